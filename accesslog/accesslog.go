@@ -0,0 +1,119 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package accesslog writes one line per handled request to the logger of nano,
+// similar to the access log of HTTP servers, e.g:
+//
+//	access route=Shop.Buy sid=12 uid=1001 path=local bytes_in=42 bytes_out=16 duration=1.2ms status=ok code=0 payload="{\"item\":3}"
+//
+// The requests are sampled by route, so that the high frequency routes can be
+// logged at a low rate while the important ones are always logged.
+package accesslog
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/lonng/nano/cluster"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/session"
+)
+
+// Config configures the access log
+type Config struct {
+	// SampleRate is the fraction of requests logged, in [0, 1]. 1 logs every request
+	// and 0 logs none unless overridden by Routes.
+	SampleRate float64
+	// Routes overrides the sample rate of routes, e.g: {"Shop.Buy": 1}
+	Routes map[string]float64
+	// Redact omits the payloads of requests entirely
+	Redact bool
+	// TraceID returns the trace id of the request if tracing is enabled, which
+	// will be logged as the trace field
+	TraceID func(s *session.Session) string
+}
+
+// Logger writes the access log of requests
+type Logger struct {
+	config Config
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// New returns an access Logger of the config
+func New(config Config) *Logger {
+	return &Logger{
+		config: config,
+		rand:   rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// sampled reports whether the request of route should be logged
+func (l *Logger) sampled(route string) bool {
+	rate, found := l.config.Routes[route]
+	if !found {
+		rate = l.config.SampleRate
+	}
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	}
+	l.mu.Lock()
+	f := l.rand.Float64()
+	l.mu.Unlock()
+	return f < rate
+}
+
+// Log writes a line for the request if it is sampled, which implements the
+// cluster.RequestLogger
+func (l *Logger) Log(info cluster.RequestInfo) {
+	if !l.sampled(info.Route) {
+		return
+	}
+	log.Println(l.format(info))
+}
+
+func (l *Logger) format(info cluster.RequestInfo) string {
+	var sid int64
+	if info.Session != nil {
+		sid = info.Session.ID()
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "access route=%s sid=%d uid=%d path=%s bytes_in=%d bytes_out=%d duration=%s status=%s code=%d",
+		info.Route, sid, info.UID, info.Path, info.BytesIn, info.BytesOut, info.Duration, info.Status, info.Code)
+	if l.config.TraceID != nil && info.Session != nil {
+		if id := l.config.TraceID(info.Session); id != "" {
+			fmt.Fprintf(b, " trace=%s", id)
+		}
+	}
+	if info.Err != nil {
+		fmt.Fprintf(b, " error=%q", info.Err.Error())
+	}
+	if !l.config.Redact {
+		fmt.Fprintf(b, " payload=%q", info.Payload)
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package accesslog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/cluster"
+	"github.com/lonng/nano/session"
+)
+
+func TestLogger_Sampled(t *testing.T) {
+	l := New(Config{SampleRate: 0.1, Routes: map[string]float64{"Shop.Buy": 1, "Room.Move": 0}})
+
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		for _, route := range []string{"Shop.Buy", "Room.Move", "Room.Chat"} {
+			if l.sampled(route) {
+				counts[route]++
+			}
+		}
+	}
+	if counts["Shop.Buy"] != 10000 {
+		t.Fatalf("expect all requests of Shop.Buy to be sampled, got: %d", counts["Shop.Buy"])
+	}
+	if counts["Room.Move"] != 0 {
+		t.Fatalf("expect no requests of Room.Move to be sampled, got: %d", counts["Room.Move"])
+	}
+	if c := counts["Room.Chat"]; c < 800 || c > 1200 {
+		t.Fatalf("expect about 10%% of requests of Room.Chat to be sampled, got: %d", c)
+	}
+}
+
+func TestLogger_Format(t *testing.T) {
+	s := session.New(nil)
+	info := cluster.RequestInfo{
+		Session:  s,
+		Route:    "Shop.Buy",
+		UID:      1001,
+		Path:     cluster.PathLocal,
+		Duration: 1500 * time.Microsecond,
+		Payload:  []byte(`{"item":3}`),
+		BytesIn:  10,
+		Status:   cluster.StatusError,
+		Code:     42,
+		Err:      errors.New("out of stock"),
+	}
+
+	traceID := func(*session.Session) string { return "abc" }
+	line := New(Config{TraceID: traceID}).format(info)
+	for _, field := range []string{"route=Shop.Buy", "uid=1001", "duration=1.5ms", "status=error", "code=42",
+		"trace=abc", `error="out of stock"`, `payload="{\"item\":3}"`} {
+		if !strings.Contains(line, field) {
+			t.Fatalf("expect %s in: %s", field, line)
+		}
+	}
+
+	line = New(Config{Redact: true}).format(info)
+	if strings.Contains(line, "payload") {
+		t.Fatalf("expect payload to be redacted: %s", line)
+	}
+}
@@ -0,0 +1,251 @@
+package nano
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/benchmark/testdata"
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/serialize"
+	jsonserializer "github.com/lonng/nano/serialize/json"
+	"github.com/lonng/nano/serialize/msgpack"
+	"github.com/lonng/nano/serialize/protobuf"
+	"github.com/lonng/nano/session"
+)
+
+// The benchmarks measure the full handler pipeline of a singleton server over
+// loopback TCP: accept, decode, deserialize, dispatch, handler, serialize, encode
+// and send. Each session sends a request and waits for its response before the
+// next one. Compare the results of two revisions with benchstat:
+//
+//	go test -run '^$' -bench Handler -benchmem -count 10 . > new.txt
+//	benchstat old.txt new.txt
+
+// benchSessions is the number of concurrent sessions of latency benchmarks
+const benchSessions = 1000
+
+var benchSerializers = []struct {
+	name       string
+	serializer serialize.Serializer
+}{
+	{"json", jsonserializer.NewSerializer()},
+	{"protobuf", protobuf.NewSerializer()},
+	{"msgpack", msgpack.NewSerializer()},
+}
+
+type BenchComponent struct {
+	component.Base
+}
+
+func (c *BenchComponent) Echo(s *session.Session, ping *testdata.Ping) error {
+	return s.Response(&testdata.Pong{Content: ping.Content})
+}
+
+var (
+	benchOnce sync.Once
+	benchAddr string
+)
+
+// startBenchServer starts the server once for all benchmarks, the serializer is
+// switched by each benchmark before the sessions are connected
+func startBenchServer(b *testing.B) string {
+	benchOnce.Do(func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			b.Fatal(err)
+		}
+		addr := ln.Addr().String()
+		ln.Close()
+
+		components := &component.Components{}
+		components.Register(&BenchComponent{})
+		go Listen(addr, WithComponents(components))
+		for i := 0; i < 100; i++ {
+			if conn, err := net.Dial("tcp", addr); err == nil {
+				conn.Close()
+				benchAddr = addr
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	if benchAddr == "" {
+		b.Fatal("bench server is not started")
+	}
+	return benchAddr
+}
+
+// benchClient is a minimal client which sends requests one by one
+type benchClient struct {
+	conn    net.Conn
+	decoder *codec.Decoder
+	pending []*packet.Packet
+	mid     uint64
+	buf     []byte
+}
+
+func dialBench(addr string) (*benchClient, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &benchClient{conn: conn, decoder: codec.NewDecoder(), buf: make([]byte, 4096)}
+	data, _ := json.Marshal(map[string]interface{}{"sys": map[string]interface{}{"version": "1.0.0"}})
+	if err := c.write(packet.Handshake, data); err != nil {
+		return nil, err
+	}
+	if _, err := c.read(packet.Handshake); err != nil {
+		return nil, err
+	}
+	if err := c.write(packet.HandshakeAck, nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *benchClient) write(typ packet.Type, data []byte) error {
+	p, err := codec.Encode(typ, data)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(p)
+	return err
+}
+
+func (c *benchClient) read(typ packet.Type) (*packet.Packet, error) {
+	for {
+		for len(c.pending) > 0 {
+			p := c.pending[0]
+			c.pending = c.pending[1:]
+			if p.Type == typ {
+				return p, nil
+			}
+		}
+		n, err := c.conn.Read(c.buf)
+		if err != nil {
+			return nil, err
+		}
+		packets, err := c.decoder.Decode(c.buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		c.pending = append(c.pending, packets...)
+	}
+}
+
+// echo sends an echo request with the payload, and waits for the response
+func (c *benchClient) echo(payload []byte) error {
+	c.mid++
+	data, err := message.Encode(&message.Message{Type: message.Request, ID: c.mid, Route: "BenchComponent.Echo", Data: payload})
+	if err != nil {
+		return err
+	}
+	if err := c.write(packet.Data, data); err != nil {
+		return err
+	}
+	p, err := c.read(packet.Data)
+	if err != nil {
+		return err
+	}
+	m, err := message.Decode(p.Data)
+	if err != nil {
+		return err
+	}
+	if m.ID != c.mid {
+		return fmt.Errorf("expect response of %d, got: %d", c.mid, m.ID)
+	}
+	return nil
+}
+
+func benchPayload(b *testing.B, s serialize.Serializer) []byte {
+	env.Serializer = s
+	payload, err := s.Marshal(&testdata.Ping{Content: "The quick brown fox jumps over the lazy dog"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return payload
+}
+
+// BenchmarkHandler_Throughput measures the messages per second and allocations
+// per message of the server and the clients, with a session per goroutine
+func BenchmarkHandler_Throughput(b *testing.B) {
+	addr := startBenchServer(b)
+	for _, bs := range benchSerializers {
+		b.Run(bs.name, func(b *testing.B) {
+			payload := benchPayload(b, bs.serializer)
+			b.ReportAllocs()
+			b.ResetTimer()
+			begin := time.Now()
+			b.RunParallel(func(pb *testing.PB) {
+				c, err := dialBench(addr)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				defer c.conn.Close()
+				for pb.Next() {
+					if err := c.echo(payload); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/time.Since(begin).Seconds(), "msgs/s")
+		})
+	}
+}
+
+// BenchmarkHandler_Latency measures the latency percentiles of requests under
+// benchSessions concurrent sessions
+func BenchmarkHandler_Latency(b *testing.B) {
+	addr := startBenchServer(b)
+	for _, bs := range benchSerializers {
+		b.Run(bs.name, func(b *testing.B) {
+			payload := benchPayload(b, bs.serializer)
+			clients := make([]*benchClient, benchSessions)
+			for i := range clients {
+				c, err := dialBench(addr)
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer c.conn.Close()
+				clients[i] = c
+			}
+
+			latencies := make([]time.Duration, b.N)
+			var wg sync.WaitGroup
+			b.ResetTimer()
+			for i, c := range clients {
+				wg.Add(1)
+				// the requests are distributed to the sessions round robin
+				go func(i int, c *benchClient) {
+					defer wg.Done()
+					for j := i; j < b.N; j += len(clients) {
+						begin := time.Now()
+						if err := c.echo(payload); err != nil {
+							b.Error(err)
+							return
+						}
+						latencies[j] = time.Since(begin)
+					}
+				}(i, c)
+			}
+			wg.Wait()
+			b.StopTimer()
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			for _, p := range []int{50, 95, 99} {
+				b.ReportMetric(float64(latencies[(len(latencies)-1)*p/100].Microseconds()), fmt.Sprintf("p%d-us", p))
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package clocktest provides a controllable clock for testing.
+package clocktest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lonng/nano/clock"
+)
+
+// Fake is a Clock which only moves forward by Advance. Tickers and timers
+// fire in the order of their deadlines while advancing, ticks of a ticker are
+// aligned to the multiples of its period since it was created.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+type waiter struct {
+	clock  *Fake
+	at     time.Time     // next fire time
+	period time.Duration // zero for timers
+	ch     chan time.Time
+	fn     func()
+}
+
+// NewFake returns a fake clock starts at the time
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Now implements the clock.Clock interface
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTicker implements the clock.Clock interface
+func (f *Fake) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("clocktest: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &waiter{clock: f, at: f.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.waiters = append(f.waiters, w)
+	return ticker{w}
+}
+
+// AfterFunc implements the clock.Clock interface, f is called synchronously
+// in Advance, so that its effects can be observed once Advance returns.
+func (f *Fake) AfterFunc(d time.Duration, fn func()) clock.Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &waiter{clock: f, at: f.now.Add(d), fn: fn}
+	f.waiters = append(f.waiters, w)
+	return w
+}
+
+// Advance moves the clock forward, and fires all tickers and timers whose
+// deadline is passed in the order of their deadlines.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	target := f.now.Add(d)
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool {
+			return f.waiters[i].at.Before(f.waiters[j].at)
+		})
+		if len(f.waiters) == 0 || f.waiters[0].at.After(target) {
+			break
+		}
+
+		w := f.waiters[0]
+		f.now = w.at
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+			// drop the tick for slow receivers like time.Ticker
+			select {
+			case w.ch <- f.now:
+			default:
+			}
+			continue
+		}
+
+		f.waiters = f.waiters[1:]
+		f.mu.Unlock()
+		w.fn()
+		f.mu.Lock()
+	}
+	f.now = target
+	f.mu.Unlock()
+}
+
+// Waiters returns the number of active tickers and timers
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// ticker adapts waiter to the clock.Ticker interface
+type ticker struct {
+	*waiter
+}
+
+func (t ticker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t ticker) Stop() {
+	t.waiter.Stop()
+}
+
+func (w *waiter) Stop() bool {
+	f := w.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.waiters {
+		if f.waiters[i] == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
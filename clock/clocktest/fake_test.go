@@ -0,0 +1,50 @@
+package clocktest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake_Ticker(t *testing.T) {
+	start := time.Unix(0, 0)
+	c := NewFake(start)
+	ticker := c.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	c.Advance(1500 * time.Millisecond)
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(start.Add(time.Second)) {
+			t.Fatalf("expect tick aligned to the period, got: %v", tick.Sub(start))
+		}
+	default:
+		t.Fatal("expect a tick")
+	}
+
+	c.Advance(500 * time.Millisecond)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("expect: 2s, got: %v", tick.Sub(start))
+	}
+	if now := c.Now(); !now.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("expect: 2s, got: %v", now.Sub(start))
+	}
+}
+
+func TestFake_AfterFunc(t *testing.T) {
+	c := NewFake(time.Unix(0, 0))
+	var fired []string
+	c.AfterFunc(2*time.Hour, func() { fired = append(fired, "2h") })
+	c.AfterFunc(time.Hour, func() { fired = append(fired, "1h") })
+	stopped := c.AfterFunc(30*time.Minute, func() { fired = append(fired, "30m") })
+	if !stopped.Stop() {
+		t.Fatal("expect timer to be stopped")
+	}
+
+	c.Advance(3 * time.Hour)
+	if len(fired) != 2 || fired[0] != "1h" || fired[1] != "2h" {
+		t.Fatalf("expect timers fired in order, got: %v", fired)
+	}
+	if c.Waiters() != 0 {
+		t.Fatalf("expect: 0, got: %d", c.Waiters())
+	}
+}
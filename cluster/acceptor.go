@@ -3,9 +3,12 @@ package cluster
 import (
 	"context"
 	"net"
+	"sync/atomic"
+	"time"
 
 	"github.com/lonng/nano/cluster/clusterpb"
 	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
 	"github.com/lonng/nano/mock"
 	"github.com/lonng/nano/session"
 )
@@ -16,7 +19,14 @@ type acceptor struct {
 	session    *session.Session
 	lastMid    uint64
 	rpcHandler rpcHandler
+	reporters  []metrics.Reporter
 	gateAddr   string
+	outBytes   int64 // bytes of serialized responses
+	responseTaps
+
+	// routes of the requests waiting for response keyed by message id, which
+	// are used to report the bytes of responses by route
+	routes pendingRoutes
 }
 
 // Push implements the session.NetworkEntity interface
@@ -26,6 +36,7 @@ func (a *acceptor) Push(route string, v interface{}) error {
 	if err != nil {
 		return err
 	}
+	metrics.ReportMessageBytes(a.reporters, route, metrics.DirectionOut, len(data))
 	request := &clusterpb.PushMessage{
 		SessionId: a.sid,
 		Route:     route,
@@ -35,20 +46,43 @@ func (a *acceptor) Push(route string, v interface{}) error {
 	return err
 }
 
-// RPC implements the session.NetworkEntity interface
-func (a *acceptor) RPC(route string, v interface{}) error {
-	// TODO: buffer
-	data, err := message.Serialize(v)
-	if err != nil {
-		return err
+// MulticastKey implements the session.Multicaster interface, the sessions served
+// by the same gate are pushed together
+func (a *acceptor) MulticastKey() string {
+	return "gate:" + a.gateAddr
+}
+
+// Multicast implements the session.Multicaster interface, the message is pushed
+// to the sessions of the gate with one request
+func (a *acceptor) Multicast(sessions []*session.Session, m *session.SharedMessage) error {
+	request := &clusterpb.MulticastMessage{
+		SessionIds: make([]int64, 0, len(sessions)),
+		Route:      m.Route,
+		Data:       m.Payload,
 	}
-	msg := &message.Message{
-		Type:  message.Notify,
-		Route: route,
-		Data:  data,
+	for _, s := range sessions {
+		if ac, ok := s.NetworkEntity().(*acceptor); ok {
+			request.SessionIds = append(request.SessionIds, ac.sid)
+			metrics.ReportMessageBytes(ac.reporters, m.Route, metrics.DirectionOut, len(m.Payload))
+		}
 	}
-	a.rpcHandler(a.session, msg, true)
-	return nil
+	_, err := a.gateClient.HandleMulticast(context.Background(), request)
+	return err
+}
+
+// RPC implements the session.NetworkEntity interface
+func (a *acceptor) RPC(route string, v interface{}) error {
+	return logRPC(route, callRPC(context.Background(), a.rpcHandler, a.session, route, v))
+}
+
+// RPCContext implements the session.ContextRPCer interface
+func (a *acceptor) RPCContext(ctx context.Context, route string, v interface{}) error {
+	return callRPC(ctx, a.rpcHandler, a.session, route, v)
+}
+
+// RPCWithFallback implements the session.FallbackRPCer interface
+func (a *acceptor) RPCWithFallback(route string, v interface{}, timeout time.Duration, fallback func(error) error) error {
+	return callRPCWithFallback(a.rpcHandler, a.reporters, a.session, route, v, timeout, fallback)
 }
 
 // LastMid implements the session.NetworkEntity interface
@@ -68,6 +102,11 @@ func (a *acceptor) ResponseMid(mid uint64, v interface{}) error {
 	if err != nil {
 		return err
 	}
+	atomic.AddInt64(&a.outBytes, int64(len(data)))
+	a.record(mid, data)
+	if route, ok := a.routes.take(mid); ok {
+		metrics.ReportMessageBytes(a.reporters, route, metrics.DirectionOut, len(data))
+	}
 	request := &clusterpb.ResponseMessage{
 		SessionId: a.sid,
 		Id:        mid,
@@ -77,6 +116,10 @@ func (a *acceptor) ResponseMid(mid uint64, v interface{}) error {
 	return err
 }
 
+func (a *acceptor) bytesOut() int64 {
+	return atomic.LoadInt64(&a.outBytes)
+}
+
 // Close implements the session.NetworkEntity interface
 func (a *acceptor) Close() error {
 	// TODO: buffer
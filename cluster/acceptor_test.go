@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/session"
+	"google.golang.org/grpc"
+)
+
+// countingMember counts the multicast requests served by the node
+type countingMember struct {
+	*Node
+	multicasts int
+}
+
+func (m *countingMember) HandleMulticast(ctx context.Context, req *clusterpb.MulticastMessage) (*clusterpb.UserMessageResponse, error) {
+	m.multicasts++
+	return m.Node.HandleMulticast(ctx, req)
+}
+
+func TestAcceptor_Multicast(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontend := &Node{ServiceAddr: listener.Addr().String()}
+	frontend.sessions = map[int64]*session.Session{}
+	member := &countingMember{Node: frontend}
+	server := grpc.NewServer()
+	clusterpb.RegisterMemberServer(server, member)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	backend := &Node{ServiceAddr: "127.0.0.1:0", rpcClient: newRPCClient()}
+	backend.sessions = map[int64]*session.Session{}
+	defer backend.rpcClient.closePool()
+
+	var clients []net.Conn
+	var members []*session.Session
+	for i := 0; i < 2; i++ {
+		conn, client := net.Pipe()
+		defer client.Close()
+		a := newAgent(conn, nil, nil, nil)
+		go a.write()
+		frontend.storeSession(a.session)
+		s, err := backend.findOrCreateSession(a.session.ID(), frontend.ServiceAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, client)
+		members = append(members, s)
+	}
+	// the session closed on the frontend is reported missing
+	gone, err := backend.findOrCreateSession(-1, frontend.ServiceAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members = append(members, gone)
+
+	m := session.NewSharedMessage("chat.world", []byte("hello"))
+	defer m.Release()
+	done := make(chan struct{})
+	go func() {
+		session.PushSharedAll(members, m, func(s *session.Session, err error) {
+			t.Errorf("unexpected error of session %d: %v", s.ID(), err)
+		})
+		close(done)
+	}()
+	for _, client := range clients {
+		if p := readPush(t, client, message.V1); p.Route != "chat.world" || string(p.Data) != "hello" {
+			t.Fatalf("unexpected message: route=%s, data=%s", p.Route, p.Data)
+		}
+	}
+	<-done
+	if member.multicasts != 1 {
+		t.Fatalf("expect 1 multicast request, got: %d", member.multicasts)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/lonng/nano/internal/log"
+)
+
+// listenAndServeAdmin serves the admin endpoints of current node:
+//
+//	POST /drain    migrates all client sessions to the other frontend nodes
+//	GET  /ring     reports the fraction of keys routed to each member by the
+//	               consistent hash rings of remote services
+//	GET  /components
+//	               lists the registered components with their handler routes
+//	               and in-flight invocations
+//	POST /components/resume?name=<component>
+//	               resumes the component suspended for exceeding its quota
+func (n *Node) listenAndServeAdmin() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/drain", n.handleDrain)
+	mux.HandleFunc("/ring", n.handleRing)
+	mux.HandleFunc("/components", n.handleComponents)
+	mux.HandleFunc("/components/resume", n.handleResumeComponent)
+
+	listenConfig := net.ListenConfig{
+		Control: Control,
+	}
+	server := &http.Server{Addr: n.AdminAddr, Handler: mux}
+	ln, err := listenConfig.Listen(context.Background(), "tcp", server.Addr)
+	if err != nil {
+		log.Println("Admin server startup failed", err.Error())
+		return
+	}
+
+	n.addServer(server)
+	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Println("Admin server exit", err.Error())
+	}
+}
+
+func (n *Node) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := n.Drain()
+	resp := struct {
+		DrainResult
+		Error string `json:"error,omitempty"`
+	}{DrainResult: result}
+	if err != nil {
+		resp.Error = err.Error()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (n *Node) handleRing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	json.NewEncoder(w).Encode(n.handler.ringShares())
+}
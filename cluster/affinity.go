@@ -0,0 +1,182 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+// SessionAffinityRouter routes the requests of a user to the same member of a
+// remote service by rendezvous hashing, so the sequential requests of the user
+// never race on the shared state of different members. Each member is scored by
+// the hash of its address and the uid, and the member with the highest score wins,
+// so only the users owned by the changed member are moved when members are added
+// or removed. The weight of member, specified in its label as `weight=N`, scales
+// its share of users.
+//
+// The member chosen for a user is bound to the session router, and a request is
+// counted as an affinity miss if it is routed to another member than the bound
+// one since the members have been re-balanced. The member pinned by
+// Session.MigrateTo takes precedence as long as it serves the service.
+type SessionAffinityRouter struct {
+	reporters []metrics.Reporter
+}
+
+// NewSessionAffinityRouter returns a router which reports the affinity misses to
+// reporters
+func NewSessionAffinityRouter(reporters ...metrics.Reporter) *SessionAffinityRouter {
+	return &SessionAffinityRouter{reporters: reporters}
+}
+
+// Route returns the address of the member which serves the service for session.
+// The session is routed by its id before it is bound to a uid, and is not bound
+// to the member, since the id is not stable across connections.
+func (r *SessionAffinityRouter) Route(s *session.Session, service string, members []*clusterpb.MemberInfo) string {
+	if addr, found := s.Router().Pinned(service); found {
+		for _, m := range members {
+			if m.ServiceAddr == addr {
+				return addr
+			}
+		}
+	}
+	uid := s.UID()
+	if uid == 0 {
+		return rendezvous(strconv.FormatInt(s.ID(), 10), members)
+	}
+	addr := rendezvous(strconv.FormatInt(uid, 10), members)
+	if bound, found := s.Router().Find(service); found && bound != addr {
+		metrics.ReportAffinityMiss(r.reporters, service)
+	}
+	s.Router().Bind(service, addr)
+	return addr
+}
+
+// rendezvous returns the address of member with the highest weighted score for
+// the key, the score is -weight/ln(u) where u is the hash of key and member
+// address mapped to (0, 1)
+func rendezvous(key string, members []*clusterpb.MemberInfo) string {
+	var (
+		addr string
+		best = math.Inf(-1)
+	)
+	for _, m := range members {
+		u := (float64(hashKey(m.ServiceAddr+"#"+key)>>11) + 0.5) / (1 << 53)
+		score := -float64(memberWeight(m.Label)) / math.Log(u)
+		if score > best {
+			best, addr = score, m.ServiceAddr
+		}
+	}
+	return addr
+}
+
+// migrateAffinity pins the services served by the member at addr to it for the
+// session, and copies the session attributes to the member if withAttributes is
+// true. The members which no longer serve any service of the session are notified
+// with the session closed by the reason session.CloseReasonMigrated.
+func (h *LocalHandler) migrateAffinity(s *session.Session, addr string, withAttributes bool) error {
+	var services []string
+	h.mu.RLock()
+	for service, members := range h.remoteServices {
+		for _, m := range members {
+			if m.ServiceAddr == addr {
+				services = append(services, service)
+				break
+			}
+		}
+	}
+	h.mu.RUnlock()
+	if len(services) == 0 {
+		return ErrMemberNotFound
+	}
+
+	client, err := h.currentNode.rpcClient.memberClient(addr)
+	if err != nil {
+		return err
+	}
+	if withAttributes {
+		req := &clusterpb.MigrateAffinityRequest{
+			GateAddr:   h.currentNode.ServiceAddr,
+			SessionId:  s.ID(),
+			Attributes: encodeAttributes(s.State()),
+		}
+		if _, err := client.MigrateAffinity(context.Background(), req); err != nil {
+			return err
+		}
+	}
+
+	previous := map[string]bool{}
+	for _, service := range services {
+		old, found := s.Router().Find(service)
+		if !found && h.affinity == nil && h.currentNode.ConsistentHash {
+			// the services routed by the hash ring are not bound
+			key := s.UID()
+			if key == 0 {
+				key = s.ID()
+			}
+			old, found = h.hashRing(service).get(strconv.FormatInt(key, 10)), true
+		}
+		if found && old != addr {
+			previous[old] = true
+		}
+		s.Router().Pin(service, addr)
+	}
+
+	request := &clusterpb.SessionClosedRequest{
+		SessionId: s.ID(),
+		Reason:    string(session.CloseReasonMigrated),
+	}
+	for old := range previous {
+		// the member still serves the other services of the session
+		if len(s.Router().Services(old)) > 0 {
+			continue
+		}
+		client, err := h.currentNode.rpcClient.memberClient(old)
+		if err != nil {
+			log.Println("Cannot retrieve connection pool for address", old, err)
+			continue
+		}
+		if _, err := client.SessionClosed(context.Background(), request); err != nil {
+			log.Println("Cannot notify migrated session to address", old, err)
+		}
+	}
+
+	session.Lifetime.Publish(session.Event{Type: session.EventMigrated, Session: s, Member: addr})
+	return nil
+}
+
+// MigrateAffinity implements the MemberServer interface, the attributes of the
+// migrated session replace the ones set on current node
+func (n *Node) MigrateAffinity(_ context.Context, req *clusterpb.MigrateAffinityRequest) (*clusterpb.MigrateAffinityResponse, error) {
+	s, err := n.findOrCreateSession(req.SessionId, req.GateAddr)
+	if err != nil {
+		return nil, err
+	}
+	s.Restore(decodeAttributes(req.Attributes))
+	session.Lifetime.Publish(session.Event{Type: session.EventDataSynced, Session: s})
+	return &clusterpb.MigrateAffinityResponse{}, nil
+}
@@ -0,0 +1,210 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+	"google.golang.org/grpc"
+)
+
+func TestRendezvous_Rebalance(t *testing.T) {
+	members := []*clusterpb.MemberInfo{
+		{ServiceAddr: "127.0.0.1:4001"},
+		{ServiceAddr: "127.0.0.1:4002", Label: "weight=2"},
+	}
+	const keys = 30000
+	owners := make([]string, keys)
+	counts := map[string]int{}
+	for i := range owners {
+		owners[i] = rendezvous(strconv.Itoa(i), members)
+		counts[owners[i]]++
+	}
+	if f := float64(counts["127.0.0.1:4002"]) / keys; math.Abs(f-2.0/3) > 0.03 {
+		t.Fatalf("expect about 2/3 of keys on the heavier member, got: %.3f", f)
+	}
+
+	// only the keys moved to the new member change their owners
+	members = append(members, &clusterpb.MemberInfo{ServiceAddr: "127.0.0.1:4003"})
+	moved := 0
+	for i, owner := range owners {
+		if addr := rendezvous(strconv.Itoa(i), members); addr != owner {
+			if addr != "127.0.0.1:4003" {
+				t.Fatalf("key %d moved from %s to %s", i, owner, addr)
+			}
+			moved++
+		}
+	}
+	if f := float64(moved) / keys; math.Abs(f-0.25) > 0.03 {
+		t.Fatalf("expect about 1/4 of keys moved, got: %.3f", f)
+	}
+}
+
+func TestSessionAffinityRouter_Miss(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	r := NewSessionAffinityRouter(reporter)
+	members := []*clusterpb.MemberInfo{{ServiceAddr: "127.0.0.1:4001"}, {ServiceAddr: "127.0.0.1:4002"}}
+
+	s := session.New(&acceptor{})
+	// not bound to a member before login
+	r.Route(s, "Room", members)
+	if _, found := s.Router().Find("Room"); found {
+		t.Fatal("expect the anonymous session not bound")
+	}
+
+	if err := s.Bind(35501); err != nil {
+		t.Fatal(err)
+	}
+	addr := r.Route(s, "Room", members)
+	for i := 0; i < 10; i++ {
+		if a := r.Route(s, "Room", members); a != addr {
+			t.Fatalf("expect the affine member %s, got: %s", addr, a)
+		}
+	}
+	if bound, _ := s.Router().Find("Room"); bound != addr {
+		t.Fatalf("expect bound to %s, got: %s", bound, addr)
+	}
+
+	// the affine member is removed
+	var rest []*clusterpb.MemberInfo
+	for _, m := range members {
+		if m.ServiceAddr != addr {
+			rest = append(rest, m)
+		}
+	}
+	if a := r.Route(s, "Room", rest); a != rest[0].ServiceAddr {
+		t.Fatalf("expect re-balanced to %s, got: %s", rest[0].ServiceAddr, a)
+	}
+	r.Route(s, "Room", rest)
+	if v := reporter.value(metrics.AffinityMisses + "{service=Room}"); v != 1 {
+		t.Fatalf("expect 1 affinity miss, got: %v", v)
+	}
+}
+
+func TestSessionAffinityRouter_Pinned(t *testing.T) {
+	r := NewSessionAffinityRouter()
+	members := []*clusterpb.MemberInfo{{ServiceAddr: "127.0.0.1:4001"}, {ServiceAddr: "127.0.0.1:4002"}}
+
+	s := session.New(&acceptor{})
+	if err := s.Bind(35502); err != nil {
+		t.Fatal(err)
+	}
+	addr := r.Route(s, "Room", members)
+	other := members[0].ServiceAddr
+	if other == addr {
+		other = members[1].ServiceAddr
+	}
+	s.Router().Pin("Room", other)
+	if a := r.Route(s, "Room", members); a != other {
+		t.Fatalf("expect the pinned member %s, got: %s", other, a)
+	}
+
+	// re-balanced if the pinned member is gone
+	if a := r.Route(s, "Room", members[:0:0]); a != "" {
+		t.Fatalf("expect no member, got: %s", a)
+	}
+	rest := []*clusterpb.MemberInfo{{ServiceAddr: addr}}
+	if a := r.Route(s, "Room", rest); a != addr {
+		t.Fatalf("expect re-balanced to %s, got: %s", addr, a)
+	}
+}
+
+func TestLocalHandler_MigrateAffinity(t *testing.T) {
+	var backends []*Node
+	var members []*clusterpb.MemberInfo
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := &Node{ServiceAddr: listener.Addr().String(), rpcClient: newRPCClient()}
+		n.sessions = map[int64]*session.Session{}
+		defer n.rpcClient.closePool()
+		server := grpc.NewServer()
+		clusterpb.RegisterMemberServer(server, n)
+		go server.Serve(listener)
+		defer server.Stop()
+		backends = append(backends, n)
+		members = append(members, &clusterpb.MemberInfo{ServiceAddr: n.ServiceAddr, Services: []string{"Match"}})
+	}
+
+	frontend := &Node{ServiceAddr: "127.0.0.1:0", rpcClient: newRPCClient()}
+	defer frontend.rpcClient.closePool()
+	frontend.sessions = map[int64]*session.Session{}
+	h := NewHandler(frontend, nil)
+	h.initRemoteService(members)
+
+	migrated := make(chan session.Event, 1)
+	sub := session.Lifetime.Subscribe(func(e session.Event) { migrated <- e }, session.EventMigrated)
+	defer sub.Unsubscribe()
+
+	conn, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(conn, nil, nil, nil)
+	a.migrate = func(addr string, withAttributes bool) error {
+		return h.migrateAffinity(a.session, addr, withAttributes)
+	}
+	s := a.session
+	s.Router().Bind("Match", backends[0].ServiceAddr)
+	if _, err := backends[0].findOrCreateSession(s.ID(), frontend.ServiceAddr); err != nil {
+		t.Fatal(err)
+	}
+	s.Set("score", 42)
+
+	if err := s.MigrateTo("127.0.0.1:1", false); err != ErrMemberNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrMemberNotFound, err)
+	}
+	if err := s.MigrateTo(backends[1].ServiceAddr, true); err != nil {
+		t.Fatal(err)
+	}
+	if addr, _ := s.Router().Find("Match"); addr != backends[1].ServiceAddr {
+		t.Fatalf("expect routed to %s, got: %s", backends[1].ServiceAddr, addr)
+	}
+	if e := <-migrated; e.Session != s || e.Member != backends[1].ServiceAddr {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	// the attributes are copied to the new member, and the session is released
+	// by the old one
+	backends[1].mu.RLock()
+	remote := backends[1].sessions[s.ID()]
+	backends[1].mu.RUnlock()
+	if remote == nil || remote.Int("score") != 42 {
+		t.Fatalf("expect the attributes migrated, got: %v", remote)
+	}
+	backends[0].mu.RLock()
+	_, found := backends[0].sessions[s.ID()]
+	backends[0].mu.RUnlock()
+	if found {
+		t.Fatal("expect the session released by the old member")
+	}
+
+	// the sessions of backend nodes can not be migrated
+	if err := remote.MigrateTo(backends[0].ServiceAddr, false); err != session.ErrMigrationUnsupported {
+		t.Fatalf("expect: %v, got: %v", session.ErrMigrationUnsupported, err)
+	}
+}
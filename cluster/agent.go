@@ -21,27 +21,56 @@
 package cluster
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"reflect"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/lonng/nano/encryption"
 	"github.com/lonng/nano/internal/codec"
 	"github.com/lonng/nano/internal/env"
 	"github.com/lonng/nano/internal/log"
 	"github.com/lonng/nano/internal/message"
 	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/metrics"
 	"github.com/lonng/nano/pipeline"
 	"github.com/lonng/nano/scheduler"
 	"github.com/lonng/nano/session"
 )
 
+// Default sizes of the per connection buffers, each connection holds one
+// read buffer and one write buffer for its whole lifetime.
+const (
+	// DefaultReadBufferSize is large enough for most requests to be read
+	// with a single syscall.
+	DefaultReadBufferSize = 2048
+	// DefaultWriteBufferSize lets a burst of small pushes to be coalesced
+	// into one write, larger payloads bypass the buffer.
+	DefaultWriteBufferSize = 4096
+)
+
 const (
 	agentWriteBacklog = 100 //原16,调高缓存
+	// the buffer holds the largest packet of raw pushes
+	rawBufferSize = codec.HeadLength + codec.MaxPacketSize
+	// the agent is closed without waiting for the kick packet any more, e.g: the
+	// slow clients may not read either
+	kickTimeout = 5 * time.Second
 )
 
+var rawBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, rawBufferSize)
+		return &buf
+	},
+}
+
 var (
 	// ErrBrokenPipe represents the low-level connection has broken.
 	ErrBrokenPipe = errors.New("broken low-level pipe")
@@ -52,19 +81,50 @@ type (
 	// Agent corresponding a user, used for store raw conn information
 	agent struct {
 		// regular agent member
-		session  *session.Session    // session
-		conn     net.Conn            // low-level conn fd
-		lastMid  uint64              // last message id
-		state    int32               // current agent state
-		chDie    chan struct{}       // wait for close
-		chSend   chan pendingMessage // push message queue
-		lastAt   int64               // last heartbeat unix time stamp
-		decoder  *codec.Decoder      // binary decoder
+		session  *session.Session // session
+		conn     net.Conn         // low-level conn fd
+		lastMid  uint64           // last message id
+		state    int32            // current agent state
+		chDie    chan struct{}    // wait for close
+		chSend   *sendQueue       // push message queue
+		lastAt   int64            // last heartbeat unix time stamp
+		decoder  *codec.Decoder   // binary decoder
 		pipeline pipeline.Pipeline
 
+		transport  pipeline.Pipeline // transport stages, e.g: payload encryption
 		rpcHandler rpcHandler
 		srv        reflect.Value // cached session reflect.Value
 		increase   uint32
+		outBytes   int64     // bytes of serialized responses
+		protocol   int32     // negotiated protocol version of message layer
+		writeSize  int       // size of the write buffer, zero for unbuffered writes
+		reaped     bool      // idle timeout is checked by the reaper of node
+		seq        uint64    // last sequence id of reliable pushes
+		acks       *ackTable // reliable pushes waiting for acknowledgement
+
+		// reporters report the rpcs answered by the fallback and the message sizes
+		reporters []metrics.Reporter
+		// routes of the requests waiting for response keyed by message id, which
+		// are tracked only if the metrics reporters are set
+		routes pendingRoutes
+
+		// fallback is called when pushing to the agent after it is closed
+		fallback func(uid int64, route string, v interface{})
+		// migrate moves the backend affinity of the session, see Session.MigrateTo
+		migrate func(addr string, withAttributes bool) error
+		// the reason set by the first caller, which is reported in the session
+		// closed event
+		closeOnce   sync.Once
+		closeReason session.CloseReason
+
+		// resumeNonce identifies the resume token issued in handshake, zero if no
+		// token is issued. suspend keeps the session for resuming when the
+		// connection is broken, and suspended holds the *suspendedSession.
+		resumeNonce uint64
+		suspend     func(reason session.CloseReason) *suspendedSession
+		suspended   atomic.Value
+		resumed     *suspendedSession // replayed once the handshake is acknowledged
+		responseTaps
 	}
 
 	pendingMessage struct {
@@ -72,20 +132,33 @@ type (
 		route   string       // message route(push)
 		mid     uint64       // response message id(response)
 		payload interface{}  // payload
+
+		raw    io.Reader  // payload streamed to the connection(raw push)
+		length int        // length of raw payload
+		done   chan error // receives the result of writing raw payload or kick message
+
+		packet []byte // encoded packet written as is(kick, redirect)
+
+		batch []pendingMessage // serialized messages written at once(batch push)
+
+		shared *session.SharedMessage // packet shared with other agents(broadcast)
 	}
 )
 
 // Create new agent instance
-func newAgent(conn net.Conn, pipeline pipeline.Pipeline, rpcHandler rpcHandler) *agent {
+func newAgent(conn net.Conn, pipeline, transport pipeline.Pipeline, rpcHandler rpcHandler) *agent {
 	a := &agent{
 		conn:       conn,
 		state:      statusStart,
 		chDie:      make(chan struct{}),
-		lastAt:     time.Now().Unix(),
-		chSend:     make(chan pendingMessage, agentWriteBacklog),
+		lastAt:     env.Clock.Now().Unix(),
+		chSend:     newSendQueue(agentWriteBacklog),
 		decoder:    codec.NewDecoder(),
+		protocol:   message.V1,
 		pipeline:   pipeline,
+		transport:  transport,
 		rpcHandler: rpcHandler,
+		acks:       newAckTable(0, 0, nil),
 	}
 
 	// binding session
@@ -96,14 +169,31 @@ func newAgent(conn net.Conn, pipeline pipeline.Pipeline, rpcHandler rpcHandler)
 	return a
 }
 
-func (a *agent) send(m pendingMessage) (err error) {
-	defer func() {
-		if e := recover(); e != nil {
-			err = ErrBrokenPipe
-		}
-	}()
-	a.chSend <- m
-	return
+// Protocol implements the session.ProtocolVersioner interface
+func (a *agent) Protocol() int {
+	return int(atomic.LoadInt32(&a.protocol))
+}
+
+// messageCodec returns the message codec of the negotiated protocol version
+func (a *agent) messageCodec() message.Codec {
+	return message.CodecOf(int(atomic.LoadInt32(&a.protocol)))
+}
+
+func (a *agent) send(m pendingMessage, priority int) error {
+	return a.chSend.push(m, priority)
+}
+
+// overflow is called when a message is pushed to the full send queue, the agent is
+// closed if the policy is OverflowClose
+func (a *agent) overflow(policy OverflowPolicy) {
+	metrics.ReportSendQueueOverflow(a.reporters, policy.String())
+	if policy != OverflowClose {
+		return
+	}
+	log.Println(fmt.Sprintf("Session send queue overflow, ID=%d, UID=%d, Remote=%s",
+		a.session.ID(), a.session.UID(), a.RemoteAddr()))
+	metrics.ReportSessionKicked(a.reporters, kickReasonQueueOverflow)
+	a.closeWith(session.CloseReasonOverflow)
 }
 
 // LastMid implements the session.NetworkEntity interface
@@ -113,7 +203,20 @@ func (a *agent) LastMid() uint64 {
 
 // Push, implementation for session.NetworkEntity interface
 func (a *agent) Push(route string, v interface{}) error {
+	return a.PushWithPriority(route, v, session.PriorityNormal)
+}
+
+// PushWithPriority, implementation for session.PriorityPusher interface
+// Messages with higher priority will be written first when the send queue has a backlog
+func (a *agent) PushWithPriority(route string, v interface{}, priority int) error {
 	if a.status() == statusClosed {
+		// kept for the client to resume
+		if ss := a.suspension(); ss != nil && ss.add(pendingMessage{typ: message.Push, route: route, payload: v}) {
+			return nil
+		}
+		if a.fallback != nil {
+			a.fallback(a.session.UID(), route, v)
+		}
 		return ErrBrokenPipe
 	}
 
@@ -136,27 +239,255 @@ func (a *agent) Push(route string, v interface{}) error {
 		}
 	}
 
-	return a.send(pendingMessage{typ: message.Push, route: route, payload: v})
+	return a.send(pendingMessage{typ: message.Push, route: route, payload: v}, priority)
 }
 
-// RPC, implementation for session.NetworkEntity interface
-func (a *agent) RPC(route string, v interface{}) error {
+// PushShared, implementation for session.SharedPusher interface
+// The packet of the message is encoded once and shared by all the agents speaking
+// the same protocol version. The message is pushed as a normal one if the packet
+// has to be processed by the pipelines or encrypted for the session.
+func (a *agent) PushShared(m *session.SharedMessage) error {
+	if a.pipeline != nil || a.transport != nil || encryption.CipherOf(a.session) != nil {
+		return a.Push(m.Route, m.Payload)
+	}
 	if a.status() == statusClosed {
+		if a.fallback != nil {
+			a.fallback(a.session.UID(), m.Route, m.Payload)
+		}
 		return ErrBrokenPipe
 	}
 
-	// TODO: buffer
-	data, err := message.Serialize(v)
+	if env.Debug {
+		log.Println(fmt.Sprintf("Type=Push, ID=%d, UID=%d, Route=%s, Data=%dbytes(shared)",
+			a.session.ID(), a.session.UID(), m.Route, len(m.Payload)))
+	}
+
+	m.Retain()
+	if err := a.send(pendingMessage{typ: message.Push, route: m.Route, shared: m}, session.PriorityNormal); err != nil {
+		m.Release()
+		return err
+	}
+	return nil
+}
+
+// writeShared writes the packet of a shared message and releases the reference held
+// by the agent. The returned error indicates the connection is broken.
+func (a *agent) writeShared(w io.Writer, m *session.SharedMessage) error {
+	defer m.Release()
+
+	p, err := m.Packet(a.Protocol())
 	if err != nil {
+		log.Println(fmt.Sprintf("Push: %s error: %s", m.Route, err.Error()))
+		return nil
+	}
+	metrics.ReportMessageBytes(a.reporters, m.Route, metrics.DirectionOut, len(m.Payload))
+	_, err = w.Write(p)
+	return err
+}
+
+// SendRaw, implementation for session.RawSender interface
+// The payload is read from r into a pooled buffer and written to the low-level connection
+// with the packet header by the write goroutine, and SendRaw blocks until the packet has
+// been written. The packet is limited by codec.MaxPacketSize.
+func (a *agent) SendRaw(route string, r io.Reader, length int) error {
+	if a.status() == statusClosed {
+		return ErrBrokenPipe
+	}
+	if length < 0 || length > codec.MaxPacketSize {
+		return codec.ErrPacketSizeExcced
+	}
+
+	// the pipeline and encryption stages process the whole payload, so it has to be
+	// read into memory
+	if a.pipeline != nil || encryption.CipherOf(a.session) != nil {
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		return a.Push(route, data)
+	}
+
+	done := make(chan error, 1)
+	m := pendingMessage{typ: message.Push, route: route, raw: r, length: length, done: done}
+	if err := a.send(m, session.PriorityNormal); err != nil {
 		return err
 	}
-	msg := &message.Message{
-		Type:  message.Notify,
-		Route: route,
-		Data:  data,
+	select {
+	case err := <-done:
+		return err
+	case <-a.chDie:
+		return ErrBrokenPipe
 	}
-	a.rpcHandler(a.session, msg, true)
-	return nil
+}
+
+// writeRaw reads the payload of a raw push into a pooled buffer after the packet
+// header and message header, then writes the packet with a single write, so the
+// message based transports, e.g: websocket, deliver it as one message. The returned
+// error indicates the connection is broken, other errors are reported to the sender
+// only.
+func (a *agent) writeRaw(m pendingMessage) error {
+	em, err := a.messageCodec().Encode(&message.Message{Type: m.typ, Route: m.route})
+	if err != nil {
+		m.done <- err
+		return nil
+	}
+	head, err := codec.EncodeHead(packet.Data, len(em)+m.length)
+	if err != nil {
+		m.done <- err
+		return nil
+	}
+
+	buf := rawBufferPool.Get().(*[]byte)
+	defer rawBufferPool.Put(buf)
+
+	n := copy(*buf, head)
+	n += copy((*buf)[n:], em)
+	if _, err := io.ReadFull(m.raw, (*buf)[n:n+m.length]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		m.done <- err
+		return nil
+	}
+
+	_, err = a.conn.Write((*buf)[:n+m.length])
+	m.done <- err
+	return err
+}
+
+// SendBatch, implementation for session.BatchSender interface
+// The messages are serialized by the caller, and then encoded and written to the
+// low-level connection with a single write by the write goroutine.
+func (a *agent) SendBatch(messages []session.BatchMessage) error {
+	if a.status() == statusClosed {
+		if a.fallback != nil {
+			for _, m := range messages {
+				a.fallback(a.session.UID(), m.Route, m.Payload)
+			}
+		}
+		return ErrBrokenPipe
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	batch := make([]pendingMessage, 0, len(messages))
+	for _, m := range messages {
+		route := m.Route
+		if _, ok := m.Payload.([]byte); env.ProtoRoute && !ok {
+			route = reflect.TypeOf(m.Payload).Elem().Name()
+		}
+		data, err := message.Serialize(m.Payload)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, pendingMessage{typ: message.Push, route: route, payload: data})
+	}
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("Type=Batch, ID=%d, UID=%d, Messages=%d",
+			a.session.ID(), a.session.UID(), len(batch)))
+	}
+
+	return a.send(pendingMessage{typ: message.Push, batch: batch}, session.PriorityNormal)
+}
+
+// writeBatch encodes the messages of a batch and writes them with a single write,
+// the whole batch is dropped if any message fails to encode. The returned error
+// indicates the connection is broken.
+func (a *agent) writeBatch(batch []pendingMessage) error {
+	var buf []byte
+	for _, m := range batch {
+		p := a.encode(m)
+		if p == nil {
+			log.Println(fmt.Sprintf("Batch: %d messages dropped", len(batch)))
+			return nil
+		}
+		buf = append(buf, p...)
+	}
+	_, err := a.conn.Write(buf)
+	return err
+}
+
+// encode serializes the pending message and encodes it to a packet, nil is returned
+// and the error is logged if the message should be dropped.
+func (a *agent) encode(data pendingMessage) []byte {
+	payload, err := message.Serialize(data.payload)
+	if err != nil {
+		switch data.typ {
+		case message.Push:
+			log.Println(fmt.Sprintf("Push: %s error: %s", data.route, err.Error()))
+		case message.Response:
+			log.Println(fmt.Sprintf("Response message(id: %d) error: %s", data.mid, err.Error()))
+		default:
+			// expect
+		}
+		return nil
+	}
+
+	// the responses are reported with the route of their requests
+	if data.typ != message.Response {
+		metrics.ReportMessageBytes(a.reporters, data.route, metrics.DirectionOut, len(payload))
+	}
+
+	// construct message and encode
+	m := &message.Message{
+		Type:  data.typ,
+		Data:  payload,
+		Route: data.route,
+		ID:    data.mid,
+	}
+	if pipe := a.pipeline; pipe != nil {
+		err := pipe.Outbound().Process(a.session, m)
+		if err != nil {
+			log.Println("broken pipeline", err.Error())
+			return nil
+		}
+	}
+	if t := a.transport; t != nil {
+		if err := t.Outbound().Process(a.session, m); err != nil {
+			log.Println("broken transport pipeline", err.Error())
+			return nil
+		}
+	}
+
+	em, err := a.messageCodec().Encode(m)
+	if err != nil {
+		log.Println(err.Error())
+		return nil
+	}
+
+	// packet encode
+	p, err := codec.Encode(packet.Data, em)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return p
+}
+
+// RPC, implementation for session.NetworkEntity interface
+func (a *agent) RPC(route string, v interface{}) error {
+	if a.status() == statusClosed {
+		return ErrBrokenPipe
+	}
+	return logRPC(route, callRPC(context.Background(), a.rpcHandler, a.session, route, v))
+}
+
+// RPCContext implements the session.ContextRPCer interface
+func (a *agent) RPCContext(ctx context.Context, route string, v interface{}) error {
+	if a.status() == statusClosed {
+		return ErrBrokenPipe
+	}
+	return callRPC(ctx, a.rpcHandler, a.session, route, v)
+}
+
+// RPCWithFallback implements the session.FallbackRPCer interface
+func (a *agent) RPCWithFallback(route string, v interface{}, timeout time.Duration, fallback func(error) error) error {
+	if a.status() == statusClosed {
+		return ErrBrokenPipe
+	}
+	return callRPCWithFallback(a.rpcHandler, a.reporters, a.session, route, v, timeout, fallback)
 }
 
 // Response, implementation for session.NetworkEntity interface
@@ -187,13 +518,43 @@ func (a *agent) ResponseMid(mid uint64, v interface{}) error {
 		}
 	}
 
-	return a.send(pendingMessage{typ: message.Response, mid: mid, payload: v})
+	// serialize the response eagerly, so the bytes can be attributed to the
+	// request being processed
+	data, err := message.Serialize(v)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&a.outBytes, int64(len(data)))
+	a.record(mid, data)
+	if route, ok := a.routes.take(mid); ok {
+		metrics.ReportMessageBytes(a.reporters, route, metrics.DirectionOut, len(data))
+	}
+
+	return a.send(pendingMessage{typ: message.Response, mid: mid, payload: data}, session.PriorityNormal)
+}
+
+func (a *agent) bytesOut() int64 {
+	return atomic.LoadInt64(&a.outBytes)
 }
 
 // Close, implementation for session.NetworkEntity interface
 // Close closes the agent, clean inner state and close low-level connection.
 // Any blocked Read or Write operations will be unblocked and return errors.
 func (a *agent) Close() error {
+	// the session closed by the application can not be resumed any more
+	if ss := a.suspension(); ss != nil {
+		ss.expire()
+	}
+	return a.close()
+}
+
+// closeWith closes the agent with the reason, unless another reason has been set
+func (a *agent) closeWith(reason session.CloseReason) error {
+	a.setCloseReason(reason)
+	return a.close()
+}
+
+func (a *agent) close() error {
 	//defer a.session.Deattach()
 	if a.status() == statusClosed {
 		return ErrCloseClosedSession
@@ -210,13 +571,115 @@ func (a *agent) Close() error {
 	case <-a.chDie:
 		// expect
 	default:
+		a.setCloseReason(session.CloseReasonClosed)
+		reason := a.closeReason
+		var ss *suspendedSession
+		if a.suspend != nil {
+			ss = a.suspend(reason)
+		}
+		if ss != nil {
+			a.suspended.Store(ss)
+		}
 		close(a.chDie)
-		scheduler.PushTask(func() { session.Lifetime.Close(a.session) })
+		a.acks.close()
+		// the lifetime of the suspended session ends when it expires
+		if ss == nil {
+			closeSession(a.reporters, a.session, reason)
+		}
 	}
 
 	return a.conn.Close()
 }
 
+// closeSession counts the closed session by the reason, and fires its closed
+// callbacks with the reason in the scheduler
+func closeSession(reporters []metrics.Reporter, s *session.Session, reason session.CloseReason) {
+	metrics.ReportSessionClosed(reporters, string(reason))
+	scheduler.PushTask(func() { session.Lifetime.CloseWithReason(s, reason) })
+}
+
+// suspension returns the suspended session waiting for the client to resume, nil
+// if the agent is not suspended
+func (a *agent) suspension() *suspendedSession {
+	ss, _ := a.suspended.Load().(*suspendedSession)
+	return ss
+}
+
+func (a *agent) setCloseReason(reason session.CloseReason) {
+	a.closeOnce.Do(func() { a.closeReason = reason })
+}
+
+// kick sends a kick packet with the reason to the client through the send queue,
+// and closes the agent after it has been flushed.
+func (a *agent) kick(reason string) error {
+	return a.kickWith(kickMessage{Reason: reason})
+}
+
+// Kick implements the session.Kicker interface, the reason is pushed through the
+// send queue with the critical priority, and the connection is closed after it
+// has been flushed to the client, or kickTimeout elapsed.
+func (a *agent) Kick(reason interface{}) error {
+	if a.status() == statusClosed {
+		return ErrBrokenPipe
+	}
+
+	a.setCloseReason(session.CloseReasonKicked)
+	done := make(chan error, 1)
+	m := pendingMessage{typ: message.Push, route: session.KickRoute, payload: reason, done: done}
+	err := a.send(m, session.PriorityCritical)
+	if err == nil {
+		timer := env.Clock.AfterFunc(kickTimeout, func() { a.Close() })
+		select {
+		case err = <-done:
+		case <-a.chDie:
+			err = ErrBrokenPipe
+		}
+		timer.Stop()
+	}
+	a.Close()
+	return err
+}
+
+// MigrateAffinity implements the session.AffinityMigrator interface
+func (a *agent) MigrateAffinity(addr string, withAttributes bool) error {
+	if a.migrate == nil {
+		return session.ErrMigrationUnsupported
+	}
+	return a.migrate(addr, withAttributes)
+}
+
+func (a *agent) kickWith(m kickMessage) error {
+	if a.status() == statusClosed {
+		return ErrBrokenPipe
+	}
+
+	a.setCloseReason(kickCloseReason(m.Reason))
+	p, err := encodeKick(m)
+	if err == nil {
+		timer := env.Clock.AfterFunc(kickTimeout, func() { a.Close() })
+		err = a.sendPacket(p, session.PriorityCritical)
+		timer.Stop()
+	}
+	a.Close()
+	return err
+}
+
+// sendPacket queues the encoded packet with the priority, and waits until it has
+// been flushed to the connection, so that it is not interleaved with the packets
+// written by the write goroutine.
+func (a *agent) sendPacket(p []byte, priority int) error {
+	done := make(chan error, 1)
+	if err := a.send(pendingMessage{packet: p, done: done}, priority); err != nil {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-a.chDie:
+		return ErrBrokenPipe
+	}
+}
+
 // RemoteAddr, implementation for session.NetworkEntity interface
 // returns the remote network address.
 func (a *agent) RemoteAddr() net.Addr {
@@ -237,14 +700,37 @@ func (a *agent) setStatus(state int32) {
 }
 
 func (a *agent) write() {
-	ticker := time.NewTicker(env.Heartbeat)
+	ticker := env.Clock.NewTicker(env.Heartbeat)
 	chWrite := make(chan []byte, agentWriteBacklog)
+
+	// the packets are buffered and flushed once there is nothing more to write,
+	// so that a burst of small packets is written with fewer syscalls
+	var w io.Writer = a.conn
+	var bw *bufio.Writer
+	if a.writeSize > 0 {
+		bw = bufio.NewWriterSize(a.conn, a.writeSize)
+		w = bw
+	}
+	flush := func(force bool) error {
+		if bw == nil || (!force && (a.chSend.len() > 0 || len(chWrite) > 0)) {
+			return nil
+		}
+		return bw.Flush()
+	}
+
 	// clean func
 	defer func() {
 		ticker.Stop()
-		close(a.chSend)
+		a.chSend.close()
 		close(chWrite)
-		a.Close()
+		a.closeWith(session.CloseReasonDisconnected)
+		// the messages not written are replayed once the session is resumed
+		<-a.chDie
+		if ss := a.suspension(); ss != nil {
+			for m, ok := a.chSend.pop(); ok; m, ok = a.chSend.pop() {
+				ss.keep(m)
+			}
+		}
 		if env.Debug {
 			log.Println(fmt.Sprintf("Session write goroutine exit, SessionID=%d, UID=%d", a.session.ID(), a.session.UID()))
 		}
@@ -252,69 +738,107 @@ func (a *agent) write() {
 
 	for {
 		select {
-		case <-ticker.C:
-			deadline := time.Now().Add(-2 * env.Heartbeat).Unix()
-			if atomic.LoadInt64(&a.lastAt) < deadline {
+		case <-ticker.C():
+			deadline := env.Clock.Now().Add(-2 * env.Heartbeat).Unix()
+			if !a.reaped && atomic.LoadInt64(&a.lastAt) < deadline {
 				log.Println(fmt.Sprintf("Session heartbeat timeout, LastTime=%d, Deadline=%d", atomic.LoadInt64(&a.lastAt), deadline))
+				a.setCloseReason(session.CloseReasonHeartbeatTimeout)
 				return
 			}
 			chWrite <- hbd
 
 		case data := <-chWrite:
 			// close agent while low-level conn broken
-			if _, err := a.conn.Write(data); err != nil {
+			if _, err := w.Write(data); err != nil {
+				log.Println(err.Error())
+				return
+			}
+			if err := flush(false); err != nil {
 				log.Println(err.Error())
 				return
 			}
 
-		case data := <-a.chSend:
-			payload, err := message.Serialize(data.payload)
-			if err != nil {
-				switch data.typ {
-				case message.Push:
-					log.Println(fmt.Sprintf("Push: %s error: %s", data.route, err.Error()))
-				case message.Response:
-					log.Println(fmt.Sprintf("Response message(id: %d) error: %s", data.mid, err.Error()))
-				default:
-					// expect
+		case <-a.chSend.ready:
+			data, ok := a.chSend.pop()
+			if !ok {
+				break
+			}
+			if data.packet != nil {
+				_, err := w.Write(data.packet)
+				if err == nil {
+					err = flush(true)
+				}
+				data.done <- err
+				if err != nil {
+					log.Println(err.Error())
+					return
 				}
 				break
 			}
-
-			// construct message and encode
-			m := &message.Message{
-				Type:  data.typ,
-				Data:  payload,
-				Route: data.route,
-				ID:    data.mid,
+			if data.raw != nil {
+				// the raw payload is written to the connection directly
+				if err := flush(true); err != nil {
+					log.Println(err.Error())
+					return
+				}
+				if err := a.writeRaw(data); err != nil {
+					log.Println(err.Error())
+					return
+				}
+				break
 			}
-			if pipe := a.pipeline; pipe != nil {
-				err := pipe.Outbound().Process(a.session, m)
-				if err != nil {
-					log.Println("broken pipeline", err.Error())
-					break
+			if data.batch != nil {
+				// the batch is written to the connection directly with a single write
+				if err := flush(true); err != nil {
+					log.Println(err.Error())
+					return
+				}
+				if err := a.writeBatch(data.batch); err != nil {
+					log.Println(err.Error())
+					return
 				}
+				break
 			}
-
-			em, err := m.Encode()
-			if err != nil {
-				log.Println(err.Error())
+			if data.shared != nil {
+				if err := a.writeShared(w, data.shared); err != nil {
+					log.Println(err.Error())
+					return
+				}
+				if err := flush(false); err != nil {
+					log.Println(err.Error())
+					return
+				}
 				break
 			}
-
-			// packet encode
-			p, err := codec.Encode(packet.Data, em)
-			if err != nil {
-				log.Println(err)
+			p := a.encode(data)
+			if p == nil {
+				if data.done != nil {
+					data.done <- ErrEncodeMessage
+				}
 				break
 			}
-			chWrite <- p
+			// write directly, so that the order decided by the send queue is kept
+			if _, err := w.Write(p); err != nil {
+				log.Println(err.Error())
+				return
+			}
+			if data.done != nil {
+				// the sender waits for the message to reach the connection
+				err := flush(true)
+				data.done <- err
+				if err != nil {
+					log.Println(err.Error())
+					return
+				}
+				break
+			}
+			if err := flush(false); err != nil {
+				log.Println(err.Error())
+				return
+			}
 
 		case <-a.chDie: // agent closed signal
 			return
-
-		case <-env.Die: // application quit
-			return
 		}
 	}
 }
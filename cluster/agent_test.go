@@ -0,0 +1,478 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/clock/clocktest"
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/pipeline"
+	"github.com/lonng/nano/session"
+)
+
+func TestAgent_HeartbeatTimeout(t *testing.T) {
+	fake := clocktest.NewFake(time.Now())
+	defer func(c clock.Clock) { env.Clock = c }(env.Clock)
+	env.Clock = fake
+
+	server, client := net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+
+	a := newAgent(server, nil, nil, nil)
+	go a.write()
+
+	// wait until the heartbeat ticker is created
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(3 * env.Heartbeat)
+
+	select {
+	case <-a.chDie:
+	case <-time.After(time.Second):
+		t.Fatal("expect agent to be closed after heartbeat timeout")
+	}
+	if a.closeReason != session.CloseReasonHeartbeatTimeout {
+		t.Fatalf("expect: %s, got: %s", session.CloseReasonHeartbeatTimeout, a.closeReason)
+	}
+}
+
+func TestAgent_CloseReason(t *testing.T) {
+	server, client := net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+
+	// the first reason wins
+	a := newAgent(server, nil, nil, nil)
+	go a.write()
+	if err := a.kick(kickReasonDuplicate); err != nil {
+		t.Fatal(err)
+	}
+	a.closeWith(session.CloseReasonDisconnected)
+	if a.closeReason != session.CloseReasonKicked {
+		t.Fatalf("expect: %s, got: %s", session.CloseReasonKicked, a.closeReason)
+	}
+
+	server, client = net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+	a = newAgent(server, nil, nil, nil)
+	go a.write()
+	if err := a.kick(kickReasonClosing); err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+	if a.closeReason != session.CloseReasonShutdown {
+		t.Fatalf("expect: %s, got: %s", session.CloseReasonShutdown, a.closeReason)
+	}
+
+	// the closed sessions are counted by reason
+	reporter := &seriesReporter{series: map[string]float64{}}
+	server, _ = net.Pipe()
+	a = newAgent(server, nil, nil, nil)
+	a.reporters = []metrics.Reporter{reporter}
+	a.Close()
+	if a.closeReason != session.CloseReasonClosed {
+		t.Fatalf("expect: %s, got: %s", session.CloseReasonClosed, a.closeReason)
+	}
+	if v := reporter.value("session_closed_total{reason=closed}"); v != 1 {
+		t.Fatalf("expect: 1, got: %v", v)
+	}
+}
+
+func TestAgent_KickTimeout(t *testing.T) {
+	fake := clocktest.NewFake(time.Now())
+	defer func(c clock.Clock) { env.Clock = c }(env.Clock)
+	env.Clock = fake
+
+	cases := []struct {
+		kick   func(a *agent) error
+		reason session.CloseReason
+	}{
+		{func(a *agent) error { return a.kick(kickReasonSlowClient) }, session.CloseReasonReadTimeout},
+		{func(a *agent) error { return a.Kick([]byte("banned")) }, session.CloseReasonKicked},
+	}
+	for _, c := range cases {
+		// the client does not read, so the kick packet can not be flushed
+		server, client := net.Pipe()
+		a := newAgent(server, nil, nil, nil)
+		go a.write()
+		for fake.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- c.kick(a) }()
+		for fake.Waiters() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		fake.Advance(kickTimeout)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("expect the kick to give up after the timeout")
+		}
+		if a.status() != statusClosed || a.closeReason != c.reason {
+			t.Fatalf("expect the agent closed by the kick, got: %d, %s", a.status(), a.closeReason)
+		}
+		client.Close()
+	}
+}
+
+func TestAgent_SendRaw(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	conn := &countingConn{Conn: server}
+	a := newAgent(conn, nil, nil, nil)
+	go a.write()
+
+	payload := bytes.Repeat([]byte("nano"), 15*1024)
+	received := make(chan []byte, 1)
+	go func() {
+		data, _ := ioutil.ReadAll(io.LimitReader(client, int64(codec.HeadLength+len("asset.map")+2+len(payload))))
+		received <- data
+	}()
+
+	if err := a.SendRaw("asset.map", bytes.NewReader(payload), len(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	data := <-received
+	if len(data) < codec.HeadLength {
+		t.Fatalf("expect a packet, got: %d bytes", len(data))
+	}
+	m, err := message.Decode(data[codec.HeadLength:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != message.Push || m.Route != "asset.map" || !bytes.Equal(m.Data, payload) {
+		t.Fatalf("unexpected message: type=%v, route=%s, %d bytes", m.Type, m.Route, len(m.Data))
+	}
+	// the message based transports deliver each write as a message
+	if writes := atomic.LoadInt32(&conn.writes); writes != 1 {
+		t.Fatalf("expect the packet written at once, got: %d writes", writes)
+	}
+
+	if err := a.SendRaw("asset.map", bytes.NewReader(nil), codec.MaxPacketSize+1); err != codec.ErrPacketSizeExcced {
+		t.Fatalf("expect: %v, got: %v", codec.ErrPacketSizeExcced, err)
+	}
+}
+
+func TestAgent_SendRawShortRead(t *testing.T) {
+	server, client := net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+
+	a := newAgent(server, nil, nil, nil)
+	go a.write()
+
+	if err := a.SendRaw("asset.map", bytes.NewReader(make([]byte, 10)), 20); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect: %v, got: %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+// countingConn counts the writes to the underlying connection
+type countingConn struct {
+	net.Conn
+	writes int32
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt32(&c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+func TestAgent_SendBatch(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	conn := &countingConn{Conn: server}
+	a := newAgent(conn, nil, nil, nil)
+	a.writeSize = 4096
+	go a.write()
+
+	routes := []string{"room.join", "room.members", "room.state"}
+	var batch []session.BatchMessage
+	for i, route := range routes {
+		batch = append(batch, session.BatchMessage{Route: route, Payload: []byte(fmt.Sprintf("data-%d", i))})
+	}
+	if err := a.SendBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := codec.NewDecoder()
+	buf := make([]byte, 4096)
+	var packets []*packet.Packet
+	for len(packets) < len(routes) {
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps, err := decoder.Decode(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, ps...)
+	}
+
+	for i, p := range packets {
+		m, err := message.Decode(p.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != message.Push || m.Route != routes[i] || string(m.Data) != fmt.Sprintf("data-%d", i) {
+			t.Fatalf("unexpected message: type=%v, route=%s, data=%s", m.Type, m.Route, m.Data)
+		}
+	}
+	if n := atomic.LoadInt32(&conn.writes); n != 1 {
+		t.Fatalf("expect the batch to be written at once, got: %d writes", n)
+	}
+}
+
+func TestAgent_SendBatchSerializeError(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	a := newAgent(server, nil, nil, nil)
+	batch := []session.BatchMessage{
+		{Route: "room.join", Payload: []byte("ok")},
+		{Route: "room.state", Payload: struct{}{}},
+	}
+	if err := a.SendBatch(batch); err == nil {
+		t.Fatal("expect the batch to fail to serialize")
+	}
+	if n := a.chSend.len(); n != 0 {
+		t.Fatalf("expect nothing to be sent, got: %d messages", n)
+	}
+}
+
+func readPush(t *testing.T, conn net.Conn, version int) *message.Message {
+	decoder := codec.NewDecoder()
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps, err := decoder.Decode(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ps) > 0 {
+			m, err := message.CodecOf(version).Decode(ps[0].Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return m
+		}
+	}
+}
+
+func TestAgent_PushShared(t *testing.T) {
+	m := session.NewSharedMessage("room.update", []byte("payload"))
+
+	versions := []int32{message.V1, message.V2, message.V2}
+	var clients []net.Conn
+	for i, version := range versions {
+		server, client := net.Pipe()
+		defer client.Close()
+
+		var pipe pipeline.Pipeline
+		if i == 2 {
+			// the packet processed by the pipeline can not be shared
+			pipe = pipeline.New()
+			pipe.Outbound().PushBack(func(s *session.Session, msg *message.Message) error {
+				msg.Data = append([]byte("piped-"), msg.Data...)
+				return nil
+			})
+		}
+		a := newAgent(server, pipe, nil, nil)
+		a.protocol = version
+		go a.write()
+		defer a.Close()
+
+		if err := a.PushShared(m); err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, client)
+	}
+
+	expects := []string{"payload", "payload", "piped-payload"}
+	for i, client := range clients {
+		msg := readPush(t, client, int(versions[i]))
+		if msg.Type != message.Push || msg.Route != "room.update" || string(msg.Data) != expects[i] {
+			t.Fatalf("unexpected message: type=%v, route=%s, data=%s", msg.Type, msg.Route, msg.Data)
+		}
+	}
+	m.Release()
+}
+
+func TestAgent_Kick(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	a := newAgent(server, nil, nil, nil)
+	a.writeSize = 4096
+	go a.write()
+
+	kicked := make(chan error, 1)
+	go func() { kicked <- a.Kick([]byte("banned")) }()
+
+	// the kick message is flushed before the connection is closed
+	m := readPush(t, client, message.V1)
+	if m.Type != message.Push || m.Route != session.KickRoute || string(m.Data) != "banned" {
+		t.Fatalf("unexpected message: type=%v, route=%s, data=%s", m.Type, m.Route, m.Data)
+	}
+	if err := <-kicked; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expect: %v, got: %v", io.EOF, err)
+	}
+	if err := a.Kick([]byte("banned")); err != ErrBrokenPipe {
+		t.Fatalf("expect: %v, got: %v", ErrBrokenPipe, err)
+	}
+}
+
+func benchmarkSendRaw(b *testing.B, pipe pipeline.Pipeline) {
+	server, client := net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+
+	a := newAgent(server, pipe, nil, nil)
+	go a.write()
+	defer a.Close()
+
+	payload := make([]byte, codec.MaxPacketSize/2)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := a.SendRaw("asset.map", bytes.NewReader(payload), len(payload)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkAgent_SendRaw reads the payload into a pooled buffer
+func BenchmarkAgent_SendRaw(b *testing.B) {
+	benchmarkSendRaw(b, nil)
+}
+
+// BenchmarkAgent_SendRawBuffered reads the payload into memory before pushing it,
+// which happens when a pipeline is installed
+func BenchmarkAgent_SendRawBuffered(b *testing.B) {
+	benchmarkSendRaw(b, pipeline.New())
+}
+
+func benchmarkPush(b *testing.B, writeSize, payloadSize int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+	server, err := l.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	a := newAgent(server, nil, nil, nil)
+	a.writeSize = writeSize
+	go a.write()
+	defer a.Close()
+
+	payload := make([]byte, payloadSize)
+	em, err := message.Encode(&message.Message{Type: message.Push, Route: "room.snapshot", Data: payload})
+	if err != nil {
+		b.Fatal(err)
+	}
+	p, err := codec.Encode(packet.Data, em)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.CopyN(ioutil.Discard, client, int64(len(p)*b.N))
+		done <- err
+	}()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(p)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := a.Push("room.snapshot", payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkAgent_Push pushes the small messages, e.g: chat or position updates,
+// and the large state snapshots to a TCP connection with different write buffer
+// sizes, zero means the packets are written to the connection directly
+func BenchmarkAgent_Push(b *testing.B) {
+	for _, payloadSize := range []int{128, 16 * 1024} {
+		for _, writeSize := range []int{0, DefaultWriteBufferSize, 32 * 1024} {
+			b.Run(fmt.Sprintf("payload=%d/buffer=%d", payloadSize, writeSize), func(b *testing.B) {
+				benchmarkPush(b, writeSize, payloadSize)
+			})
+		}
+	}
+}
+
+func benchmarkBroadcast(b *testing.B, members int, shared bool) {
+	var agents []*agent
+	for i := 0; i < members; i++ {
+		server, client := net.Pipe()
+		go io.Copy(ioutil.Discard, client)
+		a := newAgent(server, nil, nil, nil)
+		go a.write()
+		defer a.Close()
+		agents = append(agents, a)
+	}
+
+	payload := bytes.Repeat([]byte("x"), 512)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !shared {
+			for _, a := range agents {
+				a.Push("room.update", payload)
+			}
+			continue
+		}
+		m := session.NewSharedMessage("room.update", payload)
+		for _, a := range agents {
+			a.PushShared(m)
+		}
+		m.Release()
+	}
+}
+
+// BenchmarkAgent_Broadcast pushes a message to the members of a group, which is
+// encoded for each member or once for all members
+func BenchmarkAgent_Broadcast(b *testing.B) {
+	for _, shared := range []bool{false, true} {
+		b.Run(fmt.Sprintf("shared=%v", shared), func(b *testing.B) {
+			benchmarkBroadcast(b, 1000, shared)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/clock/clocktest"
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+type ProfileComponent struct {
+	component.Base
+	calls int
+}
+
+func (c *ProfileComponent) Get(s *session.Session, data []byte) error {
+	c.calls++
+	return s.Response([]byte(string(data) + "#" + strconv.Itoa(c.calls)))
+}
+
+func TestHandler_ResponseCache(t *testing.T) {
+	fake := clocktest.NewFake(time.Now())
+	defer func(c clock.Clock) { env.Clock = c }(env.Clock)
+	env.Clock = fake
+
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{MetricsReporters: []metrics.Reporter{reporter}}}
+	h := NewHandler(n, nil)
+	c := &ProfileComponent{}
+	opts := []component.Option{
+		component.WithName("Profile"),
+		component.WithSchedulerName("sync"),
+		component.WithResponseCache(time.Minute, func(s *session.Session, data []byte) string {
+			if string(data) == "nocache" {
+				return ""
+			}
+			return string(data)
+		}),
+		component.WithResponseCacheSize(1),
+	}
+	if err := h.register(c, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	a.session.Set("sync", syncScheduler{})
+
+	var mid uint64
+	request := func(data string) string {
+		mid++
+		h.localProcess(h.localHandlers["Profile.Get"], mid, a.session, &message.Message{
+			Type: message.Request, ID: mid, Route: "Profile.Get", Data: []byte(data),
+		})
+		m, ok := a.chSend.pop()
+		if !ok {
+			t.Fatalf("expect a response of %s", data)
+		}
+		if m.mid != mid {
+			t.Fatalf("expect response of mid %d, got: %d", mid, m.mid)
+		}
+		return string(m.payload.([]byte))
+	}
+
+	cases := []struct {
+		data   string
+		expect string
+	}{
+		{"alice", "alice#1"},
+		{"alice", "alice#1"},     // hit
+		{"nocache", "nocache#2"}, // not cached
+		{"nocache", "nocache#3"},
+		{"bob", "bob#4"}, // evicts alice
+		{"alice", "alice#5"},
+	}
+	for _, cs := range cases {
+		if resp := request(cs.data); resp != cs.expect {
+			t.Fatalf("request %s, expect: %s, got: %s", cs.data, cs.expect, resp)
+		}
+	}
+
+	// the cached response expires after ttl
+	if resp := request("alice"); resp != "alice#5" {
+		t.Fatalf("expect: alice#5, got: %s", resp)
+	}
+	fake.Advance(time.Minute)
+	if resp := request("alice"); resp != "alice#6" {
+		t.Fatalf("expect: alice#6, got: %s", resp)
+	}
+
+	if v := reporter.value(metrics.ResponseCacheHits + "{route=Profile.Get}"); v != 2 {
+		t.Fatalf("expect: 2 hits, got: %v", v)
+	}
+	if v := reporter.value(metrics.ResponseCacheMisses + "{route=Profile.Get}"); v != 4 {
+		t.Fatalf("expect: 4 misses, got: %v", v)
+	}
+	if _, ok := a.responseTaps.taps.Load(mid); ok {
+		t.Fatal("expect the response to be untapped")
+	}
+}
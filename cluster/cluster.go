@@ -39,6 +39,7 @@ type cluster struct {
 
 	mu      sync.RWMutex
 	members []*Member
+	users   map[int64][]string // uid -> service addresses of the nodes serving the user, in binding order
 }
 
 func newCluster(currentNode *Node) *cluster {
@@ -65,11 +66,10 @@ func (c *cluster) Register(_ context.Context, req *clusterpb.RegisterRequest) (*
 		if m.isMaster {
 			continue
 		}
-		pool, err := c.rpcClient.getConnPool(m.memberInfo.ServiceAddr)
+		client, err := c.rpcClient.memberClient(m.memberInfo.ServiceAddr)
 		if err != nil {
 			return nil, err
 		}
-		client := clusterpb.NewMemberClient(pool.Get())
 		_, err = client.NewMember(context.Background(), newMember)
 		if err != nil {
 			return nil, err
@@ -110,11 +110,10 @@ func (c *cluster) Unregister(_ context.Context, req *clusterpb.UnregisterRequest
 		if m.MemberInfo().ServiceAddr == c.currentNode.ServiceAddr {
 			continue
 		}
-		pool, err := c.rpcClient.getConnPool(m.memberInfo.ServiceAddr)
+		client, err := c.rpcClient.memberClient(m.memberInfo.ServiceAddr)
 		if err != nil {
 			return nil, err
 		}
-		client := clusterpb.NewMemberClient(pool.Get())
 		_, err = client.DelMember(context.Background(), delMember)
 		if err != nil {
 			return nil, err
@@ -125,6 +124,7 @@ func (c *cluster) Unregister(_ context.Context, req *clusterpb.UnregisterRequest
 
 	// Register services to current node
 	c.currentNode.handler.delMember(req.ServiceAddr)
+	c.unbindUsersOf(req.ServiceAddr)
 	c.mu.Lock()
 	if index == len(c.members)-1 {
 		c.members = c.members[:index]
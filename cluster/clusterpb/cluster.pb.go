@@ -26,6 +26,21 @@ It has these top-level messages:
 	SessionClosedResponse
 	CloseSessionRequest
 	CloseSessionResponse
+	MigrateSessionRequest
+	MigrateSessionResponse
+	BindUserRequest
+	BindUserResponse
+	UnbindUserRequest
+	UnbindUserResponse
+	FindUsersRequest
+	FindUsersResponse
+	PushToUsersRequest
+	KickUsersRequest
+	UserMessageResponse
+	MigrateAffinityRequest
+	MigrateAffinityResponse
+	MulticastMessage
+	UserNode
 */
 package clusterpb
 
@@ -346,7 +361,8 @@ func (*DelMemberResponse) ProtoMessage()               {}
 func (*DelMemberResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
 
 type SessionClosedRequest struct {
-	SessionId int64 `protobuf:"varint,1,opt,name=sessionId" json:"sessionId"`
+	SessionId int64  `protobuf:"varint,1,opt,name=sessionId" json:"sessionId"`
+	Reason    string `protobuf:"bytes,2,opt,name=reason" json:"reason"`
 }
 
 func (m *SessionClosedRequest) Reset()                    { *m = SessionClosedRequest{} }
@@ -361,6 +377,13 @@ func (m *SessionClosedRequest) GetSessionId() int64 {
 	return 0
 }
 
+func (m *SessionClosedRequest) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
 type SessionClosedResponse struct {
 }
 
@@ -393,6 +416,350 @@ func (m *CloseSessionResponse) String() string            { return proto.Compact
 func (*CloseSessionResponse) ProtoMessage()               {}
 func (*CloseSessionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
 
+type MigrateSessionRequest struct {
+	Uid        int64             `protobuf:"varint,1,opt,name=uid" json:"uid"`
+	Token      string            `protobuf:"bytes,2,opt,name=token" json:"token"`
+	Attributes map[string][]byte `protobuf:"bytes,3,rep,name=attributes" json:"attributes" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Groups     []string          `protobuf:"bytes,4,rep,name=groups" json:"groups"`
+}
+
+func (m *MigrateSessionRequest) Reset()                    { *m = MigrateSessionRequest{} }
+func (m *MigrateSessionRequest) String() string            { return proto.CompactTextString(m) }
+func (*MigrateSessionRequest) ProtoMessage()               {}
+func (*MigrateSessionRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
+
+func (m *MigrateSessionRequest) GetUid() int64 {
+	if m != nil {
+		return m.Uid
+	}
+	return 0
+}
+
+func (m *MigrateSessionRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *MigrateSessionRequest) GetAttributes() map[string][]byte {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *MigrateSessionRequest) GetGroups() []string {
+	if m != nil {
+		return m.Groups
+	}
+	return nil
+}
+
+type MigrateSessionResponse struct {
+	ClientAddr string `protobuf:"bytes,1,opt,name=clientAddr" json:"clientAddr"`
+}
+
+func (m *MigrateSessionResponse) Reset()                    { *m = MigrateSessionResponse{} }
+func (m *MigrateSessionResponse) String() string            { return proto.CompactTextString(m) }
+func (*MigrateSessionResponse) ProtoMessage()               {}
+func (*MigrateSessionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
+
+func (m *MigrateSessionResponse) GetClientAddr() string {
+	if m != nil {
+		return m.ClientAddr
+	}
+	return ""
+}
+
+type BindUserRequest struct {
+	Uid         int64  `protobuf:"varint,1,opt,name=uid" json:"uid"`
+	ServiceAddr string `protobuf:"bytes,2,opt,name=serviceAddr" json:"serviceAddr"`
+}
+
+func (m *BindUserRequest) Reset()                    { *m = BindUserRequest{} }
+func (m *BindUserRequest) String() string            { return proto.CompactTextString(m) }
+func (*BindUserRequest) ProtoMessage()               {}
+func (*BindUserRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
+
+func (m *BindUserRequest) GetUid() int64 {
+	if m != nil {
+		return m.Uid
+	}
+	return 0
+}
+
+func (m *BindUserRequest) GetServiceAddr() string {
+	if m != nil {
+		return m.ServiceAddr
+	}
+	return ""
+}
+
+type BindUserResponse struct {
+}
+
+func (m *BindUserResponse) Reset()                    { *m = BindUserResponse{} }
+func (m *BindUserResponse) String() string            { return proto.CompactTextString(m) }
+func (*BindUserResponse) ProtoMessage()               {}
+func (*BindUserResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+
+type UnbindUserRequest struct {
+	Uid         int64  `protobuf:"varint,1,opt,name=uid" json:"uid"`
+	ServiceAddr string `protobuf:"bytes,2,opt,name=serviceAddr" json:"serviceAddr"`
+}
+
+func (m *UnbindUserRequest) Reset()                    { *m = UnbindUserRequest{} }
+func (m *UnbindUserRequest) String() string            { return proto.CompactTextString(m) }
+func (*UnbindUserRequest) ProtoMessage()               {}
+func (*UnbindUserRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+
+func (m *UnbindUserRequest) GetUid() int64 {
+	if m != nil {
+		return m.Uid
+	}
+	return 0
+}
+
+func (m *UnbindUserRequest) GetServiceAddr() string {
+	if m != nil {
+		return m.ServiceAddr
+	}
+	return ""
+}
+
+type UnbindUserResponse struct {
+}
+
+func (m *UnbindUserResponse) Reset()                    { *m = UnbindUserResponse{} }
+func (m *UnbindUserResponse) String() string            { return proto.CompactTextString(m) }
+func (*UnbindUserResponse) ProtoMessage()               {}
+func (*UnbindUserResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+
+type FindUsersRequest struct {
+	Uids []int64 `protobuf:"varint,1,rep,packed,name=uids" json:"uids"`
+}
+
+func (m *FindUsersRequest) Reset()                    { *m = FindUsersRequest{} }
+func (m *FindUsersRequest) String() string            { return proto.CompactTextString(m) }
+func (*FindUsersRequest) ProtoMessage()               {}
+func (*FindUsersRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+
+func (m *FindUsersRequest) GetUids() []int64 {
+	if m != nil {
+		return m.Uids
+	}
+	return nil
+}
+
+type FindUsersResponse struct {
+	Addrs map[int64]string `protobuf:"bytes,1,rep,name=addrs" json:"addrs" protobuf_key:"varint,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Nodes []*UserNode      `protobuf:"bytes,2,rep,name=nodes" json:"nodes"`
+}
+
+func (m *FindUsersResponse) Reset()                    { *m = FindUsersResponse{} }
+func (m *FindUsersResponse) String() string            { return proto.CompactTextString(m) }
+func (*FindUsersResponse) ProtoMessage()               {}
+func (*FindUsersResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
+
+func (m *FindUsersResponse) GetAddrs() map[int64]string {
+	if m != nil {
+		return m.Addrs
+	}
+	return nil
+}
+
+func (m *FindUsersResponse) GetNodes() []*UserNode {
+	if m != nil {
+		return m.Nodes
+	}
+	return nil
+}
+
+type PushToUsersRequest struct {
+	Uids   []int64 `protobuf:"varint,1,rep,packed,name=uids" json:"uids"`
+	Route  string  `protobuf:"bytes,2,opt,name=route" json:"route"`
+	Data   []byte  `protobuf:"bytes,3,opt,name=data,proto3" json:"data"`
+	Device string  `protobuf:"bytes,4,opt,name=device" json:"device"`
+}
+
+func (m *PushToUsersRequest) Reset()                    { *m = PushToUsersRequest{} }
+func (m *PushToUsersRequest) String() string            { return proto.CompactTextString(m) }
+func (*PushToUsersRequest) ProtoMessage()               {}
+func (*PushToUsersRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
+
+func (m *PushToUsersRequest) GetUids() []int64 {
+	if m != nil {
+		return m.Uids
+	}
+	return nil
+}
+
+func (m *PushToUsersRequest) GetRoute() string {
+	if m != nil {
+		return m.Route
+	}
+	return ""
+}
+
+func (m *PushToUsersRequest) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *PushToUsersRequest) GetDevice() string {
+	if m != nil {
+		return m.Device
+	}
+	return ""
+}
+
+type KickUsersRequest struct {
+	Uids   []int64 `protobuf:"varint,1,rep,packed,name=uids" json:"uids"`
+	Reason string  `protobuf:"bytes,2,opt,name=reason" json:"reason"`
+	Data   []byte  `protobuf:"bytes,3,opt,name=data,proto3" json:"data"`
+}
+
+func (m *KickUsersRequest) Reset()                    { *m = KickUsersRequest{} }
+func (m *KickUsersRequest) String() string            { return proto.CompactTextString(m) }
+func (*KickUsersRequest) ProtoMessage()               {}
+func (*KickUsersRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
+
+func (m *KickUsersRequest) GetUids() []int64 {
+	if m != nil {
+		return m.Uids
+	}
+	return nil
+}
+
+func (m *KickUsersRequest) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *KickUsersRequest) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type UserMessageResponse struct {
+	Missing []int64 `protobuf:"varint,1,rep,packed,name=missing" json:"missing"`
+}
+
+func (m *UserMessageResponse) Reset()                    { *m = UserMessageResponse{} }
+func (m *UserMessageResponse) String() string            { return proto.CompactTextString(m) }
+func (*UserMessageResponse) ProtoMessage()               {}
+func (*UserMessageResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
+
+func (m *UserMessageResponse) GetMissing() []int64 {
+	if m != nil {
+		return m.Missing
+	}
+	return nil
+}
+
+type MigrateAffinityRequest struct {
+	GateAddr   string            `protobuf:"bytes,1,opt,name=gateAddr" json:"gateAddr"`
+	SessionId  int64             `protobuf:"varint,2,opt,name=sessionId" json:"sessionId"`
+	Attributes map[string][]byte `protobuf:"bytes,3,rep,name=attributes" json:"attributes" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *MigrateAffinityRequest) Reset()                    { *m = MigrateAffinityRequest{} }
+func (m *MigrateAffinityRequest) String() string            { return proto.CompactTextString(m) }
+func (*MigrateAffinityRequest) ProtoMessage()               {}
+func (*MigrateAffinityRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
+
+func (m *MigrateAffinityRequest) GetGateAddr() string {
+	if m != nil {
+		return m.GateAddr
+	}
+	return ""
+}
+
+func (m *MigrateAffinityRequest) GetSessionId() int64 {
+	if m != nil {
+		return m.SessionId
+	}
+	return 0
+}
+
+func (m *MigrateAffinityRequest) GetAttributes() map[string][]byte {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+type MigrateAffinityResponse struct {
+}
+
+func (m *MigrateAffinityResponse) Reset()                    { *m = MigrateAffinityResponse{} }
+func (m *MigrateAffinityResponse) String() string            { return proto.CompactTextString(m) }
+func (*MigrateAffinityResponse) ProtoMessage()               {}
+func (*MigrateAffinityResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
+
+type MulticastMessage struct {
+	SessionIds []int64 `protobuf:"varint,1,rep,packed,name=sessionIds" json:"sessionIds"`
+	Route      string  `protobuf:"bytes,2,opt,name=route" json:"route"`
+	Data       []byte  `protobuf:"bytes,3,opt,name=data,proto3" json:"data"`
+}
+
+func (m *MulticastMessage) Reset()                    { *m = MulticastMessage{} }
+func (m *MulticastMessage) String() string            { return proto.CompactTextString(m) }
+func (*MulticastMessage) ProtoMessage()               {}
+func (*MulticastMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{31} }
+
+func (m *MulticastMessage) GetSessionIds() []int64 {
+	if m != nil {
+		return m.SessionIds
+	}
+	return nil
+}
+
+func (m *MulticastMessage) GetRoute() string {
+	if m != nil {
+		return m.Route
+	}
+	return ""
+}
+
+func (m *MulticastMessage) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type UserNode struct {
+	Uid  int64  `protobuf:"varint,1,opt,name=uid" json:"uid"`
+	Addr string `protobuf:"bytes,2,opt,name=addr" json:"addr"`
+}
+
+func (m *UserNode) Reset()                    { *m = UserNode{} }
+func (m *UserNode) String() string            { return proto.CompactTextString(m) }
+func (*UserNode) ProtoMessage()               {}
+func (*UserNode) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{32} }
+
+func (m *UserNode) GetUid() int64 {
+	if m != nil {
+		return m.Uid
+	}
+	return 0
+}
+
+func (m *UserNode) GetAddr() string {
+	if m != nil {
+		return m.Addr
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*MemberInfo)(nil), "clusterpb.MemberInfo")
 	proto.RegisterType((*RegisterRequest)(nil), "clusterpb.RegisterRequest")
@@ -412,6 +779,21 @@ func init() {
 	proto.RegisterType((*SessionClosedResponse)(nil), "clusterpb.SessionClosedResponse")
 	proto.RegisterType((*CloseSessionRequest)(nil), "clusterpb.CloseSessionRequest")
 	proto.RegisterType((*CloseSessionResponse)(nil), "clusterpb.CloseSessionResponse")
+	proto.RegisterType((*MigrateSessionRequest)(nil), "clusterpb.MigrateSessionRequest")
+	proto.RegisterType((*MigrateSessionResponse)(nil), "clusterpb.MigrateSessionResponse")
+	proto.RegisterType((*BindUserRequest)(nil), "clusterpb.BindUserRequest")
+	proto.RegisterType((*BindUserResponse)(nil), "clusterpb.BindUserResponse")
+	proto.RegisterType((*UnbindUserRequest)(nil), "clusterpb.UnbindUserRequest")
+	proto.RegisterType((*UnbindUserResponse)(nil), "clusterpb.UnbindUserResponse")
+	proto.RegisterType((*FindUsersRequest)(nil), "clusterpb.FindUsersRequest")
+	proto.RegisterType((*FindUsersResponse)(nil), "clusterpb.FindUsersResponse")
+	proto.RegisterType((*PushToUsersRequest)(nil), "clusterpb.PushToUsersRequest")
+	proto.RegisterType((*KickUsersRequest)(nil), "clusterpb.KickUsersRequest")
+	proto.RegisterType((*UserMessageResponse)(nil), "clusterpb.UserMessageResponse")
+	proto.RegisterType((*MigrateAffinityRequest)(nil), "clusterpb.MigrateAffinityRequest")
+	proto.RegisterType((*MigrateAffinityResponse)(nil), "clusterpb.MigrateAffinityResponse")
+	proto.RegisterType((*MulticastMessage)(nil), "clusterpb.MulticastMessage")
+	proto.RegisterType((*UserNode)(nil), "clusterpb.UserNode")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -427,6 +809,9 @@ const _ = grpc.SupportPackageIsVersion4
 type MasterClient interface {
 	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
 	Unregister(ctx context.Context, in *UnregisterRequest, opts ...grpc.CallOption) (*UnregisterResponse, error)
+	BindUser(ctx context.Context, in *BindUserRequest, opts ...grpc.CallOption) (*BindUserResponse, error)
+	UnbindUser(ctx context.Context, in *UnbindUserRequest, opts ...grpc.CallOption) (*UnbindUserResponse, error)
+	FindUsers(ctx context.Context, in *FindUsersRequest, opts ...grpc.CallOption) (*FindUsersResponse, error)
 }
 
 type masterClient struct {
@@ -455,11 +840,41 @@ func (c *masterClient) Unregister(ctx context.Context, in *UnregisterRequest, op
 	return out, nil
 }
 
+func (c *masterClient) BindUser(ctx context.Context, in *BindUserRequest, opts ...grpc.CallOption) (*BindUserResponse, error) {
+	out := new(BindUserResponse)
+	err := grpc.Invoke(ctx, "/clusterpb.Master/BindUser", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) UnbindUser(ctx context.Context, in *UnbindUserRequest, opts ...grpc.CallOption) (*UnbindUserResponse, error) {
+	out := new(UnbindUserResponse)
+	err := grpc.Invoke(ctx, "/clusterpb.Master/UnbindUser", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) FindUsers(ctx context.Context, in *FindUsersRequest, opts ...grpc.CallOption) (*FindUsersResponse, error) {
+	out := new(FindUsersResponse)
+	err := grpc.Invoke(ctx, "/clusterpb.Master/FindUsers", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Master service
 
 type MasterServer interface {
 	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
 	Unregister(context.Context, *UnregisterRequest) (*UnregisterResponse, error)
+	BindUser(context.Context, *BindUserRequest) (*BindUserResponse, error)
+	UnbindUser(context.Context, *UnbindUserRequest) (*UnbindUserResponse, error)
+	FindUsers(context.Context, *FindUsersRequest) (*FindUsersResponse, error)
 }
 
 func RegisterMasterServer(s *grpc.Server, srv MasterServer) {
@@ -502,6 +917,60 @@ func _Master_Unregister_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Master_BindUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BindUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).BindUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/clusterpb.Master/BindUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).BindUser(ctx, req.(*BindUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_UnbindUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnbindUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).UnbindUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/clusterpb.Master/UnbindUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).UnbindUser(ctx, req.(*UnbindUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_FindUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).FindUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/clusterpb.Master/FindUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).FindUsers(ctx, req.(*FindUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Master_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "clusterpb.Master",
 	HandlerType: (*MasterServer)(nil),
@@ -514,6 +983,18 @@ var _Master_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Unregister",
 			Handler:    _Master_Unregister_Handler,
 		},
+		{
+			MethodName: "BindUser",
+			Handler:    _Master_BindUser_Handler,
+		},
+		{
+			MethodName: "UnbindUser",
+			Handler:    _Master_UnbindUser_Handler,
+		},
+		{
+			MethodName: "FindUsers",
+			Handler:    _Master_FindUsers_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "cluster.proto",
@@ -530,6 +1011,11 @@ type MemberClient interface {
 	DelMember(ctx context.Context, in *DelMemberRequest, opts ...grpc.CallOption) (*DelMemberResponse, error)
 	SessionClosed(ctx context.Context, in *SessionClosedRequest, opts ...grpc.CallOption) (*SessionClosedResponse, error)
 	CloseSession(ctx context.Context, in *CloseSessionRequest, opts ...grpc.CallOption) (*CloseSessionResponse, error)
+	MigrateSession(ctx context.Context, in *MigrateSessionRequest, opts ...grpc.CallOption) (*MigrateSessionResponse, error)
+	PushToUsers(ctx context.Context, in *PushToUsersRequest, opts ...grpc.CallOption) (*UserMessageResponse, error)
+	KickUsers(ctx context.Context, in *KickUsersRequest, opts ...grpc.CallOption) (*UserMessageResponse, error)
+	MigrateAffinity(ctx context.Context, in *MigrateAffinityRequest, opts ...grpc.CallOption) (*MigrateAffinityResponse, error)
+	HandleMulticast(ctx context.Context, in *MulticastMessage, opts ...grpc.CallOption) (*UserMessageResponse, error)
 }
 
 type memberClient struct {
@@ -612,6 +1098,51 @@ func (c *memberClient) CloseSession(ctx context.Context, in *CloseSessionRequest
 	return out, nil
 }
 
+func (c *memberClient) MigrateSession(ctx context.Context, in *MigrateSessionRequest, opts ...grpc.CallOption) (*MigrateSessionResponse, error) {
+	out := new(MigrateSessionResponse)
+	err := grpc.Invoke(ctx, "/clusterpb.Member/MigrateSession", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memberClient) PushToUsers(ctx context.Context, in *PushToUsersRequest, opts ...grpc.CallOption) (*UserMessageResponse, error) {
+	out := new(UserMessageResponse)
+	err := grpc.Invoke(ctx, "/clusterpb.Member/PushToUsers", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memberClient) KickUsers(ctx context.Context, in *KickUsersRequest, opts ...grpc.CallOption) (*UserMessageResponse, error) {
+	out := new(UserMessageResponse)
+	err := grpc.Invoke(ctx, "/clusterpb.Member/KickUsers", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memberClient) MigrateAffinity(ctx context.Context, in *MigrateAffinityRequest, opts ...grpc.CallOption) (*MigrateAffinityResponse, error) {
+	out := new(MigrateAffinityResponse)
+	err := grpc.Invoke(ctx, "/clusterpb.Member/MigrateAffinity", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memberClient) HandleMulticast(ctx context.Context, in *MulticastMessage, opts ...grpc.CallOption) (*UserMessageResponse, error) {
+	out := new(UserMessageResponse)
+	err := grpc.Invoke(ctx, "/clusterpb.Member/HandleMulticast", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Member service
 
 type MemberServer interface {
@@ -623,6 +1154,11 @@ type MemberServer interface {
 	DelMember(context.Context, *DelMemberRequest) (*DelMemberResponse, error)
 	SessionClosed(context.Context, *SessionClosedRequest) (*SessionClosedResponse, error)
 	CloseSession(context.Context, *CloseSessionRequest) (*CloseSessionResponse, error)
+	MigrateSession(context.Context, *MigrateSessionRequest) (*MigrateSessionResponse, error)
+	PushToUsers(context.Context, *PushToUsersRequest) (*UserMessageResponse, error)
+	KickUsers(context.Context, *KickUsersRequest) (*UserMessageResponse, error)
+	MigrateAffinity(context.Context, *MigrateAffinityRequest) (*MigrateAffinityResponse, error)
+	HandleMulticast(context.Context, *MulticastMessage) (*UserMessageResponse, error)
 }
 
 func RegisterMemberServer(s *grpc.Server, srv MemberServer) {
@@ -773,6 +1309,96 @@ func _Member_CloseSession_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Member_MigrateSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MigrateSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServer).MigrateSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/clusterpb.Member/MigrateSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServer).MigrateSession(ctx, req.(*MigrateSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Member_PushToUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushToUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServer).PushToUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/clusterpb.Member/PushToUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServer).PushToUsers(ctx, req.(*PushToUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Member_KickUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KickUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServer).KickUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/clusterpb.Member/KickUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServer).KickUsers(ctx, req.(*KickUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Member_MigrateAffinity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MigrateAffinityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServer).MigrateAffinity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/clusterpb.Member/MigrateAffinity",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServer).MigrateAffinity(ctx, req.(*MigrateAffinityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Member_HandleMulticast_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MulticastMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServer).HandleMulticast(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/clusterpb.Member/HandleMulticast",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServer).HandleMulticast(ctx, req.(*MulticastMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Member_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "clusterpb.Member",
 	HandlerType: (*MemberServer)(nil),
@@ -809,6 +1435,26 @@ var _Member_serviceDesc = grpc.ServiceDesc{
 			MethodName: "CloseSession",
 			Handler:    _Member_CloseSession_Handler,
 		},
+		{
+			MethodName: "MigrateSession",
+			Handler:    _Member_MigrateSession_Handler,
+		},
+		{
+			MethodName: "PushToUsers",
+			Handler:    _Member_PushToUsers_Handler,
+		},
+		{
+			MethodName: "KickUsers",
+			Handler:    _Member_KickUsers_Handler,
+		},
+		{
+			MethodName: "MigrateAffinity",
+			Handler:    _Member_MigrateAffinity_Handler,
+		},
+		{
+			MethodName: "HandleMulticast",
+			Handler:    _Member_HandleMulticast_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "cluster.proto",
@@ -817,42 +1463,74 @@ var _Member_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("cluster.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 591 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x95, 0x5d, 0x73, 0xd2, 0x4c,
-	0x14, 0xc7, 0x09, 0xa1, 0x3c, 0xe5, 0xf0, 0xf2, 0xc0, 0x81, 0x62, 0x8c, 0xa8, 0x99, 0x5c, 0x71,
-	0x85, 0x33, 0xd4, 0x7e, 0x00, 0xa7, 0x3a, 0xc2, 0x38, 0x54, 0x4d, 0xed, 0xbd, 0xa1, 0xd9, 0x62,
-	0x66, 0x52, 0x82, 0xd9, 0xa0, 0xe3, 0xbd, 0x1f, 0xc3, 0x6f, 0xea, 0x8d, 0x93, 0x6c, 0xb2, 0x9c,
-	0x0d, 0x41, 0x99, 0xe9, 0x1d, 0xbb, 0x67, 0xcf, 0xef, 0xbc, 0xfe, 0x09, 0xb4, 0x6f, 0x83, 0x2d,
-	0x8f, 0x59, 0x34, 0xd9, 0x44, 0x61, 0x1c, 0x62, 0x23, 0x3b, 0x6e, 0x96, 0xf6, 0x67, 0x80, 0x05,
-	0xbb, 0x5f, 0xb2, 0x68, 0xbe, 0xbe, 0x0b, 0x71, 0x00, 0x27, 0x81, 0xbb, 0x64, 0x81, 0xa1, 0x59,
-	0xda, 0xb8, 0xe1, 0x88, 0x03, 0x5a, 0xd0, 0xe4, 0x2c, 0xfa, 0xe6, 0xdf, 0xb2, 0x57, 0x9e, 0x17,
-	0x19, 0xd5, 0xd4, 0x46, 0xaf, 0xd0, 0x84, 0xd3, 0xec, 0xc8, 0x0d, 0xdd, 0xd2, 0xc7, 0x0d, 0x47,
-	0x9e, 0xed, 0x19, 0xfc, 0xef, 0xb0, 0x95, 0x9f, 0xc4, 0x73, 0xd8, 0xd7, 0x2d, 0xe3, 0x31, 0x5e,
-	0x00, 0xdc, 0xcb, 0xa0, 0x69, 0xac, 0xe6, 0xf4, 0x6c, 0x22, 0x93, 0x9a, 0xec, 0x32, 0x72, 0xc8,
-	0x43, 0xfb, 0x12, 0xba, 0x3b, 0x12, 0xdf, 0x84, 0x6b, 0xce, 0xf0, 0x05, 0xfc, 0x27, 0x5e, 0x70,
-	0x43, 0xb3, 0xf4, 0xc3, 0x9c, 0xfc, 0x95, 0x7d, 0x01, 0xbd, 0x9b, 0x75, 0x54, 0x48, 0xa8, 0x50,
-	0xa1, 0xb6, 0x57, 0xa1, 0x3d, 0x00, 0xa4, 0x6e, 0x22, 0xba, 0xfd, 0x53, 0x83, 0x4e, 0xc6, 0x58,
-	0x30, 0xce, 0xdd, 0x15, 0x4b, 0x5a, 0xb1, 0x72, 0x63, 0xca, 0x91, 0x67, 0x1c, 0x41, 0x83, 0x33,
-	0xce, 0xfd, 0x70, 0x3d, 0xf7, 0xd2, 0x36, 0xea, 0xce, 0xee, 0x02, 0x3b, 0x50, 0xf5, 0x3d, 0x43,
-	0xb7, 0xb4, 0x71, 0xcd, 0xa9, 0xfa, 0x5e, 0x32, 0x8c, 0x28, 0xdc, 0xc6, 0xcc, 0xa8, 0x89, 0x61,
-	0xa4, 0x07, 0x44, 0xa8, 0x79, 0x6e, 0xec, 0x1a, 0x27, 0x96, 0x36, 0x6e, 0x39, 0xe9, 0x6f, 0x9b,
-	0x43, 0xfb, 0x2a, 0x8c, 0xfd, 0xbb, 0x1f, 0x0f, 0x4f, 0x42, 0x06, 0xd5, 0xcb, 0x82, 0xd6, 0x48,
-	0xd0, 0xeb, 0x64, 0xae, 0xa2, 0x0f, 0x79, 0x58, 0x05, 0xad, 0x95, 0xd7, 0x57, 0x95, 0xf5, 0xe5,
-	0x50, 0x9d, 0x40, 0x6f, 0xa0, 0xf9, 0x61, 0xcb, 0xbf, 0x1c, 0x07, 0x94, 0xb9, 0x56, 0xcb, 0x72,
-	0xa5, 0xd8, 0x21, 0x0c, 0xc4, 0x2e, 0xcc, 0xdc, 0xb5, 0x17, 0x30, 0x39, 0xbf, 0x39, 0x74, 0xaf,
-	0xd8, 0x77, 0x61, 0x7a, 0xe0, 0x72, 0xf6, 0xa1, 0x47, 0x50, 0x19, 0xff, 0x25, 0x74, 0x5f, 0xb3,
-	0x40, 0xe5, 0xff, 0x7b, 0xd7, 0xfa, 0xd0, 0x23, 0x5e, 0x12, 0x35, 0xb8, 0x16, 0x95, 0x5f, 0x06,
-	0x21, 0x67, 0x5e, 0x8e, 0xfb, 0x6b, 0x8b, 0xec, 0x47, 0x70, 0x56, 0xf0, 0xca, 0x70, 0xe7, 0xd0,
-	0x4f, 0x6f, 0x32, 0xeb, 0x71, 0xb4, 0x21, 0x0c, 0x54, 0x27, 0x01, 0x9b, 0xfe, 0xd2, 0xa0, 0xbe,
-	0x70, 0x93, 0xfe, 0xe0, 0x1b, 0x38, 0xcd, 0x35, 0x8a, 0x26, 0xe9, 0x5a, 0xe1, 0x2f, 0xc0, 0x7c,
-	0x52, 0x6a, 0xcb, 0x92, 0xab, 0xe0, 0x3b, 0x80, 0x9d, 0xdc, 0x70, 0x44, 0x1e, 0xef, 0x89, 0xd7,
-	0x7c, 0x7a, 0xc0, 0x9a, 0xc3, 0xa6, 0xbf, 0x6b, 0x50, 0x17, 0xdd, 0xc4, 0x05, 0xb4, 0xf3, 0x15,
-	0x10, 0x05, 0x3f, 0x56, 0xf2, 0xa0, 0x4a, 0x36, 0x9f, 0xef, 0x0d, 0xbd, 0xb0, 0x3d, 0x49, 0x9a,
-	0x2d, 0x71, 0x27, 0xe4, 0x87, 0x06, 0x71, 0x51, 0x14, 0x79, 0x0c, 0xec, 0x2d, 0x80, 0xb8, 0x4b,
-	0x14, 0x80, 0x43, 0xe2, 0x40, 0x24, 0x71, 0x0c, 0xe8, 0x3d, 0x74, 0xd4, 0xbb, 0xc2, 0x24, 0x14,
-	0xd1, 0x1e, 0x03, 0x9c, 0x41, 0x43, 0xee, 0x36, 0xd2, 0xc9, 0x15, 0xc5, 0x63, 0x8e, 0xca, 0x8d,
-	0x94, 0x24, 0x57, 0x5b, 0x21, 0x15, 0x65, 0xa2, 0x90, 0xf6, 0xd5, 0x50, 0xc1, 0x4f, 0xd0, 0x56,
-	0x36, 0x1b, 0x69, 0x1d, 0x65, 0x4a, 0x31, 0xad, 0xc3, 0x0f, 0x24, 0xf5, 0x23, 0xb4, 0xe8, 0x86,
-	0xe3, 0x33, 0xe2, 0x53, 0xa2, 0x17, 0xa5, 0x79, 0x65, 0xd2, 0xb0, 0x2b, 0xcb, 0x7a, 0xfa, 0xcd,
-	0x3d, 0xff, 0x13, 0x00, 0x00, 0xff, 0xff, 0x80, 0x79, 0x99, 0xc0, 0x84, 0x07, 0x00, 0x00,
+	// 1100 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x57, 0xcd, 0x72, 0xdb, 0x36,
+	0x10, 0x36, 0x45, 0xd9, 0x91, 0x56, 0xb6, 0x25, 0x43, 0xb6, 0xc3, 0xd0, 0xb2, 0xa3, 0xf0, 0xd0,
+	0xba, 0x17, 0x25, 0x75, 0x9a, 0x19, 0x4f, 0x67, 0x72, 0x70, 0x53, 0x37, 0x76, 0x53, 0xb9, 0x0e,
+	0x13, 0x4f, 0x67, 0x3a, 0x3d, 0x94, 0x12, 0x61, 0x15, 0x35, 0x4d, 0xba, 0x04, 0x99, 0x8e, 0xee,
+	0x7d, 0x8e, 0xbe, 0x46, 0x5f, 0xa8, 0x87, 0x3e, 0x43, 0x4f, 0x1d, 0x10, 0x20, 0x04, 0x42, 0xd4,
+	0x4f, 0xeb, 0xde, 0xb8, 0x00, 0xf6, 0xdb, 0xc5, 0x2e, 0xf0, 0xe1, 0x23, 0x6c, 0x0c, 0x83, 0x94,
+	0x26, 0x38, 0xee, 0xdd, 0xc5, 0x51, 0x12, 0xa1, 0xba, 0x30, 0xef, 0x06, 0xce, 0x8f, 0x00, 0x7d,
+	0x7c, 0x3b, 0xc0, 0xf1, 0x79, 0x78, 0x1d, 0xa1, 0x6d, 0x58, 0x0d, 0xbc, 0x01, 0x0e, 0x2c, 0xa3,
+	0x6b, 0x1c, 0xd6, 0x5d, 0x6e, 0xa0, 0x2e, 0x34, 0x28, 0x8e, 0x3f, 0x90, 0x21, 0x3e, 0xf1, 0xfd,
+	0xd8, 0xaa, 0x64, 0x73, 0xea, 0x10, 0xb2, 0xa1, 0x26, 0x4c, 0x6a, 0x99, 0x5d, 0xf3, 0xb0, 0xee,
+	0x4a, 0xdb, 0x39, 0x83, 0xa6, 0x8b, 0x47, 0x84, 0xc5, 0x73, 0xf1, 0x2f, 0x29, 0xa6, 0x09, 0x7a,
+	0x01, 0x70, 0x2b, 0x83, 0x66, 0xb1, 0x1a, 0x47, 0x3b, 0x3d, 0x99, 0x54, 0x6f, 0x92, 0x91, 0xab,
+	0x2c, 0x74, 0x5e, 0x41, 0x6b, 0x82, 0x44, 0xef, 0xa2, 0x90, 0x62, 0xf4, 0x14, 0x1e, 0xf0, 0x15,
+	0xd4, 0x32, 0xba, 0xe6, 0x6c, 0x9c, 0x7c, 0x95, 0xf3, 0x02, 0xb6, 0xae, 0xc2, 0x58, 0x4b, 0x48,
+	0xdb, 0xa1, 0x31, 0xb5, 0x43, 0x67, 0x1b, 0x90, 0xea, 0xc6, 0xa3, 0x3b, 0xbf, 0x19, 0xb0, 0x29,
+	0x30, 0xfa, 0x98, 0x52, 0x6f, 0x84, 0x59, 0x29, 0x46, 0x5e, 0xa2, 0xe2, 0x48, 0x1b, 0x75, 0xa0,
+	0x4e, 0x31, 0xa5, 0x24, 0x0a, 0xcf, 0xfd, 0xac, 0x8c, 0xa6, 0x3b, 0x19, 0x40, 0x9b, 0x50, 0x21,
+	0xbe, 0x65, 0x76, 0x8d, 0xc3, 0xaa, 0x5b, 0x21, 0x3e, 0x6b, 0x46, 0x1c, 0xa5, 0x09, 0xb6, 0xaa,
+	0xbc, 0x19, 0x99, 0x81, 0x10, 0x54, 0x7d, 0x2f, 0xf1, 0xac, 0xd5, 0xae, 0x71, 0xb8, 0xee, 0x66,
+	0xdf, 0x0e, 0x85, 0x8d, 0x8b, 0x28, 0x21, 0xd7, 0xe3, 0xfb, 0x27, 0x21, 0x83, 0x9a, 0x65, 0x41,
+	0xab, 0x4a, 0xd0, 0x77, 0xd0, 0xcc, 0xeb, 0x90, 0x87, 0x2d, 0x40, 0x1b, 0xe5, 0xfb, 0xab, 0xc8,
+	0xfd, 0xe5, 0xa0, 0xa6, 0x02, 0x7a, 0x05, 0x8d, 0xcb, 0x94, 0xfe, 0xb4, 0x1c, 0xa0, 0xcc, 0xb5,
+	0x52, 0x96, 0xab, 0x0a, 0xbb, 0x0b, 0xdb, 0xfc, 0x2c, 0x9c, 0x79, 0xa1, 0x1f, 0x60, 0xd9, 0xbf,
+	0x73, 0x68, 0x5d, 0xe0, 0x5f, 0xf9, 0xd4, 0x3d, 0x0f, 0x67, 0x1b, 0xb6, 0x14, 0x28, 0x81, 0xff,
+	0x19, 0xb4, 0xbe, 0xc4, 0x41, 0x11, 0x7f, 0xf1, 0x59, 0x6b, 0xc3, 0x96, 0xe2, 0x25, 0xa0, 0xbe,
+	0x81, 0xed, 0x77, 0x7c, 0xe7, 0xaf, 0x82, 0x88, 0x62, 0x3f, 0x87, 0x9b, 0x5f, 0xa2, 0x5d, 0x58,
+	0x8b, 0xb1, 0x47, 0xa3, 0x50, 0xd4, 0x48, 0x58, 0xce, 0x43, 0xd8, 0xd1, 0xd0, 0x44, 0x98, 0xe7,
+	0xd0, 0xce, 0x46, 0xc4, 0xec, 0x52, 0x51, 0x58, 0x79, 0x8b, 0x4e, 0x02, 0xec, 0x2f, 0x03, 0x76,
+	0xfa, 0x64, 0x14, 0x7b, 0x89, 0x8e, 0xd7, 0x02, 0x33, 0x25, 0x39, 0x12, 0xfb, 0x64, 0xcd, 0x4c,
+	0xa2, 0x1b, 0x9c, 0x27, 0xca, 0x0d, 0x74, 0x09, 0xe0, 0x25, 0x49, 0x4c, 0x06, 0x69, 0x22, 0xa8,
+	0xa5, 0x71, 0xf4, 0x4c, 0x6d, 0x46, 0x19, 0x7a, 0xef, 0x44, 0xba, 0x9c, 0x86, 0x49, 0x3c, 0x76,
+	0x15, 0x0c, 0x56, 0x91, 0x51, 0x1c, 0xa5, 0x77, 0xd4, 0xaa, 0x66, 0x44, 0x25, 0x2c, 0xfb, 0x25,
+	0x34, 0x35, 0x37, 0x96, 0xe4, 0x0d, 0x1e, 0x8b, 0x0e, 0xb1, 0x4f, 0x96, 0xe4, 0x07, 0x2f, 0x48,
+	0xf9, 0x89, 0x5b, 0x77, 0xb9, 0xf1, 0x79, 0xe5, 0xd8, 0x70, 0x8e, 0x61, 0x57, 0xcf, 0x45, 0x30,
+	0xd4, 0x01, 0xc0, 0x30, 0x20, 0x38, 0x4c, 0x94, 0x76, 0x2b, 0x23, 0xce, 0x29, 0x34, 0xbf, 0x20,
+	0xa1, 0x7f, 0x45, 0x71, 0x3c, 0xbb, 0x3a, 0x0b, 0x29, 0xd8, 0x41, 0xd0, 0x9a, 0xc0, 0x88, 0xfa,
+	0xbf, 0x66, 0x5c, 0x37, 0xf8, 0x1f, 0xc0, 0x33, 0xf6, 0x1b, 0xe8, 0xf0, 0x1f, 0x41, 0xeb, 0x2b,
+	0x31, 0x46, 0x73, 0x74, 0x04, 0xd5, 0x94, 0xf8, 0x9c, 0x8c, 0x4d, 0x37, 0xfb, 0x76, 0xfe, 0x30,
+	0x60, 0x4b, 0x59, 0x28, 0xea, 0xf2, 0x12, 0x56, 0x3d, 0xdf, 0x97, 0xbc, 0xfd, 0xb1, 0xd2, 0xd5,
+	0xa9, 0xc5, 0x3d, 0x96, 0x85, 0x68, 0x26, 0xf7, 0x42, 0x9f, 0xc0, 0x6a, 0x18, 0xf9, 0x98, 0x5a,
+	0x95, 0xcc, 0xbd, 0xad, 0xb8, 0x33, 0xd7, 0x8b, 0xc8, 0xc7, 0x2e, 0x5f, 0x61, 0x1f, 0x03, 0x4c,
+	0xfc, 0xd5, 0xae, 0x9a, 0x25, 0x5d, 0xad, 0xab, 0x5d, 0xfd, 0x19, 0x10, 0xa3, 0xa3, 0xf7, 0xd1,
+	0xa2, 0x3d, 0x2e, 0xcf, 0x45, 0xec, 0x00, 0xfa, 0x98, 0x55, 0x56, 0xf0, 0xba, 0xb0, 0x1c, 0x17,
+	0x5a, 0x6f, 0xc8, 0xf0, 0x66, 0x61, 0xa4, 0x19, 0x57, 0xba, 0x94, 0xf7, 0x9e, 0x42, 0x9b, 0xe1,
+	0x09, 0x3a, 0x95, 0xa5, 0xb7, 0xe0, 0xc1, 0x2d, 0xa1, 0x94, 0x84, 0x23, 0x81, 0x9c, 0x9b, 0xce,
+	0x9f, 0x86, 0x3c, 0xc7, 0x27, 0xd7, 0xd7, 0x24, 0x24, 0xc9, 0x38, 0xcf, 0xe5, 0xbf, 0xbf, 0x29,
+	0x6f, 0x4b, 0x2e, 0xf1, 0xa7, 0xd3, 0x97, 0x58, 0x0b, 0x38, 0xef, 0x16, 0xdf, 0xf7, 0xb6, 0x3e,
+	0x82, 0x87, 0x53, 0x41, 0xc5, 0xa1, 0xfe, 0x01, 0x5a, 0xfd, 0x34, 0x48, 0xc8, 0xd0, 0x9b, 0xbc,
+	0xe9, 0x07, 0x00, 0x72, 0x37, 0x79, 0x33, 0x94, 0x91, 0x7f, 0xf1, 0x10, 0x3d, 0x83, 0x5a, 0x7e,
+	0x3a, 0x4b, 0x2e, 0x22, 0x82, 0xaa, 0x37, 0xb9, 0x81, 0xd9, 0xf7, 0xd1, 0xdf, 0x15, 0x58, 0xeb,
+	0x7b, 0xac, 0x52, 0xe8, 0x14, 0x6a, 0xb9, 0xfe, 0x41, 0xb6, 0x52, 0x3f, 0x4d, 0x5e, 0xd9, 0x7b,
+	0xa5, 0x73, 0x62, 0x7f, 0x2b, 0xe8, 0x0d, 0xc0, 0x44, 0xca, 0xa0, 0x8e, 0x7a, 0x71, 0x74, 0x61,
+	0x64, 0xef, 0xcf, 0x98, 0x95, 0x60, 0xa7, 0x50, 0xcb, 0x69, 0xa7, 0x90, 0x93, 0x46, 0x69, 0xf6,
+	0x5e, 0xe9, 0x5c, 0x31, 0xa7, 0x9c, 0x60, 0xb4, 0x9c, 0x34, 0x02, 0xb3, 0xf7, 0x67, 0xcc, 0x4a,
+	0xb0, 0x33, 0xa8, 0x4b, 0x06, 0x41, 0x7b, 0xe5, 0xbc, 0xc2, 0xa1, 0x3a, 0xf3, 0x48, 0xc7, 0x59,
+	0x39, 0xfa, 0xbd, 0x06, 0x6b, 0xfc, 0x1d, 0x46, 0x7d, 0xd8, 0xc8, 0xc5, 0x03, 0xbf, 0x0f, 0x8f,
+	0x0a, 0x55, 0x56, 0x35, 0xa0, 0xfd, 0x78, 0x4a, 0x2e, 0x68, 0xba, 0x83, 0x6d, 0x78, 0x9d, 0x8f,
+	0x71, 0xe1, 0x86, 0x2c, 0xc5, 0xa5, 0xa0, 0xe5, 0x96, 0x01, 0x7b, 0x0d, 0xc0, 0xc7, 0x18, 0x59,
+	0xa1, 0x5d, 0xc5, 0x41, 0x11, 0x53, 0xcb, 0x00, 0x7d, 0x0b, 0x9b, 0xc5, 0x31, 0xed, 0x9c, 0x15,
+	0xe4, 0xde, 0x32, 0x80, 0x67, 0x50, 0x97, 0xaa, 0xa8, 0xd0, 0x0a, 0x5d, 0x76, 0xd9, 0x9d, 0xf2,
+	0x49, 0x15, 0x49, 0x8a, 0xa2, 0x02, 0x92, 0x2e, 0xb0, 0xec, 0x4e, 0xf9, 0xa4, 0x44, 0x7a, 0x0f,
+	0x1b, 0x05, 0xed, 0x83, 0xd4, 0x7d, 0x94, 0x69, 0x2c, 0xbb, 0x3b, 0x7b, 0x81, 0x44, 0x7d, 0x0b,
+	0xeb, 0xaa, 0x06, 0x42, 0x07, 0x8a, 0x4f, 0x89, 0xa2, 0xb2, 0x1f, 0xcf, 0x9c, 0x97, 0x90, 0xdf,
+	0xc1, 0x66, 0x51, 0x53, 0xa0, 0xee, 0x22, 0xe9, 0x63, 0x3f, 0x99, 0xb3, 0x42, 0x02, 0x5f, 0x40,
+	0x43, 0x79, 0xd6, 0xd0, 0xbe, 0x76, 0x60, 0x8a, 0xcf, 0x9d, 0x7d, 0xa0, 0x3d, 0xad, 0xda, 0x6b,
+	0xe2, 0xac, 0xa0, 0xaf, 0xa1, 0x2e, 0x9f, 0xae, 0x42, 0x6f, 0xf4, 0x07, 0x6d, 0x09, 0xac, 0xef,
+	0xa1, 0xa9, 0x51, 0x33, 0x7a, 0xb2, 0xf0, 0xad, 0xb0, 0x9d, 0x79, 0x4b, 0x24, 0xf6, 0x25, 0x34,
+	0xf9, 0x09, 0x95, 0x0c, 0x5f, 0xc8, 0x56, 0xe7, 0xfd, 0xc5, 0xd9, 0x0e, 0xd6, 0xb2, 0x1f, 0xea,
+	0xe7, 0xff, 0x0c, 0x00, 0x36, 0xec, 0xfb, 0x2d, 0x61, 0x0f, 0x00, 0x00,
 }
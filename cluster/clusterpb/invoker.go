@@ -0,0 +1,204 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package clusterpb
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// Invoker calls the method of a service, the method is the full name of the
+// gRPC method, e.g: "/clusterpb.Member/HandleRequest". It is used to carry the
+// RPCs between the members over the transports other than gRPC.
+type Invoker func(ctx context.Context, method string, in, out proto.Message) error
+
+// MasterServiceDesc returns the description of the Master service, which is
+// used to dispatch the RPCs received by the transports other than gRPC
+func MasterServiceDesc() *grpc.ServiceDesc {
+	return &_Master_serviceDesc
+}
+
+// MemberServiceDesc returns the description of the Member service, which is
+// used to dispatch the RPCs received by the transports other than gRPC
+func MemberServiceDesc() *grpc.ServiceDesc {
+	return &_Member_serviceDesc
+}
+
+// NewMasterInvokerClient returns a MasterClient whose RPCs are called by invoke,
+// the call options are ignored
+func NewMasterInvokerClient(invoke Invoker) MasterClient {
+	return masterInvokerClient(invoke)
+}
+
+// NewMemberInvokerClient returns a MemberClient whose RPCs are called by invoke,
+// the call options are ignored
+func NewMemberInvokerClient(invoke Invoker) MemberClient {
+	return memberInvokerClient(invoke)
+}
+
+type masterInvokerClient Invoker
+
+type memberInvokerClient Invoker
+
+func (c masterInvokerClient) Register(ctx context.Context, in *RegisterRequest, _ ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	if err := c(ctx, "/clusterpb.Master/Register", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c masterInvokerClient) Unregister(ctx context.Context, in *UnregisterRequest, _ ...grpc.CallOption) (*UnregisterResponse, error) {
+	out := new(UnregisterResponse)
+	if err := c(ctx, "/clusterpb.Master/Unregister", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c masterInvokerClient) BindUser(ctx context.Context, in *BindUserRequest, _ ...grpc.CallOption) (*BindUserResponse, error) {
+	out := new(BindUserResponse)
+	if err := c(ctx, "/clusterpb.Master/BindUser", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c masterInvokerClient) UnbindUser(ctx context.Context, in *UnbindUserRequest, _ ...grpc.CallOption) (*UnbindUserResponse, error) {
+	out := new(UnbindUserResponse)
+	if err := c(ctx, "/clusterpb.Master/UnbindUser", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c masterInvokerClient) FindUsers(ctx context.Context, in *FindUsersRequest, _ ...grpc.CallOption) (*FindUsersResponse, error) {
+	out := new(FindUsersResponse)
+	if err := c(ctx, "/clusterpb.Master/FindUsers", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) HandleRequest(ctx context.Context, in *RequestMessage, _ ...grpc.CallOption) (*MemberHandleResponse, error) {
+	out := new(MemberHandleResponse)
+	if err := c(ctx, "/clusterpb.Member/HandleRequest", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) HandleNotify(ctx context.Context, in *NotifyMessage, _ ...grpc.CallOption) (*MemberHandleResponse, error) {
+	out := new(MemberHandleResponse)
+	if err := c(ctx, "/clusterpb.Member/HandleNotify", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) HandlePush(ctx context.Context, in *PushMessage, _ ...grpc.CallOption) (*MemberHandleResponse, error) {
+	out := new(MemberHandleResponse)
+	if err := c(ctx, "/clusterpb.Member/HandlePush", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) HandleResponse(ctx context.Context, in *ResponseMessage, _ ...grpc.CallOption) (*MemberHandleResponse, error) {
+	out := new(MemberHandleResponse)
+	if err := c(ctx, "/clusterpb.Member/HandleResponse", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) NewMember(ctx context.Context, in *NewMemberRequest, _ ...grpc.CallOption) (*NewMemberResponse, error) {
+	out := new(NewMemberResponse)
+	if err := c(ctx, "/clusterpb.Member/NewMember", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) DelMember(ctx context.Context, in *DelMemberRequest, _ ...grpc.CallOption) (*DelMemberResponse, error) {
+	out := new(DelMemberResponse)
+	if err := c(ctx, "/clusterpb.Member/DelMember", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) SessionClosed(ctx context.Context, in *SessionClosedRequest, _ ...grpc.CallOption) (*SessionClosedResponse, error) {
+	out := new(SessionClosedResponse)
+	if err := c(ctx, "/clusterpb.Member/SessionClosed", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) CloseSession(ctx context.Context, in *CloseSessionRequest, _ ...grpc.CallOption) (*CloseSessionResponse, error) {
+	out := new(CloseSessionResponse)
+	if err := c(ctx, "/clusterpb.Member/CloseSession", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) MigrateSession(ctx context.Context, in *MigrateSessionRequest, _ ...grpc.CallOption) (*MigrateSessionResponse, error) {
+	out := new(MigrateSessionResponse)
+	if err := c(ctx, "/clusterpb.Member/MigrateSession", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) PushToUsers(ctx context.Context, in *PushToUsersRequest, _ ...grpc.CallOption) (*UserMessageResponse, error) {
+	out := new(UserMessageResponse)
+	if err := c(ctx, "/clusterpb.Member/PushToUsers", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) KickUsers(ctx context.Context, in *KickUsersRequest, _ ...grpc.CallOption) (*UserMessageResponse, error) {
+	out := new(UserMessageResponse)
+	if err := c(ctx, "/clusterpb.Member/KickUsers", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) MigrateAffinity(ctx context.Context, in *MigrateAffinityRequest, _ ...grpc.CallOption) (*MigrateAffinityResponse, error) {
+	out := new(MigrateAffinityResponse)
+	if err := c(ctx, "/clusterpb.Member/MigrateAffinity", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c memberInvokerClient) HandleMulticast(ctx context.Context, in *MulticastMessage, _ ...grpc.CallOption) (*UserMessageResponse, error) {
+	out := new(UserMessageResponse)
+	if err := c(ctx, "/clusterpb.Member/HandleMulticast", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,187 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync/atomic"
+
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/metrics"
+)
+
+type (
+	// ComponentInfo describes a component registered to current node
+	ComponentInfo struct {
+		Name     string      `json:"name"`
+		Type     string      `json:"type"`
+		Routes   []RouteInfo `json:"routes"`
+		Inflight int64       `json:"inflight"` // invocations dispatched but not completed
+		// Suspended is the reason if the component has been suspended for
+		// exceeding its quota, see component.WithQuota
+		Suspended string `json:"suspended,omitempty"`
+	}
+
+	// RouteInfo describes a route served by a handler of component
+	RouteInfo struct {
+		Route   string   `json:"route"`
+		Handler string   `json:"handler"` // full name of the handler function
+		Params  []string `json:"params"`  // parameter types of the handler
+	}
+)
+
+// beginService counts an in-flight invocation of the service, which is ended by
+// calling the returned function
+func (h *LocalHandler) beginService(s *component.Service) func() {
+	h.currentNode.beginHandler()
+	counter := h.inflight[s.Name]
+	if counter != nil {
+		atomic.AddInt64(counter, 1)
+	}
+	return func() {
+		if counter != nil {
+			atomic.AddInt64(counter, -1)
+		}
+		h.currentNode.endHandler()
+	}
+}
+
+// admitService counts an in-flight invocation of the service, the returned
+// function runs the task within the quota of the service. The quota is acquired
+// once the invocation starts rather than when it is dispatched, so the queued
+// messages do not count against MaxGoroutines. component.ErrQuotaExceeded is
+// returned if the service has been suspended, and the messages rejected after
+// they are dispatched are dropped with the reason dropReasonRejected.
+func (h *LocalHandler) admitService(s *component.Service, route string, task func()) (func(), error) {
+	q := s.Quota
+	if q == nil {
+		end := h.beginService(s)
+		return func() {
+			defer end()
+			task()
+		}, nil
+	}
+
+	if _, suspended := q.Suspended(); suspended {
+		return nil, component.ErrQuotaExceeded
+	}
+	end := h.beginService(s)
+	return func() {
+		defer end()
+		if err := q.Acquire(); err != nil {
+			log.Println(fmt.Sprintf("Service %s rejected: %v", route, err))
+			metrics.ReportDroppedMessage(h.currentNode.MetricsReporters, route, dropReasonRejected)
+			return
+		}
+		defer q.Release()
+		defer q.Track()()
+		task()
+	}, nil
+}
+
+func (h *LocalHandler) componentInfos() []ComponentInfo {
+	infos := make([]ComponentInfo, 0, len(h.localServices))
+	for _, s := range h.localServices {
+		info := ComponentInfo{
+			Name:   s.Name,
+			Type:   s.Type.String(),
+			Routes: make([]RouteInfo, 0, len(s.Handlers)),
+		}
+		if counter := h.inflight[s.Name]; counter != nil {
+			info.Inflight = atomic.LoadInt64(counter)
+		}
+		if q := s.Quota; q != nil {
+			info.Suspended, _ = q.Suspended()
+		}
+		for name, handler := range s.Handlers {
+			route := s.Name + "." + name
+			if env.ProtoRoute {
+				route = handler.Type.Elem().Name()
+			}
+			info.Routes = append(info.Routes, RouteInfo{
+				Route:   route,
+				Handler: runtime.FuncForPC(handler.Method.Func.Pointer()).Name(),
+				Params:  paramTypes(handler.Method.Type),
+			})
+		}
+		sort.Slice(info.Routes, func(i, j int) bool { return info.Routes[i].Route < info.Routes[j].Route })
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// paramTypes returns the parameter types of a method excluding the receiver
+func paramTypes(typ reflect.Type) []string {
+	params := make([]string, 0, typ.NumIn()-1)
+	for i := 1; i < typ.NumIn(); i++ {
+		params = append(params, typ.In(i).String())
+	}
+	return params
+}
+
+// ComponentInfos returns the components registered to current node with their
+// routes and in-flight invocations, sorted by the component name
+func (n *Node) ComponentInfos() []ComponentInfo {
+	if n.handler == nil {
+		return nil
+	}
+	return n.handler.componentInfos()
+}
+
+func (n *Node) handleComponents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	json.NewEncoder(w).Encode(n.ComponentInfos())
+}
+
+// ResumeComponent resumes the component suspended for exceeding its quota, see
+// component.WithQuota
+func (n *Node) ResumeComponent(name string) error {
+	if n.handler == nil {
+		return ErrComponentNotFound
+	}
+	s, ok := n.handler.localServices[name]
+	if !ok || s.Quota == nil {
+		return ErrComponentNotFound
+	}
+	s.Quota.Resume()
+	return nil
+}
+
+func (n *Node) handleResumeComponent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := n.ResumeComponent(r.URL.Query().Get("name")); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
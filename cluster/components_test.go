@@ -0,0 +1,213 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/session"
+)
+
+func TestNode_ComponentInfos(t *testing.T) {
+	n := &Node{}
+	n.handler = NewHandler(n, nil)
+	h := n.handler
+	if err := h.register(&LogComponent{}, []component.Option{component.WithName("Log"), component.WithSchedulerName("queue")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.register(&ShadowComponent{}, []component.Option{component.WithName("Shadow")}); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	queue := make(queueScheduler, 1)
+	a.session.Set("queue", queue)
+	h.localProcess(h.localHandlers["Log.Echo"], 1, a.session, &message.Message{
+		Type: message.Request, ID: 1, Route: "Log.Echo", Data: []byte("hello"),
+	})
+	defer (<-queue)()
+
+	rec := httptest.NewRecorder()
+	n.handleComponents(rec, httptest.NewRequest(http.MethodGet, "/components", nil))
+	var infos []ComponentInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []ComponentInfo{
+		{
+			Name: "Log",
+			Type: "*cluster.LogComponent",
+			Routes: []RouteInfo{
+				{Route: "Log.Echo", Handler: "github.com/lonng/nano/cluster.(*LogComponent).Echo", Params: []string{"*session.Session", "[]uint8"}},
+				{Route: "Log.Fail", Handler: "github.com/lonng/nano/cluster.(*LogComponent).Fail", Params: []string{"*session.Session", "[]uint8"}},
+			},
+			Inflight: 1,
+		},
+		{
+			Name: "Shadow",
+			Type: "*cluster.ShadowComponent",
+			Routes: []RouteInfo{
+				{Route: "Shadow.Echo", Handler: "github.com/lonng/nano/cluster.(*ShadowComponent).Echo", Params: []string{"*session.Session", "[]uint8"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(infos, expect) {
+		t.Fatalf("expect: %+v, got: %+v", expect, infos)
+	}
+}
+
+// HeapComponent retains the memory allocated by its handler
+type HeapComponent struct {
+	component.Base
+	retained [][]byte
+}
+
+func (c *HeapComponent) Grow(s *session.Session, data []byte) error {
+	c.retained = append(c.retained, make([]byte, 8<<20))
+	return nil
+}
+
+func TestNode_ComponentQuota(t *testing.T) {
+	n := &Node{}
+	n.handler = NewHandler(n, nil)
+	h := n.handler
+	c := &BlockComponent{started: make(chan struct{}), release: make(chan struct{})}
+	opts := []component.Option{
+		component.WithName("Block"),
+		component.WithSchedulerName("queue"),
+		component.WithQuota(component.ComponentQuota{MaxGoroutines: 1}),
+	}
+	if err := h.register(c, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	queue := make(queueScheduler, 3)
+	a.session.Set("queue", queue)
+	dispatch := func() {
+		h.localProcess(h.localHandlers["Block.Wait"], 0, a.session, &message.Message{
+			Type: message.Notify, Route: "Block.Wait", Data: []byte("hello"),
+		})
+	}
+	suspended := func() string {
+		return n.ComponentInfos()[0].Suspended
+	}
+
+	// a burst of messages queued in the scheduler does not breach the quota
+	dispatch()
+	dispatch()
+	dispatch()
+	if len(queue) != 3 {
+		t.Fatalf("expect 3 invocations dispatched, got: %d", len(queue))
+	}
+	if reason := suspended(); reason != "" {
+		t.Fatalf("expect the component not to be suspended, got: %s", reason)
+	}
+
+	// the second invocation started concurrently breaches the quota, and the
+	// component is suspended
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		(<-queue)()
+	}()
+	<-c.started
+	(<-queue)()
+	if suspended() == "" {
+		t.Fatal("expect the component to be suspended")
+	}
+
+	// all messages are rejected until the component is resumed
+	(<-queue)()
+	c.release <- struct{}{}
+	<-done
+	dispatch()
+	if len(queue) != 0 {
+		t.Fatalf("expect the messages to be rejected, got: %d", len(queue))
+	}
+
+	rec := httptest.NewRecorder()
+	n.handleResumeComponent(rec, httptest.NewRequest(http.MethodPost, "/components/resume?name=Block", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expect: %d, got: %d", http.StatusOK, rec.Code)
+	}
+	if reason := suspended(); reason != "" {
+		t.Fatalf("expect the component to be resumed, got: %s", reason)
+	}
+	dispatch()
+	if len(queue) != 1 {
+		t.Fatalf("expect 1 invocation dispatched, got: %d", len(queue))
+	}
+	go func() {
+		<-c.started
+		c.release <- struct{}{}
+	}()
+	(<-queue)()
+
+	rec = httptest.NewRecorder()
+	n.handleResumeComponent(rec, httptest.NewRequest(http.MethodPost, "/components/resume?name=Unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expect: %d, got: %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestNode_ComponentQuotaHeap(t *testing.T) {
+	n := &Node{}
+	n.handler = NewHandler(n, nil)
+	h := n.handler
+	opts := []component.Option{
+		component.WithSchedulerName("queue"),
+		component.WithQuota(component.ComponentQuota{MaxHeapBytes: 1 << 20}),
+	}
+	if err := h.register(&HeapComponent{}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	queue := make(queueScheduler, 1)
+	a.session.Set("queue", queue)
+	// the garbage of the other tests collected during the invocation offsets
+	// the heap growth
+	runtime.GC()
+	h.localProcess(h.localHandlers["HeapComponent.Grow"], 0, a.session, &message.Message{
+		Type: message.Notify, Route: "HeapComponent.Grow", Data: []byte("hello"),
+	})
+	(<-queue)()
+
+	if reason := n.ComponentInfos()[0].Suspended; reason == "" {
+		t.Fatal("expect the component to be suspended for heap growth")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/metrics"
+)
+
+// reasons of the connections refused by the listeners, which are used as the
+// reason label of metrics
+const (
+	rejectMaxConnections = "max_connections"
+	rejectAcceptRate     = "accept_rate"
+)
+
+// limitListener closes the accepted connections exceeding the limits right away,
+// before any byte is read or written, so that a flood of connections costs the
+// least resources. The limits are shared by all the listeners of a node.
+type limitListener struct {
+	net.Listener
+	node *Node
+}
+
+// limited wraps the listener of TCP and WebSocket acceptors with the limits of
+// MaxConnections and AcceptRate if set
+func (n *Node) limited(ln net.Listener) net.Listener {
+	if n.MaxConnections <= 0 && n.AcceptRate <= 0 {
+		return ln
+	}
+	return &limitListener{Listener: ln, node: n}
+}
+
+// Accept waits for and returns the next connection within the limits
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if reason := l.node.admitConn(); reason != "" {
+			conn.Close()
+			metrics.ReportConnectionRejected(l.node.MetricsReporters, reason)
+			continue
+		}
+		return &limitedConn{Conn: conn, node: l.node}, nil
+	}
+}
+
+// admitConn reserves a connection, and returns the reason if it exceeds the
+// limits. The reserved connection should be released by releaseConn.
+func (n *Node) admitConn() string {
+	if n.AcceptRate > 0 && !n.acceptBucket.take(n.AcceptRate, n.AcceptBurst, env.Clock.Now()) {
+		return rejectAcceptRate
+	}
+	count := atomic.AddInt64(&n.openConns, 1)
+	if n.MaxConnections > 0 && count > int64(n.MaxConnections) {
+		atomic.AddInt64(&n.openConns, -1)
+		return rejectMaxConnections
+	}
+	return ""
+}
+
+// limitedConn releases the reserved connection once closed
+type limitedConn struct {
+	net.Conn
+	node *Node
+	once sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&c.node.openConns, -1) })
+	return c.Conn.Close()
+}
+
+// tokenBucket allows the events at rate per second with bursts of burst events
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token from the bucket, false is returned if there is no token
+func (b *tokenBucket) take(rate float64, burst int, now time.Time) bool {
+	if burst < 1 {
+		burst = 1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rate
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
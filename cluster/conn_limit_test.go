@@ -0,0 +1,111 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/metrics"
+)
+
+func TestTokenBucket(t *testing.T) {
+	var b tokenBucket
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !b.take(1, 3, now) {
+			t.Fatalf("expect the burst of 3 allowed, refused at %d", i)
+		}
+	}
+	if b.take(1, 3, now) {
+		t.Fatalf("expect the 4th token refused")
+	}
+	if !b.take(1, 3, now.Add(time.Second)) {
+		t.Fatalf("expect a token refilled after 1s")
+	}
+	if b.take(1, 3, now.Add(time.Second)) {
+		t.Fatalf("expect only 1 token refilled after 1s")
+	}
+	// the bucket does not hold more than the burst
+	for i := 0; i < 3; i++ {
+		b.take(1, 3, now.Add(time.Hour))
+	}
+	if b.take(1, 3, now.Add(time.Hour)) {
+		t.Fatalf("expect the tokens capped by the burst")
+	}
+}
+
+func TestLimitListener_MaxConnections(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{MaxConnections: 1, MetricsReporters: []metrics.Reporter{reporter}}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := n.limited(ln)
+	defer l.Close()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	c1 := dial()
+	defer c1.Close()
+	s1, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second connection is closed by the listener
+	c2 := dial()
+	defer c2.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c2.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expect the connection over the limit closed")
+	}
+	if v := reporter.value("connections_rejected_total{reason=max_connections}"); v != 1 {
+		t.Fatalf("expect: 1 rejected connection, got: %v", v)
+	}
+
+	// the slot is released once the connection is closed
+	s1.Close()
+	s1.Close()
+	c3 := dial()
+	defer c3.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatalf("expect the connection accepted after a slot released")
+	}
+}
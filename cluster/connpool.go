@@ -38,8 +38,9 @@ type connPool struct {
 
 type rpcClient struct {
 	sync.RWMutex
-	isClosed bool
-	pools    map[string]*connPool
+	isClosed  bool
+	pools     map[string]*connPool
+	transport RPCTransport // carries the RPCs instead of gRPC if present
 }
 
 func newConnArray(maxSize uint, addr string) (*connPool, error) {
@@ -0,0 +1,127 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/metrics"
+)
+
+// kick reasons of the timeouts
+const (
+	kickReasonIdle = "idle_timeout"
+)
+
+// deadlineConn sets the write deadline before each write, so that a write to
+// a half-open connection fails in the timeout instead of blocking until the
+// kernel send buffer is full
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func newDeadlineConn(conn net.Conn, timeout time.Duration) net.Conn {
+	if timeout <= 0 {
+		return conn
+	}
+	return &deadlineConn{Conn: conn, timeout: timeout}
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// reapInterval returns the interval to check the idle sessions, which is a
+// quarter of the timeout, so that a session is closed within 1.25x timeout
+func reapInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// startReaper closes the client sessions which have not sent any packet in
+// IdleTimeout periodically, until the node shutdown
+func (n *Node) startReaper() {
+	if n.IdleTimeout <= 0 {
+		return
+	}
+	n.reaperStop = make(chan struct{})
+	ticker := env.Clock.NewTicker(reapInterval(n.IdleTimeout))
+	go func(stop chan struct{}) {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				n.reapIdleSessions(env.Clock.Now())
+			case <-stop:
+				return
+			}
+		}
+	}(n.reaperStop)
+}
+
+func (n *Node) stopReaper() {
+	if n.reaperStop != nil {
+		close(n.reaperStop)
+		n.reaperStop = nil
+	}
+}
+
+// reapIdleSessions kicks the sessions idle for more than IdleTimeout, which
+// are closed with the normal lifecycle, e.g: OnSessionClosed callbacks
+func (n *Node) reapIdleSessions(now time.Time) {
+	deadline := now.Add(-n.IdleTimeout).Unix()
+	n.mu.RLock()
+	var agents []*agent
+	for _, s := range n.sessions {
+		// the suspended sessions are closed once they expire
+		if a, ok := s.NetworkEntity().(*agent); ok && a.status() != statusClosed && atomic.LoadInt64(&a.lastAt) < deadline {
+			agents = append(agents, a)
+		}
+	}
+	n.mu.RUnlock()
+
+	// the kicks are sent through the send queues concurrently, so that the clients
+	// not reading do not delay the others
+	var wg sync.WaitGroup
+	wg.Add(len(agents))
+	for _, a := range agents {
+		log.Println(fmt.Sprintf("Session idle timeout, SessionID=%d, %s", a.session.ID(), a.String()))
+		metrics.ReportSessionKicked(n.MetricsReporters, kickReasonIdle)
+		go func(a *agent) {
+			defer wg.Done()
+			a.kick(kickReasonIdle)
+		}(a)
+	}
+	wg.Wait()
+}
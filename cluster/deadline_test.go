@@ -0,0 +1,93 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+func TestNode_ReapIdleSessions(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{IdleTimeout: time.Minute, MetricsReporters: []metrics.Reporter{reporter}}}
+	n.sessions = map[int64]*session.Session{}
+	now := time.Now()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	idle := newAgent(server, nil, nil, nil)
+	idle.lastAt = now.Add(-2 * time.Minute).Unix()
+	go idle.write()
+	n.sessions[idle.session.ID()] = idle.session
+
+	server2, client2 := net.Pipe()
+	defer client2.Close()
+	active := newAgent(server2, nil, nil, nil)
+	active.lastAt = now.Add(-30 * time.Second).Unix()
+	n.sessions[active.session.ID()] = active.session
+
+	received := make(chan []byte, 1)
+	go func() {
+		data, _ := ioutil.ReadAll(client)
+		received <- data
+	}()
+	n.reapIdleSessions(now)
+
+	select {
+	case data := <-received:
+		if len(data) == 0 || packet.Type(data[0]) != packet.Kick {
+			t.Fatalf("expect the idle session kicked, got: %v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect the idle session closed")
+	}
+	if idle.status() != statusClosed {
+		t.Fatalf("expect the idle session closed")
+	}
+	if active.status() == statusClosed {
+		t.Fatalf("expect the active session alive")
+	}
+	if v := reporter.value("session_kicked{reason=idle_timeout}"); v != 1 {
+		t.Fatalf("expect: 1 kicked session, got: %v", v)
+	}
+}
+
+func TestDeadlineConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newDeadlineConn(server, 50*time.Millisecond)
+	defer conn.Close()
+
+	// nobody reads from the peer
+	start := time.Now()
+	if _, err := conn.Write([]byte("hello")); err == nil {
+		t.Fatalf("expect the write timed out")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect the write timed out in 50ms, got: %v", d)
+	}
+}
@@ -27,4 +27,16 @@ var (
 	ErrSessionOnNotify    = errors.New("current session working on notify mode")
 	ErrCloseClosedSession = errors.New("close closed session")
 	ErrInvalidRegisterReq = errors.New("invalid register request")
+	ErrNoMigrationTarget  = errors.New("no member can accept the migrated sessions")
+	ErrMigrationRefused   = errors.New("current node does not accept migrated sessions")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrDuplicateLogin     = errors.New("user has logged in with another session")
+	ErrComponentNotFound  = errors.New("component not found or has no quota")
+	ErrNodeNotRunning     = errors.New("node is not running")
+	ErrNodeDraining       = errors.New("node is draining")
+	ErrMasterUnreachable  = errors.New("master is unreachable")
+	ErrQUICCertificate    = errors.New("QUIC acceptor requires a TLS certificate")
+	ErrSendQueueFull      = errors.New("send queue of the session is full")
+	ErrEncodeMessage      = errors.New("message can not be encoded")
+	ErrMemberNotFound     = errors.New("member does not serve any remote service")
 )
@@ -0,0 +1,11 @@
+module github.com/lonng/nano/cluster/etcd
+
+go 1.12
+
+require (
+	github.com/golang/protobuf v1.5.3
+	github.com/lonng/nano v0.0.0
+	go.etcd.io/etcd/client/v3 v3.5.12
+)
+
+replace github.com/lonng/nano => ../..
@@ -0,0 +1,296 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+// Package etcd implements the cluster.Registry backed by etcd, the nodes are
+// registered with leases, so the members crashed are removed from the cluster
+// once their leases expire.
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/internal/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// DefaultPrefix is the default prefix of the keys of members
+	DefaultPrefix = "/nano/members/"
+	// DefaultTTL is the default TTL of the leases of members
+	DefaultTTL = 10 * time.Second
+
+	retryInterval = time.Second
+)
+
+// Option represents an option of Registry
+type Option func(r *Registry)
+
+// WithPrefix sets the prefix of the keys of members, e.g: to run several clusters
+// with one etcd cluster
+func WithPrefix(prefix string) Option {
+	return func(r *Registry) {
+		r.prefix = prefix
+	}
+}
+
+// WithTTL sets the TTL of the leases of members, which is how long a crashed
+// member stays in the cluster
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Registry) {
+		r.ttl = ttl
+	}
+}
+
+// Registry is a cluster.Registry backed by etcd, each member is saved in the key
+// <prefix><service address> attached to a lease kept alive by the member.
+type Registry struct {
+	client *clientv3.Client
+	prefix string
+	ttl    time.Duration
+
+	mu            sync.Mutex
+	registrations map[string]*registration // service address map to registration
+}
+
+// registration is the lease of a member registered by current process
+type registration struct {
+	mu     sync.Mutex
+	lease  clientv3.LeaseID
+	cancel context.CancelFunc // stops keeping the lease alive
+}
+
+// NewRegistry returns a Registry using the etcd client
+func NewRegistry(client *clientv3.Client, opts ...Option) *Registry {
+	r := &Registry{
+		client:        client,
+		prefix:        DefaultPrefix,
+		ttl:           DefaultTTL,
+		registrations: map[string]*registration{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Register implements the cluster.Registry interface, the lease is renewed until
+// the member is deregistered, and the member is registered again with a new lease
+// if the lease is lost, e.g: the node is partitioned from etcd longer than TTL.
+func (r *Registry) Register(ctx context.Context, member *clusterpb.MemberInfo) error {
+	value, err := proto.Marshal(member)
+	if err != nil {
+		return err
+	}
+	key := r.prefix + member.ServiceAddr
+	lease, err := r.put(ctx, key, string(value))
+	if err != nil {
+		return err
+	}
+
+	keepCtx, cancel := context.WithCancel(context.Background())
+	reg := &registration{lease: lease, cancel: cancel}
+	r.mu.Lock()
+	if prev, ok := r.registrations[member.ServiceAddr]; ok {
+		prev.cancel()
+	}
+	r.registrations[member.ServiceAddr] = reg
+	r.mu.Unlock()
+
+	go r.keepAlive(keepCtx, reg, key, string(value))
+	return nil
+}
+
+// Deregister implements the cluster.Registry interface, the key of the member is
+// removed by revoking its lease
+func (r *Registry) Deregister(ctx context.Context, addr string) error {
+	r.mu.Lock()
+	reg, ok := r.registrations[addr]
+	delete(r.registrations, addr)
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	reg.cancel()
+	reg.mu.Lock()
+	lease := reg.lease
+	reg.mu.Unlock()
+	_, err := r.client.Revoke(ctx, lease)
+	return err
+}
+
+// Watch implements the cluster.Registry interface, the members are listed again
+// if the watch is broken, e.g: the revision has been compacted.
+func (r *Registry) Watch(ctx context.Context) (<-chan []*clusterpb.MemberInfo, error) {
+	members, rev, err := r.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []*clusterpb.MemberInfo, 1)
+	ch <- snapshot(members)
+	go func() {
+		defer close(ch)
+		for {
+			r.watch(ctx, ch, members, rev)
+			if ctx.Err() != nil {
+				return
+			}
+			for {
+				members, rev, err = r.list(ctx)
+				if err == nil {
+					break
+				}
+				log.Println("List members from etcd failed", err, "and will retry in", retryInterval.String())
+				select {
+				case <-time.After(retryInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case ch <- snapshot(members):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// put saves the key with a new lease
+func (r *Registry) put(ctx context.Context, key, value string) (clientv3.LeaseID, error) {
+	ttl := int64(r.ttl / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	grant, err := r.client.Grant(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.client.Put(ctx, key, value, clientv3.WithLease(grant.ID)); err != nil {
+		return 0, err
+	}
+	return grant.ID, nil
+}
+
+// keepAlive renews the lease of the registration until ctx is done, the key
+// is saved with a new lease if the lease is lost
+func (r *Registry) keepAlive(ctx context.Context, reg *registration, key, value string) {
+	for {
+		reg.mu.Lock()
+		lease := reg.lease
+		reg.mu.Unlock()
+
+		ch, err := r.client.KeepAlive(ctx, lease)
+		if err == nil {
+			for range ch {
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println(fmt.Sprintf("Lease of %s is lost and will be granted again", key))
+
+		for {
+			lease, err = r.put(ctx, key, value)
+			if err == nil {
+				break
+			}
+			log.Println("Register member to etcd failed", err, "and will retry in", retryInterval.String())
+			select {
+			case <-time.After(retryInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+		reg.mu.Lock()
+		reg.lease = lease
+		reg.mu.Unlock()
+	}
+}
+
+// list returns the members registered and the revision of etcd
+func (r *Registry) list(ctx context.Context) (map[string]*clusterpb.MemberInfo, int64, error) {
+	resp, err := r.client.Get(ctx, r.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	members := map[string]*clusterpb.MemberInfo{}
+	for _, kv := range resp.Kvs {
+		if m := r.decode(kv.Key, kv.Value); m != nil {
+			members[string(kv.Key)] = m
+		}
+	}
+	return members, resp.Header.Revision, nil
+}
+
+// watch delivers the snapshots of the members changed after the revision until
+// the watch is broken or ctx is done
+func (r *Registry) watch(ctx context.Context, ch chan<- []*clusterpb.MemberInfo, members map[string]*clusterpb.MemberInfo, rev int64) {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for resp := range r.client.Watch(watchCtx, r.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1)) {
+		if err := resp.Err(); err != nil {
+			log.Println("Watch members from etcd failed", err)
+			return
+		}
+		for _, ev := range resp.Events {
+			key := string(ev.Kv.Key)
+			if ev.Type == clientv3.EventTypeDelete {
+				delete(members, key)
+			} else if m := r.decode(ev.Kv.Key, ev.Kv.Value); m != nil {
+				members[key] = m
+			}
+		}
+		select {
+		case ch <- snapshot(members):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// decode returns the member saved in the key, nil if the value is malformed
+func (r *Registry) decode(key, value []byte) *clusterpb.MemberInfo {
+	m := &clusterpb.MemberInfo{}
+	if err := proto.Unmarshal(value, m); err != nil {
+		log.Println(fmt.Sprintf("Decode member %s failed: %v", strings.TrimPrefix(string(key), r.prefix), err))
+		return nil
+	}
+	return m
+}
+
+// snapshot returns the members sorted by service address
+func snapshot(members map[string]*clusterpb.MemberInfo) []*clusterpb.MemberInfo {
+	list := make([]*clusterpb.MemberInfo, 0, len(members))
+	for _, m := range members {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ServiceAddr < list[j].ServiceAddr })
+	return list
+}
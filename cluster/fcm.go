@@ -0,0 +1,87 @@
+// +build fcm
+
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"fmt"
+
+	fcm "github.com/appleboy/go-fcm"
+)
+
+// FCMDelivery is the OfflineDelivery backed by Firebase Cloud Messaging, which
+// also delivers to the iOS devices via APNs. The user is notified on all devices
+// whose registration tokens are returned by the token lookup function.
+//
+// FCMDelivery depends on github.com/appleboy/go-fcm, which is only compiled with
+// the fcm build tag:
+//
+//	go get github.com/appleboy/go-fcm
+//	go build -tags fcm
+type FCMDelivery struct {
+	client *fcm.Client
+	tokens func(userID string) ([]string, error)
+}
+
+// NewFCMDelivery returns a FCMDelivery with the server key of FCM, tokens returns
+// the registration tokens of the devices of a user
+func NewFCMDelivery(apiKey string, tokens func(userID string) ([]string, error)) (*FCMDelivery, error) {
+	client, err := fcm.NewClient(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &FCMDelivery{client: client, tokens: tokens}, nil
+}
+
+// Send implements the OfflineDelivery interface
+func (d *FCMDelivery) Send(userID, title, body string, data map[string]string) error {
+	tokens, err := d.tokens(userID)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	payload := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		payload[k] = v
+	}
+	msg := &fcm.Message{
+		Notification: &fcm.Notification{Title: title, Body: body},
+		Data:         payload,
+	}
+	if len(tokens) == 1 {
+		msg.To = tokens[0]
+	} else {
+		msg.RegistrationIDs = tokens
+	}
+
+	resp, err := d.client.Send(msg)
+	if err != nil {
+		return err
+	}
+	if resp.Failure > 0 {
+		return fmt.Errorf("fcm: %d of %d deliveries failed", resp.Failure, len(tokens))
+	}
+	return nil
+}
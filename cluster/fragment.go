@@ -0,0 +1,104 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lonng/nano/internal/fragment"
+)
+
+// DefaultFragmentTimeout is the time to wait for all fragments of a message if
+// Options.FragmentTimeout is absent
+const DefaultFragmentTimeout = 10 * time.Second
+
+// fragmentConn splits the data written to the transport into the frames which
+// fit in the max frame size, and reassembles the frames read from the transport
+type fragmentConn struct {
+	net.Conn
+	fragmenter  *fragment.Fragmenter
+	reassembler *fragment.Reassembler
+
+	mu  sync.Mutex // keep the frames of a write together
+	buf []byte     // read buffer of frames
+	out []byte     // reassembled bytes not read yet
+}
+
+// fragmented wraps conn with fragmentation if the max frame size is set
+func (n *Node) fragmented(conn net.Conn) (net.Conn, error) {
+	if n.MaxFrameSize <= 0 {
+		return conn, nil
+	}
+	f, err := fragment.NewFragmenter(n.MaxFrameSize)
+	if err != nil {
+		return nil, err
+	}
+	timeout := n.FragmentTimeout
+	if timeout <= 0 {
+		timeout = DefaultFragmentTimeout
+	}
+	return &fragmentConn{
+		Conn:        conn,
+		fragmenter:  f,
+		reassembler: fragment.NewReassembler(timeout),
+		buf:         make([]byte, n.MaxFrameSize),
+	}, nil
+}
+
+// Read reads the reassembled bytes
+func (c *fragmentConn) Read(b []byte) (int, error) {
+	for len(c.out) == 0 {
+		n, err := c.Conn.Read(c.buf)
+		if err != nil {
+			return 0, err
+		}
+		messages, err := c.reassembler.Feed(c.buf[:n])
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range messages {
+			c.out = append(c.out, m...)
+		}
+	}
+	n := copy(b, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// Write splits b into frames, each frame is written with a single write, so a
+// frame is carried by one message of the message-oriented transports
+func (c *fragmentConn) Write(b []byte) (int, error) {
+	frames, err := c.fragmenter.Fragment(b)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, frame := range frames {
+		if _, err := c.Conn.Write(frame); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/lonng/nano/internal/fragment"
+)
+
+// frameConn records the size of each write
+type frameConn struct {
+	net.Conn
+	sizes chan int
+}
+
+func (c *frameConn) Write(b []byte) (int, error) {
+	c.sizes <- len(b)
+	return c.Conn.Write(b)
+}
+
+func TestFragmentConn(t *testing.T) {
+	n := &Node{Options: Options{MaxFrameSize: fragment.HeadLength + 16}}
+	server, client := net.Pipe()
+	defer client.Close()
+
+	sizes := make(chan int, 64)
+	sc, err := n.fragmented(&frameConn{Conn: server, sizes: sizes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err := n.fragmented(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := bytes.Repeat([]byte("nano"), 25)
+	go func() {
+		sc.Write(payload)
+		sc.Close()
+	}()
+
+	data := make([]byte, len(payload))
+	if _, err := io.ReadFull(cc, data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Fatalf("expect: %q, got: %q", payload, data)
+	}
+	close(sizes)
+	frames := 0
+	for size := range sizes {
+		frames++
+		if size > n.MaxFrameSize {
+			t.Fatalf("expect frames of at most %d bytes, got: %d", n.MaxFrameSize, size)
+		}
+	}
+	if frames != 7 {
+		t.Fatalf("expect: 7 frames, got: %d", frames)
+	}
+}
@@ -25,11 +25,13 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -38,6 +40,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/lonng/nano/cluster/clusterpb"
 	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/encryption"
 	"github.com/lonng/nano/internal/codec"
 	"github.com/lonng/nano/internal/env"
 	"github.com/lonng/nano/internal/log"
@@ -45,17 +48,62 @@ import (
 	"github.com/lonng/nano/internal/packet"
 	"github.com/lonng/nano/metrics"
 	"github.com/lonng/nano/pipeline"
+	"github.com/lonng/nano/ratelimit"
 	"github.com/lonng/nano/scheduler"
 	"github.com/lonng/nano/session"
 )
 
 var (
 	// cached serialized data
-	hrd []byte // handshake response data
-	hbd []byte // heartbeat packet data
+	hrd  []byte                 // handshake response data
+	hbd  []byte                 // heartbeat packet data
+	hsys map[string]interface{} // handshake response sys data
 )
 
-type rpcHandler func(session *session.Session, msg *message.Message, noCopy bool)
+// kick reasons
+const (
+	kickReasonDecryptFailed = "decrypt_failed"
+	kickReasonServerFull    = "server full"
+	kickReasonRateLimited   = "rate_limited"
+	kickReasonDraining      = "server draining"
+	kickReasonClosing       = "server closing"
+	kickReasonSlowClient    = "slow_client"
+	kickReasonTooManyConns  = "too many connections"
+	kickReasonDuplicate     = "duplicate login"
+	kickReasonQueueOverflow = "send_queue_overflow"
+)
+
+// kickCloseReason returns the close reason of the session kicked for the reason
+func kickCloseReason(reason string) session.CloseReason {
+	switch reason {
+	case kickReasonClosing, kickReasonDraining:
+		return session.CloseReasonShutdown
+	case kickReasonRateLimited:
+		return session.CloseReasonRateLimited
+	case kickReasonIdle:
+		return session.CloseReasonIdleTimeout
+	case kickReasonSlowClient:
+		return session.CloseReasonReadTimeout
+	case kickReasonDecryptFailed:
+		return session.CloseReasonProtocolError
+	case kickReasonQueueOverflow:
+		return session.CloseReasonOverflow
+	default:
+		return session.CloseReasonKicked
+	}
+}
+
+// reasons of the messages dropped before reaching the handlers
+const (
+	dropReasonPipeline     = "pipeline"
+	dropReasonDeserialize  = "deserialize"
+	dropReasonBefore       = "before"
+	dropReasonInvalidRoute = "invalid_route"
+	dropReasonNoScheduler  = "no_scheduler"
+	dropReasonRejected     = "rejected"
+)
+
+type rpcHandler func(ctx context.Context, session *session.Session, msg *message.Message, noCopy bool) error
 
 func cache() {
 
@@ -75,36 +123,47 @@ func cache() {
 		}
 	}
 
-	data, err := json.Marshal(map[string]interface{}{
-		"code": 200,
-		"sys":  sysMap,
-	})
+	hsys = sysMap
+	hrd, err = encodeHandshake(sysMap)
 	if err != nil {
 		panic(err)
 	}
 
-	hrd, err = codec.Encode(packet.Handshake, data)
+	hbd, err = codec.Encode(packet.Heartbeat, nil)
 	if err != nil {
 		panic(err)
 	}
+}
 
-	hbd, err = codec.Encode(packet.Heartbeat, nil)
+func encodeHandshake(sys map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"code": 200,
+		"sys":  sys,
+	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return codec.Encode(packet.Handshake, data)
 }
 
 type LocalHandler struct {
 	localServices        map[string]*component.Service // all registered service
 	localHandlers        map[string]*component.Handler // all handler method
 	localHandlersArgName map[string]*component.Handler // all handler method 参数名称映射
+	inflight             map[string]*int64             // in-flight invocations of each service
 
 	mu             sync.RWMutex
 	remoteServices map[string][]*clusterpb.MemberInfo
+	rings          map[string]*hashRing // consistent hash rings of remote services
+	serviceTypes   map[string]string    // server types of remote services, kept after members are gone
 
 	pipeline    pipeline.Pipeline
+	transport   pipeline.Pipeline // transport level stages which are applied in agent
 	currentNode *Node
 	rateLimiter *env.RateLimiter
+	routeLimit  ratelimit.Limiter // per session and route limiter
+	affinity    *SessionAffinityRouter
+	workers     *workerPool // dispatches the handlers if the worker pool model is used
 }
 
 func NewHandler(currentNode *Node, pipeline pipeline.Pipeline) *LocalHandler {
@@ -112,15 +171,46 @@ func NewHandler(currentNode *Node, pipeline pipeline.Pipeline) *LocalHandler {
 		localServices:        make(map[string]*component.Service),
 		localHandlers:        make(map[string]*component.Handler),
 		localHandlersArgName: make(map[string]*component.Handler),
+		inflight:             make(map[string]*int64),
 		remoteServices:       map[string][]*clusterpb.MemberInfo{},
+		rings:                map[string]*hashRing{},
+		serviceTypes:         map[string]string{},
 		pipeline:             pipeline,
 		currentNode:          currentNode,
 		rateLimiter:          env.NewRateLimiter(currentNode.RateLimit),
 	}
 
+	if currentNode.KeyExchange != nil {
+		h.transport = newTransport()
+	}
+
+	if currentNode.WorkerPoolSize > 0 {
+		h.workers = newWorkerPool(currentNode)
+	}
+
+	if currentNode.SessionAffinity {
+		h.affinity = NewSessionAffinityRouter(currentNode.MetricsReporters...)
+	}
+
+	if len(currentNode.RateLimitRules) > 0 {
+		h.routeLimit = currentNode.RateLimiter
+		if h.routeLimit == nil {
+			h.routeLimit = ratelimit.NewSlidingWindow()
+		}
+	}
+
 	return h
 }
 
+// newTransport returns the transport pipeline which encrypts and decrypts
+// the message payload of sessions which negotiated the encryption
+func newTransport() pipeline.Pipeline {
+	t := pipeline.New()
+	t.Inbound().PushBack(encryption.Inbound)
+	t.Outbound().PushBack(encryption.Outbound)
+	return t
+}
+
 func (h *LocalHandler) register(comp component.Component, opts []component.Option) error {
 	s := component.NewService(comp, opts)
 
@@ -134,6 +224,7 @@ func (h *LocalHandler) register(comp component.Component, opts []component.Optio
 
 	// register all localHandlers
 	h.localServices[s.Name] = s
+	h.inflight[s.Name] = new(int64)
 	doubleNames := make([]string, 0)
 	for name, handler := range s.Handlers {
 		n := fmt.Sprintf("%s.%s", s.Name, name)
@@ -170,16 +261,21 @@ func (h *LocalHandler) addRemoteService(member *clusterpb.MemberInfo) {
 	for _, s := range member.Services {
 		log.Println("Register remote service", s)
 		h.remoteServices[s] = append(h.remoteServices[s], member)
+		h.serviceTypes[s] = memberType(member.Label)
+		delete(h.rings, s)
 	}
+	h.reportMemberUp(member, true)
 }
 
 func (h *LocalHandler) delMember(addr string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	var removed *clusterpb.MemberInfo
 	for name, members := range h.remoteServices {
 		for i, maddr := range members {
 			if addr == maddr.ServiceAddr {
+				removed = maddr
 				if i == len(members)-1 {
 					members = members[:i]
 				} else {
@@ -192,6 +288,10 @@ func (h *LocalHandler) delMember(addr string) {
 		} else {
 			h.remoteServices[name] = members
 		}
+		delete(h.rings, name)
+	}
+	if removed != nil {
+		h.reportMemberUp(removed, false)
 	}
 }
 
@@ -216,13 +316,65 @@ func (h *LocalHandler) RemoteService() []string {
 	return result
 }
 
-func (h *LocalHandler) handle(conn net.Conn) {
+func (h *LocalHandler) handle(conn net.Conn, transport string) {
+	h.handleProtocol(conn, transport, 0)
+}
+
+// handleProtocol handles the connection whose protocol version has been negotiated
+// by the transport, the version is negotiated in handshake if it is zero
+func (h *LocalHandler) handleProtocol(conn net.Conn, transport string, version int) {
+	defer FlushOnPanic(h.currentNode)
+	if atomic.LoadInt32(&h.currentNode.draining) == 1 {
+		h.reject(conn, kickReasonDraining, "draining")
+		return
+	}
+	if !h.currentNode.acquireSession(transport) {
+		h.reject(conn, kickReasonServerFull, "capacity")
+		return
+	}
+	// the slot will be released once the read goroutine exits, which covers
+	// all close paths, e.g: client closed, heartbeat timeout and server kicked
+	defer h.currentNode.releaseSession(transport)
+
+	ip, ok := h.currentNode.acquireIPConn(conn.RemoteAddr())
+	if !ok {
+		h.reject(conn, kickReasonTooManyConns, "per_ip")
+		return
+	}
+	defer h.currentNode.releaseIPConn(ip)
+
+	conn = newMeteredConn(conn, transport, h.currentNode.MetricsReporters)
+	conn = newDeadlineConn(conn, h.currentNode.WriteTimeout)
+
 	// create a client agent and startup write gorontine
-	agent := newAgent(conn, h.pipeline, h.remoteProcess)
+	agent := newAgent(conn, h.pipeline, h.transport, h.remoteCall)
+	if size := h.currentNode.SendQueueSize; size > 0 {
+		agent.chSend = newSendQueue(size)
+	}
+	agent.chSend.policy = h.currentNode.SendQueuePolicy
+	agent.chSend.overflow = agent.overflow
+	agent.writeSize = h.currentNode.WriteBufferSize
+	agent.reaped = h.currentNode.IdleTimeout > 0
+	agent.fallback = h.currentNode.pushFallback
+	agent.migrate = func(addr string, withAttributes bool) error {
+		return h.migrateAffinity(agent.session, addr, withAttributes)
+	}
+	agent.reporters = h.currentNode.MetricsReporters
+	agent.acks = newAckTable(h.currentNode.ReliableRetries, h.currentNode.ReliableBackoff, h.currentNode.MetricsReporters)
+	if h.currentNode.ResumeTTL > 0 {
+		agent.suspend = func(reason session.CloseReason) *suspendedSession { return h.currentNode.suspendSession(agent, reason) }
+	}
+	if version > 0 {
+		agent.protocol = int32(version)
+	}
 	h.currentNode.storeSession(agent.session)
+	session.Lifetime.Publish(session.Event{Type: session.EventConnected, Session: agent.session})
 
 	// startup write goroutine
-	go agent.write()
+	go func() {
+		defer FlushOnPanic(h.currentNode)
+		agent.write()
+	}()
 
 	if env.Debug {
 		log.Println(fmt.Sprintf("New session established: %s", agent.String()))
@@ -230,35 +382,11 @@ func (h *LocalHandler) handle(conn net.Conn) {
 
 	// guarantee agent related resource be destroyed
 	defer func() {
-		if !h.currentNode.IsMaster && h.currentNode.AdvertiseAddr == "" {
-			req := &clusterpb.CloseSessionRequest{
-				SessionId: agent.session.ID(),
-			}
-			h.currentNode.CloseSession(context.Background(), req)
-		} else {
-			request := &clusterpb.SessionClosedRequest{
-				SessionId: agent.session.ID(),
-			}
-
-			members := h.currentNode.cluster.remoteAddrs()
-			for _, remote := range members {
-				log.Println("Notify remote server success", remote)
-				pool, err := h.currentNode.rpcClient.getConnPool(remote)
-				if err != nil {
-					log.Println("Cannot retrieve connection pool for address", remote, err)
-					continue
-				}
-				client := clusterpb.NewMemberClient(pool.Get())
-				_, err = client.SessionClosed(context.Background(), request)
-				if err != nil {
-					log.Println("Cannot closed session in remote address", remote, err)
-					continue
-				}
-				if env.Debug {
-					log.Println("Notify remote server success", remote)
-				}
-			}
-			agent.Close()
+		agent.closeWith(session.CloseReasonDisconnected)
+		<-agent.chDie
+		// the suspended session is cleaned up once it expires
+		if agent.suspension() == nil {
+			h.sessionClosed(agent)
 		}
 		if env.Debug {
 			log.Println(fmt.Sprintf("Session read goroutine exit, SessionID=%d, UID=%d", agent.session.ID(), agent.session.UID()))
@@ -266,11 +394,45 @@ func (h *LocalHandler) handle(conn net.Conn) {
 	}()
 
 	// read loop
-	buf := make([]byte, 2048)
+	size := h.currentNode.ReadBufferSize
+	if size <= 0 {
+		size = DefaultReadBufferSize
+	}
+	buf := make([]byte, size)
+	var partial time.Time // the time when the incomplete packet started
+	readTimeout := h.currentNode.ReadTimeout
 	for {
+		// the read deadline is extended for each read, unless the incomplete
+		// packet should be completed earlier
+		if readTimeout > 0 {
+			deadline := time.Now().Add(readTimeout)
+			if !partial.IsZero() && partial.Add(h.currentNode.SlowClientTimeout).Before(deadline) {
+				deadline = partial.Add(h.currentNode.SlowClientTimeout)
+			}
+			conn.SetReadDeadline(deadline)
+		}
 		n, err := conn.Read(buf)
 		if err != nil {
+			ne, ok := err.(net.Error)
+			timeout := ok && ne.Timeout()
+			if timeout && !partial.IsZero() && time.Since(partial) >= h.currentNode.SlowClientTimeout {
+				log.Println(fmt.Sprintf("Packet incomplete in %v, SessionID=%d, Remote=%s",
+					h.currentNode.SlowClientTimeout, agent.session.ID(), conn.RemoteAddr()))
+				metrics.ReportSessionKicked(h.currentNode.MetricsReporters, kickReasonSlowClient)
+				agent.kick(kickReasonSlowClient)
+				return
+			}
+			if timeout && readTimeout > 0 {
+				log.Println(fmt.Sprintf("Read timeout in %v, SessionID=%d, Remote=%s", readTimeout, agent.session.ID(), conn.RemoteAddr()))
+				agent.setCloseReason(session.CloseReasonReadTimeout)
+				return
+			}
 			log.Println(fmt.Sprintf("Read message error: %s, session will be closed immediately", err.Error()))
+			if closedByClient(err) {
+				agent.setCloseReason(session.CloseReasonDisconnected)
+			} else {
+				agent.setCloseReason(session.CloseReasonReadError)
+			}
 			return
 		}
 
@@ -278,20 +440,41 @@ func (h *LocalHandler) handle(conn net.Conn) {
 		packets, err := agent.decoder.Decode(buf[:n])
 		if err != nil {
 			log.Println(err.Error())
+			agent.setCloseReason(session.CloseReasonProtocolError)
 			return
 		}
 
+		// the client should complete a packet in SlowClientTimeout once it has
+		// started, idle clients without incomplete packet are not limited
+		if timeout := h.currentNode.SlowClientTimeout; timeout > 0 {
+			switch {
+			case agent.decoder.Buffered() == 0:
+				if !partial.IsZero() {
+					partial = time.Time{}
+					if readTimeout <= 0 {
+						conn.SetReadDeadline(time.Time{})
+					}
+				}
+			case partial.IsZero() || len(packets) > 0:
+				partial = time.Now()
+				if readTimeout <= 0 {
+					conn.SetReadDeadline(partial.Add(timeout))
+				}
+			}
+		}
+
 		if len(packets) < 1 {
 			continue
 		}
 
-		now := time.Now()
+		now := env.Clock.Now()
 		// process all packet
 		for i := range packets {
 			if h.rateLimiter != nil {
 				if h.rateLimiter.ShouldRateLimit(now) {
 					metrics.ReportExceededRateLimiting(h.currentNode.MetricsReporters)
 					log.Println("Receive packets exceed rate limit!")
+					agent.setCloseReason(session.CloseReasonRateLimited)
 					return
 				}
 			}
@@ -300,13 +483,13 @@ func (h *LocalHandler) handle(conn net.Conn) {
 			if env.IncreaseCheck && p.Type != packet.Heartbeat {
 				if p.Length < 4 {
 					log.Error("packet wrong increase len, disconnect!")
-					agent.Close()
+					agent.closeWith(session.CloseReasonProtocolError)
 					return
 				}
 				increase := binary.BigEndian.Uint32(p.Data)
 				if agent.increase != 0 && (agent.increase+1) != increase {
 					log.Error("packet wrong increase, disconnect!")
-					agent.Close()
+					agent.closeWith(session.CloseReasonProtocolError)
 					return
 				}
 				agent.increase = increase
@@ -316,16 +499,64 @@ func (h *LocalHandler) handle(conn net.Conn) {
 
 			if err := h.processPacket(agent, p); err != nil {
 				log.Println(err.Error())
+				agent.setCloseReason(session.CloseReasonProtocolError)
 				return
 			}
 		}
 	}
 }
 
+// closedByClient reports whether the read error means the client closed the
+// connection gracefully, rather than the connection is broken
+func closedByClient(err error) bool {
+	if err == io.EOF {
+		return true
+	}
+	return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway)
+}
+
+// sessionClosed releases the resources of the closed session, and notifies the
+// other members of the cluster
+func (h *LocalHandler) sessionClosed(agent *agent) {
+	if h.currentNode.standalone() {
+		req := &clusterpb.CloseSessionRequest{
+			SessionId: agent.session.ID(),
+		}
+		h.currentNode.CloseSession(context.Background(), req)
+	} else {
+		request := &clusterpb.SessionClosedRequest{
+			SessionId: agent.session.ID(),
+			Reason:    string(agent.closeReason),
+		}
+
+		members := h.currentNode.cluster.remoteAddrs()
+		for _, remote := range members {
+			log.Println("Notify remote server success", remote)
+			client, err := h.currentNode.rpcClient.memberClient(remote)
+			if err != nil {
+				log.Println("Cannot retrieve connection pool for address", remote, err)
+				continue
+			}
+			_, err = client.SessionClosed(context.Background(), request)
+			if err != nil {
+				log.Println("Cannot closed session in remote address", remote, err)
+				continue
+			}
+			if env.Debug {
+				log.Println("Notify remote server success", remote)
+			}
+		}
+	}
+}
+
 func (h *LocalHandler) processPacket(agent *agent, p *packet.Packet) error {
 	switch p.Type {
 	case packet.Handshake:
-		if _, err := agent.conn.Write(hrd); err != nil {
+		data, err := h.handshake(agent, p.Data)
+		if err != nil {
+			return err
+		}
+		if _, err := agent.conn.Write(data); err != nil {
 			return err
 		}
 
@@ -339,6 +570,11 @@ func (h *LocalHandler) processPacket(agent *agent, p *packet.Packet) error {
 		if env.Debug {
 			log.Println(fmt.Sprintf("Receive handshake ACK Id=%d, Remote=%s", agent.session.ID(), agent.conn.RemoteAddr()))
 		}
+		session.Lifetime.Publish(session.Event{Type: session.EventHandshake, Session: agent.session})
+		if ss := agent.resumed; ss != nil {
+			agent.resumed = nil
+			ss.replay(agent)
+		}
 
 	case packet.Data:
 		if agent.status() < statusWorking {
@@ -346,55 +582,270 @@ func (h *LocalHandler) processPacket(agent *agent, p *packet.Packet) error {
 				agent.conn.RemoteAddr().String())
 		}
 
-		msg, err := message.Decode(p.Data)
+		msg, err := agent.messageCodec().Decode(p.Data)
 		if err != nil {
 			return err
 		}
-		h.processMessage(agent, msg)
+		if t := agent.transport; t != nil {
+			if err := t.Inbound().Process(agent.session, msg); err != nil {
+				metrics.ReportSessionKicked(h.currentNode.MetricsReporters, kickReasonDecryptFailed)
+				agent.kick(kickReasonDecryptFailed)
+				return fmt.Errorf("decrypt message failed: %v, session will be closed immediately, remote=%s",
+					err, agent.conn.RemoteAddr().String())
+			}
+		}
+		if allowed, err := h.allowRoute(agent, msg.Route); err != nil {
+			return err
+		} else if allowed {
+			h.processMessage(agent, msg)
+		}
 
 	case packet.Heartbeat:
 		// expected
 	}
 
-	atomic.StoreInt64(&agent.lastAt, time.Now().Unix())
+	atomic.StoreInt64(&agent.lastAt, env.Clock.Now().Unix())
 	return nil
 }
 
+// allowRoute applies the rate limit rule of the route to the session, the
+// returned error indicates the session should be closed.
+func (h *LocalHandler) allowRoute(agent *agent, route string) (bool, error) {
+	if h.routeLimit == nil {
+		return true, nil
+	}
+	rule, ok := h.currentNode.RateLimitRules.Match(route)
+	if !ok {
+		return true, nil
+	}
+
+	wait, err := h.routeLimit.Take(agent.session, route, rule)
+	if err != nil {
+		log.Println(fmt.Sprintf("Rate limiter error: %v, route=%s", err, route))
+		return true, nil
+	}
+	if wait == 0 {
+		return true, nil
+	}
+
+	metrics.ReportExceededRateLimiting(h.currentNode.MetricsReporters)
+	switch rule.Policy {
+	case ratelimit.PolicyDelay:
+		// stop reading the connection until the window has room, the request
+		// will be dropped if it is still limited after waiting
+		elapsed := make(chan struct{})
+		timer := env.Clock.AfterFunc(wait, func() { close(elapsed) })
+		select {
+		case <-elapsed:
+		case <-agent.chDie:
+			timer.Stop()
+			return false, nil
+		}
+		if wait, err = h.routeLimit.Take(agent.session, route, rule); err == nil && wait == 0 {
+			return true, nil
+		}
+	case ratelimit.PolicyDisconnect:
+		metrics.ReportSessionKicked(h.currentNode.MetricsReporters, kickReasonRateLimited)
+		agent.kick(kickReasonRateLimited)
+		return false, fmt.Errorf("%v, session will be closed immediately, route=%s, remote=%s",
+			ratelimit.ErrRateLimited, route, agent.conn.RemoteAddr().String())
+	}
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("Request dropped by rate limit, SessionID=%d, route=%s", agent.session.ID(), route))
+	}
+	return false, nil
+}
+
+// reject refuses the connection with a kick reason before any session is created
+func (h *LocalHandler) reject(conn net.Conn, reason, label string) {
+	defer conn.Close()
+
+	metrics.ReportConnectionRejected(h.currentNode.MetricsReporters, label)
+	log.Println(fmt.Sprintf("Connection rejected: %s, remote=%s", reason, conn.RemoteAddr().String()))
+
+	p, err := encodeKick(kickMessage{Reason: reason})
+	if err != nil {
+		return
+	}
+	conn.Write(p)
+}
+
+// handshake handles the handshake request, and returns the handshake response
+// which should be sent to the client.
+func (h *LocalHandler) handshake(agent *agent, data []byte) ([]byte, error) {
+	req := struct {
+		Sys struct {
+			Crypto *struct {
+				Key []byte `json:"key"`
+			} `json:"crypto"`
+			Resume   string `json:"resume"`
+			Protocol int    `json:"protocol"`
+		} `json:"sys"`
+	}{}
+	if len(data) == 0 || json.Unmarshal(data, &req) != nil {
+		return hrd, nil
+	}
+
+	// the system data negotiated with the client, the cached response is used
+	// for the clients which negotiate nothing
+	negotiated := map[string]interface{}{}
+
+	// resume the session migrated from another node, or the session suspended
+	// after the connection was broken
+	if token := req.Sys.Resume; token != "" {
+		switch {
+		case h.currentNode.resumeSession(agent.session, token):
+		case h.currentNode.resumeSuspended(agent, token):
+			negotiated["resumed"] = true
+		default:
+			log.Println(fmt.Sprintf("Resume session failed: invalid or expired token, remote=%s",
+				agent.conn.RemoteAddr().String()))
+		}
+	}
+	if h.currentNode.ResumeTTL > 0 {
+		token, err := h.currentNode.issueResumeToken(agent)
+		if err != nil {
+			return nil, err
+		}
+		negotiated["resume"] = token
+	}
+	if v := req.Sys.Protocol; v > 0 {
+		version := message.Negotiate(v)
+		atomic.StoreInt32(&agent.protocol, int32(version))
+		negotiated["protocol"] = version
+	}
+	if h.currentNode.KeyExchange != nil && req.Sys.Crypto != nil {
+		public, err := h.handshakeCrypto(agent, req.Sys.Crypto.Key)
+		if err != nil {
+			return nil, err
+		}
+		negotiated["crypto"] = map[string]interface{}{"key": public}
+	}
+	if len(negotiated) == 0 {
+		return hrd, nil
+	}
+
+	sys := make(map[string]interface{}, len(hsys)+len(negotiated))
+	for k, v := range hsys {
+		sys[k] = v
+	}
+	for k, v := range negotiated {
+		sys[k] = v
+	}
+	return encodeHandshake(sys)
+}
+
+// handshakeCrypto negotiates the payload encryption with the client, and
+// returns the public parameters of current node.
+func (h *LocalHandler) handshakeCrypto(agent *agent, key []byte) ([]byte, error) {
+	public, secret, err := h.currentNode.KeyExchange.Exchange(key)
+	if err != nil {
+		return nil, err
+	}
+	c, err := encryption.NewServerCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	encryption.Attach(agent.session, c)
+	return public, nil
+}
+
 func (h *LocalHandler) findMembers(service string) []*clusterpb.MemberInfo {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	return h.remoteServices[service]
 }
 
+// hashRing returns the consistent hash ring of the service, which is rebuilt
+// after the members of service changed
+func (h *LocalHandler) hashRing(service string) *hashRing {
+	h.mu.RLock()
+	ring, found := h.rings[service]
+	h.mu.RUnlock()
+	if found {
+		return ring
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ring, found := h.rings[service]; found {
+		return ring
+	}
+	ring = newHashRing(h.remoteServices[service], h.currentNode.HashReplicas)
+	h.rings[service] = ring
+	return ring
+}
+
+// ringShares returns the fraction of keys routed to each member of the remote
+// services
+func (h *LocalHandler) ringShares() map[string]map[string]float64 {
+	h.mu.RLock()
+	services := make([]string, 0, len(h.remoteServices))
+	for service := range h.remoteServices {
+		services = append(services, service)
+	}
+	h.mu.RUnlock()
+
+	result := map[string]map[string]float64{}
+	for _, service := range services {
+		result[service] = h.hashRing(service).shares()
+	}
+	return result
+}
+
 func (h *LocalHandler) remoteProcess(session *session.Session, msg *message.Message, noCopy bool) {
+	if err := h.remoteCall(context.Background(), session, msg, noCopy); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// remoteCall forwards the message to a remote member which serves the route, and
+// returns once the message is accepted by the member or ctx is done
+func (h *LocalHandler) remoteCall(ctx context.Context, session *session.Session, msg *message.Message, noCopy bool) error {
 	index := strings.LastIndex(msg.Route, ".")
 	if index < 0 {
-		log.Println(fmt.Sprintf("nano/handler: invalid route %s", msg.Route))
-		return
+		return fmt.Errorf("nano/handler: invalid route %s", msg.Route)
 	}
 
 	service := msg.Route[:index]
 	members := h.findMembers(service)
 	if len(members) == 0 {
-		log.Println(fmt.Sprintf("nano/handler: %s not found(forgot registered?)", msg.Route))
-		return
+		h.reportRoutingFailure(service)
+		return fmt.Errorf("nano/handler: %s not found(forgot registered?)", msg.Route)
 	}
 
 	// Select a remote service address
-	// 1. Use the service address directly if the router contains binding item
-	// 2. Select a remote service address randomly and bind to router
+	// 1. Select a remote service address by the session affinity router if enabled,
+	//    which re-binds the session when members change
+	// 2. Use the service address directly if the router contains binding item
+	// 3. Select a remote service address by the uid or session id on the consistent
+	//    hash ring if enabled, the address is not bound so that the session follows
+	//    the ring when members change
+	// 4. Select a remote service address randomly and bind to router
 	var remoteAddr string
-	if addr, found := session.Router().Find(service); found {
+	if h.affinity != nil {
+		remoteAddr = h.affinity.Route(session, service, members)
+	} else if addr, found := session.Router().Find(service); found {
 		remoteAddr = addr
+	} else if h.currentNode.ConsistentHash {
+		key := session.UID()
+		if key == 0 {
+			key = session.ID()
+		}
+		remoteAddr = h.hashRing(service).get(strconv.FormatInt(key, 10))
 	} else {
 		remoteAddr = members[rand.Intn(len(members))].ServiceAddr
 		session.Router().Bind(service, remoteAddr)
 	}
-	pool, err := h.currentNode.rpcClient.getConnPool(remoteAddr)
+	client, err := h.currentNode.rpcClient.memberClient(remoteAddr)
 	if err != nil {
-		log.Println(err)
-		return
+		return err
 	}
+
+	h.currentNode.beginHandler()
+	defer h.currentNode.endHandler()
+
 	var data = msg.Data
 	if !noCopy && len(msg.Data) > 0 {
 		data = make([]byte, len(msg.Data))
@@ -410,7 +861,11 @@ func (h *LocalHandler) remoteProcess(session *session.Session, msg *message.Mess
 		sessionId = v.sid
 	}
 
-	client := clusterpb.NewMemberClient(pool.Get())
+	var begin time.Time
+	if h.currentNode.RequestLogger != nil {
+		begin = env.Clock.Now()
+	}
+
 	switch msg.Type {
 	case message.Request:
 		request := &clusterpb.RequestMessage{
@@ -420,7 +875,7 @@ func (h *LocalHandler) remoteProcess(session *session.Session, msg *message.Mess
 			Route:     msg.Route,
 			Data:      data,
 		}
-		_, err = client.HandleRequest(context.Background(), request)
+		_, err = client.HandleRequest(ctx, request)
 	case message.Notify:
 		request := &clusterpb.NotifyMessage{
 			GateAddr:  gateAddr,
@@ -428,11 +883,15 @@ func (h *LocalHandler) remoteProcess(session *session.Session, msg *message.Mess
 			Route:     msg.Route,
 			Data:      data,
 		}
-		_, err = client.HandleNotify(context.Background(), request)
+		_, err = client.HandleNotify(ctx, request)
+	}
+	if h.currentNode.RequestLogger != nil {
+		h.logRequest(session, msg.Route, PathRemote, begin, data, 0, err)
 	}
 	if err != nil {
-		log.Println(fmt.Sprintf("Process remote message (%d:%s) error: %+v", msg.ID, msg.Route, err))
+		return fmt.Errorf("Process remote message (%d:%s) error: %+v", msg.ID, msg.Route, err)
 	}
+	return nil
 }
 
 func (h *LocalHandler) processMessage(agent *agent, msg *message.Message) {
@@ -448,6 +907,20 @@ func (h *LocalHandler) processMessage(agent *agent, msg *message.Message) {
 		log.Println("Invalid message type: " + msg.Type.String())
 		return
 	}
+	if reporters := h.currentNode.MetricsReporters; len(reporters) > 0 {
+		metrics.ReportMessageBytes(reporters, msg.Route, metrics.DirectionIn, len(msg.Data))
+		if msg.Type == message.Request {
+			agent.routes.store(msg.ID, msg.Route)
+		}
+	}
+	if msg.Type == message.Notify && msg.Route == session.StreamCancelRoute {
+		h.cancelStream(agent, msg.Data)
+		return
+	}
+	if msg.Type == message.Notify && msg.Route == session.AckRoute {
+		h.ack(agent, msg.Data)
+		return
+	}
 	if env.ProtoRoute {
 		handler, found := h.localHandlersArgName[msg.Route]
 		if !found {
@@ -465,13 +938,38 @@ func (h *LocalHandler) processMessage(agent *agent, msg *message.Message) {
 	}
 }
 
-func (h *LocalHandler) handleWS(conn *websocket.Conn) {
+// cancelStream closes the stream unsubscribed by the client, only the streams
+// opened by the handlers of current node can be cancelled by the client, the
+// streams of remote nodes are closed when the session is closed.
+func (h *LocalHandler) cancelStream(agent *agent, data []byte) {
+	req := struct {
+		Mid uint64 `json:"mid"`
+	}{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Println(fmt.Sprintf("Invalid stream cancel request: %v", err))
+		return
+	}
+	if !agent.session.CloseStream(req.Mid) && env.Debug {
+		log.Println(fmt.Sprintf("Stream not found, SessionID=%d, mid=%d", agent.session.ID(), req.Mid))
+	}
+}
+
+// handleWS handles the WebSocket connection, whose protocol version is negotiated
+// by subprotocol if version is positive
+func (h *LocalHandler) handleWS(conn *websocket.Conn, version int) {
 	c, err := newWSConn(conn)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	go h.handle(c)
+	c.compress(h.currentNode.WSCompression)
+	fc, err := h.currentNode.fragmented(c)
+	if err != nil {
+		log.Println(err)
+		c.Close()
+		return
+	}
+	go h.handleProtocol(fc, transportWS, version)
 }
 
 func (h *LocalHandler) localProcess(handler *component.Handler, lastMid uint64, session *session.Session, msg *message.Message) {
@@ -480,6 +978,7 @@ func (h *LocalHandler) localProcess(handler *component.Handler, lastMid uint64,
 		err := pipe.Inbound().Process(session, msg)
 		if err != nil {
 			log.Println("Pipeline process failed: " + err.Error())
+			metrics.ReportDroppedMessage(h.currentNode.MetricsReporters, msg.Route, dropReasonPipeline)
 			return
 		}
 	}
@@ -493,6 +992,7 @@ func (h *LocalHandler) localProcess(handler *component.Handler, lastMid uint64,
 		err := env.Serializer.Unmarshal(payload, data)
 		if err != nil {
 			log.Println(fmt.Sprintf("Deserialize to %T failed: %+v (%v)", data, err, payload))
+			metrics.ReportDroppedMessage(h.currentNode.MetricsReporters, msg.Route, dropReasonDeserialize)
 			return
 		}
 	}
@@ -501,6 +1001,19 @@ func (h *LocalHandler) localProcess(handler *component.Handler, lastMid uint64,
 		log.Println(fmt.Sprintf("UID=%d, Message={%s}, Data=%+v", session.UID(), msg.String(), data))
 	}
 
+	// the payload may be reused once the handler returns, so it is copied for
+	// the shadow handler which is invoked asynchronously
+	var shadowPayload []byte
+	if handler.Shadow != nil {
+		shadowPayload = append([]byte(nil), payload...)
+	}
+
+	// the cache key is computed before the payload can be reused
+	var cacheKey string
+	if handler.Cache != nil && lastMid > 0 {
+		cacheKey = handler.Cache.Key(msg.Route, session, payload)
+	}
+
 	session.Set("route", msg.Route)
 	args := []reflect.Value{handler.Receiver, reflect.ValueOf(session), reflect.ValueOf(data)}
 
@@ -525,14 +1038,80 @@ func (h *LocalHandler) localProcess(handler *component.Handler, lastMid uint64,
 			if env.Debug {
 				log.Println(fmt.Sprintf("--%s FuncBefore exit ", handler.Method.Func.String()))
 			}
+			metrics.ReportDroppedMessage(h.currentNode.MetricsReporters, route, dropReasonBefore)
 			return
 		}
 
+		var begin time.Time
+		var out int64
+		if h.currentNode.RequestLogger != nil {
+			begin = env.Clock.Now()
+			out = bytesOut(session)
+		}
+
+		if cacheKey != "" {
+			cached, hit := handler.Cache.Get(cacheKey)
+			metrics.ReportResponseCache(h.currentNode.MetricsReporters, route, hit)
+			if hit {
+				metrics.ReportProcessedMessage(h.currentNode.MetricsReporters, route)
+				if err := session.ResponseMID(lastMid, cached); err != nil {
+					log.Println(fmt.Sprintf("Response %s from cache failed: %+v", route, err))
+				}
+				return
+			}
+		}
+
+		// the shadow handler starts from the same session state as the handler
+		var shadow *shadowCall
+		if handler.Shadow != nil {
+			shadow = newShadowCall(session, lastMid)
+			defer shadow.done()
+		}
+
+		// the response is recorded to populate the cache, the shadow call has
+		// recorded it already if the handler is shadowed
+		var cacheTap *responseTap
+		if cacheKey != "" && shadow == nil {
+			if t, ok := session.NetworkEntity().(tapper); ok {
+				cacheTap = t.tap(lastMid)
+				defer t.untap(lastMid)
+			}
+		}
+
 		result := handler.Method.Func.Call(args)
 		metrics.ReportTiming(os, h.currentNode.MetricsReporters, route)
+		metrics.ReportProcessedMessage(h.currentNode.MetricsReporters, route)
+		var response []byte
+		if cacheTap != nil {
+			response = cacheTap.get()
+		}
+		if shadow != nil {
+			shadow.done()
+			response = shadow.primary
+			h.currentNode.beginHandler()
+			go func() {
+				defer h.currentNode.endHandler()
+				h.shadow(handler.Shadow, shadow, route, shadowPayload)
+			}()
+		}
+		if cacheKey != "" && response != nil && (len(result) == 0 || result[0].IsNil()) {
+			handler.Cache.Put(cacheKey, response)
+		}
+		if h.currentNode.RequestLogger != nil {
+			var err error
+			if len(result) > 0 {
+				err, _ = result[0].Interface().(error)
+			}
+			h.logRequest(session, route, PathLocal, begin, payload, bytesOut(session)-out, err)
+		}
 		if len(result) > 0 {
 			if err := result[0].Interface(); err != nil {
 				log.Println(fmt.Sprintf("Service %s error: %+v", msg.Route, err))
+				code := 0
+				if c, ok := err.(coder); ok {
+					code = c.Code()
+				}
+				metrics.ReportHandlerError(h.currentNode.MetricsReporters, route, code)
 			}
 		}
 		//后置处理
@@ -553,17 +1132,20 @@ func (h *LocalHandler) localProcess(handler *component.Handler, lastMid uint64,
 		index := strings.LastIndex(msg.Route, ".")
 		if index < 0 {
 			log.Println(fmt.Sprintf("nano/handler: invalid route %s", msg.Route))
+			metrics.ReportDroppedMessage(h.currentNode.MetricsReporters, msg.Route, dropReasonInvalidRoute)
 			return
 		}
-		// A message can be dispatch to global thread or a user customized thread
+		// A message can be dispatch to global thread, the worker pool or a user customized thread
 		service := msg.Route[:index]
 		serCase = h.localServices[service]
 	}
 
+	var schedule func(scheduler.Task)
 	if serCase.SchedName != "" {
 		sched := session.Value(serCase.SchedName)
 		if sched == nil {
 			log.Println(fmt.Sprintf("nanl/handler: cannot found `schedular.LocalScheduler` by %s", serCase.SchedName))
+			metrics.ReportDroppedMessage(h.currentNode.MetricsReporters, msg.Route, dropReasonNoScheduler)
 			return
 		}
 
@@ -571,10 +1153,21 @@ func (h *LocalHandler) localProcess(handler *component.Handler, lastMid uint64,
 		if !ok {
 			log.Println(fmt.Sprintf("nanl/handler: Type %T does not implement the `schedular.LocalScheduler` interface",
 				sched))
+			metrics.ReportDroppedMessage(h.currentNode.MetricsReporters, msg.Route, dropReasonNoScheduler)
 			return
 		}
-		local.Schedule(task)
+		schedule = local.Schedule
+	} else if h.workers != nil {
+		schedule = func(task scheduler.Task) { h.workers.schedule(session.ID(), task) }
 	} else {
-		scheduler.PushTask(task)
+		schedule = scheduler.PushTask
+	}
+
+	run, err := h.admitService(serCase, msg.Route, task)
+	if err != nil {
+		log.Println(fmt.Sprintf("Service %s rejected: %v", msg.Route, err))
+		metrics.ReportDroppedMessage(h.currentNode.MetricsReporters, msg.Route, dropReasonRejected)
+		return
 	}
+	schedule(run)
 }
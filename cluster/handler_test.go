@@ -0,0 +1,276 @@
+package cluster
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/clock/clocktest"
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/ratelimit"
+	"github.com/lonng/nano/session"
+)
+
+func TestNode_AcquireSession(t *testing.T) {
+	n := &Node{Options: Options{MaxSessions: 2}}
+	if !n.acquireSession(transportTCP) || !n.acquireSession(transportTCP) {
+		t.Fatal("expect sessions to be acquired under the limit")
+	}
+	if n.acquireSession(transportTCP) {
+		t.Fatal("expect session to be rejected at capacity")
+	}
+	n.releaseSession(transportTCP)
+	if !n.acquireSession(transportKCP) {
+		t.Fatal("expect session to be acquired after release")
+	}
+	if c := *n.connectedClients(transportTCP); c != 1 {
+		t.Fatalf("expect: 1 tcp client, got: %d", c)
+	}
+	if c := *n.connectedClients(transportKCP); c != 1 {
+		t.Fatalf("expect: 1 kcp client, got: %d", c)
+	}
+}
+
+func TestHandler_RejectAtCapacity(t *testing.T) {
+	n := &Node{Options: Options{MaxSessions: 1}, activeSessions: 1}
+	h := &LocalHandler{currentNode: n}
+
+	server, client := net.Pipe()
+	go h.handle(server, transportTCP)
+
+	buf := make([]byte, 1024)
+	l, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, err := codec.NewDecoder().Decode(buf[:l])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 1 || packets[0].Type != packet.Kick {
+		t.Fatalf("expect a kick packet, got: %v", packets)
+	}
+	if n.activeSessions != 1 {
+		t.Fatalf("expect: 1, got: %d", n.activeSessions)
+	}
+}
+
+type kickReporter struct {
+	mu      sync.Mutex
+	reasons []string
+}
+
+func (r *kickReporter) ReportCount(metric string, tags map[string]string, count float64) error {
+	if metric == metrics.SessionKicked {
+		r.mu.Lock()
+		r.reasons = append(r.reasons, tags["reason"])
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+func (r *kickReporter) ReportSummary(metric string, tags map[string]string, value float64) error {
+	return nil
+}
+
+func (r *kickReporter) ReportGauge(metric string, tags map[string]string, value float64) error {
+	return nil
+}
+
+func TestHandler_KickSlowClient(t *testing.T) {
+	reporter := &kickReporter{}
+	n := &Node{Options: Options{
+		IsMaster:          true,
+		SlowClientTimeout: 100 * time.Millisecond,
+		MetricsReporters:  []metrics.Reporter{reporter},
+	}}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	h := NewHandler(n, nil)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		h.handle(server, transportTCP)
+		close(done)
+	}()
+
+	// a heartbeating client survives though it is idle longer than the timeout
+	heartbeat, _ := codec.Encode(packet.Heartbeat, nil)
+	for i := 0; i < 3; i++ {
+		if _, err := client.Write(heartbeat); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(60 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// drip the header of a data packet one byte every 40ms
+	kicked := make(chan []*packet.Packet)
+	go func() {
+		buf := make([]byte, 1024)
+		l, err := client.Read(buf)
+		if err != nil {
+			close(kicked)
+			return
+		}
+		packets, _ := codec.NewDecoder().Decode(buf[:l])
+		kicked <- packets
+	}()
+	header, _ := codec.EncodeHead(packet.Data, 16)
+	for _, b := range header {
+		if _, err := client.Write([]byte{b}); err != nil {
+			break
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+
+	packets := <-kicked
+	if len(packets) != 1 || packets[0].Type != packet.Kick {
+		t.Fatalf("expect a kick packet, got: %v", packets)
+	}
+	if !strings.Contains(string(packets[0].Data), kickReasonSlowClient) {
+		t.Fatalf("unexpected kick message: %s", packets[0].Data)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect the read goroutine to exit")
+	}
+	if len(reporter.reasons) != 1 || reporter.reasons[0] != kickReasonSlowClient {
+		t.Fatalf("expect: slow client kicked, got: %v", reporter.reasons)
+	}
+}
+
+func TestNode_AcquireIPConn(t *testing.T) {
+	n := &Node{Options: Options{MaxConnectionsPerIP: 2}}
+	a := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5001}
+	b := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5002}
+	other := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5001}
+
+	ip, ok := n.acquireIPConn(a)
+	if !ok || ip != "10.0.0.1" {
+		t.Fatalf("expect connection of 10.0.0.1 to be acquired, got: %s %v", ip, ok)
+	}
+	if _, ok := n.acquireIPConn(b); !ok {
+		t.Fatal("expect connection to be acquired under the limit")
+	}
+	if _, ok := n.acquireIPConn(a); ok {
+		t.Fatal("expect connection to be rejected at the limit")
+	}
+	if _, ok := n.acquireIPConn(other); !ok {
+		t.Fatal("expect connection of another IP to be acquired")
+	}
+
+	n.releaseIPConn(ip)
+	if _, ok := n.acquireIPConn(a); !ok {
+		t.Fatal("expect connection to be acquired after release")
+	}
+	n.releaseIPConn(ip)
+	n.releaseIPConn(ip)
+	if _, ok := n.ipConns.Load(ip); ok {
+		t.Fatal("expect the counter to be removed without connections")
+	}
+}
+
+type remoteConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c remoteConn) RemoteAddr() net.Addr { return c.addr }
+
+func TestHandler_RejectPerIP(t *testing.T) {
+	reporter := &kickReporter{}
+	n := &Node{Options: Options{MaxConnectionsPerIP: 1, MetricsReporters: []metrics.Reporter{reporter}}}
+	h := &LocalHandler{currentNode: n}
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5001}
+	if _, ok := n.acquireIPConn(addr); !ok {
+		t.Fatal("expect connection to be acquired")
+	}
+
+	server, client := net.Pipe()
+	go h.handle(remoteConn{Conn: server, addr: addr}, transportTCP)
+
+	buf := make([]byte, 1024)
+	l, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, err := codec.NewDecoder().Decode(buf[:l])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 1 || packets[0].Type != packet.Kick {
+		t.Fatalf("expect a kick packet, got: %v", packets)
+	}
+	if !strings.Contains(string(packets[0].Data), kickReasonTooManyConns) {
+		t.Fatalf("unexpected kick message: %s", packets[0].Data)
+	}
+	for i := 0; atomic.LoadInt64(&n.activeSessions) != 0; i++ {
+		if i > 100 {
+			t.Fatalf("expect the session slot to be released, got: %d", n.activeSessions)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandler_RateLimitDelay(t *testing.T) {
+	fake := clocktest.NewFake(time.Now())
+	defer func(c clock.Clock) { env.Clock = c }(env.Clock)
+	env.Clock = fake
+
+	rule := ratelimit.Rule{Limit: 1, Window: time.Second, Policy: ratelimit.PolicyDelay}
+	n := &Node{Options: Options{RateLimitRules: ratelimit.Rules{"Room.Join": rule}}}
+	h := &LocalHandler{currentNode: n, routeLimit: ratelimit.NewSlidingWindow()}
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+
+	if allowed, err := h.allowRoute(a, "Room.Join"); !allowed || err != nil {
+		t.Fatalf("expect the first request allowed, got: %v (%v)", allowed, err)
+	}
+
+	// the limited request waits for the window on the clock
+	allowed := make(chan bool, 1)
+	take := func() {
+		ok, _ := h.allowRoute(a, "Room.Join")
+		allowed <- ok
+	}
+	go take()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-allowed:
+		t.Fatal("expect the request delayed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	fake.Advance(time.Second)
+	if ok := <-allowed; !ok {
+		t.Fatal("expect the request allowed after the window")
+	}
+
+	// the waiting request is dropped once the session is closed
+	go take()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	a.Close()
+	select {
+	case ok := <-allowed:
+		if ok {
+			t.Fatal("expect the request of the closed session dropped")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect the waiting request released")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+)
+
+// DefaultHashReplicas is the number of virtual nodes placed on the hash ring for
+// each unit of member weight.
+const DefaultHashReplicas = 160
+
+// memberWeight parses the weight of member from its label, which is a comma
+// separated list and the weight is specified as `weight=N`, e.g: "game,weight=4".
+// The weight is 1 if absent or invalid.
+func memberWeight(label string) int {
+	for _, item := range strings.Split(label, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 || kv[0] != "weight" {
+			continue
+		}
+		if w, err := strconv.Atoi(kv[1]); err == nil && w > 0 {
+			return w
+		}
+	}
+	return 1
+}
+
+// hashRing is a consistent hash ring of the members of a service, each member is
+// placed on the ring with replicas*weight virtual nodes. The positions of virtual
+// nodes only depend on the member address, so only the keys owned by the changed
+// member are moved when the membership or weights change.
+type hashRing struct {
+	hashes []uint64
+	owners map[uint64]string
+}
+
+func newHashRing(members []*clusterpb.MemberInfo, replicas int) *hashRing {
+	if replicas <= 0 {
+		replicas = DefaultHashReplicas
+	}
+	r := &hashRing{owners: map[uint64]string{}}
+	for _, m := range members {
+		n := replicas * memberWeight(m.Label)
+		for i := 0; i < n; i++ {
+			h := hashKey(m.ServiceAddr + "#" + strconv.Itoa(i))
+			if _, found := r.owners[h]; found {
+				continue
+			}
+			r.owners[h] = m.ServiceAddr
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// get returns the address of member which owns the key
+func (r *hashRing) get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// shares returns the fraction of hash space owned by each member
+func (r *hashRing) shares() map[string]float64 {
+	shares := map[string]float64{}
+	if len(r.hashes) == 0 {
+		return shares
+	}
+	const space = float64(1<<63) * 2
+	prev := r.hashes[len(r.hashes)-1]
+	for _, h := range r.hashes {
+		// the range (prev, h] is owned by h, wrapping around at the end of ring
+		shares[r.owners[h]] += float64(h-prev) / space
+		prev = h
+	}
+	if len(r.hashes) == 1 {
+		shares[r.owners[prev]] = 1
+	}
+	return shares
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	// finalizer of splitmix64, fnv distributes the keys with common prefix poorly
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
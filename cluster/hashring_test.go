@@ -0,0 +1,91 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+)
+
+func TestMemberWeight(t *testing.T) {
+	cases := map[string]int{
+		"":                1,
+		"game":            1,
+		"game,weight=4":   4,
+		"weight=2, game":  2,
+		"game,weight=0":   1,
+		"game,weight=abc": 1,
+	}
+	for label, weight := range cases {
+		if w := memberWeight(label); w != weight {
+			t.Fatalf("label %q expect: %d, got: %d", label, weight, w)
+		}
+	}
+}
+
+func TestHashRing_Weight(t *testing.T) {
+	ring := newHashRing([]*clusterpb.MemberInfo{
+		{ServiceAddr: "127.0.0.1:4001", Label: "weight=1"},
+		{ServiceAddr: "127.0.0.1:4002", Label: "weight=3"},
+	}, 0)
+
+	counts := map[string]int{}
+	const keys = 100000
+	for i := 0; i < keys; i++ {
+		counts[ring.get(strconv.Itoa(i))]++
+	}
+	if f := float64(counts["127.0.0.1:4002"]) / keys; math.Abs(f-0.75) > 0.05 {
+		t.Fatalf("expect about 75%% of keys on the heavier member, got: %.3f", f)
+	}
+	if f := ring.shares()["127.0.0.1:4002"]; math.Abs(f-0.75) > 0.05 {
+		t.Fatalf("expect about 75%% of hash space on the heavier member, got: %.3f", f)
+	}
+}
+
+func TestHashRing_MinimalMovement(t *testing.T) {
+	members := []*clusterpb.MemberInfo{
+		{ServiceAddr: "127.0.0.1:4001"},
+		{ServiceAddr: "127.0.0.1:4002"},
+		{ServiceAddr: "127.0.0.1:4003"},
+	}
+	before := newHashRing(members, 0)
+	after := newHashRing(append(members, &clusterpb.MemberInfo{ServiceAddr: "127.0.0.1:4004"}), 0)
+
+	moved := 0
+	const keys = 100000
+	for i := 0; i < keys; i++ {
+		key := strconv.Itoa(i)
+		from, to := before.get(key), after.get(key)
+		if from == to {
+			continue
+		}
+		if to != "127.0.0.1:4004" {
+			t.Fatalf("key %s moved between existing members: %s -> %s", key, from, to)
+		}
+		moved++
+	}
+	if f := float64(moved) / keys; math.Abs(f-0.25) > 0.05 {
+		t.Fatalf("expect about 25%% of keys moved, got: %.3f", f)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/lonng/nano/metrics"
+	"google.golang.org/grpc/connectivity"
+)
+
+// registerHealthChecks adds the readiness checks of current node to the reporters
+// serving the health probes, e.g: the prometheus reporter
+func (n *Node) registerHealthChecks() {
+	for _, r := range n.MetricsReporters {
+		registry, ok := r.(metrics.HealthRegistry)
+		if !ok {
+			continue
+		}
+		if n.ClientAddr != "" {
+			registry.AddReadinessCheck(metrics.HealthCheckFunc("acceptor", n.checkAcceptor))
+		}
+		if !n.IsMaster && n.AdvertiseAddr != "" && n.Registry == nil && n.RPCTransport == nil {
+			registry.AddReadinessCheck(metrics.HealthCheckFunc("cluster", n.checkCluster))
+		}
+	}
+}
+
+// checkAcceptor checks whether current node accepts the client connections
+func (n *Node) checkAcceptor(_ context.Context) error {
+	if !n.isRunning() {
+		return ErrNodeNotRunning
+	}
+	if atomic.LoadInt32(&n.draining) == 1 {
+		return ErrNodeDraining
+	}
+	return nil
+}
+
+// checkCluster checks whether the master of the cluster is reachable
+func (n *Node) checkCluster(_ context.Context) error {
+	pool, err := n.rpcClient.getConnPool(n.AdvertiseAddr)
+	if err != nil {
+		return err
+	}
+	if !pool.healthy() {
+		return ErrMasterUnreachable
+	}
+	return nil
+}
+
+// healthy returns whether any connection of the pool is usable
+func (a *connPool) healthy() bool {
+	for _, c := range a.v {
+		if c == nil {
+			continue
+		}
+		switch c.GetState() {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNode_HealthChecks(t *testing.T) {
+	n := &Node{Options: Options{ClientAddr: ":0"}}
+	if err := n.checkAcceptor(context.Background()); err != ErrNodeNotRunning {
+		t.Fatalf("expect: %v, got: %v", ErrNodeNotRunning, err)
+	}
+	atomic.StoreInt32(&n.running, 1)
+	if err := n.checkAcceptor(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&n.draining, 1)
+	if err := n.checkAcceptor(context.Background()); err != ErrNodeDraining {
+		t.Fatalf("expect: %v, got: %v", ErrNodeDraining, err)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lonng/nano/internal/log"
+)
+
+// maxHTTPUpstreamBody is the largest request body of the upstream packets, which
+// are usually a few small requests
+const maxHTTPUpstreamBody = 1 << 20
+
+// httpUpstreamBacklog is the number of request bodies can be queued for a session
+// before the upstream requests block
+const httpUpstreamBacklog = 16
+
+// serveHTTPFallback serves the HTTP fallback transport for the clients which
+// can not upgrade to WebSocket, e.g: behind a proxy blocking the upgrades.
+//
+// The client opens the downstream with a GET request, which is responded as a
+// Server-Sent Events stream. The first event named open carries the id of the
+// connection, and each following event carries a chunk of the byte stream of
+// packets encoded with base64. The upstream bytes are sent as the body of POST
+// requests with the query parameter sid set to the connection id. The session
+// is closed once the downstream is closed by either side.
+func (n *Node) serveHTTPFallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			n.serveHTTPDownstream(w, r)
+		case http.MethodPost:
+			n.serveHTTPUpstream(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (n *Node) serveHTTPDownstream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	id, err := newHTTPConnID()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// disable the response buffering of nginx
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "event: open\ndata: %s\n\n", id)
+	flusher.Flush()
+
+	c := newHTTPConn(w, flusher, r)
+	n.httpConns.Store(id, c)
+	defer n.httpConns.Delete(id)
+
+	go func() {
+		select {
+		case <-r.Context().Done():
+			c.Close()
+		case <-c.die:
+		}
+	}()
+
+	// the response writer is valid until the handler returns, so the session
+	// is served in current goroutine
+	n.handler.handle(c, transportHTTP)
+	c.Close()
+	c.detach()
+}
+
+func (n *Node) serveHTTPUpstream(w http.ResponseWriter, r *http.Request) {
+	v, ok := n.httpConns.Load(r.URL.Query().Get("sid"))
+	if !ok {
+		http.Error(w, "connection not found", http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPUpstreamBody))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := v.(*httpConn).feed(body, r.Context().Done()); err != nil {
+		http.Error(w, "connection closed", http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newHTTPConnID returns a random connection id, which authorizes the upstream
+// requests of the connection
+func newHTTPConnID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// httpAddr is the remote address of the clients which is not a TCP address, e.g:
+// the server listens on a Unix domain socket
+type httpAddr string
+
+func (a httpAddr) Network() string { return "http" }
+func (a httpAddr) String() string  { return string(a) }
+
+// httpTimeoutError is returned by the reads of httpConn after the read deadline
+type httpTimeoutError struct{}
+
+func (httpTimeoutError) Error() string   { return "http fallback: i/o timeout" }
+func (httpTimeoutError) Timeout() bool   { return true }
+func (httpTimeoutError) Temporary() bool { return true }
+
+// httpConn adapts a downstream event stream and the upstream requests to
+// net.Conn. The write deadline is not supported since the response writer of
+// the stream has no deadline.
+type httpConn struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	local   net.Addr
+	remote  net.Addr
+
+	wmu      sync.Mutex
+	detached bool // the response writer is not usable since the handler returned
+
+	upstream chan []byte
+	pending  []byte // upstream bytes not read yet
+
+	dmu      sync.Mutex
+	deadline time.Time
+	wake     chan struct{} // receives a signal when the read deadline changes
+
+	die  chan struct{}
+	once sync.Once
+}
+
+func newHTTPConn(w http.ResponseWriter, flusher http.Flusher, r *http.Request) *httpConn {
+	c := &httpConn{
+		w:        w,
+		flusher:  flusher,
+		upstream: make(chan []byte, httpUpstreamBacklog),
+		wake:     make(chan struct{}, 1),
+		die:      make(chan struct{}),
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		c.local = addr
+	}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		c.remote = addr
+	} else {
+		c.remote = httpAddr(r.RemoteAddr)
+	}
+	return c
+}
+
+// feed queues the upstream bytes to be read, it blocks until the bytes are
+// queued, the connection is closed or cancel is closed
+func (c *httpConn) feed(b []byte, cancel <-chan struct{}) error {
+	select {
+	case c.upstream <- b:
+		return nil
+	case <-c.die:
+		return io.ErrClosedPipe
+	case <-cancel:
+		return io.ErrClosedPipe
+	}
+}
+
+// Read reads the bytes of upstream requests in order
+func (c *httpConn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		c.dmu.Lock()
+		deadline := c.deadline
+		c.dmu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, httpTimeoutError{}
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+
+		var err error
+		select {
+		case c.pending = <-c.upstream:
+		case <-c.die:
+			err = io.EOF
+		case <-timeout:
+			err = httpTimeoutError{}
+		case <-c.wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends the bytes to client as an event of the stream
+func (c *httpConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.detached {
+		return 0, io.ErrClosedPipe
+	}
+	if _, err := fmt.Fprintf(c.w, "data: %s\n\n", base64.StdEncoding.EncodeToString(b)); err != nil {
+		return 0, err
+	}
+	c.flusher.Flush()
+	return len(b), nil
+}
+
+// detach waits for the write in progress and refuses the subsequent writes, it
+// is called before the handler returns
+func (c *httpConn) detach() {
+	c.wmu.Lock()
+	c.detached = true
+	c.wmu.Unlock()
+}
+
+// Close closes the connection, the downstream is closed once its handler returns
+func (c *httpConn) Close() error {
+	c.once.Do(func() { close(c.die) })
+	return nil
+}
+
+func (c *httpConn) LocalAddr() net.Addr  { return c.local }
+func (c *httpConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *httpConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *httpConn) SetReadDeadline(t time.Time) error {
+	c.dmu.Lock()
+	c.deadline = t
+	c.dmu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *httpConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
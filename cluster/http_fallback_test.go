@@ -0,0 +1,187 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/session"
+)
+
+// sseClient adapts the HTTP fallback transport to net.Conn for protocolClient
+type sseClient struct {
+	net.Conn
+	url     string
+	id      string
+	body    io.ReadCloser
+	reader  *bufio.Reader
+	pending []byte
+}
+
+func dialHTTPFallback(t *testing.T, url string) *sseClient {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := resp.Header.Get("Content-Type"); typ != "text/event-stream" {
+		t.Fatalf("expect event stream, got: %s", typ)
+	}
+	c := &sseClient{url: url, body: resp.Body, reader: bufio.NewReader(resp.Body)}
+	event, data, err := c.next()
+	if err != nil || event != "open" || data == "" {
+		t.Fatalf("expect the open event, got: %s %s %v", event, data, err)
+	}
+	c.id = data
+	return c
+}
+
+// next reads the next event of the stream
+func (c *sseClient) next() (event, data string, err error) {
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return "", "", err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return event, data, nil
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func (c *sseClient) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		_, data, err := c.next()
+		if err != nil {
+			return 0, err
+		}
+		if c.pending, err = base64.StdEncoding.DecodeString(data); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *sseClient) Write(b []byte) (int, error) {
+	resp, err := http.Post(c.url+"?sid="+c.id, "application/octet-stream", bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, io.ErrClosedPipe
+	}
+	return len(b), nil
+}
+
+func (c *sseClient) Close() error {
+	return c.body.Close()
+}
+
+func TestNode_HTTPFallback(t *testing.T) {
+	cache()
+	n := &Node{Options: Options{IsMaster: true}}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.handler = NewHandler(n, nil)
+	server := httptest.NewServer(n.serveHTTPFallback())
+	defer server.Close()
+
+	conn := dialHTTPFallback(t, server.URL)
+	client := &protocolClient{conn: conn, decoder: codec.NewDecoder()}
+	if version, err := client.handshake(message.V2); err != nil || version != message.V2 {
+		t.Fatalf("expect handshake with V2, got: %d %v", version, err)
+	}
+	if count := atomic.LoadInt64(&n.activeSessions); count != 1 {
+		t.Fatalf("expect 1 session, got: %d", count)
+	}
+
+	// the upstream requests of unknown connections are refused
+	resp, err := http.Post(server.URL+"?sid=unknown", "application/octet-stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect: %d, got: %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	// the session is closed with the downstream
+	conn.Close()
+	closed := func() bool {
+		_, ok := n.httpConns.Load(conn.id)
+		return !ok && atomic.LoadInt64(&n.activeSessions) == 0
+	}
+	for deadline := time.Now().Add(time.Second); !closed(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect the session closed with the downstream")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHTTPConn_ReadDeadline(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	c := newHTTPConn(w, w, r)
+
+	c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := c.Read(make([]byte, 8)); err == nil {
+		t.Fatalf("expect the read timed out")
+	} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("expect a timeout error, got: %v", err)
+	}
+
+	c.SetReadDeadline(time.Time{})
+	c.feed([]byte("nano"), nil)
+	buf := make([]byte, 8)
+	if n, err := c.Read(buf); err != nil || string(buf[:n]) != "nano" {
+		t.Fatalf("expect: nano, got: %s %v", buf[:n], err)
+	}
+
+	c.Close()
+	if _, err := c.Read(buf); err != io.EOF {
+		t.Fatalf("expect: %v, got: %v", io.EOF, err)
+	}
+	c.detach()
+	if _, err := c.Write([]byte("nano")); err != io.ErrClosedPipe {
+		t.Fatalf("expect: %v, got: %v", io.ErrClosedPipe, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lonng/nano/metrics"
+)
+
+// DefaultShutdownTimeout is the default time to wait for the in-flight handlers
+// to complete when the node shuts down
+const DefaultShutdownTimeout = 10 * time.Second
+
+// inflight counts the handlers which have been dispatched but not completed
+type inflight struct {
+	mu   sync.Mutex
+	n    int64
+	idle chan struct{} // closed when the count drops to zero
+}
+
+func (f *inflight) add() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n == 0 {
+		f.idle = make(chan struct{})
+	}
+	f.n++
+	return f.n
+}
+
+func (f *inflight) done() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n--
+	if f.n == 0 {
+		close(f.idle)
+	}
+	return f.n
+}
+
+func (f *inflight) count() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.n
+}
+
+// wait blocks until the count drops to zero or ctx is done
+func (f *inflight) wait(ctx context.Context) error {
+	f.mu.Lock()
+	if f.n == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	idle := f.idle
+	f.mu.Unlock()
+
+	select {
+	case <-idle:
+		// new handlers may be dispatched after the count dropped to zero
+		return f.wait(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// beginHandler marks a handler in-flight, which includes the time queued in
+// the scheduler, endHandler must be called once the handler completes
+func (n *Node) beginHandler() {
+	metrics.ReportInflightHandlers(n.MetricsReporters, n.inflight.add())
+}
+
+func (n *Node) endHandler() {
+	metrics.ReportInflightHandlers(n.MetricsReporters, n.inflight.done())
+}
+
+// WaitForIdle blocks until the dispatch queue is empty and all in-flight handlers
+// have completed, including the requests forwarded to remote nodes and the shadow
+// handlers. The ctx.Err() will be returned if ctx is done before idle.
+func (n *Node) WaitForIdle(ctx context.Context) error {
+	return n.inflight.wait(ctx)
+}
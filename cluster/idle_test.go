@@ -0,0 +1,89 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/scheduler"
+)
+
+type queueScheduler chan scheduler.Task
+
+func (q queueScheduler) Schedule(task scheduler.Task) { q <- task }
+
+func TestNode_WaitForIdle(t *testing.T) {
+	n := &Node{}
+	h := NewHandler(n, nil)
+	opts := []component.Option{component.WithName("Log"), component.WithSchedulerName("queue")}
+	if err := h.register(&LogComponent{}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	queue := make(queueScheduler, 2)
+	a.session.Set("queue", queue)
+
+	if err := n.WaitForIdle(context.Background()); err != nil {
+		t.Fatalf("expect idle without handlers, got: %v", err)
+	}
+
+	for i := uint64(1); i <= 2; i++ {
+		h.localProcess(h.localHandlers["Log.Echo"], i, a.session, &message.Message{
+			Type: message.Request, ID: i, Route: "Log.Echo", Data: []byte("hello"),
+		})
+	}
+	if c := n.inflight.count(); c != 2 {
+		t.Fatalf("expect: 2 in-flight handlers, got: %d", c)
+	}
+
+	// the queued handlers are in-flight
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := n.WaitForIdle(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect: %v, got: %v", context.DeadlineExceeded, err)
+	}
+
+	idle := make(chan error)
+	go func() { idle <- n.WaitForIdle(context.Background()) }()
+	(<-queue)()
+	select {
+	case <-idle:
+		t.Fatal("expect to wait for the rest handler")
+	case <-time.After(20 * time.Millisecond):
+	}
+	(<-queue)()
+	select {
+	case err := <-idle:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect idle after all handlers completed")
+	}
+}
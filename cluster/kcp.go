@@ -0,0 +1,170 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lonng/nano/metrics"
+)
+
+// transport names, which are used as the transport label of metrics
+const (
+	transportTCP  = "tcp"
+	transportWS   = "ws"
+	transportKCP  = "kcp"
+	transportQUIC = "quic"
+	transportHTTP = "http"
+)
+
+// KCPConfig contains the parameters of KCP sessions, see the documentation of
+// kcp-go for more details.
+//
+// Each KCP session is identified by the conversation id (conv) chosen by the
+// client, which should be a random non-zero number per connection. Sessions
+// with conv 0 are refused, and a new session reusing the conv of a live one is
+// treated as the same client rebound to another address by a NAT, the stale
+// session will be closed immediately instead of waiting for the heartbeat
+// timeout.
+//
+// The KCP acceptor depends on github.com/xtaci/kcp-go/v5, which is only
+// compiled with the kcp build tag:
+//
+//	go get github.com/xtaci/kcp-go/v5
+//	go build -tags kcp
+type KCPConfig struct {
+	NoDelay      bool // whether nodelay mode is enabled
+	Interval     int  // internal update timer interval in millisecond
+	Resend       int  // fast resend trigger count, 0 means fast resend is disabled
+	NoCongestion bool // whether congestion control is disabled
+	SendWindow   int  // send window size in packets
+	RecvWindow   int  // receive window size in packets
+	MTU          int  // maximum transmission unit
+	DataShards   int  // FEC data shards, 0 means FEC is disabled
+	ParityShards int  // FEC parity shards
+}
+
+// DefaultKCPConfig returns the recommended configuration for latency sensitive games
+func DefaultKCPConfig() *KCPConfig {
+	return &KCPConfig{
+		NoDelay:      true,
+		Interval:     10,
+		Resend:       2,
+		NoCongestion: true,
+		SendWindow:   128,
+		RecvWindow:   128,
+		MTU:          1400,
+	}
+}
+
+// convConn is a KCP session registered in the conv table, the conv is
+// released once the session is closed
+type convConn struct {
+	net.Conn
+	conv  uint32
+	table *convTable
+	once  sync.Once
+}
+
+func (c *convConn) Close() error {
+	c.once.Do(func() { c.table.release(c) })
+	return c.Conn.Close()
+}
+
+// convTable tracks the conversation ids of the live KCP sessions
+type convTable struct {
+	mu    sync.Mutex
+	conns map[uint32]*convConn
+}
+
+// register registers the session of conv, and returns the stale session of
+// the same conv if present, which should be closed by the caller
+func (t *convTable) register(conn net.Conn, conv uint32) (*convConn, *convConn) {
+	c := &convConn{Conn: conn, conv: conv, table: t}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns == nil {
+		t.conns = map[uint32]*convConn{}
+	}
+	stale := t.conns[conv]
+	t.conns[conv] = c
+	return c, stale
+}
+
+// release removes the session from the table if it has not been replaced
+func (t *convTable) release(c *convConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns[c.conv] == c {
+		delete(t.conns, c.conv)
+	}
+}
+
+// len returns the number of live sessions
+func (t *convTable) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// meteredConn reports the bytes transferred by the underlying conn
+type meteredConn struct {
+	net.Conn
+	transport string
+	reporters []metrics.Reporter
+}
+
+func newMeteredConn(conn net.Conn, transport string, reporters []metrics.Reporter) net.Conn {
+	if len(reporters) == 0 {
+		return conn
+	}
+	return &meteredConn{Conn: conn, transport: transport, reporters: reporters}
+}
+
+func (c *meteredConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		metrics.ReportReceivedBytes(c.reporters, c.transport, n)
+	}
+	return n, err
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		metrics.ReportSentBytes(c.reporters, c.transport, n)
+	}
+	return n, err
+}
+
+// connectedClients returns the counter of client sessions of the transport
+func (n *Node) connectedClients(transport string) *int64 {
+	c, _ := n.clients.LoadOrStore(transport, new(int64))
+	return c.(*int64)
+}
+
+// reportConnectedClients updates the number of connected clients of the transport
+func (n *Node) reportConnectedClients(transport string, delta int64) {
+	count := atomic.AddInt64(n.connectedClients(transport), delta)
+	metrics.ReportConnectedClients(n.MetricsReporters, transport, count)
+}
@@ -0,0 +1,84 @@
+// +build kcp
+
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/lonng/nano/internal/log"
+	kcp "github.com/xtaci/kcp-go/v5"
+)
+
+func (n *Node) listenAndServeKCP(addr string) {
+	cfg := n.KCP
+	listener, err := kcp.ListenWithOptions(addr, nil, cfg.DataShards, cfg.ParityShards)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	n.addListener(listener)
+
+	defer listener.Close()
+	for n.isRunning() {
+		conn, err := listener.AcceptKCP()
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+
+		// KCP has no FIN, dead sessions are detected by the heartbeat timeout
+		conn.SetStreamMode(true)
+		conn.SetWriteDelay(false)
+		conn.SetNoDelay(boolToInt(cfg.NoDelay), cfg.Interval, cfg.Resend, boolToInt(cfg.NoCongestion))
+		conn.SetWindowSize(cfg.SendWindow, cfg.RecvWindow)
+		if cfg.MTU > 0 {
+			conn.SetMtu(cfg.MTU)
+		}
+
+		conv := conn.GetConv()
+		if conv == 0 {
+			log.Println(fmt.Sprintf("KCP session from %s refused, conv cannot be zero", conn.RemoteAddr()))
+			conn.Close()
+			continue
+		}
+		c, stale := n.kcpConvs.register(conn, conv)
+		if stale != nil {
+			log.Println(fmt.Sprintf("KCP conv %d rebound from %s to %s, close the stale session", conv, stale.RemoteAddr(), conn.RemoteAddr()))
+			stale.Close()
+		}
+
+		fc, err := n.fragmented(c)
+		if err != nil {
+			log.Println(err.Error())
+			c.Close()
+			continue
+		}
+		go n.handler.handle(fc, transportKCP)
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
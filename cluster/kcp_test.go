@@ -0,0 +1,56 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"testing"
+)
+
+func TestConvTable(t *testing.T) {
+	var table convTable
+
+	a, _ := net.Pipe()
+	first, stale := table.register(a, 1)
+	if stale != nil {
+		t.Fatalf("expect no stale session, got: %v", stale)
+	}
+
+	b, _ := net.Pipe()
+	second, stale := table.register(b, 1)
+	if stale != first {
+		t.Fatalf("expect the first session to be stale")
+	}
+	if table.len() != 1 {
+		t.Fatalf("expect: 1 live session, got: %d", table.len())
+	}
+
+	// closing the stale session should not release the conv of the new one
+	first.Close()
+	if table.len() != 1 {
+		t.Fatalf("expect: 1 live session, got: %d", table.len())
+	}
+	second.Close()
+	second.Close()
+	if table.len() != 0 {
+		t.Fatalf("expect: 0 live session, got: %d", table.len())
+	}
+}
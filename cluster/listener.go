@@ -0,0 +1,172 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+)
+
+// Transports of the client listeners
+const (
+	ListenerTCP  = "tcp"
+	ListenerWS   = "ws"
+	ListenerWSS  = "wss"
+	ListenerKCP  = "kcp"
+	ListenerQUIC = "quic"
+)
+
+// Schemes of the listener addresses besides the host:port of TCP
+const (
+	schemeUnix    = "unix://"
+	schemeSystemd = "systemd://"
+)
+
+// ListenerConfig describes an additional client endpoint of the node, the
+// clients of all endpoints are served by the same handlers and sessions.
+type ListenerConfig struct {
+	Transport string // one of ListenerTCP, ListenerWS, ListenerWSS, ListenerKCP and ListenerQUIC
+	Addr      string // host:port, or unix:///path and systemd://[name] for TCP and WebSocket
+}
+
+// initListeners validates the listeners, the recommended configuration is
+// used by the KCP and QUIC listeners if absent
+func (n *Node) initListeners() error {
+	addrs := map[string]bool{}
+	for _, l := range n.Listeners {
+		if l.Addr == "" {
+			return fmt.Errorf("listener: empty address of %s listener", l.Transport)
+		}
+		// KCP and QUIC listen on UDP, which can share the port of TCP listeners
+		network := "tcp"
+		switch l.Transport {
+		case ListenerTCP, ListenerWS:
+		case ListenerWSS:
+			if !n.secure() {
+				return fmt.Errorf("listener: wss listener %s requires a TLS certificate", l.Addr)
+			}
+		case ListenerKCP:
+			network = "udp"
+			if n.KCP == nil {
+				n.KCP = DefaultKCPConfig()
+			}
+		case ListenerQUIC:
+			network = "udp"
+			if n.QUIC == nil {
+				n.QUIC = DefaultQUICConfig()
+			}
+		default:
+			return fmt.Errorf("listener: unknown transport %q", l.Transport)
+		}
+		if network == "udp" && strings.Contains(l.Addr, "://") {
+			return fmt.Errorf("listener: %s listener requires a UDP address, got %s", l.Transport, l.Addr)
+		}
+		if addrs[network+l.Addr] {
+			return fmt.Errorf("listener: duplicate address %s", l.Addr)
+		}
+		addrs[network+l.Addr] = true
+	}
+	return nil
+}
+
+// listen listens on addr of the TCP and WebSocket acceptors, which is one of:
+//
+//	host:port         TCP address, e.g: ":3250"
+//	unix:///path      Unix domain socket, the socket file left by the previous
+//	                  process is removed
+//	systemd://[name]  socket passed by systemd socket activation, whose
+//	                  FileDescriptorName is name, the first socket is used if
+//	                  name is empty
+func (n *Node) listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, schemeUnix):
+		path := strings.TrimPrefix(addr, schemeUnix)
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	case strings.HasPrefix(addr, schemeSystemd):
+		return activatedListener(strings.TrimPrefix(addr, schemeSystemd))
+	}
+	listenConfig := net.ListenConfig{
+		Control: Control,
+	}
+	return listenConfig.Listen(context.Background(), "tcp", addr)
+}
+
+// serveListener serves the clients of the listener until the node shutdown
+func (n *Node) serveListener(l ListenerConfig) {
+	log.Println(fmt.Sprintf("Startup %s listener, address %s", l.Transport, l.Addr))
+	switch l.Transport {
+	case ListenerTCP:
+		n.listenAndServe(l.Addr)
+	case ListenerWS:
+		n.listenAndServeWS(l.Addr)
+	case ListenerWSS:
+		n.listenAndServeWSTLS(l.Addr)
+	case ListenerKCP:
+		n.listenAndServeKCP(l.Addr)
+	case ListenerQUIC:
+		n.listenAndServeQUIC(l.Addr)
+	}
+}
+
+// handleWS registers the WebSocket handler and the HTTP fallback handler if
+// enabled on the default serve mux, which is shared by all WebSocket listeners
+func (n *Node) handleWS() {
+	n.wsOnce.Do(func() {
+		http.HandleFunc("/"+strings.TrimPrefix(env.WSPath, "/"), n.serveWS(n.wsUpgrader()))
+		if path := n.HTTPFallbackPath; path != "" {
+			http.HandleFunc("/"+strings.TrimPrefix(path, "/"), n.serveHTTPFallback())
+		}
+	})
+}
+
+// addListener records the listener to be closed in shutdown
+func (n *Node) addListener(ln net.Listener) {
+	n.mu.Lock()
+	n.listeners = append(n.listeners, ln)
+	n.mu.Unlock()
+}
+
+// addServer records the HTTP server to be shutdown with the node
+func (n *Node) addServer(server *http.Server) {
+	n.mu.Lock()
+	n.httpServer = append(n.httpServer, server)
+	n.mu.Unlock()
+}
+
+// closeListeners stops accepting new clients of all listeners
+func (n *Node) closeListeners() {
+	n.mu.RLock()
+	listeners := n.listeners
+	n.mu.RUnlock()
+	for _, ln := range listeners {
+		ln.Close()
+	}
+}
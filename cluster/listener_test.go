@@ -0,0 +1,157 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNode_InitListeners(t *testing.T) {
+	n := &Node{Options: Options{Listeners: []ListenerConfig{
+		{Transport: ListenerTCP, Addr: ":3250"},
+		{Transport: ListenerKCP, Addr: ":3250"},
+		{Transport: ListenerWS, Addr: ":3260"},
+	}}}
+	if err := n.initListeners(); err != nil {
+		t.Fatal(err)
+	}
+	if n.KCP == nil {
+		t.Fatalf("expect the default KCP config")
+	}
+
+	cases := [][]ListenerConfig{
+		{{Transport: "udp", Addr: ":3250"}},
+		{{Transport: ListenerTCP}},
+		{{Transport: ListenerWSS, Addr: ":3261"}},
+		{{Transport: ListenerTCP, Addr: ":3250"}, {Transport: ListenerWS, Addr: ":3250"}},
+		{{Transport: ListenerKCP, Addr: "unix:///run/nano.sock"}},
+	}
+	for _, c := range cases {
+		n := &Node{Options: Options{Listeners: c}}
+		if err := n.initListeners(); err == nil {
+			t.Fatalf("expect listeners %v refused", c)
+		}
+	}
+}
+
+func TestNode_ServeListeners(t *testing.T) {
+	n := &Node{Options: Options{Listeners: []ListenerConfig{
+		{Transport: ListenerTCP, Addr: "127.0.0.1:0"},
+		{Transport: ListenerTCP, Addr: "127.0.0.1:0"},
+	}}}
+	atomic.StoreInt32(&n.running, 1)
+
+	done := make(chan struct{}, len(n.Listeners))
+	for _, l := range n.Listeners {
+		go func(l ListenerConfig) {
+			n.serveListener(l)
+			done <- struct{}{}
+		}(l)
+	}
+	for deadline := time.Now().Add(time.Second); ; {
+		n.mu.RLock()
+		count := len(n.listeners)
+		n.mu.RUnlock()
+		if count == len(n.Listeners) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect: %d listeners, got: %d", len(n.Listeners), count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	atomic.StoreInt32(&n.running, 0)
+	n.closeListeners()
+	for range n.Listeners {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("expect all listeners closed")
+		}
+	}
+}
+
+func TestNode_ListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nano.sock")
+
+	n := &Node{}
+	ln, err := n.listen("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the socket file is left if the process exits without closing
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = n.listen("unix://" + path)
+	if err != nil {
+		t.Fatalf("expect the stale socket file removed, got: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, ok := n.acquireIPConn(conn.RemoteAddr()); !ok {
+		t.Fatalf("expect the connections of Unix domain sockets not limited")
+	}
+}
+
+func TestParseListenFDs(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	names, err := parseListenFDs(pid, "3", "client::admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"client", "unknown", "admin"}) {
+		t.Fatalf("unexpected names: %v", names)
+	}
+
+	// the sockets passed to another process are ignored
+	if names, err := parseListenFDs("1", "3", ""); err != nil || names != nil {
+		t.Fatalf("expect no socket, got: %v %v", names, err)
+	}
+	if _, err := parseListenFDs(pid, "x", ""); err == nil {
+		t.Fatalf("expect invalid LISTEN_FDS refused")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+	"google.golang.org/grpc"
+)
+
+func TestAgent_MessageBytes(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{MetricsReporters: []metrics.Reporter{reporter}}}
+	h := NewHandler(n, nil)
+	opts := []component.Option{component.WithName("Profile"), component.WithSchedulerName("sync")}
+	if err := h.register(&ProfileComponent{}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	a.reporters = n.MetricsReporters
+	a.session.Set("sync", syncScheduler{})
+
+	h.processMessage(a, &message.Message{Type: message.Request, ID: 1, Route: "Profile.Get", Data: []byte("alice")})
+	if _, ok := a.chSend.pop(); !ok {
+		t.Fatal("expect a response")
+	}
+	if v := reporter.value("message_bytes{direction=in,route=Profile.Get}"); v != 5 {
+		t.Fatalf("expect 5 bytes in, got: %v", v)
+	}
+	// alice#1
+	if v := reporter.value("message_bytes{direction=out,route=Profile.Get}"); v != 7 {
+		t.Fatalf("expect 7 bytes out, got: %v", v)
+	}
+	if _, ok := a.routes.take(1); ok {
+		t.Fatal("expect the route of responded request to be released")
+	}
+
+	// pushes are reported when they are written
+	go a.write()
+	defer a.Close()
+	if err := a.Push("onChat", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Read(make([]byte, 64)); err != nil {
+		t.Fatal(err)
+	}
+	if v := reporter.value("message_bytes{direction=out,route=onChat}"); v != 5 {
+		t.Fatalf("expect 5 bytes out, got: %v", v)
+	}
+}
+
+func TestAgent_MessageBytesUnanswered(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{MetricsReporters: []metrics.Reporter{reporter}}}
+	h := NewHandler(n, nil)
+	opts := []component.Option{component.WithName("Log"), component.WithSchedulerName("sync")}
+	if err := h.register(&LogComponent{}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	a.reporters = n.MetricsReporters
+	a.session.Set("sync", syncScheduler{})
+
+	// the handler never responds, the routes of the oldest requests are dropped
+	for mid := uint64(1); mid <= 3*maxPendingRoutes; mid++ {
+		h.processMessage(a, &message.Message{Type: message.Request, ID: mid, Route: "Log.Fail", Data: []byte("hello")})
+	}
+	if l := a.routes.len(); l != maxPendingRoutes {
+		t.Fatalf("expect %d routes pending, got: %d", maxPendingRoutes, l)
+	}
+	if len(a.routes.mids) > 2*maxPendingRoutes {
+		t.Fatalf("expect the message ids to be compacted, got: %d", len(a.routes.mids))
+	}
+	if _, ok := a.routes.take(1); ok {
+		t.Fatal("expect the route of the oldest request to be dropped")
+	}
+
+	// the latest requests are still reported once responded
+	if err := a.ResponseMid(3*maxPendingRoutes, []byte("late")); err != nil {
+		t.Fatal(err)
+	}
+	if v := reporter.value("message_bytes{direction=out,route=Log.Fail}"); v != 4 {
+		t.Fatalf("expect 4 bytes out, got: %v", v)
+	}
+}
+
+// gateClient accepts the messages sent to the gate
+type gateClient struct {
+	clusterpb.MemberClient
+}
+
+func (gateClient) HandlePush(ctx context.Context, in *clusterpb.PushMessage, opts ...grpc.CallOption) (*clusterpb.MemberHandleResponse, error) {
+	return &clusterpb.MemberHandleResponse{}, nil
+}
+
+func (gateClient) HandleResponse(ctx context.Context, in *clusterpb.ResponseMessage, opts ...grpc.CallOption) (*clusterpb.MemberHandleResponse, error) {
+	return &clusterpb.MemberHandleResponse{}, nil
+}
+
+func TestAcceptor_MessageBytes(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{MetricsReporters: []metrics.Reporter{reporter}}}
+	n.sessions = map[int64]*session.Session{}
+	n.handler = NewHandler(n, nil)
+	opts := []component.Option{component.WithName("Profile"), component.WithSchedulerName("sync")}
+	if err := n.handler.register(&ProfileComponent{}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// the session of the request forwarded by the gate
+	ac := &acceptor{sid: 1, gateClient: gateClient{}, reporters: n.MetricsReporters}
+	s := session.New(ac)
+	ac.session = s
+	s.Set("sync", syncScheduler{})
+	n.sessions[1] = s
+
+	_, err := n.HandleRequest(context.Background(), &clusterpb.RequestMessage{SessionId: 1, Id: 1, Route: "Profile.Get", Data: []byte("alice")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := reporter.value("message_bytes{direction=in,route=Profile.Get}"); v != 5 {
+		t.Fatalf("expect 5 bytes in, got: %v", v)
+	}
+	if v := reporter.value("message_bytes{direction=out,route=Profile.Get}"); v != 7 {
+		t.Fatalf("expect 7 bytes out, got: %v", v)
+	}
+
+	if err := s.Push("onChat", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if v := reporter.value("message_bytes{direction=out,route=onChat}"); v != 5 {
+		t.Fatalf("expect 5 bytes pushed, got: %v", v)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/membership"
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/session"
+)
+
+// defaultMigrationWindow is the duration a migrated session waits for the
+// client to reconnect if Options.MigrationWindow is not specified
+const defaultMigrationWindow = 30 * time.Second
+
+// migratedSession is a session migrated from another node, which is waiting
+// for the client to reconnect with the resume token
+type migratedSession struct {
+	uid        int64
+	attributes map[string]interface{}
+	groups     []string
+	timer      clock.Timer
+}
+
+// DrainResult reports the number of sessions handled by Node.Drain
+type DrainResult struct {
+	Migrated int `json:"migrated"`
+	Failed   int `json:"failed"`
+}
+
+// Drain stops accepting new connections and migrates all client sessions of
+// current node to the other frontend nodes of the cluster, the clients will
+// be redirected to the new address with a resume token, and the session will
+// be restored on the target node transparently to handlers.
+//
+// Session attributes are transferred with encoding/gob, attributes of custom
+// types should be registered by gob.Register, and attributes which can not be
+// encoded will not be migrated.
+func (n *Node) Drain() (DrainResult, error) {
+	atomic.StoreInt32(&n.draining, 1)
+
+	var result DrainResult
+	if n.rpcClient == nil {
+		return result, ErrNoMigrationTarget
+	}
+
+	var targets []string
+	for _, addr := range n.cluster.remoteAddrs() {
+		if addr != n.ServiceAddr {
+			targets = append(targets, addr)
+		}
+	}
+	if len(targets) == 0 {
+		return result, ErrNoMigrationTarget
+	}
+
+	var agents []*agent
+	n.mu.RLock()
+	for _, s := range n.sessions {
+		if a, ok := s.NetworkEntity().(*agent); ok {
+			agents = append(agents, a)
+		}
+	}
+	n.mu.RUnlock()
+
+	next := 0
+	for _, a := range agents {
+		req, err := newMigrateRequest(a.session)
+		if err != nil {
+			log.Println(fmt.Sprintf("Migrate session failed: %v, SessionID=%d", err, a.session.ID()))
+			result.Failed++
+			continue
+		}
+
+		// try the targets in round robin order, the backend nodes refuse
+		// migrations, so they will be removed from the targets
+		migrated := false
+		for len(targets) > 0 && !migrated {
+			next = next % len(targets)
+			addr := targets[next]
+			clientAddr, err := n.migrateTo(addr, req)
+			if err != nil {
+				log.Println(fmt.Sprintf("Migrate session to %s failed: %v", addr, err))
+				targets = append(targets[:next], targets[next+1:]...)
+				continue
+			}
+			next++
+
+			if err := a.redirect(clientAddr, req.Token); err != nil {
+				log.Println(fmt.Sprintf("Redirect session failed: %v, SessionID=%d", err, a.session.ID()))
+			}
+			a.Close()
+			migrated = true
+		}
+
+		if migrated {
+			result.Migrated++
+		} else {
+			result.Failed++
+		}
+	}
+
+	if len(targets) == 0 && result.Failed > 0 {
+		return result, ErrNoMigrationTarget
+	}
+	return result, nil
+}
+
+func (n *Node) migrateTo(addr string, req *clusterpb.MigrateSessionRequest) (string, error) {
+	client, err := n.rpcClient.memberClient(addr)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.MigrateSession(context.Background(), req)
+	if err != nil {
+		return "", err
+	}
+	return resp.ClientAddr, nil
+}
+
+// MigrateSession implements the MemberServer interface
+func (n *Node) MigrateSession(_ context.Context, req *clusterpb.MigrateSessionRequest) (*clusterpb.MigrateSessionResponse, error) {
+	if n.ClientAddr == "" || atomic.LoadInt32(&n.draining) == 1 {
+		return nil, ErrMigrationRefused
+	}
+
+	window := n.MigrationWindow
+	if window <= 0 {
+		window = defaultMigrationWindow
+	}
+
+	m := &migratedSession{
+		uid:        req.Uid,
+		attributes: decodeAttributes(req.Attributes),
+		groups:     req.Groups,
+	}
+	token := req.Token
+
+	n.mu.Lock()
+	if n.migrated == nil {
+		n.migrated = map[string]*migratedSession{}
+	}
+	n.migrated[token] = m
+	n.mu.Unlock()
+
+	// clean up the session if the client does not reconnect in time
+	m.timer = env.Clock.AfterFunc(window, func() {
+		n.mu.Lock()
+		if n.migrated[token] == m {
+			delete(n.migrated, token)
+		}
+		n.mu.Unlock()
+		if env.Debug {
+			log.Println(fmt.Sprintf("Migrated session expired, UID=%d", m.uid))
+		}
+	})
+
+	return &clusterpb.MigrateSessionResponse{ClientAddr: n.clientAdvertiseAddr()}, nil
+}
+
+// resumeSession restores the migrated session associated with the token to
+// the session, returns false if the token is invalid or expired.
+func (n *Node) resumeSession(s *session.Session, token string) bool {
+	n.mu.Lock()
+	m, ok := n.migrated[token]
+	delete(n.migrated, token)
+	n.mu.Unlock()
+	if !ok {
+		return false
+	}
+	m.timer.Stop()
+
+	if m.uid > 0 {
+		s.Bind(m.uid)
+	}
+	s.Restore(m.attributes)
+	for _, name := range m.groups {
+		g := membership.Lookup(name)
+		if g == nil {
+			log.Println(fmt.Sprintf("Group %s not found when resuming session, UID=%d", name, m.uid))
+			continue
+		}
+		if err := g.Add(s); err != nil {
+			log.Println(fmt.Sprintf("Add resumed session to group %s failed: %v", name, err))
+		}
+	}
+	session.Lifetime.Publish(session.Event{Type: session.EventDataSynced, Session: s})
+	return true
+}
+
+// clientAdvertiseAddr returns the client address which can be dialed by the
+// clients, the host of service address will be used if the client address
+// does not contain a host.
+func (n *Node) clientAdvertiseAddr() string {
+	host, port, err := net.SplitHostPort(n.ClientAddr)
+	if err != nil {
+		return n.ClientAddr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		if h, _, err := net.SplitHostPort(n.ServiceAddr); err == nil {
+			host = h
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func newMigrateRequest(s *session.Session) (*clusterpb.MigrateSessionRequest, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	return &clusterpb.MigrateSessionRequest{
+		Uid:        s.UID(),
+		Token:      hex.EncodeToString(token),
+		Attributes: encodeAttributes(s.State()),
+		Groups:     membership.Groups(s),
+	}, nil
+}
+
+func encodeAttributes(data map[string]interface{}) map[string][]byte {
+	attributes := make(map[string][]byte, len(data))
+	for k, v := range data {
+		buf := &bytes.Buffer{}
+		if err := gob.NewEncoder(buf).Encode(&v); err != nil {
+			log.Println(fmt.Sprintf("Session attribute %s can not be migrated: %v", k, err))
+			continue
+		}
+		attributes[k] = buf.Bytes()
+	}
+	return attributes
+}
+
+func decodeAttributes(attributes map[string][]byte) map[string]interface{} {
+	data := make(map[string]interface{}, len(attributes))
+	for k, b := range attributes {
+		var v interface{}
+		if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v); err != nil {
+			log.Println(fmt.Sprintf("Session attribute %s can not be restored: %v", k, err))
+			continue
+		}
+		data[k] = v
+	}
+	return data
+}
+
+// redirect sends a redirect packet to the client through the send queue, the
+// client should reconnect to the address and resume the session with the token
+// in handshake.
+func (a *agent) redirect(addr, token string) error {
+	data, err := json.Marshal(map[string]string{"addr": addr, "token": token})
+	if err != nil {
+		return err
+	}
+	p, err := codec.Encode(packet.Redirect, data)
+	if err != nil {
+		return err
+	}
+	return a.sendPacket(p, session.PriorityCritical)
+}
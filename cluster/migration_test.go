@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/internal/membership"
+	"github.com/lonng/nano/session"
+)
+
+type testGroup struct {
+	sessions []*session.Session
+}
+
+func (g *testGroup) Add(s *session.Session) error {
+	g.sessions = append(g.sessions, s)
+	return nil
+}
+
+func TestNode_MigrateSession(t *testing.T) {
+	g := &testGroup{}
+	membership.Register("migration-test", g)
+	defer membership.Unregister("migration-test", g)
+
+	source := session.New(nil)
+	source.Bind(1000)
+	source.Set("level", 10)
+	source.Set("name", "nano")
+	source.Set("conn", make(chan int)) // can not be migrated
+	membership.Join(source, "migration-test")
+
+	req, err := newMigrateRequest(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := &Node{Options: Options{ClientAddr: ":3250"}, ServiceAddr: "10.0.0.2:3251"}
+	resp, err := n.MigrateSession(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ClientAddr != "10.0.0.2:3250" {
+		t.Fatalf("expect: 10.0.0.2:3250, got: %s", resp.ClientAddr)
+	}
+
+	target := session.New(nil)
+	if !n.resumeSession(target, req.Token) {
+		t.Fatal("expect session to be resumed")
+	}
+	if target.UID() != 1000 || target.Int("level") != 10 || target.String("name") != "nano" {
+		t.Fatalf("unexpected session state, UID=%d, data=%v", target.UID(), target.State())
+	}
+	if target.HasKey("conn") {
+		t.Fatal("expect unsupported attribute to be skipped")
+	}
+	if len(g.sessions) != 1 || g.sessions[0] != target {
+		t.Fatal("expect session to rejoin the group")
+	}
+	if n.resumeSession(session.New(nil), req.Token) {
+		t.Fatal("expect token to be used only once")
+	}
+}
+
+func TestNode_MigrateSessionExpired(t *testing.T) {
+	n := &Node{Options: Options{ClientAddr: ":3250", MigrationWindow: 10 * time.Millisecond}}
+	req := &clusterpb.MigrateSessionRequest{Uid: 1, Token: "token"}
+	if _, err := n.MigrateSession(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n.resumeSession(session.New(nil), "token") {
+		t.Fatal("expect expired session to be cleaned up")
+	}
+
+	backend := &Node{}
+	if _, err := backend.MigrateSession(context.Background(), req); err != ErrMigrationRefused {
+		t.Fatalf("expect: %v, got: %v", ErrMigrationRefused, err)
+	}
+}
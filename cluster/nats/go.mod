@@ -0,0 +1,12 @@
+module github.com/lonng/nano/cluster/nats
+
+go 1.12
+
+require (
+	github.com/golang/protobuf v1.3.1
+	github.com/lonng/nano v0.0.0
+	github.com/nats-io/nats.go v1.31.0
+	google.golang.org/grpc v1.20.1
+)
+
+replace github.com/lonng/nano => ../..
@@ -0,0 +1,246 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+// Package nats implements the cluster.RPCTransport over NATS request/reply, the
+// nodes connect to the NATS servers only, instead of a full mesh of gRPC
+// connections between each other.
+package nats
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lonng/nano/internal/log"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/grpc"
+)
+
+const (
+	// DefaultSubjectPrefix is the default prefix of the subjects of members
+	DefaultSubjectPrefix = "nano.rpc"
+	// DefaultTimeout is the default timeout of the RPCs whose context has no
+	// deadline
+	DefaultTimeout = 10 * time.Second
+)
+
+const (
+	statusOK    byte = 0
+	statusError byte = 1
+)
+
+// ErrClosedTransport is returned when the transport has been closed
+var ErrClosedTransport = errors.New("nats transport closed")
+
+// Option represents an option of Transport
+type Option func(t *Transport)
+
+// WithSubjectPrefix sets the prefix of the subjects, e.g: to run several clusters
+// with one NATS cluster
+func WithSubjectPrefix(prefix string) Option {
+	return func(t *Transport) {
+		t.prefix = prefix
+	}
+}
+
+// WithTimeout sets the timeout of the RPCs whose context has no deadline, the
+// RPCs of NATS require a deadline
+func WithTimeout(timeout time.Duration) Option {
+	return func(t *Transport) {
+		t.timeout = timeout
+	}
+}
+
+// Transport is a cluster.RPCTransport over NATS, each member subscribes to the
+// subject <prefix>.<encoded service address>.> and the RPCs are sent to the
+// subject <prefix>.<encoded service address>.<service>.<method> as requests.
+// The connection is owned by the caller, which is not closed by Close.
+type Transport struct {
+	conn    *nats.Conn
+	prefix  string
+	timeout time.Duration
+
+	mu       sync.RWMutex
+	closed   bool
+	methods  map[string]method // full method name map to method
+	subjects map[string]string // service address map to subject prefix
+	sub      *nats.Subscription
+}
+
+// method is a method of the registered service
+type method struct {
+	impl    interface{}
+	handler func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error)
+}
+
+// NewTransport returns a Transport using the NATS connection
+func NewTransport(conn *nats.Conn, opts ...Option) *Transport {
+	t := &Transport{
+		conn:     conn,
+		prefix:   DefaultSubjectPrefix,
+		timeout:  DefaultTimeout,
+		methods:  map[string]method{},
+		subjects: map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// RegisterService implements the cluster.RPCTransport interface
+func (t *Transport) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, m := range desc.Methods {
+		name := "/" + desc.ServiceName + "/" + m.MethodName
+		t.methods[name] = method{impl: impl, handler: m.Handler}
+	}
+}
+
+// Serve implements the cluster.RPCTransport interface, the requests are handled
+// concurrently like gRPC
+func (t *Transport) Serve(addr string) error {
+	subject := t.subject(addr)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosedTransport
+	}
+	sub, err := t.conn.Subscribe(subject+".>", func(msg *nats.Msg) {
+		go t.handle(strings.TrimPrefix(msg.Subject, subject+"."), msg)
+	})
+	if err != nil {
+		return err
+	}
+	t.sub = sub
+	// the RPCs can be received once the subscription is flushed to the server
+	return t.conn.Flush()
+}
+
+// Invoke implements the cluster.RPCTransport interface
+func (t *Transport) Invoke(ctx context.Context, addr, method string, in, out proto.Message) error {
+	t.mu.RLock()
+	closed := t.closed
+	t.mu.RUnlock()
+	if closed {
+		return ErrClosedTransport
+	}
+
+	data, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	// "/clusterpb.Member/HandleRequest" => "clusterpb.Member.HandleRequest"
+	subject := t.subject(addr) + "." + strings.Replace(strings.TrimPrefix(method, "/"), "/", ".", 1)
+	resp, err := t.conn.RequestWithContext(ctx, subject, data)
+	if err != nil {
+		return err
+	}
+	if len(resp.Data) == 0 {
+		return fmt.Errorf("nats transport: empty response of %s", method)
+	}
+	if resp.Data[0] == statusError {
+		return errors.New(string(resp.Data[1:]))
+	}
+	return proto.Unmarshal(resp.Data[1:], out)
+}
+
+// Close implements the cluster.RPCTransport interface
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	if t.sub != nil {
+		return t.sub.Unsubscribe()
+	}
+	return nil
+}
+
+// subject returns the subject prefix of the member, the service address is
+// encoded since the dots separate the tokens of subjects
+func (t *Transport) subject(addr string) string {
+	t.mu.RLock()
+	subject, ok := t.subjects[addr]
+	t.mu.RUnlock()
+	if ok {
+		return subject
+	}
+
+	subject = t.prefix + "." + base64.RawURLEncoding.EncodeToString([]byte(addr))
+	t.mu.Lock()
+	t.subjects[addr] = subject
+	t.mu.Unlock()
+	return subject
+}
+
+// handle calls the method named by the suffix of subject, e.g: the suffix
+// "clusterpb.Member.HandleRequest" calls "/clusterpb.Member/HandleRequest"
+func (t *Transport) handle(suffix string, msg *nats.Msg) {
+	name := suffix
+	if i := strings.LastIndex(suffix, "."); i >= 0 {
+		name = "/" + suffix[:i] + "/" + suffix[i+1:]
+	}
+
+	t.mu.RLock()
+	m, ok := t.methods[name]
+	t.mu.RUnlock()
+
+	var resp []byte
+	if !ok {
+		resp = append([]byte{statusError}, "nats transport: unknown method "+name...)
+	} else {
+		out, err := m.handler(m.impl, context.Background(), func(v interface{}) error {
+			return proto.Unmarshal(msg.Data, v.(proto.Message))
+		}, nil)
+		if err == nil {
+			var data []byte
+			data, err = proto.Marshal(out.(proto.Message))
+			resp = append([]byte{statusOK}, data...)
+		}
+		if err != nil {
+			resp = append([]byte{statusError}, err.Error()...)
+		}
+	}
+
+	if msg.Reply == "" {
+		return
+	}
+	if err := msg.Respond(resp); err != nil {
+		log.Println(fmt.Sprintf("Respond %s failed: %v", name, err))
+	}
+}
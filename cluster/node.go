@@ -22,44 +22,104 @@ package cluster
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/lonng/nano/cluster/clusterpb"
 	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/encryption"
 	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/fragment"
 	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/membership"
 	"github.com/lonng/nano/internal/message"
 	"github.com/lonng/nano/metrics"
 	"github.com/lonng/nano/pipeline"
+	"github.com/lonng/nano/ratelimit"
 	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nano/service"
 	"github.com/lonng/nano/session"
 	"google.golang.org/grpc"
 )
 
 // Options contains some configurations for current node
 type Options struct {
-	Pipeline         pipeline.Pipeline
-	IsMaster         bool
-	AdvertiseAddr    string
-	RetryInterval    time.Duration
-	ClientAddr       string
-	Components       *component.Components
-	Label            string
-	IsWebsocket      bool
-	TSLCertificate   string
-	TSLKey           string
-	FuncBefore       func(session *session.Session, msg interface{}) bool
-	FuncAfter        func(session *session.Session, msg interface{}) bool
-	RateLimit        *env.RateLimitingMaker
-	MetricsReporters []metrics.Reporter
-	MetricsPeriod    time.Duration
+	Pipeline            pipeline.Pipeline
+	IsMaster            bool
+	AdvertiseAddr       string
+	RetryInterval       time.Duration
+	ClientAddr          string
+	Components          *component.Components
+	Label               string
+	IsWebsocket         bool
+	TSLCertificate      string
+	TSLKey              string
+	FuncBefore          func(session *session.Session, msg interface{}) bool
+	FuncAfter           func(session *session.Session, msg interface{}) bool
+	RateLimit           *env.RateLimitingMaker
+	MetricsReporters    []metrics.Reporter
+	MetricsPeriod       time.Duration
+	KeyExchange         encryption.KeyExchange
+	MaxSessions         int
+	KCP                 *KCPConfig
+	QUIC                *QUICConfig
+	RateLimitRules      ratelimit.Rules
+	RateLimiter         ratelimit.Limiter
+	MigrationWindow     time.Duration
+	AdminAddr           string
+	RequestLogger       RequestLogger
+	ConsistentHash      bool
+	HashReplicas        int
+	ReconnectBase       time.Duration
+	ReconnectJitter     time.Duration
+	MetricsFlush        *metrics.FlushConfig
+	SlowClientTimeout   time.Duration
+	ShutdownTimeout     time.Duration
+	MaxConnectionsPerIP int
+	DuplicateLogin      DuplicateLoginPolicy
+	ReadBufferSize      int
+	WriteBufferSize     int
+	ReliableRetries     int
+	ReliableBackoff     time.Duration
+	MaxFrameSize        int
+	FragmentTimeout     time.Duration
+	SessionIDGenerator  func() int64
+	PushFallback        OfflineDelivery
+	SessionAffinity     bool
+	WorkerPoolSize      int
+	WSCompression       *WSCompressionConfig
+	WSSubprotocols      []string
+	ProxyProtocol       bool
+	ProxyHeaderTimeout  time.Duration
+	Listeners           []ListenerConfig
+	MaxConnections      int
+	AcceptRate          float64
+	AcceptBurst         int
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	IdleTimeout         time.Duration
+	ShutdownNotice      *ShutdownNotice
+	Acceptors           []Acceptor
+	TLSConfig           *tls.Config
+	SendQueueSize       int
+	SendQueuePolicy     OverflowPolicy
+	HTTPFallbackPath    string
+	SessionStore        session.Store
+	DuplicateLoginHook  func(s *session.Session, uid int64) DuplicateLoginPolicy
+	ResumeTTL           time.Duration
+	ResumeBuffer        int
+	ResumeSecret        []byte
+	PersistInterval     time.Duration
+	Registry            Registry
+	RPCTransport        RPCTransport
 }
 
 // Node represents a node in nano cluster, which will contains a group of services.
@@ -74,22 +134,63 @@ type Node struct {
 	server    *grpc.Server
 	rpcClient *rpcClient
 
-	mu         sync.RWMutex
-	sessions   map[int64]*session.Session
-	httpServer []*http.Server
-	running    bool
-	listener   net.Listener
+	activeSessions int64    // number of client sessions served by current node
+	clients        sync.Map // number of client sessions of each transport
+	ipConns        sync.Map // number of client connections of each IP, *int64
+	openConns      int64    // number of connections accepted by the limited listeners
+	draining       int32    // current node is draining, new connections will be rejected
+	running        int32    // current node is serving, the accept loops exit once it is cleared
+	inflight       inflight // handlers dispatched but not completed
+
+	mu          sync.RWMutex
+	sessions    map[int64]*session.Session
+	migrated    map[string]*migratedSession // migrated sessions keyed by resume token
+	suspended   map[int64]*suspendedSession // disconnected sessions waiting to be resumed
+	userIndex   *userIndex                  // sessions of current node keyed by uid
+	userUpdates chan userUpdate             // uid bindings to be synchronized to master
+	usersDie    chan struct{}               // stops synchronizing the uid bindings
+	httpServer  []*http.Server
+	listeners   []net.Listener
+	wsOnce      sync.Once // registers the WebSocket handler once
+	kcpConvs    convTable // conversation ids of the live KCP sessions
+	httpConns   sync.Map  // connections of the HTTP fallback keyed by id, *httpConn
+
+	sysCollector *metrics.SysCollector // samples the runtime metrics if reporters present
+	acceptBucket tokenBucket           // throttles the accepted connections at AcceptRate
+	reaperStop   chan struct{}         // stops the reaper of idle sessions
+	flushStop    chan struct{}         // stops the flush of persistent attributes
+	storeOps     chan func()           // operations of the session store run in order
+	tlsOnce      sync.Once             // loads the TLS configuration of client listeners
+	resumeKey    []byte                // signs the resume tokens of sessions
+	tlsConfig    *tls.Config
+	tlsErr       error
+	certReloader *CertReloader   // reloads the certificate files on SIGHUP
+	stopWatch    func()          // stops watching the members of registry
+	hooks        []*session.Hook // lifetime hooks removed on shutdown
+}
+
+// isRunning reports whether current node is serving
+func (n *Node) isRunning() bool {
+	return atomic.LoadInt32(&n.running) == 1
 }
 
 func (n *Node) Startup() error {
 	if n.ServiceAddr == "" {
 		return errors.New("service address cannot be empty in master node")
 	}
-	n.running = true
+	if n.MaxFrameSize > 0 {
+		if _, err := fragment.NewFragmenter(n.MaxFrameSize); err != nil {
+			return err
+		}
+	}
+	if n.SessionIDGenerator != nil {
+		service.Connections.SetSessionIDGenerator(n.SessionIDGenerator)
+	}
+	atomic.StoreInt32(&n.running, 1)
 	n.sessions = map[int64]*session.Session{}
 	n.cluster = newCluster(n)
 	n.handler = NewHandler(n, n.Pipeline)
-	n.listener = nil
+	n.listeners = nil
 	components := n.Components.List()
 	for _, c := range components {
 		err := n.handler.register(c.Comp, c.Opts)
@@ -102,6 +203,14 @@ func (n *Node) Startup() error {
 	if err := n.initNode(); err != nil {
 		return err
 	}
+	if err := n.initListeners(); err != nil {
+		return err
+	}
+	if err := n.initResume(); err != nil {
+		return err
+	}
+	n.initUsers()
+	n.registerHealthChecks()
 
 	// Initialize all components
 	for _, c := range components {
@@ -114,11 +223,15 @@ func (n *Node) Startup() error {
 	if n.ClientAddr != "" {
 		go func() {
 			if n.IsWebsocket {
-				if len(n.TSLCertificate) != 0 {
-					n.listenAndServeWSTLS()
+				if n.secure() {
+					n.listenAndServeWSTLS(n.ClientAddr)
 				} else {
-					n.listenAndServeWS()
+					n.listenAndServeWS(n.ClientAddr)
 				}
+			} else if n.KCP != nil {
+				n.listenAndServeKCP(n.ClientAddr)
+			} else if n.QUIC != nil {
+				n.listenAndServeQUIC(n.ClientAddr)
 			} else {
 				n.listenAndServe(n.ClientAddr)
 			}
@@ -136,19 +249,83 @@ func (n *Node) Startup() error {
 				n.listenAndServe(addr)
 			}()
 		}
-
+	}
+	for _, l := range n.Listeners {
+		go n.serveListener(l)
+	}
+	for _, a := range n.Acceptors {
+		go n.serveAcceptor(a)
+	}
+	if n.ClientAddr != "" || len(n.Listeners) > 0 || len(n.Acceptors) > 0 {
 		n.startMetrics()
+		n.startReaper()
+		n.startFlusher()
+	}
+
+	if n.AdminAddr != "" {
+		go n.listenAndServeAdmin()
 	}
 
 	return nil
 }
 
+// FlushMetrics flushes the current metrics of reporters if MetricsFlush is set,
+// which is called before the process exits on an unrecovered panic
+func (n *Node) FlushMetrics() {
+	if n.MetricsFlush == nil {
+		return
+	}
+	metrics.Flush(n.MetricsReporters, *n.MetricsFlush)
+}
+
+// FlushOnPanic flushes the metrics of node before the panic of current goroutine
+// crashes the process, and panics again. It has to be deferred directly by the
+// goroutines, e.g: defer cluster.FlushOnPanic(node)
+func FlushOnPanic(n *Node) {
+	if err := recover(); err != nil {
+		n.FlushMetrics()
+		panic(err)
+	}
+}
+
+// flushOnPanic intercepts the gRPC calls, so the metrics are flushed if the
+// handlers of the member and master services panic
+func (n *Node) flushOnPanic(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	defer FlushOnPanic(n)
+	return handler(ctx, req)
+}
+
 func (n *Node) startMetrics() {
 	if len(n.Options.MetricsReporters) == 0 {
 		return
 	}
 
-	go metrics.ReportSysMetrics(n.Options.MetricsReporters, n.Options.MetricsPeriod)
+	n.sysCollector = metrics.NewSysCollector(n.Options.MetricsReporters, n.Options.MetricsPeriod, func() int64 {
+		return atomic.LoadInt64(&n.activeSessions)
+	})
+	n.sysCollector.AddGauge(metrics.SchedulerQueueLength, func() float64 {
+		return float64(scheduler.QueueLen())
+	})
+	n.sysCollector.AddGauge(metrics.SendQueuePending, func() float64 {
+		pending, _ := n.sendQueueStats()
+		return float64(pending)
+	})
+	n.sysCollector.AddGauge(metrics.SendQueueSaturation, func() float64 {
+		_, saturation := n.sendQueueStats()
+		return saturation
+	})
+	n.sysCollector.AddFunc(func(reporters []metrics.Reporter) {
+		metrics.ReportGroups(reporters, membership.GroupSizes())
+		metrics.ReportBoundSessions(reporters, n.sessionsPerUID())
+		metrics.ReportSendQueueDepths(reporters, n.sendQueueDepths())
+	})
+	n.sysCollector.Start()
+}
+
+// standalone reports whether current node runs without a cluster, i.e. neither
+// a master nor a registry is present
+func (n *Node) standalone() bool {
+	return !n.IsMaster && n.AdvertiseAddr == "" && n.Registry == nil
 }
 
 func (n *Node) Handler() *LocalHandler {
@@ -158,29 +335,19 @@ func (n *Node) Handler() *LocalHandler {
 func (n *Node) initNode() error {
 	// Current node is not master server and does not contains master
 	// address, so running in singleton mode
-	if !n.IsMaster && n.AdvertiseAddr == "" {
+	if n.standalone() {
 		return nil
 	}
 
-	listener, err := net.Listen("tcp", n.ServiceAddr)
-	if err != nil {
+	if err := n.serveRPC(); err != nil {
 		return err
 	}
 
-	// Initialize the gRPC server and register service
-	n.server = grpc.NewServer()
-	n.rpcClient = newRPCClient()
-	clusterpb.RegisterMemberServer(n.server, n)
-
-	go func() {
-		err := n.server.Serve(listener)
-		if err != nil {
-			log.Fatalf("Start current node failed: %v", err)
-		}
-	}()
+	if n.Registry != nil {
+		return n.initRegistry()
+	}
 
 	if n.IsMaster {
-		clusterpb.RegisterMasterServer(n.server, n.cluster)
 		member := &Member{
 			isMaster: true,
 			memberInfo: &clusterpb.MemberInfo{
@@ -192,11 +359,10 @@ func (n *Node) initNode() error {
 		n.cluster.members = append(n.cluster.members, member)
 		n.cluster.setRpcClient(n.rpcClient)
 	} else {
-		pool, err := n.rpcClient.getConnPool(n.AdvertiseAddr)
+		client, err := n.rpcClient.masterClient(n.AdvertiseAddr)
 		if err != nil {
 			return err
 		}
-		client := clusterpb.NewMasterClient(pool.Get())
 		request := &clusterpb.RegisterRequest{
 			MemberInfo: &clusterpb.MemberInfo{
 				Label:       n.Label,
@@ -221,9 +387,13 @@ func (n *Node) initNode() error {
 }
 
 // Shutdowns all components registered by application, that
-// call by reverse order against register
+// call by reverse order against register. The node drains the client sessions
+// before closing them: new connections are refused, the ShutdownNotice is pushed
+// to the sessions if present, and the in-flight handlers are waited for up to
+// ShutdownTimeout.
 func (n *Node) Shutdown() {
-	n.running = false
+	atomic.StoreInt32(&n.running, 0)
+	atomic.StoreInt32(&n.draining, 1)
 	// reverse call `BeforeShutdown` hooks
 	components := n.Components.List()
 	length := len(components)
@@ -231,24 +401,63 @@ func (n *Node) Shutdown() {
 		components[i].Comp.BeforeShutdown()
 	}
 
-	if n.listener != nil {
-		n.listener.Close()
+	n.closeListeners()
+	n.closeAcceptors()
+
+	// wait for the in-flight handlers, so that their responses can be
+	// delivered before the sessions are closed
+	timeout := n.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	n.notifyShutdown(ctx)
+	if err := n.WaitForIdle(ctx); err != nil {
+		log.Println(fmt.Sprintf("Wait for %d in-flight handlers timeout", n.inflight.count()))
 	}
-	for _, v := range n.httpServer {
+	cancel()
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	n.closeSessions(ctx)
+	cancel()
+	n.mu.RLock()
+	servers := n.httpServer
+	n.mu.RUnlock()
+	for _, v := range servers {
 		v.Shutdown(context.Background())
 	}
 	// reverse call `Shutdown` hooks
 	for i := length - 1; i >= 0; i-- {
 		components[i].Comp.Shutdown()
 	}
+	if n.handler != nil && n.handler.workers != nil {
+		n.handler.workers.close()
+	}
+	if n.sysCollector != nil {
+		n.sysCollector.Stop()
+	}
+	n.stopReaper()
+	n.stopFlusher()
+	if n.certReloader != nil {
+		n.certReloader.Stop()
+	}
+	// close the reporters, e.g: the prometheus reporter pushes the final metrics
+	// to the pushgateway in push mode
+	for _, r := range n.MetricsReporters {
+		if c, ok := r.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Println("Close metrics reporter failed", err)
+			}
+		}
+	}
 
-	if !n.IsMaster && n.AdvertiseAddr != "" {
-		pool, err := n.rpcClient.getConnPool(n.AdvertiseAddr)
+	if n.Registry != nil {
+		n.closeRegistry()
+	} else if !n.IsMaster && n.AdvertiseAddr != "" {
+		client, err := n.rpcClient.masterClient(n.AdvertiseAddr)
 		if err != nil {
 			log.Println("Retrieve master address error", err)
 			goto EXIT
 		}
-		client := clusterpb.NewMasterClient(pool.Get())
 		request := &clusterpb.UnregisterRequest{
 			ServiceAddr: n.ServiceAddr,
 		}
@@ -263,102 +472,180 @@ EXIT:
 	if n.server != nil {
 		n.server.GracefulStop()
 	}
+	if n.RPCTransport != nil && n.rpcClient != nil {
+		if err := n.RPCTransport.Close(); err != nil {
+			log.Println("Close RPC transport failed", err)
+		}
+	}
+	n.closeUsers()
+}
+
+// serveRPC serves the Member service, and the Master service if current node is
+// master, by gRPC or the RPCTransport if present
+func (n *Node) serveRPC() error {
+	n.rpcClient = newRPCClient()
+	if t := n.RPCTransport; t != nil {
+		n.rpcClient.transport = t
+		t.RegisterService(clusterpb.MemberServiceDesc(), n)
+		if n.IsMaster && n.Registry == nil {
+			t.RegisterService(clusterpb.MasterServiceDesc(), n.cluster)
+		}
+		return t.Serve(n.ServiceAddr)
+	}
+
+	listener, err := net.Listen("tcp", n.ServiceAddr)
+	if err != nil {
+		return err
+	}
+
+	// Initialize the gRPC server and register service
+	n.server = grpc.NewServer(grpc.UnaryInterceptor(n.flushOnPanic))
+	clusterpb.RegisterMemberServer(n.server, n)
+	if n.IsMaster && n.Registry == nil {
+		clusterpb.RegisterMasterServer(n.server, n.cluster)
+	}
+
+	go func() {
+		err := n.server.Serve(listener)
+		if err != nil {
+			log.Fatalf("Start current node failed: %v", err)
+		}
+	}()
+	return nil
 }
 
 // Enable current server accept connection
 func (n *Node) listenAndServe(addr string) {
-	listenConfig := net.ListenConfig{
-		Control: Control,
+	ln, err := n.listen(addr)
+	if err != nil {
+		log.Fatal(err.Error())
 	}
-
-	listener, err := listenConfig.Listen(context.Background(), "tcp", addr)
+	conf, err := n.serverTLSConfig()
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	n.listener = listener
+	listener := n.proxied(n.limited(ln))
+	if conf != nil {
+		listener = tls.NewListener(listener, conf)
+	}
+	n.addListener(listener)
 
 	defer listener.Close()
-	for n.running {
+	for n.isRunning() {
 		conn, err := listener.Accept()
 		if err != nil {
 			log.Println(err.Error())
 			continue
 		}
 
-		go n.handler.handle(conn)
+		go n.handler.handle(conn, transportTCP)
 	}
 }
 
-func (n *Node) listenAndServeWS() {
-	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin:     env.CheckOrigin,
+// wsUpgrader returns the upgrader of the WebSocket acceptor, permessage-deflate
+// is negotiated if WSCompression is set
+func (n *Node) wsUpgrader() websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		CheckOrigin:       env.CheckOrigin,
+		EnableCompression: n.WSCompression != nil,
+	}
+}
+
+// negotiateSubprotocol selects the subprotocol among the proposed ones, the
+// subprotocols naming the protocol versions are preferred, and then the first
+// of WSSubprotocols proposed by the client. The version is zero if it will be
+// negotiated in handshake, and false is returned if none is supported.
+func (n *Node) negotiateSubprotocol(proposed []string) (string, int, bool) {
+	if subprotocol, version := message.NegotiateSubprotocol(proposed); version > 0 {
+		return subprotocol, version, true
+	}
+	for _, s := range n.WSSubprotocols {
+		for _, p := range proposed {
+			if p == s {
+				return s, 0, true
+			}
+		}
 	}
+	return "", 0, false
+}
 
-	http.HandleFunc("/"+strings.TrimPrefix(env.WSPath, "/"), func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
+// serveWS returns the handler which upgrades the HTTP requests to WebSocket
+// connections. If the client proposes subprotocols, the highest protocol version
+// proposed is selected and responded, otherwise the first of WSSubprotocols, and
+// the upgrade is rejected with 400 if none of the proposed subprotocols is
+// supported. The clients which propose nothing declare the protocol version in
+// handshake.
+func (n *Node) serveWS(upgrader websocket.Upgrader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			header  http.Header
+			version int
+		)
+		if proposed := websocket.Subprotocols(r); len(proposed) > 0 {
+			subprotocol, v, ok := n.negotiateSubprotocol(proposed)
+			if !ok {
+				log.Println(fmt.Sprintf("Upgrade failure, URI=%s, Error=unsupported subprotocols %v", r.RequestURI, proposed))
+				http.Error(w, "unsupported subprotocol", http.StatusBadRequest)
+				return
+			}
+			version = v
+			header = http.Header{"Sec-Websocket-Protocol": []string{subprotocol}}
+		}
+
+		conn, err := upgrader.Upgrade(w, r, header)
 		if err != nil {
 			log.Println(fmt.Sprintf("Upgrade failure, URI=%s, Error=%s", r.RequestURI, err.Error()))
 			return
 		}
 
-		n.handler.handleWS(conn)
-	})
+		n.handler.handleWS(conn, version)
+	}
+}
+
+func (n *Node) listenAndServeWS(addr string) {
+	n.handleWS()
 
 	// if err := http.ListenAndServe(n.ClientAddr, nil); err != nil {
 	// 	log.Fatal(err.Error())
 	// }
 
-	listenConfig := net.ListenConfig{
-		Control: Control,
-	}
-	server := &http.Server{Addr: n.ClientAddr, Handler: nil}
-	ln, err := listenConfig.Listen(context.Background(), "tcp", server.Addr)
+	server := &http.Server{Addr: addr, Handler: nil}
+	ln, err := n.listen(addr)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	n.httpServer = append(n.httpServer, server)
-	err = server.Serve(ln)
+	n.addServer(server)
+	err = server.Serve(n.proxied(n.limited(ln)))
 	if err != nil && err != http.ErrServerClosed {
 		log.Fatal(err.Error())
 	}
 }
 
-func (n *Node) listenAndServeWSTLS() {
-	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin:     env.CheckOrigin,
-	}
-
-	http.HandleFunc("/"+strings.TrimPrefix(env.WSPath, "/"), func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Println(fmt.Sprintf("Upgrade failure, URI=%s, Error=%s", r.RequestURI, err.Error()))
-			return
-		}
-
-		n.handler.handleWS(conn)
-	})
+func (n *Node) listenAndServeWSTLS(addr string) {
+	n.handleWS()
 
 	// if err := http.ListenAndServe(n.ClientAddr, nil); err != nil {
 	// 	log.Fatal(err.Error())
 	// }
 
-	listenConfig := net.ListenConfig{
-		Control: Control,
+	server := &http.Server{Addr: addr, Handler: nil}
+	ln, err := n.listen(addr)
+	if err != nil {
+		log.Fatal(err.Error())
 	}
-	server := &http.Server{Addr: n.ClientAddr, Handler: nil}
-	ln, err := listenConfig.Listen(context.Background(), "tcp", server.Addr)
+
+	conf, err := n.serverTLSConfig()
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	server.TLSConfig = conf
 
-	n.httpServer = append(n.httpServer, server)
+	n.addServer(server)
 	// 	if err := http.ListenAndServeTLS(n.ClientAddr, n.TSLCertificate, n.TSLKey, nil); err != nil {
-	err = server.ServeTLS(ln, n.TSLCertificate, n.TSLKey)
+	err = server.ServeTLS(n.proxied(n.limited(ln)), "", "")
 	if err != nil && err != http.ErrServerClosed {
 		log.Fatal(err.Error())
 	}
@@ -389,9 +676,92 @@ func (n *Node) listenAndServeWSTLS() {
 
 func (n *Node) storeSession(s *session.Session) {
 	n.mu.Lock()
+	old, found := n.sessions[s.ID()]
 	n.sessions[s.ID()] = s
-	metrics.ReportNumberOfConnectedClients(n.Options.MetricsReporters, int64(len(n.sessions)))
 	n.mu.Unlock()
+
+	// the session ids generated by the custom generator must be unique
+	if found && old != s {
+		log.Println(fmt.Sprintf("Duplicated session id %d, the session id generator should generate unique ids", s.ID()))
+	}
+}
+
+// acquireSession reserves a slot for a new client session, false will be
+// returned if the node has reached the MaxSessions limit.
+func (n *Node) acquireSession(transport string) bool {
+	count := atomic.AddInt64(&n.activeSessions, 1)
+	if n.MaxSessions > 0 && count > int64(n.MaxSessions) {
+		atomic.AddInt64(&n.activeSessions, -1)
+		return false
+	}
+	metrics.ReportSessionCapacity(n.MetricsReporters, count, int64(n.MaxSessions))
+	n.reportConnectedClients(transport, 1)
+	return true
+}
+
+// acquireIPConn reserves a connection of the IP of addr, false will be returned
+// if the IP has reached the MaxConnectionsPerIP limit. The returned IP should be
+// passed to releaseIPConn once the connection is closed.
+func (n *Node) acquireIPConn(addr net.Addr) (string, bool) {
+	if n.MaxConnectionsPerIP <= 0 || addr == nil {
+		return "", true
+	}
+	if _, ok := addr.(*net.UnixAddr); ok {
+		// the clients of Unix domain sockets are local proxies
+		return "", true
+	}
+	ip := addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	max := int64(n.MaxConnectionsPerIP)
+	for {
+		v, _ := n.ipConns.LoadOrStore(ip, new(int64))
+		count := v.(*int64)
+		for {
+			c := atomic.LoadInt64(count)
+			if c < 0 {
+				// the counter is being removed by releaseIPConn, retry with a new one
+				break
+			}
+			if c >= max {
+				return ip, false
+			}
+			if atomic.CompareAndSwapInt64(count, c, c+1) {
+				return ip, true
+			}
+		}
+	}
+}
+
+// releaseIPConn releases the connection reserved by acquireIPConn, the counter
+// of the IP is removed once there is no connection
+func (n *Node) releaseIPConn(ip string) {
+	if ip == "" {
+		return
+	}
+	v, ok := n.ipConns.Load(ip)
+	if !ok {
+		return
+	}
+	count := v.(*int64)
+	if atomic.AddInt64(count, -1) == 0 && atomic.CompareAndSwapInt64(count, 0, -1) {
+		n.ipConns.Delete(ip)
+	}
+}
+
+// releaseSession releases the slot reserved by acquireSession
+func (n *Node) releaseSession(transport string) {
+	count := atomic.AddInt64(&n.activeSessions, -1)
+	metrics.ReportSessionCapacity(n.MetricsReporters, count, int64(n.MaxSessions))
+	n.reportConnectedClients(transport, -1)
+}
+
+// FindSession returns the session of the session id, nil will be returned if
+// the session does not exist
+func (n *Node) FindSession(sid int64) *session.Session {
+	return n.findSession(sid)
 }
 
 func (n *Node) findSession(sid int64) *session.Session {
@@ -401,19 +771,45 @@ func (n *Node) findSession(sid int64) *session.Session {
 	return s
 }
 
+// SessionCount returns the number of the sessions of current node, including the
+// sessions of the remote clients on the backend nodes
+func (n *Node) SessionCount() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.sessions)
+}
+
+// RangeSessions calls f for each session of current node until f returns false,
+// the sessions are collected before calling f, so f can close or bind them
+func (n *Node) RangeSessions(f func(s *session.Session) bool) {
+	n.mu.RLock()
+	sessions := make([]*session.Session, 0, len(n.sessions))
+	for _, s := range n.sessions {
+		sessions = append(sessions, s)
+	}
+	n.mu.RUnlock()
+
+	for _, s := range sessions {
+		if !f(s) {
+			return
+		}
+	}
+}
+
 func (n *Node) findOrCreateSession(sid int64, gateAddr string) (*session.Session, error) {
 	n.mu.RLock()
 	s, found := n.sessions[sid]
 	n.mu.RUnlock()
 	if !found {
-		conns, err := n.rpcClient.getConnPool(gateAddr)
+		gateClient, err := n.rpcClient.memberClient(gateAddr)
 		if err != nil {
 			return nil, err
 		}
 		ac := &acceptor{
 			sid:        sid,
-			gateClient: clusterpb.NewMemberClient(conns.Get()),
-			rpcHandler: n.handler.remoteProcess,
+			gateClient: gateClient,
+			rpcHandler: n.handler.remoteCall,
+			reporters:  n.MetricsReporters,
 			gateAddr:   gateAddr,
 		}
 		s = session.New(ac)
@@ -440,6 +836,12 @@ func (n *Node) HandleRequest(_ context.Context, req *clusterpb.RequestMessage) (
 		Route: req.Route,
 		Data:  req.Data,
 	}
+	if len(n.MetricsReporters) > 0 {
+		metrics.ReportMessageBytes(n.MetricsReporters, req.Route, metrics.DirectionIn, len(req.Data))
+		if ac, ok := s.NetworkEntity().(*acceptor); ok {
+			ac.routes.store(req.Id, req.Route)
+		}
+	}
 	n.handler.localProcess(handler, req.Id, s, msg)
 	return &clusterpb.MemberHandleResponse{}, nil
 }
@@ -458,6 +860,7 @@ func (n *Node) HandleNotify(_ context.Context, req *clusterpb.NotifyMessage) (*c
 		Route: req.Route,
 		Data:  req.Data,
 	}
+	metrics.ReportMessageBytes(n.MetricsReporters, req.Route, metrics.DirectionIn, len(req.Data))
 	n.handler.localProcess(handler, 0, s, msg)
 	return &clusterpb.MemberHandleResponse{}, nil
 }
@@ -470,6 +873,26 @@ func (n *Node) HandlePush(_ context.Context, req *clusterpb.PushMessage) (*clust
 	return &clusterpb.MemberHandleResponse{}, s.Push(req.Route, req.Data)
 }
 
+// HandleMulticast implements the MemberServer interface, the message is encoded
+// once and shared by the sessions, and the ids of the closed sessions are
+// returned as missing
+func (n *Node) HandleMulticast(_ context.Context, req *clusterpb.MulticastMessage) (*clusterpb.UserMessageResponse, error) {
+	resp := &clusterpb.UserMessageResponse{}
+	m := session.NewSharedMessage(req.Route, req.Data)
+	defer m.Release()
+	for _, sid := range req.SessionIds {
+		s := n.findSession(sid)
+		if s == nil {
+			resp.Missing = append(resp.Missing, sid)
+			continue
+		}
+		if err := s.PushShared(m); err != nil {
+			log.Println(err)
+		}
+	}
+	return resp, nil
+}
+
 func (n *Node) HandleResponse(_ context.Context, req *clusterpb.ResponseMessage) (*clusterpb.MemberHandleResponse, error) {
 	s := n.findSession(req.SessionId)
 	if s == nil {
@@ -495,11 +918,14 @@ func (n *Node) SessionClosed(_ context.Context, req *clusterpb.SessionClosedRequ
 	n.mu.Lock()
 	s, found := n.sessions[req.SessionId]
 	delete(n.sessions, req.SessionId)
-	l := len(n.sessions)
 	n.mu.Unlock()
-	metrics.ReportNumberOfConnectedClients(n.Options.MetricsReporters, int64(l))
 	if found {
-		scheduler.PushTask(func() { session.Lifetime.Close(s) })
+		// the reason is absent if the request is sent by the older frontends
+		reason := session.CloseReason(req.Reason)
+		if reason == "" {
+			reason = session.CloseReasonClosed
+		}
+		scheduler.PushTask(func() { session.Lifetime.CloseWithReason(s, reason) })
 	}
 	return &clusterpb.SessionClosedResponse{}, nil
 }
@@ -509,11 +935,9 @@ func (n *Node) CloseSession(_ context.Context, req *clusterpb.CloseSessionReques
 	n.mu.Lock()
 	s, found := n.sessions[req.SessionId]
 	delete(n.sessions, req.SessionId)
-	l := len(n.sessions)
 	n.mu.Unlock()
 	if found {
 		s.Close()
 	}
-	metrics.ReportNumberOfConnectedClients(n.Options.MetricsReporters, int64(l))
 	return &clusterpb.CloseSessionResponse{}, nil
 }
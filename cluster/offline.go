@@ -0,0 +1,79 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lonng/nano/internal/log"
+)
+
+type (
+	// OfflineDelivery delivers the pushes to the users who are not connected,
+	// e.g: the mobile push notifications of APNs or FCM, see FCMDelivery
+	OfflineDelivery interface {
+		Send(userID, title, body string, data map[string]string) error
+	}
+
+	// OfflineNotification is implemented by the push messages which should be
+	// delivered to the offline users, e.g: the chat messages or the invitations.
+	// The other messages, e.g: the position updates, are dropped as usual.
+	OfflineNotification interface {
+		Notification() (title, body string, data map[string]string)
+	}
+)
+
+// pushFallback is called when a push targets a closed session, the message is
+// delivered offline if the user has not connected with another session
+func (n *Node) pushFallback(uid int64, route string, v interface{}) {
+	if n.PushFallback == nil || uid <= 0 {
+		return
+	}
+	if _, ok := v.(OfflineNotification); !ok {
+		return
+	}
+	go func() {
+		_, _, missing, err := n.locateUsers([]int64{uid})
+		if err != nil {
+			log.Println("Locate user failed", uid, err)
+			return
+		}
+		n.deliverOffline(missing, route, v)
+	}()
+}
+
+// deliverOffline sends the message to the offline users via the push fallback
+func (n *Node) deliverOffline(uids []int64, route string, v interface{}) {
+	if n.PushFallback == nil || len(uids) == 0 {
+		return
+	}
+	notification, ok := v.(OfflineNotification)
+	if !ok {
+		return
+	}
+	title, body, data := notification.Notification()
+	for _, uid := range uids {
+		if err := n.PushFallback.Send(strconv.FormatInt(uid, 10), title, body, data); err != nil {
+			log.Println(fmt.Sprintf("Deliver %s to offline user %d failed: %v", route, uid, err))
+		}
+	}
+}
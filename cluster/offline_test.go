@@ -0,0 +1,112 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/serialize"
+	"github.com/lonng/nano/serialize/json"
+	"github.com/lonng/nano/session"
+)
+
+type offlineMail struct {
+	From string
+}
+
+func (m *offlineMail) Notification() (string, string, map[string]string) {
+	return "New mail", "from " + m.From, map[string]string{"from": m.From}
+}
+
+type offlineRecord struct {
+	userID, title, body string
+	data                map[string]string
+}
+
+type offlineRecorder chan offlineRecord
+
+func (r offlineRecorder) Send(userID, title, body string, data map[string]string) error {
+	r <- offlineRecord{userID: userID, title: title, body: body, data: data}
+	return nil
+}
+
+func TestNode_PushFallback(t *testing.T) {
+	defer func(s serialize.Serializer) { env.Serializer = s }(env.Serializer)
+	env.Serializer = json.NewSerializer()
+
+	records := make(offlineRecorder, 4)
+	n := &Node{Options: Options{IsMaster: true, PushFallback: records}, ServiceAddr: "127.0.0.1:0"}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.initUsers()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	a.fallback = n.pushFallback
+	n.storeSession(a.session)
+	if err := a.session.Bind(9101); err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+	session.Lifetime.Close(a.session)
+
+	expect := func(userID string) {
+		t.Helper()
+		select {
+		case r := <-records:
+			if r.userID != userID || r.title != "New mail" || r.body != "from alice" || r.data["from"] != "alice" {
+				t.Fatalf("unexpected offline delivery: %+v", r)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expect the push to be delivered offline to %s", userID)
+		}
+	}
+
+	// the push to the closed session is delivered offline
+	if err := a.session.Push("mail.new", &offlineMail{From: "alice"}); err != ErrBrokenPipe {
+		t.Fatalf("expect: %v, got: %v", ErrBrokenPipe, err)
+	}
+	expect("9101")
+
+	// the messages which are not notifications are dropped
+	if err := a.session.Push("room.move", []byte("x")); err != ErrBrokenPipe {
+		t.Fatalf("expect: %v, got: %v", ErrBrokenPipe, err)
+	}
+	if _, err := n.MultiSend([]int64{9102}, "room.move", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the users never connected are delivered offline
+	if err := n.SendToUser(9102, "mail.new", &offlineMail{From: "alice"}); err != ErrUserNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrUserNotFound, err)
+	}
+	expect("9102")
+
+	select {
+	case r := <-records:
+		t.Fatalf("unexpected offline delivery: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/session"
+)
+
+// startFlusher saves the changed persistent attributes of sessions every
+// PersistInterval, until the node shutdown
+func (n *Node) startFlusher() {
+	if n.PersistInterval <= 0 {
+		return
+	}
+	n.flushStop = make(chan struct{})
+	ticker := env.Clock.NewTicker(n.PersistInterval)
+	go func(stop chan struct{}) {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				flushPersistent()
+			case <-stop:
+				return
+			}
+		}
+	}(n.flushStop)
+}
+
+// stopFlusher stops the periodic flush, and flushes the attributes saved failed
+// by the closed sessions for the last time
+func (n *Node) stopFlusher() {
+	if n.flushStop != nil {
+		close(n.flushStop)
+		n.flushStop = nil
+		flushPersistent()
+	}
+}
+
+func flushPersistent() {
+	if err := session.Flush(); err != nil {
+		log.Println("Flush persistent session attributes failed", err)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nano/session"
+)
+
+type protocolClient struct {
+	conn    net.Conn
+	decoder *codec.Decoder
+	pending []*packet.Packet
+}
+
+func (c *protocolClient) write(typ packet.Type, data []byte) error {
+	p, err := codec.Encode(typ, data)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(p)
+	return err
+}
+
+func (c *protocolClient) read(typ packet.Type) (*packet.Packet, error) {
+	buf := make([]byte, 4096)
+	for {
+		for len(c.pending) > 0 {
+			p := c.pending[0]
+			c.pending = c.pending[1:]
+			if p.Type == typ {
+				return p, nil
+			}
+		}
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		packets, err := c.decoder.Decode(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range packets {
+			// the data of packet is shared with the decoder
+			c.pending = append(c.pending, &packet.Packet{Type: p.Type, Length: p.Length, Data: append([]byte(nil), p.Data...)})
+		}
+	}
+}
+
+// handshake declares version to server if it is positive, and returns the
+// negotiated version
+func (c *protocolClient) handshake(version int) (int, error) {
+	sys := map[string]interface{}{"version": "1.0.0"}
+	if version > 0 {
+		sys["protocol"] = version
+	}
+	data, _ := json.Marshal(map[string]interface{}{"sys": sys})
+	if err := c.write(packet.Handshake, data); err != nil {
+		return 0, err
+	}
+
+	p, err := c.read(packet.Handshake)
+	if err != nil {
+		return 0, err
+	}
+	var resp struct {
+		Sys struct {
+			Protocol int `json:"protocol"`
+		} `json:"sys"`
+	}
+	if err := json.Unmarshal(p.Data, &resp); err != nil {
+		return 0, err
+	}
+	if err := c.write(packet.HandshakeAck, nil); err != nil {
+		return 0, err
+	}
+	if resp.Sys.Protocol == 0 {
+		return message.V1, nil
+	}
+	return resp.Sys.Protocol, nil
+}
+
+// request sends a request with the codec of version, and returns the response
+func (c *protocolClient) request(version int, m *message.Message) (*message.Message, error) {
+	mc := message.CodecOf(version)
+	data, err := mc.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write(packet.Data, data); err != nil {
+		return nil, err
+	}
+	p, err := c.read(packet.Data)
+	if err != nil {
+		return nil, err
+	}
+	return mc.Decode(p.Data)
+}
+
+func TestHandler_ProtocolVersions(t *testing.T) {
+	cache()
+	n := &Node{Options: Options{IsMaster: true}}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	h := NewHandler(n, nil)
+	if err := h.register(&LogComponent{}, []component.Option{component.WithName("Log")}); err != nil {
+		t.Fatal(err)
+	}
+	go scheduler.Sched()
+
+	// a route longer than 255 bytes can only be encoded since V2
+	route := "Log.Echo"
+	padded := route + strings.Repeat(" ", 300)
+	h.localHandlers[padded] = h.localHandlers[route]
+
+	cases := []struct {
+		declared int
+		expect   int
+		route    string
+	}{
+		{0, message.V1, route},
+		{message.V1, message.V1, route},
+		{message.V2, message.V2, padded},
+		{message.V3, message.V3, padded},
+		{message.V3 + 1, message.V3, padded},
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range cases {
+		c := c
+		server, conn := net.Pipe()
+		go h.handle(server, transportTCP)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			client := &protocolClient{conn: conn, decoder: codec.NewDecoder()}
+			version, err := client.handshake(c.declared)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if version != c.expect {
+				t.Errorf("declared: %d, expect: %d, got: %d", c.declared, c.expect, version)
+				return
+			}
+
+			for i := uint64(1); i <= 10; i++ {
+				m, err := client.request(version, &message.Message{
+					Type: message.Request, ID: i, Route: c.route, Data: []byte("hello"),
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if m.Type != message.Response || m.ID != i || string(m.Data) != "hello" {
+					t.Errorf("unexpected response of version %d: %+v", version, m)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNode_WSSubprotocol(t *testing.T) {
+	cache()
+	n := &Node{Options: Options{IsMaster: true}}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.handler = NewHandler(n, nil)
+	server := httptest.NewServer(n.serveWS(websocket.Upgrader{}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// none of the proposed subprotocols is supported
+	_, resp, err := (&websocket.Dialer{Subprotocols: []string{"chat", "nano-v99"}}).Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect the upgrade rejected with 400, got: %v", err)
+	}
+
+	conn, _, err := (&websocket.Dialer{Subprotocols: []string{"chat", "nano-v1", "nano-v2"}}).Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if p := conn.Subprotocol(); p != "nano-v2" {
+		t.Fatalf("expect subprotocol nano-v2, got: %s", p)
+	}
+
+	// the agent has been created once the handshake is responded
+	data, _ := json.Marshal(map[string]interface{}{"sys": map[string]interface{}{"version": "1.0.0"}})
+	p, err := codec.Encode(packet.Handshake, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if len(n.sessions) != 1 {
+		t.Fatalf("expect 1 session, got: %d", len(n.sessions))
+	}
+	for _, s := range n.sessions {
+		if v := s.Protocol(); v != message.V2 {
+			t.Fatalf("expect protocol V2, got: %d", v)
+		}
+	}
+}
+
+func TestNode_WSOptions(t *testing.T) {
+	cache()
+	n := &Node{Options: Options{
+		IsMaster:       true,
+		WSCompression:  &WSCompressionConfig{Threshold: 16, Level: 6},
+		WSSubprotocols: []string{"binary", "chat"},
+	}}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.handler = NewHandler(n, nil)
+	server := httptest.NewServer(n.serveWS(n.wsUpgrader()))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dialer := &websocket.Dialer{Subprotocols: []string{"chat", "binary"}, EnableCompression: true}
+	conn, resp, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if p := conn.Subprotocol(); p != "binary" {
+		t.Fatalf("expect subprotocol binary, got: %s", p)
+	}
+	if ext := resp.Header.Get("Sec-Websocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("expect permessage-deflate negotiated, got: %q", ext)
+	}
+
+	// the handshake response is larger than the threshold and compressed
+	data, _ := json.Marshal(map[string]interface{}{"sys": map[string]interface{}{"version": "1.0.0"}})
+	p, err := codec.Encode(packet.Handshake, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		t.Fatal(err)
+	}
+	_, resp2, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp2) < 16 || packet.Type(resp2[0]) != packet.Handshake {
+		t.Fatalf("unexpected handshake response: %v", resp2)
+	}
+
+	// the subprotocols naming the protocol versions are preferred
+	if s, v, ok := n.negotiateSubprotocol([]string{"chat", "nano-v2"}); !ok || s != "nano-v2" || v != message.V2 {
+		t.Fatalf("expect nano-v2 selected, got: %s %d %v", s, v, ok)
+	}
+	if _, _, ok := n.negotiateSubprotocol([]string{"json"}); ok {
+		t.Fatalf("expect unsupported subprotocol refused")
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"time"
+
+	"github.com/lonng/nano/internal/proxyproto"
+)
+
+// DefaultProxyHeaderTimeout is the time to wait for the PROXY protocol header
+// of a new connection if Options.ProxyHeaderTimeout is absent
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+// proxied wraps the listener of TCP and WebSocket acceptors, the connections
+// are required to start with the PROXY protocol header if ProxyProtocol is set,
+// so that the address of the real client is reported by the sessions and used
+// by the per-IP connection limit.
+func (n *Node) proxied(ln net.Listener) net.Listener {
+	if !n.ProxyProtocol {
+		return ln
+	}
+	timeout := n.ProxyHeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+	return &proxyproto.Listener{Listener: ln, Timeout: timeout}
+}
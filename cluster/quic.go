@@ -0,0 +1,97 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// QUICConfig contains the parameters of the QUIC acceptor. QUIC runs on UDP,
+// the connections survive the network changes of mobile clients (e.g. from
+// Wi-Fi to cellular), and a client which has connected before can resume its
+// TLS session and send the first request in 0-RTT.
+//
+// The QUIC acceptor depends on github.com/quic-go/quic-go, which is only
+// compiled with the quic build tag:
+//
+//	go get github.com/quic-go/quic-go
+//	go build -tags quic
+type QUICConfig struct {
+	// TLSConfig is used for the handshake, the TLS configuration of the node,
+	// i.e. Options.TLSConfig or the certificate set by the TSLCertificate and
+	// TSLKey options, will be used if it is nil.
+	TLSConfig *tls.Config
+	// NextProtos is the ALPN protocols negotiated with the client,
+	// DefaultQUICProtocol will be used if it is empty.
+	NextProtos []string
+	// Allow0RTT accepts the early data sent by the resumed sessions. The
+	// 0-RTT data can be replayed by an attacker, so the handlers of the
+	// first request should be idempotent.
+	Allow0RTT bool
+	// SessionTicketKeys encrypt the session tickets, which should be shared
+	// by the nodes behind the same address to resume the sessions issued by
+	// the other nodes. The first key is used to issue new tickets.
+	SessionTicketKeys [][32]byte
+	HandshakeTimeout  time.Duration // idle timeout before the handshake completes
+	MaxIdleTimeout    time.Duration // connection is closed if no packet received in the duration
+	KeepAlivePeriod   time.Duration // interval of the keep-alive packets, zero means disabled
+}
+
+// DefaultQUICProtocol is the ALPN protocol of the QUIC acceptor
+const DefaultQUICProtocol = "nano"
+
+// DefaultQUICConfig returns the recommended configuration for mobile clients
+func DefaultQUICConfig() *QUICConfig {
+	return &QUICConfig{
+		Allow0RTT:        true,
+		HandshakeTimeout: 5 * time.Second,
+		MaxIdleTimeout:   30 * time.Second,
+		KeepAlivePeriod:  10 * time.Second,
+	}
+}
+
+// quicTLSConfig returns the TLS configuration of the QUIC acceptor
+func (n *Node) quicTLSConfig() (*tls.Config, error) {
+	cfg := n.QUIC
+	var conf *tls.Config
+	if cfg.TLSConfig != nil {
+		conf = cfg.TLSConfig.Clone()
+	} else {
+		base, err := n.serverTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		if base == nil {
+			return nil, ErrQUICCertificate
+		}
+		conf = base.Clone()
+	}
+	if len(cfg.NextProtos) > 0 {
+		conf.NextProtos = cfg.NextProtos
+	} else if len(conf.NextProtos) == 0 {
+		conf.NextProtos = []string{DefaultQUICProtocol}
+	}
+	if len(cfg.SessionTicketKeys) > 0 {
+		conf.SetSessionTicketKeys(cfg.SessionTicketKeys)
+	}
+	return conf, nil
+}
@@ -0,0 +1,163 @@
+// +build quic
+
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/lonng/nano/internal/log"
+	quic "github.com/quic-go/quic-go"
+)
+
+func (n *Node) listenAndServeQUIC(addr string) {
+	cfg := n.QUIC
+	tlsConf, err := n.quicTLSConfig()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	ln, err := quic.ListenAddrEarly(addr, tlsConf, &quic.Config{
+		HandshakeIdleTimeout: cfg.HandshakeTimeout,
+		MaxIdleTimeout:       cfg.MaxIdleTimeout,
+		KeepAlivePeriod:      cfg.KeepAlivePeriod,
+		Allow0RTT:            cfg.Allow0RTT,
+	})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	listener := newQUICListener(ln)
+	n.addListener(listener)
+
+	defer listener.Close()
+	for n.isRunning() {
+		conn, err := listener.Accept()
+		if err != nil {
+			if err == errQUICListenerClosed {
+				return
+			}
+			log.Println(err.Error())
+			continue
+		}
+
+		fc, err := n.fragmented(conn)
+		if err != nil {
+			log.Println(err.Error())
+			conn.Close()
+			continue
+		}
+		go n.handler.handle(fc, transportQUIC)
+	}
+}
+
+var errQUICListenerClosed = errors.New("quic listener closed")
+
+// quicListener adapts the QUIC listener to net.Listener, each client session
+// is carried by the first bidirectional stream opened by the client
+type quicListener struct {
+	ln     *quic.EarlyListener
+	ctx    context.Context
+	cancel context.CancelFunc
+	conns  chan net.Conn
+	once   sync.Once
+}
+
+func newQUICListener(ln *quic.EarlyListener) *quicListener {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &quicListener{ln: ln, ctx: ctx, cancel: cancel, conns: make(chan net.Conn)}
+	go l.serve()
+	return l
+}
+
+// serve accepts the connections, the streams are accepted concurrently so
+// that a slow handshake does not block the other clients
+func (l *quicListener) serve() {
+	for {
+		conn, err := l.ln.Accept(l.ctx)
+		if err != nil {
+			if l.ctx.Err() == nil {
+				log.Println(err.Error())
+				l.Close()
+			}
+			return
+		}
+		go l.accept(conn)
+	}
+}
+
+func (l *quicListener) accept(conn quic.EarlyConnection) {
+	stream, err := conn.AcceptStream(l.ctx)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return
+	}
+	select {
+	case l.conns <- &quicConn{Stream: stream, conn: conn}:
+	case <-l.ctx.Done():
+		conn.CloseWithError(0, "")
+	}
+}
+
+func (l *quicListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.ctx.Done():
+		return nil, errQUICListenerClosed
+	}
+}
+
+func (l *quicListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		l.cancel()
+		err = l.ln.Close()
+	})
+	return err
+}
+
+func (l *quicListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// quicConn is a client session over a QUIC stream
+type quicConn struct {
+	quic.Stream
+	conn quic.EarlyConnection
+}
+
+func (c *quicConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *quicConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes the whole connection, since a client session owns the QUIC
+// connection exclusively
+func (c *quicConn) Close() error {
+	c.Stream.Close()
+	return c.conn.CloseWithError(0, "")
+}
@@ -0,0 +1,47 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestNode_QUICTLSConfig(t *testing.T) {
+	n := &Node{Options: Options{QUIC: DefaultQUICConfig()}}
+	if _, err := n.quicTLSConfig(); err != ErrQUICCertificate {
+		t.Fatalf("expect: %v, got: %v", ErrQUICCertificate, err)
+	}
+
+	base := &tls.Config{}
+	n.QUIC.TLSConfig = base
+	n.QUIC.SessionTicketKeys = [][32]byte{{1}}
+	conf, err := n.quicTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.NextProtos) != 1 || conf.NextProtos[0] != DefaultQUICProtocol {
+		t.Fatalf("expect: %v, got: %v", []string{DefaultQUICProtocol}, conf.NextProtos)
+	}
+	if len(base.NextProtos) != 0 {
+		t.Fatalf("the TLS config of options should not be modified")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/packet"
+)
+
+// ReconnectHint is sent to clients in the kick package when the server is closing,
+// it spreads the reconnections of clients over a period of time to prevent them
+// from reconnecting simultaneously after the server restarted.
+//
+// The body of kick package is a json string as follows:
+//
+//	{
+//	  "reason": "server closing",
+//	  "reconnect": {
+//	    "delay_ms": 3721
+//	  }
+//	}
+//
+// SDK contract: a client which receives a kick package with the reconnect field
+// must wait at least delay_ms milliseconds before reconnecting to the server, and
+// should apply its own backoff if the reconnection fails afterwards. The field is
+// absent if the client should not reconnect, e.g: the player was kicked off.
+type ReconnectHint struct {
+	DelayMs int64 `json:"delay_ms"`
+}
+
+// kickMessage is the body of kick package
+type kickMessage struct {
+	Reason    string         `json:"reason"`
+	Reconnect *ReconnectHint `json:"reconnect,omitempty"`
+}
+
+func encodeKick(m kickMessage) ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(packet.Kick, data)
+}
+
+// reconnectHint returns a hint with the delay of ReconnectBase plus a random
+// jitter in [0, ReconnectJitter)
+func (n *Node) reconnectHint() *ReconnectHint {
+	delay := n.ReconnectBase
+	if n.ReconnectJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(n.ReconnectJitter)))
+	}
+	return &ReconnectHint{DelayMs: int64(delay / time.Millisecond)}
+}
+
+// closeSessions kicks all client sessions of current node with a reconnect hint,
+// which is called when the node is shutting down. The hints are sent through the
+// send queues, and the sessions whose hints are not written until ctx is done are
+// closed without waiting.
+func (n *Node) closeSessions(ctx context.Context) {
+	agents := n.agents()
+	var wg sync.WaitGroup
+	wg.Add(len(agents))
+	for _, a := range agents {
+		go func(a *agent) {
+			defer wg.Done()
+			err := a.kickWith(kickMessage{Reason: kickReasonClosing, Reconnect: n.reconnectHint()})
+			if err != nil && err != ErrBrokenPipe {
+				log.Println(err)
+			}
+		}(a)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Wait for reconnect hints timeout")
+		for _, a := range agents {
+			a.Close()
+		}
+		<-done
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/session"
+)
+
+func TestNode_CloseSessionsWithReconnectHint(t *testing.T) {
+	n := &Node{Options: Options{ReconnectBase: time.Second, ReconnectJitter: 2 * time.Second}}
+	n.sessions = map[int64]*session.Session{}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	n.storeSession(a.session)
+	go a.write()
+
+	go n.closeSessions(context.Background())
+
+	buf := make([]byte, 1024)
+	l, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, err := codec.NewDecoder().Decode(buf[:l])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 1 || packets[0].Type != packet.Kick {
+		t.Fatalf("expect a kick packet, got: %v", packets)
+	}
+
+	var m kickMessage
+	if err := json.Unmarshal(packets[0].Data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Reason != kickReasonClosing || m.Reconnect == nil {
+		t.Fatalf("unexpected kick message: %s", packets[0].Data)
+	}
+	if m.Reconnect.DelayMs < 1000 || m.Reconnect.DelayMs >= 3000 {
+		t.Fatalf("expect delay in [1000, 3000), got: %d", m.Reconnect.DelayMs)
+	}
+}
+
+func TestNode_CloseSessionsTimeout(t *testing.T) {
+	n := &Node{}
+	n.sessions = map[int64]*session.Session{}
+
+	// the client never reads, so the hint can not be written
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	n.storeSession(a.session)
+	go a.write()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		n.closeSessions(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect the sessions closed once ctx is done")
+	}
+	if a.status() != statusClosed {
+		t.Fatal("expect the session closed")
+	}
+}
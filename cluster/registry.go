@@ -0,0 +1,134 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/internal/log"
+)
+
+// Registry registers the nodes of the cluster with their services and labels,
+// and watches the changes of the members, which replaces the master node, e.g:
+// the etcd registry. The nodes join and leave the cluster without bootstrapping
+// a master first, so the rolling deploys are not coupled to a master.
+//
+// The uid bindings are synchronized by the master, the nodes of a cluster using
+// a registry should locate the users by Options.SessionStore.
+type Registry interface {
+	// Register registers the member, the registration is kept alive until it is
+	// deregistered, or expires once the node crashed.
+	Register(ctx context.Context, member *clusterpb.MemberInfo) error
+	// Deregister removes the registration of the member
+	Deregister(ctx context.Context, addr string) error
+	// Watch delivers the snapshots of all registered members until ctx is done,
+	// the current members are delivered first, then one snapshot per change.
+	Watch(ctx context.Context) (<-chan []*clusterpb.MemberInfo, error)
+}
+
+// initRegistry registers current node to the registry, and keeps the remote
+// services in sync with the members registered
+func (n *Node) initRegistry() error {
+	info := &clusterpb.MemberInfo{
+		Label:       n.Label,
+		ServiceAddr: n.ServiceAddr,
+		Services:    n.handler.LocalService(),
+	}
+	for {
+		err := n.Registry.Register(context.Background(), info)
+		if err == nil {
+			break
+		}
+		log.Println("Register current node to registry failed", err, "and will retry in", n.RetryInterval.String())
+		time.Sleep(n.RetryInterval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	snapshots, err := n.Registry.Watch(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	n.cluster.setRpcClient(n.rpcClient)
+	n.stopWatch = cancel
+
+	// the routes are ready once Startup returns, like registering to master
+	members, ok := <-snapshots
+	if !ok {
+		return ctx.Err()
+	}
+	known := map[string]*clusterpb.MemberInfo{}
+	n.syncMembers(known, members)
+	go func() {
+		for members := range snapshots {
+			n.syncMembers(known, members)
+		}
+	}()
+	return nil
+}
+
+// syncMembers applies the snapshot of the registered members to the remote
+// services, known holds the members applied before
+func (n *Node) syncMembers(known map[string]*clusterpb.MemberInfo, members []*clusterpb.MemberInfo) {
+	current := map[string]*clusterpb.MemberInfo{}
+	for _, m := range members {
+		if m.ServiceAddr != n.ServiceAddr {
+			current[m.ServiceAddr] = m
+		}
+	}
+
+	for addr := range known {
+		if _, ok := current[addr]; ok {
+			continue
+		}
+		log.Println("Exists peer leave cluster", addr)
+		delete(known, addr)
+		n.handler.delMember(addr)
+		n.cluster.delMember(addr)
+	}
+	for addr, m := range current {
+		prev, ok := known[addr]
+		if ok && reflect.DeepEqual(prev.Services, m.Services) && prev.Label == m.Label {
+			continue
+		}
+		if ok {
+			// the services of the member are changed, e.g: redeployed
+			n.handler.delMember(addr)
+		}
+		log.Println(fmt.Sprintf("New peer join cluster %s, Label=%s, Services=%v", addr, m.Label, m.Services))
+		known[addr] = m
+		n.handler.addRemoteService(m)
+		n.cluster.addMember(m)
+	}
+}
+
+// closeRegistry stops watching the members and deregisters current node
+func (n *Node) closeRegistry() {
+	if n.stopWatch != nil {
+		n.stopWatch()
+	}
+	if err := n.Registry.Deregister(context.Background(), n.ServiceAddr); err != nil {
+		log.Println("Deregister current node failed", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package cluster
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/session"
+)
+
+// memoryRegistry is a Registry shared by the nodes in the same process
+type memoryRegistry struct {
+	mu       sync.Mutex
+	members  map[string]*clusterpb.MemberInfo
+	watchers []chan []*clusterpb.MemberInfo
+}
+
+func (r *memoryRegistry) Register(_ context.Context, member *clusterpb.MemberInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.members[member.ServiceAddr] = member
+	r.notify()
+	return nil
+}
+
+func (r *memoryRegistry) Deregister(_ context.Context, addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.members, addr)
+	r.notify()
+	return nil
+}
+
+func (r *memoryRegistry) Watch(_ context.Context) (<-chan []*clusterpb.MemberInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan []*clusterpb.MemberInfo, 16)
+	ch <- r.snapshot()
+	r.watchers = append(r.watchers, ch)
+	return ch, nil
+}
+
+func (r *memoryRegistry) notify() {
+	for _, ch := range r.watchers {
+		ch <- r.snapshot()
+	}
+}
+
+func (r *memoryRegistry) snapshot() []*clusterpb.MemberInfo {
+	members := make([]*clusterpb.MemberInfo, 0, len(r.members))
+	for _, m := range r.members {
+		members = append(members, m)
+	}
+	return members
+}
+
+type (
+	LobbyComponent struct{ component.Base }
+	RoomComponent  struct{ component.Base }
+)
+
+func (c *LobbyComponent) Join(_ *session.Session, _ []byte) error { return nil }
+func (c *RoomComponent) Join(_ *session.Session, _ []byte) error  { return nil }
+
+func waitServices(t *testing.T, h *LocalHandler, expect []string) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		services := h.RemoteService()
+		sort.Strings(services)
+		if reflect.DeepEqual(services, expect) || (len(services) == 0 && len(expect) == 0) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect remote services %v, got: %v", expect, services)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNode_Registry(t *testing.T) {
+	registry := &memoryRegistry{members: map[string]*clusterpb.MemberInfo{}}
+
+	lobbyComps := &component.Components{}
+	lobbyComps.Register(&LobbyComponent{})
+	lobby := &Node{
+		Options:     Options{Components: lobbyComps, Registry: registry, Label: "lobby"},
+		ServiceAddr: "127.0.0.1:34451",
+	}
+	if err := lobby.Startup(); err != nil {
+		t.Fatal(err)
+	}
+	defer lobby.Shutdown()
+
+	roomComps := &component.Components{}
+	roomComps.Register(&RoomComponent{})
+	room := &Node{
+		Options:     Options{Components: roomComps, Registry: registry, Label: "room"},
+		ServiceAddr: "127.0.0.1:34452",
+	}
+	if err := room.Startup(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the members registered before are routed once Startup returns
+	waitServices(t, room.Handler(), []string{"LobbyComponent"})
+	waitServices(t, lobby.Handler(), []string{"RoomComponent"})
+
+	room.Shutdown()
+	waitServices(t, lobby.Handler(), nil)
+}
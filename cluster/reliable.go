@@ -0,0 +1,194 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+// Default settings of the reliable pushes, see session.PushReliable
+const (
+	// DefaultReliableRetries is the number of resends before the session is
+	// considered dead
+	DefaultReliableRetries = 3
+	// DefaultReliableBackoff is the interval before the first resend, which is
+	// doubled for each later resend
+	DefaultReliableBackoff = time.Second
+)
+
+type (
+	// ackTable is the pending-ack table of the reliable pushes of a session,
+	// keyed by the sequence id
+	ackTable struct {
+		mu        sync.Mutex
+		pending   map[uint64]*pendingAck
+		closed    bool
+		retries   int
+		backoff   time.Duration
+		reporters []metrics.Reporter
+	}
+
+	pendingAck struct {
+		route    string
+		data     []byte
+		attempts int
+		timer    clock.Timer
+	}
+)
+
+func newAckTable(retries int, backoff time.Duration, reporters []metrics.Reporter) *ackTable {
+	if retries <= 0 {
+		retries = DefaultReliableRetries
+	}
+	if backoff <= 0 {
+		backoff = DefaultReliableBackoff
+	}
+	return &ackTable{
+		pending:   map[uint64]*pendingAck{},
+		retries:   retries,
+		backoff:   backoff,
+		reporters: reporters,
+	}
+}
+
+// ack removes the reliable push of seq, returns false if it is not pending
+func (t *ackTable) ack(seq uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pending[seq]
+	if !ok {
+		return false
+	}
+	p.timer.Stop()
+	delete(t.pending, seq)
+	return true
+}
+
+// close stops resending the pending pushes, which is called when the session
+// is closed
+func (t *ackTable) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	for seq, p := range t.pending {
+		p.timer.Stop()
+		delete(t.pending, seq)
+	}
+}
+
+func (t *ackTable) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// PushReliable, implementation for session.ReliablePusher interface
+func (a *agent) PushReliable(route string, v interface{}) error {
+	if a.status() == statusClosed {
+		return ErrBrokenPipe
+	}
+
+	// the client which can not acknowledge receives a plain push
+	if atomic.LoadInt32(&a.protocol) < message.V3 {
+		return a.Push(route, v)
+	}
+
+	data, err := message.Serialize(v)
+	if err != nil {
+		return err
+	}
+
+	t := a.acks
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return ErrBrokenPipe
+	}
+	seq := atomic.AddUint64(&a.seq, 1)
+	p := &pendingAck{route: route, data: data}
+	p.timer = env.Clock.AfterFunc(t.backoff, func() { a.resend(seq) })
+	t.pending[seq] = p
+	t.mu.Unlock()
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("Type=ReliablePush, ID=%d, UID=%d, Route=%s, Seq=%d, Data=%dbytes",
+			a.session.ID(), a.session.UID(), route, seq, len(data)))
+	}
+
+	return a.send(pendingMessage{typ: message.ReliablePush, route: route, mid: seq, payload: data}, session.PriorityNormal)
+}
+
+// resend sends the reliable push of seq again if it has not been acknowledged,
+// and closes the session once the retries are exhausted
+func (a *agent) resend(seq uint64) {
+	t := a.acks
+	t.mu.Lock()
+	p, ok := t.pending[seq]
+	if !ok || t.closed {
+		t.mu.Unlock()
+		return
+	}
+	if p.attempts >= t.retries {
+		delete(t.pending, seq)
+		t.mu.Unlock()
+
+		metrics.ReportReliableGiveUp(t.reporters, p.route)
+		log.Println(fmt.Sprintf("Reliable push not acknowledged, close session, ID=%d, UID=%d, Route=%s, Seq=%d",
+			a.session.ID(), a.session.UID(), p.route, seq))
+		a.Close()
+		return
+	}
+	p.attempts++
+	p.timer = env.Clock.AfterFunc(t.backoff<<uint(p.attempts), func() { a.resend(seq) })
+	t.mu.Unlock()
+
+	metrics.ReportReliableResend(t.reporters, p.route)
+	if err := a.send(pendingMessage{typ: message.ReliablePush, route: p.route, mid: seq, payload: p.data}, session.PriorityNormal); err != nil {
+		log.Println(fmt.Sprintf("Resend reliable push %s error: %s", p.route, err.Error()))
+	}
+}
+
+// ack acknowledges the reliable push of the client
+func (h *LocalHandler) ack(agent *agent, data []byte) {
+	req := struct {
+		Seq uint64 `json:"seq"`
+	}{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Println(fmt.Sprintf("Invalid ack: %v", err))
+		return
+	}
+	if !agent.acks.ack(req.Seq) && env.Debug {
+		log.Println(fmt.Sprintf("Reliable push not pending, SessionID=%d, seq=%d", agent.session.ID(), req.Seq))
+	}
+}
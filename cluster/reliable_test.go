@@ -0,0 +1,113 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/clock/clocktest"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+func TestAgent_PushReliable(t *testing.T) {
+	fake := clocktest.NewFake(time.Now())
+	defer func(c clock.Clock) { env.Clock = c }(env.Clock)
+	env.Clock = fake
+
+	reporter := &seriesReporter{series: map[string]float64{}}
+	h := NewHandler(&Node{}, nil)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	a.protocol = message.V3
+	a.acks = newAckTable(2, time.Second, []metrics.Reporter{reporter})
+
+	expectPush := func(typ message.Type, seq uint64) {
+		t.Helper()
+		m, ok := a.chSend.pop()
+		if !ok {
+			t.Fatal("expect a push to be sent")
+		}
+		if m.typ != typ || m.mid != seq || m.route != "room.event" {
+			t.Fatalf("unexpected push: type=%v, seq=%d, route=%s", m.typ, m.mid, m.route)
+		}
+	}
+
+	// the push is resent until acknowledged
+	if err := a.session.PushReliable("room.event", []byte("win")); err != nil {
+		t.Fatal(err)
+	}
+	expectPush(message.ReliablePush, 1)
+	fake.Advance(time.Second)
+	expectPush(message.ReliablePush, 1)
+	h.processMessage(a, &message.Message{Type: message.Notify, Route: session.AckRoute, Data: []byte(`{"seq":1}`)})
+	if l := a.acks.len(); l != 0 {
+		t.Fatalf("expect the push to be acknowledged, got %d pending", l)
+	}
+	fake.Advance(time.Minute)
+	if l := a.chSend.len(); l != 0 {
+		t.Fatalf("expect no resend after ack, got: %d", l)
+	}
+
+	// the session is closed after all retries
+	if err := a.session.PushReliable("room.event", []byte("lose")); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(time.Second + 2*time.Second)
+	if a.status() == statusClosed {
+		t.Fatal("expect the session to be alive before the retries are exhausted")
+	}
+	fake.Advance(4 * time.Second)
+	if a.status() != statusClosed {
+		t.Fatal("expect the session to be closed")
+	}
+	if v := reporter.value(metrics.ReliableResends + "{route=room.event}"); v != 3 {
+		t.Fatalf("expect: 3 resends, got: %v", v)
+	}
+	if v := reporter.value(metrics.ReliableGiveUps + "{route=room.event}"); v != 1 {
+		t.Fatalf("expect: 1 give-up, got: %v", v)
+	}
+}
+
+func TestAgent_PushReliableFallback(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+
+	// the client of V1 can not acknowledge the push
+	if err := a.session.PushReliable("room.event", []byte("win")); err != nil {
+		t.Fatal(err)
+	}
+	m, ok := a.chSend.pop()
+	if !ok || m.typ != message.Push {
+		t.Fatalf("expect a plain push, got: %v", m.typ)
+	}
+	if l := a.acks.len(); l != 0 {
+		t.Fatalf("expect no pending ack, got: %d", l)
+	}
+}
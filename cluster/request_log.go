@@ -0,0 +1,103 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/session"
+)
+
+// Request paths reported in RequestInfo.Path
+const (
+	PathLocal  = "local"  // the request was processed by a handler of current node
+	PathRemote = "remote" // the request was forwarded to a remote node via RPC
+)
+
+// Request statuses reported in RequestInfo.Status
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// RequestInfo describes a completed request, which will be passed to the
+// RequestLogger after the handler returns.
+type RequestInfo struct {
+	Session    *session.Session
+	Route      string
+	UID        int64
+	RemoteAddr string
+	Path       string
+	Duration   time.Duration
+	Payload    []byte // payload of the request, which should not be retained
+	BytesIn    int
+	BytesOut   int64 // bytes of responses emitted while the handler was running
+	Status     string
+	Code       int // returned by the Code() method of Err, 0 if absent
+	Err        error
+}
+
+// RequestLogger receives a RequestInfo for every completed request.
+type RequestLogger func(info RequestInfo)
+
+// coder is implemented by handler errors which carry an application error code.
+type coder interface {
+	Code() int
+}
+
+// outCounter is implemented by network entities which count the bytes of
+// responses they emitted.
+type outCounter interface {
+	bytesOut() int64
+}
+
+func bytesOut(s *session.Session) int64 {
+	if c, ok := s.NetworkEntity().(outCounter); ok {
+		return c.bytesOut()
+	}
+	return 0
+}
+
+func (h *LocalHandler) logRequest(s *session.Session, route, path string, start time.Time, payload []byte, out int64, err error) {
+	info := RequestInfo{
+		Session:  s,
+		Route:    route,
+		UID:      s.UID(),
+		Path:     path,
+		Duration: env.Clock.Now().Sub(start),
+		Payload:  payload,
+		BytesIn:  len(payload),
+		BytesOut: out,
+		Status:   StatusOK,
+		Err:      err,
+	}
+	if addr := s.RemoteAddr(); addr != nil {
+		info.RemoteAddr = addr.String()
+	}
+	if err != nil {
+		info.Status = StatusError
+		if c, ok := err.(coder); ok {
+			info.Code = c.Code()
+		}
+	}
+	h.currentNode.RequestLogger(info)
+}
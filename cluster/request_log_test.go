@@ -0,0 +1,133 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nano/session"
+)
+
+type codeError struct{}
+
+func (codeError) Error() string { return "code error" }
+func (codeError) Code() int     { return 42 }
+
+type LogComponent struct {
+	component.Base
+}
+
+func (c *LogComponent) Echo(s *session.Session, data []byte) error {
+	return s.Response(data)
+}
+
+func (c *LogComponent) Fail(s *session.Session, data []byte) error {
+	return codeError{}
+}
+
+type syncScheduler struct{}
+
+func (syncScheduler) Schedule(task scheduler.Task) { task() }
+
+func TestHandler_RequestLogger(t *testing.T) {
+	var infos []RequestInfo
+	n := &Node{Options: Options{RequestLogger: func(info RequestInfo) {
+		infos = append(infos, info)
+	}}}
+	h := NewHandler(n, nil)
+	opts := []component.Option{component.WithName("Log"), component.WithSchedulerName("sync")}
+	if err := h.register(&LogComponent{}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	a.session.Bind(1001)
+	a.session.Set("sync", syncScheduler{})
+
+	h.localProcess(h.localHandlers["Log.Echo"], 1, a.session, &message.Message{
+		Type: message.Request, ID: 1, Route: "Log.Echo", Data: []byte("hello"),
+	})
+	h.localProcess(h.localHandlers["Log.Fail"], 2, a.session, &message.Message{
+		Type: message.Request, ID: 2, Route: "Log.Fail", Data: []byte("hi"),
+	})
+
+	if len(infos) != 2 {
+		t.Fatalf("expect: 2 requests logged, got: %d", len(infos))
+	}
+	ok := infos[0]
+	if ok.Route != "Log.Echo" || ok.UID != 1001 || ok.Path != PathLocal || ok.Status != StatusOK {
+		t.Fatalf("unexpected request info: %+v", ok)
+	}
+	if ok.BytesIn != 5 || ok.BytesOut != 5 {
+		t.Fatalf("expect: 5 bytes in and out, got: %d/%d", ok.BytesIn, ok.BytesOut)
+	}
+	failed := infos[1]
+	if failed.Status != StatusError || failed.Code != 42 || failed.Err == nil || failed.BytesOut != 0 {
+		t.Fatalf("unexpected request info: %+v", failed)
+	}
+}
+
+func TestHandler_RouteMetrics(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{MetricsReporters: []metrics.Reporter{reporter}}}
+	h := NewHandler(n, nil)
+	opts := []component.Option{component.WithName("Log"), component.WithSchedulerName("sync")}
+	if err := h.register(&LogComponent{}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	a.session.Set("sync", syncScheduler{})
+
+	h.localProcess(h.localHandlers["Log.Echo"], 1, a.session, &message.Message{
+		Type: message.Request, ID: 1, Route: "Log.Echo", Data: []byte("hello"),
+	})
+	h.localProcess(h.localHandlers["Log.Fail"], 2, a.session, &message.Message{
+		Type: message.Request, ID: 2, Route: "Log.Fail", Data: []byte("hi"),
+	})
+	// the message is dropped without the scheduler of the component
+	a.session.Remove("sync")
+	h.localProcess(h.localHandlers["Log.Echo"], 3, a.session, &message.Message{
+		Type: message.Request, ID: 3, Route: "Log.Echo", Data: []byte("hello"),
+	})
+
+	cases := map[string]float64{
+		"processed_messages_total{route=Log.Echo}":                   1,
+		"processed_messages_total{route=Log.Fail}":                   1,
+		"handler_errors_total{code=42,route=Log.Fail}":               1,
+		"handler_errors_total{code=0,route=Log.Echo}":                0,
+		"dropped_messages_total{reason=no_scheduler,route=Log.Echo}": 1,
+	}
+	for series, expect := range cases {
+		if v := reporter.value(series); v != expect {
+			t.Fatalf("series: %s, expect: %v, got: %v", series, expect, v)
+		}
+	}
+}
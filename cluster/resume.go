@@ -0,0 +1,335 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/session"
+)
+
+// DefaultResumeBuffer is the number of pushes kept for a disconnected session if
+// Options.ResumeBuffer is not specified
+const DefaultResumeBuffer = 256
+
+const (
+	resumeTokenSize = 8 + 8 + 16 // session id, nonce and truncated signature
+	resumeSecretLen = 32
+)
+
+// suspendedSession is a session whose connection is broken, which waits for the
+// client to reconnect with the resume token in Options.ResumeTTL. The pushes to
+// the session are kept in a bounded buffer and replayed after resuming, the
+// session expires once the buffer overflows.
+type suspendedSession struct {
+	node   *Node
+	agent  *agent // the closed agent
+	reason session.CloseReason
+	timer  clock.Timer
+
+	mu       sync.Mutex
+	unacked  []pendingMessage // reliable pushes not acknowledged, ordered by seq
+	backlog  []pendingMessage // pushes not written to the broken connection
+	pending  []pendingMessage // pushes after the connection is broken
+	limit    int
+	overflow bool
+	done     bool // resumed or expired
+}
+
+// resumableReason reports whether the session closed for the reason can be
+// resumed, i.e. the connection is broken instead of closed by the server
+func resumableReason(reason session.CloseReason) bool {
+	switch reason {
+	case session.CloseReasonDisconnected, session.CloseReasonReadError, session.CloseReasonHeartbeatTimeout, session.CloseReasonReadTimeout:
+		return true
+	}
+	return false
+}
+
+// initResume prepares the key signing the resume tokens
+func (n *Node) initResume() error {
+	if n.ResumeTTL <= 0 {
+		return nil
+	}
+	n.resumeKey = n.ResumeSecret
+	if len(n.resumeKey) == 0 {
+		n.resumeKey = make([]byte, resumeSecretLen)
+		if _, err := rand.Read(n.resumeKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeToken returns the token of the session and the nonce signed by current
+// node, which is hex encoded as other tokens.
+func (n *Node) resumeToken(sid int64, nonce uint64) string {
+	buf := make([]byte, 16, resumeTokenSize)
+	binary.BigEndian.PutUint64(buf, uint64(sid))
+	binary.BigEndian.PutUint64(buf[8:], nonce)
+	return hex.EncodeToString(append(buf, n.signResume(buf)...))
+}
+
+func (n *Node) signResume(data []byte) []byte {
+	mac := hmac.New(sha256.New, n.resumeKey)
+	mac.Write(data)
+	return mac.Sum(nil)[:resumeTokenSize-16]
+}
+
+// parseResumeToken verifies the token and returns the session id and nonce
+func (n *Node) parseResumeToken(token string) (int64, uint64, bool) {
+	if len(n.resumeKey) == 0 || len(token) != resumeTokenSize*2 {
+		return 0, 0, false
+	}
+	buf, err := hex.DecodeString(token)
+	if err != nil || !hmac.Equal(buf[16:], n.signResume(buf[:16])) {
+		return 0, 0, false
+	}
+	return int64(binary.BigEndian.Uint64(buf)), binary.BigEndian.Uint64(buf[8:]), true
+}
+
+// issueResumeToken assigns a nonce to the agent and returns its resume token
+func (n *Node) issueResumeToken(a *agent) (string, error) {
+	if a.resumeNonce == 0 {
+		var buf [8]byte
+		for a.resumeNonce == 0 {
+			if _, err := rand.Read(buf[:]); err != nil {
+				return "", err
+			}
+			a.resumeNonce = binary.BigEndian.Uint64(buf[:])
+		}
+	}
+	return n.resumeToken(a.session.ID(), a.resumeNonce), nil
+}
+
+// suspendSession keeps the session of the closed agent for resuming, nil will be
+// returned if the session can not be resumed
+func (n *Node) suspendSession(a *agent, reason session.CloseReason) *suspendedSession {
+	if n.ResumeTTL <= 0 || a.resumeNonce == 0 || !resumableReason(reason) {
+		return nil
+	}
+	limit := n.ResumeBuffer
+	if limit <= 0 {
+		limit = DefaultResumeBuffer
+	}
+	ss := &suspendedSession{node: n, agent: a, reason: reason, limit: limit, unacked: a.acks.unacked()}
+
+	sid := a.session.ID()
+	n.mu.Lock()
+	if n.suspended == nil {
+		n.suspended = map[int64]*suspendedSession{}
+	}
+	n.suspended[sid] = ss
+	ss.timer = env.Clock.AfterFunc(n.ResumeTTL, ss.expire)
+	n.mu.Unlock()
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("Session suspended, ID=%d, UID=%d, Reason=%s", sid, a.session.UID(), reason))
+	}
+	return ss
+}
+
+// resumeSuspended binds the suspended session of the token to the agent of the new
+// connection, and drops the session created for the connection. The pushes kept
+// are replayed once the handshake is acknowledged.
+func (n *Node) resumeSuspended(a *agent, token string) bool {
+	sid, nonce, ok := n.parseResumeToken(token)
+	if !ok {
+		return false
+	}
+
+	fresh := a.session
+	n.mu.Lock()
+	ss, found := n.suspended[sid]
+	if !found || ss.agent.resumeNonce != nonce || !ss.claim() {
+		n.mu.Unlock()
+		return false
+	}
+	delete(n.suspended, sid)
+	delete(n.sessions, fresh.ID())
+	s := ss.agent.session
+	n.sessions[sid] = s
+	n.mu.Unlock()
+	ss.timer.Stop()
+
+	a.session = s
+	a.srv = reflect.ValueOf(s)
+	a.resumeNonce = nonce
+	a.resumed = ss
+	s.Attach(a)
+	closeSession(a.reporters, fresh, session.CloseReasonResumed)
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("Session resumed, ID=%d, UID=%d, Remote=%s", sid, s.UID(), a.conn.RemoteAddr()))
+	}
+	return true
+}
+
+// add keeps the push to the suspended session, false will be returned if the
+// session has been resumed or expired, or the buffer is full
+func (ss *suspendedSession) add(m pendingMessage) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.done || ss.overflow || ss.full() {
+		return false
+	}
+	ss.pending = append(ss.pending, m)
+	return true
+}
+
+// full marks the session overflowed if the buffer is full, the session expires
+// without waiting for the client, it is called with the lock held.
+func (ss *suspendedSession) full() bool {
+	if len(ss.unacked)+len(ss.backlog)+len(ss.pending) < ss.limit {
+		return false
+	}
+	ss.overflow = true
+	go ss.expire()
+	return true
+}
+
+// keep moves the message left in the send queue of the broken connection to the
+// backlog, the responses and the raw payloads are dropped.
+func (ss *suspendedSession) keep(m pendingMessage) {
+	switch {
+	case m.batch != nil:
+		for _, b := range m.batch {
+			ss.keep(b)
+		}
+		return
+	case m.shared != nil:
+		shared := m.shared
+		m = pendingMessage{typ: message.Push, route: shared.Route, payload: shared.Payload}
+		shared.Release()
+	case m.raw != nil || m.done != nil:
+		m.discard(ErrBrokenPipe)
+		return
+	}
+	// the reliable pushes are kept in unacked
+	if m.typ != message.Push {
+		return
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.done || ss.overflow || ss.full() {
+		return
+	}
+	ss.backlog = append(ss.backlog, m)
+}
+
+// claim marks the session resumed, false will be returned if it has expired or
+// the buffer has overflowed
+func (ss *suspendedSession) claim() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.done || ss.overflow {
+		return false
+	}
+	ss.done = true
+	return true
+}
+
+// replay sends the pushes kept to the agent of the new connection
+func (ss *suspendedSession) replay(a *agent) {
+	ss.mu.Lock()
+	messages := make([]pendingMessage, 0, len(ss.unacked)+len(ss.backlog)+len(ss.pending))
+	messages = append(messages, ss.unacked...)
+	messages = append(messages, ss.backlog...)
+	messages = append(messages, ss.pending...)
+	ss.unacked, ss.backlog, ss.pending = nil, nil, nil
+	ss.mu.Unlock()
+
+	for _, m := range messages {
+		var err error
+		if m.typ == message.ReliablePush {
+			err = a.PushReliable(m.route, m.payload)
+		} else {
+			err = a.send(m, session.PriorityNormal)
+		}
+		if err != nil {
+			log.Println(fmt.Sprintf("Replay push %s error: %s", m.route, err.Error()))
+			return
+		}
+	}
+}
+
+// expire closes the suspended session with the normal lifecycle, which is called
+// when the client does not resume in time or the session is closed by server
+func (ss *suspendedSession) expire() {
+	n := ss.node
+	sid := ss.agent.session.ID()
+	n.mu.Lock()
+	if n.suspended[sid] != ss {
+		n.mu.Unlock()
+		return
+	}
+	delete(n.suspended, sid)
+	n.mu.Unlock()
+	ss.timer.Stop()
+
+	ss.mu.Lock()
+	ss.done = true
+	ss.unacked, ss.backlog, ss.pending = nil, nil, nil
+	ss.mu.Unlock()
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("Suspended session expired, ID=%d, UID=%d", sid, ss.agent.session.UID()))
+	}
+	if n.handler != nil {
+		n.handler.sessionClosed(ss.agent)
+	}
+	closeSession(ss.agent.reporters, ss.agent.session, ss.reason)
+}
+
+// unacked returns the reliable pushes not acknowledged in the order of their
+// sequence ids
+func (t *ackTable) unacked() []pendingMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seqs := make([]uint64, 0, len(t.pending))
+	for seq := range t.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	messages := make([]pendingMessage, 0, len(seqs))
+	for _, seq := range seqs {
+		p := t.pending[seq]
+		messages = append(messages, pendingMessage{typ: message.ReliablePush, route: p.route, mid: seq, payload: p.data})
+	}
+	return messages
+}
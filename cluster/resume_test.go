@@ -0,0 +1,256 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nano/session"
+)
+
+func newResumeNode(t *testing.T, buffer int) *Node {
+	n := &Node{Options: Options{IsMaster: true, ResumeTTL: time.Minute, ResumeBuffer: buffer}, ServiceAddr: "127.0.0.1:0"}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	if err := n.initResume(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func newResumeAgent(n *Node, conn net.Conn) *agent {
+	a := newAgent(conn, nil, nil, nil)
+	a.suspend = func(reason session.CloseReason) *suspendedSession { return n.suspendSession(a, reason) }
+	n.storeSession(a.session)
+	return a
+}
+
+func TestNode_ResumeSession(t *testing.T) {
+	n := newResumeNode(t, 0)
+
+	server, client := net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+	old := newResumeAgent(n, server)
+	token, err := n.issueResumeToken(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := old.session
+	s.Set("hp", 100)
+
+	old.closeWith(session.CloseReasonDisconnected)
+	if old.suspension() == nil {
+		t.Fatal("expect the session to be suspended")
+	}
+	if err := s.Push("battle.update", []byte("round 2")); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client = net.Pipe()
+	defer client.Close()
+	a := newResumeAgent(n, server)
+	go a.write()
+	fresh := a.session
+	if n.resumeSuspended(a, token[:len(token)-2]+"00") {
+		t.Fatal("expect the forged token to be rejected")
+	}
+	if !n.resumeSuspended(a, token) {
+		t.Fatal("expect the session to be resumed")
+	}
+	if a.session != s || s.NetworkEntity() != a || s.Int("hp") != 100 {
+		t.Fatal("expect the agent to be bound to the suspended session")
+	}
+	n.mu.RLock()
+	_, found := n.sessions[fresh.ID()]
+	n.mu.RUnlock()
+	if found {
+		t.Fatal("expect the session of the new connection to be dropped")
+	}
+	if n.resumeSuspended(newResumeAgent(n, server), token) {
+		t.Fatal("expect the token to be used only once")
+	}
+
+	// replayed once the handshake is acknowledged
+	go a.resumed.replay(a)
+	m := readPush(t, client, message.V1)
+	if m.Route != "battle.update" || string(m.Data) != "round 2" {
+		t.Fatalf("unexpected message: route=%s, data=%s", m.Route, m.Data)
+	}
+}
+
+func TestNode_ResumeSessionExpired(t *testing.T) {
+	n := newResumeNode(t, 1)
+	newSuspended := func(reason session.CloseReason) (*agent, string) {
+		server, client := net.Pipe()
+		go io.Copy(ioutil.Discard, client)
+		a := newResumeAgent(n, server)
+		token, err := n.issueResumeToken(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.closeWith(reason)
+		return a, token
+	}
+
+	// the session closed by server can not be resumed
+	if a, _ := newSuspended(kickReasonDuplicate); a.suspension() != nil {
+		t.Fatal("expect the kicked session not to be suspended")
+	}
+
+	// expired
+	n.ResumeTTL = 10 * time.Millisecond
+	a, token := newSuspended(session.CloseReasonHeartbeatTimeout)
+	if a.suspension() == nil {
+		t.Fatal("expect the session to be suspended")
+	}
+	n.ResumeTTL = time.Minute
+	waitSuspended(t, n, 0)
+	server, _ := net.Pipe()
+	if n.resumeSuspended(newResumeAgent(n, server), token) {
+		t.Fatal("expect the expired session not to be resumed")
+	}
+
+	// overflowed
+	a, token = newSuspended(session.CloseReasonDisconnected)
+	if err := a.session.Push("battle.update", []byte("round 1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.session.Push("battle.update", []byte("round 2")); err != ErrBrokenPipe {
+		t.Fatalf("expect: %v, got: %v", ErrBrokenPipe, err)
+	}
+	if n.resumeSuspended(newResumeAgent(n, server), token) {
+		t.Fatal("expect the overflowed session not to be resumed")
+	}
+	if a.session.Push("battle.update", []byte("round 3")) != ErrBrokenPipe {
+		t.Fatal("expect the pushes to be rejected after overflow")
+	}
+
+	// closed by the application
+	a, token = newSuspended(session.CloseReasonDisconnected)
+	a.session.Close()
+	if n.resumeSuspended(newResumeAgent(n, server), token) {
+		t.Fatal("expect the closed session not to be resumed")
+	}
+	// the overflowed session expires asynchronously
+	waitSuspended(t, n, 0)
+}
+
+// waitSuspended waits until the number of suspended sessions is expect
+func waitSuspended(t *testing.T, n *Node, expect int) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		n.mu.RLock()
+		count := len(n.suspended)
+		n.mu.RUnlock()
+		if count == expect {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect: %d suspended sessions, got: %d", expect, count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandler_ResumeSession(t *testing.T) {
+	cache()
+	n := newResumeNode(t, 0)
+	h := NewHandler(n, nil)
+	go scheduler.Sched()
+
+	type handshakeResponse struct {
+		Sys struct {
+			Resume  string `json:"resume"`
+			Resumed bool   `json:"resumed"`
+		} `json:"sys"`
+	}
+	handshake := func(client *protocolClient, token string) handshakeResponse {
+		data, _ := json.Marshal(map[string]interface{}{"sys": map[string]interface{}{"resume": token}})
+		if err := client.write(packet.Handshake, data); err != nil {
+			t.Fatal(err)
+		}
+		p, err := client.read(packet.Handshake)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp handshakeResponse
+		if err := json.Unmarshal(p.Data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.write(packet.HandshakeAck, nil); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	server, conn := net.Pipe()
+	go h.handle(server, transportTCP)
+	client := &protocolClient{conn: conn, decoder: codec.NewDecoder()}
+	resp := handshake(client, "")
+	if resp.Sys.Resume == "" || resp.Sys.Resumed {
+		t.Fatalf("unexpected handshake response: %+v", resp)
+	}
+
+	// the network blips
+	var s *session.Session
+	n.mu.RLock()
+	for _, s = range n.sessions {
+	}
+	n.mu.RUnlock()
+	conn.Close()
+	for {
+		if s.NetworkEntity().(*agent).suspension() != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.Push("battle.update", []byte("round 2")); err != nil {
+		t.Fatal(err)
+	}
+
+	server, conn = net.Pipe()
+	defer conn.Close()
+	go h.handle(server, transportTCP)
+	client = &protocolClient{conn: conn, decoder: codec.NewDecoder()}
+	if resumed := handshake(client, resp.Sys.Resume); !resumed.Sys.Resumed || resumed.Sys.Resume != resp.Sys.Resume {
+		t.Fatalf("unexpected handshake response: %+v", resumed)
+	}
+	p, err := client.read(packet.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := message.Decode(p.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Route != "battle.update" || string(m.Data) != "round 2" {
+		t.Fatalf("unexpected message: route=%s, data=%s", m.Route, m.Data)
+	}
+}
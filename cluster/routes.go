@@ -0,0 +1,81 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import "sync"
+
+// maxPendingRoutes bounds the routes of the requests waiting for response of a
+// session, the oldest are dropped as the handlers may never respond
+const maxPendingRoutes = 1024
+
+// pendingRoutes is the routes of the requests waiting for response keyed by
+// message id, the zero value is ready to use
+type pendingRoutes struct {
+	mu     sync.Mutex
+	routes map[uint64]string
+	mids   []uint64 // message ids in the order of requests, may be responded
+}
+
+// store records the route of the request mid, and drops the oldest request if
+// there are more than maxPendingRoutes requests waiting for response
+func (p *pendingRoutes) store(mid uint64, route string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.routes == nil {
+		p.routes = map[uint64]string{}
+	}
+	p.routes[mid] = route
+	p.mids = append(p.mids, mid)
+	for len(p.routes) > maxPendingRoutes {
+		delete(p.routes, p.mids[0])
+		p.mids = p.mids[1:]
+	}
+
+	// the message ids of the responded requests are compacted lazily
+	if len(p.mids) > 2*maxPendingRoutes {
+		mids := make([]uint64, 0, len(p.routes))
+		for _, mid := range p.mids {
+			if _, ok := p.routes[mid]; ok {
+				mids = append(mids, mid)
+			}
+		}
+		p.mids = mids
+	}
+}
+
+// take removes and returns the route of the request mid
+func (p *pendingRoutes) take(mid uint64) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	route, ok := p.routes[mid]
+	if ok {
+		delete(p.routes, mid)
+	}
+	return route, ok
+}
+
+func (p *pendingRoutes) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.routes)
+}
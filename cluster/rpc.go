@@ -0,0 +1,74 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+// callRPC serializes v and forwards it to the remote member which serves the
+// route, the call is abandoned once ctx is done
+func callRPC(ctx context.Context, handler rpcHandler, s *session.Session, route string, v interface{}) error {
+	// TODO: buffer
+	data, err := message.Serialize(v)
+	if err != nil {
+		return err
+	}
+	msg := &message.Message{
+		Type:  message.Notify,
+		Route: route,
+		Data:  data,
+	}
+	return handler(ctx, s, msg, true)
+}
+
+// callRPCWithFallback calls the route with a deadline, the fallback is called with
+// the error if the call is failed or timed out, and its result is returned instead
+func callRPCWithFallback(handler rpcHandler, reporters []metrics.Reporter, s *session.Session,
+	route string, v interface{}, timeout time.Duration, fallback func(error) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := callRPC(ctx, handler, s, route, v)
+	if err == nil {
+		return nil
+	}
+	metrics.ReportRPCFallback(reporters, route)
+	if fallback == nil {
+		return err
+	}
+	return fallback(err)
+}
+
+// logRPC logs the error of the fire-and-forget RPC
+func logRPC(route string, err error) error {
+	if err != nil {
+		log.Println(fmt.Sprintf("nano/rpc: %s error: %v", route, err))
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+func TestAgent_RPCWithFallback(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{MetricsReporters: []metrics.Reporter{reporter}}}
+	h := NewHandler(n, nil)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, h.remoteCall)
+	a.reporters = n.MetricsReporters
+
+	// no member serves the route
+	errDegraded := errors.New("degraded")
+	var cause error
+	err := a.session.RPCWithFallback("Room.Join", []byte("hi"), time.Second, func(err error) error {
+		cause = err
+		return errDegraded
+	})
+	if err != errDegraded {
+		t.Fatalf("expect the result of fallback, got: %v", err)
+	}
+	if cause == nil {
+		t.Fatalf("expect the fallback receives the cause")
+	}
+	if v := reporter.value("rpc_fallback_total{route=Room.Join}"); v != 1 {
+		t.Fatalf("expect 1 fallback, got: %v", v)
+	}
+
+	// the fire-and-forget RPC does not surface the error
+	if err := a.session.RPC("Room.Join", []byte("hi")); err != nil {
+		t.Fatalf("expect nil, got: %v", err)
+	}
+	if err := a.session.RPCContext(context.Background(), "Room.Join", []byte("hi")); err == nil {
+		t.Fatalf("expect the error of forwarding")
+	}
+}
+
+func TestAcceptor_RPCWithFallbackTimeout(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	stall := func(ctx context.Context, s *session.Session, msg *message.Message, noCopy bool) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ac := &acceptor{rpcHandler: stall, reporters: []metrics.Reporter{reporter}}
+	ac.session = session.New(ac)
+
+	err := ac.session.RPCWithFallback("Room.Join", []byte("hi"), 10*time.Millisecond, func(err error) error {
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expect deadline exceeded, got: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expect the fallback answers the call, got: %v", err)
+	}
+	if v := reporter.value("rpc_fallback_total{route=Room.Join}"); v != 1 {
+		t.Fatalf("expect 1 fallback, got: %v", v)
+	}
+
+	// the call succeeds within the deadline
+	ac.rpcHandler = func(ctx context.Context, s *session.Session, msg *message.Message, noCopy bool) error { return nil }
+	err = ac.session.RPCWithFallback("Room.Join", []byte("hi"), time.Second, func(err error) error {
+		t.Fatalf("unexpected fallback: %v", err)
+		return nil
+	})
+	if err != nil || reporter.value("rpc_fallback_total{route=Room.Join}") != 1 {
+		t.Fatalf("unexpected fallback, err: %v", err)
+	}
+}
+
+// flushReporter counts the flushes of metrics
+type flushReporter struct {
+	seriesReporter
+	flushed int32
+}
+
+func (r *flushReporter) Flush(metrics.FlushConfig) error {
+	atomic.AddInt32(&r.flushed, 1)
+	return nil
+}
+
+func TestNode_FlushOnPanic(t *testing.T) {
+	reporter := &flushReporter{seriesReporter: seriesReporter{series: map[string]float64{}}}
+	n := &Node{Options: Options{MetricsReporters: []metrics.Reporter{reporter}, MetricsFlush: &metrics.FlushConfig{}}}
+
+	n.flushOnPanic(context.Background(), nil, nil, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	if flushed := atomic.LoadInt32(&reporter.flushed); flushed != 0 {
+		t.Fatalf("expect no flush, got: %d", flushed)
+	}
+
+	// the panic of the gRPC handler is propagated after the metrics are flushed
+	func() {
+		defer func() {
+			if err := recover(); err != "boom" {
+				t.Fatalf("expect the panic propagated, got: %v", err)
+			}
+		}()
+		n.flushOnPanic(context.Background(), nil, nil, func(context.Context, interface{}) (interface{}, error) {
+			panic("boom")
+		})
+	}()
+	if flushed := atomic.LoadInt32(&reporter.flushed); flushed != 1 {
+		t.Fatalf("expect the metrics flushed, got: %d", flushed)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package cluster
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lonng/nano/cluster/clusterpb"
+	"google.golang.org/grpc"
+)
+
+// RPCTransport carries the RPCs between the members of the cluster instead of
+// the direct gRPC connections, e.g: the NATS transport of package cluster/nats,
+// which saves a full mesh of connections between the nodes. The members are
+// addressed by their service addresses as with gRPC.
+type RPCTransport interface {
+	// RegisterService registers the implementation of the service, which is
+	// served once Serve is called
+	RegisterService(desc *grpc.ServiceDesc, impl interface{})
+	// Serve serves the services registered for the service address, and returns
+	// once the RPCs can be received
+	Serve(addr string) error
+	// Invoke calls the method of the member serving at addr, the method is the
+	// full name of gRPC method, e.g: "/clusterpb.Member/HandleRequest"
+	Invoke(ctx context.Context, addr, method string, in, out proto.Message) error
+	// Close stops serving and releases the resources
+	Close() error
+}
+
+// memberClient returns the client of the Member service served at addr
+func (c *rpcClient) memberClient(addr string) (clusterpb.MemberClient, error) {
+	if c.transport != nil {
+		return clusterpb.NewMemberInvokerClient(c.invoker(addr)), nil
+	}
+	pool, err := c.getConnPool(addr)
+	if err != nil {
+		return nil, err
+	}
+	return clusterpb.NewMemberClient(pool.Get()), nil
+}
+
+// masterClient returns the client of the Master service served at addr
+func (c *rpcClient) masterClient(addr string) (clusterpb.MasterClient, error) {
+	if c.transport != nil {
+		return clusterpb.NewMasterInvokerClient(c.invoker(addr)), nil
+	}
+	pool, err := c.getConnPool(addr)
+	if err != nil {
+		return nil, err
+	}
+	return clusterpb.NewMasterClient(pool.Get()), nil
+}
+
+func (c *rpcClient) invoker(addr string) clusterpb.Invoker {
+	return func(ctx context.Context, method string, in, out proto.Message) error {
+		return c.transport.Invoke(ctx, addr, method, in, out)
+	}
+}
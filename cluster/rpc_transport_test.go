@@ -0,0 +1,128 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lonng/nano/component"
+	"google.golang.org/grpc"
+)
+
+// memoryBus connects the memoryTransports in the same process
+type memoryBus struct {
+	mu      sync.RWMutex
+	members map[string]map[string]grpc.MethodDesc
+	impls   map[string]map[string]interface{}
+}
+
+// memoryTransport is a RPCTransport which calls the methods of members directly,
+// the messages are encoded to simulate the network
+type memoryTransport struct {
+	bus     *memoryBus
+	methods map[string]grpc.MethodDesc
+	impls   map[string]interface{}
+}
+
+func (t *memoryTransport) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	for _, m := range desc.Methods {
+		name := "/" + desc.ServiceName + "/" + m.MethodName
+		t.methods[name] = m
+		t.impls[name] = impl
+	}
+}
+
+func (t *memoryTransport) Serve(addr string) error {
+	t.bus.mu.Lock()
+	defer t.bus.mu.Unlock()
+	t.bus.members[addr] = t.methods
+	t.bus.impls[addr] = t.impls
+	return nil
+}
+
+func (t *memoryTransport) Invoke(ctx context.Context, addr, method string, in, out proto.Message) error {
+	t.bus.mu.RLock()
+	m, ok := t.bus.members[addr][method]
+	impl := t.bus.impls[addr][method]
+	t.bus.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("method %s of %s not found", method, addr)
+	}
+
+	data, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := m.Handler(impl, ctx, func(v interface{}) error {
+		return proto.Unmarshal(data, v.(proto.Message))
+	}, nil)
+	if err != nil {
+		return err
+	}
+	data, err = proto.Marshal(resp.(proto.Message))
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, out)
+}
+
+func (t *memoryTransport) Close() error {
+	return nil
+}
+
+func (b *memoryBus) transport() *memoryTransport {
+	return &memoryTransport{bus: b, methods: map[string]grpc.MethodDesc{}, impls: map[string]interface{}{}}
+}
+
+func TestNode_RPCTransport(t *testing.T) {
+	bus := &memoryBus{members: map[string]map[string]grpc.MethodDesc{}, impls: map[string]map[string]interface{}{}}
+
+	lobbyComps := &component.Components{}
+	lobbyComps.Register(&LobbyComponent{})
+	master := &Node{
+		Options:     Options{Components: lobbyComps, IsMaster: true, RPCTransport: bus.transport()},
+		ServiceAddr: "lobby",
+	}
+	if err := master.Startup(); err != nil {
+		t.Fatal(err)
+	}
+	defer master.Shutdown()
+
+	roomComps := &component.Components{}
+	roomComps.Register(&RoomComponent{})
+	room := &Node{
+		Options:     Options{Components: roomComps, AdvertiseAddr: "lobby", RPCTransport: bus.transport()},
+		ServiceAddr: "room",
+	}
+	if err := room.Startup(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the members are registered to master by the transport without listening
+	waitServices(t, master.Handler(), []string{"RoomComponent"})
+	waitServices(t, room.Handler(), []string{"LobbyComponent"})
+
+	room.Shutdown()
+	waitServices(t, master.Handler(), nil)
+}
@@ -0,0 +1,284 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"sync"
+
+	"github.com/lonng/nano/session"
+)
+
+const (
+	// DefaultSendQueueSize is the number of messages can be queued for each session
+	// if the size is not specified
+	DefaultSendQueueSize = agentWriteBacklog
+
+	// priorityLevels is the number of distinct priority levels of the send queue
+	priorityLevels = session.PriorityCritical - session.PriorityLow + 1
+
+	// agingThreshold is the number of times a non-empty level can be passed over
+	// by higher levels before it is served regardless of its priority
+	agingThreshold = 8
+)
+
+// OverflowPolicy decides what to do when a message is pushed to a session whose
+// send queue is full, e.g: the client is on a slow mobile network
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the sender until the queue has room, a slow client
+	// stalls the broadcasters pushing to it
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest message of the lowest priority to make
+	// room, the pushed message is dropped if all queued messages have a higher
+	// priority
+	OverflowDropOldest
+	// OverflowDropNewest drops the pushed message with ErrSendQueueFull
+	OverflowDropNewest
+	// OverflowClose closes the session
+	OverflowClose
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowDropNewest:
+		return "drop_newest"
+	case OverflowClose:
+		return "close"
+	default:
+		return "block"
+	}
+}
+
+// sendQueue is a bounded priority queue of pending messages. Messages with the
+// same priority are delivered in FIFO order, and a non-empty level which has been
+// skipped agingThreshold times is served next, so low priority messages can not
+// be starved by a burst of high priority ones.
+type sendQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	levels  [priorityLevels][]pendingMessage
+	skipped [priorityLevels]int
+	size    int
+	backlog int
+	closed  bool
+
+	// policy is applied when a message is pushed to the full queue, and overflow
+	// is called with it if set
+	policy   OverflowPolicy
+	overflow func(policy OverflowPolicy)
+
+	// ready receives a signal when the queue transits to non-empty
+	ready chan struct{}
+}
+
+func newSendQueue(backlog int) *sendQueue {
+	q := &sendQueue{
+		backlog: backlog,
+		ready:   make(chan struct{}, 1),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// clampPriority maps an arbitrary priority to a valid queue level
+func clampPriority(priority int) int {
+	if priority < session.PriorityLow {
+		priority = session.PriorityLow
+	}
+	if priority > session.PriorityCritical {
+		priority = session.PriorityCritical
+	}
+	return priority - session.PriorityLow
+}
+
+// push appends a message to the queue, the overflow policy is applied when the
+// queue is full. ErrBrokenPipe is returned if the queue has been closed.
+func (q *sendQueue) push(m pendingMessage, priority int) error {
+	q.mu.Lock()
+	for q.policy == OverflowBlock && q.size >= q.backlog && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		q.mu.Unlock()
+		return ErrBrokenPipe
+	}
+	level := clampPriority(priority)
+	if q.size >= q.backlog {
+		return q.overflowed(m, level)
+	}
+	q.levels[level] = append(q.levels[level], m)
+	q.size++
+	q.mu.Unlock()
+
+	q.notify()
+	return nil
+}
+
+// overflowed applies the overflow policy to the message pushed to the full queue,
+// it is called with the lock held and releases it.
+func (q *sendQueue) overflowed(m pendingMessage, level int) error {
+	err := ErrSendQueueFull
+	var dropped *pendingMessage
+	switch q.policy {
+	case OverflowDropOldest:
+		for i := 0; i <= level; i++ {
+			if len(q.levels[i]) == 0 {
+				continue
+			}
+			oldest := q.levels[i][0]
+			dropped = &oldest
+			q.levels[i][0] = pendingMessage{}
+			q.levels[i] = q.levels[i][1:]
+			q.levels[level] = append(q.levels[level], m)
+			err = nil
+			break
+		}
+	case OverflowClose:
+		q.closed = true
+		err = ErrBrokenPipe
+	}
+	q.mu.Unlock()
+
+	if dropped != nil {
+		dropped.discard(ErrSendQueueFull)
+	}
+	if q.overflow != nil {
+		q.overflow(q.policy)
+	}
+	if err == nil {
+		q.notify()
+	}
+	return err
+}
+
+// pop removes the next message which should be written, the second return
+// value is false if the queue is empty.
+func (q *sendQueue) pop() (pendingMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.size == 0 {
+		return pendingMessage{}, false
+	}
+
+	// serve the most starved level first, otherwise the highest non-empty level
+	level := -1
+	for i := 0; i < priorityLevels; i++ {
+		if len(q.levels[i]) > 0 && q.skipped[i] >= agingThreshold {
+			level = i
+			break
+		}
+	}
+	if level < 0 {
+		for i := priorityLevels - 1; i >= 0; i-- {
+			if len(q.levels[i]) > 0 {
+				level = i
+				break
+			}
+		}
+	}
+
+	for i := 0; i < level; i++ {
+		if len(q.levels[i]) > 0 {
+			q.skipped[i]++
+		}
+	}
+	q.skipped[level] = 0
+
+	m := q.levels[level][0]
+	q.levels[level][0] = pendingMessage{}
+	q.levels[level] = q.levels[level][1:]
+	q.size--
+	if q.size > 0 {
+		q.notify()
+	}
+	q.cond.Signal()
+	return m, true
+}
+
+// len returns the number of pending messages
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// close wakes up all blocked producers and rejects subsequent messages
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// discard releases the resources held by a queued message which will never be
+// written, the sender of a raw payload receives err
+func (m pendingMessage) discard(err error) {
+	if m.done != nil {
+		m.done <- err
+	}
+	if m.shared != nil {
+		m.shared.Release()
+	}
+}
+
+func (q *sendQueue) notify() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// sendQueueDepths returns the number of messages pending in the send queue of each
+// session of current node
+func (n *Node) sendQueueDepths() []int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	depths := make([]int, 0, len(n.sessions))
+	for _, s := range n.sessions {
+		if a, ok := s.NetworkEntity().(*agent); ok {
+			depths = append(depths, a.chSend.len())
+		}
+	}
+	return depths
+}
+
+// sendQueueStats returns the number of messages pending in the send queues of the
+// sessions of current node, and the largest fraction of a send queue occupied
+func (n *Node) sendQueueStats() (pending int, saturation float64) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for _, s := range n.sessions {
+		a, ok := s.NetworkEntity().(*agent)
+		if !ok {
+			continue
+		}
+		size := a.chSend.len()
+		pending += size
+		if f := float64(size) / float64(a.chSend.backlog); f > saturation {
+			saturation = f
+		}
+	}
+	return pending, saturation
+}
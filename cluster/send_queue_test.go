@@ -0,0 +1,164 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lonng/nano/session"
+)
+
+func TestSendQueue_Priority(t *testing.T) {
+	q := newSendQueue(16)
+	q.push(pendingMessage{route: "low"}, session.PriorityLow)
+	q.push(pendingMessage{route: "normal1"}, session.PriorityNormal)
+	q.push(pendingMessage{route: "critical"}, session.PriorityCritical)
+	q.push(pendingMessage{route: "normal2"}, session.PriorityNormal)
+
+	expect := []string{"critical", "normal1", "normal2", "low"}
+	for _, route := range expect {
+		m, ok := q.pop()
+		if !ok {
+			t.Fatalf("expect: %s, got empty queue", route)
+		}
+		if m.route != route {
+			t.Fatalf("expect: %s, got: %s", route, m.route)
+		}
+	}
+	if _, ok := q.pop(); ok {
+		t.Fatal("expect empty queue")
+	}
+}
+
+func TestSendQueue_Aging(t *testing.T) {
+	q := newSendQueue(agingThreshold * 4)
+	q.push(pendingMessage{route: "low"}, session.PriorityLow)
+	for i := 0; i < agingThreshold*2; i++ {
+		q.push(pendingMessage{route: "high"}, session.PriorityHigh)
+	}
+
+	for i := 0; i < agingThreshold; i++ {
+		m, _ := q.pop()
+		if m.route != "high" {
+			t.Fatalf("pop %d expect: high, got: %s", i, m.route)
+		}
+	}
+	if m, _ := q.pop(); m.route != "low" {
+		t.Fatalf("expect starved message to be served, got: %s", m.route)
+	}
+}
+
+func TestSendQueue_Close(t *testing.T) {
+	q := newSendQueue(1)
+	if err := q.push(pendingMessage{}, session.PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- q.push(pendingMessage{}, session.PriorityNormal)
+	}()
+	q.close()
+	if err := <-done; err != ErrBrokenPipe {
+		t.Fatalf("expect: %v, got: %v", ErrBrokenPipe, err)
+	}
+}
+
+func TestSendQueue_Overflow(t *testing.T) {
+	cases := []struct {
+		policy OverflowPolicy
+		err    error
+		routes []string
+	}{
+		{OverflowDropOldest, nil, []string{"critical", "normal2", "normal3"}},
+		{OverflowDropNewest, ErrSendQueueFull, []string{"critical", "normal2", "low"}},
+		{OverflowClose, ErrBrokenPipe, []string{"critical", "normal2", "low"}},
+	}
+	for _, c := range cases {
+		var overflows []OverflowPolicy
+		q := newSendQueue(3)
+		q.policy = c.policy
+		q.overflow = func(policy OverflowPolicy) { overflows = append(overflows, policy) }
+		q.push(pendingMessage{route: "low"}, session.PriorityLow)
+		q.push(pendingMessage{route: "critical"}, session.PriorityCritical)
+		q.push(pendingMessage{route: "normal2"}, session.PriorityNormal)
+
+		if err := q.push(pendingMessage{route: "normal3"}, session.PriorityNormal); err != c.err {
+			t.Fatalf("%v expect: %v, got: %v", c.policy, c.err, err)
+		}
+		if len(overflows) != 1 || overflows[0] != c.policy {
+			t.Fatalf("%v expect the overflow reported, got: %v", c.policy, overflows)
+		}
+		var routes []string
+		for m, ok := q.pop(); ok; m, ok = q.pop() {
+			routes = append(routes, m.route)
+		}
+		if fmt.Sprint(routes) != fmt.Sprint(c.routes) {
+			t.Fatalf("%v expect: %v, got: %v", c.policy, c.routes, routes)
+		}
+	}
+}
+
+func TestSendQueue_DropOldestHigherPriority(t *testing.T) {
+	q := newSendQueue(1)
+	q.policy = OverflowDropOldest
+	done := make(chan error, 1)
+	q.push(pendingMessage{route: "raw", done: done}, session.PriorityCritical)
+
+	// the queued messages of higher priority are kept
+	if err := q.push(pendingMessage{route: "low"}, session.PriorityLow); err != ErrSendQueueFull {
+		t.Fatalf("expect: %v, got: %v", ErrSendQueueFull, err)
+	}
+
+	// the sender of the dropped raw payload is notified
+	if err := q.push(pendingMessage{route: "critical"}, session.PriorityCritical); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != ErrSendQueueFull {
+		t.Fatalf("expect: %v, got: %v", ErrSendQueueFull, err)
+	}
+	if m, _ := q.pop(); m.route != "critical" {
+		t.Fatalf("expect: critical, got: %s", m.route)
+	}
+}
+
+func TestAgent_SendQueueOverflowClose(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	a := newAgent(server, nil, nil, nil)
+	a.chSend = newSendQueue(1)
+	a.chSend.policy = OverflowClose
+	a.chSend.overflow = a.overflow
+	if err := a.Push("room.update", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Push("room.update", []byte("2")); err != ErrBrokenPipe {
+		t.Fatalf("expect: %v, got: %v", ErrBrokenPipe, err)
+	}
+	if a.status() != statusClosed {
+		t.Fatalf("expect the agent closed")
+	}
+}
+
+func TestNode_SendQueueStats(t *testing.T) {
+	n := &Node{}
+	n.sessions = map[int64]*session.Session{}
+	for i := 1; i <= 2; i++ {
+		server, client := net.Pipe()
+		defer client.Close()
+		a := newAgent(server, nil, nil, nil)
+		for j := 0; j < i*2; j++ {
+			a.chSend.push(pendingMessage{route: "Room.Message"}, session.PriorityNormal)
+		}
+		n.sessions[a.session.ID()] = a.session
+	}
+
+	pending, saturation := n.sendQueueStats()
+	if pending != 6 {
+		t.Fatalf("expect: 6, got: %d", pending)
+	}
+	if expect := 4 / float64(agentWriteBacklog); saturation != expect {
+		t.Fatalf("expect: %v, got: %v", expect, saturation)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/session"
+)
+
+// storeBacklog is the number of session store operations can be queued before the
+// lifetime hooks block
+const storeBacklog = 1024
+
+// initStore starts the goroutine running the operations of the session store in
+// order, so that the lifetime hooks are not blocked by the store
+func (n *Node) initStore() {
+	if n.SessionStore == nil {
+		return
+	}
+	n.storeOps = make(chan func(), storeBacklog)
+	go func() {
+		for op := range n.storeOps {
+			op()
+		}
+	}()
+}
+
+// storeBind records the binding of the session in the session store, and unbinds
+// the previous uid of the session if it is rebound
+func (n *Node) storeBind(s *session.Session, old int64) {
+	if n.storeOps == nil {
+		return
+	}
+	uid, sid := s.UID(), s.ID()
+	n.storeOps <- func() {
+		if old > 0 {
+			if err := n.SessionStore.Unbind(old, sid); err != nil {
+				log.Println("Unbind user from session store failed", old, err)
+			}
+		}
+		if err := n.SessionStore.Bind(uid, sid, n.ServiceAddr); err != nil {
+			log.Println("Bind user to session store failed", uid, err)
+		}
+	}
+}
+
+// storeUnbind saves the data of the closed session and removes its binding from
+// the session store, the data is encoded before the session is cleared
+func (n *Node) storeUnbind(s *session.Session, uid int64) {
+	if n.storeOps == nil {
+		return
+	}
+	sid, data := s.ID(), encodeAttributes(s.State())
+	n.storeOps <- func() {
+		if err := n.SessionStore.Save(uid, data); err != nil {
+			log.Println("Save session data to session store failed", uid, err)
+		}
+		if err := n.SessionStore.Unbind(uid, sid); err != nil {
+			log.Println("Unbind user from session store failed", uid, err)
+		}
+	}
+}
+
+// restoreSession loads the data saved for the uid of the session, the keys which
+// have been set on the session are not overwritten. It waits for the operations
+// queued before, e.g: the data saved by the previous session of the uid.
+func (n *Node) restoreSession(s *session.Session) {
+	if n.storeOps == nil {
+		return
+	}
+	uid := s.UID()
+	done := make(chan map[string][]byte, 1)
+	n.storeOps <- func() {
+		data, err := n.SessionStore.Load(uid)
+		if err != nil {
+			log.Println("Load session data from session store failed", uid, err)
+			close(done)
+			return
+		}
+		done <- data
+	}
+	data, ok := <-done
+	if !ok {
+		return
+	}
+	for k, v := range decodeAttributes(data) {
+		if !s.HasKey(k) {
+			s.Set(k, v)
+		}
+	}
+	session.Lifetime.Publish(session.Event{Type: session.EventDataSynced, Session: s})
+}
@@ -0,0 +1,192 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"runtime/debug"
+	"sync"
+
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+type (
+	// responseTaps records the responses of the requests whose handler is
+	// shadowed, keyed by the request id
+	responseTaps struct {
+		taps sync.Map
+	}
+
+	responseTap struct {
+		mu   sync.Mutex
+		data []byte
+	}
+
+	// tapper is implemented by the network entities which record responses
+	tapper interface {
+		tap(mid uint64) *responseTap
+		untap(mid uint64)
+	}
+
+	// shadowCall is the shadow invocation of a request
+	shadowCall struct {
+		fork    *session.Session
+		entity  *shadowEntity
+		tapper  tapper
+		tap     *responseTap
+		primary []byte // response of the primary handler
+	}
+
+	// shadowEntity is the network entity of the sessions forked for shadow
+	// handlers, the response is recorded instead of being sent to the client
+	shadowEntity struct {
+		mid    uint64
+		remote net.Addr
+		resp   responseTap
+	}
+)
+
+func (t *responseTap) set(data []byte) {
+	t.mu.Lock()
+	t.data = data
+	t.mu.Unlock()
+}
+
+func (t *responseTap) get() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.data
+}
+
+func (t *responseTaps) tap(mid uint64) *responseTap {
+	rt := &responseTap{}
+	t.taps.Store(mid, rt)
+	return rt
+}
+
+func (t *responseTaps) untap(mid uint64) {
+	t.taps.Delete(mid)
+}
+
+func (t *responseTaps) record(mid uint64, data []byte) {
+	if rt, ok := t.taps.Load(mid); ok {
+		rt.(*responseTap).set(data)
+	}
+}
+
+// Push implements the session.NetworkEntity interface, pushes of shadow
+// handlers are dropped
+func (e *shadowEntity) Push(route string, v interface{}) error { return nil }
+
+// RPC implements the session.NetworkEntity interface, RPCs of shadow handlers
+// are dropped
+func (e *shadowEntity) RPC(route string, v interface{}) error { return nil }
+
+// LastMid implements the session.NetworkEntity interface
+func (e *shadowEntity) LastMid() uint64 { return e.mid }
+
+// Response implements the session.NetworkEntity interface
+func (e *shadowEntity) Response(v interface{}) error {
+	return e.ResponseMid(e.mid, v)
+}
+
+// ResponseMid implements the session.NetworkEntity interface
+func (e *shadowEntity) ResponseMid(mid uint64, v interface{}) error {
+	if mid != e.mid {
+		return nil
+	}
+	data, err := message.Serialize(v)
+	if err != nil {
+		return err
+	}
+	e.resp.set(data)
+	return nil
+}
+
+// Close implements the session.NetworkEntity interface
+func (e *shadowEntity) Close() error { return nil }
+
+// RemoteAddr implements the session.NetworkEntity interface
+func (e *shadowEntity) RemoteAddr() net.Addr { return e.remote }
+
+// newShadowCall forks the session for the shadow handler of request mid, and
+// records the response of the primary handler until done
+func newShadowCall(s *session.Session, mid uint64) *shadowCall {
+	c := &shadowCall{entity: &shadowEntity{mid: mid, remote: s.RemoteAddr()}}
+	c.fork = s.Fork(c.entity)
+	if t, ok := s.NetworkEntity().(tapper); ok {
+		c.tapper = t
+		c.tap = t.tap(mid)
+	}
+	return c
+}
+
+// done stops recording the response of the primary handler
+func (c *shadowCall) done() {
+	if c.tapper == nil {
+		return
+	}
+	c.primary = c.tap.get()
+	c.tapper.untap(c.entity.mid)
+	c.tapper = nil
+}
+
+// shadow invokes the shadow handler with the forked session, and compares its
+// response with the response of the primary handler
+func (h *LocalHandler) shadow(handler *component.Handler, c *shadowCall, route string, payload []byte) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Println(fmt.Sprintf("Shadow %s panic: %+v\n%s", route, err, debug.Stack()))
+		}
+	}()
+
+	var data interface{}
+	if handler.IsRawArg {
+		data = payload
+	} else {
+		data = reflect.New(handler.Type.Elem()).Interface()
+		if err := env.Serializer.Unmarshal(payload, data); err != nil {
+			log.Println(fmt.Sprintf("Shadow %s deserialize to %T failed: %+v", route, data, err))
+			return
+		}
+	}
+
+	result := handler.Method.Func.Call([]reflect.Value{handler.Receiver, reflect.ValueOf(c.fork), reflect.ValueOf(data)})
+	if len(result) > 0 {
+		if err := result[0].Interface(); err != nil {
+			log.Println(fmt.Sprintf("Shadow %s error: %+v", route, err))
+		}
+	}
+
+	if resp := c.entity.resp.get(); !bytes.Equal(c.primary, resp) {
+		metrics.ReportShadowDiff(h.currentNode.MetricsReporters, route)
+		log.Println(fmt.Sprintf("Shadow %s response differs, UID=%d, MID=%d, Primary=%q, Shadow=%q",
+			route, c.fork.UID(), c.entity.mid, c.primary, resp))
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+type ShadowComponent struct {
+	component.Base
+	upper bool
+}
+
+func (c *ShadowComponent) Echo(s *session.Session, data []byte) error {
+	if c.upper && len(data) > 0 && data[0] >= 'a' && data[0] <= 'z' {
+		data = append([]byte{data[0] - 'a' + 'A'}, data[1:]...)
+	}
+	return s.Response(data)
+}
+
+type diffReporter struct {
+	routes chan string
+}
+
+func (r *diffReporter) ReportCount(metric string, tags map[string]string, count float64) error {
+	if metric == metrics.ShadowDiff {
+		r.routes <- tags["route"]
+	}
+	return nil
+}
+
+func (r *diffReporter) ReportSummary(metric string, tags map[string]string, value float64) error {
+	return nil
+}
+
+func (r *diffReporter) ReportGauge(metric string, tags map[string]string, value float64) error {
+	return nil
+}
+
+func TestHandler_Shadow(t *testing.T) {
+	reporter := &diffReporter{routes: make(chan string, 1)}
+	n := &Node{Options: Options{MetricsReporters: []metrics.Reporter{reporter}}}
+	h := NewHandler(n, nil)
+	opts := []component.Option{
+		component.WithName("Shadow"),
+		component.WithSchedulerName("sync"),
+		component.WithShadow(&ShadowComponent{upper: true}),
+	}
+	if err := h.register(&ShadowComponent{}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	a.session.Set("sync", syncScheduler{})
+
+	// the responses are the same
+	h.localProcess(h.localHandlers["Shadow.Echo"], 1, a.session, &message.Message{
+		Type: message.Request, ID: 1, Route: "Shadow.Echo", Data: []byte("123"),
+	})
+	select {
+	case route := <-reporter.routes:
+		t.Fatalf("unexpected diff of route %s", route)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the responses differ
+	h.localProcess(h.localHandlers["Shadow.Echo"], 2, a.session, &message.Message{
+		Type: message.Request, ID: 2, Route: "Shadow.Echo", Data: []byte("hello"),
+	})
+	select {
+	case route := <-reporter.routes:
+		if route != "Shadow.Echo" {
+			t.Fatalf("expect: Shadow.Echo, got: %s", route)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect the diff to be reported")
+	}
+
+	if l := a.chSend.len(); l != 2 {
+		t.Fatalf("expect: 2 responses sent to client, got: %d", l)
+	}
+	if _, ok := a.responseTaps.taps.Load(uint64(2)); ok {
+		t.Fatal("expect the response to be untapped")
+	}
+}
+
+func TestService_ExtractShadow(t *testing.T) {
+	s := component.NewService(&ShadowComponent{}, []component.Option{component.WithShadow(&LogComponent{})})
+	if err := s.ExtractHandler(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Handlers["Echo"].Shadow == nil {
+		t.Fatal("expect Echo to be shadowed")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lonng/nano/internal/log"
+)
+
+// ShutdownNotice is pushed to all client sessions when the node starts to shut
+// down, so that the clients can finish the current action or tell the players
+// before they are disconnected
+type ShutdownNotice struct {
+	Route string      // route of the push
+	Data  interface{} // payload of the push, which is serialized by the serializer
+}
+
+// drainPollInterval is the interval to check whether the notices have been sent
+const drainPollInterval = 10 * time.Millisecond
+
+// agents returns the agents of the client sessions of current node
+func (n *Node) agents() []*agent {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	var agents []*agent
+	for _, s := range n.sessions {
+		if a, ok := s.NetworkEntity().(*agent); ok {
+			agents = append(agents, a)
+		}
+	}
+	return agents
+}
+
+// notifyShutdown pushes the ShutdownNotice to all client sessions, and waits
+// until the notices are written or ctx is done
+func (n *Node) notifyShutdown(ctx context.Context) {
+	notice := n.ShutdownNotice
+	if notice == nil {
+		return
+	}
+	agents := n.agents()
+	for _, a := range agents {
+		if err := a.Push(notice.Route, notice.Data); err != nil {
+			log.Println(fmt.Sprintf("Push shutdown notice failed: %v, SessionID=%d", err, a.session.ID()))
+		}
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for _, a := range agents {
+		for a.chSend.len() > 0 && a.status() != statusClosed {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				log.Println("Wait for shutdown notices timeout")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/session"
+)
+
+func TestNode_NotifyShutdown(t *testing.T) {
+	n := &Node{Options: Options{ShutdownNotice: &ShutdownNotice{Route: "onClosing", Data: []byte("bye")}}}
+	n.sessions = map[int64]*session.Session{}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	n.sessions[a.session.ID()] = a.session
+	go a.write()
+
+	received := make(chan []*packet.Packet, 1)
+	go func() {
+		buf := make([]byte, 1024)
+		decoder := codec.NewDecoder()
+		for {
+			nr, err := client.Read(buf)
+			if err != nil {
+				return
+			}
+			packets, _ := decoder.Decode(buf[:nr])
+			if len(packets) > 0 {
+				received <- packets
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	n.notifyShutdown(ctx)
+	if ctx.Err() != nil {
+		t.Fatalf("expect the notice sent before the deadline")
+	}
+
+	select {
+	case packets := <-received:
+		m, err := message.Decode(packets[0].Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != message.Push || m.Route != "onClosing" || string(m.Data) != "bye" {
+			t.Fatalf("unexpected notice: %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect the shutdown notice received")
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd
+const listenFDsStart = 3
+
+// activatedSocket is a listening socket passed by systemd socket activation
+type activatedSocket struct {
+	name     string // FileDescriptorName of the socket
+	listener net.Listener
+}
+
+var activation struct {
+	once    sync.Once
+	mu      sync.Mutex
+	sockets []activatedSocket // sockets not taken yet, in the order of fds
+	err     error
+}
+
+// parseListenFDs parses the environment variables of systemd socket activation,
+// and returns the names of the file descriptors from listenFDsStart. The sockets
+// without FileDescriptorName are named "unknown" as systemd does.
+func parseListenFDs(pid, fds, names string) ([]string, error) {
+	if pid == "" || fds == "" {
+		return nil, nil
+	}
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		// the sockets are passed to another process, e.g: the parent process
+		return nil, nil
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("systemd: invalid LISTEN_FDS %q", fds)
+	}
+	var list []string
+	if names != "" {
+		list = strings.Split(names, ":")
+	}
+	result := make([]string, count)
+	for i := range result {
+		result[i] = "unknown"
+		if i < len(list) && list[i] != "" {
+			result[i] = list[i]
+		}
+	}
+	return result, nil
+}
+
+// activatedSockets takes over the sockets passed by systemd, which is done
+// once for the lifetime of the process
+func activatedSockets() {
+	names, err := parseListenFDs(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"))
+	if err != nil {
+		activation.err = err
+		return
+	}
+	for i, name := range names {
+		fd := listenFDsStart + i
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			activation.err = fmt.Errorf("systemd: socket %s(fd %d) is not a stream listener: %v", name, fd, err)
+			return
+		}
+		activation.sockets = append(activation.sockets, activatedSocket{name: name, listener: ln})
+	}
+}
+
+// activatedListener takes the first listener named name among the sockets
+// passed by systemd, or the first one of all sockets if name is empty
+func activatedListener(name string) (net.Listener, error) {
+	activation.once.Do(activatedSockets)
+	if activation.err != nil {
+		return nil, activation.err
+	}
+
+	activation.mu.Lock()
+	defer activation.mu.Unlock()
+	for i, s := range activation.sockets {
+		if name == "" || s.name == name {
+			activation.sockets = append(activation.sockets[:i], activation.sockets[i+1:]...)
+			return s.listener, nil
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("systemd: no socket passed")
+	}
+	return nil, fmt.Errorf("systemd: no socket named %q passed", name)
+}
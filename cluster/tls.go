@@ -0,0 +1,138 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/lonng/nano/internal/log"
+)
+
+// CertReloader loads the certificate from the files, and reloads it when the
+// process receives the signals, so that the certificates can be rotated, e.g:
+// renewed by Let's Encrypt, without restarting the server. It can be used as
+// the GetCertificate of tls.Config.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	signals chan os.Signal
+}
+
+// NewCertReloader returns a reloader which has loaded the certificate
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate from the files, the current certificate is kept
+// if the files are invalid
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the current certificate, which implements the
+// GetCertificate of tls.Config
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch reloads the certificate when the process receives sig, syscall.SIGHUP
+// is watched if sig is empty. It takes no effect if the reloader is watching.
+func (r *CertReloader) Watch(sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.signals != nil {
+		return
+	}
+	r.signals = make(chan os.Signal, 1)
+	signal.Notify(r.signals, sig...)
+	go func(signals chan os.Signal) {
+		for range signals {
+			if err := r.Reload(); err != nil {
+				log.Println(fmt.Sprintf("Reload certificate %s failed: %v", r.certFile, err))
+				continue
+			}
+			log.Println(fmt.Sprintf("Certificate %s reloaded", r.certFile))
+		}
+	}(r.signals)
+}
+
+// Stop stops watching the signals
+func (r *CertReloader) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.signals == nil {
+		return
+	}
+	signal.Stop(r.signals)
+	close(r.signals)
+	r.signals = nil
+}
+
+// serverTLSConfig returns the TLS configuration of the client listeners, which
+// is TLSConfig if present, otherwise it is loaded from TSLCertificate and TSLKey,
+// and the certificate is reloaded on SIGHUP. Nil is returned if TLS is absent.
+func (n *Node) serverTLSConfig() (*tls.Config, error) {
+	n.tlsOnce.Do(func() {
+		switch {
+		case n.TLSConfig != nil:
+			n.tlsConfig = n.TLSConfig
+		case n.TSLCertificate != "" && n.TSLKey != "":
+			r, err := NewCertReloader(n.TSLCertificate, n.TSLKey)
+			if err != nil {
+				n.tlsErr = err
+				return
+			}
+			r.Watch(syscall.SIGHUP)
+			n.certReloader = r
+			n.tlsConfig = &tls.Config{GetCertificate: r.GetCertificate}
+		}
+	})
+	return n.tlsConfig, n.tlsErr
+}
+
+// secure returns whether TLS of the client listeners is configured
+func (n *Node) secure() bool {
+	return n.TLSConfig != nil || (n.TSLCertificate != "" && n.TSLKey != "")
+}
@@ -0,0 +1,245 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/session"
+)
+
+// writeCert writes a self-signed certificate of cn and its key to dir
+func writeCert(t *testing.T, dir, cn string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	return mustParse(t, *cert).Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "old.nano")
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := r.GetCertificate(nil)
+	if cn := commonName(t, cert); cn != "old.nano" {
+		t.Fatalf("expect: old.nano, got: %s", cn)
+	}
+
+	writeCert(t, dir, "new.nano")
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ = r.GetCertificate(nil)
+	if cn := commonName(t, cert); cn != "new.nano" {
+		t.Fatalf("expect: new.nano, got: %s", cn)
+	}
+
+	// the current certificate is kept if the files are invalid
+	ioutil.WriteFile(certFile, []byte("invalid"), 0600)
+	if err := r.Reload(); err == nil {
+		t.Fatalf("expect the invalid certificate refused")
+	}
+	cert, _ = r.GetCertificate(nil)
+	if cn := commonName(t, cert); cn != "new.nano" {
+		t.Fatalf("expect: new.nano, got: %s", cn)
+	}
+
+	r.Watch()
+	r.Stop()
+	r.Stop()
+}
+
+func TestNode_ListenTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCert(t, dir, "game.nano")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(mustParse(t, cert))
+
+	// mutual TLS, the client presents the same certificate for simplicity
+	cache()
+	n := &Node{Options: Options{IsMaster: true, TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}}}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.handler = NewHandler(n, nil)
+	atomic.StoreInt32(&n.running, 1)
+	go n.listenAndServe("127.0.0.1:0")
+	defer func() {
+		atomic.StoreInt32(&n.running, 0)
+		n.closeListeners()
+	}()
+
+	var addr string
+	for deadline := time.Now().Add(time.Second); addr == ""; {
+		n.mu.RLock()
+		if len(n.listeners) > 0 {
+			addr = n.listeners[0].Addr().String()
+		}
+		n.mu.RUnlock()
+		if time.Now().After(deadline) {
+			t.Fatalf("expect the listener started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the client without certificate is refused
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: pool, ServerName: "game.nano"})
+	if err == nil {
+		client := &protocolClient{conn: conn, decoder: codec.NewDecoder()}
+		if _, err := client.handshake(message.V2); err == nil {
+			t.Fatalf("expect the client without certificate refused")
+		}
+		conn.Close()
+	}
+
+	conn, err = tls.Dial("tcp", addr, &tls.Config{RootCAs: pool, ServerName: "game.nano", Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := &protocolClient{conn: conn, decoder: codec.NewDecoder()}
+	if version, err := client.handshake(message.V2); err != nil || version != message.V2 {
+		t.Fatalf("expect handshake with V2, got: %d %v", version, err)
+	}
+}
+
+func TestNode_ListenTLSCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCert(t, dir, "game.nano")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(mustParse(t, cert))
+
+	// the TCP acceptor serves TLS with the certificate files like WSS
+	cache()
+	n := &Node{Options: Options{IsMaster: true, TSLCertificate: certFile, TSLKey: keyFile}}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.handler = NewHandler(n, nil)
+	atomic.StoreInt32(&n.running, 1)
+	go n.listenAndServe("127.0.0.1:0")
+	defer func() {
+		atomic.StoreInt32(&n.running, 0)
+		n.closeListeners()
+		n.certReloader.Stop()
+	}()
+
+	var addr string
+	for deadline := time.Now().Add(time.Second); addr == ""; {
+		n.mu.RLock()
+		if len(n.listeners) > 0 {
+			addr = n.listeners[0].Addr().String()
+		}
+		n.mu.RUnlock()
+		if time.Now().After(deadline) {
+			t.Fatalf("expect the listener started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: pool, ServerName: "game.nano"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := &protocolClient{conn: conn, decoder: codec.NewDecoder()}
+	if version, err := client.handshake(message.V2); err != nil || version != message.V2 {
+		t.Fatalf("expect handshake with V2, got: %d %v", version, err)
+	}
+}
+
+func mustParse(t *testing.T, cert tls.Certificate) *x509.Certificate {
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -0,0 +1,84 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"strings"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/metrics"
+)
+
+// unknownServerType is the server type of routing failures of the services which
+// have never been served by any member
+const unknownServerType = "unknown"
+
+// memberType parses the server type of member from its label, which is the first
+// item without `=` of the comma separated label, e.g: "game" of "game,weight=4".
+func memberType(label string) string {
+	for _, item := range strings.Split(label, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" && !strings.Contains(item, "=") {
+			return item
+		}
+	}
+	return ""
+}
+
+// reportMemberUp reports the member is up or down, and the number of members of
+// each server type, h.mu should be held by the caller
+func (h *LocalHandler) reportMemberUp(member *clusterpb.MemberInfo, up bool) {
+	reporters := h.currentNode.MetricsReporters
+	if len(reporters) == 0 {
+		return
+	}
+	metrics.ReportClusterMemberUp(reporters, member.ServiceAddr, memberType(member.Label), up)
+
+	// the server types without members are reported as zero
+	counts := make(map[string]int, len(h.serviceTypes))
+	for _, typ := range h.serviceTypes {
+		counts[typ] = 0
+	}
+	seen := map[string]bool{}
+	for _, members := range h.remoteServices {
+		for _, m := range members {
+			if !seen[m.ServiceAddr] {
+				seen[m.ServiceAddr] = true
+				counts[memberType(m.Label)]++
+			}
+		}
+	}
+	for typ, n := range counts {
+		metrics.ReportClusterMembers(reporters, typ, n)
+	}
+}
+
+// reportRoutingFailure reports the message of service cannot be routed since there
+// is no available member
+func (h *LocalHandler) reportRoutingFailure(service string) {
+	h.mu.RLock()
+	typ, ok := h.serviceTypes[service]
+	h.mu.RUnlock()
+	if !ok {
+		typ = unknownServerType
+	}
+	metrics.ReportRoutingFailure(h.currentNode.MetricsReporters, typ)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+)
+
+// seriesReporter records the latest value of each series
+type seriesReporter struct {
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+func (r *seriesReporter) key(metric string, tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return metric + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (r *seriesReporter) ReportCount(metric string, tags map[string]string, count float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series[r.key(metric, tags)] += count
+	return nil
+}
+
+// ReportSummary records the sum of observations
+func (r *seriesReporter) ReportSummary(metric string, tags map[string]string, value float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series[r.key(metric, tags)] += value
+	return nil
+}
+
+func (r *seriesReporter) ReportGauge(metric string, tags map[string]string, value float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series[r.key(metric, tags)] = value
+	return nil
+}
+
+func (r *seriesReporter) value(series string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.series[series]
+}
+
+func TestMemberType(t *testing.T) {
+	cases := map[string]string{"game": "game", "game,weight=4": "game", "weight=4, chat": "chat", "weight=4": ""}
+	for label, expect := range cases {
+		if typ := memberType(label); typ != expect {
+			t.Fatalf("label: %s, expect: %s, got: %s", label, expect, typ)
+		}
+	}
+}
+
+func TestHandler_TopologyMetrics(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{MetricsReporters: []metrics.Reporter{reporter}}}
+	h := NewHandler(n, nil)
+
+	h.addRemoteService(&clusterpb.MemberInfo{Label: "game", ServiceAddr: "10.0.0.1:3000", Services: []string{"Room", "Match"}})
+	h.addRemoteService(&clusterpb.MemberInfo{Label: "game,weight=2", ServiceAddr: "10.0.0.2:3000", Services: []string{"Room", "Match"}})
+	h.addRemoteService(&clusterpb.MemberInfo{Label: "chat", ServiceAddr: "10.0.0.3:3000", Services: []string{"Chat"}})
+
+	expect := func(series string, value float64) {
+		t.Helper()
+		if v := reporter.value(series); v != value {
+			t.Fatalf("expect %s: %v, got: %v", series, value, v)
+		}
+	}
+	expect("cluster_members{server_type=game}", 2)
+	expect("cluster_members{server_type=chat}", 1)
+	expect("cluster_member_up{server_id=10.0.0.1:3000,server_type=game}", 1)
+
+	h.delMember("10.0.0.1:3000")
+	h.delMember("10.0.0.3:3000")
+	expect("cluster_members{server_type=game}", 1)
+	expect("cluster_members{server_type=chat}", 0)
+	expect("cluster_member_up{server_id=10.0.0.1:3000,server_type=game}", 0)
+	expect("cluster_member_up{server_id=10.0.0.2:3000,server_type=game}", 1)
+
+	// the server type of services is kept after all members are gone
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	h.remoteProcess(a.session, &message.Message{Type: message.Notify, Route: "Chat.Send", Data: []byte("hi")}, false)
+	h.remoteProcess(a.session, &message.Message{Type: message.Notify, Route: "Mail.Send", Data: []byte("hi")}, false)
+	expect("routing_failures_total{server_type=chat}", 1)
+	expect("routing_failures_total{server_type=unknown}", 1)
+}
@@ -0,0 +1,131 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/lonng/nano/internal/log"
+)
+
+// Conn is a client connection of a custom transport, which carries the byte
+// stream of nano packets. The message-oriented transports should buffer the
+// messages to implement Read like the WebSocket acceptor.
+type Conn interface {
+	net.Conn
+}
+
+// Acceptor accepts the client connections of a custom transport, e.g: a relay
+// protocol or an in-process pipe for tests. The connections are served by the
+// same handling loop as the built-in acceptors, including handshake, heartbeat,
+// session limits and metrics.
+type Acceptor interface {
+	// Transport returns the name of transport, which is used as the transport
+	// label of metrics
+	Transport() string
+	// ListenAndServe accepts the connections until Close is called, serve
+	// should be called in a new goroutine for each connection, which blocks
+	// until the connection is closed
+	ListenAndServe(serve func(Conn)) error
+	// Close stops accepting new connections, the connections accepted are
+	// closed by the node
+	Close() error
+}
+
+// serveAcceptor serves the connections of the custom acceptor until closed
+func (n *Node) serveAcceptor(a Acceptor) {
+	transport := a.Transport()
+	err := a.ListenAndServe(func(conn Conn) {
+		fc, err := n.fragmented(conn)
+		if err != nil {
+			log.Println(err.Error())
+			conn.Close()
+			return
+		}
+		n.handler.handle(fc, transport)
+	})
+	if err != nil && n.isRunning() {
+		log.Println(fmt.Sprintf("Acceptor %s exit: %v", transport, err))
+	}
+}
+
+// closeAcceptors stops accepting new clients of the custom acceptors
+func (n *Node) closeAcceptors() {
+	for _, a := range n.Acceptors {
+		if err := a.Close(); err != nil {
+			log.Println(fmt.Sprintf("Close acceptor %s failed: %v", a.Transport(), err))
+		}
+	}
+}
+
+// ErrAcceptorClosed is returned by PipeAcceptor once it has been closed
+var ErrAcceptorClosed = errors.New("acceptor closed")
+
+// PipeAcceptor is an Acceptor of in-process connections, which is useful to
+// test the handlers with real sessions without network
+type PipeAcceptor struct {
+	conns chan Conn
+	once  sync.Once
+	die   chan struct{}
+}
+
+// NewPipeAcceptor returns an acceptor of in-process connections
+func NewPipeAcceptor() *PipeAcceptor {
+	return &PipeAcceptor{conns: make(chan Conn), die: make(chan struct{})}
+}
+
+// Transport implements the Acceptor interface
+func (p *PipeAcceptor) Transport() string {
+	return "pipe"
+}
+
+// Dial returns the client side of a new in-process connection, which blocks
+// until the connection is accepted
+func (p *PipeAcceptor) Dial() (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case p.conns <- server:
+		return client, nil
+	case <-p.die:
+		return nil, ErrAcceptorClosed
+	}
+}
+
+// ListenAndServe implements the Acceptor interface
+func (p *PipeAcceptor) ListenAndServe(serve func(Conn)) error {
+	for {
+		select {
+		case conn := <-p.conns:
+			go serve(conn)
+		case <-p.die:
+			return ErrAcceptorClosed
+		}
+	}
+}
+
+// Close implements the Acceptor interface
+func (p *PipeAcceptor) Close() error {
+	p.once.Do(func() { close(p.die) })
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/session"
+)
+
+func TestNode_ServeAcceptor(t *testing.T) {
+	cache()
+	pipe := NewPipeAcceptor()
+	n := &Node{Options: Options{IsMaster: true, Acceptors: []Acceptor{pipe}}}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.handler = NewHandler(n, nil)
+	atomic.StoreInt32(&n.running, 1)
+
+	done := make(chan struct{})
+	go func() {
+		n.serveAcceptor(pipe)
+		close(done)
+	}()
+
+	conn, err := pipe.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := &protocolClient{conn: conn, decoder: codec.NewDecoder()}
+	if version, err := client.handshake(message.V2); err != nil || version != message.V2 {
+		t.Fatalf("expect handshake with V2, got: %d %v", version, err)
+	}
+	if c := atomic.LoadInt64(n.connectedClients("pipe")); c != 1 {
+		t.Fatalf("expect: 1 pipe client, got: %d", c)
+	}
+
+	atomic.StoreInt32(&n.running, 0)
+	n.closeAcceptors()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expect the acceptor stopped")
+	}
+	if _, err := pipe.Dial(); err != ErrAcceptorClosed {
+		t.Fatalf("expect: %v, got: %v", ErrAcceptorClosed, err)
+	}
+}
@@ -0,0 +1,759 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+const userUpdateBacklog = 1024
+
+// DuplicateLoginPolicy decides what to do when a session is being bound to a uid
+// which has been bound to another session of the same device, e.g: the user logs
+// in on a second phone. The sessions bound with different device tags by
+// Session.BindDevice are not duplicates.
+type DuplicateLoginPolicy int
+
+const (
+	// DuplicateLoginAllow allows multiple sessions bound to the same uid and
+	// device, the messages to the user are delivered to the latest one
+	DuplicateLoginAllow DuplicateLoginPolicy = iota
+	// DuplicateLoginKickOld kicks the old session, a.k.a "new wins"
+	DuplicateLoginKickOld
+	// DuplicateLoginRejectNew rejects the binding of the new session with
+	// ErrDuplicateLogin, a.k.a "old wins"
+	DuplicateLoginRejectNew
+)
+
+func (p DuplicateLoginPolicy) String() string {
+	switch p {
+	case DuplicateLoginKickOld:
+		return "kick_old"
+	case DuplicateLoginRejectNew:
+		return "reject_new"
+	default:
+		return "allow"
+	}
+}
+
+// userUpdate binds or unbinds a uid to current node in the registry of master
+type userUpdate struct {
+	uid  int64
+	bind bool
+}
+
+// userIndex maps the uids to the sessions of current node
+type userIndex struct {
+	users map[int64][]*session.Session // uid -> sessions of each device in binding order
+	uids  map[int64]int64              // session id -> uid
+}
+
+func newUserIndex() *userIndex {
+	return &userIndex{
+		users: map[int64][]*session.Session{},
+		uids:  map[int64]int64{},
+	}
+}
+
+// bind indexes the session of the device, which replaces the session bound to
+// the uid and device before
+func (idx *userIndex) bind(uid int64, s *session.Session) {
+	idx.remove(uid, s.Device())
+	idx.users[uid] = append(idx.users[uid], s)
+	idx.uids[s.ID()] = uid
+}
+
+// remove deletes the session of the device bound to uid, and reports whether the
+// uid is still bound to the sessions of other devices
+func (idx *userIndex) remove(uid int64, device string) bool {
+	sessions := idx.users[uid]
+	for i, s := range sessions {
+		if s.Device() == device {
+			sessions = append(sessions[:i:i], sessions[i+1:]...)
+			break
+		}
+	}
+	if len(sessions) == 0 {
+		delete(idx.users, uid)
+		return false
+	}
+	idx.users[uid] = sessions
+	return true
+}
+
+// current reports whether s is the session of its device bound to uid
+func (idx *userIndex) current(uid int64, s *session.Session) bool {
+	for _, bound := range idx.users[uid] {
+		if bound == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionsPerUID returns the number of sessions of current node bound to each uid
+func (n *Node) sessionsPerUID() []int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.userIndex == nil {
+		return nil
+	}
+	counts := make(map[int64]int, len(n.userIndex.users))
+	for _, uid := range n.userIndex.uids {
+		counts[uid]++
+	}
+	perUID := make([]int, 0, len(counts))
+	for _, c := range counts {
+		perUID = append(perUID, c)
+	}
+	return perUID
+}
+
+// initUsers maintains the uid index of current node, and synchronizes it to the
+// registry of master in cluster mode
+func (n *Node) initUsers() {
+	n.userIndex = newUserIndex()
+	if n.DuplicateLogin != DuplicateLoginAllow || n.DuplicateLoginHook != nil {
+		n.hooks = append(n.hooks, session.Lifetime.OnBinding(n.onSessionBinding))
+	}
+	n.hooks = append(n.hooks,
+		session.Lifetime.OnBind(n.onSessionBind),
+		session.Lifetime.OnClosed(n.onSessionClosed))
+	n.initStore()
+
+	if !n.IsMaster && n.AdvertiseAddr != "" {
+		n.userUpdates = make(chan userUpdate, userUpdateBacklog)
+		n.usersDie = make(chan struct{})
+		go n.syncUsers()
+	}
+}
+
+// closeUsers removes the lifetime hooks of current node, so that the restarted
+// or other nodes of the process are not affected, and stops synchronizing the
+// uid bindings to master
+func (n *Node) closeUsers() {
+	for _, h := range n.hooks {
+		h.Remove()
+	}
+	n.hooks = nil
+
+	if n.usersDie != nil {
+		select {
+		case <-n.usersDie:
+		default:
+			close(n.usersDie)
+		}
+	}
+}
+
+// onSessionBinding applies the duplicate login policy if the uid has been bound
+// to another session of the same device, the policy returned by DuplicateLoginHook
+// takes precedence
+func (n *Node) onSessionBinding(s *session.Session, uid int64) error {
+	local, remote, _, err := n.locateUsers([]int64{uid})
+	if err != nil {
+		// the binding is not blocked by the failures of master
+		log.Println("Locate user failed", uid, err)
+		return nil
+	}
+	device := s.Device()
+	var duplicates []*session.Session
+	for _, bound := range local {
+		if bound != s && bound.Device() == device {
+			duplicates = append(duplicates, bound)
+		}
+	}
+	// the devices of the users served by other nodes are unknown, so only the
+	// local sessions are duplicates of the tagged devices
+	if device != "" {
+		remote = nil
+	}
+	if len(remote) == 0 && len(duplicates) == 0 {
+		return nil
+	}
+
+	policy := n.DuplicateLogin
+	if n.DuplicateLoginHook != nil {
+		policy = n.DuplicateLoginHook(s, uid)
+	}
+	metrics.ReportDuplicateLogin(n.MetricsReporters, policy.String())
+	switch policy {
+	case DuplicateLoginAllow:
+		return nil
+	case DuplicateLoginRejectNew:
+		return ErrDuplicateLogin
+	}
+	// the binding is not blocked by the slow clients of the old sessions or the
+	// round trips to remote nodes
+	go n.kickDuplicates(uid, duplicates, remote)
+	return nil
+}
+
+// kickDuplicates kicks the old sessions of uid replaced by the new login
+func (n *Node) kickDuplicates(uid int64, duplicates []*session.Session, remote map[string][]int64) {
+	for _, old := range duplicates {
+		go kickSession(old, kickReasonDuplicate)
+	}
+	if err := n.kickRemote(remote, kickReasonDuplicate); err != nil && err != ErrUserNotFound {
+		log.Println("Kick duplicate login failed", uid, err)
+	}
+}
+
+func (n *Node) onSessionBind(s *session.Session, _ int64) {
+	n.mu.Lock()
+	if n.sessions[s.ID()] != s {
+		n.mu.Unlock()
+		return
+	}
+	var updates []userUpdate
+	old, found := n.userIndex.uids[s.ID()]
+	if found && n.userIndex.current(old, s) && !n.userIndex.remove(old, s.Device()) {
+		updates = append(updates, userUpdate{uid: old})
+	}
+	n.userIndex.bind(s.UID(), s)
+	updates = append(updates, userUpdate{uid: s.UID(), bind: true})
+	n.mu.Unlock()
+
+	for _, u := range updates {
+		n.updateUser(u)
+	}
+	n.storeBind(s, old)
+	if !found {
+		n.restoreSession(s)
+	}
+}
+
+func (n *Node) onSessionClosed(s *session.Session) {
+	n.mu.Lock()
+	// the sessions of remote clients are removed by SessionClosed already
+	if n.sessions[s.ID()] == s {
+		delete(n.sessions, s.ID())
+	}
+	uid, found := n.userIndex.uids[s.ID()]
+	if !found {
+		n.mu.Unlock()
+		return
+	}
+	delete(n.userIndex.uids, s.ID())
+	current := n.userIndex.current(uid, s)
+	online := current && n.userIndex.remove(uid, s.Device())
+	var latest *session.Session
+	if online {
+		sessions := n.userIndex.users[uid]
+		latest = sessions[len(sessions)-1]
+	}
+	n.mu.Unlock()
+
+	if !current {
+		return
+	}
+	n.storeUnbind(s, uid)
+	if online {
+		// the user is still online on other devices
+		n.storeBind(latest, 0)
+		return
+	}
+	n.updateUser(userUpdate{uid: uid})
+}
+
+// updateUser applies the update to the registry of master, the updates are sent
+// to master in order by syncUsers, and dropped after current node is shut down
+func (n *Node) updateUser(u userUpdate) {
+	switch {
+	case n.IsMaster:
+		if u.bind {
+			n.cluster.bindUser(u.uid, n.ServiceAddr)
+		} else {
+			n.cluster.unbindUser(u.uid, n.ServiceAddr)
+		}
+	case n.userUpdates != nil:
+		select {
+		case n.userUpdates <- u:
+		case <-n.usersDie:
+		}
+	}
+}
+
+func (n *Node) syncUsers() {
+	for {
+		select {
+		case u := <-n.userUpdates:
+			n.syncUser(u)
+		case <-n.usersDie:
+			return
+		}
+	}
+}
+
+// syncUser sends the update of the uid binding to master
+func (n *Node) syncUser(u userUpdate) {
+	client, err := n.rpcClient.masterClient(n.AdvertiseAddr)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if u.bind {
+		_, err = client.BindUser(context.Background(), &clusterpb.BindUserRequest{Uid: u.uid, ServiceAddr: n.ServiceAddr})
+	} else {
+		_, err = client.UnbindUser(context.Background(), &clusterpb.UnbindUserRequest{Uid: u.uid, ServiceAddr: n.ServiceAddr})
+	}
+	if err != nil {
+		log.Println("Sync user to master failed", u.uid, err)
+	}
+}
+
+// FindUser returns the latest session bound to the uid in current node, nil will
+// be returned if the user is not online on current node
+func (n *Node) FindUser(uid int64) *session.Session {
+	return n.findUser(uid)
+}
+
+// findUser returns the latest session bound to the uid in current node
+func (n *Node) findUser(uid int64) *session.Session {
+	sessions := n.findSessions(uid, "")
+	if len(sessions) == 0 {
+		return nil
+	}
+	return sessions[len(sessions)-1]
+}
+
+// findSessions returns the sessions bound to the uid in current node, only the
+// session of device is returned unless device is empty
+func (n *Node) findSessions(uid int64, device string) []*session.Session {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.userIndex == nil {
+		return nil
+	}
+	var sessions []*session.Session
+	for _, s := range n.userIndex.users[uid] {
+		if device == "" || s.Device() == device {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+// locateUsers splits the uids into the sessions of current node and the uids of
+// each remote node, the uids can not be found are returned as missing
+func (n *Node) locateUsers(uids []int64) ([]*session.Session, map[string][]int64, []int64, error) {
+	return n.locateDevices(uids, "")
+}
+
+// locateDevices is the same as locateUsers, but only the sessions of device are
+// located unless device is empty. The users may be served by current node and
+// other nodes at the same time, e.g: the devices connected to different frontends,
+// so the remote nodes are always looked up.
+func (n *Node) locateDevices(uids []int64, device string) ([]*session.Session, map[string][]int64, []int64, error) {
+	var local []*session.Session
+	found := make(map[int64]bool, len(uids))
+	for _, uid := range uids {
+		if sessions := n.findSessions(uid, device); len(sessions) > 0 {
+			local = append(local, sessions...)
+			found[uid] = true
+		}
+	}
+
+	nodes, err := n.lookupUsers(uids)
+	if err != nil {
+		if len(local) == 0 {
+			return nil, nil, nil, err
+		}
+		// the local sessions are still delivered if the remote ones are unknown
+		log.Println("Locate remote users failed", err)
+	}
+
+	var missing []int64
+	remote := map[string][]int64{}
+	for _, uid := range uids {
+		for _, addr := range nodes[uid] {
+			if addr == n.ServiceAddr {
+				continue
+			}
+			remote[addr] = append(remote[addr], uid)
+			found[uid] = true
+		}
+		if !found[uid] {
+			missing = append(missing, uid)
+		}
+	}
+	return local, remote, missing, nil
+}
+
+// lookupUsers returns the service addresses of the nodes serving each uid, which
+// are located by the session store or the registry of master in cluster mode
+func (n *Node) lookupUsers(uids []int64) (map[int64][]string, error) {
+	switch {
+	case n.SessionStore != nil:
+		addrs, err := n.SessionStore.Locate(uids)
+		if err != nil {
+			return nil, err
+		}
+		nodes := make(map[int64][]string, len(addrs))
+		for uid, addr := range addrs {
+			nodes[uid] = []string{addr}
+		}
+		return nodes, nil
+	case n.IsMaster:
+		return n.cluster.findUsers(uids), nil
+	case n.AdvertiseAddr != "":
+		client, err := n.rpcClient.masterClient(n.AdvertiseAddr)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.FindUsers(context.Background(), &clusterpb.FindUsersRequest{Uids: uids})
+		if err != nil {
+			return nil, err
+		}
+		nodes := map[int64][]string{}
+		for _, node := range resp.Nodes {
+			nodes[node.Uid] = append(nodes[node.Uid], node.Addr)
+		}
+		return nodes, nil
+	}
+	return nil, nil
+}
+
+// SendToUser pushes the message to the sessions bound to uid, i.e. all devices of
+// the user, which may be served by other nodes in cluster mode. ErrUserNotFound will be returned if the uid has
+// not been bound to any session.
+func (n *Node) SendToUser(uid int64, route string, v interface{}) error {
+	missing, err := n.MultiSend([]int64{uid}, route, v)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// MultiSend pushes the message to the sessions bound to uids, the messages to the
+// users of the same remote node are forwarded in one RPC. The uids which have not
+// been bound to any session are returned, and the message is delivered to them by
+// the push fallback if it is an OfflineNotification.
+func (n *Node) MultiSend(uids []int64, route string, v interface{}) (missing []int64, err error) {
+	defer func() {
+		if err == nil {
+			n.deliverOffline(missing, route, v)
+		}
+	}()
+	return n.multiSend(uids, "", route, v)
+}
+
+// PushToUID pushes the message to the sessions bound to uid, which are located by
+// the session store or the registry of master in cluster mode, so that the backend
+// nodes can push to the users connected to any frontend node. It reports whether
+// the message is delivered to a session of the user, false if the user is not
+// online, and the push fallback is not applied.
+func (n *Node) PushToUID(uid int64, route string, v interface{}) (bool, error) {
+	missing, err := n.multiSend([]int64{uid}, "", route, v)
+	return len(missing) == 0, err
+}
+
+// SendToDevice pushes the message to the session of the device bound to uid, e.g:
+// the companion app of the user, ErrUserNotFound will be returned if the user is
+// not online on the device. The message is pushed to all devices of the user if
+// device is empty, and it is not delivered by the push fallback.
+func (n *Node) SendToDevice(uid int64, device, route string, v interface{}) error {
+	missing, err := n.multiSend([]int64{uid}, device, route, v)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// multiSend pushes the message to the sessions of device bound to uids, and returns
+// the uids whose message is not delivered to any session
+func (n *Node) multiSend(uids []int64, device, route string, v interface{}) ([]int64, error) {
+	data, err := message.Serialize(v)
+	if err != nil {
+		return nil, err
+	}
+	local, remote, _, err := n.locateDevices(uids, device)
+	if err != nil {
+		return nil, err
+	}
+
+	delivered := make(map[int64]bool, len(uids))
+	shared := session.NewSharedMessage(route, data)
+	defer shared.Release()
+	for _, s := range local {
+		if e := s.PushShared(shared); e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		delivered[s.UID()] = true
+	}
+	for addr, ids := range remote {
+		client, e := n.rpcClient.memberClient(addr)
+		if e != nil {
+			log.Println(e)
+			continue
+		}
+		request := &clusterpb.PushToUsersRequest{Uids: ids, Route: route, Data: data, Device: device}
+		resp, e := client.PushToUsers(context.Background(), request)
+		if e != nil {
+			log.Println(e)
+			continue
+		}
+		// the registry is stale if the user has left the node
+		stale := make(map[int64]bool, len(resp.Missing))
+		for _, uid := range resp.Missing {
+			stale[uid] = true
+		}
+		for _, uid := range ids {
+			if !stale[uid] {
+				delivered[uid] = true
+			}
+		}
+	}
+
+	var missing []int64
+	for _, uid := range uids {
+		if !delivered[uid] {
+			missing = append(missing, uid)
+		}
+	}
+	return missing, err
+}
+
+// KickUser sends a kick packet with the reason to the sessions bound to uid and
+// closes them, ErrUserNotFound will be returned if the uid has not been bound to
+// any session.
+func (n *Node) KickUser(uid int64, reason string) error {
+	local, remote, missing, err := n.locateUsers([]int64{uid})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return ErrUserNotFound
+	}
+
+	for _, s := range local {
+		kickSession(s, reason)
+	}
+	return n.kickRemote(remote, reason)
+}
+
+// kickRemote kicks the users of each remote node with the reason
+func (n *Node) kickRemote(remote map[string][]int64, reason string) error {
+	for addr, uids := range remote {
+		client, err := n.rpcClient.memberClient(addr)
+		if err != nil {
+			return err
+		}
+		request := &clusterpb.KickUsersRequest{Uids: uids, Reason: reason}
+		resp, err := client.KickUsers(context.Background(), request)
+		if err != nil {
+			return err
+		}
+		if len(resp.Missing) > 0 {
+			return ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+// KickUID pushes the reason to the sessions bound to uid with the route
+// session.KickRoute and closes them, ErrUserNotFound will be returned if the uid
+// has not been bound to any session. The reason is serialized once here and
+// forwarded to the frontend node serving the user in cluster mode.
+func (n *Node) KickUID(uid int64, reason interface{}) error {
+	data, err := message.Serialize(reason)
+	if err != nil {
+		return err
+	}
+	local, remote, missing, err := n.locateUsers([]int64{uid})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return ErrUserNotFound
+	}
+
+	for _, s := range local {
+		if err := s.Kick(data); err != nil {
+			log.Println(err)
+		}
+	}
+	for addr, uids := range remote {
+		client, err := n.rpcClient.memberClient(addr)
+		if err != nil {
+			return err
+		}
+		request := &clusterpb.KickUsersRequest{Uids: uids, Data: data}
+		resp, err := client.KickUsers(context.Background(), request)
+		if err != nil {
+			return err
+		}
+		if len(resp.Missing) > 0 {
+			return ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+// kickSession sends a kick packet with the reason through the send queue of the
+// agent, which is closed once the packet has been flushed, the sessions of other
+// entities are closed directly
+func kickSession(s *session.Session, reason string) {
+	a, ok := s.NetworkEntity().(*agent)
+	if !ok {
+		s.Close()
+		return
+	}
+	if err := a.kick(reason); err != nil && err != ErrBrokenPipe {
+		log.Println(err)
+	}
+}
+
+// PushToUsers implements the MemberServer interface
+func (n *Node) PushToUsers(_ context.Context, req *clusterpb.PushToUsersRequest) (*clusterpb.UserMessageResponse, error) {
+	resp := &clusterpb.UserMessageResponse{}
+	for _, uid := range req.Uids {
+		sessions := n.findSessions(uid, req.Device)
+		if len(sessions) == 0 {
+			resp.Missing = append(resp.Missing, uid)
+			continue
+		}
+		for _, s := range sessions {
+			if err := s.Push(req.Route, req.Data); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	return resp, nil
+}
+
+// KickUsers implements the MemberServer interface
+func (n *Node) KickUsers(_ context.Context, req *clusterpb.KickUsersRequest) (*clusterpb.UserMessageResponse, error) {
+	resp := &clusterpb.UserMessageResponse{}
+	for _, uid := range req.Uids {
+		sessions := n.findSessions(uid, "")
+		if len(sessions) == 0 {
+			resp.Missing = append(resp.Missing, uid)
+			continue
+		}
+		for _, s := range sessions {
+			// the kick request with data is sent by KickUID
+			if len(req.Data) > 0 {
+				if err := s.Kick(req.Data); err != nil {
+					log.Println(err)
+				}
+				continue
+			}
+			kickSession(s, req.Reason)
+		}
+	}
+	return resp, nil
+}
+
+// BindUser implements the MasterServer interface
+func (c *cluster) BindUser(_ context.Context, req *clusterpb.BindUserRequest) (*clusterpb.BindUserResponse, error) {
+	c.bindUser(req.Uid, req.ServiceAddr)
+	return &clusterpb.BindUserResponse{}, nil
+}
+
+// UnbindUser implements the MasterServer interface
+func (c *cluster) UnbindUser(_ context.Context, req *clusterpb.UnbindUserRequest) (*clusterpb.UnbindUserResponse, error) {
+	c.unbindUser(req.Uid, req.ServiceAddr)
+	return &clusterpb.UnbindUserResponse{}, nil
+}
+
+// FindUsers implements the MasterServer interface, the Addrs of response holds the
+// node the user bound latest, and the Nodes holds all nodes serving the user
+func (c *cluster) FindUsers(_ context.Context, req *clusterpb.FindUsersRequest) (*clusterpb.FindUsersResponse, error) {
+	resp := &clusterpb.FindUsersResponse{Addrs: map[int64]string{}}
+	for uid, addrs := range c.findUsers(req.Uids) {
+		resp.Addrs[uid] = addrs[len(addrs)-1]
+		for _, addr := range addrs {
+			resp.Nodes = append(resp.Nodes, &clusterpb.UserNode{Uid: uid, Addr: addr})
+		}
+	}
+	return resp, nil
+}
+
+func (c *cluster) bindUser(uid int64, addr string) {
+	c.mu.Lock()
+	if c.users == nil {
+		c.users = map[int64][]string{}
+	}
+	c.users[uid] = append(removeAddr(c.users[uid], addr), addr)
+	c.mu.Unlock()
+}
+
+// unbindUser removes the node from the nodes serving the user, which is sent by
+// the node once none of its sessions is bound to the uid
+func (c *cluster) unbindUser(uid int64, addr string) {
+	c.mu.Lock()
+	c.removeUser(uid, addr)
+	c.mu.Unlock()
+}
+
+func (c *cluster) unbindUsersOf(addr string) {
+	c.mu.Lock()
+	for uid := range c.users {
+		c.removeUser(uid, addr)
+	}
+	c.mu.Unlock()
+}
+
+// removeUser removes the node serving the user, it is called with the lock held
+func (c *cluster) removeUser(uid int64, addr string) {
+	if addrs := removeAddr(c.users[uid], addr); len(addrs) > 0 {
+		c.users[uid] = addrs
+	} else {
+		delete(c.users, uid)
+	}
+}
+
+func (c *cluster) findUsers(uids []int64) map[int64][]string {
+	nodes := map[int64][]string{}
+	c.mu.RLock()
+	for _, uid := range uids {
+		if addrs, found := c.users[uid]; found {
+			nodes[uid] = append([]string(nil), addrs...)
+		}
+	}
+	c.mu.RUnlock()
+	return nodes
+}
+
+func removeAddr(addrs []string, addr string) []string {
+	for i, a := range addrs {
+		if a == addr {
+			return append(addrs[:i:i], addrs[i+1:]...)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,591 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/internal/packet"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+	"google.golang.org/grpc"
+)
+
+func TestNode_SendToUser(t *testing.T) {
+	n := &Node{Options: Options{IsMaster: true}, ServiceAddr: "127.0.0.1:0"}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.initUsers()
+
+	server, client := net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+	a := newAgent(server, nil, nil, nil)
+	go a.write()
+	n.storeSession(a.session)
+
+	if err := n.SendToUser(1001, "mail.new", []byte("hello")); err != ErrUserNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrUserNotFound, err)
+	}
+
+	a.session.Bind(1001)
+	if err := n.SendToUser(1001, "mail.new", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if addrs := n.cluster.findUsers([]int64{1001}); len(addrs[1001]) != 1 || addrs[1001][0] != n.ServiceAddr {
+		t.Fatalf("expect user to be registered to master, got: %v", addrs)
+	}
+
+	// rebinding removes the previous uid
+	a.session.Bind(1002)
+	missing, err := n.MultiSend([]int64{1001, 1002}, "mail.new", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0] != 1001 {
+		t.Fatalf("expect: [1001], got: %v", missing)
+	}
+
+	if err := n.KickUser(1002, "banned"); err != nil {
+		t.Fatal(err)
+	}
+	session.Lifetime.Close(a.session)
+	if n.findUser(1002) != nil {
+		t.Fatal("expect user to be removed after session closed")
+	}
+	if addrs := n.cluster.findUsers([]int64{1002}); len(addrs) != 0 {
+		t.Fatalf("expect user to be unregistered from master, got: %v", addrs)
+	}
+}
+
+func TestNode_KickUID(t *testing.T) {
+	n := &Node{Options: Options{IsMaster: true}, ServiceAddr: "127.0.0.1:0"}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.initUsers()
+
+	newUser := func(uid int64) net.Conn {
+		server, client := net.Pipe()
+		a := newAgent(server, nil, nil, nil)
+		go a.write()
+		n.storeSession(a.session)
+		a.session.Bind(uid)
+		return client
+	}
+
+	if err := n.KickUID(1001, []byte("banned")); err != ErrUserNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrUserNotFound, err)
+	}
+
+	// kicked by current node
+	client := newUser(1001)
+	defer client.Close()
+	kicked := make(chan error, 1)
+	go func() { kicked <- n.KickUID(1001, []byte("banned")) }()
+	if m := readPush(t, client, message.V1); m.Route != session.KickRoute || string(m.Data) != "banned" {
+		t.Fatalf("unexpected message: route=%s, data=%s", m.Route, m.Data)
+	}
+	if err := <-kicked; err != nil {
+		t.Fatal(err)
+	}
+
+	// kicked by the request forwarded from other nodes
+	client = newUser(1002)
+	defer client.Close()
+	done := make(chan *clusterpb.UserMessageResponse, 1)
+	go func() {
+		resp, _ := n.KickUsers(context.Background(), &clusterpb.KickUsersRequest{Uids: []int64{1002, 1003}, Data: []byte("maintenance")})
+		done <- resp
+	}()
+	if m := readPush(t, client, message.V1); m.Route != session.KickRoute || string(m.Data) != "maintenance" {
+		t.Fatalf("unexpected message: route=%s, data=%s", m.Route, m.Data)
+	}
+	if resp := <-done; len(resp.Missing) != 1 || resp.Missing[0] != 1003 {
+		t.Fatalf("expect: [1003], got: %v", resp.Missing)
+	}
+}
+
+func TestNode_SessionsPerUID(t *testing.T) {
+	n := &Node{}
+	n.userIndex = newUserIndex()
+	for sid, uid := range map[int64]int64{1: 1001, 2: 1001, 3: 1002} {
+		n.userIndex.uids[sid] = uid
+	}
+
+	perUID := n.sessionsPerUID()
+	sort.Ints(perUID)
+	if len(perUID) != 2 || perUID[0] != 1 || perUID[1] != 2 {
+		t.Fatalf("expect: [1 2], got: %v", perUID)
+	}
+
+	reporter := &seriesReporter{series: map[string]float64{}}
+	metrics.ReportBoundSessions([]metrics.Reporter{reporter}, perUID)
+	if v := reporter.value("bound_sessions{}"); v != 3 {
+		t.Fatalf("expect: 3, got: %v", v)
+	}
+}
+
+func TestNode_DuplicateLogin(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	newNode := func(policy DuplicateLoginPolicy, hook func(*session.Session, int64) DuplicateLoginPolicy) *Node {
+		n := &Node{Options: Options{IsMaster: true, DuplicateLogin: policy, DuplicateLoginHook: hook, MetricsReporters: []metrics.Reporter{reporter}}, ServiceAddr: "127.0.0.1:0"}
+		n.sessions = map[int64]*session.Session{}
+		n.cluster = newCluster(n)
+		n.initUsers()
+		return n
+	}
+	newSession := func(n *Node) (*agent, net.Conn) {
+		server, client := net.Pipe()
+		a := newAgent(server, nil, nil, nil)
+		n.storeSession(a.session)
+		go a.write()
+		return a, client
+	}
+
+	// new wins
+	n := newNode(DuplicateLoginKickOld, nil)
+	old, client := newSession(n)
+	defer client.Close()
+	if err := old.session.Bind(9001); err != nil {
+		t.Fatal(err)
+	}
+	kicked := make(chan []byte)
+	go func() {
+		buf := make([]byte, 1024)
+		l, _ := client.Read(buf)
+		kicked <- buf[:l]
+	}()
+	current, _ := newSession(n)
+	if err := current.session.Bind(9001); err != nil {
+		t.Fatal(err)
+	}
+	packets, err := codec.NewDecoder().Decode(<-kicked)
+	if err != nil || len(packets) != 1 || packets[0].Type != packet.Kick {
+		t.Fatalf("expect the old session to be kicked, got: %v (%v)", packets, err)
+	}
+	if !strings.Contains(string(packets[0].Data), kickReasonDuplicate) {
+		t.Fatalf("unexpected kick message: %s", packets[0].Data)
+	}
+	if n.findUser(9001) != current.session {
+		t.Fatal("expect the user to be bound to the new session")
+	}
+
+	// the binding is not blocked by the old session whose client does not read
+	slow, slowClient := newSession(n)
+	defer slowClient.Close()
+	if err := slow.session.Bind(9005); err != nil {
+		t.Fatal(err)
+	}
+	bound := make(chan error, 1)
+	latest, _ := newSession(n)
+	go func() { bound <- latest.session.Bind(9005) }()
+	select {
+	case err := <-bound:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect the binding not blocked by the kick")
+	}
+
+	// old wins
+	n = newNode(DuplicateLoginRejectNew, nil)
+	first, _ := newSession(n)
+	second, _ := newSession(n)
+	if err := first.session.Bind(9002); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.session.Bind(9002); err != ErrDuplicateLogin {
+		t.Fatalf("expect: %v, got: %v", ErrDuplicateLogin, err)
+	}
+	if second.session.UID() != 0 || n.findUser(9002) != first.session {
+		t.Fatal("expect the user to be kept bound to the old session")
+	}
+	// rebinding the same uid is not a duplicate login
+	if err := first.session.Bind(9002); err != nil {
+		t.Fatal(err)
+	}
+
+	// decided by the hook
+	n = newNode(DuplicateLoginAllow, func(s *session.Session, uid int64) DuplicateLoginPolicy {
+		if uid == 9003 {
+			return DuplicateLoginAllow
+		}
+		return DuplicateLoginRejectNew
+	})
+	for _, uid := range []int64{9003, 9004} {
+		first, _ := newSession(n)
+		second, _ := newSession(n)
+		if err := first.session.Bind(uid); err != nil {
+			t.Fatal(err)
+		}
+		err := second.session.Bind(uid)
+		if uid == 9003 && err != nil {
+			t.Fatal(err)
+		}
+		if uid == 9004 && err != ErrDuplicateLogin {
+			t.Fatalf("expect: %v, got: %v", ErrDuplicateLogin, err)
+		}
+	}
+
+	if v := reporter.value("duplicate_login_total{policy=allow}"); v != 1 {
+		t.Fatalf("expect: 1 duplicate login allowed, got: %v", v)
+	}
+	if v := reporter.value("duplicate_login_total{policy=kick_old}"); v != 2 {
+		t.Fatalf("expect: 2 duplicate logins kicked, got: %v", v)
+	}
+	if v := reporter.value("duplicate_login_total{policy=reject_new}"); v != 2 {
+		t.Fatalf("expect: 1 duplicate login rejected, got: %v", v)
+	}
+}
+
+func TestNode_SessionStore(t *testing.T) {
+	store := session.NewMemoryStore()
+	n := &Node{Options: Options{IsMaster: true, SessionStore: store}, ServiceAddr: "127.0.0.1:3250"}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.initUsers()
+
+	newSession := func() *session.Session {
+		server, client := net.Pipe()
+		go io.Copy(ioutil.Discard, client)
+		a := newAgent(server, nil, nil, nil)
+		go a.write()
+		n.storeSession(a.session)
+		return a.session
+	}
+
+	s := newSession()
+	s.Set("level", 7)
+	s.Set("nickname", "nano")
+	if err := s.Bind(2001); err != nil {
+		t.Fatal(err)
+	}
+
+	// the other nodes locate the user by the store
+	other := &Node{Options: Options{SessionStore: store}, ServiceAddr: "127.0.0.1:3251"}
+	_, remote, missing, err := other.locateUsers([]int64{2001, 2002})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remote[n.ServiceAddr]) != 1 || len(missing) != 1 || missing[0] != 2002 {
+		t.Fatalf("expect 2001 located at %s, got: %v %v", n.ServiceAddr, remote, missing)
+	}
+
+	// the data is restored to the next session of the user
+	session.Lifetime.Close(s)
+	s2 := newSession()
+	s2.Set("nickname", "renamed")
+	if err := s2.Bind(2001); err != nil {
+		t.Fatal(err)
+	}
+	if level := s2.Int("level"); level != 7 {
+		t.Fatalf("expect: 7, got: %d", level)
+	}
+	if nickname := s2.String("nickname"); nickname != "renamed" {
+		t.Fatalf("expect the keys set before binding kept, got: %s", nickname)
+	}
+
+	// the late unbind of the closed session does not remove the new binding
+	store.Unbind(2001, s.ID())
+	if addrs, _ := store.Locate([]int64{2001}); addrs[2001] != n.ServiceAddr {
+		t.Fatalf("expect 2001 bound, got: %v", addrs)
+	}
+}
+
+func TestNode_SendToDevice(t *testing.T) {
+	n := &Node{Options: Options{IsMaster: true, DuplicateLogin: DuplicateLoginKickOld}, ServiceAddr: "127.0.0.1:0"}
+	n.sessions = map[int64]*session.Session{}
+	n.cluster = newCluster(n)
+	n.initUsers()
+
+	newDevice := func(uid int64, device string) (*agent, net.Conn) {
+		server, client := net.Pipe()
+		a := newAgent(server, nil, nil, nil)
+		go a.write()
+		n.storeSession(a.session)
+		if err := a.session.BindDevice(uid, device); err != nil {
+			t.Fatal(err)
+		}
+		return a, client
+	}
+
+	// the sessions of different devices are not duplicates
+	game, gameClient := newDevice(9101, "game")
+	defer gameClient.Close()
+	companion, companionClient := newDevice(9101, "companion")
+	defer companionClient.Close()
+	if sessions := n.findSessions(9101, ""); len(sessions) != 2 {
+		t.Fatalf("expect 2 devices online, got: %v", sessions)
+	}
+	if err := companion.session.BindDevice(9101, "game"); err != session.ErrDeviceChanged {
+		t.Fatalf("expect: %v, got: %v", session.ErrDeviceChanged, err)
+	}
+
+	sent := make(chan error, 1)
+	go func() { sent <- n.SendToDevice(9101, "companion", "mail.new", []byte("companion")) }()
+	if m := readPush(t, companionClient, message.V1); m.Route != "mail.new" || string(m.Data) != "companion" {
+		t.Fatalf("unexpected message: route=%s, data=%s", m.Route, m.Data)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if err := n.SendToDevice(9101, "pc", "mail.new", []byte("pc")); err != ErrUserNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrUserNotFound, err)
+	}
+
+	// pushed to all devices of the user
+	go func() { sent <- n.SendToUser(9101, "mail.new", []byte("all")) }()
+	for _, client := range []net.Conn{gameClient, companionClient} {
+		if m := readPush(t, client, message.V1); string(m.Data) != "all" {
+			t.Fatalf("unexpected message: %s", m.Data)
+		}
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	// the user keeps bound until the sessions of all devices are closed
+	session.Lifetime.Close(companion.session)
+	if addrs := n.cluster.findUsers([]int64{9101}); len(addrs[9101]) != 1 || addrs[9101][0] != n.ServiceAddr {
+		t.Fatalf("expect user to be registered to master, got: %v", addrs)
+	}
+	if n.findUser(9101) != game.session {
+		t.Fatal("expect the user to be bound to the game session")
+	}
+	session.Lifetime.Close(game.session)
+	if addrs := n.cluster.findUsers([]int64{9101}); len(addrs) != 0 {
+		t.Fatalf("expect user to be unregistered from master, got: %v", addrs)
+	}
+}
+
+func TestNode_PushToUID(t *testing.T) {
+	store := session.NewMemoryStore()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontend := &Node{Options: Options{SessionStore: store}, ServiceAddr: listener.Addr().String()}
+	frontend.sessions = map[int64]*session.Session{}
+	frontend.initUsers()
+	server := grpc.NewServer()
+	clusterpb.RegisterMemberServer(server, frontend)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	// the backend node locates the user by the store
+	backend := &Node{Options: Options{SessionStore: store}, ServiceAddr: "127.0.0.1:0", rpcClient: newRPCClient()}
+	defer backend.rpcClient.closePool()
+	if delivered, err := backend.PushToUID(3001, "match.found", []byte("hello")); err != nil || delivered {
+		t.Fatalf("expect the offline user not delivered, got: %v (%v)", delivered, err)
+	}
+
+	conn, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(conn, nil, nil, nil)
+	go a.write()
+	frontend.storeSession(a.session)
+	if err := a.session.Bind(3001); err != nil {
+		t.Fatal(err)
+	}
+	// the binding is saved to the store asynchronously
+	for {
+		if addrs, _ := store.Locate([]int64{3001}); addrs[3001] != "" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	type result struct {
+		delivered bool
+		err       error
+	}
+	done := make(chan result, 1)
+	go func() {
+		delivered, err := backend.PushToUID(3001, "match.found", []byte("hello"))
+		done <- result{delivered, err}
+	}()
+	if m := readPush(t, client, message.V1); m.Route != "match.found" || string(m.Data) != "hello" {
+		t.Fatalf("unexpected message: route=%s, data=%s", m.Route, m.Data)
+	}
+	if r := <-done; r.err != nil || !r.delivered {
+		t.Fatalf("expect the message delivered, got: %v (%v)", r.delivered, r.err)
+	}
+
+	// the stale binding of the store is reported not online
+	store.Bind(3002, 1, frontend.ServiceAddr)
+	if delivered, err := backend.PushToUID(3002, "match.found", []byte("hello")); err != nil || delivered {
+		t.Fatalf("expect the stale user not delivered, got: %v (%v)", delivered, err)
+	}
+}
+
+func TestNode_MultipleFrontends(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontend := &Node{ServiceAddr: listener.Addr().String()}
+	frontend.sessions = map[int64]*session.Session{}
+	frontend.initUsers()
+	server := grpc.NewServer()
+	clusterpb.RegisterMemberServer(server, frontend)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	master := &Node{Options: Options{IsMaster: true}, ServiceAddr: "127.0.0.1:0", rpcClient: newRPCClient()}
+	defer master.rpcClient.closePool()
+	master.sessions = map[int64]*session.Session{}
+	master.cluster = newCluster(master)
+	master.initUsers()
+
+	newUser := func(n *Node, uid int64, device string) net.Conn {
+		conn, client := net.Pipe()
+		a := newAgent(conn, nil, nil, nil)
+		go a.write()
+		n.storeSession(a.session)
+		if err := a.session.BindDevice(uid, device); err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+	pc := newUser(master, 4001, "pc")
+	defer pc.Close()
+	phone := newUser(frontend, 4001, "phone")
+	defer phone.Close()
+	master.cluster.bindUser(4001, frontend.ServiceAddr)
+
+	resp, err := master.cluster.FindUsers(context.Background(), &clusterpb.FindUsersRequest{Uids: []int64{4001}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Nodes) != 2 || resp.Addrs[4001] != frontend.ServiceAddr {
+		t.Fatalf("expect the user served by both nodes, got: %v", resp)
+	}
+
+	// the remote devices are pushed even though the user is online locally
+	sent := make(chan error, 1)
+	go func() { sent <- master.SendToUser(4001, "mail.new", []byte("all")) }()
+	for _, client := range []net.Conn{pc, phone} {
+		if m := readPush(t, client, message.V1); string(m.Data) != "all" {
+			t.Fatalf("unexpected message: %s", m.Data)
+		}
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	// the user is delivered locally even though the registry of the remote node is stale
+	tablet := newUser(master, 4002, "tablet")
+	defer tablet.Close()
+	master.cluster.bindUser(4002, frontend.ServiceAddr)
+	go func() {
+		delivered, err := master.PushToUID(4002, "mail.new", []byte("tablet"))
+		if err == nil && !delivered {
+			err = ErrUserNotFound
+		}
+		sent <- err
+	}()
+	if m := readPush(t, tablet, message.V1); string(m.Data) != "tablet" {
+		t.Fatalf("unexpected message: %s", m.Data)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	master.cluster.unbindUser(4001, frontend.ServiceAddr)
+	if addrs := master.cluster.findUsers([]int64{4001}); len(addrs[4001]) != 1 || addrs[4001][0] != master.ServiceAddr {
+		t.Fatalf("expect the user served by master only, got: %v", addrs)
+	}
+}
+
+func TestNode_FindUser(t *testing.T) {
+	n := &Node{ServiceAddr: "127.0.0.1:0"}
+	n.sessions = map[int64]*session.Session{}
+	n.initUsers()
+
+	s1, s2 := session.New(nil), session.New(nil)
+	n.storeSession(s1)
+	n.storeSession(s2)
+	if count := n.SessionCount(); count != 2 {
+		t.Fatalf("expect: 2, got: %d", count)
+	}
+
+	s1.Bind(5001)
+	s2.Bind(5002)
+	if n.FindUser(5001) != s1 || n.FindUser(5002) != s2 {
+		t.Fatal("expect the sessions found by their uids")
+	}
+	s2.Bind(5003)
+	if n.FindUser(5003) != s2 || n.FindUser(5002) != nil {
+		t.Fatal("expect the session found by its current uid")
+	}
+
+	var found []*session.Session
+	n.RangeSessions(func(s *session.Session) bool {
+		found = append(found, s)
+		return true
+	})
+	if len(found) != 2 {
+		t.Fatalf("expect 2 sessions iterated, got: %d", len(found))
+	}
+
+	// the closed sessions are removed from current node
+	session.Lifetime.Close(s2)
+	if n.SessionCount() != 1 || n.FindUser(5003) != nil {
+		t.Fatal("expect the closed session removed")
+	}
+	session.Lifetime.Close(s1)
+	if n.SessionCount() != 0 || n.FindUser(5001) != nil {
+		t.Fatal("expect the closed session removed")
+	}
+}
+
+func TestNode_CloseUsers(t *testing.T) {
+	n := &Node{Options: Options{AdvertiseAddr: "127.0.0.1:0"}, ServiceAddr: "127.0.0.1:0", rpcClient: newRPCClient()}
+	defer n.rpcClient.closePool()
+	n.sessions = map[int64]*session.Session{}
+	n.initUsers()
+	n.closeUsers()
+	n.closeUsers()
+
+	// the updates are dropped instead of blocking once the backlog is full
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i <= userUpdateBacklog; i++ {
+			n.updateUser(userUpdate{uid: int64(i), bind: true})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect the updates not blocked after shutdown")
+	}
+}
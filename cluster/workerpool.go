@@ -0,0 +1,127 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/scheduler"
+)
+
+// DefaultWorkerPoolBacklog is the number of tasks which can be queued for each
+// worker of the pool, the read goroutine of the connection blocks once the queue
+// is full, which applies back pressure to the clients.
+const DefaultWorkerPoolBacklog = 64
+
+// workerPool dispatches the handlers to a bounded number of goroutines, the tasks
+// of a session are always run by the same worker, so the handlers of a session run
+// one at a time in order, while the handlers of different sessions run concurrently.
+type workerPool struct {
+	node      *Node // flushes the metrics if a worker crashes
+	size      int
+	queues    []chan scheduler.Task // tasks of each worker
+	busy      int64                 // number of workers running a task
+	reporters []metrics.Reporter
+	chDie     chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func newWorkerPool(node *Node) *workerPool {
+	size := node.WorkerPoolSize
+	p := &workerPool{
+		node:      node,
+		size:      size,
+		queues:    make([]chan scheduler.Task, size),
+		reporters: node.MetricsReporters,
+		chDie:     make(chan struct{}),
+	}
+	p.wg.Add(size)
+	for i := range p.queues {
+		p.queues[i] = make(chan scheduler.Task, DefaultWorkerPoolBacklog)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// schedule queues the task to the worker of session sid, it blocks until the task
+// is queued, and the task is dropped if the pool has been closed.
+func (p *workerPool) schedule(sid int64, task scheduler.Task) {
+	i := sid % int64(p.size)
+	if i < 0 {
+		i = -i
+	}
+	select {
+	case p.queues[i] <- task:
+		metrics.ReportWorkerPoolQueueDepth(p.reporters, p.depth())
+	case <-p.chDie:
+		log.Println("nano/handler: worker pool closed, task dropped")
+	}
+}
+
+// depth returns the number of tasks queued in all workers
+func (p *workerPool) depth() int {
+	n := 0
+	for _, q := range p.queues {
+		n += len(q)
+	}
+	return n
+}
+
+func (p *workerPool) work(tasks chan scheduler.Task) {
+	defer p.wg.Done()
+	defer FlushOnPanic(p.node)
+	for {
+		select {
+		case task := <-tasks:
+			p.run(task)
+		case <-p.chDie:
+			return
+		}
+	}
+}
+
+func (p *workerPool) run(task scheduler.Task) {
+	busy := atomic.AddInt64(&p.busy, 1)
+	metrics.ReportWorkerPoolUtilization(p.reporters, float64(busy)/float64(p.size))
+	defer func() {
+		if err := recover(); err != nil {
+			log.Println(fmt.Sprintf("Handle message panic: %+v\n%s", err, debug.Stack()))
+		}
+		busy := atomic.AddInt64(&p.busy, -1)
+		metrics.ReportWorkerPoolUtilization(p.reporters, float64(busy)/float64(p.size))
+	}()
+	task()
+}
+
+// close stops the workers once their current tasks complete, the queued tasks
+// are dropped
+func (p *workerPool) close() {
+	p.closeOnce.Do(func() {
+		close(p.chDie)
+		p.wg.Wait()
+	})
+}
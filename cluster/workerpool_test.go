@@ -0,0 +1,120 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+type BlockComponent struct {
+	component.Base
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *BlockComponent) Wait(s *session.Session, data []byte) error {
+	c.started <- struct{}{}
+	<-c.release
+	return nil
+}
+
+func (c *BlockComponent) Panic(s *session.Session, data []byte) error {
+	panic("boom")
+}
+
+func TestHandler_WorkerPool(t *testing.T) {
+	reporter := &seriesReporter{series: map[string]float64{}}
+	n := &Node{Options: Options{WorkerPoolSize: 2, MetricsReporters: []metrics.Reporter{reporter}}}
+	h := NewHandler(n, nil)
+	defer h.workers.close()
+	c := &BlockComponent{started: make(chan struct{}), release: make(chan struct{})}
+	if err := h.register(c, []component.Option{component.WithName("Block")}); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	a := newAgent(server, nil, nil, nil)
+	server2, client2 := net.Pipe()
+	defer client2.Close()
+	b := newAgent(server2, nil, nil, nil)
+	if a.session.ID()%2 == b.session.ID()%2 {
+		t.Fatalf("expect the sessions dispatched to different workers: %d, %d", a.session.ID(), b.session.ID())
+	}
+
+	// a panicking handler does not kill the worker
+	h.localProcess(h.localHandlers["Block.Panic"], 0, a.session, &message.Message{Type: message.Notify, Route: "Block.Panic"})
+
+	// the handlers of the same session run one at a time
+	for i := 0; i < 2; i++ {
+		h.localProcess(h.localHandlers["Block.Wait"], 0, a.session, &message.Message{Type: message.Notify, Route: "Block.Wait"})
+	}
+	select {
+	case <-c.started:
+	case <-time.After(time.Second):
+		t.Fatal("expect the handler running")
+	}
+	select {
+	case <-c.started:
+		t.Fatal("expect the handlers of a session run one at a time")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// the handlers of different sessions run concurrently
+	h.localProcess(h.localHandlers["Block.Wait"], 0, b.session, &message.Message{Type: message.Notify, Route: "Block.Wait"})
+	select {
+	case <-c.started:
+	case <-time.After(time.Second):
+		t.Fatal("expect 2 handlers running concurrently")
+	}
+	if v := reporter.value("worker_pool_utilization{}"); v != 1 {
+		t.Fatalf("expect all workers busy, got: %v", v)
+	}
+
+	close(c.release)
+	// the queued handler of the session runs once the former completes
+	select {
+	case <-c.started:
+	case <-time.After(time.Second):
+		t.Fatal("expect the queued handler running")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := n.WaitForIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the workers are released after the handlers complete
+	deadline := time.Now().Add(time.Second)
+	for reporter.value("worker_pool_utilization{}") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expect all workers idle")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
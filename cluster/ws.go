@@ -26,14 +26,28 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/lonng/nano/internal/log"
 )
 
+// WSCompressionConfig contains the parameters of the permessage-deflate
+// extension, which is used if the client offers it in the handshake.
+type WSCompressionConfig struct {
+	// Threshold is the size in bytes of the smallest message to compress, the
+	// smaller messages are sent uncompressed since the deflate header costs
+	// more than it saves. Zero means all messages are compressed.
+	Threshold int
+	// Level is the flate compression level, from flate.BestSpeed(1) to
+	// flate.BestCompression(9). Zero means the default level (BestSpeed).
+	Level int
+}
+
 // wsConn is an adapter to t.Conn, which implements all t.Conn
 // interface base on *websocket.Conn
 type wsConn struct {
-	conn   *websocket.Conn
-	typ    int // message type
-	reader io.Reader
+	conn      *websocket.Conn
+	typ       int // message type
+	reader    io.Reader
+	threshold int // messages smaller than threshold are not compressed
 }
 
 // newWSConn return an initialized *wsConn
@@ -51,6 +65,21 @@ func newWSConn(conn *websocket.Conn) (*wsConn, error) {
 	return c, nil
 }
 
+// compress enables the write compression of messages larger than the threshold
+// of cfg, which takes effect only if permessage-deflate has been negotiated
+func (c *wsConn) compress(cfg *WSCompressionConfig) {
+	if cfg == nil {
+		c.conn.EnableWriteCompression(false)
+		return
+	}
+	if cfg.Level != 0 {
+		if err := c.conn.SetCompressionLevel(cfg.Level); err != nil {
+			log.Println(err.Error())
+		}
+	}
+	c.threshold = cfg.Threshold
+}
+
 // Read reads data from the connection.
 // Read can be made to time out and return an Error with Timeout() == true
 // after a fixed time limit; see SetDeadline and SetReadDeadline.
@@ -73,6 +102,9 @@ func (c *wsConn) Read(b []byte) (int, error) {
 // Write can be made to time out and return an Error with Timeout() == true
 // after a fixed time limit; see SetDeadline and SetWriteDeadline.
 func (c *wsConn) Write(b []byte) (int, error) {
+	if c.threshold > 0 {
+		c.conn.EnableWriteCompression(len(b) >= c.threshold)
+	}
 	err := c.conn.WriteMessage(websocket.BinaryMessage, b)
 	if err != nil {
 		return 0, err
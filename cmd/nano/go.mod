@@ -0,0 +1,8 @@
+module github.com/lonng/nano/cmd/nano
+
+go 1.12
+
+require (
+	github.com/spf13/cobra v1.1.3
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -0,0 +1,334 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	componentPath = "github.com/lonng/nano/component"
+	sessionPath   = "github.com/lonng/nano/session"
+)
+
+// route is a handler found in the Go sources
+type route struct {
+	Name    string         // route, e.g: Room.Join
+	Payload string         // name of the payload type, empty for raw payload
+	Pos     token.Position // position of the handler
+}
+
+func lintCommand() *cobra.Command {
+	var protos []string
+	cmd := &cobra.Command{
+		Use:   "lint [dir...]",
+		Short: "Check that the payloads of all handlers have matching proto definitions",
+		Long: `Lint finds the handlers of the components, which embed component.Base, in the Go
+sources of dirs, and checks that the payload type of each handler is defined as a
+message in the proto files. A dir ending with /... is walked recursively. The
+handlers receiving raw []byte payloads are not checked. The routes are named by
+the type names of components, which may differ from the names registered with
+component.WithName or component.WithNameFunc.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = []string{"./..."}
+			}
+			routes, err := findRoutes(args)
+			if err != nil {
+				return err
+			}
+			messages, err := findMessages(protos)
+			if err != nil {
+				return err
+			}
+			problems := lint(routes, messages)
+			for _, p := range problems {
+				fmt.Fprintln(cmd.OutOrStdout(), p)
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("%d of %d routes have no matching proto definitions", len(problems), len(routes))
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%d routes checked\n", len(routes))
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&protos, "proto", []string{"./..."}, "directories of the proto files, a dir ending with /... is walked recursively")
+	return cmd
+}
+
+// lint returns the problems of routes, which are sorted by route
+func lint(routes []route, messages map[string]bool) []string {
+	var problems []string
+	for _, r := range routes {
+		if r.Payload != "" && !messages[r.Payload] {
+			problems = append(problems, fmt.Sprintf("%s: %s: payload %s is not defined in proto files", r.Pos, r.Name, r.Payload))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// expand returns the directories of patterns, a pattern ending with /... matches
+// the directory and all its subdirectories except the hidden ones and testdata
+func expand(patterns []string) ([]string, error) {
+	var dirs []string
+	for _, p := range patterns {
+		if !strings.HasSuffix(p, "/...") {
+			dirs = append(dirs, p)
+			continue
+		}
+		root := strings.TrimSuffix(p, "/...")
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			name := info.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "testdata" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// findRoutes parses the Go sources in dirs and returns the handlers of components
+func findRoutes(patterns []string) ([]route, error) {
+	dirs, err := expand(patterns)
+	if err != nil {
+		return nil, err
+	}
+	var routes []route
+	for _, dir := range dirs {
+		fset := token.NewFileSet()
+		pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+			return !strings.HasSuffix(info.Name(), "_test.go")
+		}, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range pkgs {
+			routes = append(routes, packageRoutes(fset, pkg)...)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Name < routes[j].Name })
+	return routes, nil
+}
+
+// importName returns the name of the package imported by the file, or empty if
+// the package is not imported
+func importName(file *ast.File, path string) string {
+	for _, spec := range file.Imports {
+		if p, _ := strconv.Unquote(spec.Path.Value); p != path {
+			continue
+		}
+		if spec.Name != nil {
+			return spec.Name.Name
+		}
+		return path[strings.LastIndex(path, "/")+1:]
+	}
+	return ""
+}
+
+// isSelector reports whether expr is pkg.name
+func isSelector(expr ast.Expr, pkg, name string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || pkg == "" {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Name == pkg && sel.Sel.Name == name
+}
+
+func packageRoutes(fset *token.FileSet, pkg *ast.Package) []route {
+	// the components of package, which embed component.Base
+	components := map[string]bool{}
+	for _, file := range pkg.Files {
+		name := importName(file, componentPath)
+		ast.Inspect(file, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return false
+			}
+			for _, field := range st.Fields.List {
+				typ := field.Type
+				if star, ok := typ.(*ast.StarExpr); ok {
+					typ = star.X
+				}
+				if len(field.Names) == 0 && isSelector(typ, name, "Base") {
+					components[spec.Name.Name] = true
+				}
+			}
+			return false
+		})
+	}
+
+	var routes []route
+	for _, file := range pkg.Files {
+		session := importName(file, sessionPath)
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || !fn.Name.IsExported() {
+				continue
+			}
+			recv := fn.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			ident, ok := recv.(*ast.Ident)
+			if !ok || !components[ident.Name] {
+				continue
+			}
+			payload, ok := handlerPayload(fn.Type, session)
+			if !ok {
+				continue
+			}
+			routes = append(routes, route{
+				Name:    ident.Name + "." + fn.Name.Name,
+				Payload: payload,
+				Pos:     fset.Position(fn.Pos()),
+			})
+		}
+	}
+	return routes
+}
+
+// handlerPayload returns the name of payload type if the function is a handler,
+// which is declared as func(*session.Session, []byte or *Payload) error
+func handlerPayload(typ *ast.FuncType, session string) (string, bool) {
+	var params []ast.Expr
+	for _, field := range typ.Params.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			params = append(params, field.Type)
+		}
+	}
+	if len(params) != 2 || typ.Results == nil || len(typ.Results.List) != 1 {
+		return "", false
+	}
+	if ident, ok := typ.Results.List[0].Type.(*ast.Ident); !ok || ident.Name != "error" {
+		return "", false
+	}
+	if star, ok := params[0].(*ast.StarExpr); !ok || !isSelector(star.X, session, "Session") {
+		return "", false
+	}
+
+	switch p := params[1].(type) {
+	case *ast.ArrayType:
+		if ident, ok := p.Elt.(*ast.Ident); ok && ident.Name == "byte" && p.Len == nil {
+			return "", true
+		}
+	case *ast.StarExpr:
+		switch x := p.X.(type) {
+		case *ast.Ident:
+			return x.Name, true
+		case *ast.SelectorExpr:
+			return x.Sel.Name, true
+		}
+	}
+	return "", false
+}
+
+var (
+	protoComment = regexp.MustCompile(`(?s)//[^\n]*|/\*.*?\*/`)
+	protoToken   = regexp.MustCompile(`\bmessage\s+(\w+)\s*\{|\{|\}`)
+)
+
+// findMessages parses the proto files in dirs, and returns the Go type names of
+// the messages, the nested messages are named as Parent_Child
+func findMessages(patterns []string) (map[string]bool, error) {
+	dirs, err := expand(patterns)
+	if err != nil {
+		return nil, err
+	}
+	messages := map[string]bool{}
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.proto"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range protoMessages(string(data)) {
+				messages[name] = true
+			}
+		}
+	}
+	return messages, nil
+}
+
+// protoMessages returns the Go type names of the messages defined in src
+func protoMessages(src string) []string {
+	src = protoComment.ReplaceAllString(src, "")
+	var (
+		names []string
+		// the names of enclosing blocks, empty for the blocks which are not messages
+		stack []string
+	)
+	for _, m := range protoToken.FindAllStringSubmatch(src, -1) {
+		switch {
+		case m[1] != "":
+			name := m[1]
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] != "" {
+					name = stack[i] + "_" + name
+					break
+				}
+			}
+			names = append(names, name)
+			stack = append(stack, name)
+		case m[0] == "{":
+			stack = append(stack, "")
+		case len(stack) > 0:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return names
+}
@@ -0,0 +1,66 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProtoMessages(t *testing.T) {
+	src := `
+message A { /* message Commented { } */
+  message B { message C {} }
+  oneof x { string y = 1; }
+  enum E { V = 0; }
+}
+// message D {}
+message D {}`
+	expect := []string{"A", "A_B", "A_B_C", "D"}
+	if names := protoMessages(src); !reflect.DeepEqual(names, expect) {
+		t.Fatalf("expect: %v, got: %v", expect, names)
+	}
+}
+
+func TestLint(t *testing.T) {
+	routes, err := findRoutes([]string{"testdata/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range routes {
+		names = append(names, r.Name+"("+r.Payload+")")
+	}
+	expect := []string{"Room.Chat(ChatMessage_Text)", "Room.Join(JoinRequest)", "Room.Leave(LeaveRequest)", "Room.Raw()"}
+	if !reflect.DeepEqual(names, expect) {
+		t.Fatalf("expect: %v, got: %v", expect, names)
+	}
+
+	messages, err := findMessages([]string{"testdata/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := lint(routes, messages)
+	if len(problems) != 1 || !strings.Contains(problems[0], "Room.Leave: payload LeaveRequest") {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+var componentTemplate = template.Must(template.New("component").Parse(`package {{.Package}}
+
+import (
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/session"
+)
+
+// {{.Name}} is the {{.Name}} component, which is registered by
+//
+//	components.Register(&{{.Package}}.{{.Name}}{})
+//
+// and its handlers are served as the routes {{.Name}}.<Handler>.
+type {{.Name}} struct {
+	component.Base
+}
+
+// Init is called when the component is initialized
+func (c *{{.Name}}) Init() {}
+
+// Shutdown is called when the server is shutting down
+func (c *{{.Name}}) Shutdown() {}
+{{range .Handlers}}
+// {{.}} handles the route {{$.Name}}.{{.}}
+func (c *{{$.Name}}) {{.}}(s *session.Session, data []byte) error {
+	return nil
+}
+{{end}}`))
+
+// componentData is the data of component template
+type componentData struct {
+	Package  string
+	Name     string
+	Handlers []string
+}
+
+func newCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "new",
+		Short: "Generate the scaffolding of nano applications",
+	}
+
+	var dir, pkg string
+	component := &cobra.Command{
+		Use:   "component <name> [handler...]",
+		Short: "Generate a component with empty handlers",
+		Example: `  nano new component Room Join Leave
+  nano new component Room --dir ./game --package game`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := generateComponent(dir, pkg, args[0], args[1:])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Generated", path)
+			return nil
+		},
+	}
+	component.Flags().StringVarP(&dir, "dir", "d", ".", "directory of the generated file")
+	component.Flags().StringVarP(&pkg, "package", "p", "", "package name, the name of directory by default")
+	cmd.AddCommand(component)
+	return cmd
+}
+
+// generateComponent writes the component file to dir, and returns its path. The
+// existing file will not be overwritten.
+func generateComponent(dir, pkg, name string, handlers []string) (string, error) {
+	for _, n := range append([]string{name}, handlers...) {
+		if !isExportedIdent(n) {
+			return "", fmt.Errorf("%q is not an exported Go identifier", n)
+		}
+	}
+	if pkg == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		pkg = packageName(filepath.Base(abs))
+	}
+
+	buf := &bytes.Buffer{}
+	data := componentData{Package: pkg, Name: name, Handlers: handlers}
+	if err := componentTemplate.Execute(buf, data); err != nil {
+		return "", err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, snakeCase(name)+".go")
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%s already exists", path)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, src, 0644)
+}
+
+func isExportedIdent(s string) bool {
+	for i, r := range s {
+		if i == 0 && !unicode.IsUpper(r) {
+			return false
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// packageName derives a valid package name from the directory name
+func packageName(dir string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, dir)
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		return "main"
+	}
+	return name
+}
+
+// snakeCase converts the CamelCase name to the snake_case file name, e.g:
+// ChatRoom to chat_room
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// a new word starts at an upper letter after a lower letter or before one
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	cases := map[string]string{"Room": "room", "ChatRoom": "chat_room", "HTTPProxy": "http_proxy", "Room2": "room2"}
+	for name, expect := range cases {
+		if s := snakeCase(name); s != expect {
+			t.Fatalf("name: %s, expect: %s, got: %s", name, expect, s)
+		}
+	}
+}
+
+func TestGenerateComponent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "game-server")
+
+	path, err := generateComponent(dir, "", "ChatRoom", []string{"Join", "Leave"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "chat_room.go" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Name.Name != "gameserver" {
+		t.Fatalf("expect package gameserver, got: %s", file.Name.Name)
+	}
+
+	// the generated handlers are found by lint
+	routes, err := findRoutes([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].Name != "ChatRoom.Join" || routes[1].Name != "ChatRoom.Leave" {
+		t.Fatalf("unexpected routes: %+v", routes)
+	}
+
+	if _, err := generateComponent(dir, "", "ChatRoom", nil); err == nil {
+		t.Fatal("expect the existing file not overwritten")
+	}
+	if _, err := generateComponent(dir, "", "room", nil); err == nil {
+		t.Fatal("expect the unexported name rejected")
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// Defaults of the development server config
+const (
+	defaultPollInterval = 500 * time.Millisecond
+	defaultStopTimeout  = 5 * time.Second
+)
+
+// serveConfig is the config of development server, e.g:
+//
+//	build: ./cmd/server         # the main package to build
+//	args: ["--addr", ":3250"]   # the arguments of server
+//	env:                        # the extra environment variables of server
+//	  NANO_ENV: dev
+//	watch: ["."]                # the directories watched recursively
+//	exclude: [".git", "vendor"] # the directory names not watched
+//	extensions: [".go"]         # the extensions of files watched
+//	interval: 500ms             # the interval of polling changes
+type serveConfig struct {
+	Build      string            `yaml:"build"`
+	Args       []string          `yaml:"args"`
+	Env        map[string]string `yaml:"env"`
+	Watch      []string          `yaml:"watch"`
+	Exclude    []string          `yaml:"exclude"`
+	Extensions []string          `yaml:"extensions"`
+	Interval   time.Duration     `yaml:"interval"`
+}
+
+func loadServeConfig(path string) (*serveConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &serveConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if cfg.Build == "" {
+		cfg.Build = "."
+	}
+	if len(cfg.Watch) == 0 {
+		cfg.Watch = []string{"."}
+	}
+	if len(cfg.Exclude) == 0 {
+		cfg.Exclude = []string{".git", "vendor", "node_modules"}
+	}
+	if len(cfg.Extensions) == 0 {
+		cfg.Extensions = []string{".go"}
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultPollInterval
+	}
+	return cfg, nil
+}
+
+func serveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve <config.yaml>",
+		Short: "Run a development server which is rebuilt and restarted on changes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadServeConfig(args[0])
+			if err != nil {
+				return err
+			}
+			return serve(cfg)
+		},
+	}
+}
+
+// snapshot is the modification time of watched files, keyed by path
+type snapshot map[string]time.Time
+
+// scan walks the watched directories, the files which are not accessible are
+// skipped, since they may be removed during the walk
+func scan(cfg *serveConfig) snapshot {
+	s := snapshot{}
+	for _, root := range cfg.Watch {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				for _, name := range cfg.Exclude {
+					if info.Name() == name && path != root {
+						return filepath.SkipDir
+					}
+				}
+				return nil
+			}
+			for _, ext := range cfg.Extensions {
+				if strings.HasSuffix(path, ext) {
+					s[path] = info.ModTime()
+					break
+				}
+			}
+			return nil
+		})
+	}
+	return s
+}
+
+// changed returns one of the files added, removed or modified, and whether
+// there is any
+func (s snapshot) changed(next snapshot) (string, bool) {
+	for path, t := range next {
+		if prev, ok := s[path]; !ok || !prev.Equal(t) {
+			return path, true
+		}
+	}
+	for path := range s {
+		if _, ok := next[path]; !ok {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// serve builds and runs the server, and rebuilds and restarts it once the watched
+// files change, until it is interrupted
+func serve(cfg *serveConfig) error {
+	dir, err := ioutil.TempDir("", "nano-serve")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	bin := filepath.Join(dir, "server")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	var server *exec.Cmd
+	restart := func() {
+		stop(server)
+		server = nil
+		build := exec.Command("go", "build", "-o", bin, cfg.Build)
+		build.Stdout, build.Stderr = os.Stdout, os.Stderr
+		if err := build.Run(); err != nil {
+			log.Println("Build failed, waiting for changes:", err)
+			return
+		}
+		cmd := exec.Command(bin, cfg.Args...)
+		cmd.Stdout, cmd.Stderr, cmd.Stdin = os.Stdout, os.Stderr, os.Stdin
+		cmd.Env = os.Environ()
+		for k, v := range cfg.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		if err := cmd.Start(); err != nil {
+			log.Println("Start server failed:", err)
+			return
+		}
+		log.Println("Server started, pid:", cmd.Process.Pid)
+		server = cmd
+	}
+
+	last := scan(cfg)
+	restart()
+	for {
+		select {
+		case <-sig:
+			stop(server)
+			return nil
+		case <-ticker.C:
+			next := scan(cfg)
+			if path, ok := last.changed(next); ok {
+				log.Println("Changed:", path)
+				restart()
+			}
+			last = next
+		}
+	}
+}
+
+// stop interrupts the server and kills it if it does not exit in time
+func stop(cmd *exec.Cmd) {
+	if cmd == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	// interrupt is not supported on windows
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+	select {
+	case <-done:
+	case <-time.After(defaultStopTimeout):
+		cmd.Process.Kill()
+		<-done
+	}
+}
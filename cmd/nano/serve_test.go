@@ -0,0 +1,96 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadServeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "serve.yaml")
+	ioutil.WriteFile(path, []byte("build: ./cmd/server\nargs: [\"--addr\", \":3250\"]\ninterval: 1s\n"), 0644)
+	cfg, err := loadServeConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &serveConfig{
+		Build:      "./cmd/server",
+		Args:       []string{"--addr", ":3250"},
+		Watch:      []string{"."},
+		Exclude:    []string{".git", "vendor", "node_modules"},
+		Extensions: []string{".go"},
+		Interval:   time.Second,
+	}
+	if !reflect.DeepEqual(cfg, expect) {
+		t.Fatalf("expect: %+v, got: %+v", expect, cfg)
+	}
+
+	ioutil.WriteFile(path, []byte("biuld: .\n"), 0644)
+	if _, err := loadServeConfig(path); err == nil {
+		t.Fatal("expect the unknown field rejected")
+	}
+}
+
+func TestSnapshot_Changed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".git", "ignored.go"), []byte("package git"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("readme"), 0644)
+
+	cfg := &serveConfig{Watch: []string{dir}, Exclude: []string{".git"}, Extensions: []string{".go"}}
+	last := scan(cfg)
+	if len(last) != 1 {
+		t.Fatalf("expect only main.go watched, got: %v", last)
+	}
+	if _, ok := last.changed(scan(cfg)); ok {
+		t.Fatal("expect no change")
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("changed"), 0644)
+	if _, ok := last.changed(scan(cfg)); ok {
+		t.Fatal("expect the files of other extensions not watched")
+	}
+	ioutil.WriteFile(filepath.Join(dir, "room.go"), []byte("package main"), 0644)
+	if path, ok := last.changed(scan(cfg)); !ok || filepath.Base(path) != "room.go" {
+		t.Fatalf("expect room.go added, got: %s", path)
+	}
+	os.Remove(filepath.Join(dir, "main.go"))
+	next := scan(cfg)
+	if path, ok := last.changed(next); !ok {
+		t.Fatalf("expect a change, got: %s", path)
+	}
+}
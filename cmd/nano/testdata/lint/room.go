@@ -0,0 +1,31 @@
+package lint
+
+import (
+	"github.com/lonng/nano/component"
+	nano "github.com/lonng/nano/session"
+
+	"example.com/game/pb"
+)
+
+type Room struct {
+	component.Base
+}
+
+type JoinRequest struct{}
+
+func (r *Room) Join(s *nano.Session, req *pb.JoinRequest) error { return nil }
+
+func (r *Room) Chat(s *nano.Session, msg *pb.ChatMessage_Text) error { return nil }
+
+func (r *Room) Leave(s *nano.Session, req *LeaveRequest) error { return nil }
+
+func (r *Room) Raw(s *nano.Session, data []byte) error { return nil }
+
+// not handlers
+func (r *Room) Init()                                    {}
+func (r *Room) count(s *nano.Session, data []byte) error { return nil }
+func (r *Room) Sum(a, b int) int                         { return a + b }
+
+type helper struct{}
+
+func (h *helper) Join(s *nano.Session, req *pb.JoinRequest) error { return nil }
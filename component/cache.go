@@ -0,0 +1,125 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package component
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/session"
+)
+
+// DefaultResponseCacheSize is the number of responses kept by the response
+// cache of a component if WithResponseCacheSize is absent
+const DefaultResponseCacheSize = 1024
+
+type (
+	// ResponseCache is a local LRU cache of the serialized responses of the
+	// handlers of a component, see WithResponseCache
+	ResponseCache struct {
+		ttl   time.Duration
+		size  int
+		keyFn func(*session.Session, []byte) string
+
+		mu    sync.Mutex
+		ll    *list.List
+		items map[string]*list.Element
+	}
+
+	cacheEntry struct {
+		key      string
+		data     []byte
+		deadline time.Time
+	}
+)
+
+func newResponseCache(ttl time.Duration, size int, keyFn func(*session.Session, []byte) string) *ResponseCache {
+	if size <= 0 {
+		size = DefaultResponseCacheSize
+	}
+	return &ResponseCache{
+		ttl:   ttl,
+		size:  size,
+		keyFn: keyFn,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// Key returns the cache key of the request of route, an empty string means the
+// request should not be cached
+func (c *ResponseCache) Key(route string, s *session.Session, payload []byte) string {
+	key := c.keyFn(s, payload)
+	if key == "" {
+		return ""
+	}
+	return route + "\x00" + key
+}
+
+// Get returns the cached response of key, the expired response is removed
+func (c *ResponseCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !env.Clock.Now().Before(entry.deadline) {
+		c.ll.Remove(e)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return entry.data, true
+}
+
+// Put stores the response of key, the least recently used response is evicted
+// if the cache is full
+func (c *ResponseCache) Put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline := env.Clock.Now().Add(c.ttl)
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		entry.data, entry.deadline = data, deadline
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, data: data, deadline: deadline})
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of responses in the cache, including the expired
+// responses which have not been removed
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
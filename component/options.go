@@ -20,11 +20,22 @@
 
 package component
 
+import (
+	"time"
+
+	"github.com/lonng/nano/session"
+)
+
 type (
 	options struct {
 		name      string              // component name
 		nameFunc  func(string) string // rename handler name
 		schedName string              // schedName name
+		shadow    Component           // shadow component mirrors the handlers
+		cacheTTL  time.Duration       // lifetime of the cached responses
+		cacheSize int                 // capacity of the response cache
+		cacheKey  func(*session.Session, []byte) string
+		quota     ComponentQuota // resource quota of the component
 	}
 
 	// Option used to customize handler
@@ -52,3 +63,35 @@ func WithSchedulerName(name string) Option {
 		opt.schedName = name
 	}
 }
+
+// WithShadow mirrors the handlers to the methods with the same name of shadow
+// component, which is used to compare a new implementation with the current one.
+// The shadow handler is invoked asynchronously after the handler returns, and its
+// response is compared with the response of handler but never sent to the client.
+func WithShadow(shadow Component) Option {
+	return func(opt *options) {
+		opt.shadow = shadow
+	}
+}
+
+// WithResponseCache caches the responses of the handlers for ttl in a local LRU
+// cache, which is used for the idempotent read-only handlers, e.g: the profile of
+// a player. The cache key of a request is returned by keyFn with the session and
+// the raw payload, and the request is not cached if the key is empty. On a cache
+// hit the cached response is sent without invoking the handler; on a miss the
+// response sent before the handler returns is cached, the responses sent later
+// asynchronously and the responses of failed handlers are never cached.
+func WithResponseCache(ttl time.Duration, keyFn func(*session.Session, []byte) string) Option {
+	return func(opt *options) {
+		opt.cacheTTL = ttl
+		opt.cacheKey = keyFn
+	}
+}
+
+// WithResponseCacheSize sets the number of responses kept by the response cache,
+// DefaultResponseCacheSize will be used if absent
+func WithResponseCacheSize(size int) Option {
+	return func(opt *options) {
+		opt.cacheSize = size
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package component
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrQuotaExceeded is returned for the messages of a component which has been
+// suspended for exceeding its quota. The rejected messages are dropped, like the
+// messages failed in the handlers no response is sent for the requests, so the
+// clients should time out the requests.
+var ErrQuotaExceeded = errors.New("component quota exceeded")
+
+type (
+	// ComponentQuota limits the resources used by a component, so that a buggy
+	// component can not starve the other components of the server, see WithQuota
+	ComponentQuota struct {
+		// MaxGoroutines is the maximum number of invocations of the handlers which
+		// have been started but not completed, zero for no limit. The messages
+		// queued in the schedulers are not counted.
+		MaxGoroutines int
+		// MaxHeapBytes is the maximum heap growth during an invocation of the
+		// handlers, zero for no limit
+		MaxHeapBytes uint64
+	}
+
+	// Quota enforces the ComponentQuota of a component, the component is suspended
+	// once any limit is breached, and all messages to it are rejected with
+	// ErrQuotaExceeded until it is resumed manually
+	Quota struct {
+		ComponentQuota
+		sem       chan struct{} // semaphore of the invocations
+		suspended int32
+
+		mu     sync.Mutex
+		reason string // reason of suspension
+	}
+)
+
+// WithQuota limits the resources used by the component. The heap growth is
+// measured by runtime.ReadMemStats snapshots before and after each invocation,
+// which stops the world, and the allocations of other goroutines running at the
+// same time are counted, e.g: if the handlers are dispatched to a worker pool, so
+// MaxHeapBytes should only be used to catch the runaway handlers.
+func WithQuota(quota ComponentQuota) Option {
+	return func(opt *options) {
+		opt.quota = quota
+	}
+}
+
+func newQuota(q ComponentQuota) *Quota {
+	quota := &Quota{ComponentQuota: q}
+	if q.MaxGoroutines > 0 {
+		quota.sem = make(chan struct{}, q.MaxGoroutines)
+	}
+	return quota
+}
+
+// Acquire acquires the quota for an invocation when it starts, which should be
+// released by Release after the invocation completes. ErrQuotaExceeded is returned if the
+// component has been suspended, or it is suspended as there are MaxGoroutines
+// invocations not completed.
+func (q *Quota) Acquire() error {
+	if atomic.LoadInt32(&q.suspended) == 1 {
+		return ErrQuotaExceeded
+	}
+	if q.sem == nil {
+		return nil
+	}
+	select {
+	case q.sem <- struct{}{}:
+		return nil
+	default:
+		q.Suspend(fmt.Sprintf("%d goroutines exceeded", q.MaxGoroutines))
+		return ErrQuotaExceeded
+	}
+}
+
+// Release releases the quota acquired by Acquire
+func (q *Quota) Release() {
+	if q.sem != nil {
+		<-q.sem
+	}
+}
+
+// Track takes a heap snapshot before an invocation, and the returned function
+// should be called after the invocation to suspend the component if the heap
+// has grown more than MaxHeapBytes.
+func (q *Quota) Track() func() {
+	if q.MaxHeapBytes == 0 {
+		return func() {}
+	}
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	return func() {
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		if after.HeapAlloc > before.HeapAlloc && after.HeapAlloc-before.HeapAlloc > q.MaxHeapBytes {
+			q.Suspend(fmt.Sprintf("heap grew %d bytes in an invocation, %d bytes exceeded",
+				after.HeapAlloc-before.HeapAlloc, q.MaxHeapBytes))
+		}
+	}
+}
+
+// Suspend suspends the component with the reason
+func (q *Quota) Suspend(reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if atomic.LoadInt32(&q.suspended) == 1 {
+		return
+	}
+	q.reason = reason
+	atomic.StoreInt32(&q.suspended, 1)
+}
+
+// Resume resumes the suspended component
+func (q *Quota) Resume() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reason = ""
+	atomic.StoreInt32(&q.suspended, 0)
+}
+
+// Suspended returns the reason if the component has been suspended
+func (q *Quota) Suspended() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.reason, atomic.LoadInt32(&q.suspended) == 1
+}
@@ -34,6 +34,8 @@ type (
 		Type          reflect.Type   // low-level type of method
 		IsRawArg      bool           // whether the data need to serialize
 		ParentService *Service
+		Shadow        *Handler       // handler of the shadow component, see WithShadow
+		Cache         *ResponseCache // response cache shared by the handlers of the service, see WithResponseCache
 	}
 
 	// Service implements a specific service, some of it's methods will be
@@ -44,6 +46,7 @@ type (
 		Receiver  reflect.Value       // receiver of methods for the service
 		Handlers  map[string]*Handler // registered methods
 		SchedName string              // name of scheduler variable in session data
+		Quota     *Quota              // resource quota of the service, nil for no quota, see WithQuota
 		Options   options             // options
 	}
 )
@@ -65,6 +68,9 @@ func NewService(comp Component, opts []Option) *Service {
 		s.Name = reflect.Indirect(s.Receiver).Type().Name()
 	}
 	s.SchedName = s.Options.schedName
+	if q := s.Options.quota; q.MaxGoroutines > 0 || q.MaxHeapBytes > 0 {
+		s.Quota = newQuota(q)
+	}
 
 	return s
 }
@@ -121,9 +127,44 @@ func (s *Service) ExtractHandler() error {
 		return errors.New(str)
 	}
 
+	var cache *ResponseCache
+	if s.Options.cacheKey != nil && s.Options.cacheTTL > 0 {
+		cache = newResponseCache(s.Options.cacheTTL, s.Options.cacheSize, s.Options.cacheKey)
+	}
 	for i := range s.Handlers {
 		s.Handlers[i].Receiver = s.Receiver
+		s.Handlers[i].Cache = cache
+	}
+
+	if s.Options.shadow != nil {
+		return s.extractShadow()
+	}
+	return nil
+}
+
+// extractShadow binds the handlers to the methods with the same name of the
+// shadow component, the handlers without such method are not mirrored
+func (s *Service) extractShadow() error {
+	shadow := &Service{
+		Name:     s.Name,
+		Type:     reflect.TypeOf(s.Options.shadow),
+		Receiver: reflect.ValueOf(s.Options.shadow),
+		Options:  options{nameFunc: s.Options.nameFunc},
+	}
+	if err := shadow.ExtractHandler(); err != nil {
+		return errors.New("shadow: " + err.Error())
 	}
 
+	for name, h := range s.Handlers {
+		sh, ok := shadow.Handlers[name]
+		if !ok {
+			continue
+		}
+		if sh.Type != h.Type {
+			return errors.New("shadow: handler " + s.Name + "." + name + " has argument of type " +
+				sh.Type.String() + ", expect " + h.Type.String())
+		}
+		h.Shadow = sh
+	}
 	return nil
 }
@@ -0,0 +1,291 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package e2e
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/internal/packet"
+)
+
+// RequestTimeout is the maximum duration to wait for the response of a request.
+var RequestTimeout = 5 * time.Second
+
+var (
+	// ErrClientClosed is returned by the requests of a closed client.
+	ErrClientClosed = errors.New("e2e: client closed")
+	// ErrRequestTimeout is returned if the response is not received in RequestTimeout.
+	ErrRequestTimeout = errors.New("e2e: request timeout")
+)
+
+// CancelFunc cancels a subscription.
+type CancelFunc func()
+
+// TestClient is a client connected to the test server with a real TCP connection,
+// the messages are serialized by the serializer of the server.
+type TestClient struct {
+	conn    net.Conn
+	decoder *codec.Decoder
+	die     chan struct{} // closed when the client is closed
+	exit    chan struct{} // closed when the read goroutine exits
+
+	mu        sync.Mutex
+	closed    bool
+	mid       uint64
+	responses map[uint64]chan []byte
+	subs      map[string]map[int]func([]byte)
+	subID     int
+
+	muWrite sync.Mutex
+}
+
+func dial(addr string) (*TestClient, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &TestClient{
+		conn:      conn,
+		decoder:   codec.NewDecoder(),
+		die:       make(chan struct{}),
+		exit:      make(chan struct{}),
+		responses: map[uint64]chan []byte{},
+		subs:      map[string]map[int]func([]byte){},
+	}
+	if err := c.handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.read()
+	return c, nil
+}
+
+// handshake sends the handshake packet and waits for the response, the packets
+// following the response are processed by the read goroutine.
+func (c *TestClient) handshake() error {
+	data, err := json.Marshal(map[string]interface{}{"sys": map[string]interface{}{"version": "1.0.0"}})
+	if err != nil {
+		return err
+	}
+	if err := c.write(packet.Handshake, data); err != nil {
+		return err
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(RequestTimeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, 1024)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		packets, err := c.decoder.Decode(buf[:n])
+		if err != nil {
+			return err
+		}
+		if len(packets) == 0 {
+			continue
+		}
+		if packets[0].Type != packet.Handshake {
+			return fmt.Errorf("e2e: expect handshake response, got packet type: %d", packets[0].Type)
+		}
+		return c.write(packet.HandshakeAck, nil)
+	}
+}
+
+func (c *TestClient) write(typ packet.Type, data []byte) error {
+	p, err := codec.Encode(typ, data)
+	if err != nil {
+		return err
+	}
+	c.muWrite.Lock()
+	defer c.muWrite.Unlock()
+	_, err = c.conn.Write(p)
+	return err
+}
+
+func (c *TestClient) send(m *message.Message) error {
+	data, err := message.Encode(m)
+	if err != nil {
+		return err
+	}
+	return c.write(packet.Data, data)
+}
+
+// Request sends a request to the route, and waits for the response to be
+// unmarshalled into resp.
+func (c *TestClient) Request(route string, req proto.Message, resp proto.Message) error {
+	data, err := env.Serializer.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClientClosed
+	}
+	c.mid++
+	mid := c.mid
+	ch := make(chan []byte, 1)
+	c.responses[mid] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.responses, mid)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(&message.Message{Type: message.Request, ID: mid, Route: route, Data: data}); err != nil {
+		return err
+	}
+
+	select {
+	case data := <-ch:
+		return env.Serializer.Unmarshal(data, resp)
+	case <-c.die:
+		return ErrClientClosed
+	case <-time.After(RequestTimeout):
+		return ErrRequestTimeout
+	}
+}
+
+// Notify sends a notify message to the route, which has no response.
+func (c *TestClient) Notify(route string, req proto.Message) error {
+	data, err := env.Serializer.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return c.send(&message.Message{Type: message.Notify, Route: route, Data: data})
+}
+
+// Subscribe calls handler with the payload of the messages pushed to the route
+// until the returned CancelFunc is called. The handlers are called by the read
+// goroutine in order, so a handler should not block.
+func (c *TestClient) Subscribe(route string, handler func([]byte)) CancelFunc {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subID++
+	id := c.subID
+	if c.subs[route] == nil {
+		c.subs[route] = map[int]func([]byte){}
+	}
+	c.subs[route][id] = handler
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.subs[route], id)
+	}
+}
+
+// Close closes the connection and waits for the read goroutine to exit.
+func (c *TestClient) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.die)
+	c.mu.Unlock()
+
+	err := c.conn.Close()
+	<-c.exit
+	return err
+}
+
+func (c *TestClient) read() {
+	defer func() {
+		close(c.exit)
+		c.Close()
+	}()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		packets, err := c.decoder.Decode(buf[:n])
+		if err != nil {
+			return
+		}
+		for _, p := range packets {
+			if !c.process(p) {
+				return
+			}
+		}
+	}
+}
+
+// process processes a packet from the server, false is returned if the client
+// should be closed.
+func (c *TestClient) process(p *packet.Packet) bool {
+	switch p.Type {
+	case packet.Heartbeat:
+		return c.write(packet.Heartbeat, nil) == nil
+
+	case packet.Kick:
+		return false
+
+	case packet.Data:
+		m, err := message.Decode(p.Data)
+		if err != nil {
+			return false
+		}
+		c.mu.Lock()
+		switch m.Type {
+		case message.Response:
+			if ch, ok := c.responses[m.ID]; ok {
+				select {
+				case ch <- m.Data:
+				default:
+					// duplicated response
+				}
+			}
+			c.mu.Unlock()
+
+		case message.Push:
+			handlers := make([]func([]byte), 0, len(c.subs[m.Route]))
+			for _, h := range c.subs[m.Route] {
+				handlers = append(handlers, h)
+			}
+			c.mu.Unlock()
+			for _, h := range handlers {
+				h(m.Data)
+			}
+
+		default:
+			c.mu.Unlock()
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package e2e
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lonng/nano"
+	"github.com/lonng/nano/benchmark/testdata"
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/session"
+)
+
+type EchoComponent struct {
+	component.Base
+}
+
+func (e *EchoComponent) Echo(s *session.Session, ping *testdata.Ping) error {
+	return s.Response(&testdata.Pong{Content: ping.Content})
+}
+
+func (e *EchoComponent) Broadcast(s *session.Session, ping *testdata.Ping) error {
+	return s.Push("onBroadcast", &testdata.Pong{Content: ping.Content})
+}
+
+func startEchoServer(t *testing.T) *TestEnv {
+	components := &component.Components{}
+	components.Register(&EchoComponent{})
+	return StartTestServer(t, nano.WithComponents(components))
+}
+
+func TestClient_Request(t *testing.T) {
+	env := startEchoServer(t)
+	client, err := env.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{"hello", "world"} {
+		pong := &testdata.Pong{}
+		if err := client.Request("EchoComponent.Echo", &testdata.Ping{Content: content}, pong); err != nil {
+			t.Fatal(err)
+		}
+		if pong.Content != content {
+			t.Fatalf("expect: %s, got: %s", content, pong.Content)
+		}
+	}
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	env := startEchoServer(t)
+	client, err := env.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan string, 1)
+	cancel := client.Subscribe("onBroadcast", func(data []byte) {
+		pong := &testdata.Pong{}
+		if err := proto.Unmarshal(data, pong); err != nil {
+			t.Error(err)
+		}
+		received <- pong.Content
+	})
+	if err := client.Notify("EchoComponent.Broadcast", &testdata.Ping{Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case content := <-received:
+		if content != "hello" {
+			t.Fatalf("expect: hello, got: %s", content)
+		}
+	case <-time.After(RequestTimeout):
+		t.Fatal("expect the push to be received")
+	}
+
+	// the cancelled subscription receives nothing
+	cancel()
+	if err := client.Notify("EchoComponent.Broadcast", &testdata.Ping{Content: "world"}); err != nil {
+		t.Fatal(err)
+	}
+	// wait for the notify to be processed
+	pong := &testdata.Pong{}
+	if err := client.Request("EchoComponent.Echo", &testdata.Ping{Content: "sync"}, pong); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case content := <-received:
+		t.Fatalf("unexpected push: %s", content)
+	default:
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	env := startEchoServer(t)
+	client, err := env.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Request("EchoComponent.Echo", &testdata.Ping{Content: "hello"}, &testdata.Pong{}); err != ErrClientClosed {
+		t.Fatalf("expect: %v, got: %v", ErrClientClosed, err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package e2e starts a full nano server and real clients in the test process, so
+// that the handlers can be tested end to end over a TCP connection without running
+// a server outside of the tests.
+//
+//	func TestRoom_Join(t *testing.T) {
+//		components := &component.Components{}
+//		components.Register(&Room{})
+//		env := e2e.StartTestServer(t, nano.WithComponents(components))
+//
+//		client, err := env.Dial()
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		resp := &pb.JoinResponse{}
+//		if err := client.Request("Room.Join", &pb.JoinRequest{}, resp); err != nil {
+//			t.Fatal(err)
+//		}
+//	}
+//
+// Only one server can run in a process at a time, so the tests using the package
+// must not run in parallel.
+package e2e
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano"
+)
+
+// StartTimeout is the maximum duration to wait for the test server to accept
+// connections.
+var StartTimeout = 5 * time.Second
+
+// TestEnv is a nano server running in the test process, which is shut down with
+// all clients dialed to it when the test completes.
+type TestEnv struct {
+	t    *testing.T
+	addr string
+	done chan struct{} // closed when the server has been shut down
+
+	mu      sync.Mutex
+	clients []*TestClient
+}
+
+// StartTestServer starts a singleton server listening on a free loopback port with
+// the options, and waits until it accepts connections. The server and the clients
+// dialed by the returned TestEnv are cleaned up via t.Cleanup.
+func StartTestServer(t *testing.T, opts ...nano.Option) *TestEnv {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	e := &TestEnv{t: t, addr: addr, done: make(chan struct{})}
+	go func() {
+		defer close(e.done)
+		nano.Listen(addr, opts...)
+	}()
+	t.Cleanup(e.shutdown)
+
+	deadline := time.Now().Add(StartTimeout)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return e
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("test server is not started in %v: %v", StartTimeout, err)
+		}
+		select {
+		case <-e.done:
+			t.Fatal("test server exited, is there another server running?")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// Addr returns the address of the test server.
+func (e *TestEnv) Addr() string {
+	return e.addr
+}
+
+// Dial connects a new client to the test server and completes the handshake.
+func (e *TestEnv) Dial() (*TestClient, error) {
+	c, err := dial(e.addr)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.clients = append(e.clients, c)
+	e.mu.Unlock()
+	return c, nil
+}
+
+// shutdown closes the clients, and then shuts down the server and waits for it
+// to exit.
+func (e *TestEnv) shutdown() {
+	e.mu.Lock()
+	clients := e.clients
+	e.clients = nil
+	e.mu.Unlock()
+	for _, c := range clients {
+		c.Close()
+	}
+
+	select {
+	case <-e.done:
+		return
+	default:
+	}
+	nano.Shutdown()
+	<-e.done
+}
@@ -0,0 +1,230 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package encryption provides an optional payload encryption layer. A shared
+// secret is derived during handshake by a pluggable KeyExchange, and message
+// payloads are sealed with AES-GCM using a per-session key.
+//
+// The client opts in by adding its public parameters to the handshake request:
+//
+//	{"sys": {"crypto": {"key": "<base64 client public key>"}}}
+//
+// and the server replies with its own public parameters in the handshake response:
+//
+//	{"code": 200, "sys": {"crypto": {"key": "<base64 server public key>"}}}
+//
+// Clients which do not send the crypto field keep talking in plaintext, so both
+// kinds of clients can be served by the same acceptor during migration.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/session"
+)
+
+// Errors that could be occurred during encryption
+var (
+	ErrInvalidPublicKey = errors.New("encryption: invalid public key")
+	ErrShortCiphertext  = errors.New("encryption: ciphertext too short")
+	ErrReplayedNonce    = errors.New("encryption: nonce is not monotonic")
+)
+
+const (
+	seqLength = 8
+
+	// nonce prefix of each direction, keeps the nonce of both sides disjoint
+	// even if they share the same key and sequence
+	directionServer uint32 = 1
+	directionClient uint32 = 2
+)
+
+// KeyExchange derives a shared secret with the client during handshake.
+type KeyExchange interface {
+	// Exchange receives the public parameters sent by the client and returns
+	// the public parameters which will be sent back to the client, and the
+	// shared secret used to derive the session key.
+	Exchange(peer []byte) (public []byte, secret []byte, err error)
+}
+
+// ecdh implements KeyExchange with an ephemeral ECDH key per session
+type ecdh struct {
+	curve elliptic.Curve
+}
+
+// NewECDHKeyExchange returns a KeyExchange based on ephemeral ECDH over the
+// P-256 curve, public keys are encoded in the uncompressed form.
+func NewECDHKeyExchange() KeyExchange {
+	return &ecdh{curve: elliptic.P256()}
+}
+
+// Exchange implements the KeyExchange interface
+func (e *ecdh) Exchange(peer []byte) ([]byte, []byte, error) {
+	x, y := elliptic.Unmarshal(e.curve, peer)
+	if x == nil {
+		return nil, nil, ErrInvalidPublicKey
+	}
+
+	priv, px, py, err := elliptic.GenerateKey(e.curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sx, _ := e.curve.ScalarMult(x, y, priv)
+	b := sx.Bytes()
+	secret := make([]byte, (e.curve.Params().BitSize+7)/8)
+	copy(secret[len(secret)-len(b):], b)
+	return elliptic.Marshal(e.curve, px, py), secret, nil
+}
+
+// Cipher seals and opens payloads of a session with AES-GCM, the nonce of
+// each direction is a monotonic sequence, which is transferred in front of
+// the ciphertext.
+type Cipher struct {
+	aead    cipher.AEAD
+	sendDir uint32
+	recvDir uint32
+	sendSeq uint64 // last sent sequence
+
+	mu      sync.Mutex
+	recvSeq uint64 // last received sequence
+}
+
+// NewServerCipher returns the server side Cipher of the shared secret
+func NewServerCipher(secret []byte) (*Cipher, error) {
+	return newCipher(secret, directionServer, directionClient)
+}
+
+// NewClientCipher returns the client side Cipher of the shared secret, which
+// is useful for testing and Go clients.
+func NewClientCipher(secret []byte) (*Cipher, error) {
+	return newCipher(secret, directionClient, directionServer)
+}
+
+func newCipher(secret []byte, send, recv uint32) (*Cipher, error) {
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead, sendDir: send, recvDir: recv}, nil
+}
+
+func (c *Cipher) nonce(dir uint32, seq uint64) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce, dir)
+	binary.BigEndian.PutUint64(nonce[len(nonce)-seqLength:], seq)
+	return nonce
+}
+
+// Seal encrypts the plaintext, the result is the 8 bytes sequence followed
+// by the ciphertext.
+func (c *Cipher) Seal(plaintext []byte) []byte {
+	seq := atomic.AddUint64(&c.sendSeq, 1)
+	out := make([]byte, seqLength, seqLength+len(plaintext)+c.aead.Overhead())
+	binary.BigEndian.PutUint64(out, seq)
+	return c.aead.Seal(out, c.nonce(c.sendDir, seq), plaintext, nil)
+}
+
+// Open decrypts the data sealed by the peer, data with a sequence which is not
+// greater than the last one will be rejected.
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	if len(data) < seqLength+c.aead.Overhead() {
+		return nil, ErrShortCiphertext
+	}
+	seq := binary.BigEndian.Uint64(data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if seq <= c.recvSeq {
+		return nil, ErrReplayedNonce
+	}
+	plaintext, err := c.aead.Open(nil, c.nonce(c.recvDir, seq), data[seqLength:], nil)
+	if err != nil {
+		return nil, err
+	}
+	c.recvSeq = seq
+	return plaintext, nil
+}
+
+// ciphers maps session id to the Cipher of the session
+var ciphers sync.Map
+
+func init() {
+	session.Lifetime.OnClosed(func(s *session.Session) {
+		ciphers.Delete(s.ID())
+	})
+}
+
+// Attach binds the cipher to the session, all subsequent payloads of the
+// session will be processed by the Inbound and Outbound stages.
+func Attach(s *session.Session, c *Cipher) {
+	ciphers.Store(s.ID(), c)
+}
+
+// CipherOf returns the cipher bound to the session, nil if the session is
+// working in plaintext mode.
+func CipherOf(s *session.Session) *Cipher {
+	c, ok := ciphers.Load(s.ID())
+	if !ok {
+		return nil
+	}
+	return c.(*Cipher)
+}
+
+// Inbound is a pipeline stage which decrypts the payload of the message,
+// messages of plaintext sessions are passed through.
+func Inbound(s *session.Session, msg *message.Message) error {
+	c := CipherOf(s)
+	if c == nil {
+		return nil
+	}
+	data, err := c.Open(msg.Data)
+	if err != nil {
+		return err
+	}
+	msg.Data = data
+	return nil
+}
+
+// Outbound is a pipeline stage which encrypts the payload of the message,
+// messages of plaintext sessions are passed through.
+func Outbound(s *session.Session, msg *message.Message) error {
+	c := CipherOf(s)
+	if c == nil {
+		return nil
+	}
+	msg.Data = c.Seal(msg.Data)
+	return nil
+}
@@ -0,0 +1,84 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func exchange(t *testing.T) (*Cipher, *Cipher) {
+	curve := elliptic.P256()
+	priv, x, y, err := elliptic.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public, secret, err := NewECDHKeyExchange().Exchange(elliptic.Marshal(curve, x, y))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	px, py := elliptic.Unmarshal(curve, public)
+	sx, _ := curve.ScalarMult(px, py, priv)
+	b := sx.Bytes()
+	clientSecret := make([]byte, len(secret))
+	copy(clientSecret[len(clientSecret)-len(b):], b)
+	if !bytes.Equal(secret, clientSecret) {
+		t.Fatal("shared secret mismatch")
+	}
+
+	server, err := NewServerCipher(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClientCipher(clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestCipher(t *testing.T) {
+	server, client := exchange(t)
+
+	payload := []byte("hello nano")
+	data, err := server.Open(client.Seal(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Fatalf("expect: %s, got: %s", payload, data)
+	}
+
+	data, err = client.Open(server.Seal(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Fatalf("expect: %s, got: %s", payload, data)
+	}
+}
+
+func TestCipher_Replay(t *testing.T) {
+	server, client := exchange(t)
+
+	sealed := client.Seal([]byte("hello"))
+	if _, err := server.Open(sealed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Open(sealed); err != ErrReplayedNonce {
+		t.Fatalf("expect: %v, got: %v", ErrReplayedNonce, err)
+	}
+
+	// messages sealed by the server can not be reflected back to the server
+	if _, err := server.Open(server.Seal([]byte("hello"))); err == nil {
+		t.Fatal("expect reflected message to be rejected")
+	}
+}
+
+func TestExchange_InvalidKey(t *testing.T) {
+	if _, _, err := NewECDHKeyExchange().Exchange([]byte("invalid")); err != ErrInvalidPublicKey {
+		t.Fatalf("expect: %v, got: %v", ErrInvalidPublicKey, err)
+	}
+}
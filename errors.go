@@ -20,7 +20,11 @@
 
 package nano
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/lonng/nano/cluster"
+)
 
 // Errors that could be occurred during message handling.
 var (
@@ -28,4 +32,21 @@ var (
 	ErrClosedGroup        = errors.New("group closed")
 	ErrMemberNotFound     = errors.New("member not found in the group")
 	ErrSessionDuplication = errors.New("session has existed in the current group")
+	ErrGroupFull          = errors.New("group is full")
+	ErrWaitlisted         = errors.New("group is full, session is waiting for a vacancy")
+	ErrGroupCycle         = errors.New("group cannot be a descendant of itself")
+	ErrGroupHasParent     = errors.New("group has been a child of another group")
+
+	// ErrUserNotFound indicates the user has not been bound to any session, the
+	// message can be delivered offline instead.
+	ErrUserNotFound = cluster.ErrUserNotFound
+
+	// ErrDuplicateLogin is returned by Session.Bind if the user has logged in with
+	// another session and the duplicate login policy rejects the new session.
+	ErrDuplicateLogin = cluster.ErrDuplicateLogin
+
+	// Errors of the transactions, see TxManager.
+	ErrTxDone               = errors.New("transaction has been committed or rolled back")
+	ErrDuplicateParticipant = errors.New("component has been registered to the transaction")
+	ErrUnknownParticipant   = errors.New("participant of the transaction log is not provided to recover")
 )
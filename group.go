@@ -27,6 +27,7 @@ import (
 
 	"github.com/lonng/nano/internal/env"
 	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/membership"
 	"github.com/lonng/nano/internal/message"
 	"github.com/lonng/nano/session"
 )
@@ -41,20 +42,86 @@ const (
 type SessionFilter func(*session.Session) bool
 
 // Group represents a session group which used to manage a number of
-// sessions, data send to the group will send to all session in it.
+// sessions, data send to the group will send to all session in it. The
+// members of the group held by a backend node can be served by different
+// frontend nodes, the broadcasts are fanned out to each frontend with one
+// request, e.g: the world chat channels.
 type Group struct {
 	mu       sync.RWMutex
 	status   int32                      // channel current status
 	name     string                     // channel name
 	sessions map[int64]*session.Session // session id map to session instance
+	store    GroupStore                 // saves the uids of members, nil if not persistent
+	uids     map[int64]bool             // uids saved to store
+	metas    map[int64]MemberMeta       // session id map to metadata of member
+
+	maxMembers int          // capacity of the group, 0 means unlimited
+	fullPolicy FullPolicy   // how the sessions joining the full group are treated
+	approve    JoinApproval // approves the sessions to join, nil if no approval
+	waitlist   []waiter     // sessions waiting for vacancies
+	coalesce   *coalescer   // coalesces the broadcasts, nil if not coalescing
+
+	parent   *Group   // parent group, guarded by hierarchy
+	children []*Group // child groups, guarded by hierarchy
+
+	onJoin  []MemberHandler  // callbacks after a session joined
+	onLeave []MemberHandler  // callbacks after a session left
+	onEmpty []func(g *Group) // callbacks after the last session left
 }
 
-// NewGroup returns a new group instance
-func NewGroup(n string) *Group {
-	return &Group{
+// NewGroup returns a new group instance, e.g: a room of 4 players
+//
+//	room := nano.NewGroup("room-42", nano.WithMaxMembers(4), nano.WithFullPolicy(nano.FullWaitlist))
+func NewGroup(n string, opts ...GroupOption) *Group {
+	g := &Group{
 		status:   groupStatusWorking,
 		name:     n,
 		sessions: make(map[int64]*session.Session),
+		metas:    make(map[int64]MemberMeta),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	membership.Register(n, g)
+	g.restore()
+	return g
+}
+
+// restore loads the membership from the persistence adapter, and keeps the
+// sessions which are still connected
+func (c *Group) restore() {
+	sids, err := groupPersistence.LoadMembership(c.name)
+	if err != nil {
+		log.Println(fmt.Sprintf("Load membership of group %s failed: %v", c.name, err))
+		return
+	}
+	if len(sids) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, sid := range sids {
+		if s := findSession(sid); s != nil {
+			c.sessions[sid] = s
+			membership.Join(s, c.name)
+		}
+	}
+	if len(c.sessions) != len(sids) {
+		c.persist()
+	}
+}
+
+// persist saves the membership to the persistence adapter, the caller
+// should hold the lock
+func (c *Group) persist() {
+	sids := make([]int64, 0, len(c.sessions))
+	for sid := range c.sessions {
+		sids = append(sids, sid)
+	}
+	if err := groupPersistence.SaveMembership(c.name, sids); err != nil {
+		log.Println(fmt.Sprintf("Save membership of group %s failed: %v", c.name, err))
 	}
 }
 
@@ -100,18 +167,22 @@ func (c *Group) Multicast(route string, v interface{}, filter SessionFilter) err
 		log.Println(fmt.Sprintf("Multicast %s, Data=%+v", route, v))
 	}
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	// the message is encoded once and shared by all the members
+	m := session.NewSharedMessage(route, data)
+	defer m.Release()
 
+	c.mu.RLock()
+	members := make([]*session.Session, 0, len(c.sessions))
 	for _, s := range c.sessions {
-		if !filter(s) {
-			continue
-		}
-		if err = s.Push(route, data); err != nil {
-			log.Println(err.Error())
+		if filter(s) {
+			members = append(members, s)
 		}
 	}
+	c.mu.RUnlock()
 
+	session.PushSharedAll(members, m, func(_ *session.Session, err error) {
+		log.Println(err.Error())
+	})
 	return nil
 }
 
@@ -121,6 +192,11 @@ func (c *Group) Broadcast(route string, v interface{}) error {
 		return ErrClosedGroup
 	}
 
+	if c.coalesce != nil {
+		c.coalesce.queue(c, route, v)
+		return nil
+	}
+
 	data, err := message.Serialize(v)
 	if err != nil {
 		return err
@@ -130,18 +206,111 @@ func (c *Group) Broadcast(route string, v interface{}) error {
 		log.Println(fmt.Sprintf("Broadcast %s, Data=%+v", route, v))
 	}
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	return c.broadcast(route, data, nil, nil)
+}
+
+// BroadcastFilter pushes the message to the members accepted by filter, e.g: the
+// players of a team, the message is encoded once and shared by them. Unlike
+// Multicast, the last error of the pushes is returned.
+func (c *Group) BroadcastFilter(route string, v interface{}, filter SessionFilter) error {
+	if c.isClosed() {
+		return ErrClosedGroup
+	}
+
+	data, err := message.Serialize(v)
+	if err != nil {
+		return err
+	}
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("BroadcastFilter %s, Data=%+v", route, v))
+	}
+
+	return c.broadcast(route, data, filter, nil)
+}
+
+// PayloadTransform customizes the payload of a broadcast for a member, common is
+// the payload serialized once for all the members which must not be modified. The
+// common payload is pushed if nil or common itself is returned, e.g: the protobuf
+// fields private to the member can be appended to a copy of common, since the
+// concatenated messages are merged when decoding.
+type PayloadTransform func(s *session.Session, common []byte) []byte
+
+// BroadcastTransform pushes the message to all members with the payload customized
+// by transform, e.g: to hide the private data of other players. The message is
+// serialized once, and the members receiving the common payload share the encoded
+// packet as Broadcast, only the customized payloads are encoded per member.
+func (c *Group) BroadcastTransform(route string, v interface{}, transform PayloadTransform) error {
+	if c.isClosed() {
+		return ErrClosedGroup
+	}
+
+	data, err := message.Serialize(v)
+	if err != nil {
+		return err
+	}
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("BroadcastTransform %s, Data=%+v", route, v))
+	}
+
+	return c.broadcast(route, data, nil, transform)
+}
 
+// broadcast pushes the serialized payload to the members accepted by filter, and
+// returns the last error of the pushes, filter and transform can be nil
+func (c *Group) broadcast(route string, data []byte, filter SessionFilter, transform PayloadTransform) error {
+	c.mu.RLock()
+	members := make([]*session.Session, 0, len(c.sessions))
 	for _, s := range c.sessions {
-		if err = s.Push(route, data); err != nil {
-			log.Println(fmt.Sprintf("Session push message error, ID=%d, UID=%d, Error=%s", s.ID(), s.UID(), err.Error()))
+		if filter == nil || filter(s) {
+			members = append(members, s)
 		}
 	}
+	c.mu.RUnlock()
 
+	return pushAll(route, data, members, transform)
+}
+
+// pushAll pushes the serialized payload to the sessions, and returns the last
+// error of the pushes, transform can be nil
+func pushAll(route string, data []byte, members []*session.Session, transform PayloadTransform) error {
+	var err error
+	onError := func(s *session.Session, e error) {
+		err = e
+		log.Println(fmt.Sprintf("Session push message error, ID=%d, UID=%d, Error=%s", s.ID(), s.UID(), e.Error()))
+	}
+
+	if transform != nil {
+		// the capacity is limited so that appending to common always copies
+		common := data[:len(data):len(data)]
+		shared := members[:0]
+		for _, s := range members {
+			payload := transform(s, common)
+			if payload == nil || sameBytes(payload, data) {
+				shared = append(shared, s)
+				continue
+			}
+			if e := s.Push(route, payload); e != nil {
+				onError(s, e)
+			}
+		}
+		members = shared
+	}
+
+	// the message is encoded once and shared by all the members, and the members
+	// served by other nodes are pushed in one request per node
+	m := session.NewSharedMessage(route, data)
+	defer m.Release()
+	session.PushSharedAll(members, m, onError)
 	return err
 }
 
+// sameBytes reports whether a and b are the same slice
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
 // Contains check whether a UID is contained in current group or not
 func (c *Group) Contains(uid int64) bool {
 	_, err := c.Member(uid)
@@ -150,6 +319,11 @@ func (c *Group) Contains(uid int64) bool {
 
 // Add add session to group
 func (c *Group) Add(session *session.Session) error {
+	return c.add(session, nil)
+}
+
+// add adds the session to group with the metadata, which can be nil
+func (c *Group) add(session *session.Session, meta MemberMeta) error {
 	if c.isClosed() {
 		return ErrClosedGroup
 	}
@@ -158,19 +332,49 @@ func (c *Group) Add(session *session.Session) error {
 		log.Println(fmt.Sprintf("Add session to group %s, ID=%d, UID=%d", c.name, session.ID(), session.UID()))
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if c.approve != nil {
+		if err := c.approve(c, session); err != nil {
+			return err
+		}
+	}
 
-	id := session.ID()
+	c.mu.Lock()
 	_, ok := c.sessions[session.ID()]
 	if ok {
+		c.mu.Unlock()
 		return ErrSessionDuplication
 	}
 
-	c.sessions[id] = session
+	if c.full() {
+		err := c.wait(session, meta)
+		c.mu.Unlock()
+		return err
+	}
+
+	c.join(session, meta)
+	onJoin := c.onJoin
+	c.mu.Unlock()
+
+	c.joined(onJoin, session)
 	return nil
 }
 
+// join records the session as a member, the caller should hold the lock
+func (c *Group) join(s *session.Session, meta MemberMeta) {
+	id := s.ID()
+	c.sessions[id] = s
+	if len(meta) > 0 {
+		copied := make(MemberMeta, len(meta))
+		for k, v := range meta {
+			copied[k] = v
+		}
+		c.metas[id] = copied
+	}
+	membership.Join(s, c.name)
+	c.persist()
+	c.addMember(s.UID())
+}
+
 // Leave remove specified UID related session from group
 func (c *Group) Leave(s *session.Session) error {
 	if c.isClosed() {
@@ -181,11 +385,37 @@ func (c *Group) Leave(s *session.Session) error {
 		log.Println(fmt.Sprintf("Remove session from group %s, UID=%d", c.name, s.UID()))
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.remove(s, false)
+	return nil
+}
 
+// remove removes the session from group and calls the callbacks if it is a
+// member, the uid of the closed session is kept in the store of the persistent
+// group so that the user rejoins once it is bound again
+func (c *Group) remove(s *session.Session, closed bool) {
+	c.mu.Lock()
+	if _, ok := c.sessions[s.ID()]; !ok {
+		c.unwait(s)
+		c.mu.Unlock()
+		return
+	}
 	delete(c.sessions, s.ID())
-	return nil
+	membership.Leave(s, c.name)
+	c.persist()
+	if !closed {
+		c.removeMember(s.UID())
+	}
+	promoted := c.promote()
+	empty := len(c.sessions) == 0
+	onJoin, onLeave, onEmpty := c.onJoin, c.onLeave, c.onEmpty
+	c.mu.Unlock()
+
+	left := []*session.Session{s}
+	c.left(onLeave, onEmpty, left, empty)
+	c.forget(left)
+	for _, p := range promoted {
+		c.joined(onJoin, p)
+	}
 }
 
 // LeaveAll clear all sessions in the group
@@ -195,9 +425,22 @@ func (c *Group) LeaveAll() error {
 	}
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
+	members := make([]*session.Session, 0, len(c.sessions))
+	for _, s := range c.sessions {
+		membership.Leave(s, c.name)
+		members = append(members, s)
+	}
 	c.sessions = make(map[int64]*session.Session)
+	c.waitlist = nil
+	c.persist()
+	for uid := range c.uids {
+		c.removeMember(uid)
+	}
+	onLeave, onEmpty := c.onLeave, c.onEmpty
+	c.mu.Unlock()
+
+	c.left(onLeave, onEmpty, members, len(members) > 0)
+	c.forget(members)
 	return nil
 }
 
@@ -223,8 +466,37 @@ func (c *Group) Close() error {
 	}
 
 	atomic.StoreInt32(&c.status, groupStatusClosed)
+	membership.Unregister(c.name, c)
+	if c.coalesce != nil {
+		c.coalesce.stop()
+	}
+
+	// the children become roots, which are not closed with the group
+	hierarchy.Lock()
+	if c.parent != nil {
+		c.detach()
+	}
+	for _, child := range c.children {
+		child.parent = nil
+	}
+	c.children = nil
+	hierarchy.Unlock()
+	if c.store != nil {
+		persistentGroups.Lock()
+		if persistentGroups.groups[c.name] == c {
+			delete(persistentGroups.groups, c.name)
+		}
+		persistentGroups.Unlock()
+	}
 
 	// release all reference
+	c.mu.Lock()
+	for _, s := range c.sessions {
+		membership.Leave(s, c.name)
+	}
 	c.sessions = make(map[int64]*session.Session)
+	c.metas = make(map[int64]MemberMeta)
+	c.waitlist = nil
+	c.mu.Unlock()
 	return nil
 }
@@ -0,0 +1,95 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"github.com/lonng/nano/internal/membership"
+	"github.com/lonng/nano/session"
+)
+
+// MemberHandler represents a callback that will be called after a session
+// joined or left the group
+type MemberHandler func(g *Group, s *session.Session)
+
+func init() {
+	// the closed sessions leave all the groups they joined
+	session.Lifetime.OnClosed(func(s *session.Session) {
+		for _, name := range membership.Forget(s) {
+			if g, ok := membership.Lookup(name).(*Group); ok {
+				g.remove(s, true)
+			}
+		}
+	})
+}
+
+// Name returns the name of group
+func (c *Group) Name() string {
+	return c.name
+}
+
+// OnMemberJoin set the Callback which will be called after a session
+// joined the group, e.g: Add or the member rejoins a persistent group.
+func (c *Group) OnMemberJoin(h MemberHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onJoin = append(c.onJoin, h)
+}
+
+// OnMemberLeave set the Callback which will be called after a session
+// left the group, e.g: Leave, LeaveAll or the session is closed, which
+// can be told by Session.CloseReason, e.g: to reassign the room host.
+func (c *Group) OnMemberLeave(h MemberHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onLeave = append(c.onLeave, h)
+}
+
+// OnEmpty set the Callback which will be called after the last session
+// left the group, e.g: to dissolve the room by Close.
+func (c *Group) OnEmpty(h func(g *Group)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onEmpty = append(c.onEmpty, h)
+}
+
+// joined calls the callbacks of the session joined, the callbacks are called
+// without holding the lock, so they can operate the group
+func (c *Group) joined(onJoin []MemberHandler, s *session.Session) {
+	for _, h := range onJoin {
+		h(c, s)
+	}
+}
+
+// left calls the callbacks of the sessions left, and the empty callbacks if
+// the group becomes empty
+func (c *Group) left(onLeave []MemberHandler, onEmpty []func(g *Group), sessions []*session.Session, empty bool) {
+	for _, s := range sessions {
+		for _, h := range onLeave {
+			h(c, s)
+		}
+	}
+	if !empty {
+		return
+	}
+	for _, h := range onEmpty {
+		h(c)
+	}
+}
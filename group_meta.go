@@ -0,0 +1,125 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package nano
+
+import (
+	"github.com/lonng/nano/session"
+)
+
+// MemberMeta is the small metadata attached to the membership of a session,
+// e.g: the team, role and seat index of a player in the room, which lives as
+// long as the session is a member of the group.
+type MemberMeta map[string]interface{}
+
+// Int returns the value associated with the key as an int, 0 if the value is
+// absent or not an int.
+func (m MemberMeta) Int(key string) int {
+	v, _ := m[key].(int)
+	return v
+}
+
+// String returns the value associated with the key as a string, "" if the value
+// is absent or not a string.
+func (m MemberMeta) String(key string) string {
+	v, _ := m[key].(string)
+	return v
+}
+
+// MemberPredicate represents a predicate of the members used by Query, the meta
+// must not be modified.
+type MemberPredicate func(s *session.Session, meta MemberMeta) bool
+
+// MetaEquals returns a MemberPredicate which matches the members whose metadata
+// value of the key equals to value, e.g: MetaEquals("team", "red").
+func MetaEquals(key string, value interface{}) MemberPredicate {
+	return func(_ *session.Session, meta MemberMeta) bool {
+		v, ok := meta[key]
+		return ok && v == value
+	}
+}
+
+// AddWithMeta adds the session to the group with the metadata, which can be read
+// in the join callbacks.
+func (c *Group) AddWithMeta(s *session.Session, meta MemberMeta) error {
+	return c.add(s, meta)
+}
+
+// SetMeta sets the metadata value of the member, e.g: the seat is changed.
+func (c *Group) SetMeta(s *session.Session, key string, value interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.sessions[s.ID()]; !ok {
+		return ErrMemberNotFound
+	}
+	meta, ok := c.metas[s.ID()]
+	if !ok {
+		meta = MemberMeta{}
+		c.metas[s.ID()] = meta
+	}
+	meta[key] = value
+	return nil
+}
+
+// Meta returns a copy of the metadata of the member, nil if the session is not a
+// member or has no metadata. The metadata is still readable in the leave callbacks.
+func (c *Group) Meta(s *session.Session) MemberMeta {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	meta, ok := c.metas[s.ID()]
+	if !ok {
+		return nil
+	}
+	copied := make(MemberMeta, len(meta))
+	for k, v := range meta {
+		copied[k] = v
+	}
+	return copied
+}
+
+// Query returns the members matched by the predicate, e.g: the players of a team
+// by MetaEquals("team", "red"). The predicate is called with holding the read lock,
+// so it must not operate the group.
+func (c *Group) Query(pred MemberPredicate) []*session.Session {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var members []*session.Session
+	for sid, s := range c.sessions {
+		if pred(s, c.metas[sid]) {
+			members = append(members, s)
+		}
+	}
+	return members
+}
+
+// forget removes the metadata of the sessions left, unless they have joined the
+// group again in the callbacks
+func (c *Group) forget(sessions []*session.Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range sessions {
+		if _, ok := c.sessions[s.ID()]; !ok {
+			delete(c.metas, s.ID())
+		}
+	}
+}
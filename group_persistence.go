@@ -0,0 +1,111 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"strconv"
+
+	"github.com/go-redis/redis"
+	"github.com/lonng/nano/internal/runtime"
+	"github.com/lonng/nano/session"
+)
+
+// GroupPersistenceAdapter saves the membership of groups, so that the
+// membership can survive server restarts. The membership is saved on every
+// Add and Leave, and loaded when the group is created.
+type GroupPersistenceAdapter interface {
+	SaveMembership(groupID string, sessionIDs []int64) error
+	LoadMembership(groupID string) ([]int64, error)
+}
+
+// groupPersistence is the adapter used by all groups
+var groupPersistence GroupPersistenceAdapter = NoopGroupPersistence{}
+
+// findSession returns the connected session of the session id, which is used
+// to reconcile the membership loaded from the persistence adapter
+var findSession = func(sid int64) *session.Session {
+	if runtime.CurrentNode == nil {
+		return nil
+	}
+	return runtime.CurrentNode.FindSession(sid)
+}
+
+// NoopGroupPersistence is the default GroupPersistenceAdapter, which keeps
+// the membership in memory only
+type NoopGroupPersistence struct{}
+
+// SaveMembership implements the GroupPersistenceAdapter interface
+func (NoopGroupPersistence) SaveMembership(string, []int64) error { return nil }
+
+// LoadMembership implements the GroupPersistenceAdapter interface
+func (NoopGroupPersistence) LoadMembership(string) ([]int64, error) { return nil, nil }
+
+// RedisGroupPersistence saves the membership of each group in a Redis sorted
+// set, which is scored by the session id
+type RedisGroupPersistence struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisGroupPersistence returns a GroupPersistenceAdapter backed by Redis,
+// the key of each group is the prefix followed by the group id, the default
+// prefix is "nano:group:"
+func NewRedisGroupPersistence(client redis.Cmdable, prefix string) *RedisGroupPersistence {
+	if prefix == "" {
+		prefix = "nano:group:"
+	}
+	return &RedisGroupPersistence{client: client, prefix: prefix}
+}
+
+// SaveMembership implements the GroupPersistenceAdapter interface
+func (r *RedisGroupPersistence) SaveMembership(groupID string, sessionIDs []int64) error {
+	key := r.prefix + groupID
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(key)
+		if len(sessionIDs) == 0 {
+			return nil
+		}
+		members := make([]redis.Z, 0, len(sessionIDs))
+		for _, sid := range sessionIDs {
+			members = append(members, redis.Z{Score: float64(sid), Member: sid})
+		}
+		pipe.ZAdd(key, members...)
+		return nil
+	})
+	return err
+}
+
+// LoadMembership implements the GroupPersistenceAdapter interface
+func (r *RedisGroupPersistence) LoadMembership(groupID string) ([]int64, error) {
+	members, err := r.client.ZRange(r.prefix+groupID, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	sessionIDs := make([]int64, 0, len(members))
+	for _, m := range members {
+		sid, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sessionIDs = append(sessionIDs, sid)
+	}
+	return sessionIDs, nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package nano
+
+import (
+	"github.com/lonng/nano/session"
+)
+
+// GroupOption represents an option of the group, see NewGroup
+type GroupOption func(g *Group)
+
+// JoinApproval represents a callback which approves the session to join the
+// group, the session is rejected with the error returned, e.g: the password of
+// the room is wrong.
+type JoinApproval func(g *Group, s *session.Session) error
+
+// FullPolicy represents how the sessions joining a full group are treated
+type FullPolicy int
+
+const (
+	// FullReject rejects the sessions joining a full group with ErrGroupFull
+	FullReject FullPolicy = iota
+	// FullWaitlist queues the sessions joining a full group, which are added to
+	// the group in order once there are vacancies, and Add returns ErrWaitlisted
+	FullWaitlist
+)
+
+// waiter is a session waiting for the vacancy of a full group
+type waiter struct {
+	session *session.Session
+	meta    MemberMeta
+}
+
+// WithMaxMembers sets the capacity of the group, 0 means unlimited, the capacity
+// is checked with holding the lock, so the concurrent joins never exceed it.
+func WithMaxMembers(n int) GroupOption {
+	return func(g *Group) {
+		g.maxMembers = n
+	}
+}
+
+// WithJoinApproval sets the callback approving the sessions to join the group, which
+// is called without holding the lock before the capacity is checked, the waitlisted
+// sessions are not approved again when they are added to the group.
+func WithJoinApproval(fn JoinApproval) GroupOption {
+	return func(g *Group) {
+		g.approve = fn
+	}
+}
+
+// WithFullPolicy sets how the sessions joining the full group are treated, the
+// default policy is FullReject.
+func WithFullPolicy(policy FullPolicy) GroupOption {
+	return func(g *Group) {
+		g.fullPolicy = policy
+	}
+}
+
+// SetMaxMembers changes the capacity of the group, 0 means unlimited, the waiting
+// sessions are added to the group if the capacity is raised. The members are not
+// removed if the capacity is lowered below the count of members.
+func (c *Group) SetMaxMembers(n int) {
+	c.mu.Lock()
+	c.maxMembers = n
+	promoted := c.promote()
+	onJoin := c.onJoin
+	c.mu.Unlock()
+
+	for _, s := range promoted {
+		c.joined(onJoin, s)
+	}
+}
+
+// Waitlist returns the sessions waiting for the vacancies of the group in order
+func (c *Group) Waitlist() []*session.Session {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var sessions []*session.Session
+	for _, w := range c.waitlist {
+		if w.session.CloseReason() == "" {
+			sessions = append(sessions, w.session)
+		}
+	}
+	return sessions
+}
+
+// full reports whether the group is full, the caller should hold the lock
+func (c *Group) full() bool {
+	return c.maxMembers > 0 && len(c.sessions) >= c.maxMembers
+}
+
+// wait rejects the session or puts it to the waitlist according to the policy,
+// the caller should hold the lock
+func (c *Group) wait(s *session.Session, meta MemberMeta) error {
+	if c.fullPolicy != FullWaitlist {
+		return ErrGroupFull
+	}
+	for _, w := range c.waitlist {
+		if w.session.ID() == s.ID() {
+			return ErrSessionDuplication
+		}
+	}
+	c.waitlist = append(c.waitlist, waiter{session: s, meta: meta})
+	return ErrWaitlisted
+}
+
+// unwait removes the session from the waitlist, and reports whether it was
+// waiting, the caller should hold the lock
+func (c *Group) unwait(s *session.Session) bool {
+	for i, w := range c.waitlist {
+		if w.session.ID() == s.ID() {
+			c.waitlist = append(c.waitlist[:i], c.waitlist[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// promote adds the waiting sessions to the group until it is full, and returns
+// the sessions added, the closed sessions are dropped. The caller should hold
+// the lock and call the join callbacks for the sessions added.
+func (c *Group) promote() []*session.Session {
+	var promoted []*session.Session
+	for len(c.waitlist) > 0 && !c.full() {
+		w := c.waitlist[0]
+		c.waitlist = c.waitlist[1:]
+		if w.session.CloseReason() != "" {
+			continue
+		}
+		if _, ok := c.sessions[w.session.ID()]; ok {
+			continue
+		}
+		c.join(w.session, w.meta)
+		promoted = append(promoted, w.session)
+	}
+	if len(c.waitlist) == 0 {
+		c.waitlist = nil
+	}
+	return promoted
+}
@@ -0,0 +1,312 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/session"
+)
+
+// GroupStore saves the uids of the members of persistent groups, so that the
+// groups and their membership survive node restarts, e.g: chat channels. Unlike
+// GroupPersistenceAdapter, the members are recorded by uid, which is stable
+// across connections, so the users rejoin the groups once they are bound again.
+type GroupStore interface {
+	// AddMember records uid is a member of the group
+	AddMember(group string, uid int64) error
+	// RemoveMember removes uid from the members of the group
+	RemoveMember(group string, uid int64) error
+	// Members returns the uids of the members of the group
+	Members(group string) ([]int64, error)
+	// Groups returns the names of the groups which have members
+	Groups() ([]string, error)
+}
+
+var persistentGroups = struct {
+	sync.RWMutex
+	hooked bool
+	groups map[string]*Group
+}{groups: map[string]*Group{}}
+
+// NewPersistentGroup returns a group whose membership is saved to the store, the
+// members saved before are loaded, and their live sessions rejoin the group. The
+// sessions of the members joining later, e.g: reconnected after the node restarts,
+// are added to the group once they are bound to the uid. The anonymous sessions
+// are not saved until they are bound.
+//
+// Leave and LeaveAll remove the members from the store, while Close only releases
+// the group on current node, so the group can be restored by the next process.
+func NewPersistentGroup(name string, store GroupStore, opts ...GroupOption) *Group {
+	g := NewGroup(name, opts...)
+	g.store = store
+	g.uids = map[int64]bool{}
+
+	uids, err := store.Members(name)
+	if err != nil {
+		log.Println(fmt.Sprintf("Load members of group %s failed: %v", name, err))
+	}
+	for _, uid := range uids {
+		g.uids[uid] = true
+	}
+
+	persistentGroups.Lock()
+	if !persistentGroups.hooked {
+		persistentGroups.hooked = true
+		session.Lifetime.OnBind(rejoinGroups)
+	}
+	persistentGroups.groups[name] = g
+	persistentGroups.Unlock()
+
+	if len(uids) > 0 {
+		var online []*session.Session
+		RangeSessions(func(s *session.Session) bool {
+			if g.uids[s.UID()] {
+				online = append(online, s)
+			}
+			return true
+		})
+		for _, s := range online {
+			g.rejoin(s)
+		}
+	}
+	return g
+}
+
+// RestoreGroups creates the persistent groups saved in the store, which is called
+// on boot to rehydrate the groups before the clients reconnect.
+func RestoreGroups(store GroupStore) ([]*Group, error) {
+	names, err := store.Groups()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]*Group, 0, len(names))
+	for _, name := range names {
+		groups = append(groups, NewPersistentGroup(name, store))
+	}
+	return groups, nil
+}
+
+// rejoinGroups adds the session bound to uid to the persistent groups which
+// the uid is a member of, and saves the membership of the anonymous session
+// joined the groups before binding
+func rejoinGroups(s *session.Session, _ int64) {
+	persistentGroups.RLock()
+	groups := make([]*Group, 0, len(persistentGroups.groups))
+	for _, g := range persistentGroups.groups {
+		groups = append(groups, g)
+	}
+	persistentGroups.RUnlock()
+
+	for _, g := range groups {
+		g.rejoin(s)
+	}
+}
+
+// rejoin adds the session to the group if its uid is a member, or records its
+// uid if the session has joined the group
+func (c *Group) rejoin(s *session.Session) {
+	uid := s.UID()
+	if uid == 0 || c.isClosed() {
+		return
+	}
+
+	c.mu.Lock()
+	if _, ok := c.sessions[s.ID()]; ok {
+		c.addMember(uid)
+		c.mu.Unlock()
+		return
+	}
+	if !c.uids[uid] {
+		c.mu.Unlock()
+		return
+	}
+	c.join(s, nil)
+	onJoin := c.onJoin
+	c.mu.Unlock()
+
+	c.joined(onJoin, s)
+}
+
+// addMember saves uid to the store of the persistent group, the caller should
+// hold the lock
+func (c *Group) addMember(uid int64) {
+	if c.store == nil || uid == 0 || c.uids[uid] {
+		return
+	}
+	c.uids[uid] = true
+	if err := c.store.AddMember(c.name, uid); err != nil {
+		log.Println(fmt.Sprintf("Save member %d of group %s failed: %v", uid, c.name, err))
+	}
+}
+
+// removeMember removes uid from the store of the persistent group if no session
+// of uid is left in the group, the caller should hold the lock
+func (c *Group) removeMember(uid int64) {
+	if c.store == nil || !c.uids[uid] {
+		return
+	}
+	for _, s := range c.sessions {
+		if s.UID() == uid {
+			return
+		}
+	}
+	delete(c.uids, uid)
+	if err := c.store.RemoveMember(c.name, uid); err != nil {
+		log.Println(fmt.Sprintf("Remove member %d of group %s failed: %v", uid, c.name, err))
+	}
+}
+
+// MemoryGroupStore is a GroupStore which keeps the membership in memory, which
+// is used by the single process deployments and tests
+type MemoryGroupStore struct {
+	mu     sync.RWMutex
+	groups map[string]map[int64]bool
+}
+
+// NewMemoryGroupStore returns an empty MemoryGroupStore
+func NewMemoryGroupStore() *MemoryGroupStore {
+	return &MemoryGroupStore{groups: map[string]map[int64]bool{}}
+}
+
+// AddMember implements the GroupStore interface
+func (m *MemoryGroupStore) AddMember(group string, uid int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members, ok := m.groups[group]
+	if !ok {
+		members = map[int64]bool{}
+		m.groups[group] = members
+	}
+	members[uid] = true
+	return nil
+}
+
+// RemoveMember implements the GroupStore interface
+func (m *MemoryGroupStore) RemoveMember(group string, uid int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.groups[group], uid)
+	if len(m.groups[group]) == 0 {
+		delete(m.groups, group)
+	}
+	return nil
+}
+
+// Members implements the GroupStore interface
+func (m *MemoryGroupStore) Members(group string) ([]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	uids := make([]int64, 0, len(m.groups[group]))
+	for uid := range m.groups[group] {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids, nil
+}
+
+// Groups implements the GroupStore interface
+func (m *MemoryGroupStore) Groups() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.groups))
+	for name := range m.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RedisGroupStore is a GroupStore backed by Redis, the uids of each group are
+// saved in the set <prefix>members:<group>, and the names of the groups having
+// members are saved in the set <prefix>names.
+type RedisGroupStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisGroupStore returns a GroupStore backed by the redis client, the default
+// prefix of keys is "nano:groups:"
+func NewRedisGroupStore(client redis.Cmdable, prefix string) *RedisGroupStore {
+	if prefix == "" {
+		prefix = "nano:groups:"
+	}
+	return &RedisGroupStore{client: client, prefix: prefix}
+}
+
+func (r *RedisGroupStore) membersKey(group string) string {
+	return r.prefix + "members:" + group
+}
+
+func (r *RedisGroupStore) namesKey() string {
+	return r.prefix + "names"
+}
+
+// AddMember implements the GroupStore interface
+func (r *RedisGroupStore) AddMember(group string, uid int64) error {
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(r.membersKey(group), uid)
+		pipe.SAdd(r.namesKey(), group)
+		return nil
+	})
+	return err
+}
+
+// RemoveMember implements the GroupStore interface, the group is removed from
+// the names once its last member is removed
+func (r *RedisGroupStore) RemoveMember(group string, uid int64) error {
+	key := r.membersKey(group)
+	if err := r.client.SRem(key, uid).Err(); err != nil {
+		return err
+	}
+	n, err := r.client.SCard(key).Result()
+	if err != nil || n > 0 {
+		return err
+	}
+	return r.client.SRem(r.namesKey(), group).Err()
+}
+
+// Members implements the GroupStore interface
+func (r *RedisGroupStore) Members(group string) ([]int64, error) {
+	members, err := r.client.SMembers(r.membersKey(group)).Result()
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]int64, 0, len(members))
+	for _, m := range members {
+		uid, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
+// Groups implements the GroupStore interface
+func (r *RedisGroupStore) Groups() ([]string, error) {
+	return r.client.SMembers(r.namesKey()).Result()
+}
@@ -2,8 +2,16 @@ package nano
 
 import (
 	"math/rand"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/clock/clocktest"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/membership"
+	"github.com/lonng/nano/mock"
+	"github.com/lonng/nano/scheduler"
 	"github.com/lonng/nano/session"
 )
 
@@ -40,3 +48,474 @@ func TestChannel_Add(t *testing.T) {
 		t.Fail()
 	}
 }
+
+type memoryGroupPersistence struct {
+	groups map[string][]int64
+}
+
+func (m *memoryGroupPersistence) SaveMembership(groupID string, sessionIDs []int64) error {
+	m.groups[groupID] = sessionIDs
+	return nil
+}
+
+func (m *memoryGroupPersistence) LoadMembership(groupID string) ([]int64, error) {
+	return m.groups[groupID], nil
+}
+
+func TestGroup_Persistence(t *testing.T) {
+	connected := session.New(nil)
+	adapter := &memoryGroupPersistence{groups: map[string][]int64{
+		"test_persistence": {connected.ID(), connected.ID() + 1000},
+	}}
+
+	defer func(p GroupPersistenceAdapter, find func(int64) *session.Session) {
+		groupPersistence, findSession = p, find
+	}(groupPersistence, findSession)
+	groupPersistence = adapter
+	findSession = func(sid int64) *session.Session {
+		if sid == connected.ID() {
+			return connected
+		}
+		return nil
+	}
+
+	// the disconnected session should be removed from the membership
+	g := NewGroup("test_persistence")
+	if g.Count() != 1 {
+		t.Fatalf("expect: 1, got: %d", g.Count())
+	}
+	if sids := adapter.groups["test_persistence"]; len(sids) != 1 || sids[0] != connected.ID() {
+		t.Fatalf("expect reconciled membership to be saved, got: %v", sids)
+	}
+
+	s := session.New(nil)
+	g.Add(s)
+	if len(adapter.groups["test_persistence"]) != 2 {
+		t.Fatalf("expect: 2, got: %v", adapter.groups["test_persistence"])
+	}
+	g.Leave(connected)
+	if sids := adapter.groups["test_persistence"]; len(sids) != 1 || sids[0] != s.ID() {
+		t.Fatalf("expect: [%d], got: %v", s.ID(), sids)
+	}
+}
+
+func TestGroup_Sizes(t *testing.T) {
+	g := NewGroup("test_sizes")
+	defer g.Close()
+	for i := 0; i < 3; i++ {
+		g.Add(session.New(nil))
+	}
+
+	found := false
+	for _, size := range membership.GroupSizes() {
+		if size == 3 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expect the members of group counted, got: %v", membership.GroupSizes())
+	}
+
+	g.Close()
+	for _, size := range membership.GroupSizes() {
+		if size == 3 {
+			t.Fatal("expect the closed group not counted")
+		}
+	}
+}
+
+func TestGroup_PersistentGroup(t *testing.T) {
+	store := NewMemoryGroupStore()
+	g := NewPersistentGroup("test_persistent", store)
+
+	s := session.New(nil)
+	if err := g.Add(s); err != nil {
+		t.Fatal(err)
+	}
+	// the anonymous session is saved once it is bound
+	if uids, _ := store.Members("test_persistent"); len(uids) != 0 {
+		t.Fatalf("expect the anonymous session not saved, got: %v", uids)
+	}
+	if err := s.Bind(8001); err != nil {
+		t.Fatal(err)
+	}
+	other := session.New(nil)
+	other.Bind(8002)
+	g.Add(other)
+	if uids, _ := store.Members("test_persistent"); len(uids) != 2 {
+		t.Fatalf("expect 2 members saved, got: %v", uids)
+	}
+	g.Leave(other)
+	if uids, _ := store.Members("test_persistent"); len(uids) != 1 || uids[0] != 8001 {
+		t.Fatalf("expect: [8001], got: %v", uids)
+	}
+
+	// the group is restored after the node restarts, and the member rejoins
+	// once it is bound again
+	g.Close()
+	session.Lifetime.Close(s)
+	session.Lifetime.Close(other)
+	groups, err := RestoreGroups(store)
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("expect 1 group restored, got: %v (%v)", groups, err)
+	}
+	restored := groups[0]
+	defer restored.Close()
+	if restored.Count() != 0 {
+		t.Fatalf("expect no session, got: %d", restored.Count())
+	}
+	reconnected := session.New(nil)
+	if err := reconnected.Bind(8001); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := restored.Member(8001); err != nil || m != reconnected {
+		t.Fatalf("expect the member rejoined, got: %v (%v)", m, err)
+	}
+
+	restored.LeaveAll()
+	if names, _ := store.Groups(); len(names) != 0 {
+		t.Fatalf("expect no group saved, got: %v", names)
+	}
+}
+
+func TestGroup_MemberEvents(t *testing.T) {
+	g := NewGroup("test_member_events")
+	defer g.Close()
+
+	var joined, left []int64
+	var empty int
+	g.OnMemberJoin(func(_ *Group, s *session.Session) { joined = append(joined, s.ID()) })
+	g.OnMemberLeave(func(_ *Group, s *session.Session) { left = append(left, s.ID()) })
+	g.OnEmpty(func(*Group) { empty++ })
+
+	host, guest := session.New(nil), session.New(nil)
+	g.Add(host)
+	g.Add(guest)
+	if len(joined) != 2 {
+		t.Fatalf("expect 2 joined, got: %v", joined)
+	}
+
+	// the non-member leaving is ignored
+	g.Leave(session.New(nil))
+	g.Leave(host)
+	if len(left) != 1 || left[0] != host.ID() || empty != 0 {
+		t.Fatalf("unexpected left: %v, empty: %d", left, empty)
+	}
+
+	// the closed session is removed automatically
+	session.Lifetime.CloseWithReason(guest, session.CloseReasonDisconnected)
+	if g.Count() != 0 || len(left) != 2 || left[1] != guest.ID() {
+		t.Fatalf("expect the closed session removed, count: %d, left: %v", g.Count(), left)
+	}
+	if empty != 1 {
+		t.Fatalf("expect 1 empty callback, got: %d", empty)
+	}
+}
+
+// pushRecorder records the payloads pushed to the session
+type pushRecorder struct {
+	mock.NetworkEntity
+	payloads [][]byte
+}
+
+func (r *pushRecorder) Push(_ string, v interface{}) error {
+	r.payloads = append(r.payloads, v.([]byte))
+	return nil
+}
+
+func TestGroup_BroadcastTransform(t *testing.T) {
+	g := NewGroup("test_broadcast_transform")
+	defer g.Close()
+
+	entities := []*pushRecorder{{}, {}, {}}
+	var members []*session.Session
+	for _, e := range entities {
+		s := session.New(e)
+		g.Add(s)
+		members = append(members, s)
+	}
+	owner := members[0]
+
+	err := g.BroadcastTransform("room.state", []byte("state"), func(s *session.Session, common []byte) []byte {
+		if s == owner {
+			return append(common, "+private"...)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range entities {
+		expect := "state"
+		if i == 0 {
+			expect = "state+private"
+		}
+		if len(e.payloads) != 1 || string(e.payloads[0]) != expect {
+			t.Fatalf("expect member %d received %s, got: %q", i, expect, e.payloads)
+		}
+	}
+
+	err = g.BroadcastFilter("room.team", []byte("team"), func(s *session.Session) bool { return s != owner })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities[0].payloads) != 1 || len(entities[1].payloads) != 2 || len(entities[2].payloads) != 2 {
+		t.Fatal("expect the filtered member not pushed")
+	}
+}
+
+func TestGroup_MemberMeta(t *testing.T) {
+	g := NewGroup("test_member_meta")
+	defer g.Close()
+
+	red1, red2, blue := session.New(nil), session.New(nil), session.New(nil)
+	g.AddWithMeta(red1, MemberMeta{"team": "red", "seat": 1})
+	g.AddWithMeta(red2, MemberMeta{"team": "red", "seat": 2})
+	g.AddWithMeta(blue, MemberMeta{"team": "blue", "seat": 3})
+
+	if reds := g.Query(MetaEquals("team", "red")); len(reds) != 2 {
+		t.Fatalf("expect 2 members of red team, got: %d", len(reds))
+	}
+	if err := g.SetMeta(blue, "team", "red"); err != nil {
+		t.Fatal(err)
+	}
+	if reds := g.Query(MetaEquals("team", "red")); len(reds) != 3 {
+		t.Fatalf("expect 3 members of red team, got: %d", len(reds))
+	}
+
+	var seat int
+	g.OnMemberLeave(func(g *Group, s *session.Session) {
+		seat = g.Meta(s).Int("seat")
+	})
+	g.Leave(red2)
+	if seat != 2 {
+		t.Fatalf("expect the seat of the left member is 2, got: %d", seat)
+	}
+	if g.Meta(red2) != nil {
+		t.Fatal("expect the metadata removed after the member left")
+	}
+	if err := g.SetMeta(red2, "seat", 4); err != ErrMemberNotFound {
+		t.Fatalf("expect ErrMemberNotFound, got: %v", err)
+	}
+}
+
+func TestGroup_Capacity(t *testing.T) {
+	g := NewGroup("test_capacity", WithMaxMembers(10))
+	defer g.Close()
+
+	var paraCount = 100
+	w := make(chan error, paraCount)
+	for i := 0; i < paraCount; i++ {
+		go func() {
+			w <- g.Add(session.New(nil))
+		}()
+	}
+	var full int
+	for i := 0; i < paraCount; i++ {
+		if err := <-w; err == ErrGroupFull {
+			full++
+		}
+	}
+	if g.Count() != 10 || full != paraCount-10 {
+		t.Fatalf("expect 10 members and %d rejected, got: %d, %d", paraCount-10, g.Count(), full)
+	}
+}
+
+func TestGroup_Waitlist(t *testing.T) {
+	banned := session.New(nil)
+	g := NewGroup("test_waitlist", WithMaxMembers(1), WithFullPolicy(FullWaitlist),
+		WithJoinApproval(func(g *Group, s *session.Session) error {
+			if s == banned {
+				return ErrMemberNotFound
+			}
+			return nil
+		}))
+	defer g.Close()
+
+	if err := g.Add(banned); err != ErrMemberNotFound {
+		t.Fatalf("expect the session rejected by approval, got: %v", err)
+	}
+
+	host, first, second := session.New(nil), session.New(nil), session.New(nil)
+	if err := g.Add(host); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddWithMeta(first, MemberMeta{"seat": 1}); err != ErrWaitlisted {
+		t.Fatalf("expect ErrWaitlisted, got: %v", err)
+	}
+	if err := g.Add(second); err != ErrWaitlisted {
+		t.Fatalf("expect ErrWaitlisted, got: %v", err)
+	}
+
+	var joined []*session.Session
+	g.OnMemberJoin(func(g *Group, s *session.Session) {
+		joined = append(joined, s)
+	})
+	g.Leave(host)
+	if len(joined) != 1 || joined[0] != first || g.Meta(first).Int("seat") != 1 {
+		t.Fatal("expect the first waiting session joined with its metadata")
+	}
+	if list := g.Waitlist(); len(list) != 1 || list[0] != second {
+		t.Fatalf("expect the second session is waiting, got: %v", list)
+	}
+
+	g.SetMaxMembers(2)
+	if g.Count() != 2 || len(g.Waitlist()) != 0 {
+		t.Fatal("expect the waiting session joined after the capacity raised")
+	}
+}
+
+func TestGroup_Coalescing(t *testing.T) {
+	fake := clocktest.NewFake(time.Now())
+	defer func(c clock.Clock) { env.Clock = c }(env.Clock)
+	env.Clock = fake
+
+	g := NewGroup("test_coalescing", WithCoalescing(100*time.Millisecond, func(route string, prev, v interface{}) interface{} {
+		if route == "room.delta" {
+			return append(prev.([]byte), v.([]byte)...)
+		}
+		return v
+	}))
+	defer g.Close()
+
+	entity := &pushRecorder{}
+	g.Add(session.New(entity))
+
+	for _, frame := range []string{"1", "2", "3"} {
+		g.Broadcast("room.state", []byte("state"+frame))
+		g.Broadcast("room.delta", []byte(frame))
+	}
+	if len(entity.payloads) != 0 {
+		t.Fatal("expect the updates are coalesced within the window")
+	}
+
+	fake.Advance(100 * time.Millisecond)
+	if len(entity.payloads) != 2 || string(entity.payloads[0]) != "state3" || string(entity.payloads[1]) != "123" {
+		t.Fatalf("expect one push per route, got: %q", entity.payloads)
+	}
+
+	g.Broadcast("room.state", []byte("state4"))
+	g.Flush()
+	if len(entity.payloads) != 3 || string(entity.payloads[2]) != "state4" {
+		t.Fatalf("expect the update flushed, got: %q", entity.payloads)
+	}
+}
+
+func TestGroup_BroadcastEvery(t *testing.T) {
+	fake := clocktest.NewFake(time.Now())
+	defer func(c clock.Clock) { env.Clock = c }(env.Clock)
+	env.Clock = fake
+
+	go scheduler.Sched()
+	defer scheduler.Close()
+
+	g := NewGroup("test_broadcast_every")
+	ticks := make(chan int, 10)
+	var n int
+	g.BroadcastEvery(time.Second, func(g *Group) (string, interface{}) {
+		n++
+		ticks <- n
+		return "room.tick", []byte("tick")
+	})
+
+	// wait until the ticker of scheduler is created
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i <= 2; i++ {
+		fake.Advance(time.Second)
+		select {
+		case tick := <-ticks:
+			if tick != i {
+				t.Fatalf("expect tick %d, got: %d", i, tick)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expect the message broadcast every second")
+		}
+	}
+
+	g.Close()
+	fake.Advance(time.Second)
+	fake.Advance(time.Second)
+	select {
+	case <-ticks:
+		t.Fatal("expect the timer stopped after the group closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestGroup_Hierarchy(t *testing.T) {
+	world := NewGroup("test.world")
+	zone := NewGroup("test.zone.3")
+	room := NewGroup("test.zone.3.room.42")
+	other := NewGroup("test.zone.4.room.42")
+	for _, g := range []*Group{world, zone, room, other} {
+		defer g.Close()
+	}
+
+	if err := world.AddChild(zone); err != nil {
+		t.Fatal(err)
+	}
+	if err := zone.AddChild(room); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.AddChild(world); err != ErrGroupCycle {
+		t.Fatalf("expect ErrGroupCycle, got: %v", err)
+	}
+	if err := other.AddChild(room); err != ErrGroupHasParent {
+		t.Fatalf("expect ErrGroupHasParent, got: %v", err)
+	}
+
+	zoneMember, roomMember, otherMember := &pushRecorder{}, &pushRecorder{}, &pushRecorder{}
+	both := session.New(zoneMember)
+	zone.Add(both)
+	room.Add(both)
+	room.Add(session.New(roomMember))
+	other.Add(session.New(otherMember))
+
+	if err := world.BroadcastTree("world.notice", []byte("notice")); err != nil {
+		t.Fatal(err)
+	}
+	if len(zoneMember.payloads) != 1 || len(roomMember.payloads) != 1 || len(otherMember.payloads) != 0 {
+		t.Fatal("expect the members of descendants received the message once")
+	}
+
+	if err := PushChannel("test.zone.*.room.42", "room.notice", []byte("notice")); err != nil {
+		t.Fatal(err)
+	}
+	if len(zoneMember.payloads) != 2 || len(roomMember.payloads) != 2 || len(otherMember.payloads) != 1 {
+		t.Fatal("expect the members of matched groups received the message")
+	}
+
+	if err := PushChannel("test.zone.4.**", "zone.notice", []byte("notice")); err != nil {
+		t.Fatal(err)
+	}
+	if len(roomMember.payloads) != 2 || len(otherMember.payloads) != 2 {
+		t.Fatal("expect the members of groups under zone 4 received the message")
+	}
+
+	zone.Close()
+	if len(world.Children()) != 0 || room.Parent() != nil {
+		t.Fatal("expect the closed group detached from the tree")
+	}
+}
+
+func TestMatchChannel(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"zone.*.room.42", "zone.3.room.42", true},
+		{"zone.*.room.42", "zone.3.room.43", false},
+		{"zone.*", "zone.3.room.42", false},
+		{"zone.**", "zone", true},
+		{"zone.**.42", "zone.3.room.42", true},
+		{"**", "world", true},
+		{"world", "world.zone", false},
+	}
+	for _, c := range cases {
+		if got := matchChannel(strings.Split(c.pattern, "."), strings.Split(c.name, ".")); got != c.match {
+			t.Fatalf("expect match(%s, %s) = %v, got: %v", c.pattern, c.name, c.match, got)
+		}
+	}
+}
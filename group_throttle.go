@@ -0,0 +1,169 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package nano
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/scheduler"
+)
+
+// BroadcastFunc returns the message broadcast to the group on each tick of
+// BroadcastEvery, the tick is skipped if v is nil, e.g: nothing changed.
+type BroadcastFunc func(g *Group) (route string, v interface{})
+
+// CoalesceFunc merges the update v into the pending update prev of the same
+// route within the coalescing window, e.g: to accumulate the deltas of the
+// room state, see WithCoalescing.
+type CoalesceFunc func(route string, prev, v interface{}) interface{}
+
+// coalescer holds the updates broadcast within the coalescing window
+type coalescer struct {
+	mu      sync.Mutex
+	window  time.Duration
+	merge   CoalesceFunc
+	routes  []string               // routes in order of their first updates
+	pending map[string]interface{} // route map to pending update
+	timer   clock.Timer            // flushes the pending updates, nil if none
+}
+
+// WithCoalescing makes Broadcast coalesce the updates within the window, e.g: to
+// avoid broadcasting the state of a fast-paced room per frame. The updates of
+// each route are merged by merge, or the latest one wins if merge is nil, and the
+// result is pushed once per member at the end of the window, in order of the first
+// update of each route.
+//
+// Broadcast returns nil once the update is queued, the errors of serializing and
+// pushing are logged when the window is flushed. Multicast, BroadcastFilter and
+// BroadcastTransform are not coalesced.
+func WithCoalescing(window time.Duration, merge CoalesceFunc) GroupOption {
+	return func(g *Group) {
+		g.coalesce = &coalescer{
+			window:  window,
+			merge:   merge,
+			pending: map[string]interface{}{},
+		}
+	}
+}
+
+// BroadcastEvery broadcasts the message returned by fn every interval, fn is called
+// in the scheduler goroutine like the timers of scheduler, so the state of the room
+// can be read without locks. The message is pushed at once even if the group is
+// coalescing. The timer is stopped once the group is closed, or by Timer.Stop.
+func (c *Group) BroadcastEvery(interval time.Duration, fn BroadcastFunc) *scheduler.Timer {
+	var t *scheduler.Timer
+	t = scheduler.NewTimer(interval, func() {
+		if c.isClosed() {
+			t.Stop()
+			return
+		}
+		route, v := fn(c)
+		if v == nil {
+			return
+		}
+		data, err := message.Serialize(v)
+		if err != nil {
+			log.Println(fmt.Sprintf("Serialize broadcast of group %s failed, Route=%s, Error=%s", c.name, route, err.Error()))
+			return
+		}
+		c.broadcast(route, data, nil, nil)
+	})
+	return t
+}
+
+// Flush pushes the updates coalesced within current window at once, and returns
+// the last error, it does nothing if the group is not coalescing.
+func (c *Group) Flush() error {
+	co := c.coalesce
+	if co == nil {
+		return nil
+	}
+
+	co.mu.Lock()
+	if co.timer != nil {
+		co.timer.Stop()
+		co.timer = nil
+	}
+	routes, pending := co.routes, co.pending
+	co.routes, co.pending = nil, map[string]interface{}{}
+	co.mu.Unlock()
+
+	if c.isClosed() {
+		return ErrClosedGroup
+	}
+
+	var err error
+	for _, route := range routes {
+		v := pending[route]
+		if env.Debug {
+			log.Println(fmt.Sprintf("Broadcast coalesced %s, Data=%+v", route, v))
+		}
+
+		data, e := message.Serialize(v)
+		if e != nil {
+			err = e
+			log.Println(fmt.Sprintf("Serialize broadcast of group %s failed, Route=%s, Error=%s", c.name, route, e.Error()))
+			continue
+		}
+		if e := c.broadcast(route, data, nil, nil); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// queue adds the update to current window, and starts the window if it is the
+// first update
+func (co *coalescer) queue(c *Group, route string, v interface{}) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	prev, ok := co.pending[route]
+	if !ok {
+		co.routes = append(co.routes, route)
+	} else if co.merge != nil {
+		v = co.merge(route, prev, v)
+	}
+	co.pending[route] = v
+
+	if co.timer == nil {
+		co.timer = env.Clock.AfterFunc(co.window, func() {
+			c.Flush()
+		})
+	}
+}
+
+// stop drops the pending updates, which is called once the group is closed
+func (co *coalescer) stop() {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	if co.timer != nil {
+		co.timer.Stop()
+		co.timer = nil
+	}
+	co.routes, co.pending = nil, map[string]interface{}{}
+}
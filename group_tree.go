@@ -0,0 +1,211 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package nano
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/internal/log"
+	"github.com/lonng/nano/internal/membership"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/session"
+)
+
+// hierarchy guards the parents and children of all groups, so the relationships
+// can be changed without holding the locks of the groups
+var hierarchy sync.RWMutex
+
+// AddChild makes child a child of the group, e.g: world -> zone -> room, so the
+// members of child receive the messages sent by BroadcastTree of its ancestors.
+// A group has at most one parent, and cannot be a descendant of itself.
+func (c *Group) AddChild(child *Group) error {
+	if c.isClosed() || child.isClosed() {
+		return ErrClosedGroup
+	}
+
+	hierarchy.Lock()
+	defer hierarchy.Unlock()
+
+	if child.parent == c {
+		return nil
+	}
+	if child.parent != nil {
+		return ErrGroupHasParent
+	}
+	for g := c; g != nil; g = g.parent {
+		if g == child {
+			return ErrGroupCycle
+		}
+	}
+	child.parent = c
+	c.children = append(c.children, child)
+	return nil
+}
+
+// RemoveChild removes child from the children of the group
+func (c *Group) RemoveChild(child *Group) {
+	hierarchy.Lock()
+	defer hierarchy.Unlock()
+
+	if child.parent == c {
+		child.detach()
+	}
+}
+
+// Parent returns the parent of the group, nil if it is a root
+func (c *Group) Parent() *Group {
+	hierarchy.RLock()
+	defer hierarchy.RUnlock()
+	return c.parent
+}
+
+// Children returns the children of the group
+func (c *Group) Children() []*Group {
+	hierarchy.RLock()
+	defer hierarchy.RUnlock()
+	return append([]*Group(nil), c.children...)
+}
+
+// BroadcastTree pushes the message to the members of the group and all of its
+// descendants, e.g: the announcements of a zone, the sessions joined several
+// groups of the tree receive the message once.
+func (c *Group) BroadcastTree(route string, v interface{}) error {
+	if c.isClosed() {
+		return ErrClosedGroup
+	}
+
+	data, err := message.Serialize(v)
+	if err != nil {
+		return err
+	}
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("BroadcastTree %s, Group=%s, Data=%+v", route, c.name, v))
+	}
+
+	hierarchy.RLock()
+	groups := c.descendants(nil)
+	hierarchy.RUnlock()
+
+	return pushAll(route, data, collectMembers(groups), nil)
+}
+
+// PushChannel pushes the message to the members of the groups whose names match
+// the pattern and their descendants, e.g: "zone.*.room.42". The names and patterns
+// are separated by dots, "*" matches exactly one segment, and "**" matches zero or
+// more segments, e.g: "zone.3.**" matches "zone.3" and "zone.3.room.42". The sessions
+// joined several matched groups receive the message once.
+func PushChannel(pattern, route string, v interface{}) error {
+	data, err := message.Serialize(v)
+	if err != nil {
+		return err
+	}
+
+	if env.Debug {
+		log.Println(fmt.Sprintf("PushChannel %s, Pattern=%s, Data=%+v", route, pattern, v))
+	}
+
+	segments := strings.Split(pattern, ".")
+	var matched []*Group
+	membership.Range(func(name string, j membership.Joiner) bool {
+		if g, ok := j.(*Group); ok && matchChannel(segments, strings.Split(name, ".")) {
+			matched = append(matched, g)
+		}
+		return true
+	})
+	if len(matched) == 0 {
+		return nil
+	}
+
+	hierarchy.RLock()
+	var groups []*Group
+	for _, g := range matched {
+		groups = g.descendants(groups)
+	}
+	hierarchy.RUnlock()
+
+	return pushAll(route, data, collectMembers(groups), nil)
+}
+
+// descendants appends the group and its descendants to groups, the caller should
+// hold the lock of hierarchy
+func (c *Group) descendants(groups []*Group) []*Group {
+	groups = append(groups, c)
+	for _, child := range c.children {
+		groups = child.descendants(groups)
+	}
+	return groups
+}
+
+// detach removes the group from the children of its parent, the caller should
+// hold the lock of hierarchy
+func (c *Group) detach() {
+	siblings := c.parent.children
+	for i, g := range siblings {
+		if g == c {
+			c.parent.children = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	c.parent = nil
+}
+
+// collectMembers returns the members of the open groups, the sessions joined
+// several groups are returned once
+func collectMembers(groups []*Group) []*session.Session {
+	seen := map[int64]bool{}
+	var members []*session.Session
+	for _, g := range groups {
+		if g.isClosed() {
+			continue
+		}
+		g.mu.RLock()
+		for sid, s := range g.sessions {
+			if !seen[sid] {
+				seen[sid] = true
+				members = append(members, s)
+			}
+		}
+		g.mu.RUnlock()
+	}
+	return members
+}
+
+// matchChannel reports whether the segments of the name match the pattern
+func matchChannel(pattern, name []string) bool {
+	for i, p := range pattern {
+		if p == "**" {
+			rest := pattern[i+1:]
+			for j := i; j <= len(name); j++ {
+				if matchChannel(rest, name[j:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if i >= len(name) || (p != "*" && p != name[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(name)
+}
@@ -21,6 +21,7 @@
 package nano
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -72,7 +73,9 @@ func Listen(addr string, opts ...Option) {
 	}
 
 	opt := cluster.Options{
-		Components: &component.Components{},
+		Components:      &component.Components{},
+		ReadBufferSize:  cluster.DefaultReadBufferSize,
+		WriteBufferSize: cluster.DefaultWriteBufferSize,
 	}
 	for _, option := range opts {
 		option(&opt)
@@ -99,6 +102,10 @@ func Listen(addr string, opts ...Option) {
 	}
 	runtime.CurrentNode = node
 
+	// flush the last window of metrics before crashing, the goroutines started
+	// by the node flush the metrics as well
+	defer cluster.FlushOnPanic(node)
+
 	if node.ClientAddr != "" {
 		log.Println(fmt.Sprintf("Startup *Nano gate server* %s, client address: %v, service address: %s",
 			app.name, node.ClientAddr, node.ServiceAddr))
@@ -107,9 +114,13 @@ func Listen(addr string, opts ...Option) {
 			app.name, node.ServiceAddr))
 	}
 
-	go scheduler.Sched()
+	go func() {
+		defer cluster.FlushOnPanic(node)
+		scheduler.Sched()
+	}()
 	sg := make(chan os.Signal)
 	signal.Notify(sg, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM)
+	defer signal.Stop(sg)
 
 	select {
 	case <-env.Die:
@@ -123,6 +134,8 @@ func Listen(addr string, opts ...Option) {
 	node.Shutdown()
 	runtime.CurrentNode = nil
 	scheduler.Close()
+	// the application can be listened again after shutdown, e.g: in tests
+	env.Die = make(chan bool)
 	atomic.StoreInt32(&running, 0)
 }
 
@@ -130,3 +143,33 @@ func Listen(addr string, opts ...Option) {
 func Shutdown() {
 	close(env.Die)
 }
+
+// Components returns the components registered to current node with their handler
+// routes and in-flight invocations, which is also exposed by the admin server at
+// GET /components, see WithAdminAddr.
+func Components() []cluster.ComponentInfo {
+	if runtime.CurrentNode == nil {
+		return nil
+	}
+	return runtime.CurrentNode.ComponentInfos()
+}
+
+// ResumeComponent resumes the component suspended for exceeding its quota, which
+// is also exposed by the admin server at POST /components/resume?name=<component>,
+// see component.WithQuota.
+func ResumeComponent(name string) error {
+	if runtime.CurrentNode == nil {
+		return cluster.ErrComponentNotFound
+	}
+	return runtime.CurrentNode.ResumeComponent(name)
+}
+
+// WaitForIdle blocks until the dispatch queue is empty and all in-flight handlers
+// have completed, which is used to wait for the messages sent to be processed,
+// e.g: in integration tests. The ctx.Err() will be returned if ctx is done first.
+func WaitForIdle(ctx context.Context) error {
+	if runtime.CurrentNode == nil {
+		return nil
+	}
+	return runtime.CurrentNode.WaitForIdle(ctx)
+}
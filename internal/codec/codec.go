@@ -54,7 +54,7 @@ func NewDecoder() *Decoder {
 func (c *Decoder) forward() error {
 	header := c.buf.Next(HeadLength)
 	c.typ = header[0]
-	if c.typ < packet.Handshake || c.typ > packet.Kick {
+	if c.typ < packet.Handshake || c.typ > packet.Redirect {
 		return packet.ErrWrongPacketType
 	}
 	c.size = bytesToInt(header[1:])
@@ -107,6 +107,12 @@ func (c *Decoder) Decode(data []byte) ([]*packet.Packet, error) {
 	return packets, nil
 }
 
+// Buffered returns the number of bytes of the incomplete packet, which are
+// buffered until the rest of the packet arrives
+func (c *Decoder) Buffered() int {
+	return c.buf.Len()
+}
+
 // Encode create a packet.Packet from  the raw bytes slice and then encode to network bytes slice
 // Protocol refs: https://github.com/NetEase/pomelo/wiki/Communication-Protocol
 //
@@ -114,7 +120,7 @@ func (c *Decoder) Decode(data []byte) ([]*packet.Packet, error) {
 // --------|------------------------|--------
 // 1 byte packet type, 3 bytes packet data length(big end), and data segment
 func Encode(typ packet.Type, data []byte) ([]byte, error) {
-	if typ < packet.Handshake || typ > packet.Kick {
+	if typ < packet.Handshake || typ > packet.Redirect {
 		return nil, packet.ErrWrongPacketType
 	}
 
@@ -128,6 +134,23 @@ func Encode(typ packet.Type, data []byte) ([]byte, error) {
 	return buf, nil
 }
 
+// EncodeHead returns the header of a packet which carries length bytes of data,
+// the data can be written right after the header. The length is limited by
+// MaxPacketSize as the decoder of the peer does.
+func EncodeHead(typ packet.Type, length int) ([]byte, error) {
+	if typ < packet.Handshake || typ > packet.Redirect {
+		return nil, packet.ErrWrongPacketType
+	}
+	if length < 0 || length > MaxPacketSize {
+		return nil, ErrPacketSizeExcced
+	}
+
+	buf := make([]byte, HeadLength)
+	buf[0] = byte(typ)
+	copy(buf[1:], intToBytes(length))
+	return buf, nil
+}
+
 // Decode packet data length byte to int(Big end)
 func bytesToInt(b []byte) int {
 	result := 0
@@ -50,8 +50,8 @@ func TestPack(t *testing.T) {
 		t.Error("should err")
 	}
 
-	_ = &Packet{Type: Type(6), Data: data, Length: len(data)}
-	if _, err = Encode(Type(6), data); err == nil {
+	_ = &Packet{Type: Type(7), Data: data, Length: len(data)}
+	if _, err = Encode(Type(7), data); err == nil {
 		t.Error("should err")
 	}
 
@@ -26,6 +26,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/lonng/nano/clock"
 	"github.com/lonng/nano/serialize"
 	"github.com/lonng/nano/serialize/protobuf"
 	"google.golang.org/grpc"
@@ -57,6 +58,9 @@ var (
 	GrpcOptions   = []grpc.DialOption{grpc.WithInsecure()}
 	RateLimit     *RateLimitingMaker
 	IncreaseCheck bool
+
+	// Clock is the time source of scheduler, heartbeat and rate limiters
+	Clock = clock.Real()
 )
 
 func init() {
@@ -0,0 +1,210 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package fragment splits the outbound data into the frames which fit in the
+// effective MTU of a transport, and reassembles the frames on the receive side.
+//
+// A frame is composed of a 10 bytes header and the fragment of data:
+//
+//	| message id(4 bytes) | index(2 bytes) | total(2 bytes) | length(2 bytes) | fragment |
+//
+// All the integers are big endian. The frames are self-delimited by the length,
+// so they can be carried by both message-oriented and stream-oriented transports.
+package fragment
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonng/nano/internal/env"
+)
+
+// Frame constants.
+const (
+	HeadLength   = 10
+	MaxFrameSize = HeadLength + 1<<16 - 1 // the length of fragment is encoded in 2 bytes
+	MaxFragments = 1<<16 - 1              // the total of fragments is encoded in 2 bytes
+
+	// maxPending is the number of incomplete messages buffered by a Reassembler
+	maxPending = 64
+)
+
+// Errors that could be occurred in fragmentation
+var (
+	ErrFrameSize       = errors.New("fragment: invalid max frame size")
+	ErrMessageTooLarge = errors.New("fragment: message exceeds max fragments")
+	ErrWrongFrame      = errors.New("fragment: wrong frame")
+	ErrTooManyPending  = errors.New("fragment: too many incomplete messages")
+)
+
+// Fragmenter splits the messages into the frames whose size is not greater than
+// the max frame size, it is safe for concurrent use.
+type Fragmenter struct {
+	maxFrameSize int
+	seq          uint32 // last message id
+}
+
+// NewFragmenter returns a Fragmenter which splits the messages into the frames
+// of at most maxFrameSize bytes, including the frame header.
+func NewFragmenter(maxFrameSize int) (*Fragmenter, error) {
+	if maxFrameSize <= HeadLength || maxFrameSize > MaxFrameSize {
+		return nil, ErrFrameSize
+	}
+	return &Fragmenter{maxFrameSize: maxFrameSize}, nil
+}
+
+// Fragment splits the message into the numbered frames, a message is carried by
+// one frame if it fits in the max frame size.
+func (f *Fragmenter) Fragment(data []byte) ([][]byte, error) {
+	size := f.maxFrameSize - HeadLength
+	total := (len(data) + size - 1) / size
+	if total == 0 {
+		total = 1
+	}
+	if total > MaxFragments {
+		return nil, ErrMessageTooLarge
+	}
+
+	id := atomic.AddUint32(&f.seq, 1)
+	frames := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[i*size : end]
+
+		frame := make([]byte, HeadLength+len(chunk))
+		binary.BigEndian.PutUint32(frame[0:], id)
+		binary.BigEndian.PutUint16(frame[4:], uint16(i))
+		binary.BigEndian.PutUint16(frame[6:], uint16(total))
+		binary.BigEndian.PutUint16(frame[8:], uint16(len(chunk)))
+		copy(frame[HeadLength:], chunk)
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// Reassembler buffers the frames until all fragments of a message arrive, the
+// incomplete messages are discarded after timeout. It is not safe for concurrent
+// use, the frames of a connection should be fed by its read goroutine.
+type Reassembler struct {
+	timeout time.Duration
+	buf     []byte // bytes of incomplete frame
+	pending map[uint32]*partial
+}
+
+type partial struct {
+	fragments [][]byte
+	received  int
+	size      int
+	deadline  time.Time
+}
+
+// NewReassembler returns a Reassembler which discards the incomplete messages
+// if the fragments do not arrive within timeout since the first one.
+func NewReassembler(timeout time.Duration) *Reassembler {
+	return &Reassembler{
+		timeout: timeout,
+		pending: map[uint32]*partial{},
+	}
+}
+
+// Feed appends the bytes read from the transport, and returns the messages whose
+// fragments are all arrived in the order of their completion.
+func (r *Reassembler) Feed(data []byte) ([][]byte, error) {
+	r.buf = append(r.buf, data...)
+	r.expire()
+
+	var messages [][]byte
+	offset := 0
+	for len(r.buf)-offset >= HeadLength {
+		head := r.buf[offset : offset+HeadLength]
+		id := binary.BigEndian.Uint32(head[0:])
+		index := int(binary.BigEndian.Uint16(head[4:]))
+		total := int(binary.BigEndian.Uint16(head[6:]))
+		length := int(binary.BigEndian.Uint16(head[8:]))
+		if total == 0 || index >= total {
+			return nil, ErrWrongFrame
+		}
+		if len(r.buf)-offset < HeadLength+length {
+			break
+		}
+		chunk := r.buf[offset+HeadLength : offset+HeadLength+length]
+		offset += HeadLength + length
+
+		// the message is carried by one frame
+		if total == 1 {
+			messages = append(messages, append([]byte(nil), chunk...))
+			continue
+		}
+
+		p, ok := r.pending[id]
+		if !ok {
+			if len(r.pending) >= maxPending {
+				return nil, ErrTooManyPending
+			}
+			p = &partial{fragments: make([][]byte, total), deadline: env.Clock.Now().Add(r.timeout)}
+			r.pending[id] = p
+		}
+		if len(p.fragments) != total {
+			return nil, ErrWrongFrame
+		}
+		if p.fragments[index] != nil {
+			continue // duplicated fragment
+		}
+		p.fragments[index] = append([]byte(nil), chunk...)
+		p.received++
+		p.size += length
+		if p.received < total {
+			continue
+		}
+
+		delete(r.pending, id)
+		message := make([]byte, 0, p.size)
+		for _, f := range p.fragments {
+			message = append(message, f...)
+		}
+		messages = append(messages, message)
+	}
+
+	r.buf = append(r.buf[:0], r.buf[offset:]...)
+	return messages, nil
+}
+
+// Pending returns the number of incomplete messages
+func (r *Reassembler) Pending() int {
+	return len(r.pending)
+}
+
+// expire discards the incomplete messages whose deadline is passed
+func (r *Reassembler) expire() {
+	if r.timeout <= 0 {
+		return
+	}
+	now := env.Clock.Now()
+	for id, p := range r.pending {
+		if now.After(p.deadline) {
+			delete(r.pending, id)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package fragment
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/clock"
+	"github.com/lonng/nano/clock/clocktest"
+	"github.com/lonng/nano/internal/env"
+)
+
+func TestFragment(t *testing.T) {
+	f, err := NewFragmenter(HeadLength + 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReassembler(time.Second)
+
+	first, second := []byte("hello world"), []byte("nano")
+	f1, err := f.Fragment(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f1) != 3 {
+		t.Fatalf("expect: 3 frames, got: %d", len(f1))
+	}
+	f2, err := f.Fragment(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f2) != 1 {
+		t.Fatalf("expect: 1 frame, got: %d", len(f2))
+	}
+
+	// the frames of different messages are interleaved, and the bytes of a
+	// frame may be split by the stream-oriented transports
+	stream := bytes.Join([][]byte{f1[2], f1[0], f2[0], f1[0], f1[1]}, nil)
+	var messages [][]byte
+	for i := 0; i < len(stream); i += 3 {
+		end := i + 3
+		if end > len(stream) {
+			end = len(stream)
+		}
+		ms, err := r.Feed(stream[i:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, ms...)
+	}
+	if len(messages) != 2 || !bytes.Equal(messages[0], second) || !bytes.Equal(messages[1], first) {
+		t.Fatalf("unexpected messages: %q", messages)
+	}
+	if r.Pending() != 0 {
+		t.Fatalf("expect no pending message, got: %d", r.Pending())
+	}
+}
+
+func TestFragment_FrameSize(t *testing.T) {
+	for _, size := range []int{0, HeadLength, MaxFrameSize + 1} {
+		if _, err := NewFragmenter(size); err != ErrFrameSize {
+			t.Fatalf("size: %d, expect: %v, got: %v", size, ErrFrameSize, err)
+		}
+	}
+	f, _ := NewFragmenter(HeadLength + 1)
+	if _, err := f.Fragment(make([]byte, MaxFragments+1)); err != ErrMessageTooLarge {
+		t.Fatalf("expect: %v, got: %v", ErrMessageTooLarge, err)
+	}
+}
+
+func TestReassembler_Timeout(t *testing.T) {
+	fake := clocktest.NewFake(time.Now())
+	defer func(c clock.Clock) { env.Clock = c }(env.Clock)
+	env.Clock = fake
+
+	f, _ := NewFragmenter(HeadLength + 4)
+	r := NewReassembler(time.Second)
+	frames, _ := f.Fragment([]byte("hello world"))
+	if _, err := r.Feed(frames[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the incomplete message is discarded after timeout
+	fake.Advance(2 * time.Second)
+	ms, err := r.Feed(bytes.Join(frames[1:], nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 0 {
+		t.Fatalf("expect the incomplete message to be discarded, got: %q", ms)
+	}
+	if r.Pending() != 1 {
+		t.Fatalf("expect the later fragments to be pending, got: %d", r.Pending())
+	}
+
+	if _, err := r.Feed([]byte{0, 0, 0, 1, 0, 2, 0, 2, 0, 0}); err != ErrWrongFrame {
+		t.Fatalf("expect: %v, got: %v", ErrWrongFrame, err)
+	}
+}
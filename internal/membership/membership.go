@@ -0,0 +1,160 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package membership tracks the groups joined by each session, so that the
+// memberships can be restored after the session migrated to another node.
+package membership
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/lonng/nano/session"
+)
+
+// Joiner represents a named group which sessions can be added to
+type Joiner interface {
+	Add(s *session.Session) error
+}
+
+var (
+	mu       sync.RWMutex
+	groups   = map[string]Joiner{}             // group name => group
+	sessions = map[int64]map[string]struct{}{} // session id => group names
+)
+
+// Register registers the group by its name, the group registered later
+// will replace the former one with the same name
+func Register(name string, g Joiner) {
+	mu.Lock()
+	groups[name] = g
+	mu.Unlock()
+}
+
+// Unregister removes the group from the registry if it is still registered
+func Unregister(name string, g Joiner) {
+	mu.Lock()
+	if groups[name] == g {
+		delete(groups, name)
+	}
+	mu.Unlock()
+}
+
+// GroupSizes returns the number of members of each registered group which can
+// count its members
+func GroupSizes() []int {
+	mu.RLock()
+	counters := make([]interface{ Count() int }, 0, len(groups))
+	for _, g := range groups {
+		if c, ok := g.(interface{ Count() int }); ok {
+			counters = append(counters, c)
+		}
+	}
+	mu.RUnlock()
+
+	// the groups are counted without holding mu, since the groups join and
+	// leave the sessions with their own locks held
+	sizes := make([]int, len(counters))
+	for i, c := range counters {
+		sizes[i] = c.Count()
+	}
+	return sizes
+}
+
+// Lookup returns the group registered with the name
+func Lookup(name string) Joiner {
+	mu.RLock()
+	defer mu.RUnlock()
+	return groups[name]
+}
+
+// Range calls fn for each registered group until fn returns false, fn is called
+// without holding the lock
+func Range(fn func(name string, g Joiner) bool) {
+	mu.RLock()
+	names := make([]string, 0, len(groups))
+	joiners := make([]Joiner, 0, len(groups))
+	for name, g := range groups {
+		names = append(names, name)
+		joiners = append(joiners, g)
+	}
+	mu.RUnlock()
+
+	for i, name := range names {
+		if !fn(name, joiners[i]) {
+			return
+		}
+	}
+}
+
+// Join records the session has joined the group
+func Join(s *session.Session, name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names, ok := sessions[s.ID()]
+	if !ok {
+		names = map[string]struct{}{}
+		sessions[s.ID()] = names
+	}
+	names[name] = struct{}{}
+}
+
+// Leave records the session has left the group
+func Leave(s *session.Session, name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names, ok := sessions[s.ID()]
+	if !ok {
+		return
+	}
+	delete(names, name)
+	if len(names) == 0 {
+		delete(sessions, s.ID())
+	}
+}
+
+// Forget removes the records of the closed session, and returns the names of the
+// groups it has joined
+func Forget(s *session.Session) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(sessions[s.ID()]))
+	for name := range sessions[s.ID()] {
+		names = append(names, name)
+	}
+	delete(sessions, s.ID())
+	return names
+}
+
+// Groups returns the names of the groups joined by the session
+func Groups(s *session.Session) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(sessions[s.ID()]))
+	for name := range sessions[s.ID()] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
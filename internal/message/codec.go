@@ -0,0 +1,124 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package message
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// Protocol versions of message layer, the client declares the highest version it
+// supports in handshake, and the messages of the connection are encoded with the
+// codec of negotiated version. New features which change the wire format must be
+// gated on the negotiated version, so that the installed clients keep working.
+const (
+	// V1 is the pomelo compatible message format, which is used if the client
+	// does not declare a version
+	V1 = 1
+	// V2 encodes the route length as a base 128 varint, so that the route is
+	// not limited to 255 bytes, and the payload of messages can be empty
+	V2 = 2
+	// V3 adds the ReliablePush message type, which is acknowledged by the client
+	V3 = 3
+)
+
+// Codec encodes and decodes the messages of a protocol version
+type Codec interface {
+	Encode(m *Message) ([]byte, error)
+	Decode(data []byte) (*Message, error)
+}
+
+type versionCodec int
+
+func (v versionCodec) Encode(m *Message) ([]byte, error) {
+	return encode(m, int(v))
+}
+
+func (v versionCodec) Decode(data []byte) (*Message, error) {
+	return decode(data, int(v))
+}
+
+// codecs is the registry of versioned codecs
+var codecs = map[int]Codec{
+	V1: versionCodec(V1),
+	V2: versionCodec(V2),
+	V3: versionCodec(V3),
+}
+
+// CodecOf returns the codec of version, the codec of V1 will be returned if the
+// version is not supported
+func CodecOf(version int) Codec {
+	if c, ok := codecs[version]; ok {
+		return c
+	}
+	return codecs[V1]
+}
+
+// Negotiate returns the highest version supported by both server and the client,
+// the version is the highest one declared by the client
+func Negotiate(version int) int {
+	best := V1
+	for v := range codecs {
+		if v <= version && v > best {
+			best = v
+		}
+	}
+	return best
+}
+
+// SubprotocolPrefix is the prefix of the WebSocket subprotocols which name the
+// protocol versions, e.g: nano-v2 for V2
+const SubprotocolPrefix = "nano-v"
+
+// Subprotocol returns the WebSocket subprotocol of version
+func Subprotocol(version int) string {
+	return SubprotocolPrefix + strconv.Itoa(version)
+}
+
+// NegotiateSubprotocol returns the highest version supported by server among the
+// WebSocket subprotocols proposed by the client, and the subprotocol which names
+// it. The version is zero if none of the proposed subprotocols is supported.
+func NegotiateSubprotocol(proposed []string) (string, int) {
+	best := 0
+	for _, p := range proposed {
+		if !strings.HasPrefix(p, SubprotocolPrefix) {
+			continue
+		}
+		v, err := strconv.Atoi(p[len(SubprotocolPrefix):])
+		if err != nil {
+			continue
+		}
+		if _, ok := codecs[v]; ok && v > best {
+			best = v
+		}
+	}
+	if best == 0 {
+		return "", 0
+	}
+	return Subprotocol(best), best
+}
+
+func appendUvarint(buf []byte, n uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(b[:], n)
+	return append(buf, b[:l]...)
+}
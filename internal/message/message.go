@@ -29,7 +29,7 @@ import (
 	"github.com/lonng/nano/internal/log"
 )
 
-// Type represents the type of message, which could be Request/Notify/Response/Push
+// Type represents the type of message, which could be Request/Notify/Response/Push/ReliablePush
 type Type byte
 
 // Message types
@@ -38,6 +38,9 @@ const (
 	Notify        = 0x01
 	Response      = 0x02
 	Push          = 0x03
+	// ReliablePush is a push which should be acknowledged by the client with
+	// the message id, it is only available since V3
+	ReliablePush = 0x04
 )
 
 const (
@@ -52,6 +55,8 @@ var types = map[Type]string{
 	Notify:   "Notify",
 	Response: "Response",
 	Push:     "Push",
+
+	ReliablePush: "ReliablePush",
 }
 
 func (t Type) String() string {
@@ -96,12 +101,18 @@ func (m *Message) Encode() ([]byte, error) {
 }
 
 func routable(t Type) bool {
-	return t == Request || t == Notify || t == Push
+	return t == Request || t == Notify || t == Push || t == ReliablePush
 }
 
-func invalidType(t Type) bool {
-	return t < Request || t > Push
+func identified(t Type) bool {
+	return t == Request || t == Response || t == ReliablePush
+}
 
+func invalidType(t Type, version int) bool {
+	if version >= V3 {
+		return t < Request || t > ReliablePush
+	}
+	return t < Request || t > Push
 }
 
 // Encode marshals message to binary format. Different message types is corresponding to
@@ -114,11 +125,16 @@ func invalidType(t Type) bool {
 // | notify   |----001-|<route>             |
 // | response |----010-|<message id>        |
 // | push     |----011-|<route>             |
+// | reliable |----100-|<message id>|<route>| (since V3)
 // ------------------------------------------
 // The figure above indicates that the bit does not affect the type of message.
 // See ref: https://github.com/lonnng/nano/blob/master/docs/communication_protocol.md
 func Encode(m *Message) ([]byte, error) {
-	if invalidType(m.Type) {
+	return encode(m, V1)
+}
+
+func encode(m *Message, version int) ([]byte, error) {
+	if invalidType(m.Type, version) {
 		return nil, ErrWrongMessageType
 	}
 
@@ -131,7 +147,7 @@ func Encode(m *Message) ([]byte, error) {
 	}
 	buf = append(buf, flag)
 
-	if m.Type == Request || m.Type == Response {
+	if identified(m.Type) {
 		n := m.ID
 		// variant length encode
 		for {
@@ -150,6 +166,9 @@ func Encode(m *Message) ([]byte, error) {
 		if compressed {
 			buf = append(buf, byte((code>>8)&0xFF))
 			buf = append(buf, byte(code&0xFF))
+		} else if version >= V2 {
+			buf = appendUvarint(buf, uint64(len(m.Route)))
+			buf = append(buf, []byte(m.Route)...)
 		} else {
 			buf = append(buf, byte(len(m.Route)))
 			buf = append(buf, []byte(m.Route)...)
@@ -163,6 +182,10 @@ func Encode(m *Message) ([]byte, error) {
 // Decode unmarshal the bytes slice to a message
 // See ref: https://github.com/lonnng/nano/blob/master/docs/communication_protocol.md
 func Decode(data []byte) (*Message, error) {
+	return decode(data, V1)
+}
+
+func decode(data []byte, version int) (*Message, error) {
 	if len(data) < msgHeadLength {
 		return nil, ErrInvalidMessage
 	}
@@ -171,11 +194,11 @@ func Decode(data []byte) (*Message, error) {
 	offset := 1
 	m.Type = Type((flag >> 1) & msgTypeMask)
 
-	if invalidType(m.Type) {
+	if invalidType(m.Type, version) {
 		return nil, ErrWrongMessageType
 	}
 
-	if m.Type == Request || m.Type == Response {
+	if identified(m.Type) {
 		id := uint64(0)
 		// little end byte order
 		// WARNING: must can be stored in 64 bits integer
@@ -191,7 +214,8 @@ func Decode(data []byte) (*Message, error) {
 		m.ID = id
 	}
 
-	if offset >= len(data) {
+	// the payload is required in V1, which can be empty since V2
+	if offset > len(data) || (version < V2 && offset == len(data)) {
 		return nil, ErrWrongMessage
 	}
 
@@ -205,6 +229,15 @@ func Decode(data []byte) (*Message, error) {
 			}
 			m.Route = route
 			offset += 2
+		} else if version >= V2 {
+			m.compressed = false
+			rl, n := binary.Uvarint(data[offset:])
+			if n <= 0 || rl > uint64(len(data)-offset-n) {
+				return nil, ErrWrongMessage
+			}
+			offset += n
+			m.Route = string(data[offset:(offset + int(rl))])
+			offset += int(rl)
 		} else {
 			m.compressed = false
 			rl := data[offset]
@@ -2,6 +2,7 @@ package message
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -162,3 +163,87 @@ func TestEncode(t *testing.T) {
 		t.Error("not equal")
 	}
 }
+
+func TestCodec_V2(t *testing.T) {
+	route := strings.Repeat("r", 300)
+	m := &Message{Type: Request, ID: 1, Route: route, Data: []byte(`hello world`)}
+	em, err := CodecOf(V2).Encode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm, err := CodecOf(V2).Decode(em)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, dm) {
+		t.Fatalf("expect: %v, got: %v", m, dm)
+	}
+
+	// the payload can be empty since V2
+	notify := &Message{Type: Notify, Route: "test.notify", Data: []byte{}}
+	em, err = CodecOf(V2).Encode(notify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dm, err := CodecOf(V2).Decode(em); err != nil || !reflect.DeepEqual(notify, dm) {
+		t.Fatalf("expect: %v, got: %v (%v)", notify, dm, err)
+	}
+	if _, err := CodecOf(V1).Decode(em); err != ErrWrongMessage {
+		t.Fatalf("expect: %v, got: %v", ErrWrongMessage, err)
+	}
+}
+
+func TestCodec_V3(t *testing.T) {
+	m := &Message{Type: ReliablePush, ID: 300, Route: "room.event", Data: []byte(`hello world`)}
+	em, err := CodecOf(V3).Encode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm, err := CodecOf(V3).Decode(em)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, dm) {
+		t.Fatalf("expect: %v, got: %v", m, dm)
+	}
+
+	// the reliable push is not available before V3
+	if _, err := CodecOf(V2).Encode(m); err != ErrWrongMessageType {
+		t.Fatalf("expect: %v, got: %v", ErrWrongMessageType, err)
+	}
+	if _, err := CodecOf(V2).Decode(em); err != ErrWrongMessageType {
+		t.Fatalf("expect: %v, got: %v", ErrWrongMessageType, err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := map[int]int{0: V1, V1: V1, V2: V2, V3: V3, V3 + 1: V3}
+	for declared, expect := range cases {
+		if v := Negotiate(declared); v != expect {
+			t.Fatalf("declared: %d, expect: %d, got: %d", declared, expect, v)
+		}
+	}
+	if CodecOf(V3+1) != CodecOf(V1) {
+		t.Fatal("expect the codec of V1 for unsupported version")
+	}
+}
+
+func TestNegotiateSubprotocol(t *testing.T) {
+	cases := []struct {
+		proposed []string
+		expect   string
+		version  int
+	}{
+		{[]string{"nano-v1"}, "nano-v1", V1},
+		{[]string{"nano-v1", "nano-v3", "nano-v2"}, "nano-v3", V3},
+		{[]string{"chat", "nano-v2", "nano-v99"}, "nano-v2", V2},
+		{[]string{"chat", "nano-vx", "nano-v99"}, "", 0},
+		{nil, "", 0},
+	}
+	for _, c := range cases {
+		s, v := NegotiateSubprotocol(c.proposed)
+		if s != c.expect || v != c.version {
+			t.Fatalf("proposed: %v, expect: %s(%d), got: %s(%d)", c.proposed, c.expect, c.version, s, v)
+		}
+	}
+}
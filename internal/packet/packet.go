@@ -44,6 +44,10 @@ const (
 
 	// Kick represents a kick off packet
 	Kick = 0x05 // disconnect message from server
+
+	// Redirect represents a redirect packet, the client should reconnect to the
+	// address in the packet and resume the session with the token
+	Redirect = 0x06
 )
 
 // ErrWrongPacketType represents a wrong packet type.
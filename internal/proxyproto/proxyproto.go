@@ -0,0 +1,246 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package proxyproto parses the PROXY protocol header sent by the load balancers
+// ahead of the connection data, which carries the address of the real client.
+// Both the human-readable v1 and the binary v2 formats are supported, see
+// https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors that could be occurred in header parsing
+var (
+	ErrNoHeader      = errors.New("proxyproto: missing header")
+	ErrInvalidHeader = errors.New("proxyproto: invalid header")
+)
+
+const (
+	maxV1Length = 107 // max length of the v1 header, including CRLF
+	v2Length    = 16  // length of the fixed part of the v2 header
+)
+
+// v2Signature is the leading 12 bytes of the v2 header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Listener wraps the accepted connections of the listener with Conn
+type Listener struct {
+	net.Listener
+	Timeout time.Duration // max duration to read the header, zero means no limit
+}
+
+// Accept waits for and returns the next connection, the header is not read
+// until the first Read or RemoteAddr call, so that a slow client does not
+// block the accept loop
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, l.Timeout), nil
+}
+
+// Conn is a connection starting with the PROXY protocol header, its RemoteAddr
+// and LocalAddr are the addresses carried by the header
+type Conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once sync.Once
+	src  net.Addr
+	dst  net.Addr
+	err  error
+}
+
+// NewConn returns the connection which reads the header within timeout
+func NewConn(conn net.Conn, timeout time.Duration) *Conn {
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+}
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.src, c.dst, c.err = ReadHeader(c.reader)
+	})
+}
+
+// Read reads the data following the header, the error of header parsing is
+// returned if the header is invalid
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the source address of the header, or the address of the
+// peer if the header carries no address, e.g: health checks of load balancers
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address of the header, or the local
+// address of the connection if the header carries no address
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.dst != nil {
+		return c.dst
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ReadHeader reads the header of v1 or v2 from r, the returned addresses are
+// nil if the header carries no address, i.e. UNKNOWN of v1 and LOCAL of v2.
+func ReadHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	b, err := r.Peek(len(v2Signature))
+	if err != nil {
+		if err == io.EOF {
+			err = ErrNoHeader
+		}
+		return nil, nil, err
+	}
+	if bytes.Equal(b, v2Signature) {
+		return readV2(r)
+	}
+	if bytes.HasPrefix(b, []byte("PROXY ")) {
+		return readV1(r)
+	}
+	return nil, nil, ErrNoHeader
+}
+
+// readV1 reads the header like "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func readV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < maxV1Length {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return nil, nil, ErrInvalidHeader
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, nil, ErrInvalidHeader
+	}
+	if len(fields) != 6 {
+		return nil, nil, ErrInvalidHeader
+	}
+	v4 := fields[1] == "TCP4"
+	src, err := parseV1Addr(fields[2], fields[4], v4)
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseV1Addr(fields[3], fields[5], v4)
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseV1Addr(host, port string, v4 bool) (net.Addr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (ip.To4() != nil) != v4 {
+		return nil, ErrInvalidHeader
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readV2 reads the binary header, the TLVs following the addresses are skipped
+func readV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var header [v2Length]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, ErrInvalidHeader
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch header[12] & 0xf {
+	case 0x0: // LOCAL, the connection is established by the proxy itself
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, ErrInvalidHeader
+	}
+
+	var size int
+	switch header[13] >> 4 {
+	case 0x1: // AF_INET
+		size = net.IPv4len
+	case 0x2: // AF_INET6
+		size = net.IPv6len
+	default: // AF_UNSPEC and AF_UNIX carry no IP address
+		return nil, nil, nil
+	}
+	if len(payload) < 2*size+4 {
+		return nil, nil, ErrInvalidHeader
+	}
+	src := &net.TCPAddr{
+		IP:   net.IP(payload[:size]),
+		Port: int(binary.BigEndian.Uint16(payload[2*size:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(payload[size : 2*size]),
+		Port: int(binary.BigEndian.Uint16(payload[2*size+2:])),
+	}
+	return src, dst, nil
+}
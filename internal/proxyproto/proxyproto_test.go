@@ -0,0 +1,122 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func v2Header(cmd, fam byte, payload []byte) []byte {
+	b := append([]byte{}, v2Signature...)
+	b = append(b, 0x20|cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(payload)))
+	return append(b, payload...)
+}
+
+func TestReadHeader(t *testing.T) {
+	inet := []byte{10, 0, 0, 1, 10, 0, 0, 2, 0x1f, 0x90, 0x01, 0xbb}
+	inet6 := make([]byte, 36)
+	copy(inet6, net.ParseIP("2001:db8::1"))
+	copy(inet6[16:], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(inet6[32:], 8080)
+	binary.BigEndian.PutUint16(inet6[34:], 443)
+
+	cases := []struct {
+		name     string
+		header   []byte
+		src, dst string
+		err      error
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"), "192.168.0.1:56324", "192.168.0.11:443", nil},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 8080 443\r\n"), "[2001:db8::1]:8080", "[2001:db8::2]:443", nil},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", "", nil},
+		{"v1 mismatched family", []byte("PROXY TCP4 2001:db8::1 2001:db8::2 8080 443\r\n"), "", "", ErrInvalidHeader},
+		{"v1 bad port", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 65536 443\r\n"), "", "", ErrInvalidHeader},
+		{"v1 no crlf", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\n"), "", "", ErrInvalidHeader},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", maxV1Length) + "\r\n"), "", "", ErrInvalidHeader},
+		{"v2 inet", v2Header(0x1, 0x11, append(inet, 0x03, 0, 0)), "10.0.0.1:8080", "10.0.0.2:443", nil},
+		{"v2 inet6", v2Header(0x1, 0x21, inet6), "[2001:db8::1]:8080", "[2001:db8::2]:443", nil},
+		{"v2 local", v2Header(0x0, 0x00, nil), "", "", nil},
+		{"v2 unix", v2Header(0x1, 0x31, make([]byte, 216)), "", "", nil},
+		{"v2 short", v2Header(0x1, 0x11, inet[:8]), "", "", ErrInvalidHeader},
+		{"v2 bad command", v2Header(0x2, 0x11, inet), "", "", ErrInvalidHeader},
+		{"no header", []byte("GET / HTTP/1.1\r\n\r\n"), "", "", ErrNoHeader},
+		{"short", []byte("hi"), "", "", ErrNoHeader},
+	}
+	for _, c := range cases {
+		src, dst, err := ReadHeader(bufio.NewReader(bytes.NewReader(c.header)))
+		if err != c.err {
+			t.Fatalf("%s: expect error: %v, got: %v", c.name, c.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if c.src == "" {
+			if src != nil || dst != nil {
+				t.Fatalf("%s: expect no address, got: %v %v", c.name, src, dst)
+			}
+			continue
+		}
+		if src.String() != c.src || dst.String() != c.dst {
+			t.Fatalf("%s: expect: %s %s, got: %v %v", c.name, c.src, c.dst, src, dst)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Listener{Listener: ln, Timeout: time.Second}
+	defer l.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("PROXY TCP4 203.0.113.7 10.0.0.1 40000 3250\r\nhello"))
+	}()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if addr := conn.RemoteAddr().String(); addr != "203.0.113.7:40000" {
+		t.Fatalf("expect remote address of client, got: %s", addr)
+	}
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("expect: hello, got: %q", data)
+	}
+
+	// the connection without header is refused once the timeout is exceeded
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		time.Sleep(2 * time.Second)
+		conn.Close()
+	}()
+	l.Timeout = 100 * time.Millisecond
+	conn2, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	if _, err := conn2.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expect the header timed out")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"sync"
+)
+
+// CompositeReporter fans out the metrics to multiple reporters, so that the same
+// metrics can be shipped to several backends, e.g: Prometheus and an in-house TSDB.
+// The reporters can be registered at runtime.
+type CompositeReporter struct {
+	mu        sync.RWMutex
+	reporters []Reporter
+}
+
+// NewCompositeReporter returns a CompositeReporter fanning out to the reporters
+func NewCompositeReporter(reporters ...Reporter) *CompositeReporter {
+	return &CompositeReporter{reporters: append([]Reporter(nil), reporters...)}
+}
+
+// Register adds a reporter to the backends
+func (c *CompositeReporter) Register(r Reporter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reporters = append(c.reporters, r)
+}
+
+// Reporters returns the registered backends
+func (c *CompositeReporter) Reporters() []Reporter {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Reporter(nil), c.reporters...)
+}
+
+// each calls fn with every backend, the metrics are reported to all backends even
+// if some of them fail, and the first error is returned
+func (c *CompositeReporter) each(fn func(r Reporter) error) error {
+	var first error
+	for _, r := range c.Reporters() {
+		if err := fn(r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ReportCount reports the count to all backends
+func (c *CompositeReporter) ReportCount(metric string, tags map[string]string, count float64) error {
+	return c.each(func(r Reporter) error { return r.ReportCount(metric, tags, count) })
+}
+
+// ReportSummary reports the summary value to all backends
+func (c *CompositeReporter) ReportSummary(metric string, tags map[string]string, value float64) error {
+	return c.each(func(r Reporter) error { return r.ReportSummary(metric, tags, value) })
+}
+
+// ReportHistogram implements the HistogramReporter interface, the value is reported
+// as a summary to the backends not implementing the HistogramReporter interface
+func (c *CompositeReporter) ReportHistogram(metric string, tags map[string]string, value float64) error {
+	return c.each(func(r Reporter) error { return ReportHistogram(r, metric, tags, value) })
+}
+
+// ReportGauge reports the gauge value to all backends
+func (c *CompositeReporter) ReportGauge(metric string, tags map[string]string, value float64) error {
+	return c.each(func(r Reporter) error { return r.ReportGauge(metric, tags, value) })
+}
+
+// Flush implements the Flusher interface, which flushes the backends implementing
+// the Flusher interface
+func (c *CompositeReporter) Flush(cfg FlushConfig) error {
+	return c.each(func(r Reporter) error {
+		if f, ok := r.(Flusher); ok {
+			return f.Flush(cfg)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordReporter records the reported metrics
+type recordReporter struct {
+	reported []string
+	err      error
+}
+
+func (r *recordReporter) ReportCount(metric string, tags map[string]string, count float64) error {
+	r.reported = append(r.reported, "count:"+metric)
+	return r.err
+}
+
+func (r *recordReporter) ReportSummary(metric string, tags map[string]string, value float64) error {
+	r.reported = append(r.reported, "summary:"+metric)
+	return r.err
+}
+
+func (r *recordReporter) ReportGauge(metric string, tags map[string]string, value float64) error {
+	r.reported = append(r.reported, "gauge:"+metric)
+	return r.err
+}
+
+func TestCompositeReporter(t *testing.T) {
+	failed := &recordReporter{err: errors.New("unavailable")}
+	c := NewCompositeReporter(failed)
+	r := &recordReporter{}
+	c.Register(r)
+
+	if err := c.ReportCount(ExceededRateLimiting, nil, 1); err != failed.err {
+		t.Fatalf("expect: %v, got: %v", failed.err, err)
+	}
+	c.ReportSummary(ResponseTime, nil, 1)
+	c.ReportGauge(ConnectedClients, nil, 1)
+
+	expect := []string{"count:" + ExceededRateLimiting, "summary:" + ResponseTime, "gauge:" + ConnectedClients}
+	for _, b := range []*recordReporter{failed, r} {
+		if !reflect.DeepEqual(b.reported, expect) {
+			t.Fatalf("expect: %v, got: %v", expect, b.reported)
+		}
+	}
+}
+
+// histogramReporter records the reported metrics including histograms
+type histogramReporter struct {
+	recordReporter
+}
+
+func (r *histogramReporter) ReportHistogram(metric string, tags map[string]string, value float64) error {
+	r.reported = append(r.reported, "histogram:"+metric)
+	return r.err
+}
+
+func TestCompositeReporter_ReportHistogram(t *testing.T) {
+	r, h := &recordReporter{}, &histogramReporter{}
+	c := NewCompositeReporter(r, h)
+	c.ReportHistogram(MessageBytes, nil, 128)
+
+	// the value is reported as a summary to the backends without histograms
+	if expect := []string{"summary:" + MessageBytes}; !reflect.DeepEqual(r.reported, expect) {
+		t.Fatalf("expect: %v, got: %v", expect, r.reported)
+	}
+	if expect := []string{"histogram:" + MessageBytes}; !reflect.DeepEqual(h.reported, expect) {
+		t.Fatalf("expect: %v, got: %v", expect, h.reported)
+	}
+}
+
+func TestCompositeReporter_Flush(t *testing.T) {
+	b := &blockingFlusher{flushed: make(chan struct{})}
+	c := NewCompositeReporter(&recordReporter{}, b)
+	go c.Flush(FlushConfig{})
+	<-b.flushed
+}
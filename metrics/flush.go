@@ -0,0 +1,138 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultFlushTimeout is the default timeout of flushing metrics
+const DefaultFlushTimeout = 3 * time.Second
+
+// FlushConfig configures where the current metrics are flushed to before the
+// process exits, e.g: on an unrecovered panic
+type FlushConfig struct {
+	PushGateway string        // address of pushgateway, e.g: http://pushgateway:9091
+	Job         string        // job name of the pushed metrics, "nano" by default
+	Instance    string        // instance label of the pushed metrics, optional
+	File        string        // file which the metrics are written to in text exposition format
+	Timeout     time.Duration // DefaultFlushTimeout will be used if zero
+}
+
+// Flusher is implemented by the reporters which can flush their current metrics
+type Flusher interface {
+	Flush(cfg FlushConfig) error
+}
+
+// Flush flushes the metrics of reporters which implement the Flusher interface.
+// It is best-effort and returns after the timeout even if the flushing has not
+// completed, so that it never hangs a crashing process.
+func Flush(reporters []Reporter, cfg FlushConfig) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultFlushTimeout
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, r := range reporters {
+			f, ok := r.(Flusher)
+			if !ok {
+				continue
+			}
+			if err := f.Flush(cfg); err != nil {
+				log.Println("Flush metrics failed", err)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(cfg.Timeout):
+		log.Println("Flush metrics timeout")
+	}
+}
+
+// Flush implements the Flusher interface, which writes the text exposition of
+// the registry to the file and pushes it to the pushgateway
+func (p *PrometheusReporter) Flush(cfg FlushConfig) error {
+	data, contentType := p.gather()
+	if cfg.File != "" {
+		if err := ioutil.WriteFile(cfg.File, data, 0644); err != nil {
+			return err
+		}
+	}
+	if cfg.PushGateway == "" {
+		return nil
+	}
+	return p.push(cfg.PushGateway, cfg.Job, cfg.Instance, data, contentType, cfg.Timeout)
+}
+
+// gather returns the text exposition of the registry and its content type
+func (p *PrometheusReporter) gather() ([]byte, string) {
+	rec := httptest.NewRecorder()
+	p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.Bytes(), rec.Header().Get("Content-Type")
+}
+
+// push replaces the metrics of the job and instance grouping in the pushgateway
+// with the text exposition data
+func (p *PrometheusReporter) push(gateway, job, instance string, data []byte, contentType string, timeout time.Duration) error {
+	if job == "" {
+		job = "nano"
+	}
+	addr := fmt.Sprintf("%s/metrics/job/%s", strings.TrimSuffix(gateway, "/"), url.PathEscape(job))
+	if instance != "" {
+		addr += "/instance/" + url.PathEscape(instance)
+	}
+	req, err := http.NewRequest(http.MethodPut, addr, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d from pushgateway", resp.StatusCode)
+	}
+	return nil
+}
+
+// Flush implements the Flusher interface, which sends the buffered metrics to
+// statsd if the client supports it
+func (s *StatsdReporter) Flush(_ FlushConfig) error {
+	if f, ok := s.client.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+type blockingFlusher struct {
+	ConsoleReporter
+	flushed chan struct{}
+}
+
+func (b *blockingFlusher) Flush(_ FlushConfig) error {
+	close(b.flushed)
+	select {}
+}
+
+func TestFlush_Timeout(t *testing.T) {
+	r := &blockingFlusher{flushed: make(chan struct{})}
+	start := time.Now()
+	Flush([]Reporter{r}, FlushConfig{Timeout: 50 * time.Millisecond})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect flush to return after timeout, took: %v", elapsed)
+	}
+	select {
+	case <-r.flushed:
+	default:
+		t.Fatal("expect reporter to be flushed")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultHealthCheckTimeout is the timeout of running the health checks of a probe
+const DefaultHealthCheckTimeout = 3 * time.Second
+
+// Status of the health probes
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+)
+
+// HealthChecker checks a dependency of the server, e.g: the connectivity of the
+// cluster, the server is unhealthy if any check returns an error
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// HealthRegistry is implemented by the reporters which serve the health probes,
+// the checks can be added at runtime
+type HealthRegistry interface {
+	AddLivenessCheck(c HealthChecker)
+	AddReadinessCheck(c HealthChecker)
+}
+
+type healthCheck struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (c healthCheck) Name() string                    { return c.name }
+func (c healthCheck) Check(ctx context.Context) error { return c.fn(ctx) }
+
+// HealthCheckFunc returns a HealthChecker named name, which checks by fn
+func HealthCheckFunc(name string, fn func(ctx context.Context) error) HealthChecker {
+	return healthCheck{name: name, fn: fn}
+}
+
+// WithLivenessChecks adds the checks of the liveness probe served at /healthz
+func WithLivenessChecks(checks ...HealthChecker) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		p.liveness = append(p.liveness, checks...)
+	}
+}
+
+// WithReadinessChecks adds the checks of the readiness probe served at /readyz
+func WithReadinessChecks(checks ...HealthChecker) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		p.readiness = append(p.readiness, checks...)
+	}
+}
+
+// AddLivenessCheck implements the HealthRegistry interface
+func (p *PrometheusReporter) AddLivenessCheck(c HealthChecker) {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+	p.liveness = append(p.liveness, c)
+}
+
+// AddReadinessCheck implements the HealthRegistry interface
+func (p *PrometheusReporter) AddReadinessCheck(c HealthChecker) {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+	p.readiness = append(p.readiness, c)
+}
+
+// healthResult is the response of the health probes
+type healthResult struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"` // check name -> ok or the error
+}
+
+// healthHandler serves a probe running the checks returned by checks concurrently,
+// which responds 503 if any check fails or times out
+func (p *PrometheusReporter) healthHandler(checks func() []HealthChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DefaultHealthCheckTimeout)
+		defer cancel()
+
+		list := checks()
+		errs := make([]error, len(list))
+		var wg sync.WaitGroup
+		for i, c := range list {
+			wg.Add(1)
+			go func(i int, c HealthChecker) {
+				defer wg.Done()
+				errs[i] = c.Check(ctx)
+			}(i, c)
+		}
+		wg.Wait()
+
+		result := healthResult{Status: HealthStatusOK, Checks: make(map[string]string, len(list))}
+		for i, c := range list {
+			if errs[i] != nil {
+				result.Status = HealthStatusUnavailable
+				result.Checks[c.Name()] = errs[i].Error()
+				continue
+			}
+			result.Checks[c.Name()] = HealthStatusOK
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if result.Status != HealthStatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// livenessChecks returns the checks of the liveness probe
+func (p *PrometheusReporter) livenessChecks() []HealthChecker {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+	return append([]HealthChecker(nil), p.liveness...)
+}
+
+// readinessChecks returns the checks of the readiness probe
+func (p *PrometheusReporter) readinessChecks() []HealthChecker {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+	return append([]HealthChecker(nil), p.readiness...)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPrometheusReporter_HealthProbes(t *testing.T) {
+	ok := HealthCheckFunc("db", func(ctx context.Context) error { return nil })
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry(),
+		WithListenAddr("127.0.0.1:0"), WithLivenessChecks(ok), WithReadinessChecks(ok))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	probe := func(path string) (int, healthResult) {
+		resp, err := http.Get("http://" + p.Addr().String() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result healthResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, result
+	}
+
+	if code, result := probe("/readyz"); code != http.StatusOK || result.Status != HealthStatusOK {
+		t.Fatalf("expect ready, got: %d %+v", code, result)
+	}
+
+	// the checks added at runtime are run by the next probes
+	p.AddReadinessCheck(HealthCheckFunc("cluster", func(ctx context.Context) error {
+		return errors.New("master is unreachable")
+	}))
+	code, result := probe("/readyz")
+	if code != http.StatusServiceUnavailable || result.Status != HealthStatusUnavailable {
+		t.Fatalf("expect unavailable, got: %d %+v", code, result)
+	}
+	if result.Checks["cluster"] != "master is unreachable" || result.Checks["db"] != HealthStatusOK {
+		t.Fatalf("unexpected checks: %+v", result.Checks)
+	}
+	if code, _ := probe("/healthz"); code != http.StatusOK {
+		t.Fatalf("expect alive, got: %d", code)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package otlp exports the metrics of nano to an OpenTelemetry collector over
+// OTLP/HTTP. The Reporter implements the metrics.Reporter interface:
+//
+//	reporter, err := otlp.NewReporter(ctx, otlp.Config{
+//		Endpoint:           "otel-collector:4318",
+//		Headers:            map[string]string{"api-key": "secret"},
+//		ResourceAttributes: map[string]string{"service.name": "lobby"},
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer reporter.Shutdown(context.Background())
+//	nano.Listen(addr, nano.WithMetrics([]metrics.Reporter{reporter}, time.Minute))
+//
+// It is a separate module, so that the dependencies of the OpenTelemetry SDK are
+// only required by the applications exporting to OTLP.
+package otlp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// DefaultInterval is the interval of exporting the metrics if Config.Interval is zero
+const DefaultInterval = 15 * time.Second
+
+// instrumentationName is the name of the meter of the metrics
+const instrumentationName = "github.com/lonng/nano"
+
+// Config configures the OTLP exporter of Reporter
+type Config struct {
+	Endpoint           string            // host:port of the OTLP/HTTP receiver, "localhost:4318" if empty
+	URLPath            string            // URL path of the receiver, "/v1/metrics" if empty
+	Insecure           bool              // use HTTP instead of HTTPS
+	Headers            map[string]string // headers sent with each export, e.g: the api key
+	ResourceAttributes map[string]string // attributes of the resource, e.g: service.name
+	Interval           time.Duration     // interval of exporting the metrics
+}
+
+// Reporter reports the metrics to OpenTelemetry instruments: the counts are added to
+// counters, the summaries are recorded by histograms, e.g: ResponseTime and
+// ProcessDelay, and the gauges are observed by observable gauges, e.g:
+// ConnectedClients and Goroutines, with the last value reported for each set of tags.
+type Reporter struct {
+	provider *sdkmetric.MeterProvider
+	meter    metric.Meter
+
+	mu         sync.Mutex
+	counters   map[string]metric.Float64Counter
+	histograms map[string]metric.Float64Histogram
+	gauges     map[string]map[attribute.Distinct]gaugePoint
+}
+
+type gaugePoint struct {
+	attrs attribute.Set
+	value float64
+}
+
+// NewReporter returns a Reporter exporting the metrics periodically to the
+// collector configured by cfg.
+func NewReporter(ctx context.Context, cfg Config) (*Reporter, error) {
+	opts := []otlpmetrichttp.Option{}
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.URLPath != "" {
+		opts = append(opts, otlpmetrichttp.WithURLPath(cfg.URLPath))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+	}
+	exporter, err := otlpmetrichttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := cfg.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	res, err := newResource(cfg.ResourceAttributes)
+	if err != nil {
+		return nil, err
+	}
+	return newReporter(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval)), res), nil
+}
+
+// newResource returns the default resource with the attributes
+func newResource(attrs map[string]string) (*resource.Resource, error) {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		kvs = append(kvs, attribute.String(k, v))
+	}
+	return resource.Merge(resource.Default(), resource.NewSchemaless(kvs...))
+}
+
+func newReporter(reader sdkmetric.Reader, res *resource.Resource) *Reporter {
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
+	return &Reporter{
+		provider:   provider,
+		meter:      provider.Meter(instrumentationName),
+		counters:   map[string]metric.Float64Counter{},
+		histograms: map[string]metric.Float64Histogram{},
+		gauges:     map[string]map[attribute.Distinct]gaugePoint{},
+	}
+}
+
+func attributes(tags map[string]string) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(tags))
+	for k, v := range tags {
+		kvs = append(kvs, attribute.String(k, v))
+	}
+	return attribute.NewSet(kvs...)
+}
+
+// unit returns the unit of the metric by its suffix
+func unit(metric string) string {
+	switch {
+	case strings.HasSuffix(metric, "_ns"):
+		return "ns"
+	case strings.HasSuffix(metric, "_bytes"):
+		return "By"
+	}
+	return ""
+}
+
+// ReportCount adds the count to the counter of the metric
+func (r *Reporter) ReportCount(name string, tags map[string]string, count float64) error {
+	r.mu.Lock()
+	c, ok := r.counters[name]
+	if !ok {
+		var err error
+		c, err = r.meter.Float64Counter(name, metric.WithUnit(unit(name)))
+		if err != nil {
+			r.mu.Unlock()
+			return err
+		}
+		r.counters[name] = c
+	}
+	r.mu.Unlock()
+
+	c.Add(context.Background(), count, metric.WithAttributeSet(attributes(tags)))
+	return nil
+}
+
+// ReportSummary records the value by the histogram of the metric
+func (r *Reporter) ReportSummary(name string, tags map[string]string, value float64) error {
+	r.mu.Lock()
+	h, ok := r.histograms[name]
+	if !ok {
+		var err error
+		h, err = r.meter.Float64Histogram(name, metric.WithUnit(unit(name)))
+		if err != nil {
+			r.mu.Unlock()
+			return err
+		}
+		r.histograms[name] = h
+	}
+	r.mu.Unlock()
+
+	h.Record(context.Background(), value, metric.WithAttributeSet(attributes(tags)))
+	return nil
+}
+
+// ReportGauge sets the value of the observable gauge of the metric, which is
+// observed when the metrics are exported
+func (r *Reporter) ReportGauge(name string, tags map[string]string, value float64) error {
+	attrs := attributes(tags)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	points, ok := r.gauges[name]
+	if !ok {
+		points = map[attribute.Distinct]gaugePoint{}
+		_, err := r.meter.Float64ObservableGauge(name, metric.WithUnit(unit(name)),
+			metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				for _, p := range points {
+					o.Observe(p.value, metric.WithAttributeSet(p.attrs))
+				}
+				return nil
+			}))
+		if err != nil {
+			return err
+		}
+		r.gauges[name] = points
+	}
+	points[attrs.Equivalent()] = gaugePoint{attrs: attrs, value: value}
+	return nil
+}
+
+// ForceFlush exports the metrics immediately, e.g: before the process crashes
+func (r *Reporter) ForceFlush(ctx context.Context) error {
+	return r.provider.ForceFlush(ctx)
+}
+
+// Shutdown exports the metrics and stops the exporter
+func (r *Reporter) Shutdown(ctx context.Context) error {
+	return r.provider.Shutdown(ctx)
+}
@@ -0,0 +1,124 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package otlp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]metricdata.Metrics{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func TestReporter(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	res, err := newResource(map[string]string{"service.name": "lobby"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newReporter(reader, res)
+
+	r.ReportSummary("response_time_ns", map[string]string{"route": "Room.Join"}, 2e6)
+	r.ReportSummary("response_time_ns", map[string]string{"route": "Room.Join"}, 4e6)
+	r.ReportGauge("connected_clients", map[string]string{"transport": "ws"}, 3)
+	r.ReportGauge("connected_clients", map[string]string{"transport": "ws"}, 5)
+	r.ReportGauge("goroutines", nil, 42)
+	r.ReportCount("exceeded_rate_limiting", nil, 1)
+	r.ReportCount("exceeded_rate_limiting", nil, 2)
+
+	metrics := collect(t, reader)
+
+	h, ok := metrics["response_time_ns"].Data.(metricdata.Histogram[float64])
+	if !ok || len(h.DataPoints) != 1 {
+		t.Fatalf("expect a histogram, got: %+v", metrics["response_time_ns"])
+	}
+	if p := h.DataPoints[0]; p.Count != 2 || p.Sum != 6e6 {
+		t.Fatalf("unexpected histogram: count=%d, sum=%v", p.Count, p.Sum)
+	}
+	if route, _ := h.DataPoints[0].Attributes.Value("route"); route != attribute.StringValue("Room.Join") {
+		t.Fatalf("unexpected route: %v", route)
+	}
+	if u := metrics["response_time_ns"].Unit; u != "ns" {
+		t.Fatalf("expect unit: ns, got: %s", u)
+	}
+
+	for name, expect := range map[string]float64{"connected_clients": 5, "goroutines": 42} {
+		g, ok := metrics[name].Data.(metricdata.Gauge[float64])
+		if !ok || len(g.DataPoints) != 1 || g.DataPoints[0].Value != expect {
+			t.Fatalf("expect gauge %s to be %v, got: %+v", name, expect, metrics[name])
+		}
+	}
+
+	s, ok := metrics["exceeded_rate_limiting"].Data.(metricdata.Sum[float64])
+	if !ok || len(s.DataPoints) != 1 || s.DataPoints[0].Value != 3 {
+		t.Fatalf("expect counter to be 3, got: %+v", metrics["exceeded_rate_limiting"])
+	}
+}
+
+func TestNewReporter(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case received <- req:
+		default:
+		}
+	}))
+	defer server.Close()
+
+	r, err := NewReporter(context.Background(), Config{
+		Endpoint: strings.TrimPrefix(server.URL, "http://"),
+		Insecure: true,
+		Headers:  map[string]string{"api-key": "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ReportGauge("goroutines", nil, 42)
+	if err := r.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	req := <-received
+	if req.URL.Path != "/v1/metrics" || req.Header.Get("api-key") != "secret" {
+		t.Fatalf("unexpected export request: %s %v", req.URL.Path, req.Header)
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
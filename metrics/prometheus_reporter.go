@@ -21,17 +21,44 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// DefaultNamespace is the namespace of metrics if the reporter is created
+// without a namespace
+const DefaultNamespace = "nano"
+
+// Defaults of the HTTP handler which exposes the metrics, the scrapes exceeding
+// the in-flight limit are responded with 503, and the scrapes slower than the
+// timeout are responded with 503 as well, so the slow collectors do not pile up
+// the scrapes.
+const (
+	DefaultScrapeMaxInFlight = 4
+	DefaultScrapeTimeout     = 10 * time.Second
+)
+
+// CollapsedLabelValue is the value of the labels collapsed by MaxCardinality
+const CollapsedLabelValue = "other"
+
+// DefaultShutdownTimeout is the timeout of closing the metrics HTTP server, the
+// scrapes in progress are waited for until the timeout
+const DefaultShutdownTimeout = 5 * time.Second
+
 // Summary defines a summary metric
 type Summary struct {
+	Namespace  string
 	Subsystem  string
 	Name       string
 	Help       string
@@ -41,14 +68,27 @@ type Summary struct {
 
 // Gauge defines a gauge metric
 type Gauge struct {
+	Namespace string
 	Subsystem string
 	Name      string
 	Help      string
 	Labels    []string
 }
 
+// Histogram defines a histogram metric, prometheus.DefBuckets will be used if
+// the buckets are absent
+type Histogram struct {
+	Namespace string
+	Subsystem string
+	Name      string
+	Help      string
+	Buckets   []float64
+	Labels    []string
+}
+
 // Counter defines a counter metric
 type Counter struct {
+	Namespace string
 	Subsystem string
 	Name      string
 	Help      string
@@ -57,186 +97,1157 @@ type Counter struct {
 
 var (
 	prometheusReporter *PrometheusReporter
-	once               sync.Once
+	singletonMu        sync.Mutex // guards prometheusReporter
 )
 
+var (
+	// ErrMetricRegistered is returned when registering a custom metric with the name
+	// of a metric registered to the reporter, since the metrics are reported by name
+	ErrMetricRegistered = errors.New("metric has been registered with the same name")
+
+	// ErrServerStarted is returned when starting the metrics HTTP server of a reporter
+	// which has been started
+	ErrServerStarted = errors.New("metrics server has been started")
+)
+
+// PrometheusOption customizes the prometheus reporter
+type PrometheusOption func(p *PrometheusReporter)
+
+// AllowMetrics registers only the metrics with the names, e.g: ConnectedClients,
+// which is used to cut the scrape cost and cardinality. Reporting to the metrics
+// filtered out is a no-op.
+func AllowMetrics(names ...string) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		if p.allow == nil {
+			p.allow = map[string]bool{}
+		}
+		for _, name := range names {
+			p.allow[name] = true
+		}
+	}
+}
+
+// DenyMetrics does not register the metrics with the names, e.g: the expensive
+// summaries ResponseTime and ProcessDelay. Deny takes precedence over allow.
+func DenyMetrics(names ...string) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		if p.deny == nil {
+			p.deny = map[string]bool{}
+		}
+		for _, name := range names {
+			p.deny[name] = true
+		}
+	}
+}
+
+// WithHandlerOpts customizes the HTTP handler which exposes the metrics, e.g: the
+// limit of in-flight scrapes, the scrape timeout and the error handling. The handler
+// continues on collector errors, and is limited by DefaultScrapeMaxInFlight and
+// DefaultScrapeTimeout by default.
+func WithHandlerOpts(opts promhttp.HandlerOpts) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		p.handlerOpts = opts
+	}
+}
+
+// MetricsOptions customizes the naming of the metrics, so that the metrics can be
+// aligned with the existing dashboards
+type MetricsOptions struct {
+	// Namespace overrides the namespace of the metrics, e.g: DefaultNamespace of the
+	// metrics reported by GetPrometheusReporter
+	Namespace string
+	// Subsystems overrides the subsystems of the built-in metrics by name, e.g:
+	// {ResponseTime: "rpc"}, an empty subsystem removes it from the metric name
+	Subsystems map[string]string
+	// Objectives overrides the quantile objectives of the built-in summaries
+	Objectives map[float64]float64
+	// Labels is the allowlist of the labels reported, the other labels are dropped
+	// to cut cardinality, e.g: route. The const labels and the additional labels
+	// are always reported, and all labels are reported if nil.
+	Labels []string
+}
+
+// WithMetricsOptions customizes the naming of the metrics by opts
+func WithMetricsOptions(opts MetricsOptions) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		if opts.Namespace != "" {
+			p.namespace = opts.Namespace
+		}
+		p.subsystems = opts.Subsystems
+		p.objectives = opts.Objectives
+		if opts.Labels != nil {
+			p.allowLabels = make(map[string]bool, len(opts.Labels))
+			for _, label := range opts.Labels {
+				p.allowLabels[label] = true
+			}
+		}
+	}
+}
+
+// MaxCardinality caps the number of distinct label value combinations of each
+// metric, the label values of the combinations beyond the limit are collapsed to
+// CollapsedLabelValue, e.g: the unknown routes spammed by a buggy client. The
+// collapsed reports are counted by CardinalityCollapsed. Zero means unlimited.
+func MaxCardinality(n int) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		p.maxCardinality = n
+	}
+}
+
+// WithListenAddr sets the address the metrics HTTP server binds to, e.g:
+// 127.0.0.1:9090, which overrides the port passed to GetPrometheusReporter
+func WithListenAddr(addr string) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		p.listenAddr = addr
+	}
+}
+
+// WithTLS serves the metrics over HTTPS with the certificate and key files
+func WithTLS(certFile, keyFile string) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		p.certFile = certFile
+		p.keyFile = keyFile
+	}
+}
+
+// TimingHistograms emits ResponseTime and ProcessDelay as histograms rather than
+// summaries, so that they can be aggregated across instances. TimingBuckets are
+// used unless customized by HistogramBuckets.
+func TimingHistograms() PrometheusOption {
+	return func(p *PrometheusReporter) {
+		p.timingHistograms = true
+	}
+}
+
+// HistogramBuckets customizes the buckets of a built-in histogram, e.g: MessageBytes,
+// or ResponseTime if TimingHistograms is enabled
+func HistogramBuckets(name string, buckets []float64) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		if p.buckets == nil {
+			p.buckets = map[string][]float64{}
+		}
+		p.buckets[name] = buckets
+	}
+}
+
 // PrometheusReporter reports metrics to prometheus
 type PrometheusReporter struct {
+	namespace           string
 	serverType          string
 	game                string
 	countReportersMap   map[string]*prometheus.CounterVec
 	summaryReportersMap map[string]*prometheus.SummaryVec
 	gaugeReportersMap   map[string]*prometheus.GaugeVec
+	histogramsMap       map[string]*prometheus.HistogramVec // summaries observed into buckets
+	mu                  sync.RWMutex                        // guards the maps, custom metrics can be registered at runtime
 	additionalLabels    map[string]string
+	constLabels         map[string]string
+	registerer          prometheus.Registerer
+	allow               map[string]bool // names of the metrics to register, nil for all
+	deny                map[string]bool // names of the metrics not to register
+	handlerOpts         promhttp.HandlerOpts
+	timingHistograms    bool                 // emit the timings as histograms
+	buckets             map[string][]float64 // buckets of the built-in histograms
+	subsystems          map[string]string    // subsystems of the built-in metrics
+	objectives          map[float64]float64  // objectives of the built-in summaries
+	allowLabels         map[string]bool      // labels to report, nil for all
+	maxCardinality      int                  // max label value combinations of a metric
+	cardinalityMu       sync.Mutex           // guards combinations
+	combinations        map[string]map[string]bool
+	listenAddr          string
+	certFile            string
+	keyFile             string
+	pushConfig          *PushConfig
+	pushDie             chan struct{}
+	pushDone            chan struct{}
+	pushStop            sync.Once
+	healthMu            sync.Mutex // guards liveness and readiness
+	liveness            []HealthChecker
+	readiness           []HealthChecker
+	serverMu            sync.Mutex // guards server and listener
+	server              *http.Server
+	listener            net.Listener
+}
+
+// enabled returns whether the metric passes the allow and deny lists
+func (p *PrometheusReporter) enabled(name string) bool {
+	if p.deny[name] {
+		return false
+	}
+	return p.allow == nil || p.allow[name]
+}
+
+// bucketsOf returns the buckets of the built-in histogram customized by
+// HistogramBuckets, or defaults if absent
+func (p *PrometheusReporter) bucketsOf(name string, defaults []float64) []float64 {
+	if buckets := p.buckets[name]; len(buckets) > 0 {
+		return buckets
+	}
+	return defaults
 }
 
 func (p *PrometheusReporter) registerMetrics(
 	constLabels, additionalLabels map[string]string,
-) {
+) error {
 
 	constLabels["game"] = p.game
 	constLabels["serverType"] = p.serverType
 
 	p.additionalLabels = additionalLabels
-	additionalLabelsKeys := make([]string, 0, len(additionalLabels))
-	for key := range additionalLabels {
-		additionalLabelsKeys = append(additionalLabelsKeys, key)
-	}
+	p.constLabels = constLabels
 
-	// HandlerResponseTimeMs summary
-	p.summaryReportersMap[ResponseTime] = prometheus.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Namespace:   "nano",
-			Subsystem:   "handler",
-			Name:        ResponseTime,
-			Help:        "the time to process a msg in nanoseconds",
-			Objectives:  map[float64]float64{0.7: 0.02, 0.95: 0.005, 0.99: 0.001},
-			ConstLabels: constLabels,
-		},
-		append([]string{"route"}, additionalLabelsKeys...),
-	)
-
-	// ProcessDelay summary
-	p.summaryReportersMap[ProcessDelay] = prometheus.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Namespace:   "nano",
-			Subsystem:   "handler",
-			Name:        ProcessDelay,
-			Help:        "the delay to start processing a msg in nanoseconds",
-			Objectives:  map[float64]float64{0.7: 0.02, 0.95: 0.005, 0.99: 0.001},
-			ConstLabels: constLabels,
-		},
-		append([]string{"route"}, additionalLabelsKeys...),
-	)
+	// HandlerResponseTimeMs and ProcessDelay are summaries by default, which can
+	// not be aggregated across instances, so they can be emitted as histograms
+	timings := []struct{ name, help string }{
+		{ResponseTime, "the time to process a msg in nanoseconds"},
+		{ProcessDelay, "the delay to start processing a msg in nanoseconds"},
+	}
+	for _, t := range timings {
+		if p.timingHistograms {
+			p.histogramsMap[t.name] = prometheus.NewHistogramVec(
+				prometheus.HistogramOpts{
+					Namespace:   p.namespace,
+					Subsystem:   p.subsystemOf(t.name, "handler"),
+					Name:        t.name,
+					Help:        t.help,
+					Buckets:     p.bucketsOf(t.name, TimingBuckets),
+					ConstLabels: constLabels,
+				},
+				p.labelKeys([]string{"route"}),
+			)
+			continue
+		}
+		p.summaryReportersMap[t.name] = prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Namespace:   p.namespace,
+				Subsystem:   p.subsystemOf(t.name, "handler"),
+				Name:        t.name,
+				Help:        t.help,
+				Objectives:  p.objectivesOr(map[float64]float64{0.7: 0.02, 0.95: 0.005, 0.99: 0.001}),
+				ConstLabels: constLabels,
+			},
+			p.labelKeys([]string{"route"}),
+		)
+	}
 
 	// ConnectedClients gauge
 	p.gaugeReportersMap[ConnectedClients] = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Namespace:   "nano",
-			Subsystem:   "acceptor",
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ConnectedClients, "acceptor"),
 			Name:        ConnectedClients,
 			Help:        "the number of clients connected right now",
 			ConstLabels: constLabels,
 		},
-		additionalLabelsKeys,
+		p.labelKeys([]string{"transport"}),
 	)
 
 	p.gaugeReportersMap[Goroutines] = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Namespace:   "nano",
-			Subsystem:   "sys",
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(Goroutines, "sys"),
 			Name:        Goroutines,
 			Help:        "the current number of goroutines",
 			ConstLabels: constLabels,
 		},
-		additionalLabelsKeys,
+		p.labelKeys(nil),
 	)
 
 	p.gaugeReportersMap[HeapSize] = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Namespace:   "nano",
-			Subsystem:   "sys",
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(HeapSize, "sys"),
 			Name:        HeapSize,
 			Help:        "the current heap size",
 			ConstLabels: constLabels,
 		},
-		additionalLabelsKeys,
+		p.labelKeys(nil),
 	)
 
 	p.gaugeReportersMap[HeapObjects] = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Namespace:   "nano",
-			Subsystem:   "sys",
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(HeapObjects, "sys"),
 			Name:        HeapObjects,
 			Help:        "the current number of allocated heap objects",
 			ConstLabels: constLabels,
 		},
-		additionalLabelsKeys,
+		p.labelKeys(nil),
+	)
+
+	p.summaryReportersMap[GCPause] = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(GCPause, "sys"),
+			Name:        GCPause,
+			Help:        "the stop-the-world pause of gc in nanoseconds",
+			Objectives:  p.objectivesOr(map[float64]float64{0.5: 0.05, 0.99: 0.001}),
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.countReportersMap[GCCount] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(GCCount, "sys"),
+			Name:        GCCount,
+			Help:        "the number of completed gc cycles",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.countReportersMap[ProcessCPUSeconds] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ProcessCPUSeconds, "sys"),
+			Name:        ProcessCPUSeconds,
+			Help:        "the user and system cpu time spent in seconds",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.gaugeReportersMap[OpenConnections] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(OpenConnections, "acceptor"),
+			Name:        OpenConnections,
+			Help:        "the number of client connections opened right now",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
 	)
 
 	p.gaugeReportersMap[MessageCount] = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Namespace:   "nano",
-			Subsystem:   "acceptor",
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(MessageCount, "acceptor"),
 			Name:        MessageCount,
 			Help:        "the current number of processed message",
 			ConstLabels: constLabels,
 		},
-		additionalLabelsKeys,
+		p.labelKeys(nil),
 	)
 
 	p.countReportersMap[ExceededRateLimiting] = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Namespace:   "nano",
-			Subsystem:   "acceptor",
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ExceededRateLimiting, "acceptor"),
 			Name:        ExceededRateLimiting,
 			Help:        "the number of blocked requests by exceeded rate limiting",
 			ConstLabels: constLabels,
 		},
-		additionalLabelsKeys,
+		p.labelKeys(nil),
+	)
+
+	p.countReportersMap[SessionKicked] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(SessionKicked, "acceptor"),
+			Name:        SessionKicked,
+			Help:        "the number of sessions kicked by the server",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"reason"}),
+	)
+
+	p.countReportersMap[SessionClosed] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(SessionClosed, "session"),
+			Name:        SessionClosed,
+			Help:        "the number of sessions closed, labeled by the close reason",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"reason"}),
+	)
+
+	p.countReportersMap[ConnectionsRejected] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ConnectionsRejected, "acceptor"),
+			Name:        ConnectionsRejected,
+			Help:        "the number of connections refused by the server",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"reason"}),
+	)
+
+	p.gaugeReportersMap[ActiveSessions] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ActiveSessions, "acceptor"),
+			Name:        ActiveSessions,
+			Help:        "the number of client sessions served right now",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.gaugeReportersMap[MaxSessions] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(MaxSessions, "acceptor"),
+			Name:        MaxSessions,
+			Help:        "the limit of client sessions, zero means unlimited",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.countReportersMap[ReceivedBytes] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ReceivedBytes, "acceptor"),
+			Name:        ReceivedBytes,
+			Help:        "the number of bytes received from clients",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"transport"}),
+	)
+
+	p.countReportersMap[SentBytes] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(SentBytes, "acceptor"),
+			Name:        SentBytes,
+			Help:        "the number of bytes sent to clients",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"transport"}),
+	)
+
+	p.countReportersMap[RateLimiterBackendErrors] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(RateLimiterBackendErrors, "ratelimiter"),
+			Name:        RateLimiterBackendErrors,
+			Help:        "the number of errors of the distributed rate limiter backend",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.countReportersMap[ShadowDiff] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ShadowDiff, "handler"),
+			Name:        ShadowDiff,
+			Help:        "the number of shadow handler responses differ from the handler responses",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route"}),
+	)
+
+	p.gaugeReportersMap[InflightHandlers] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(InflightHandlers, "handler"),
+			Name:        InflightHandlers,
+			Help:        "the number of handlers dispatched but not completed",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.gaugeReportersMap[ClusterMembers] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ClusterMembers, ""),
+			Name:        ClusterMembers,
+			Help:        "the number of known cluster members",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"server_type"}),
+	)
+
+	p.gaugeReportersMap[ClusterMemberUp] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ClusterMemberUp, ""),
+			Name:        ClusterMemberUp,
+			Help:        "whether the cluster member is alive, 1 for up and 0 for down",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"server_id", "server_type"}),
+	)
+
+	p.countReportersMap[RoutingFailures] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(RoutingFailures, ""),
+			Name:        RoutingFailures,
+			Help:        "the number of messages which cannot be routed since there is no available backend",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"server_type"}),
+	)
+
+	p.countReportersMap[DuplicateLogins] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(DuplicateLogins, "session"),
+			Name:        DuplicateLogins,
+			Help:        "the number of sessions bound to a uid which has been bound to another session",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"policy"}),
+	)
+
+	p.countReportersMap[ResponseCacheHits] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ResponseCacheHits, "handler"),
+			Name:        ResponseCacheHits,
+			Help:        "the number of requests responded from the response cache",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route"}),
+	)
+
+	p.countReportersMap[ResponseCacheMisses] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ResponseCacheMisses, "handler"),
+			Name:        ResponseCacheMisses,
+			Help:        "the number of requests not found in the response cache",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route"}),
+	)
+
+	p.countReportersMap[ReliableResends] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ReliableResends, "session"),
+			Name:        ReliableResends,
+			Help:        "the number of reliable pushes resent since they have not been acknowledged in time",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route"}),
+	)
+
+	p.countReportersMap[ReliableGiveUps] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ReliableGiveUps, "session"),
+			Name:        ReliableGiveUps,
+			Help:        "the number of reliable pushes not acknowledged after all retries",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route"}),
+	)
+
+	p.countReportersMap[RPCFallbacks] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(RPCFallbacks, "handler"),
+			Name:        RPCFallbacks,
+			Help:        "the number of failed or timed out rpcs answered by the fallback",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route"}),
+	)
+
+	p.countReportersMap[AffinityMisses] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(AffinityMisses, "handler"),
+			Name:        AffinityMisses,
+			Help:        "the number of requests routed away from the affine member after re-balance",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"service"}),
+	)
+
+	p.countReportersMap[ProcessedMessages] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ProcessedMessages, "handler"),
+			Name:        ProcessedMessages,
+			Help:        "the number of messages processed by the handlers",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route"}),
+	)
+
+	p.countReportersMap[HandlerErrors] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(HandlerErrors, "handler"),
+			Name:        HandlerErrors,
+			Help:        "the number of handler invocations returning an error",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route", "code"}),
+	)
+
+	p.countReportersMap[DroppedMessages] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(DroppedMessages, "handler"),
+			Name:        DroppedMessages,
+			Help:        "the number of messages dropped before reaching the handlers",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route", "reason"}),
+	)
+
+	p.gaugeReportersMap[SchedulerQueueLength] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(SchedulerQueueLength, "handler"),
+			Name:        SchedulerQueueLength,
+			Help:        "the number of tasks waiting to be run by the scheduler",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.gaugeReportersMap[SendQueuePending] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(SendQueuePending, "session"),
+			Name:        SendQueuePending,
+			Help:        "the number of messages pending in the outbound queues of sessions",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.gaugeReportersMap[SendQueueSaturation] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(SendQueueSaturation, "session"),
+			Name:        SendQueueSaturation,
+			Help:        "the largest fraction of an outbound queue of a session occupied",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.summaryReportersMap[SendQueueDepth] = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(SendQueueDepth, "session"),
+			Name:        SendQueueDepth,
+			Help:        "the number of messages pending in the outbound queue of each session",
+			Objectives:  p.objectivesOr(map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}),
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.countReportersMap[SendQueueOverflows] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(SendQueueOverflows, "session"),
+			Name:        SendQueueOverflows,
+			Help:        "the number of messages pushed to a full outbound queue of a session",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"policy"}),
+	)
+
+	p.countReportersMap[CardinalityCollapsed] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(CardinalityCollapsed, ""),
+			Name:        CardinalityCollapsed,
+			Help:        "the number of reports whose label values are collapsed by the cardinality limit",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"metric"}),
+	)
+
+	p.gaugeReportersMap[ActiveGroups] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(ActiveGroups, "group"),
+			Name:        ActiveGroups,
+			Help:        "the number of groups created right now",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.summaryReportersMap[GroupMembers] = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(GroupMembers, "group"),
+			Name:        GroupMembers,
+			Help:        "the number of members of the groups",
+			Objectives:  p.objectivesOr(map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}),
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.gaugeReportersMap[BoundSessions] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(BoundSessions, "session"),
+			Name:        BoundSessions,
+			Help:        "the number of sessions bound to a uid",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.summaryReportersMap[SessionsPerUID] = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(SessionsPerUID, "session"),
+			Name:        SessionsPerUID,
+			Help:        "the number of sessions bound to the same uid",
+			Objectives:  p.objectivesOr(map[float64]float64{0.5: 0.05, 0.99: 0.001}),
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.gaugeReportersMap[WorkerPoolQueueDepth] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(WorkerPoolQueueDepth, "handler"),
+			Name:        WorkerPoolQueueDepth,
+			Help:        "the number of handlers queued for the worker pool",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.gaugeReportersMap[WorkerPoolUtilization] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(WorkerPoolUtilization, "handler"),
+			Name:        WorkerPoolUtilization,
+			Help:        "the fraction of workers of the worker pool running a handler",
+			ConstLabels: constLabels,
+		},
+		p.labelKeys(nil),
+	)
+
+	p.histogramsMap[MessageBytes] = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystemOf(MessageBytes, "handler"),
+			Name:        MessageBytes,
+			Help:        "the size of serialized message bodies in bytes",
+			Buckets:     p.bucketsOf(MessageBytes, MessageBytesBuckets),
+			ConstLabels: constLabels,
+		},
+		p.labelKeys([]string{"route", "direction"}),
 	)
 
 	toRegister := make([]prometheus.Collector, 0)
-	for _, c := range p.countReportersMap {
+	for name, c := range p.countReportersMap {
+		if !p.enabled(name) {
+			delete(p.countReportersMap, name)
+			continue
+		}
 		toRegister = append(toRegister, c)
 	}
 
-	for _, c := range p.gaugeReportersMap {
+	for name, c := range p.gaugeReportersMap {
+		if !p.enabled(name) {
+			delete(p.gaugeReportersMap, name)
+			continue
+		}
 		toRegister = append(toRegister, c)
 	}
 
-	for _, c := range p.summaryReportersMap {
+	for name, c := range p.summaryReportersMap {
+		if !p.enabled(name) {
+			delete(p.summaryReportersMap, name)
+			continue
+		}
+		toRegister = append(toRegister, c)
+	}
+
+	for name, c := range p.histogramsMap {
+		if !p.enabled(name) {
+			delete(p.histogramsMap, name)
+			continue
+		}
 		toRegister = append(toRegister, c)
 	}
 
-	prometheus.MustRegister(toRegister...)
+	for _, c := range toRegister {
+		if err := p.registerer.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelKeys returns the labels of a metric passing the label allowlist, followed
+// by the additional labels
+func (p *PrometheusReporter) labelKeys(labels []string) []string {
+	keys := make([]string, 0, len(labels)+len(p.additionalLabels))
+	for _, key := range labels {
+		if p.allowLabels == nil || p.allowLabels[key] {
+			keys = append(keys, key)
+		}
+	}
+	for key := range p.additionalLabels {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// subsystemOf returns the subsystem of a built-in metric overridden by
+// MetricsOptions, or the default subsystem if absent
+func (p *PrometheusReporter) subsystemOf(name, subsystem string) string {
+	if s, ok := p.subsystems[name]; ok {
+		return s
+	}
+	return subsystem
+}
+
+// objectivesOr returns the objectives of the built-in summaries set by
+// MetricsOptions, or defaults if absent
+func (p *PrometheusReporter) objectivesOr(defaults map[float64]float64) map[float64]float64 {
+	if len(p.objectives) > 0 {
+		return p.objectives
+	}
+	return defaults
+}
+
+// namespaceOrDefault returns the namespace of a custom metric, or the namespace
+// of reporter if absent
+func (p *PrometheusReporter) namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return p.namespace
+	}
+	return namespace
+}
+
+// registered returns whether a metric has been registered with the name
+func (p *PrometheusReporter) registered(name string) bool {
+	return p.countReportersMap[name] != nil || p.summaryReportersMap[name] != nil ||
+		p.gaugeReportersMap[name] != nil || p.histogramsMap[name] != nil
+}
+
+// registerCustom registers the collector of a custom metric to the registerer, and
+// then adds it to the metrics reported by add
+func (p *PrometheusReporter) registerCustom(name string, c prometheus.Collector, add func()) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.registered(name) {
+		return ErrMetricRegistered
+	}
+	if err := p.registerer.Register(c); err != nil {
+		return err
+	}
+	add()
+	return nil
+}
+
+// RegisterSummary registers a custom summary metric, which is reported by its name
+// via ReportSummary. The metric is named as namespace_subsystem_name, and the
+// namespace is the namespace of reporter if absent. The custom metrics are exposed
+// with the built-in metrics by the same registry, and can be registered at runtime,
+// the reports before registering are dropped. ErrMetricRegistered is returned if
+// the name has been registered, and the metrics filtered out by AllowMetrics or
+// DenyMetrics are not registered.
+func (p *PrometheusReporter) RegisterSummary(s Summary) error {
+	if !p.enabled(s.Name) {
+		return nil
+	}
+	vec := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:   p.namespaceOrDefault(s.Namespace),
+			Subsystem:   s.Subsystem,
+			Name:        s.Name,
+			Help:        s.Help,
+			Objectives:  s.Objectives,
+			ConstLabels: p.constLabels,
+		},
+		p.labelKeys(s.Labels),
+	)
+	return p.registerCustom(s.Name, vec, func() { p.summaryReportersMap[s.Name] = vec })
+}
+
+// RegisterHistogram registers a custom histogram metric, which is observed via
+// ReportHistogram or ReportSummary, see RegisterSummary
+func (p *PrometheusReporter) RegisterHistogram(h Histogram) error {
+	if !p.enabled(h.Name) {
+		return nil
+	}
+	buckets := h.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	vec := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   p.namespaceOrDefault(h.Namespace),
+			Subsystem:   h.Subsystem,
+			Name:        h.Name,
+			Help:        h.Help,
+			Buckets:     buckets,
+			ConstLabels: p.constLabels,
+		},
+		p.labelKeys(h.Labels),
+	)
+	return p.registerCustom(h.Name, vec, func() {
+		if p.histogramsMap == nil {
+			p.histogramsMap = make(map[string]*prometheus.HistogramVec)
+		}
+		p.histogramsMap[h.Name] = vec
+	})
+}
+
+// RegisterGauge registers a custom gauge metric, see RegisterSummary
+func (p *PrometheusReporter) RegisterGauge(g Gauge) error {
+	if !p.enabled(g.Name) {
+		return nil
+	}
+	vec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   p.namespaceOrDefault(g.Namespace),
+			Subsystem:   g.Subsystem,
+			Name:        g.Name,
+			Help:        g.Help,
+			ConstLabels: p.constLabels,
+		},
+		p.labelKeys(g.Labels),
+	)
+	return p.registerCustom(g.Name, vec, func() { p.gaugeReportersMap[g.Name] = vec })
+}
+
+// RegisterCounter registers a custom counter metric, see RegisterSummary
+func (p *PrometheusReporter) RegisterCounter(c Counter) error {
+	if !p.enabled(c.Name) {
+		return nil
+	}
+	vec := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   p.namespaceOrDefault(c.Namespace),
+			Subsystem:   c.Subsystem,
+			Name:        c.Name,
+			Help:        c.Help,
+			ConstLabels: p.constLabels,
+		},
+		p.labelKeys(c.Labels),
+	)
+	return p.registerCustom(c.Name, vec, func() { p.countReportersMap[c.Name] = vec })
 }
 
-// GetPrometheusReporter gets the prometheus reporter singleton
+// NewPrometheusReporter creates a prometheus reporter whose metrics are named
+// under namespace and registered to registerer. The namespace defaults to
+// DefaultNamespace and the registerer defaults to prometheus.DefaultRegisterer,
+// so several reporters can coexist in one process with different namespaces
+// or registries. The caller is responsible for exposing the registry. The metrics
+// registered can be filtered by AllowMetrics and DenyMetrics.
+func NewPrometheusReporter(
+	namespace string,
+	game string,
+	serverType string,
+	constLabels map[string]string,
+	registerer prometheus.Registerer,
+	opts ...PrometheusOption,
+) (*PrometheusReporter, error) {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	labels := make(map[string]string, len(constLabels)+2)
+	for k, v := range constLabels {
+		labels[k] = v
+	}
+
+	p := &PrometheusReporter{
+		namespace:           namespace,
+		serverType:          serverType,
+		game:                game,
+		countReportersMap:   make(map[string]*prometheus.CounterVec),
+		summaryReportersMap: make(map[string]*prometheus.SummaryVec),
+		gaugeReportersMap:   make(map[string]*prometheus.GaugeVec),
+		histogramsMap:       make(map[string]*prometheus.HistogramVec),
+		registerer:          registerer,
+		handlerOpts: promhttp.HandlerOpts{
+			ErrorHandling:       promhttp.ContinueOnError,
+			MaxRequestsInFlight: DefaultScrapeMaxInFlight,
+			Timeout:             DefaultScrapeTimeout,
+		},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if err := p.registerMetrics(labels, make(map[string]string)); err != nil {
+		return nil, err
+	}
+	if p.pushConfig != nil {
+		p.startPush()
+	}
+	return p, nil
+}
+
+// GetPrometheusReporter gets the prometheus reporter singleton, which is
+// registered to a private registry under DefaultNamespace and exposed at /metrics
+// on port by a dedicated HTTP server, the bind address can be customized by
+// WithListenAddr and the metrics can be served over HTTPS by WithTLS. The naming
+// of the metrics can be customized by WithMetricsOptions. The server
+// is stopped by Close, and a new singleton is created on the next call.
 func GetPrometheusReporter(
 	port int,
 	game string,
 	serverType string,
 	constLabels map[string]string,
+	opts ...PrometheusOption,
 ) (*PrometheusReporter, error) {
-	var (
-		additionalLabels = make(map[string]string)
-	)
+	singletonMu.Lock()
+	defer singletonMu.Unlock()
+	if prometheusReporter != nil {
+		return prometheusReporter, nil
+	}
+
+	opts = append([]PrometheusOption{WithListenAddr(fmt.Sprintf(":%d", port))}, opts...)
+	p, err := NewPrometheusReporter(DefaultNamespace, game, serverType, constLabels, prometheus.NewRegistry(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Start(); err != nil {
+		p.stopPush()
+		return nil, err
+	}
+	prometheusReporter = p
+	return p, nil
+}
 
-	once.Do(func() {
-		prometheusReporter = &PrometheusReporter{
-			serverType:          serverType,
-			game:                game,
-			countReportersMap:   make(map[string]*prometheus.CounterVec),
-			summaryReportersMap: make(map[string]*prometheus.SummaryVec),
-			gaugeReportersMap:   make(map[string]*prometheus.GaugeVec),
+// Start binds the listen address set by WithListenAddr, a random port is picked
+// if absent, and then exposes the metrics at /metrics by a dedicated HTTP server
+// in background. The liveness and readiness probes are served at /healthz and
+// /readyz, see HealthChecker. The bind errors are returned, the server is stopped
+// by Close.
+func (p *PrometheusReporter) Start() error {
+	p.serverMu.Lock()
+	defer p.serverMu.Unlock()
+	if p.server != nil {
+		return ErrServerStarted
+	}
+
+	ln, err := net.Listen("tcp", p.listenAddr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", p.handler())
+	mux.Handle("/healthz", p.healthHandler(p.livenessChecks))
+	mux.Handle("/readyz", p.healthHandler(p.readinessChecks))
+	server := &http.Server{Handler: mux}
+	p.server, p.listener = server, ln
+
+	go func() {
+		var err error
+		if p.certFile != "" || p.keyFile != "" {
+			err = server.ServeTLS(ln, p.certFile, p.keyFile)
+		} else {
+			err = server.Serve(ln)
 		}
-		prometheusReporter.registerMetrics(constLabels, additionalLabels)
-		http.Handle("/metrics", promhttp.Handler())
-		go (func() {
-			log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
-		})()
-	})
+		if err != nil && err != http.ErrServerClosed {
+			log.Println("Metrics server stopped", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the metrics HTTP server listens on, or nil if the
+// server is not started
+func (p *PrometheusReporter) Addr() net.Addr {
+	p.serverMu.Lock()
+	defer p.serverMu.Unlock()
+	if p.listener == nil {
+		return nil
+	}
+	return p.listener.Addr()
+}
 
-	return prometheusReporter, nil
+// Close stops the metrics HTTP server gracefully, the scrapes in progress are
+// waited for until DefaultShutdownTimeout. The metrics are pushed once more if
+// the push mode is enabled by WithPushGateway, which is stopped after closed. The
+// server can be started again after closed, and Close is a no-op if the server
+// is not started.
+func (p *PrometheusReporter) Close() error {
+	singletonMu.Lock()
+	if prometheusReporter == p {
+		prometheusReporter = nil
+	}
+	singletonMu.Unlock()
+
+	pushErr := p.stopPush()
+
+	p.serverMu.Lock()
+	server := p.server
+	p.server, p.listener = nil, nil
+	p.serverMu.Unlock()
+	if server == nil {
+		return pushErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	return pushErr
 }
 
-// ReportSummary reports a summary metric
+// handler returns the http handler which exposes the metrics of reporter
+func (p *PrometheusReporter) handler() http.Handler {
+	g, ok := p.registerer.(prometheus.Gatherer)
+	if !ok {
+		g = prometheus.DefaultGatherer
+	}
+	return promhttp.HandlerFor(g, p.handlerOpts)
+}
+
+// ReportSummary reports a summary metric, the metrics exposed as histograms, e.g:
+// MessageBytes, are observed into their buckets
 func (p *PrometheusReporter) ReportSummary(metric string, labels map[string]string, value float64) error {
-	sum := p.summaryReportersMap[metric]
+	p.mu.RLock()
+	h, sum := p.histogramsMap[metric], p.summaryReportersMap[metric]
+	p.mu.RUnlock()
+	if h != nil {
+		labels = p.limitCardinality(metric, p.ensureLabels(labels))
+		h.With(labels).Observe(value)
+		return nil
+	}
 	if sum != nil {
-		labels = p.ensureLabels(labels)
+		labels = p.limitCardinality(metric, p.ensureLabels(labels))
 		sum.With(labels).Observe(value)
 		return nil
 	}
 	return nil
 }
 
+// ReportHistogram implements the HistogramReporter interface, which observes the
+// value into the buckets of a histogram metric, e.g: MessageBytes or the histograms
+// registered by RegisterHistogram
+func (p *PrometheusReporter) ReportHistogram(metric string, labels map[string]string, value float64) error {
+	p.mu.RLock()
+	h := p.histogramsMap[metric]
+	p.mu.RUnlock()
+	if h != nil {
+		labels = p.limitCardinality(metric, p.ensureLabels(labels))
+		h.With(labels).Observe(value)
+	}
+	return nil
+}
+
 // ReportCount reports a summary metric
 func (p *PrometheusReporter) ReportCount(metric string, labels map[string]string, count float64) error {
+	p.mu.RLock()
 	cnt := p.countReportersMap[metric]
+	p.mu.RUnlock()
 	if cnt != nil {
-		labels = p.ensureLabels(labels)
+		labels = p.limitCardinality(metric, p.ensureLabels(labels))
 		cnt.With(labels).Add(count)
 		return nil
 	}
@@ -245,18 +1256,76 @@ func (p *PrometheusReporter) ReportCount(metric string, labels map[string]string
 
 // ReportGauge reports a gauge metric
 func (p *PrometheusReporter) ReportGauge(metric string, labels map[string]string, value float64) error {
+	p.mu.RLock()
 	g := p.gaugeReportersMap[metric]
+	p.mu.RUnlock()
 	if g != nil {
-		labels = p.ensureLabels(labels)
+		labels = p.limitCardinality(metric, p.ensureLabels(labels))
 		g.With(labels).Set(value)
 		return nil
 	}
 	return nil
 }
 
+// limitCardinality returns the labels whose values are collapsed to
+// CollapsedLabelValue if the combination is new and the metric has reached
+// the cardinality limit, the additional labels are never collapsed
+func (p *PrometheusReporter) limitCardinality(metric string, labels map[string]string) map[string]string {
+	if p.maxCardinality <= 0 || metric == CardinalityCollapsed {
+		return labels
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for key, val := range labels {
+		pairs = append(pairs, key+"="+val)
+	}
+	sort.Strings(pairs)
+	combination := strings.Join(pairs, ",")
+
+	p.cardinalityMu.Lock()
+	if p.combinations == nil {
+		p.combinations = map[string]map[string]bool{}
+	}
+	seen := p.combinations[metric]
+	if seen == nil {
+		seen = map[string]bool{}
+		p.combinations[metric] = seen
+	}
+	if seen[combination] || len(seen) < p.maxCardinality {
+		seen[combination] = true
+		p.cardinalityMu.Unlock()
+		return labels
+	}
+	p.cardinalityMu.Unlock()
+
+	collapsed := make(map[string]string, len(labels))
+	for key, val := range labels {
+		if _, ok := p.additionalLabels[key]; ok {
+			collapsed[key] = val
+			continue
+		}
+		collapsed[key] = CollapsedLabelValue
+	}
+	p.ReportCount(CardinalityCollapsed, map[string]string{"metric": metric}, 1)
+	return collapsed
+}
+
 // ensureLabels checks if labels contains the additionalLabels values,
-// otherwise adds them with the default values
+// otherwise adds them with the default values. The labels not in the allowlist
+// are dropped from a copy, since the labels may be reported to other reporters.
 func (p *PrometheusReporter) ensureLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string, len(p.additionalLabels))
+	}
+	if p.allowLabels != nil {
+		allowed := make(map[string]string, len(labels))
+		for key, val := range labels {
+			if _, ok := p.additionalLabels[key]; ok || p.allowLabels[key] {
+				allowed[key] = val
+			}
+		}
+		labels = allowed
+	}
 	for key, defaultVal := range p.additionalLabels {
 		if _, ok := labels[key]; !ok {
 			labels[key] = defaultVal
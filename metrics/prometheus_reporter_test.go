@@ -0,0 +1,449 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestPrometheusReporter_CustomMetricNamespace(t *testing.T) {
+	p := &PrometheusReporter{
+		namespace:           DefaultNamespace,
+		countReportersMap:   make(map[string]*prometheus.CounterVec),
+		summaryReportersMap: make(map[string]*prometheus.SummaryVec),
+		gaugeReportersMap:   make(map[string]*prometheus.GaugeVec),
+		constLabels:         map[string]string{"game": "mygame"},
+		additionalLabels:    map[string]string{"region": "eu"},
+		registerer:          prometheus.NewRegistry(),
+	}
+	err := p.RegisterCounter(Counter{
+		Namespace: "mygame",
+		Subsystem: "matchmaking",
+		Name:      "queued_total",
+		Help:      "the number of players queued",
+		Labels:    []string{"mode"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RegisterGauge(Gauge{Subsystem: "matchmaking", Name: "rooms", Help: "the number of rooms"}); err != nil {
+		t.Fatal(err)
+	}
+	p.ReportCount("queued_total", map[string]string{"mode": "ranked"}, 1)
+	p.ReportGauge("rooms", map[string]string{}, 3)
+
+	rec := httptest.NewRecorder()
+	p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var queued, rooms string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		switch {
+		case strings.HasPrefix(line, "mygame_matchmaking_queued_total{"):
+			queued = line
+		case strings.HasPrefix(line, "nano_matchmaking_rooms{"):
+			rooms = line
+		}
+	}
+	for _, label := range []string{`game="mygame"`, `region="eu"`, `mode="ranked"`} {
+		if !strings.Contains(queued, label) {
+			t.Fatalf("expect label %s in: %q", label, queued)
+		}
+	}
+	if !strings.Contains(rooms, `game="mygame"`) || !strings.Contains(rooms, `region="eu"`) {
+		t.Fatalf("expect the metric in default namespace with labels, got: %q", rooms)
+	}
+}
+
+func TestNewPrometheusReporter_Namespaces(t *testing.T) {
+	lobby, err := NewPrometheusReporter("lobby", "mygame", "connector", nil, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same metrics can be registered to another registry under another namespace
+	battle, err := NewPrometheusReporter("battle", "mygame", "connector", nil, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lobby.ReportGauge(ConnectedClients, map[string]string{"transport": "tcp"}, 3)
+	battle.ReportGauge(ConnectedClients, map[string]string{"transport": "tcp"}, 5)
+
+	for _, c := range []struct {
+		p      *PrometheusReporter
+		prefix string
+		other  string
+	}{
+		{lobby, "lobby_", "battle_"},
+		{battle, "battle_", "lobby_"},
+	} {
+		rec := httptest.NewRecorder()
+		c.p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body := rec.Body.String()
+		if !strings.Contains(body, c.prefix+"acceptor_connected_clients{") {
+			t.Fatalf("expect metrics under namespace %q, got: %q", c.prefix, body)
+		}
+		if strings.Contains(body, c.other) {
+			t.Fatalf("unexpected metrics of namespace %q in: %q", c.other, body)
+		}
+	}
+
+	// Registering the same namespace to the same registry twice fails
+	reg := prometheus.NewRegistry()
+	if _, err := NewPrometheusReporter("", "mygame", "connector", nil, reg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPrometheusReporter("", "mygame", "connector", nil, reg); err == nil {
+		t.Fatal("expect an error on duplicate registration")
+	}
+}
+
+func TestNewPrometheusReporter_AllowMetrics(t *testing.T) {
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry(), AllowMetrics(ConnectedClients))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reporting to the metrics filtered out is a no-op
+	if err := p.ReportGauge(ConnectedClients, map[string]string{"transport": "tcp"}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ReportGauge(Goroutines, map[string]string{}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ReportSummary(ResponseTime, map[string]string{"route": "Room.Join"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ReportCount(DuplicateLogins, map[string]string{"policy": "kick_old"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RegisterCounter(Counter{Name: "queued_total", Help: "the number of players queued"}); err != nil {
+		t.Fatal(err)
+	}
+	p.ReportCount("queued_total", map[string]string{}, 1)
+
+	rec := httptest.NewRecorder()
+	p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	exposed := 0
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "nano_acceptor_connected_clients{") {
+			t.Fatalf("unexpected metric: %q", line)
+		}
+		exposed++
+	}
+	if exposed != 1 {
+		t.Fatalf("expect: 1 series exposed, got: %d", exposed)
+	}
+}
+
+func TestNewPrometheusReporter_DenyMetrics(t *testing.T) {
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry(),
+		AllowMetrics(ConnectedClients, ResponseTime), DenyMetrics(ResponseTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.summaryReportersMap[ResponseTime]; ok {
+		t.Fatal("expect the denied metric not to be registered")
+	}
+	if _, ok := p.gaugeReportersMap[ConnectedClients]; !ok {
+		t.Fatal("expect the allowed metric to be registered")
+	}
+}
+
+func TestPrometheusReporter_MessageBytesHistogram(t *testing.T) {
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ReportMessageBytes([]Reporter{p}, "Room.Join", DirectionIn, 100)
+	ReportMessageBytes([]Reporter{p}, "Room.Join", DirectionIn, 3000)
+	ReportMessageBytes([]Reporter{p}, "Room.Join", DirectionOut, 200000)
+
+	rec := httptest.NewRecorder()
+	p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, series := range []string{
+		`nano_handler_message_bytes_bucket{direction="in",game="mygame",route="Room.Join",serverType="connector",le="256"} 1`,
+		`nano_handler_message_bytes_bucket{direction="in",game="mygame",route="Room.Join",serverType="connector",le="4096"} 2`,
+		`nano_handler_message_bytes_bucket{direction="out",game="mygame",route="Room.Join",serverType="connector",le="65536"} 0`,
+		`nano_handler_message_bytes_bucket{direction="out",game="mygame",route="Room.Join",serverType="connector",le="262144"} 1`,
+		`nano_handler_message_bytes_sum{direction="in",game="mygame",route="Room.Join",serverType="connector"} 3100`,
+	} {
+		if !strings.Contains(body, series) {
+			t.Fatalf("expect series %s in:\n%s", series, body)
+		}
+	}
+}
+
+func TestPrometheusReporter_HandlerOpts(t *testing.T) {
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := p.handlerOpts; o.MaxRequestsInFlight != DefaultScrapeMaxInFlight || o.Timeout != DefaultScrapeTimeout ||
+		o.ErrorHandling != promhttp.ContinueOnError {
+		t.Fatalf("expect the bounded defaults, got: %+v", o)
+	}
+
+	opts := promhttp.HandlerOpts{ErrorHandling: promhttp.HTTPErrorOnError, MaxRequestsInFlight: 1, Timeout: time.Second}
+	p, err = NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry(), WithHandlerOpts(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := p.handlerOpts; o.MaxRequestsInFlight != 1 || o.Timeout != time.Second || o.ErrorHandling != promhttp.HTTPErrorOnError {
+		t.Fatalf("expect: %+v, got: %+v", opts, p.handlerOpts)
+	}
+	p.ReportGauge(ConnectedClients, map[string]string{"transport": "tcp"}, 3)
+	rec := httptest.NewRecorder()
+	p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "nano_acceptor_connected_clients{") {
+		t.Fatalf("expect the metrics exposed, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestPrometheusReporter_RegisterCustomMetrics(t *testing.T) {
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the business metrics are registered at runtime and served with the built-in ones
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.ReportSummary("gold_spent", map[string]string{"item": "potion"}, 10)
+		}
+	}()
+	err = p.RegisterHistogram(Histogram{
+		Subsystem: "economy",
+		Name:      "gold_spent",
+		Help:      "the gold spent per purchase",
+		Buckets:   []float64{10, 100},
+		Labels:    []string{"item"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if err := p.RegisterCounter(Counter{Subsystem: "match", Name: "matches_started_total"}); err != nil {
+		t.Fatal(err)
+	}
+	p.ReportSummary("gold_spent", map[string]string{"item": "sword"}, 50)
+	p.ReportCount("matches_started_total", nil, 1)
+	p.ReportGauge(ConnectedClients, map[string]string{"transport": "tcp"}, 3)
+
+	// the metrics are reported by name, so the names can not be registered twice
+	if err := p.RegisterGauge(Gauge{Namespace: "mygame", Name: ConnectedClients}); err != ErrMetricRegistered {
+		t.Fatalf("expect: %v, got: %v", ErrMetricRegistered, err)
+	}
+
+	rec := httptest.NewRecorder()
+	p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, series := range []string{
+		`nano_economy_gold_spent_bucket{game="mygame",item="sword",serverType="connector",le="100"} 1`,
+		`nano_match_matches_started_total{game="mygame",serverType="connector"} 1`,
+		`nano_acceptor_connected_clients{game="mygame",serverType="connector",transport="tcp"} 3`,
+	} {
+		if !strings.Contains(body, series) {
+			t.Fatalf("expect series %s in:\n%s", series, body)
+		}
+	}
+}
+
+func TestPrometheusReporter_StartClose(t *testing.T) {
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry(), WithListenAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Addr() != nil {
+		t.Fatalf("expect no address before started, got: %v", p.Addr())
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != ErrServerStarted {
+		t.Fatalf("expect: %v, got: %v", ErrServerStarted, err)
+	}
+	addr := p.Addr().String()
+	p.ReportGauge(ConnectedClients, map[string]string{"transport": "tcp"}, 3)
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `nano_acceptor_connected_clients{game="mygame",serverType="connector",transport="tcp"} 3`) {
+		t.Fatalf("unexpected metrics:\n%s", body)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get("http://" + addr + "/metrics"); err == nil {
+		t.Fatal("expect the metrics server to be stopped")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bind errors are returned rather than exiting the process
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	WithListenAddr(ln.Addr().String())(p)
+	if err := p.Start(); err == nil {
+		p.Close()
+		t.Fatal("expect the bind error")
+	}
+}
+
+func TestGetPrometheusReporter_Close(t *testing.T) {
+	p, err := GetPrometheusReporter(0, "mygame", "connector", nil, WithListenAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, _ := GetPrometheusReporter(0, "mygame", "connector", nil); same != p {
+		t.Fatal("expect the singleton")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the metrics are registered to a private registry, so the singleton can be
+	// created again after closed
+	p2, err := GetPrometheusReporter(0, "mygame", "connector", nil, WithListenAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	if p2 == p {
+		t.Fatal("expect a new reporter after closed")
+	}
+}
+
+func TestPrometheusReporter_TimingHistograms(t *testing.T) {
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry(),
+		TimingHistograms(), HistogramBuckets(ProcessDelay, []float64{1e6, 1e9}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.summaryReportersMap[ResponseTime] != nil || p.summaryReportersMap[ProcessDelay] != nil {
+		t.Fatal("expect the timings not to be summaries")
+	}
+
+	// the timings reported by ReportTiming are observed into the buckets as well
+	ReportTiming(time.Now().UnixNano(), []Reporter{p}, "Room.Join")
+	p.ReportHistogram(ProcessDelay, map[string]string{"route": "Room.Join"}, 2e6)
+	p.ReportHistogram(ConnectedClients, nil, 1)
+
+	rec := httptest.NewRecorder()
+	p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, series := range []string{
+		`nano_handler_response_time_ns_bucket{game="mygame",route="Room.Join",serverType="connector",le="1e+10"} 1`,
+		`nano_handler_handler_delay_ns_bucket{game="mygame",route="Room.Join",serverType="connector",le="1e+06"} 0`,
+		`nano_handler_handler_delay_ns_bucket{game="mygame",route="Room.Join",serverType="connector",le="1e+09"} 1`,
+	} {
+		if !strings.Contains(body, series) {
+			t.Fatalf("expect series %s in:\n%s", series, body)
+		}
+	}
+	if strings.Contains(body, "nano_acceptor_connected_clients") {
+		t.Fatalf("expect gauges not to be observed as histograms:\n%s", body)
+	}
+}
+
+func TestPrometheusReporter_MetricsOptions(t *testing.T) {
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry(), WithMetricsOptions(MetricsOptions{
+		Namespace:  "legacy",
+		Subsystems: map[string]string{ResponseTime: "rpc", ConnectedClients: ""},
+		Objectives: map[float64]float64{0.5: 0.05},
+		Labels:     []string{"transport"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := map[string]string{"route": "Room.Join"}
+	p.ReportSummary(ResponseTime, tags, 1e6)
+	if tags["route"] != "Room.Join" {
+		t.Fatal("expect the labels of caller untouched")
+	}
+	p.ReportGauge(ConnectedClients, map[string]string{"transport": "tcp"}, 3)
+	if err := p.RegisterCounter(Counter{Name: "matches_total", Labels: []string{"mode"}}); err != nil {
+		t.Fatal(err)
+	}
+	p.ReportCount("matches_total", map[string]string{"mode": "ranked"}, 1)
+
+	rec := httptest.NewRecorder()
+	p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, series := range []string{
+		`legacy_rpc_response_time_ns_sum{game="mygame",serverType="connector"} 1e+06`,
+		`legacy_connected_clients{game="mygame",serverType="connector",transport="tcp"} 3`,
+		`legacy_matches_total{game="mygame",serverType="connector"} 1`,
+	} {
+		if !strings.Contains(body, series) {
+			t.Fatalf("expect series %s in:\n%s", series, body)
+		}
+	}
+}
+
+func TestPrometheusReporter_MaxCardinality(t *testing.T) {
+	p, err := NewPrometheusReporter("", "mygame", "connector", nil, prometheus.NewRegistry(), MaxCardinality(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range []string{"Room.Join", "Room.Leave", "Room.Join", "x1", "x2", "x3"} {
+		p.ReportCount(ShadowDiff, map[string]string{"route": route}, 1)
+	}
+
+	rec := httptest.NewRecorder()
+	p.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, series := range []string{
+		`nano_handler_shadow_diff_total{game="mygame",route="Room.Join",serverType="connector"} 2`,
+		`nano_handler_shadow_diff_total{game="mygame",route="Room.Leave",serverType="connector"} 1`,
+		`nano_handler_shadow_diff_total{game="mygame",route="other",serverType="connector"} 3`,
+		`nano_cardinality_collapsed_total{game="mygame",metric="shadow_diff_total",serverType="connector"} 3`,
+	} {
+		if !strings.Contains(body, series) {
+			t.Fatalf("expect series %s in:\n%s", series, body)
+		}
+	}
+	if strings.Contains(body, `route="x1"`) {
+		t.Fatalf("expect the routes beyond the limit collapsed:\n%s", body)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"log"
+	"time"
+)
+
+// DefaultPushInterval is the default interval of pushing metrics to the pushgateway
+const DefaultPushInterval = 15 * time.Second
+
+// PushConfig configures the push mode of the prometheus reporter, which pushes the
+// metrics to a pushgateway periodically rather than being scraped, e.g: for the
+// short-lived servers which are gone before being scraped
+type PushConfig struct {
+	Gateway  string        // address of pushgateway, e.g: http://pushgateway:9091
+	Job      string        // job name of the pushed metrics, "nano" by default
+	Instance string        // instance label of the pushed metrics, e.g: the pod name
+	Interval time.Duration // DefaultPushInterval will be used if zero
+	Timeout  time.Duration // DefaultFlushTimeout will be used if zero
+}
+
+// WithPushGateway enables the push mode, the metrics are pushed to the pushgateway
+// every interval, and once more when the reporter is closed
+func WithPushGateway(cfg PushConfig) PrometheusOption {
+	return func(p *PrometheusReporter) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = DefaultPushInterval
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = DefaultFlushTimeout
+		}
+		p.pushConfig = &cfg
+	}
+}
+
+// Push pushes the current metrics to the pushgateway configured by WithPushGateway
+func (p *PrometheusReporter) Push() error {
+	if p.pushConfig == nil {
+		return nil
+	}
+	cfg := p.pushConfig
+	data, contentType := p.gather()
+	return p.push(cfg.Gateway, cfg.Job, cfg.Instance, data, contentType, cfg.Timeout)
+}
+
+// startPush pushes the metrics periodically until stopPush is called
+func (p *PrometheusReporter) startPush() {
+	p.pushDie = make(chan struct{})
+	p.pushDone = make(chan struct{})
+	go func() {
+		defer close(p.pushDone)
+		ticker := time.NewTicker(p.pushConfig.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.Push(); err != nil {
+					log.Println("Push metrics failed", err)
+				}
+			case <-p.pushDie:
+				return
+			}
+		}
+	}()
+}
+
+// stopPush stops pushing periodically, and then pushes the final metrics
+func (p *PrometheusReporter) stopPush() error {
+	if p.pushDie == nil {
+		return nil
+	}
+	var err error
+	p.pushStop.Do(func() {
+		close(p.pushDie)
+		<-p.pushDone
+		err = p.Push()
+	})
+	return err
+}
@@ -0,0 +1,102 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pushgateway records the pushes
+type pushgateway struct {
+	mu     sync.Mutex
+	paths  []string
+	bodies []string
+	pushed chan struct{}
+}
+
+func (g *pushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	g.mu.Lock()
+	g.paths = append(g.paths, r.Method+" "+r.URL.EscapedPath())
+	g.bodies = append(g.bodies, string(body))
+	g.mu.Unlock()
+	select {
+	case g.pushed <- struct{}{}:
+	default:
+	}
+}
+
+func TestPrometheusReporter_PushGateway(t *testing.T) {
+	g := &pushgateway{pushed: make(chan struct{}, 1)}
+	ts := httptest.NewServer(g)
+	defer ts.Close()
+
+	p, err := NewPrometheusReporter("", "mygame", "match", nil, prometheus.NewRegistry(), WithPushGateway(PushConfig{
+		Gateway:  ts.URL,
+		Job:      "match",
+		Instance: "match-0/abc",
+		Interval: 10 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-g.pushed:
+	case <-time.After(time.Second):
+		t.Fatal("expect the metrics to be pushed periodically")
+	}
+
+	// the metrics reported right before shutdown are pushed when closed
+	p.ReportCount(SessionKicked, map[string]string{"reason": "match_over"}, 1)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if expect := "PUT /metrics/job/match/instance/match-0%2Fabc"; g.paths[len(g.paths)-1] != expect {
+		t.Fatalf("expect: %s, got: %s", expect, g.paths[len(g.paths)-1])
+	}
+	if last := g.bodies[len(g.bodies)-1]; !strings.Contains(last, `reason="match_over"`) {
+		t.Fatalf("expect the final metrics pushed, got:\n%s", last)
+	}
+
+	// no more pushes after closed
+	n := len(g.paths)
+	g.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	g.mu.Lock()
+	if len(g.paths) != n {
+		t.Fatalf("expect no pushes after closed, got: %d", len(g.paths)-n)
+	}
+}
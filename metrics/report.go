@@ -1,7 +1,7 @@
 package metrics
 
 import (
-	"runtime"
+	"strconv"
 	"sync/atomic"
 	"time"
 )
@@ -22,6 +22,110 @@ var (
 	// ExceededRateLimiting reports the number of requests made in a connection
 	// after the rate limit was exceeded
 	ExceededRateLimiting = "exceeded_rate_limiting"
+	// SessionKicked reports the number of sessions kicked by the server, labeled by reason
+	SessionKicked = "session_kicked"
+	// SessionClosed reports the number of sessions closed, labeled by the close reason,
+	// e.g: disconnected or kicked
+	SessionClosed = "session_closed_total"
+	// ConnectionsRejected reports the number of connections refused by the server, labeled by reason
+	ConnectionsRejected = "connections_rejected_total"
+	// ActiveSessions reports the number of client sessions served right now
+	ActiveSessions = "active_sessions"
+	// MaxSessions reports the limit of client sessions, zero means unlimited
+	MaxSessions = "max_sessions"
+	// ReceivedBytes reports the number of bytes received from clients, labeled by transport
+	ReceivedBytes = "received_bytes"
+	// SentBytes reports the number of bytes sent to clients, labeled by transport
+	SentBytes = "sent_bytes"
+	// RateLimiterBackendErrors reports the number of errors of the distributed rate limiter backend
+	RateLimiterBackendErrors = "backend_errors_total"
+	// ShadowDiff reports the number of shadow handler responses differ from the
+	// handler responses, labeled by route
+	ShadowDiff = "shadow_diff_total"
+	// InflightHandlers reports the number of handlers dispatched but not completed
+	InflightHandlers = "inflight_handlers"
+	// ClusterMembers reports the number of known cluster members, labeled by server type
+	ClusterMembers = "cluster_members"
+	// ClusterMemberUp reports whether a cluster member is alive, labeled by server id and type
+	ClusterMemberUp = "cluster_member_up"
+	// RoutingFailures reports the number of messages which cannot be routed since there
+	// is no available backend, labeled by server type
+	RoutingFailures = "routing_failures_total"
+	// DuplicateLogins reports the number of sessions bound to a uid which has been
+	// bound to another session, labeled by the duplicate login policy
+	DuplicateLogins = "duplicate_login_total"
+	// ResponseCacheHits reports the number of requests responded from the response
+	// cache, labeled by route
+	ResponseCacheHits = "response_cache_hits_total"
+	// ResponseCacheMisses reports the number of requests not found in the response
+	// cache, labeled by route
+	ResponseCacheMisses = "response_cache_misses_total"
+	// ReliableResends reports the number of reliable pushes resent since they have
+	// not been acknowledged in time, labeled by route
+	ReliableResends = "reliable_push_resends_total"
+	// ReliableGiveUps reports the number of reliable pushes not acknowledged after
+	// all retries, whose sessions are closed, labeled by route
+	ReliableGiveUps = "reliable_push_giveups_total"
+	// RPCFallbacks reports the number of RPCs which are failed or timed out and
+	// answered by the fallback, labeled by route
+	RPCFallbacks = "rpc_fallback_total"
+	// MessageBytes reports the distribution of serialized message body sizes,
+	// labeled by route and direction, which is either DirectionIn or DirectionOut
+	MessageBytes = "message_bytes"
+	// AffinityMisses reports the number of requests routed to another member than the
+	// one the session was bound to since the members are re-balanced, labeled by service
+	AffinityMisses = "affinity_misses_total"
+	// WorkerPoolQueueDepth reports the number of handlers queued for the workers of
+	// the worker pool
+	WorkerPoolQueueDepth = "worker_pool_queue_depth"
+	// WorkerPoolUtilization reports the fraction of workers of the worker pool which
+	// are running a handler
+	WorkerPoolUtilization = "worker_pool_utilization"
+
+	// ProcessedMessages reports the number of messages processed by the handlers,
+	// labeled by route
+	ProcessedMessages = "processed_messages_total"
+	// HandlerErrors reports the number of handler invocations returning an error,
+	// labeled by route and the error code, which is returned by the Code() method
+	// of the error or 0 if absent
+	HandlerErrors = "handler_errors_total"
+	// DroppedMessages reports the number of messages dropped before reaching the
+	// handlers, labeled by route and reason
+	DroppedMessages = "dropped_messages_total"
+	// SchedulerQueueLength reports the number of tasks waiting to be run by the scheduler
+	SchedulerQueueLength = "scheduler_queue_length"
+	// SendQueuePending reports the number of messages pending in the outbound queues
+	// of all sessions
+	SendQueuePending = "send_queue_pending"
+	// SendQueueSaturation reports the largest fraction of an outbound queue of a session
+	// occupied, the writes of the session block if it reaches 1
+	SendQueueSaturation = "send_queue_saturation"
+	// SendQueueDepth reports the distribution of the number of messages pending in
+	// the outbound queue of each session
+	SendQueueDepth = "send_queue_depth"
+	// SendQueueOverflows reports the number of messages pushed to a full outbound
+	// queue of a session, labeled by the overflow policy applied
+	SendQueueOverflows = "send_queue_overflows_total"
+	// CardinalityCollapsed reports the number of reports whose label values are
+	// collapsed since the metric has reached the cardinality limit, labeled by metric
+	CardinalityCollapsed = "cardinality_collapsed_total"
+	// ActiveGroups reports the number of groups created right now
+	ActiveGroups = "active_groups"
+	// GroupMembers reports the distribution of the number of members of the groups
+	GroupMembers = "group_members"
+	// BoundSessions reports the number of sessions bound to a uid
+	BoundSessions = "bound_sessions"
+	// SessionsPerUID reports the distribution of the number of sessions bound to
+	// the same uid
+	SessionsPerUID = "sessions_per_uid"
+	// GCPause reports the durations of the stop-the-world pauses of GC in nanoseconds
+	GCPause = "gc_pause_ns"
+	// GCCount reports the number of completed GC cycles
+	GCCount = "gc_total"
+	// OpenConnections reports the number of client connections opened right now
+	OpenConnections = "open_connections"
+	// ProcessCPUSeconds reports the user and system CPU time spent by the process in seconds
+	ProcessCPUSeconds = "process_cpu_seconds_total"
 
 	//MetricsStartTime = "metrics_start_time"
 
@@ -29,12 +133,45 @@ var (
 	messageCount = int32(0)
 )
 
+// Directions of the messages reported by MessageBytes
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// MessageBytesBuckets are the buckets of MessageBytes, which range from 16 bytes
+// to 1 megabyte by a factor of 4
+var MessageBytesBuckets = []float64{16, 64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// TimingBuckets are the buckets of ResponseTime and ProcessDelay if they are emitted
+// as histograms, which range from 1 millisecond to 10 seconds in nanoseconds
+var TimingBuckets = []float64{1e6, 2.5e6, 5e6, 1e7, 2.5e7, 5e7, 1e8, 2.5e8, 5e8, 1e9, 2.5e9, 5e9, 1e10}
+
+// Reporter is a backend of the metrics, e.g: Prometheus or statsd. A node reports
+// to all of its reporters, and CompositeReporter fans out to multiple backends
+// behind a single reporter.
 type Reporter interface {
 	ReportCount(metric string, tags map[string]string, count float64) error
 	ReportSummary(metric string, tags map[string]string, value float64) error
 	ReportGauge(metric string, tags map[string]string, value float64) error
 }
 
+// HistogramReporter is implemented by the reporters which can observe values into
+// the buckets of histograms, whose distributions can be aggregated across instances
+// rather than summaries
+type HistogramReporter interface {
+	ReportHistogram(metric string, tags map[string]string, value float64) error
+}
+
+// ReportHistogram observes the value by the histogram of reporter, the value is
+// reported as a summary if reporter does not implement HistogramReporter
+func ReportHistogram(r Reporter, metric string, tags map[string]string, value float64) error {
+	if h, ok := r.(HistogramReporter); ok {
+		return h.ReportHistogram(metric, tags, value)
+	}
+	return r.ReportSummary(metric, tags, value)
+}
+
 func CountMessage() {
 	atomic.AddInt32(&messageCount, 1)
 }
@@ -63,31 +200,220 @@ func ReportMessageProcessDelay(start int64, reporters []Reporter, route string)
 	}
 }
 
+// ReportNumberOfConnectedClients reports the number of connected clients without transport.
+// Deprecated: use ReportConnectedClients instead.
 func ReportNumberOfConnectedClients(reporters []Reporter, number int64) {
+	ReportConnectedClients(reporters, "", number)
+}
+
+func ReportConnectedClients(reporters []Reporter, transport string, number int64) {
 	for _, r := range reporters {
-		r.ReportGauge(ConnectedClients, map[string]string{}, float64(number))
+		r.ReportGauge(ConnectedClients, map[string]string{"transport": transport}, float64(number))
 	}
 }
 
+// ReportSysMetrics reports the runtime metrics every period, which never returns.
+// Deprecated: use SysCollector instead, which can be stopped.
 func ReportSysMetrics(reporters []Reporter, period time.Duration) {
-	for {
-		for _, r := range reporters {
-			num := runtime.NumGoroutine()
-			m := &runtime.MemStats{}
-			runtime.ReadMemStats(m)
-
-			r.ReportGauge(Goroutines, map[string]string{}, float64(num))
-			r.ReportGauge(HeapSize, map[string]string{}, float64(m.Alloc))
-			r.ReportGauge(HeapObjects, map[string]string{}, float64(m.HeapObjects))
-			r.ReportGauge(MessageCount, map[string]string{}, float64(atomic.LoadInt32(&messageCount)))
+	NewSysCollector(reporters, period, nil).run()
+}
+
+func ReportExceededRateLimiting(reporters []Reporter) {
+	for _, r := range reporters {
+		r.ReportCount(ExceededRateLimiting, map[string]string{}, 1)
+	}
+}
+
+func ReportSessionKicked(reporters []Reporter, reason string) {
+	for _, r := range reporters {
+		r.ReportCount(SessionKicked, map[string]string{"reason": reason}, 1)
+	}
+}
+
+func ReportSessionClosed(reporters []Reporter, reason string) {
+	for _, r := range reporters {
+		r.ReportCount(SessionClosed, map[string]string{"reason": reason}, 1)
+	}
+}
+
+func ReportConnectionRejected(reporters []Reporter, reason string) {
+	for _, r := range reporters {
+		r.ReportCount(ConnectionsRejected, map[string]string{"reason": reason}, 1)
+	}
+}
+
+func ReportSessionCapacity(reporters []Reporter, active, max int64) {
+	for _, r := range reporters {
+		r.ReportGauge(ActiveSessions, map[string]string{}, float64(active))
+		r.ReportGauge(MaxSessions, map[string]string{}, float64(max))
+	}
+}
+
+func ReportReceivedBytes(reporters []Reporter, transport string, n int) {
+	for _, r := range reporters {
+		r.ReportCount(ReceivedBytes, map[string]string{"transport": transport}, float64(n))
+	}
+}
+
+func ReportSentBytes(reporters []Reporter, transport string, n int) {
+	for _, r := range reporters {
+		r.ReportCount(SentBytes, map[string]string{"transport": transport}, float64(n))
+	}
+}
+
+func ReportRateLimiterBackendError(reporters []Reporter) {
+	for _, r := range reporters {
+		r.ReportCount(RateLimiterBackendErrors, map[string]string{}, 1)
+	}
+}
+
+func ReportShadowDiff(reporters []Reporter, route string) {
+	for _, r := range reporters {
+		r.ReportCount(ShadowDiff, map[string]string{"route": route}, 1)
+	}
+}
+
+func ReportInflightHandlers(reporters []Reporter, n int64) {
+	for _, r := range reporters {
+		r.ReportGauge(InflightHandlers, map[string]string{}, float64(n))
+	}
+}
+
+func ReportClusterMembers(reporters []Reporter, serverType string, n int) {
+	for _, r := range reporters {
+		r.ReportGauge(ClusterMembers, map[string]string{"server_type": serverType}, float64(n))
+	}
+}
+
+func ReportClusterMemberUp(reporters []Reporter, serverID, serverType string, up bool) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	for _, r := range reporters {
+		r.ReportGauge(ClusterMemberUp, map[string]string{"server_id": serverID, "server_type": serverType}, value)
+	}
+}
+
+func ReportRoutingFailure(reporters []Reporter, serverType string) {
+	for _, r := range reporters {
+		r.ReportCount(RoutingFailures, map[string]string{"server_type": serverType}, 1)
+	}
+}
+
+func ReportDuplicateLogin(reporters []Reporter, policy string) {
+	for _, r := range reporters {
+		r.ReportCount(DuplicateLogins, map[string]string{"policy": policy}, 1)
+	}
+}
+
+func ReportResponseCache(reporters []Reporter, route string, hit bool) {
+	metric := ResponseCacheMisses
+	if hit {
+		metric = ResponseCacheHits
+	}
+	for _, r := range reporters {
+		r.ReportCount(metric, map[string]string{"route": route}, 1)
+	}
+}
+
+func ReportReliableResend(reporters []Reporter, route string) {
+	for _, r := range reporters {
+		r.ReportCount(ReliableResends, map[string]string{"route": route}, 1)
+	}
+}
+
+func ReportReliableGiveUp(reporters []Reporter, route string) {
+	for _, r := range reporters {
+		r.ReportCount(ReliableGiveUps, map[string]string{"route": route}, 1)
+	}
+}
+
+func ReportRPCFallback(reporters []Reporter, route string) {
+	for _, r := range reporters {
+		r.ReportCount(RPCFallbacks, map[string]string{"route": route}, 1)
+	}
+}
+
+func ReportMessageBytes(reporters []Reporter, route, direction string, n int) {
+	for _, r := range reporters {
+		r.ReportSummary(MessageBytes, map[string]string{"route": route, "direction": direction}, float64(n))
+	}
+}
+
+func ReportAffinityMiss(reporters []Reporter, service string) {
+	for _, r := range reporters {
+		r.ReportCount(AffinityMisses, map[string]string{"service": service}, 1)
+	}
+}
+
+func ReportWorkerPoolQueueDepth(reporters []Reporter, n int) {
+	for _, r := range reporters {
+		r.ReportGauge(WorkerPoolQueueDepth, map[string]string{}, float64(n))
+	}
+}
+
+func ReportWorkerPoolUtilization(reporters []Reporter, utilization float64) {
+	for _, r := range reporters {
+		r.ReportGauge(WorkerPoolUtilization, map[string]string{}, utilization)
+	}
+}
+
+func ReportProcessedMessage(reporters []Reporter, route string) {
+	for _, r := range reporters {
+		r.ReportCount(ProcessedMessages, map[string]string{"route": route}, 1)
+	}
+}
+
+func ReportHandlerError(reporters []Reporter, route string, code int) {
+	for _, r := range reporters {
+		r.ReportCount(HandlerErrors, map[string]string{"route": route, "code": strconv.Itoa(code)}, 1)
+	}
+}
+
+func ReportDroppedMessage(reporters []Reporter, route, reason string) {
+	for _, r := range reporters {
+		r.ReportCount(DroppedMessages, map[string]string{"route": route, "reason": reason}, 1)
+	}
+}
+
+// ReportGroups reports the number of groups and the number of members of each group
+func ReportGroups(reporters []Reporter, sizes []int) {
+	for _, r := range reporters {
+		r.ReportGauge(ActiveGroups, map[string]string{}, float64(len(sizes)))
+		for _, size := range sizes {
+			r.ReportSummary(GroupMembers, map[string]string{}, float64(size))
+		}
+	}
+}
+
+// ReportSendQueueDepths reports the number of messages pending in the outbound
+// queue of each session
+func ReportSendQueueDepths(reporters []Reporter, depths []int) {
+	for _, r := range reporters {
+		for _, depth := range depths {
+			r.ReportSummary(SendQueueDepth, map[string]string{}, float64(depth))
 		}
+	}
+}
 
-		time.Sleep(period)
+func ReportSendQueueOverflow(reporters []Reporter, policy string) {
+	for _, r := range reporters {
+		r.ReportCount(SendQueueOverflows, map[string]string{"policy": policy}, 1)
 	}
 }
 
-func ReportExceededRateLimiting(reporters []Reporter) {
+// ReportBoundSessions reports the number of bound sessions, and the number of
+// sessions of each uid, whose sum is the number of bound sessions
+func ReportBoundSessions(reporters []Reporter, perUID []int) {
+	bound := 0
+	for _, n := range perUID {
+		bound += n
+	}
 	for _, r := range reporters {
-		r.ReportCount(ExceededRateLimiting, map[string]string{}, 1)
+		r.ReportGauge(BoundSessions, map[string]string{}, float64(bound))
+		for _, n := range perUID {
+			r.ReportSummary(SessionsPerUID, map[string]string{}, float64(n))
+		}
 	}
 }
@@ -22,6 +22,7 @@ package metrics
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/DataDog/datadog-go/statsd"
 )
@@ -30,10 +31,15 @@ import (
 type Client interface {
 	Count(name string, value int64, tags []string, rate float64) error
 	Gauge(name string, value float64, tags []string, rate float64) error
+	Histogram(name string, value float64, tags []string, rate float64) error
 	TimeInMilliseconds(name string, value float64, tags []string, rate float64) error
 }
 
-// StatsdReporter sends application metrics to statsd
+// StatsdReporter pushes application metrics to statsd over UDP with DogStatsD
+// tags, which is used by the push-based infrastructures instead of the
+// PrometheusReporter. The counts and gauges are sent as is; the summaries in
+// nanoseconds, whose names end with "_ns", are sent as timings in milliseconds
+// with the suffix replaced by "_ms", and the other summaries as histograms.
 type StatsdReporter struct {
 	client      Client
 	rate        float64
@@ -41,7 +47,9 @@ type StatsdReporter struct {
 	defaultTags []string
 }
 
-// NewStatsdReporter returns an instance of statsd reportar and an error if something fails
+// NewStatsdReporter returns an instance of statsd reportar and an error if something fails.
+// The prefix is prepended to the metric names, e.g: "nano.", and the serverType and
+// tagsMap are sent as the tags of all metrics.
 func NewStatsdReporter(
 	host string,
 	prefix string,
@@ -56,16 +64,15 @@ func NewStatsdReporter(
 		serverType: serverType,
 	}
 
-	//	sr.buildDefaultTags(tagsMap)
+	sr.buildDefaultTags(tagsMap)
 
 	if len(clientOrNil) > 0 {
 		sr.client = clientOrNil[0]
 	} else {
-		c, err := statsd.New(host)
+		c, err := statsd.New(host, statsd.WithNamespace(prefix))
 		if err != nil {
 			return nil, err
 		}
-		c.Namespace = prefix
 		sr.client = c
 	}
 	return sr, nil
@@ -85,50 +92,39 @@ func (s *StatsdReporter) buildDefaultTags(tagsMap map[string]string) {
 	s.defaultTags = defaultTags
 }
 
-// ReportCount sends count reports to statsd
-func (s *StatsdReporter) ReportCount(metric string, tagsMap map[string]string, count float64) error {
-	fullTags := s.defaultTags
+// tags returns the default tags followed by the tags of a metric, the default tags
+// are copied since the reporter is used concurrently
+func (s *StatsdReporter) tags(tagsMap map[string]string) []string {
+	fullTags := make([]string, len(s.defaultTags), len(s.defaultTags)+len(tagsMap))
+	copy(fullTags, s.defaultTags)
 
 	for k, v := range tagsMap {
 		fullTags = append(fullTags, fmt.Sprintf("%s:%s", k, v))
 	}
+	return fullTags
+}
 
-	err := s.client.Count(metric, int64(count), fullTags, s.rate)
-	if err != nil {
-		//logger.Log.Errorf("failed to report count: %q", err)
-	}
-
-	return err
+// ReportCount sends count reports to statsd
+func (s *StatsdReporter) ReportCount(metric string, tagsMap map[string]string, count float64) error {
+	return s.client.Count(metric, int64(count), s.tags(tagsMap), s.rate)
 }
 
 // ReportGauge sents the gauge value and reports to statsd
 func (s *StatsdReporter) ReportGauge(metric string, tagsMap map[string]string, value float64) error {
-	fullTags := s.defaultTags
-
-	for k, v := range tagsMap {
-		fullTags = append(fullTags, fmt.Sprintf("%s:%s", k, v))
-	}
-
-	err := s.client.Gauge(metric, value, fullTags, s.rate)
-	if err != nil {
-		//logger.Log.Errorf("failed to report gauge: %q", err)
-	}
-
-	return err
+	return s.client.Gauge(metric, value, s.tags(tagsMap), s.rate)
 }
 
 // ReportSummary observes the summary value and reports to statsd
 func (s *StatsdReporter) ReportSummary(metric string, tagsMap map[string]string, value float64) error {
-	fullTags := s.defaultTags
-
-	for k, v := range tagsMap {
-		fullTags = append(fullTags, fmt.Sprintf("%s:%s", k, v))
-	}
-
-	err := s.client.TimeInMilliseconds(metric, float64(value), fullTags, s.rate)
-	if err != nil {
-		//logger.Log.Errorf("failed to report summary: %q", err)
+	if strings.HasSuffix(metric, "_ns") {
+		name := strings.TrimSuffix(metric, "_ns") + "_ms"
+		return s.client.TimeInMilliseconds(name, value/1e6, s.tags(tagsMap), s.rate)
 	}
+	return s.client.Histogram(metric, value, s.tags(tagsMap), s.rate)
+}
 
-	return err
+// ReportHistogram implements the HistogramReporter interface, which sends the value
+// as a statsd histogram
+func (s *StatsdReporter) ReportHistogram(metric string, tagsMap map[string]string, value float64) error {
+	return s.client.Histogram(metric, value, s.tags(tagsMap), s.rate)
 }
@@ -0,0 +1,74 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsdReporter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s, err := NewStatsdReporter(conn.LocalAddr().String(), "nano.", 1, "connector", map[string]string{"region": "eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ReportCount(ExceededRateLimiting, nil, 2)
+	s.ReportGauge(ConnectedClients, map[string]string{"transport": "ws"}, 10)
+	s.ReportSummary(ResponseTime, map[string]string{"route": "Room.Join"}, 3e6)
+	s.ReportSummary(MessageBytes, nil, 128)
+	if err := s.Flush(FlushConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var received []string
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for len(received) < 4 {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(buf[:n])), "\n") {
+			received = append(received, line)
+		}
+	}
+	sort.Strings(received)
+
+	expect := []string{
+		"nano.connected_clients:10|g|#serverType:connector,region:eu,transport:ws",
+		"nano.exceeded_rate_limiting:2|c|#serverType:connector,region:eu",
+		"nano.message_bytes:128|h|#serverType:connector,region:eu",
+		"nano.response_time_ms:3.000000|ms|#serverType:connector,region:eu,route:Room.Join",
+	}
+	if !reflect.DeepEqual(received, expect) {
+		t.Fatalf("expect: %q, got: %q", expect, received)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSysCollectInterval is the default interval of collecting the runtime metrics
+const DefaultSysCollectInterval = 15 * time.Second
+
+// SysCollector samples the runtime and process metrics periodically in background,
+// i.e: Goroutines, HeapSize, HeapObjects, GCPause, GCCount, ProcessCPUSeconds and
+// OpenConnections, and reports them to the reporters
+type SysCollector struct {
+	reporters   []Reporter
+	interval    time.Duration
+	connections func() int64 // returns the number of open connections, optional
+	gauges      []sysGauge
+	funcs       []func(reporters []Reporter)
+
+	numGC uint32        // number of GC cycles reported
+	cpu   time.Duration // CPU time reported
+
+	die      chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// sysGauge is a gauge sampled every collecting
+type sysGauge struct {
+	name   string
+	sample func() float64
+}
+
+// NewSysCollector returns a collector reporting to reporters every interval, which
+// defaults to DefaultSysCollectInterval. OpenConnections is reported only if the
+// connections is not nil.
+func NewSysCollector(reporters []Reporter, interval time.Duration, connections func() int64) *SysCollector {
+	if interval <= 0 {
+		interval = DefaultSysCollectInterval
+	}
+	return &SysCollector{
+		reporters:   reporters,
+		interval:    interval,
+		connections: connections,
+		die:         make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// AddGauge adds a gauge sampled by fn every collecting, e.g: the length of a queue,
+// which should be called before Start
+func (c *SysCollector) AddGauge(name string, fn func() float64) {
+	c.gauges = append(c.gauges, sysGauge{name: name, sample: fn})
+}
+
+// AddFunc adds a function called every collecting to report the metrics sampled
+// by itself, e.g: the distribution of the sizes of groups, which should be called
+// before Start
+func (c *SysCollector) AddFunc(fn func(reporters []Reporter)) {
+	c.funcs = append(c.funcs, fn)
+}
+
+// Start collects the metrics in background until Stop is called
+func (c *SysCollector) Start() {
+	go c.run()
+}
+
+// Stop stops collecting and waits for the collecting in progress
+func (c *SysCollector) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.die)
+		<-c.done
+	})
+}
+
+func (c *SysCollector) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.collect()
+		select {
+		case <-ticker.C:
+		case <-c.die:
+			return
+		}
+	}
+}
+
+// collect samples the metrics once, the counters are reported by the deltas since
+// the last collecting
+func (c *SysCollector) collect() {
+	m := &runtime.MemStats{}
+	runtime.ReadMemStats(m)
+	goroutines := runtime.NumGoroutine()
+	messages := atomic.LoadInt32(&messageCount)
+
+	// PauseNs is a circular buffer of the recent pauses, the pauses overwritten
+	// between two collectings are lost
+	gcs := m.NumGC - c.numGC
+	pauses := gcs
+	if pauses > uint32(len(m.PauseNs)) {
+		pauses = uint32(len(m.PauseNs))
+	}
+	c.numGC = m.NumGC
+
+	gauges := make([]float64, len(c.gauges))
+	for i, g := range c.gauges {
+		gauges[i] = g.sample()
+	}
+
+	var cpu time.Duration
+	cpuOK := false
+	if total, ok := processCPUTime(); ok {
+		cpu, cpuOK = total-c.cpu, true
+		c.cpu = total
+	}
+
+	for _, r := range c.reporters {
+		r.ReportGauge(Goroutines, map[string]string{}, float64(goroutines))
+		r.ReportGauge(HeapSize, map[string]string{}, float64(m.Alloc))
+		r.ReportGauge(HeapObjects, map[string]string{}, float64(m.HeapObjects))
+		r.ReportGauge(MessageCount, map[string]string{}, float64(messages))
+		if c.connections != nil {
+			r.ReportGauge(OpenConnections, map[string]string{}, float64(c.connections()))
+		}
+		for i, g := range c.gauges {
+			r.ReportGauge(g.name, map[string]string{}, gauges[i])
+		}
+		if gcs > 0 {
+			r.ReportCount(GCCount, map[string]string{}, float64(gcs))
+		}
+		for i := uint32(0); i < pauses; i++ {
+			pause := m.PauseNs[(m.NumGC-i+uint32(len(m.PauseNs))-1)%uint32(len(m.PauseNs))]
+			r.ReportSummary(GCPause, map[string]string{}, float64(pause))
+		}
+		if cpuOK && cpu > 0 {
+			r.ReportCount(ProcessCPUSeconds, map[string]string{}, cpu.Seconds())
+		}
+	}
+	for _, fn := range c.funcs {
+		fn(c.reporters)
+	}
+}
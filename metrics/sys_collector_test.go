@@ -0,0 +1,155 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sysReporter records the last values of the gauges and the sums of the counts
+// and summaries
+type sysReporter struct {
+	mu       sync.Mutex
+	values   map[string]float64
+	reported chan struct{}
+}
+
+func newSysReporter() *sysReporter {
+	return &sysReporter{values: map[string]float64{}, reported: make(chan struct{}, 1)}
+}
+
+func (r *sysReporter) ReportCount(metric string, tags map[string]string, count float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[metric] += count
+	return nil
+}
+
+func (r *sysReporter) ReportSummary(metric string, tags map[string]string, value float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[metric] += value
+	return nil
+}
+
+func (r *sysReporter) ReportGauge(metric string, tags map[string]string, value float64) error {
+	r.mu.Lock()
+	r.values[metric] = value
+	r.mu.Unlock()
+	if metric == MessageCount {
+		select {
+		case r.reported <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (r *sysReporter) value(metric string) (float64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.values[metric]
+	return v, ok
+}
+
+func TestSysCollector_Collect(t *testing.T) {
+	r := newSysReporter()
+	c := NewSysCollector([]Reporter{r}, time.Minute, func() int64 { return 42 })
+	runtime.GC()
+	c.collect()
+
+	if v, _ := r.value(Goroutines); v <= 0 {
+		t.Fatalf("expect goroutines reported, got: %v", v)
+	}
+	if v, _ := r.value(HeapSize); v <= 0 {
+		t.Fatalf("expect heap size reported, got: %v", v)
+	}
+	if v, _ := r.value(OpenConnections); v != 42 {
+		t.Fatalf("expect: 42, got: %v", v)
+	}
+	gcs, _ := r.value(GCCount)
+	if gcs < 1 {
+		t.Fatalf("expect gc cycles reported, got: %v", gcs)
+	}
+	if _, ok := r.value(GCPause); !ok {
+		t.Fatal("expect gc pauses reported")
+	}
+	if _, ok := processCPUTime(); ok {
+		if v, _ := r.value(ProcessCPUSeconds); v <= 0 {
+			t.Fatalf("expect cpu time reported, got: %v", v)
+		}
+	}
+
+	// the counters are reported by the deltas
+	runtime.GC()
+	c.collect()
+	if v, _ := r.value(GCCount); v != float64(c.numGC) {
+		t.Fatalf("expect: %d, got: %v", c.numGC, v)
+	}
+}
+
+func TestSysCollector_StartStop(t *testing.T) {
+	r := newSysReporter()
+	c := NewSysCollector([]Reporter{r}, 10*time.Millisecond, nil)
+	c.Start()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-r.reported:
+		case <-time.After(time.Second):
+			t.Fatal("expect the metrics collected periodically")
+		}
+	}
+	c.Stop()
+	c.Stop()
+
+	if _, ok := r.value(OpenConnections); ok {
+		t.Fatal("expect no open connections reported without the counter")
+	}
+	select {
+	case <-r.reported:
+	default:
+	}
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case <-r.reported:
+		t.Fatal("expect no collecting after stopped")
+	default:
+	}
+}
+
+func TestSysCollector_AddGauge(t *testing.T) {
+	r := newSysReporter()
+	c := NewSysCollector([]Reporter{r}, time.Minute, nil)
+	depth := 0
+	c.AddGauge(SchedulerQueueLength, func() float64 {
+		depth++
+		return float64(depth)
+	})
+
+	c.collect()
+	c.collect()
+	if v, _ := r.value(SchedulerQueueLength); v != 2 {
+		t.Fatalf("expect the gauge sampled every collecting, got: %v", v)
+	}
+}
@@ -1,19 +1,25 @@
 package nano
 
 import (
+	"crypto/tls"
 	"net/http"
 	"time"
 
 	"github.com/lonng/nano/metrics"
 	"github.com/lonng/nano/session"
 
+	"github.com/lonng/nano/accesslog"
+	"github.com/lonng/nano/clock"
 	"github.com/lonng/nano/cluster"
 	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/encryption"
 	"github.com/lonng/nano/internal/env"
 	"github.com/lonng/nano/internal/log"
 	"github.com/lonng/nano/internal/message"
 	"github.com/lonng/nano/pipeline"
+	"github.com/lonng/nano/ratelimit"
 	"github.com/lonng/nano/serialize"
+	"github.com/lonng/nano/serialize/json"
 	"google.golang.org/grpc"
 )
 
@@ -95,6 +101,26 @@ func WithRateLimit(limit int, interval time.Duration) Option {
 	}
 }
 
+// WithRouteRateLimit limits the requests of each session to the route over a
+// sliding window, use ratelimit.AnyRoute to apply the rule to all routes which
+// do not have a dedicated rule.
+func WithRouteRateLimit(route string, rule ratelimit.Rule) Option {
+	return func(opt *cluster.Options) {
+		if opt.RateLimitRules == nil {
+			opt.RateLimitRules = ratelimit.Rules{}
+		}
+		opt.RateLimitRules[route] = rule
+	}
+}
+
+// WithRateLimiter overrides the default in-memory sliding window limiter used
+// by the route rate limit rules
+func WithRateLimiter(l ratelimit.Limiter) Option {
+	return func(opt *cluster.Options) {
+		opt.RateLimiter = l
+	}
+}
+
 // WithHeartbeatInterval sets Heartbeat time interval
 func WithHeartbeatInterval(d time.Duration) Option {
 	return func(_ *cluster.Options) {
@@ -185,7 +211,49 @@ func WithIsWebsocket(enableWs bool) Option {
 	}
 }
 
-// WithTSLConfig sets the `key` and `certificate` of TSL
+// WithTLS sets the TLS configuration of the client acceptors, which takes
+// precedence over WithTSLConfig. The TCP acceptor serves TLS and the WebSocket
+// acceptor serves WSS with it, the client certificates can be verified by the
+// ClientAuth and ClientCAs of cfg, and the certificates can be rotated without
+// restarting by setting the GetCertificate of cfg, e.g: with a CertReloader.
+//
+//	reloader, err := cluster.NewCertReloader("server.crt", "server.key")
+//	...
+//	reloader.Watch(syscall.SIGHUP)
+//	nano.WithTLS(&tls.Config{
+//		GetCertificate: reloader.GetCertificate,
+//		ClientAuth:     tls.RequireAndVerifyClientCert,
+//		ClientCAs:      pool,
+//	})
+func WithTLS(cfg *tls.Config) Option {
+	return func(opt *cluster.Options) {
+		opt.TLSConfig = cfg
+	}
+}
+
+// WithWSCompression enables the permessage-deflate extension of the WebSocket
+// acceptor, the messages smaller than threshold bytes are sent uncompressed and
+// level is the flate compression level, zero means the default level. Clients
+// which do not offer the extension are served uncompressed.
+func WithWSCompression(threshold, level int) Option {
+	return func(opt *cluster.Options) {
+		opt.WSCompression = &cluster.WSCompressionConfig{Threshold: threshold, Level: level}
+	}
+}
+
+// WithWSSubprotocols sets the WebSocket subprotocols accepted besides the ones
+// naming the protocol versions (nano-v1, nano-v2...), the first one proposed by
+// the client in the order of protocols is selected. The connections proposing
+// none of the supported subprotocols are refused.
+func WithWSSubprotocols(protocols ...string) Option {
+	return func(opt *cluster.Options) {
+		opt.WSSubprotocols = protocols
+	}
+}
+
+// WithTSLConfig sets the `key` and `certificate` of TSL, the TCP acceptor serves
+// TLS and the WebSocket acceptor serves WSS with the certificate, which is
+// reloaded from the files when the process receives SIGHUP.
 func WithTSLConfig(certificate, key string) Option {
 	return func(opt *cluster.Options) {
 		opt.TSLCertificate = certificate
@@ -209,3 +277,499 @@ func WithMetrics(reporters []metrics.Reporter, period time.Duration) Option {
 		}
 	}
 }
+
+// WithEncryption enables the optional payload encryption, the shared secret is
+// negotiated with the client at handshake by the KeyExchange, ECDH over P-256
+// will be used if the KeyExchange is nil. Clients which do not request
+// encryption at handshake are still served in plaintext.
+func WithEncryption(kx encryption.KeyExchange) Option {
+	return func(opt *cluster.Options) {
+		if kx == nil {
+			kx = encryption.NewECDHKeyExchange()
+		}
+		opt.KeyExchange = kx
+	}
+}
+
+// WithMaxSessions sets the limit of concurrent client sessions of current node,
+// new connections will be kicked with a "server full" reason once the limit is
+// reached. Zero means unlimited.
+func WithMaxSessions(n int) Option {
+	return func(opt *cluster.Options) {
+		opt.MaxSessions = n
+	}
+}
+
+// WithKCP makes the client acceptor listen on UDP with the KCP protocol, the
+// recommended configuration will be used if cfg is nil. The KCP acceptor is
+// only available in binaries built with the kcp build tag.
+func WithKCP(cfg *cluster.KCPConfig) Option {
+	return func(opt *cluster.Options) {
+		if cfg == nil {
+			cfg = cluster.DefaultKCPConfig()
+		}
+		opt.KCP = cfg
+	}
+}
+
+// WithQUIC makes the client acceptor listen on UDP with the QUIC protocol, the
+// recommended configuration will be used if cfg is nil. QUIC requires TLS, the
+// certificate set by WithTSLConfig is used unless cfg.TLSConfig is present.
+// The QUIC acceptor is only available in binaries built with the quic build tag.
+func WithQUIC(cfg *cluster.QUICConfig) Option {
+	return func(opt *cluster.Options) {
+		if cfg == nil {
+			cfg = cluster.DefaultQUICConfig()
+		}
+		opt.QUIC = cfg
+	}
+}
+
+// WithListener adds a client endpoint to current node besides the one of
+// ClientAddr, the transport is one of "tcp", "ws", "wss", "kcp" and "quic".
+// It can be used repeatedly, e.g: serving TCP on :3250, WebSocket on :3260
+// and secure WebSocket on :3261 at once. All endpoints share the handlers and
+// sessions of the node, and the options of each transport, e.g: WithTSLConfig
+// for "tcp", "wss" and "quic", WithKCP for "kcp", apply to all its endpoints.
+//
+// Besides host:port, the address of "tcp", "ws" and "wss" can be a Unix domain
+// socket like "unix:///run/nano.sock", or "systemd://name" to serve the socket
+// passed by systemd socket activation whose FileDescriptorName is name, the
+// first passed socket is served if name is empty.
+func WithListener(transport, addr string) Option {
+	return func(opt *cluster.Options) {
+		opt.Listeners = append(opt.Listeners, cluster.ListenerConfig{Transport: transport, Addr: addr})
+	}
+}
+
+// WithAcceptor adds a custom transport to current node, the connections accepted
+// by the acceptor are served like the ones of built-in transports. It can be
+// used repeatedly to add several acceptors.
+func WithAcceptor(a cluster.Acceptor) Option {
+	return func(opt *cluster.Options) {
+		opt.Acceptors = append(opt.Acceptors, a)
+	}
+}
+
+// WithProxyProtocol makes the TCP and WebSocket acceptors read the PROXY protocol
+// (v1 or v2) header of each connection, which is sent by the load balancers like
+// AWS NLB and HAProxy, so that session.RemoteAddr is the address of the real
+// client. The connections without a valid header in timeout are closed, and
+// cluster.DefaultProxyHeaderTimeout(5s) will be used if timeout is zero. It must
+// be enabled only behind the load balancers, since the header can be forged by
+// the clients connecting directly.
+func WithProxyProtocol(timeout time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.ProxyProtocol = true
+		opt.ProxyHeaderTimeout = timeout
+	}
+}
+
+// WithMigrationWindow sets the duration a session migrated from a draining node
+// waits for the client to reconnect, the default is 30 seconds.
+func WithMigrationWindow(d time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.MigrationWindow = d
+	}
+}
+
+// WithAdminAddr sets the address of the admin HTTP server, which serves the
+// following endpoints:
+//
+//	POST /drain    migrates all client sessions to the other frontend nodes
+//	GET  /ring     reports the key distribution of consistent hash rings
+func WithAdminAddr(addr string) Option {
+	return func(opt *cluster.Options) {
+		opt.AdminAddr = addr
+	}
+}
+
+// WithGroupPersistence sets the adapter which saves the membership of groups,
+// the membership is kept in memory only by default.
+func WithGroupPersistence(adapter GroupPersistenceAdapter) Option {
+	return func(_ *cluster.Options) {
+		if adapter != nil {
+			groupPersistence = adapter
+		}
+	}
+}
+
+// WithClock sets the time source of scheduler, heartbeat and rate limiters,
+// which is useful to fast-forward the time in tests with clocktest.Fake.
+func WithClock(c clock.Clock) Option {
+	return func(_ *cluster.Options) {
+		if c != nil {
+			env.Clock = c
+		}
+	}
+}
+
+// WithRequestLogger sets the hook which receives a cluster.RequestInfo after
+// each request is processed, e.g: to write structured access logs. The hook is
+// called from the handler goroutine, so it should not block.
+func WithRequestLogger(fn cluster.RequestLogger) Option {
+	return func(opt *cluster.Options) {
+		opt.RequestLogger = fn
+	}
+}
+
+// WithConsistentHash routes the sessions to the members of remote services by
+// consistent hashing of uid, or session id if the session is not bound. Each
+// member is placed on the ring with replicas virtual nodes per unit of weight,
+// which is specified in the member label as `weight=N`, e.g: "game,weight=4".
+// The cluster.DefaultHashReplicas will be used if replicas is not positive.
+func WithConsistentHash(replicas int) Option {
+	return func(opt *cluster.Options) {
+		opt.ConsistentHash = true
+		opt.HashReplicas = replicas
+	}
+}
+
+// WithReconnectHint sets the delay which clients should wait before reconnecting
+// when the server is closing, each client is told to wait for base plus a random
+// jitter in [0, jitter), e.g: the jitter can be derived from the number of clients
+// the server expects to serve, so that the reconnections after a restart are spread
+// over a period of time. See cluster.ReconnectHint for the client SDK contract.
+func WithReconnectHint(base, jitter time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.ReconnectBase = base
+		opt.ReconnectJitter = jitter
+	}
+}
+
+// WithJSONSerializer uses the json serializer of the backend as application
+// serializer, e.g: WithJSONSerializer(json.GoJSON, json.DisableHTMLEscape())
+func WithJSONSerializer(backend json.Backend, opts ...json.Option) Option {
+	return func(_ *cluster.Options) {
+		env.Serializer = json.New(backend, opts...)
+	}
+}
+
+// WithMetricsFlushOnPanic flushes the current metrics of reporters to the pushgateway
+// or file of cfg when the application crashes with an unrecovered panic, so that
+// the last window of metrics is not lost. The flushing is bounded by cfg.Timeout.
+// The goroutines started by the application should defer cluster.FlushOnPanic to
+// flush the metrics if they panic as well.
+func WithMetricsFlushOnPanic(cfg metrics.FlushConfig) Option {
+	return func(opt *cluster.Options) {
+		opt.MetricsFlush = &cfg
+	}
+}
+
+// WithAccessLog writes one line per handled request to the logger, the requests
+// are sampled by the rates of config. The access log is chained after the hook
+// set by WithRequestLogger.
+func WithAccessLog(config accesslog.Config) Option {
+	return func(opt *cluster.Options) {
+		l := accesslog.New(config)
+		prev := opt.RequestLogger
+		opt.RequestLogger = func(info cluster.RequestInfo) {
+			if prev != nil {
+				prev(info)
+			}
+			l.Log(info)
+		}
+	}
+}
+
+// WithSlowClientTimeout disconnects the clients which have not completed a packet
+// within timeout since the packet started, e.g: a client drips the packet one byte
+// every few seconds. The idle clients without incomplete packet are not affected.
+func WithSlowClientTimeout(timeout time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.SlowClientTimeout = timeout
+	}
+}
+
+// WithShutdownTimeout sets the time to wait for the in-flight handlers to complete
+// when the node shuts down, cluster.DefaultShutdownTimeout will be used if absent.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.ShutdownTimeout = timeout
+	}
+}
+
+// WithReadTimeout sets the max duration to wait for the next bytes of a client
+// connection, the session is closed if nothing is received in the timeout.
+// Since the clients send heartbeats, the timeout should be longer than the
+// heartbeat interval. Zero means no timeout.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.ReadTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the max duration of each write to a client connection,
+// the session is closed if a write does not complete in the timeout, e.g: the
+// peer of a half-open connection stops reading. Zero means no timeout.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.WriteTimeout = timeout
+	}
+}
+
+// WithIdleTimeout closes the client sessions which have not sent any packet,
+// including heartbeats, in the timeout. The idle sessions are kicked with an
+// "idle_timeout" reason and closed with the normal lifecycle, which fires the
+// session closed callbacks. Without the option, the sessions are closed if
+// there is no packet in two heartbeat intervals.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.IdleTimeout = timeout
+	}
+}
+
+// WithShutdownNotice pushes the data with route to all client sessions when the
+// node starts to shut down, the node waits up to the shutdown timeout (see
+// WithShutdownTimeout) for the notices to be sent and the in-flight handlers to
+// complete before the sessions are closed.
+func WithShutdownNotice(route string, data interface{}) Option {
+	return func(opt *cluster.Options) {
+		opt.ShutdownNotice = &cluster.ShutdownNotice{Route: route, Data: data}
+	}
+}
+
+// WithMaxConnectionsPerIP sets the limit of concurrent client connections from
+// one IP address, new connections over the limit will be kicked with a "too many
+// connections" reason. Zero means unlimited.
+func WithMaxConnectionsPerIP(n int) Option {
+	return func(opt *cluster.Options) {
+		opt.MaxConnectionsPerIP = n
+	}
+}
+
+// WithMaxConnections sets the limit of concurrent connections accepted by the TCP
+// and WebSocket acceptors of current node, including the ones which have not
+// completed the handshake. The connections over the limit are closed right after
+// accepted without reading any data. Zero means unlimited.
+func WithMaxConnections(n int) Option {
+	return func(opt *cluster.Options) {
+		opt.MaxConnections = n
+	}
+}
+
+// WithAcceptRate throttles the new connections of the TCP and WebSocket acceptors
+// of current node to rate per second, with bursts of at most burst connections.
+// The connections over the rate are closed right after accepted.
+func WithAcceptRate(rate float64, burst int) Option {
+	return func(opt *cluster.Options) {
+		opt.AcceptRate = rate
+		opt.AcceptBurst = burst
+	}
+}
+
+// WithDuplicateLogin sets the policy applied when a session is bound to a uid
+// which has been bound to another session, e.g: cluster.DuplicateLoginKickOld kicks
+// the old session and cluster.DuplicateLoginRejectNew makes Session.Bind of the new
+// session return ErrDuplicateLogin. Multiple sessions are allowed by default. The
+// policy applies to the sessions of the same device, the sessions bound with
+// different device tags by session.BindDevice can be online at the same time.
+func WithDuplicateLogin(policy cluster.DuplicateLoginPolicy) Option {
+	return func(opt *cluster.Options) {
+		opt.DuplicateLogin = policy
+	}
+}
+
+// WithDuplicateLoginHook sets the hook deciding the policy of each duplicate login
+// instead of the policy set by WithDuplicateLogin, e.g: allowing the accounts of
+// game masters to log in on several devices. The hook is called with the new session
+// and the uid before binding, only if the uid has been bound to another session.
+func WithDuplicateLoginHook(hook func(s *session.Session, uid int64) cluster.DuplicateLoginPolicy) Option {
+	return func(opt *cluster.Options) {
+		opt.DuplicateLoginHook = hook
+	}
+}
+
+// WithSessionStore persists the uid bindings and the data of sessions in store, e.g:
+// session.NewRedisStore, so that the state of a user survives the restarts of the
+// frontend servers. The data of a session is saved when it is closed, and restored
+// when the next session of the user is bound, the keys set before binding are kept.
+// The users are located by the store instead of the registry of master, so any node
+// can find where a user is online. The data is encoded with encoding/gob, the values
+// of custom types should be registered by gob.Register.
+func WithSessionStore(store session.Store) Option {
+	return func(opt *cluster.Options) {
+		opt.SessionStore = store
+	}
+}
+
+// WithPersistInterval saves the changed persistent attributes of the bound sessions
+// every interval by the handler set with session.OnPersist, in addition to when the
+// sessions are closed, which bounds the state lost if the process crashes. The keys
+// of the persistent attributes are designated by session.Persistent, and restored
+// by the handler set with session.OnRestore when the next session of the user is
+// bound. The saving failed is retried in the next interval.
+func WithPersistInterval(interval time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.PersistInterval = interval
+	}
+}
+
+// WithReadBufferSize sets the size of the buffer used to read from each client
+// connection, cluster.DefaultReadBufferSize(2KB) is used by default. A larger
+// buffer reads large requests with fewer syscalls, at the cost of the memory
+// held by every connection.
+func WithReadBufferSize(n int) Option {
+	return func(opt *cluster.Options) {
+		opt.ReadBufferSize = n
+	}
+}
+
+// WithWriteBufferSize sets the size of the buffer used to write to each client
+// connection, cluster.DefaultWriteBufferSize(4KB) is used by default. The pending
+// packets are coalesced in the buffer and flushed once the send queue is drained,
+// a larger buffer saves syscalls for bursts of pushes at the cost of the memory
+// held by every connection. Zero disables the buffering and writes each packet
+// to the connection directly.
+func WithWriteBufferSize(n int) Option {
+	return func(opt *cluster.Options) {
+		opt.WriteBufferSize = n
+	}
+}
+
+// WithHTTPFallback serves the clients which can not upgrade to WebSocket, e.g:
+// behind a corporate proxy blocking the upgrades, on path of the WebSocket
+// listeners. The downstream packets are sent as a Server-Sent Events stream and
+// the upstream packets are sent by POST requests, see the HTTP fallback section of
+// the communication protocol. The sessions are the same as the other transports.
+func WithHTTPFallback(path string) Option {
+	return func(opt *cluster.Options) {
+		opt.HTTPFallbackPath = path
+	}
+}
+
+// WithSendQueue sets the number of messages can be queued for each session and the
+// policy applied when a message is pushed to a full queue, which happens when the
+// client reads slower than the server pushes, e.g: a mobile client on a poor
+// network. cluster.DefaultSendQueueSize(100) and cluster.OverflowBlock are used by
+// default, which blocks the sender until the queue has room, so a single slow client
+// can stall a broadcaster. cluster.OverflowDropOldest and cluster.OverflowDropNewest
+// drop messages, cluster.OverflowClose closes the session. The overflows are counted
+// by the metric send_queue_overflows_total.
+func WithSendQueue(size int, policy cluster.OverflowPolicy) Option {
+	return func(opt *cluster.Options) {
+		opt.SendQueueSize = size
+		opt.SendQueuePolicy = policy
+	}
+}
+
+// WithReliablePush sets how the reliable pushes are resent, see Session.PushReliable.
+// A reliable push is resent after backoff if it has not been acknowledged, the
+// backoff is doubled for each resend, and the session is closed if the push is not
+// acknowledged after retries resends. cluster.DefaultReliableRetries(3) and
+// cluster.DefaultReliableBackoff(1s) will be used if absent.
+func WithReliablePush(retries int, backoff time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.ReliableRetries = retries
+		opt.ReliableBackoff = backoff
+	}
+}
+
+// WithMaxFrameSize splits the data written to the WebSocket and KCP clients into
+// the frames of at most n bytes, which is used when the transport has an effective
+// MTU, e.g: the max frame size of a WebSocket proxy. The frames are reassembled by
+// the client, and the client should fragment its data in the same way, see the
+// fragmentation section of the communication protocol. Zero disables fragmentation.
+func WithMaxFrameSize(n int) Option {
+	return func(opt *cluster.Options) {
+		opt.MaxFrameSize = n
+	}
+}
+
+// WithFragmentTimeout sets the time to wait for all fragments of a message since
+// the first one arrives, the incomplete message will be discarded after timeout.
+// cluster.DefaultFragmentTimeout will be used if absent.
+func WithFragmentTimeout(timeout time.Duration) Option {
+	return func(opt *cluster.Options) {
+		opt.FragmentTimeout = timeout
+	}
+}
+
+// WithSessionIDGenerator sets the generator of session ids, the sequential ids of
+// current process are used by default, which collide among the frontend nodes.
+// The generator must return unique ids among the sessions of the cluster, e.g: the
+// snowflake ids which embed the node id, see service.Snowflake.
+func WithSessionIDGenerator(gen func() int64) Option {
+	return func(opt *cluster.Options) {
+		opt.SessionIDGenerator = gen
+	}
+}
+
+// WithPushFallback delivers the pushes to the offline users by offline, e.g: the
+// mobile push notifications via cluster.FCMDelivery. A push is delivered offline
+// if it targets a closed session and the user has not connected with another
+// session, or it is sent by SendToUser/MultiSend to a user who is not connected.
+// Only the messages which implement cluster.OfflineNotification are delivered.
+func WithPushFallback(offline cluster.OfflineDelivery) Option {
+	return func(opt *cluster.Options) {
+		opt.PushFallback = offline
+	}
+}
+
+// WithSessionAffinity routes the requests of a user to the same member of each
+// remote service by rendezvous hashing of uid, so the sequential requests of the
+// user are handled by the same server. Only the users owned by the added or removed
+// members are re-balanced, and the requests routed away from the previous member
+// are counted by the metric affinity_misses_total. It takes precedence over the
+// router bindings and WithConsistentHash.
+func WithSessionAffinity() Option {
+	return func(opt *cluster.Options) {
+		opt.SessionAffinity = true
+	}
+}
+
+// WithWorkerPool dispatches the handlers to a pool of size worker goroutines instead
+// of the single dispatch goroutine. The messages of a session are always run by the
+// same worker, so the handlers of a session run one at a time in order, while the
+// handlers of different sessions run concurrently and must be safe for concurrent
+// use. The default model runs all handlers one at a time in the order the messages
+// are received. The components registered with a customized scheduler are not
+// affected. See the dispatch model section of get started.
+func WithWorkerPool(size int) Option {
+	return func(opt *cluster.Options) {
+		opt.WorkerPoolSize = size
+	}
+}
+
+// WithSessionResume keeps the session of a broken connection for ttl, so that the
+// client can reconnect with the resume token issued in handshake and continue the
+// session without logging in again, e.g: on a mobile network blip. The pushes to
+// the session are kept in a buffer of size messages and replayed after resuming,
+// the session can not be resumed once the buffer overflows. The reliable pushes
+// not acknowledged are replayed as well, so they are delivered at least once.
+// The client should reconnect to the same node, see docs/communication_protocol.md.
+func WithSessionResume(ttl time.Duration, size int) Option {
+	return func(opt *cluster.Options) {
+		opt.ResumeTTL = ttl
+		opt.ResumeBuffer = size
+	}
+}
+
+// WithResumeSecret sets the key signing the resume tokens, a random key is generated
+// when the node starts up if not specified.
+func WithResumeSecret(secret []byte) Option {
+	return func(opt *cluster.Options) {
+		opt.ResumeSecret = secret
+	}
+}
+
+// WithRegistry registers current node to the registry instead of the master node,
+// e.g: the etcd registry of package cluster/etcd, the members of the cluster are
+// discovered by watching the registry, and the routes are updated once the members
+// join or leave. WithAdvertiseAddr and WithMaster are ignored if a registry is set,
+// and the users should be located by WithSessionStore.
+func WithRegistry(registry cluster.Registry) Option {
+	return func(opt *cluster.Options) {
+		opt.Registry = registry
+	}
+}
+
+// WithRPCTransport carries the RPCs between the members of the cluster by the
+// transport instead of the direct gRPC connections, e.g: the NATS transport of
+// package cluster/nats. All the members of the cluster should use the same kind
+// of transport.
+func WithRPCTransport(transport cluster.RPCTransport) Option {
+	return func(opt *cluster.Options) {
+		opt.RPCTransport = transport
+	}
+}
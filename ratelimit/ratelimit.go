@@ -0,0 +1,90 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package ratelimit limits the requests of each session with rules which
+// can be configured per route, the requests are counted over a sliding window,
+// which provides a more uniform protection than fixed intervals.
+package ratelimit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lonng/nano/session"
+)
+
+// AnyRoute is the route of the rule which applies to all routes without a
+// dedicated rule
+const AnyRoute = "*"
+
+// ErrRateLimited is returned when a session has been disconnected by the
+// PolicyDisconnect policy
+var ErrRateLimited = errors.New("ratelimit: session exceeded rate limit")
+
+// Policy represents the backpressure policy when the limit is exceeded
+type Policy byte
+
+const (
+	// PolicyDrop drops the exceeded requests silently
+	PolicyDrop Policy = iota
+	// PolicyDelay holds the exceeded requests until the window has room,
+	// which stops reading from the connection of the session meanwhile
+	PolicyDelay
+	// PolicyDisconnect kicks the session
+	PolicyDisconnect
+)
+
+var policyNames = map[Policy]string{
+	PolicyDrop:       "drop",
+	PolicyDelay:      "delay",
+	PolicyDisconnect: "disconnect",
+}
+
+func (p Policy) String() string {
+	return policyNames[p]
+}
+
+// Rule allows Limit requests in the most recent Window
+type Rule struct {
+	Limit  int
+	Window time.Duration
+	Policy Policy
+}
+
+// Limiter counts the requests of sessions
+type Limiter interface {
+	// Take records a request of the session to the route, and returns how
+	// long the caller should wait before retrying if the request exceeds the
+	// rule, zero means the request is allowed and has been recorded.
+	Take(s *session.Session, route string, rule Rule) (time.Duration, error)
+}
+
+// Rules contains the rules of routes
+type Rules map[string]Rule
+
+// Match returns the rule of the route, or the AnyRoute rule if the route
+// does not have a dedicated rule
+func (r Rules) Match(route string) (Rule, bool) {
+	if rule, ok := r[route]; ok {
+		return rule, true
+	}
+	rule, ok := r[AnyRoute]
+	return rule, ok
+}
@@ -0,0 +1,117 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ratelimit
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+// slidingWindowScript counts the requests in a sorted set scored by the
+// request timestamp in milliseconds, returns zero if the request is allowed,
+// otherwise the milliseconds to wait until the oldest request expires.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+if redis.call('ZCARD', key) < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return tonumber(oldest[2]) + window - now
+`)
+
+// RedisOptions contains the options of RedisRateLimiter
+type RedisOptions struct {
+	// Prefix of all keys, default is "nano:ratelimit:"
+	Prefix string
+	// Reporters which the backend errors will be reported to
+	Reporters []metrics.Reporter
+}
+
+// RedisRateLimiter is a Limiter which shares the sliding window of a player
+// between all instances, the requests are keyed by the UID of the session,
+// and by the session id if the session has not been bound. The requests are
+// limited by an in-memory sliding window when the Redis is unreachable.
+type RedisRateLimiter struct {
+	client   redis.Cmdable
+	prefix   string
+	fallback *SlidingWindow
+	nonce    string // distinguishes the requests of different instances
+	seq      uint64
+
+	reporters []metrics.Reporter
+}
+
+// NewRedisRateLimiter returns a Limiter backed by the redis client
+func NewRedisRateLimiter(client redis.Cmdable, opts RedisOptions) *RedisRateLimiter {
+	if opts.Prefix == "" {
+		opts.Prefix = "nano:ratelimit:"
+	}
+	return &RedisRateLimiter{
+		client:    client,
+		prefix:    opts.Prefix,
+		fallback:  NewSlidingWindow(),
+		nonce:     strconv.FormatInt(rand.Int63(), 36),
+		reporters: opts.Reporters,
+	}
+}
+
+func (r *RedisRateLimiter) key(s *session.Session, route string) string {
+	if uid := s.UID(); uid > 0 {
+		return fmt.Sprintf("%suid:%d:%s", r.prefix, uid, route)
+	}
+	return fmt.Sprintf("%ssid:%d:%s", r.prefix, s.ID(), route)
+}
+
+// Take implements the Limiter interface
+func (r *RedisRateLimiter) Take(s *session.Session, route string, rule Rule) (time.Duration, error) {
+	if rule.Limit <= 0 {
+		return 0, nil
+	}
+
+	now := env.Clock.Now()
+	member := fmt.Sprintf("%s-%d", r.nonce, atomic.AddUint64(&r.seq, 1))
+	wait, err := slidingWindowScript.Run(r.client, []string{r.key(s, route)},
+		now.UnixNano()/int64(time.Millisecond),
+		int64(rule.Window/time.Millisecond),
+		rule.Limit,
+		member,
+	).Int64()
+	if err != nil {
+		metrics.ReportRateLimiterBackendError(r.reporters)
+		return r.fallback.take(s.ID(), route, rule, now), nil
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
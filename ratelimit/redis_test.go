@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/lonng/nano/metrics"
+	"github.com/lonng/nano/session"
+)
+
+type countReporter struct {
+	counts map[string]float64
+}
+
+func (r *countReporter) ReportCount(metric string, tags map[string]string, count float64) error {
+	r.counts[metric] += count
+	return nil
+}
+
+func (r *countReporter) ReportSummary(metric string, tags map[string]string, value float64) error {
+	return nil
+}
+
+func (r *countReporter) ReportGauge(metric string, tags map[string]string, value float64) error {
+	return nil
+}
+
+func TestRedisRateLimiter_Fallback(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 100 * time.Millisecond,
+		MaxRetries:  -1,
+	})
+	defer client.Close()
+
+	reporter := &countReporter{counts: map[string]float64{}}
+	r := NewRedisRateLimiter(client, RedisOptions{Reporters: []metrics.Reporter{reporter}})
+	s := session.New(nil)
+	rule := Rule{Limit: 1, Window: time.Minute}
+
+	if wait, err := r.Take(s, "room.join", rule); err != nil || wait != 0 {
+		t.Fatalf("expect first request to be allowed, wait: %v, err: %v", wait, err)
+	}
+	if wait, err := r.Take(s, "room.join", rule); err != nil || wait == 0 {
+		t.Fatalf("expect second request to be limited locally, wait: %v, err: %v", wait, err)
+	}
+	if c := reporter.counts[metrics.RateLimiterBackendErrors]; c != 2 {
+		t.Fatalf("expect: 2 backend errors, got: %v", c)
+	}
+}
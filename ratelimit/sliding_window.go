@@ -0,0 +1,96 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lonng/nano/internal/env"
+	"github.com/lonng/nano/session"
+)
+
+// SlidingWindow is a Limiter which keeps a log of request timestamps of each
+// session and route in memory, the log of a session is released after the
+// session closed.
+type SlidingWindow struct {
+	sessions sync.Map // session id => *windowLog
+}
+
+// windowLog contains the logs of all routes of a session
+type windowLog struct {
+	mu     sync.Mutex
+	routes map[string]*ring
+}
+
+// ring is a circular buffer of the timestamps of the recent requests
+type ring struct {
+	times []time.Time
+	head  int // index of the oldest timestamp
+	size  int
+}
+
+// NewSlidingWindow returns a local sliding window log limiter
+func NewSlidingWindow() *SlidingWindow {
+	w := &SlidingWindow{}
+	session.Lifetime.OnClosed(func(s *session.Session) {
+		w.sessions.Delete(s.ID())
+	})
+	return w
+}
+
+// Take implements the Limiter interface
+func (w *SlidingWindow) Take(s *session.Session, route string, rule Rule) (time.Duration, error) {
+	return w.take(s.ID(), route, rule, env.Clock.Now()), nil
+}
+
+func (w *SlidingWindow) take(sid int64, route string, rule Rule, now time.Time) time.Duration {
+	if rule.Limit <= 0 {
+		return 0
+	}
+
+	v, _ := w.sessions.LoadOrStore(sid, &windowLog{routes: map[string]*ring{}})
+	l := v.(*windowLog)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.routes[route]
+	if !ok || len(r.times) != rule.Limit {
+		r = &ring{times: make([]time.Time, rule.Limit)}
+		l.routes[route] = r
+	}
+
+	// evict the timestamps out of the window
+	start := now.Add(-rule.Window)
+	for r.size > 0 && !r.times[r.head].After(start) {
+		r.head = (r.head + 1) % len(r.times)
+		r.size--
+	}
+
+	if r.size >= rule.Limit {
+		return r.times[r.head].Sub(start)
+	}
+
+	r.times[(r.head+r.size)%len(r.times)] = now
+	r.size++
+	return 0
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	w := NewSlidingWindow()
+	rule := Rule{Limit: 3, Window: time.Second}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if wait := w.take(1, "room.join", rule, now.Add(time.Duration(i)*100*time.Millisecond)); wait != 0 {
+			t.Fatalf("request %d should be allowed, wait: %v", i, wait)
+		}
+	}
+
+	// the window is full until the first request expires
+	wait := w.take(1, "room.join", rule, now.Add(500*time.Millisecond))
+	if wait != 500*time.Millisecond {
+		t.Fatalf("expect: %v, got: %v", 500*time.Millisecond, wait)
+	}
+
+	// other routes and sessions are counted separately
+	if wait := w.take(1, "room.leave", rule, now); wait != 0 {
+		t.Fatalf("expect other routes to be allowed, wait: %v", wait)
+	}
+	if wait := w.take(2, "room.join", rule, now); wait != 0 {
+		t.Fatalf("expect other sessions to be allowed, wait: %v", wait)
+	}
+
+	// the window slides instead of resetting at fixed intervals
+	if wait := w.take(1, "room.join", rule, now.Add(time.Second+time.Millisecond)); wait != 0 {
+		t.Fatalf("expect request to be allowed after the oldest expired, wait: %v", wait)
+	}
+	if wait := w.take(1, "room.join", rule, now.Add(time.Second+2*time.Millisecond)); wait == 0 {
+		t.Fatal("expect request to be limited")
+	}
+}
+
+func TestRules_Match(t *testing.T) {
+	rules := Rules{
+		"room.join": {Limit: 1, Window: time.Second},
+		AnyRoute:    {Limit: 10, Window: time.Second},
+	}
+	if rule, _ := rules.Match("room.join"); rule.Limit != 1 {
+		t.Fatalf("expect: 1, got: %d", rule.Limit)
+	}
+	if rule, _ := rules.Match("room.chat"); rule.Limit != 10 {
+		t.Fatalf("expect: 10, got: %d", rule.Limit)
+	}
+	if _, ok := (Rules{}).Match("room.chat"); ok {
+		t.Fatal("expect no rule")
+	}
+}
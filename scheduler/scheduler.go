@@ -23,8 +23,8 @@ package scheduler
 import (
 	"fmt"
 	"runtime/debug"
+	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/lonng/nano/internal/env"
 	"github.com/lonng/nano/internal/log"
@@ -46,6 +46,7 @@ type LocalScheduler interface {
 type Hook func()
 
 var (
+	mu      sync.Mutex // guards chDie and chExit, which are reset by Close
 	chDie   = make(chan struct{})
 	chExit  = make(chan struct{})
 	chTask  = chanx.NewUnboundedChan(messageQueueBacklog)
@@ -53,6 +54,13 @@ var (
 	closed  int32
 )
 
+// signals returns the channels of the current run of scheduler
+func signals() (die, exit chan struct{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	return chDie, chExit
+}
+
 func try(f func()) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -69,21 +77,22 @@ func Sched() {
 		return
 	}
 
-	ticker := time.NewTicker(env.TimerPrecision)
+	die, exit := signals()
+	ticker := env.Clock.NewTicker(env.TimerPrecision)
 	defer func() {
 		ticker.Stop()
-		close(chExit)
+		close(exit)
 	}()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			cron()
 
 		case f := <-chTask.Out:
 			try(f.(Task))
 
-		case <-chDie:
+		case <-die:
 			return
 		}
 	}
@@ -93,9 +102,24 @@ func Close() {
 	if atomic.AddInt32(&closed, 1) != 1 {
 		return
 	}
-	close(chDie)
-	<-chExit
+	die, exit := signals()
+	close(die)
+	<-exit
 	log.Println("Scheduler stopped")
+
+	// reset the state, so that the scheduler can be started again by the next
+	// server in the same process, e.g: the servers started by e2e tests
+	mu.Lock()
+	chDie = make(chan struct{})
+	chExit = make(chan struct{})
+	mu.Unlock()
+	atomic.StoreInt32(&started, 0)
+	atomic.StoreInt32(&closed, 0)
+}
+
+// QueueLen returns the number of tasks waiting to be run by the scheduler
+func QueueLen() int {
+	return chTask.Len()
 }
 
 func PushTask(task Task) {
@@ -28,6 +28,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/lonng/nano/internal/env"
 	"github.com/lonng/nano/internal/log"
 )
 
@@ -117,7 +118,7 @@ func cron() {
 		return
 	}
 
-	now := time.Now()
+	now := env.Clock.Now()
 	unn := now.UnixNano()
 	for id, t := range timerManager.timers {
 		c := atomic.LoadInt32(&t.counter)
@@ -197,10 +198,10 @@ func NewCountTimer(interval time.Duration, count int, fn TimerFunc) *Timer {
 	t := &Timer{
 		id:       atomic.AddInt64(&timerManager.incrementID, 1),
 		fn:       fn,
-		createAt: time.Now().UnixNano(),
+		createAt: env.Clock.Now().UnixNano(),
 		interval: interval,
-		elapse:   int64(interval),       // first execution will be after interval
-		lastTime: time.Now().UnixNano(), //最后执行时间
+		elapse:   int64(interval),            // first execution will be after interval
+		lastTime: env.Clock.Now().UnixNano(), //最后执行时间
 		counter:  int32(count),
 	}
 
@@ -236,7 +237,7 @@ func NewCondTimer(condition TimerCondition, fn TimerFunc) *Timer {
 //往前调时间,调整所有定时器上次触发时间为当前
 func OnChangeTimeAhead() {
 	PushTask(func() {
-		unn := time.Now().UnixNano()
+		unn := env.Clock.Now().UnixNano()
 		for _, t := range timerManager.timers {
 			t.lastTime = unn
 		}
@@ -0,0 +1,61 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package json
+
+import (
+	"bytes"
+
+	gojson "github.com/goccy/go-json"
+)
+
+// GoSerializer implements the serialize.Serializer interface with
+// github.com/goccy/go-json. The output is equivalent to Serializer, except that
+// the keys of maps which contain escaped characters may be ordered differently.
+type GoSerializer struct {
+	opts    options
+	encOpts []gojson.EncodeOptionFunc
+}
+
+// NewGoSerializer returns a new GoSerializer.
+func NewGoSerializer(opts ...Option) *GoSerializer {
+	s := &GoSerializer{opts: newOptions(opts)}
+	if !s.opts.escapeHTML {
+		s.encOpts = append(s.encOpts, gojson.DisableHTMLEscape())
+	}
+	return s
+}
+
+// Marshal returns the JSON encoding of v.
+func (s *GoSerializer) Marshal(v interface{}) ([]byte, error) {
+	return gojson.MarshalWithOption(v, s.encOpts...)
+}
+
+// Unmarshal parses the JSON-encoded data and stores the result
+// in the value pointed to by v.
+func (s *GoSerializer) Unmarshal(data []byte, v interface{}) error {
+	if !s.opts.useNumber {
+		return gojson.Unmarshal(data, v)
+	}
+
+	dec := gojson.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
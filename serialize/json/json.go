@@ -21,24 +21,99 @@
 package json
 
 import (
+	"bytes"
 	"encoding/json"
+
+	"github.com/lonng/nano/serialize"
 )
 
+// Backend represents the implementation of json encoding
+type Backend int
+
+// Supported backends
+const (
+	// Std is backed by encoding/json
+	Std Backend = iota
+	// GoJSON is backed by github.com/goccy/go-json, which is compatible with
+	// encoding/json and much faster
+	GoJSON
+)
+
+type options struct {
+	escapeHTML bool
+	useNumber  bool
+}
+
+// Option configures the json serializers
+type Option func(*options)
+
+// DisableHTMLEscape disables escaping of <, > and & in json strings, which are
+// escaped to \u003c, \u003e and \u0026 by default.
+func DisableHTMLEscape() Option {
+	return func(o *options) {
+		o.escapeHTML = false
+	}
+}
+
+// UseNumber decodes numbers into an interface{} as a json.Number instead of
+// as a float64.
+func UseNumber() Option {
+	return func(o *options) {
+		o.useNumber = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{escapeHTML: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// New returns a json serializer of the backend. The `omitempty` options of
+// struct tags are respected by all backends.
+func New(backend Backend, opts ...Option) serialize.Serializer {
+	if backend == GoJSON {
+		return NewGoSerializer(opts...)
+	}
+	return NewSerializer(opts...)
+}
+
 // Serializer implements the serialize.Serializer interface
-type Serializer struct{}
+type Serializer struct {
+	opts options
+}
 
 // NewSerializer returns a new Serializer.
-func NewSerializer() *Serializer {
-	return &Serializer{}
+func NewSerializer(opts ...Option) *Serializer {
+	return &Serializer{opts: newOptions(opts)}
 }
 
 // Marshal returns the JSON encoding of v.
 func (s *Serializer) Marshal(v interface{}) ([]byte, error) {
-	return json.Marshal(v)
+	if s.opts.escapeHTML {
+		return json.Marshal(v)
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// Encode terminates each value with a newline
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
 }
 
 // Unmarshal parses the JSON-encoded data and stores the result
 // in the value pointed to by v.
 func (s *Serializer) Unmarshal(data []byte, v interface{}) error {
-	return json.Unmarshal(data, v)
+	if !s.opts.useNumber {
+		return json.Unmarshal(data, v)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
 }
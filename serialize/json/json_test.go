@@ -1,7 +1,11 @@
 package json
 
 import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -57,3 +61,171 @@ func BenchmarkSerializer_Deserialize(b *testing.B) {
 		}
 	}
 }
+
+type Item struct {
+	ID    int64   `json:"id"`
+	Count int     `json:"count"`
+	Bound bool    `json:"bound,omitempty"`
+	Price float64 `json:"price,omitempty"`
+}
+
+type Player struct {
+	UID       int64             `json:"uid"`
+	Name      string            `json:"name"`
+	Level     int               `json:"level"`
+	Position  []float64         `json:"position"`
+	Items     []Item            `json:"items"`
+	Equipment map[string]int64  `json:"equipment"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+	Guild     *string           `json:"guild,omitempty"`
+}
+
+var letters = []rune("abcXYZ<>&\"\\/\u00e9\u4e2d\U0001F600 \n\t")
+
+func randString(r *rand.Rand) string {
+	b := make([]rune, r.Intn(16))
+	for i := range b {
+		b[i] = letters[r.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func randPlayer(r *rand.Rand) *Player {
+	p := &Player{
+		UID:       r.Int63(),
+		Name:      randString(r),
+		Level:     r.Intn(100),
+		Position:  []float64{r.Float64() * 1000, r.Float64() * 1000, float64(r.Intn(10))},
+		Equipment: map[string]int64{},
+	}
+	for i := r.Intn(20); i > 0; i-- {
+		p.Items = append(p.Items, Item{ID: r.Int63n(1 << 53), Count: r.Intn(999), Bound: r.Intn(2) == 0, Price: float64(r.Intn(10000)) / 100})
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		p.Equipment[randString(r)] = r.Int63n(1 << 53)
+	}
+	if r.Intn(2) == 0 {
+		p.Attrs = map[string]string{randString(r): randString(r)}
+	}
+	if r.Intn(2) == 0 {
+		guild := randString(r)
+		p.Guild = &guild
+	}
+	return p
+}
+
+func TestSerializer_DisableHTMLEscape(t *testing.T) {
+	m := Message{1, "<b>&</b>"}
+	for _, backend := range []Backend{Std, GoJSON} {
+		b, err := New(backend).Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "<") {
+			t.Fatalf("backend %d: expect html to be escaped by default, got: %s", backend, b)
+		}
+		b, err = New(backend, DisableHTMLEscape()).Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != `{"code":1,"data":"<b>&</b>"}` {
+			t.Fatalf("backend %d: unexpected output: %s", backend, b)
+		}
+	}
+}
+
+func TestSerializer_UseNumber(t *testing.T) {
+	data := []byte(`{"uid":9007199254740993}`)
+	for _, backend := range []Backend{Std, GoJSON} {
+		var v map[string]interface{}
+		if err := New(backend, UseNumber()).Unmarshal(data, &v); err != nil {
+			t.Fatal(err)
+		}
+		if n, ok := v["uid"].(json.Number); !ok || n.String() != "9007199254740993" {
+			t.Fatalf("backend %d: expect json.Number, got: %#v", backend, v["uid"])
+		}
+	}
+}
+
+// TestSerializer_Backends checks that both backends produce the same output and
+// decode each other's output into the same values
+func TestSerializer_Backends(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, opts := range [][]Option{nil, {DisableHTMLEscape()}, {UseNumber()}} {
+		std, fast := New(Std, opts...), New(GoJSON, opts...)
+		for i := 0; i < 500; i++ {
+			p := randPlayer(r)
+			b1, err := std.Marshal(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b2, err := fast.Marshal(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b1, b2) && !equalJSON(t, b1, b2) {
+				t.Fatalf("marshal diverged:\nstd:    %s\ngojson: %s", b1, b2)
+			}
+
+			p1, p2 := &Player{}, &Player{}
+			if err := std.Unmarshal(b2, p1); err != nil {
+				t.Fatal(err)
+			}
+			if err := fast.Unmarshal(b1, p2); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p1, p2) || !reflect.DeepEqual(p, p1) {
+				t.Fatalf("unmarshal diverged:\norigin: %+v\nstd:    %+v\ngojson: %+v", p, p1, p2)
+			}
+
+			var v1, v2 interface{}
+			if err := std.Unmarshal(b1, &v1); err != nil {
+				t.Fatal(err)
+			}
+			if err := fast.Unmarshal(b1, &v2); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(v1, v2) {
+				t.Fatalf("unmarshal to interface diverged:\nstd:    %#v\ngojson: %#v", v1, v2)
+			}
+		}
+	}
+}
+
+// equalJSON reports whether a and b are equivalent json documents, the backends
+// order the map keys which contain escaped characters differently
+func equalJSON(t *testing.T, a, b []byte) bool {
+	var v1, v2 interface{}
+	if err := json.Unmarshal(a, &v1); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &v2); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(v1, v2)
+}
+
+func benchmarkPlayer(b *testing.B, s interface {
+	Marshal(interface{}) ([]byte, error)
+	Unmarshal([]byte, interface{}) error
+}) {
+	p := randPlayer(rand.New(rand.NewSource(1)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, err := s.Marshal(p)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := s.Unmarshal(data, &Player{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSerializer_Player(b *testing.B) {
+	benchmarkPlayer(b, NewSerializer())
+}
+
+func BenchmarkGoSerializer_Player(b *testing.B) {
+	benchmarkPlayer(b, NewGoSerializer())
+}
@@ -0,0 +1,28 @@
+package msgpack
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Message struct {
+	Code int    `msgpack:"code"`
+	Data string `msgpack:"data"`
+}
+
+func TestMsgpackSerializer_Serialize(t *testing.T) {
+	m := Message{1, "hello world"}
+	s := NewSerializer()
+	b, err := s.Marshal(m)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	m2 := Message{}
+	if err := s.Unmarshal(b, &m2); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("expect: %+v, got: %+v", m, m2)
+	}
+}
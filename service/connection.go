@@ -28,8 +28,9 @@ import (
 var Connections = newConnectionService()
 
 type connectionService struct {
-	count int64
-	sid   int64
+	count     int64
+	sid       int64
+	generator atomic.Value // func() int64, generates the session ids if present
 }
 
 func newConnectionService() *connectionService {
@@ -59,5 +60,16 @@ func (c *connectionService) Reset() {
 
 // SessionID returns the session id
 func (c *connectionService) SessionID() int64 {
+	if gen, ok := c.generator.Load().(func() int64); ok && gen != nil {
+		return gen()
+	}
 	return atomic.AddInt64(&c.sid, 1)
 }
+
+// SetSessionIDGenerator replaces the sequential session ids with the ids returned
+// by gen, which must be unique among the sessions of the cluster, since sessions
+// are indexed by id on both frontend and backend nodes. The sequential session ids
+// are restored if gen is nil.
+func (c *connectionService) SetSessionIDGenerator(gen func() int64) {
+	c.generator.Store(gen)
+}
@@ -29,3 +29,17 @@ func TestNewConnectionService(t *testing.T) {
 		t.Error("wrong session id")
 	}
 }
+
+func TestConnectionService_SessionIDGenerator(t *testing.T) {
+	service := newConnectionService()
+	service.SetSessionIDGenerator(func() int64 { return 42 })
+	if id := service.SessionID(); id != 42 {
+		t.Fatalf("expect: 42, got: %d", id)
+	}
+
+	// restore the sequential ids
+	service.SetSessionIDGenerator(nil)
+	if id := service.SessionID(); id != 1 {
+		t.Fatalf("expect: 1, got: %d", id)
+	}
+}
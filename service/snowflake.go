@@ -0,0 +1,100 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Bits of the snowflake ids, an id is composed of the milliseconds since the
+// SnowflakeEpoch, the node id and the sequence within the millisecond:
+//
+//	| 0(1 bit) | timestamp(41 bits) | node(10 bits) | sequence(12 bits) |
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+
+	// MaxSnowflakeNode is the max node id of the snowflake ids
+	MaxSnowflakeNode = 1<<snowflakeNodeBits - 1
+	maxSequence      = 1<<snowflakeSequenceBits - 1
+)
+
+// SnowflakeEpoch is the start time of the timestamps of the snowflake ids
+var SnowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ErrIllegalNode represents the node id of snowflake is out of range
+var ErrIllegalNode = errors.New("snowflake node id should be in range [0, 1023]")
+
+// Snowflake generates the unique ids which embed the node id, so that the ids
+// generated by different nodes never collide and the node can be derived from
+// the id. Up to 4096 ids can be generated in a millisecond by a node, it waits for
+// the next millisecond if the sequence is exhausted, e.g: the session ids of a
+// frontend node, whose node id is 3:
+//
+//	sf, err := service.NewSnowflake(3)
+//	...
+//	nano.Listen(addr, nano.WithSessionIDGenerator(sf.Next))
+type Snowflake struct {
+	mu       sync.Mutex
+	node     int64
+	last     int64 // milliseconds of the last id
+	sequence int64
+}
+
+// NewSnowflake returns a Snowflake of node
+func NewSnowflake(node int64) (*Snowflake, error) {
+	if node < 0 || node > MaxSnowflakeNode {
+		return nil, ErrIllegalNode
+	}
+	return &Snowflake{node: node}, nil
+}
+
+// Next returns a new id
+func (s *Snowflake) Next() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Since(SnowflakeEpoch).Nanoseconds() / int64(time.Millisecond)
+	// the clock moved backwards, keep the ids increasing
+	if now < s.last {
+		now = s.last
+	}
+	if now == s.last {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			for now <= s.last {
+				time.Sleep(time.Millisecond / 10)
+				now = time.Since(SnowflakeEpoch).Nanoseconds() / int64(time.Millisecond)
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.last = now
+	return now<<(snowflakeNodeBits+snowflakeSequenceBits) | s.node<<snowflakeSequenceBits | s.sequence
+}
+
+// SnowflakeNode returns the node id embedded in the snowflake id
+func SnowflakeNode(id int64) int64 {
+	return (id >> snowflakeSequenceBits) & MaxSnowflakeNode
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSnowflake(t *testing.T) {
+	if _, err := NewSnowflake(MaxSnowflakeNode + 1); err != ErrIllegalNode {
+		t.Fatalf("expect: %v, got: %v", ErrIllegalNode, err)
+	}
+
+	const count = 10000
+	nodes := []int64{0, 3, MaxSnowflakeNode}
+	ids := make(chan int64, count*len(nodes))
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		sf, err := NewSnowflake(node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(node int64) {
+			defer wg.Done()
+			last := int64(0)
+			for i := 0; i < count; i++ {
+				id := sf.Next()
+				if id <= last {
+					t.Errorf("expect increasing ids, got %d after %d", id, last)
+					return
+				}
+				if n := SnowflakeNode(id); n != node {
+					t.Errorf("expect node: %d, got: %d", node, n)
+					return
+				}
+				last = id
+				ids <- id
+			}
+		}(node)
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := map[int64]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicated id: %d", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// ErrAttributeNotFound represents the session has no attribute with the key
+var ErrAttributeNotFound = errors.New("session attribute not found")
+
+// The typed setters below are shorthands of Set, which make the type of an attribute
+// explicit, so that it can be read by the getter of the same type, e.g: an untyped
+// constant passed to Set is stored as int and can not be read by Int64.
+
+// SetInt associates the int value with the key
+func (s *Session) SetInt(key string, value int) {
+	s.Set(key, value)
+}
+
+// SetInt64 associates the int64 value with the key
+func (s *Session) SetInt64(key string, value int64) {
+	s.Set(key, value)
+}
+
+// SetFloat64 associates the float64 value with the key
+func (s *Session) SetFloat64(key string, value float64) {
+	s.Set(key, value)
+}
+
+// SetString associates the string value with the key
+func (s *Session) SetString(key string, value string) {
+	s.Set(key, value)
+}
+
+// SetBool associates the bool value with the key
+func (s *Session) SetBool(key string, value bool) {
+	s.Set(key, value)
+}
+
+// Bool returns the value associated with the key as a bool.
+func (s *Session) Bool(key string) bool {
+	v, _ := s.Lookup(key)
+	value, _ := v.(bool)
+	return value
+}
+
+// SetBytes associates a copy of the value with the key, so that the caller can
+// reuse the slice afterwards.
+func (s *Session) SetBytes(key string, value []byte) {
+	s.Set(key, append([]byte(nil), value...))
+}
+
+// Bytes returns a copy of the value associated with the key as a []byte, which
+// can be modified without affecting the session. It returns nil if the key is
+// absent or the value is not a []byte.
+func (s *Session) Bytes(key string) []byte {
+	v, _ := s.Lookup(key)
+	value, ok := v.([]byte)
+	if !ok {
+		return nil
+	}
+	return append([]byte(nil), value...)
+}
+
+// SetJSON associates the json encoding of v with the key. The attribute is a
+// snapshot of v, the later changes of v are not visible to other goroutines
+// until it is set again, which avoids sharing mutable structs between the
+// handler and push goroutines.
+func (s *Session) SetJSON(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.Set(key, data)
+	return nil
+}
+
+// JSON decodes the attribute set by SetJSON into the value pointed to by v, each
+// call decodes a fresh copy.
+func (s *Session) JSON(key string, v interface{}) error {
+	data, err := s.blob(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// SetProto associates the protobuf encoding of m with the key, which has the same
+// snapshot semantics as SetJSON.
+func (s *Session) SetProto(key string, m proto.Message) error {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	s.Set(key, data)
+	return nil
+}
+
+// Proto decodes the attribute set by SetProto into m, each call decodes a fresh
+// copy.
+func (s *Session) Proto(key string, m proto.Message) error {
+	data, err := s.blob(key)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// blob returns the attribute stored as a []byte, the slice is shared with the
+// session and must not be modified.
+func (s *Session) blob(key string) ([]byte, error) {
+	v, ok := s.Lookup(key)
+	if !ok {
+		return nil, ErrAttributeNotFound
+	}
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("session attribute %s is %T, not an encoded blob", key, v)
+	}
+	return data, nil
+}
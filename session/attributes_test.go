@@ -0,0 +1,138 @@
+package session
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/lonng/nano/cluster/clusterpb"
+)
+
+func TestSession_TypedAttributes(t *testing.T) {
+	s := New(nil)
+	s.SetInt("level", 10)
+	s.SetInt64("gold", 1<<40)
+	s.SetFloat64("ratio", 0.5)
+	s.SetString("name", "nano")
+	s.SetBool("vip", true)
+
+	if s.Int("level") != 10 || s.Int64("gold") != 1<<40 || s.Float64("ratio") != 0.5 ||
+		s.String("name") != "nano" || !s.Bool("vip") {
+		t.Fatalf("unexpected attributes: %v", s.State())
+	}
+	if s.Bool("name") {
+		t.Fatal("expect false for the value of other types")
+	}
+}
+
+func TestSession_Bytes(t *testing.T) {
+	s := New(nil)
+	data := []byte("hello")
+	s.SetBytes("data", data)
+	data[0] = 'j'
+
+	got := s.Bytes("data")
+	if string(got) != "hello" {
+		t.Fatalf("expect: hello, got: %s", got)
+	}
+	got[0] = 'j'
+	if string(s.Bytes("data")) != "hello" {
+		t.Fatal("expect the attribute not to be affected by the copy")
+	}
+	if s.Bytes("absent") != nil {
+		t.Fatal("expect nil for the absent key")
+	}
+}
+
+func TestSession_Blob(t *testing.T) {
+	type profile struct {
+		Name  string
+		Items []int
+	}
+
+	s := New(nil)
+	p := &profile{Name: "nano", Items: []int{1, 2}}
+	if err := s.SetJSON("profile", p); err != nil {
+		t.Fatal(err)
+	}
+	p.Items[0] = 100
+
+	var got profile
+	if err := s.JSON("profile", &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "nano" || len(got.Items) != 2 || got.Items[0] != 1 {
+		t.Fatalf("unexpected profile: %+v", got)
+	}
+
+	m := &clusterpb.KickUsersRequest{Uids: []int64{1001}, Reason: "banned"}
+	if err := s.SetProto("kick", m); err != nil {
+		t.Fatal(err)
+	}
+	var kick clusterpb.KickUsersRequest
+	if err := s.Proto("kick", &kick); err != nil {
+		t.Fatal(err)
+	}
+	if len(kick.Uids) != 1 || kick.Uids[0] != 1001 || kick.Reason != "banned" {
+		t.Fatalf("unexpected message: %v", kick)
+	}
+
+	if err := s.JSON("absent", &got); err != ErrAttributeNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrAttributeNotFound, err)
+	}
+	s.Set("name", "nano")
+	if err := s.JSON("name", &got); err == nil {
+		t.Fatal("expect an error for the attribute not encoded")
+	}
+}
+
+func TestSession_OnAttributeChanged(t *testing.T) {
+	type change struct {
+		key        string
+		old, value interface{}
+	}
+
+	s := New(nil)
+	var changes []change
+	Lifetime.OnAttributeChanged(func(changed *Session, key string, old, value interface{}) {
+		if changed == s {
+			changes = append(changes, change{key, old, value})
+		}
+	})
+
+	s.SetInt("level", 1)
+	s.SetInt("level", 2)
+	s.Remove("level")
+	s.Remove("level")
+	// the detached copy does not fire the hooks
+	s.Fork(nil).SetInt("level", 3)
+
+	expects := []change{{"level", nil, 1}, {"level", 1, 2}, {"level", 2, nil}}
+	if len(changes) != len(expects) {
+		t.Fatalf("expect: %v, got: %v", expects, changes)
+	}
+	for i := range expects {
+		if changes[i] != expects[i] {
+			t.Fatalf("expect: %v, got: %v", expects, changes)
+		}
+	}
+}
+
+func TestSession_ConcurrentAttributes(t *testing.T) {
+	s := New(nil)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			s.SetInt("counter", i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			for range s.State() {
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,50 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+// BatchMessage is a push message sent in a batch by Session.SendBatch.
+type BatchMessage struct {
+	Route   string
+	Payload interface{}
+}
+
+// BatchSender is implemented by the network entities which can write a batch of
+// push messages to the low-level connection at once.
+type BatchSender interface {
+	SendBatch(messages []BatchMessage) error
+}
+
+// SendBatch pushes the messages to client atomically, no other message will be
+// written between the messages of the batch. All messages are serialized before
+// sending, and nothing is sent if any of them fails to serialize. The messages are
+// pushed one by one if the low-level network entity does not support batching,
+// e.g: the session is the backend session of a remote gate.
+func (s *Session) SendBatch(messages []BatchMessage) error {
+	if b, ok := s.entity.(BatchSender); ok {
+		return b.SendBatch(messages)
+	}
+	for _, m := range messages {
+		if err := s.entity.Push(m.Route, m.Payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
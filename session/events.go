@@ -0,0 +1,174 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import "sync"
+
+// EventType represents the type of session lifecycle events
+type EventType int
+
+// Session lifecycle events, which are published in the order they happen to a
+// session, EventBound, EventDataSynced and EventMigrated could be published more
+// than once.
+const (
+	// EventConnected is published when the session of a new connection is created
+	EventConnected EventType = iota
+	// EventHandshake is published when the handshake with the client is completed
+	EventHandshake
+	// EventBound is published when the session is bound to a uid
+	EventBound
+	// EventDataSynced is published when the data of the session is restored, e.g:
+	// loaded from the session store or resumed from another node
+	EventDataSynced
+	// EventClosed is published when the session is closed, with the close reason
+	EventClosed
+	// EventMigrated is published when the backend affinity of the session is moved
+	// to another member by Session.MigrateTo, with the address of the member
+	EventMigrated
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventHandshake:
+		return "handshake"
+	case EventBound:
+		return "bound"
+	case EventDataSynced:
+		return "data_synced"
+	case EventClosed:
+		return "closed"
+	case EventMigrated:
+		return "migrated"
+	default:
+		return "unknown"
+	}
+}
+
+// CloseReason represents why a session is closed, which tells the network churn
+// from the sessions closed by the server
+type CloseReason string
+
+// Session close reasons
+const (
+	// CloseReasonClosed represents the session is closed by the application, e.g:
+	// Session.Close
+	CloseReasonClosed CloseReason = "closed"
+	// CloseReasonDisconnected represents the client closed the connection
+	CloseReasonDisconnected CloseReason = "disconnected"
+	// CloseReasonReadError represents the connection is broken, e.g: reset by peer
+	CloseReasonReadError CloseReason = "read_error"
+	// CloseReasonReadTimeout represents the client has not sent a packet in time
+	CloseReasonReadTimeout CloseReason = "read_timeout"
+	// CloseReasonHeartbeatTimeout represents the client has not sent a heartbeat in time
+	CloseReasonHeartbeatTimeout CloseReason = "heartbeat_timeout"
+	// CloseReasonIdleTimeout represents the session is idle for too long
+	CloseReasonIdleTimeout CloseReason = "idle_timeout"
+	// CloseReasonProtocolError represents the client sent a malformed packet
+	CloseReasonProtocolError CloseReason = "protocol_error"
+	// CloseReasonKicked represents the session is kicked, e.g: Session.Kick or the
+	// duplicate login
+	CloseReasonKicked CloseReason = "kicked"
+	// CloseReasonShutdown represents the server is shutting down
+	CloseReasonShutdown CloseReason = "shutdown"
+	// CloseReasonRateLimited represents the client exceeded the rate limit
+	CloseReasonRateLimited CloseReason = "rate_limited"
+	// CloseReasonOverflow represents the client reads slower than the server pushes,
+	// see cluster.OverflowClose
+	CloseReasonOverflow CloseReason = "send_queue_overflow"
+	// CloseReasonResumed represents the session is replaced by the resumed one
+	CloseReasonResumed CloseReason = "resumed"
+	// CloseReasonMigrated represents the backend affinity of the session is moved
+	// to another member, which is seen by the members served the session before
+	CloseReasonMigrated CloseReason = "migrated"
+)
+
+// Event represents a session lifecycle event
+type Event struct {
+	Type    EventType
+	Session *Session
+	UID     int64       // the uid bound to, set for EventBound
+	Reason  CloseReason // why the session is closed, set for EventClosed
+	Member  string      // the address of member migrated to, set for EventMigrated
+}
+
+// EventHandler represents a subscriber of session lifecycle events
+type EventHandler func(e Event)
+
+// Subscription represents the registration of an EventHandler
+type Subscription struct {
+	bus     *eventBus
+	handler EventHandler
+	types   map[EventType]bool // nil for all types
+}
+
+// eventBus dispatches the session lifecycle events to the subscribers
+type eventBus struct {
+	mu   sync.RWMutex
+	subs []*Subscription
+}
+
+func (b *eventBus) subscribe(h EventHandler, types []EventType) *Subscription {
+	sub := &Subscription{bus: b, handler: h}
+	if len(types) > 0 {
+		sub.types = make(map[EventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// copy on write, so that publishing needs no allocation
+	subs := make([]*Subscription, 0, len(b.subs)+1)
+	b.subs = append(append(subs, b.subs...), sub)
+	return sub
+}
+
+// Unsubscribe removes the subscription, the handler will not be called for the
+// events published afterwards.
+func (sub *Subscription) Unsubscribe() {
+	b := sub.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := make([]*Subscription, 0, len(b.subs))
+	for _, s := range b.subs {
+		if s != sub {
+			subs = append(subs, s)
+		}
+	}
+	b.subs = subs
+}
+
+func (b *eventBus) publish(e Event) {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		if sub.types == nil || sub.types[e.Type] {
+			sub.handler(e)
+		}
+	}
+}
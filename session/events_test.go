@@ -0,0 +1,58 @@
+package session
+
+import "testing"
+
+func TestLifetime_Subscribe(t *testing.T) {
+	s := New(nil)
+	var all, closed []Event
+	sub := Lifetime.Subscribe(func(e Event) {
+		if e.Session == s {
+			all = append(all, e)
+		}
+	})
+	defer Lifetime.Subscribe(func(e Event) {
+		if e.Session == s {
+			closed = append(closed, e)
+		}
+	}, EventClosed).Unsubscribe()
+
+	Lifetime.Publish(Event{Type: EventConnected, Session: s})
+	if err := s.Bind(1001); err != nil {
+		t.Fatal(err)
+	}
+	sub.Unsubscribe()
+	Lifetime.CloseWithReason(s, "heartbeat_timeout")
+
+	if len(all) != 2 || all[0].Type != EventConnected || all[1].Type != EventBound || all[1].UID != 1001 {
+		t.Fatalf("unexpected events: %v", all)
+	}
+	if len(closed) != 1 || closed[0].Type != EventClosed || closed[0].Reason != "heartbeat_timeout" {
+		t.Fatalf("unexpected events: %v", closed)
+	}
+}
+
+func TestSession_CloseReason(t *testing.T) {
+	s := New(nil)
+	var reason CloseReason
+	calls := 0
+	hook := Lifetime.OnClosed(func(closed *Session) {
+		if closed == s {
+			reason = closed.CloseReason()
+			calls++
+		}
+	})
+	if s.CloseReason() != "" {
+		t.Fatalf("unexpected close reason of the alive session: %s", s.CloseReason())
+	}
+	Lifetime.CloseWithReason(s, CloseReasonKicked)
+	if reason != CloseReasonKicked {
+		t.Fatalf("expect: %s, got: %s", CloseReasonKicked, reason)
+	}
+
+	// the removed hook is not called any more
+	hook.Remove()
+	Lifetime.Close(s)
+	if calls != 1 {
+		t.Fatalf("expect the hook called once, got: %d", calls)
+	}
+}
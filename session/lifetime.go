@@ -1,14 +1,44 @@
 package session
 
+import "sync"
+
 type (
 	// LifetimeHandler represents a callback
 	// that will be called when a session close or
 	// session low-level connection broken.
 	LifetimeHandler func(*Session)
 
+	// BindHandler represents a callback that will be called
+	// when a session is bound to a uid, old is the uid bound
+	// before, or 0 if the session has not been bound.
+	BindHandler func(s *Session, old int64)
+
+	// BindGuard represents a callback that will be called
+	// before a session is bound to a uid, the binding will
+	// be rejected if an error is returned.
+	BindGuard func(s *Session, uid int64) error
+
+	// AttributeHandler represents a callback that will be called
+	// after an attribute of a session is set or removed, value is
+	// nil if the attribute is removed.
+	AttributeHandler func(s *Session, key string, old, value interface{})
+
 	lifetime struct {
-		// callbacks that emitted on session closed
-		onClosed []LifetimeHandler
+		mu sync.RWMutex
+		// callbacks registered in order, copy on write
+		hooks []*Hook
+		// subscribers of the lifecycle events
+		events eventBus
+	}
+
+	// Hook represents the registration of a lifetime callback, which can be
+	// removed, e.g: the callbacks of a node are removed on shutdown.
+	Hook struct {
+		lt        *lifetime
+		closed    LifetimeHandler
+		bind      BindHandler
+		binding   BindGuard
+		attribute AttributeHandler
 	}
 )
 
@@ -16,16 +46,136 @@ var Lifetime = &lifetime{}
 
 // OnClosed set the Callback which will be called
 // when session is closed Waring: session has closed.
-func (lt *lifetime) OnClosed(h LifetimeHandler) {
-	lt.onClosed = append(lt.onClosed, h)
+func (lt *lifetime) OnClosed(h LifetimeHandler) *Hook {
+	return lt.add(&Hook{closed: h})
 }
 
-func (lt *lifetime) Close(s *Session) {
-	if len(lt.onClosed) < 1 {
+// OnBind set the Callback which will be called
+// when session is bound to a new uid.
+func (lt *lifetime) OnBind(h BindHandler) *Hook {
+	return lt.add(&Hook{bind: h})
+}
+
+// OnBinding set the Callback which will be called before
+// session is bound to a uid, the binding is rejected if the
+// callback returns an error.
+func (lt *lifetime) OnBinding(h BindGuard) *Hook {
+	return lt.add(&Hook{binding: h})
+}
+
+// OnAttributeChanged set the Callback which will be called
+// after an attribute of session is set or removed, it is
+// called on the goroutine changing the attribute.
+func (lt *lifetime) OnAttributeChanged(h AttributeHandler) *Hook {
+	return lt.add(&Hook{attribute: h})
+}
+
+func (lt *lifetime) add(h *Hook) *Hook {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	h.lt = lt
+	hooks := make([]*Hook, 0, len(lt.hooks)+1)
+	lt.hooks = append(append(hooks, lt.hooks...), h)
+	return h
+}
+
+// Remove removes the callback, it will not be called for the sessions
+// changed afterwards.
+func (h *Hook) Remove() {
+	lt := h.lt
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	hooks := make([]*Hook, 0, len(lt.hooks))
+	for _, hook := range lt.hooks {
+		if hook != h {
+			hooks = append(hooks, hook)
+		}
+	}
+	lt.hooks = hooks
+}
+
+func (lt *lifetime) snapshot() []*Hook {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+	return lt.hooks
+}
+
+// Subscribe registers the handler for the session lifecycle events of types, or all
+// events if no type is specified, e.g: analytics, presence and anti-cheat modules
+// can subscribe independently. The handler is called synchronously on the goroutine
+// publishing the event, and should not block.
+func (lt *lifetime) Subscribe(h EventHandler, types ...EventType) *Subscription {
+	return lt.events.subscribe(h, types)
+}
+
+// Publish dispatches the event to the subscribers, which is called by the network
+// layer, e.g: on connected or handshake completed.
+func (lt *lifetime) Publish(e Event) {
+	lt.events.publish(e)
+}
+
+func (lt *lifetime) attributeChanged(s *Session, key string, old, value interface{}) {
+	// the detached sessions do not fire the lifetime hooks
+	if s.store == nil {
 		return
 	}
+	persisted.changed(s, key)
+	for _, h := range lt.snapshot() {
+		if h.attribute != nil {
+			h.attribute(s, key, old, value)
+		}
+	}
+}
+
+func (lt *lifetime) binding(s *Session, uid int64) error {
+	for _, h := range lt.snapshot() {
+		if h.binding == nil {
+			continue
+		}
+		if err := h.binding(s, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lt *lifetime) Bind(s *Session, old int64) {
+	// the persistent attributes are restored before the callbacks, so that they
+	// are visible to the callbacks
+	restored := old == 0 && s.store != nil && persisted.restore(s)
+	for _, h := range lt.snapshot() {
+		if h.bind != nil {
+			h.bind(s, old)
+		}
+	}
+	lt.Publish(Event{Type: EventBound, Session: s, UID: s.UID()})
+	if restored {
+		lt.Publish(Event{Type: EventDataSynced, Session: s})
+	}
+}
+
+func (lt *lifetime) Close(s *Session) {
+	lt.CloseWithReason(s, CloseReasonClosed)
+}
+
+// CloseWithReason fires the closed callbacks and publishes the EventClosed with
+// the reason, e.g: CloseReasonHeartbeatTimeout. The reason can be read by the
+// callbacks with Session.CloseReason.
+func (lt *lifetime) CloseWithReason(s *Session, reason CloseReason) {
+	s.setCloseReason(reason)
+	// saved before the callbacks, which may clear the session
+	if s.store != nil {
+		persisted.closed(s)
+	}
+	s.closeStreams()
+	s.untagAll()
 
-	for _, h := range lt.onClosed {
-		h(s)
+	for _, h := range lt.snapshot() {
+		if h.closed != nil {
+			h.closed(s)
+		}
 	}
+	lt.Publish(Event{Type: EventClosed, Session: s, Reason: reason})
 }
@@ -0,0 +1,221 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import "sync"
+
+type (
+	// PersistHandler represents a callback that saves the persistent attributes of
+	// the user, attrs replaces the attributes saved before, i.e. the removed ones
+	// are absent.
+	PersistHandler func(uid int64, attrs map[string]interface{}) error
+
+	// RestoreHandler represents a callback that loads the persistent attributes
+	// saved for the user, which returns nil if nothing is saved.
+	RestoreHandler func(uid int64) (map[string]interface{}, error)
+)
+
+// persistence tracks the changes of the persistent attributes, so that only the
+// sessions whose persistent attributes changed are saved by Flush
+type persistence struct {
+	mu        sync.Mutex
+	keys      map[string]bool
+	onPersist PersistHandler
+	onRestore RestoreHandler
+	dirty     map[*Session]bool
+	pending   map[int64]map[string]interface{} // attributes of closed sessions failed to save
+}
+
+var persisted = &persistence{
+	keys:    map[string]bool{},
+	dirty:   map[*Session]bool{},
+	pending: map[int64]map[string]interface{}{},
+}
+
+// Persistent designates the attributes of keys to be persisted, which are saved
+// by the PersistHandler after they are changed and restored by the RestoreHandler
+// when a session is bound to the uid, e.g: the lightweight player state.
+func Persistent(keys ...string) {
+	persisted.mu.Lock()
+	defer persisted.mu.Unlock()
+	for _, k := range keys {
+		persisted.keys[k] = true
+	}
+}
+
+// OnPersist sets the handler saving the persistent attributes, which is called
+// by Flush for the bound sessions whose persistent attributes changed, and when
+// such a session is closed. It is called synchronously, so the store should
+// respond in time.
+func OnPersist(h PersistHandler) {
+	persisted.mu.Lock()
+	defer persisted.mu.Unlock()
+	persisted.onPersist = h
+}
+
+// OnRestore sets the handler loading the persistent attributes, which is called
+// when a session is bound to a uid for the first time, the attributes which have
+// been set on the session are not overwritten.
+func OnRestore(h RestoreHandler) {
+	persisted.mu.Lock()
+	defer persisted.mu.Unlock()
+	persisted.onRestore = h
+}
+
+// Flush saves the changed persistent attributes of the bound sessions and the
+// closed sessions failed to save before, which is called periodically by the
+// node, see nano.WithPersistInterval. The failed ones are retried in the next
+// flush, and the first error is returned.
+func Flush() error {
+	p := persisted
+	p.mu.Lock()
+	h := p.onPersist
+	if h == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	pending := p.pending
+	p.pending = map[int64]map[string]interface{}{}
+	var sessions []*Session
+	for s := range p.dirty {
+		// the changes before binding are saved once the session is bound
+		if s.UID() > 0 {
+			sessions = append(sessions, s)
+			delete(p.dirty, s)
+		}
+	}
+	p.mu.Unlock()
+
+	var first error
+	for uid, attrs := range pending {
+		if err := h(uid, attrs); err != nil {
+			p.retry(uid, attrs)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	for _, s := range sessions {
+		if err := h(s.UID(), p.snapshot(s)); err != nil {
+			p.mu.Lock()
+			p.dirty[s] = true
+			p.mu.Unlock()
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// retry keeps the attributes to be saved by the next flush, unless a newer
+// snapshot of the uid has been kept
+func (p *persistence) retry(uid int64, attrs map[string]interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.pending[uid]; !ok {
+		p.pending[uid] = attrs
+	}
+}
+
+func (p *persistence) snapshot(s *Session) map[string]interface{} {
+	p.mu.Lock()
+	keys := make([]string, 0, len(p.keys))
+	for k := range p.keys {
+		keys = append(keys, k)
+	}
+	p.mu.Unlock()
+
+	s.RLock()
+	defer s.RUnlock()
+	attrs := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		if v, ok := s.data[k]; ok {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+// changed marks the session dirty if the attribute is persistent
+func (p *persistence) changed(s *Session, key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.onPersist != nil && p.keys[key] {
+		p.dirty[s] = true
+	}
+}
+
+// restore sets the persistent attributes saved for the uid of the session, the
+// attributes not saved yet take precedence over the ones of the store. It returns
+// false if nothing is restored.
+func (p *persistence) restore(s *Session) bool {
+	uid := s.UID()
+	p.mu.Lock()
+	h := p.onRestore
+	attrs, ok := p.pending[uid]
+	p.mu.Unlock()
+
+	if !ok {
+		if h == nil {
+			return false
+		}
+		var err error
+		if attrs, err = h(uid); err != nil || attrs == nil {
+			return false
+		}
+	}
+
+	// restoring is not a change, so the attribute hooks are not fired
+	s.Lock()
+	defer s.Unlock()
+	for k, v := range attrs {
+		if _, found := s.data[k]; !found {
+			s.data[k] = v
+		}
+	}
+	return true
+}
+
+// closed saves the persistent attributes of the closed session if changed, which
+// is kept to be retried by the next flush if failed
+func (p *persistence) closed(s *Session) {
+	p.mu.Lock()
+	h, dirty := p.onPersist, p.dirty[s]
+	delete(p.dirty, s)
+	p.mu.Unlock()
+
+	uid := s.UID()
+	if h == nil || !dirty || uid < 1 {
+		return
+	}
+	attrs := p.snapshot(s)
+	err := h(uid, attrs)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.pending[uid] = attrs
+	} else {
+		// the older snapshot must not overwrite the saved one
+		delete(p.pending, uid)
+	}
+}
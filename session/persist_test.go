@@ -0,0 +1,82 @@
+package session
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPersistent(t *testing.T) {
+	const uid = 2001
+	saved := map[int64]map[string]interface{}{}
+	var saves int
+	var failure error
+	Persistent("persist.level")
+	OnPersist(func(uid int64, attrs map[string]interface{}) error {
+		if failure != nil {
+			return failure
+		}
+		saves++
+		saved[uid] = attrs
+		return nil
+	})
+	OnRestore(func(uid int64) (map[string]interface{}, error) {
+		return saved[uid], nil
+	})
+	defer OnPersist(nil)
+	defer OnRestore(nil)
+
+	s := New(nil)
+	s.Set("persist.level", 3)
+	s.Set("persist.temp", "x")
+	if err := Flush(); err != nil || saves != 0 {
+		t.Fatalf("the unbound session is saved, saves=%d, err=%v", saves, err)
+	}
+	if err := s.Bind(uid); err != nil {
+		t.Fatal(err)
+	}
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"persist.level": 3}; saves != 1 || !reflect.DeepEqual(saved[uid], want) {
+		t.Fatalf("saved %v, want %v", saved[uid], want)
+	}
+	s.Set("persist.temp", "y")
+	if err := Flush(); err != nil || saves != 1 {
+		t.Fatalf("the unchanged attributes are saved, saves=%d, err=%v", saves, err)
+	}
+
+	// the failed saving of the closed session is restored and retried
+	s.Set("persist.level", 4)
+	failure = errors.New("store unavailable")
+	Lifetime.Close(s)
+	s2 := New(nil)
+	if err := s2.Bind(uid); err != nil {
+		t.Fatal(err)
+	}
+	if s2.Int("persist.level") != 4 {
+		t.Fatalf("restored level %v, want 4", s2.Value("persist.level"))
+	}
+	if err := Flush(); err != failure {
+		t.Fatalf("got error %v, want %v", err, failure)
+	}
+	failure = nil
+	if err := Flush(); err != nil || saved[uid]["persist.level"] != 4 {
+		t.Fatalf("saved %v, err=%v", saved[uid], err)
+	}
+
+	// the attributes set before binding are not overwritten
+	Lifetime.Close(s2)
+	s3 := New(nil)
+	s3.Set("persist.level", 1)
+	if err := s3.Bind(uid); err != nil {
+		t.Fatal(err)
+	}
+	if s3.Int("persist.level") != 1 {
+		t.Fatalf("restored level %v, want 1", s3.Value("persist.level"))
+	}
+	Lifetime.Close(s3)
+	if saved[uid]["persist.level"] != 1 {
+		t.Fatalf("saved %v on close", saved[uid])
+	}
+}
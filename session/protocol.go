@@ -0,0 +1,39 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+// ProtocolVersioner is implemented by the network entities which negotiate the
+// protocol version of message layer with the client.
+type ProtocolVersioner interface {
+	Protocol() int
+}
+
+// Protocol returns the protocol version of message layer negotiated with the client,
+// either by the WebSocket subprotocol or in handshake, which can be used to select
+// the serializer or the features available to the client. Zero is returned if the
+// low-level network entity does not negotiate the version, e.g: the session is the
+// backend session of a remote gate.
+func (s *Session) Protocol() int {
+	if p, ok := s.entity.(ProtocolVersioner); ok {
+		return p.Protocol()
+	}
+	return 0
+}
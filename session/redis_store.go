@@ -0,0 +1,133 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"strconv"
+
+	"github.com/go-redis/redis"
+)
+
+// unbindScript deletes the binding of a uid only if it is still bound to the
+// session, so that a late unbind of the old session does not remove the binding
+// of the new one.
+var unbindScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'sid') == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisStore is a Store backed by Redis, the binding of each uid is saved in the
+// hash <prefix>user:<uid> with the fields sid and addr, and the data of each uid
+// is saved in the hash <prefix>data:<uid>.
+//
+// The bindings of a node which exits without closing its sessions, e.g: killed,
+// are left in Redis until the users bind again.
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore returns a Store backed by the redis client, the default prefix of
+// keys is "nano:session:"
+func NewRedisStore(client redis.Cmdable, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "nano:session:"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (r *RedisStore) userKey(uid int64) string {
+	return r.prefix + "user:" + strconv.FormatInt(uid, 10)
+}
+
+func (r *RedisStore) dataKey(uid int64) string {
+	return r.prefix + "data:" + strconv.FormatInt(uid, 10)
+}
+
+// Bind implements the Store interface
+func (r *RedisStore) Bind(uid, sid int64, addr string) error {
+	return r.client.HMSet(r.userKey(uid), map[string]interface{}{
+		"sid":  sid,
+		"addr": addr,
+	}).Err()
+}
+
+// Unbind implements the Store interface
+func (r *RedisStore) Unbind(uid, sid int64) error {
+	return unbindScript.Run(r.client, []string{r.userKey(uid)}, strconv.FormatInt(sid, 10)).Err()
+}
+
+// Locate implements the Store interface
+func (r *RedisStore) Locate(uids []int64) (map[int64]string, error) {
+	cmds := make([]*redis.StringCmd, len(uids))
+	_, err := r.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, uid := range uids {
+			cmds[i] = pipe.HGet(r.userKey(uid), "addr")
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	addrs := make(map[int64]string, len(uids))
+	for i, cmd := range cmds {
+		if addr, err := cmd.Result(); err == nil {
+			addrs[uids[i]] = addr
+		}
+	}
+	return addrs, nil
+}
+
+// Save implements the Store interface
+func (r *RedisStore) Save(uid int64, data map[string][]byte) error {
+	key := r.dataKey(uid)
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(key)
+		if len(data) == 0 {
+			return nil
+		}
+		fields := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			fields[k] = v
+		}
+		pipe.HMSet(key, fields)
+		return nil
+	})
+	return err
+}
+
+// Load implements the Store interface
+func (r *RedisStore) Load(uid int64) (map[string][]byte, error) {
+	fields, err := r.client.HGetAll(r.dataKey(uid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	data := make(map[string][]byte, len(fields))
+	for k, v := range fields {
+		data[k] = []byte(v)
+	}
+	return data, nil
+}
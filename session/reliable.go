@@ -0,0 +1,50 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+// AckRoute is the route of the notify which is sent by the client to acknowledge
+// a reliable push, the payload is a JSON object which contains the message id of
+// the reliable push, e.g: {"seq": 12}
+const AckRoute = "sys.ack"
+
+// ReliablePusher is implemented by the network entities which can deliver pushes
+// at least once, the push is resent until it is acknowledged by the client.
+type ReliablePusher interface {
+	PushReliable(route string, v interface{}) error
+}
+
+// PushReliable pushes message to client with at-least-once delivery, which is used
+// for the critical game events. The push is tagged with a sequence id and resent
+// with backoff until the client acknowledges it by a notify to AckRoute, and the
+// session will be closed if the push is not acknowledged after all retries. So the
+// client may receive a reliable push more than once, and should deduplicate it by
+// the sequence id. The reliable pushes and the plain pushes share the same route
+// space and outbound queue.
+//
+// PushReliable falls back to a plain push if the low-level network entity or the
+// client does not support it, e.g: the client has not negotiated protocol V3, or
+// the session is the backend session of a remote gate.
+func (s *Session) PushReliable(route string, v interface{}) error {
+	if p, ok := s.entity.(ReliablePusher); ok {
+		return p.PushReliable(route, v)
+	}
+	return s.entity.Push(route, v)
+}
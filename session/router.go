@@ -25,6 +25,7 @@ import "sync"
 // Router is used to select remote service address
 type Router struct {
 	routes sync.Map
+	pinned sync.Map // services pinned to an address by Session.MigrateTo
 }
 
 func newRouter() *Router {
@@ -36,6 +37,35 @@ func (r *Router) Bind(service, address string) {
 	r.routes.Store(service, address)
 }
 
+// Pin bound an address to remote service, the pinned address takes precedence
+// over the address chosen by the routing strategies, e.g: the session affinity
+// router, until the service is pinned to another address
+func (r *Router) Pin(service, address string) {
+	r.pinned.Store(service, address)
+	r.routes.Store(service, address)
+}
+
+// Pinned returns the address the remote service is pinned to
+func (r *Router) Pinned(service string) (string, bool) {
+	v, found := r.pinned.Load(service)
+	if !found {
+		return "", false
+	}
+	return v.(string), true
+}
+
+// Services returns the remote services bound to address
+func (r *Router) Services(address string) []string {
+	var services []string
+	r.routes.Range(func(k, v interface{}) bool {
+		if v.(string) == address {
+			services = append(services, k.(string))
+		}
+		return true
+	})
+	return services
+}
+
 // Find finds the address corresponding a remote service
 func (r *Router) Find(service string) (string, bool) {
 	v, found := r.routes.Load(service)
@@ -0,0 +1,71 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// ContextRPCer is implemented by the network entities which can bound the RPC
+// with a context, and report whether the remote member has accepted the message.
+type ContextRPCer interface {
+	RPCContext(ctx context.Context, route string, v interface{}) error
+}
+
+// FallbackRPCer is implemented by the network entities which can answer the failed
+// or timed out RPC with a fallback.
+type FallbackRPCer interface {
+	RPCWithFallback(route string, v interface{}, timeout time.Duration, fallback func(error) error) error
+}
+
+// RPCContext sends message to remote server and waits until the message is accepted
+// by the remote member or ctx is done. Unlike RPC, the error of forwarding is returned
+// to the caller, so a retry policy can be built on top of it.
+//
+// RPCContext falls back to RPC if the low-level network entity does not support it.
+func (s *Session) RPCContext(ctx context.Context, route string, v interface{}) error {
+	if r, ok := s.entity.(ContextRPCer); ok {
+		return r.RPCContext(ctx, route, v)
+	}
+	return s.entity.RPC(route, v)
+}
+
+// RPCWithFallback sends message to remote server with a deadline, if the call is
+// failed or not accepted within timeout, the fallback is called with the error and
+// its result is returned instead, e.g: return a cached value or a default answer
+// to the client when the backend is degraded. The fallback is counted by the
+// metric rpc_fallback_total, labeled by route.
+//
+// The deadline bounds a single attempt, a retry policy should retry RPCContext
+// inside the fallback or wrap the whole call, rather than extend the timeout.
+func (s *Session) RPCWithFallback(route string, v interface{}, timeout time.Duration, fallback func(error) error) error {
+	if r, ok := s.entity.(FallbackRPCer); ok {
+		return r.RPCWithFallback(route, v, timeout, fallback)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := s.RPCContext(ctx, route, v)
+	if err != nil && fallback != nil {
+		return fallback(err)
+	}
+	return err
+}
@@ -23,7 +23,9 @@ package session
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -42,9 +44,54 @@ type NetworkEntity interface {
 	RemoteAddr() net.Addr
 }
 
+// PriorityPusher is implemented by the network entities which can deliver pushes
+// out of order according to their priority.
+type PriorityPusher interface {
+	PushWithPriority(route string, v interface{}, priority int) error
+}
+
+// RawSender is implemented by the network entities which can write a payload
+// from a reader to the low-level connection without allocating it in memory.
+type RawSender interface {
+	SendRaw(route string, r io.Reader, length int) error
+}
+
+// Kicker is implemented by the network entities which can make sure the kick
+// message has been written before the low-level connection is closed.
+type Kicker interface {
+	Kick(reason interface{}) error
+}
+
+// AffinityMigrator is implemented by the network entities which can move the
+// backend affinity of the session to another member of the cluster.
+type AffinityMigrator interface {
+	MigrateAffinity(addr string, withAttributes bool) error
+}
+
+// KickRoute is the route of the message pushed to client before the session is
+// kicked, whose payload is the reason passed to Session.Kick.
+const KickRoute = "onKick"
+
+// Push priorities, messages with higher priority will be written before the lower
+// ones when the outbound queue has a backlog, and messages with the same priority
+// are written in FIFO order.
+const (
+	PriorityLow = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityCritical
+)
+
 var (
 	//ErrIllegalUID represents a invalid uid
 	ErrIllegalUID = errors.New("illegal uid")
+
+	// ErrDeviceChanged represents the device of a bound session is changed
+	ErrDeviceChanged = errors.New("device of bound session can not be changed")
+
+	// ErrMigrationUnsupported represents the network entity of session can not
+	// migrate its backend affinity, e.g: the sessions of backend nodes
+	ErrMigrationUnsupported = errors.New("session affinity can not be migrated")
 )
 
 // Session represents a client session which could storage temp data during low-level
@@ -58,9 +105,16 @@ type Session struct {
 	lastTime     int64                  // last heartbeat time
 	entity       NetworkEntity          // low-level network entity
 	data         map[string]interface{} // session data store
+	device       string                 // device tag, e.g: mobile
+	closeReason  CloseReason            // why the session is closed
 	router       *Router
-	callInitTime int64         //每个消息调用开始
-	callTimes    []msgCallTime //打点记录
+	streams      map[uint64]*Stream // opened streams, keyed by request id
+	callInitTime int64              //每个消息调用开始
+	callTimes    []msgCallTime      //打点记录
+
+	tagMu sync.Mutex        // protect tags
+	tags  map[string]string // tags indexed in store
+	store *SessionStore     // store of the tags, nil for detached sessions
 }
 type msgCallTime struct {
 	Name string
@@ -78,6 +132,7 @@ func New(entity NetworkEntity) *Session {
 		router:       newRouter(),
 		callInitTime: 0,
 		callTimes:    make([]msgCallTime, 0),
+		store:        Sessions,
 	}
 }
 
@@ -101,6 +156,56 @@ func (s *Session) Push(route string, v interface{}) error {
 	return s.entity.Push(route, v)
 }
 
+// PushWithPriority pushes message to client with the specified priority, the
+// priority will be ignored if the low-level network entity does not support it.
+func (s *Session) PushWithPriority(route string, v interface{}, priority int) error {
+	if p, ok := s.entity.(PriorityPusher); ok {
+		return p.PushWithPriority(route, v, priority)
+	}
+	return s.entity.Push(route, v)
+}
+
+// SendRaw pushes length bytes read from r to client as the payload of route, which
+// is used to send binary payloads, e.g: map files or assets. The payload is read into
+// a pooled buffer if the low-level network entity supports it, otherwise it will be
+// pushed as a []byte, and the packet can not exceed the max packet size of client.
+// SendRaw returns after the payload has been consumed, so r can be closed afterwards.
+func (s *Session) SendRaw(route string, r io.Reader, length int) error {
+	if rs, ok := s.entity.(RawSender); ok {
+		return rs.SendRaw(route, r, length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return s.entity.Push(route, data)
+}
+
+// Kick pushes the reason to client with the route KickRoute and closes the session,
+// so the client can tell why it is disconnected, e.g: banned, logged in elsewhere
+// or maintenance. The reason is serialized by the serializer like other pushes.
+func (s *Session) Kick(reason interface{}) error {
+	if k, ok := s.entity.(Kicker); ok {
+		return k.Kick(reason)
+	}
+	err := s.entity.Push(KickRoute, reason)
+	s.Close()
+	return err
+}
+
+// MigrateTo moves the backend affinity of current session to the member serving
+// at addr, the requests of the services served by the member will be routed to it
+// afterwards, e.g: when the match of the user moves to another server. The session
+// attributes are copied to the member if withAttributes is true, and the members
+// served the session before are notified with the session closed by the reason
+// CloseReasonMigrated. EventMigrated is published once the session is migrated.
+func (s *Session) MigrateTo(addr string, withAttributes bool) error {
+	if m, ok := s.entity.(AffinityMigrator); ok {
+		return m.MigrateAffinity(addr, withAttributes)
+	}
+	return ErrMigrationUnsupported
+}
+
 // Response message to client
 func (s *Session) Response(v interface{}) error {
 	return s.entity.Response(v)
@@ -127,16 +232,70 @@ func (s *Session) LastMid() uint64 {
 	return s.entity.LastMid()
 }
 
-// Bind bind UID to current session
+// Bind bind UID to current session, the error returned by the callbacks set by
+// Lifetime.OnBinding will be returned if the binding is rejected
 func (s *Session) Bind(uid int64) error {
 	if uid < 1 {
 		return ErrIllegalUID
 	}
+	if uid != s.UID() {
+		if err := Lifetime.binding(s, uid); err != nil {
+			return err
+		}
+	}
 
-	atomic.StoreInt64(&s.uid, uid)
+	if old := atomic.SwapInt64(&s.uid, uid); old != uid {
+		Lifetime.Bind(s, old)
+	}
+	return nil
+}
+
+// BindDevice binds uid to current session with the device tag, e.g: "mobile" or
+// "pc", the sessions of a uid with different device tags can be online at the same
+// time, and the duplicate login policy applies to the sessions of the same device.
+// The device of a bound session can not be changed.
+func (s *Session) BindDevice(uid int64, device string) error {
+	s.Lock()
+	if s.UID() > 0 && s.device != device {
+		s.Unlock()
+		return ErrDeviceChanged
+	}
+	old := s.device
+	s.device = device
+	s.Unlock()
+
+	if err := s.Bind(uid); err != nil {
+		s.Lock()
+		s.device = old
+		s.Unlock()
+		return err
+	}
 	return nil
 }
 
+// Device returns the device tag of current session, which is empty if the
+// session is bound by Bind.
+func (s *Session) Device() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.device
+}
+
+// CloseReason returns why current session is closed, which is set before the
+// callbacks set by Lifetime.OnClosed are called, e.g: to tell the network churn
+// from the kicks. It is empty if the session has not been closed.
+func (s *Session) CloseReason() CloseReason {
+	s.RLock()
+	defer s.RUnlock()
+	return s.closeReason
+}
+
+func (s *Session) setCloseReason(reason CloseReason) {
+	s.Lock()
+	s.closeReason = reason
+	s.Unlock()
+}
+
 // Close terminate current session, session related data will not be released,
 // all related data should be Clear explicitly in Session closed callback
 func (s *Session) Close() {
@@ -154,17 +313,23 @@ func (s *Session) RemoteAddr() net.Addr {
 // Remove delete data associated with the key from session storage
 func (s *Session) Remove(key string) {
 	s.Lock()
-	defer s.Unlock()
-
+	old, found := s.data[key]
 	delete(s.data, key)
+	s.Unlock()
+
+	if found {
+		Lifetime.attributeChanged(s, key, old, nil)
+	}
 }
 
 // Set associates value with the key in session storage
 func (s *Session) Set(key string, value interface{}) {
 	s.Lock()
-	defer s.Unlock()
-
+	old := s.data[key]
 	s.data[key] = value
+	s.Unlock()
+
+	Lifetime.attributeChanged(s, key, old, value)
 }
 
 // HasKey decides whether a key has associated value
@@ -405,20 +570,124 @@ func (s *Session) Value(key string) interface{} {
 	return s.data[key]
 }
 
-// State returns all session state
+// Lookup returns the value associated with the key, the boolean is false if the
+// key is absent.
+func (s *Session) Lookup(key string) (interface{}, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	v, ok := s.data[key]
+	return v, ok
+}
+
+// LookupInt returns the value associated with the key as a int, the boolean is
+// false if the key is absent or the value is not a int.
+func (s *Session) LookupInt(key string) (int, bool) {
+	v, _ := s.Lookup(key)
+	value, ok := v.(int)
+	return value, ok
+}
+
+// LookupInt64 returns the value associated with the key as a int64, the boolean
+// is false if the key is absent or the value is not a int64.
+func (s *Session) LookupInt64(key string) (int64, bool) {
+	v, _ := s.Lookup(key)
+	value, ok := v.(int64)
+	return value, ok
+}
+
+// LookupFloat64 returns the value associated with the key as a float64, the
+// boolean is false if the key is absent or the value is not a float64.
+func (s *Session) LookupFloat64(key string) (float64, bool) {
+	v, _ := s.Lookup(key)
+	value, ok := v.(float64)
+	return value, ok
+}
+
+// LookupString returns the value associated with the key as a string, the boolean
+// is false if the key is absent or the value is not a string.
+func (s *Session) LookupString(key string) (string, bool) {
+	v, _ := s.Lookup(key)
+	value, ok := v.(string)
+	return value, ok
+}
+
+// ValueAs stores the value associated with the key into the value pointed to by
+// ptr, e.g:
+//
+//	var p *Player
+//	if s.ValueAs("player", &p) {
+//		// use p
+//	}
+//
+// It returns false and leaves ptr unchanged if the key is absent or the value is
+// not assignable to the type pointed to by ptr, instead of panicking as a type
+// assertion does. It panics if ptr is not a non-nil pointer.
+func (s *Session) ValueAs(key string, ptr interface{}) bool {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		panic("session: ValueAs requires a non-nil pointer")
+	}
+
+	v, ok := s.Lookup(key)
+	if !ok || v == nil {
+		return false
+	}
+	value := reflect.ValueOf(v)
+	if !value.Type().AssignableTo(rv.Elem().Type()) {
+		return false
+	}
+	rv.Elem().Set(value)
+	return true
+}
+
+// State returns a copy of all session state, so it can be iterated while the
+// session is modified by other goroutines
 func (s *Session) State() map[string]interface{} {
 	s.RLock()
 	defer s.RUnlock()
 
-	return s.data
+	data := make(map[string]interface{}, len(s.data))
+	for k, v := range s.data {
+		data[k] = v
+	}
+	return data
 }
 
-// Restore session state after reconnect
+// Restore session state after reconnect, data is copied so the caller can
+// keep using it
 func (s *Session) Restore(data map[string]interface{}) {
+	state := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		state[k] = v
+	}
+
 	s.Lock()
 	defer s.Unlock()
 
-	s.data = data
+	s.data = state
+}
+
+// Fork returns a detached copy of session with the same id, uid and data, the
+// messages of the copy are sent to entity. The lifetime hooks are not fired for
+// the copy, and the changes of its data and tags do not affect the session.
+func (s *Session) Fork(entity NetworkEntity) *Session {
+	s.RLock()
+	data := make(map[string]interface{}, len(s.data))
+	for k, v := range s.data {
+		data[k] = v
+	}
+	s.RUnlock()
+
+	return &Session{
+		id:        s.id,
+		uid:       atomic.LoadInt64(&s.uid),
+		lastTime:  s.lastTime,
+		entity:    entity,
+		data:      data,
+		router:    newRouter(),
+		callTimes: make([]msgCallTime, 0),
+	}
 }
 
 // Clear releases all data related to current session
@@ -434,14 +703,20 @@ func (s *Session) Deattach() {
 	s.entity = nil
 }
 
-//-----用于统计各节点性能-----
-//重置打点时间
+// Attach replaces the low-level network entity of the session, e.g: the session
+// is resumed on a new connection
+func (s *Session) Attach(entity NetworkEntity) {
+	s.entity = entity
+}
+
+// -----用于统计各节点性能-----
+// 重置打点时间
 func (s *Session) ResetCallTime() {
 	s.callInitTime = time.Now().UnixNano()
 	s.callTimes = s.callTimes[:0]
 }
 
-//返回毫秒时间
+// 返回毫秒时间
 func (s *Session) AddCallTime(name string) int64 {
 	now := time.Now().UnixNano()
 	diff := (now - s.callInitTime) / 1e6
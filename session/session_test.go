@@ -1,6 +1,9 @@
 package session
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestNewSession(t *testing.T) {
 	s := New(nil)
@@ -173,3 +176,155 @@ func TestSession_Restore(t *testing.T) {
 		t.Fail()
 	}
 }
+
+type streamEntity struct {
+	NetworkEntity
+	mid       uint64
+	responses []interface{}
+}
+
+func (e *streamEntity) LastMid() uint64 { return e.mid }
+
+func (e *streamEntity) ResponseMid(mid uint64, v interface{}) error {
+	if mid != e.mid {
+		return errors.New("unexpected mid")
+	}
+	e.responses = append(e.responses, v)
+	return nil
+}
+
+func TestSession_Stream(t *testing.T) {
+	e := &streamEntity{}
+	s := New(e)
+	if _, err := s.Stream(); err != ErrNoPendingRequest {
+		t.Fatalf("expect: %v, got: %v", ErrNoPendingRequest, err)
+	}
+
+	e.mid = 10
+	st, err := s.Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := st.Send(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(e.responses) != 3 {
+		t.Fatalf("expect: 3 responses, got: %d", len(e.responses))
+	}
+
+	if !s.CloseStream(10) {
+		t.Fatal("expect stream to be closed")
+	}
+	<-st.Done()
+	if err := st.Send(3); err != ErrStreamClosed {
+		t.Fatalf("expect: %v, got: %v", ErrStreamClosed, err)
+	}
+}
+
+func TestSession_StreamClosedWithSession(t *testing.T) {
+	s := New(&streamEntity{mid: 1})
+	st, err := s.Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Lifetime.Close(s)
+	select {
+	case <-st.Done():
+	default:
+		t.Fatal("expect stream to be closed with the session")
+	}
+}
+
+func TestSession_Lookup(t *testing.T) {
+	s := New(nil)
+	s.Set("int", 234)
+	s.Set("string", "hello")
+	s.Set("float64", 1.5)
+
+	if v, ok := s.LookupInt("int"); !ok || v != 234 {
+		t.Fatalf("expect: 234, got: %v %v", v, ok)
+	}
+	if v, ok := s.LookupString("string"); !ok || v != "hello" {
+		t.Fatalf("expect: hello, got: %v %v", v, ok)
+	}
+	if v, ok := s.LookupFloat64("float64"); !ok || v != 1.5 {
+		t.Fatalf("expect: 1.5, got: %v %v", v, ok)
+	}
+	if v, ok := s.LookupInt("string"); ok || v != 0 {
+		t.Fatalf("expect zero value on wrong type, got: %v %v", v, ok)
+	}
+	if v, ok := s.LookupString("absent"); ok || v != "" {
+		t.Fatalf("expect zero value on absent key, got: %v %v", v, ok)
+	}
+}
+
+func TestSession_ValueAs(t *testing.T) {
+	type player struct{ name string }
+	s := New(nil)
+	s.Set("player", &player{name: "nano"})
+	s.Set("error", errors.New("failed"))
+
+	var p *player
+	if !s.ValueAs("player", &p) || p.name != "nano" {
+		t.Fatalf("expect the player, got: %v", p)
+	}
+	var str string
+	if s.ValueAs("player", &str) || str != "" {
+		t.Fatal("expect false on wrong type")
+	}
+	if s.ValueAs("absent", &p) || p.name != "nano" {
+		t.Fatal("expect false on absent key and the pointer unchanged")
+	}
+	// the value is assignable to interface
+	var err error
+	if !s.ValueAs("error", &err) || err.Error() != "failed" {
+		t.Fatalf("expect the error, got: %v", err)
+	}
+}
+
+func TestSession_Tag(t *testing.T) {
+	a, b := New(nil), New(nil)
+	if err := a.Tag("state", "tutorial"); err != nil {
+		t.Fatal(err)
+	}
+	b.Tag("state", "tutorial")
+	if err := a.Tag("", "x"); err != ErrIllegalTag {
+		t.Fatalf("expect: %v, got: %v", ErrIllegalTag, err)
+	}
+
+	found, err := Sessions.FindByTag("state", "tutorial")
+	if err != nil || len(found) != 2 {
+		t.Fatalf("expect: 2 sessions, got: %v (%v)", found, err)
+	}
+
+	// the session is moved to the new value
+	b.Tag("state", "lobby")
+	if found, _ := Sessions.FindByTag("state", "tutorial"); len(found) != 1 || found[0] != a {
+		t.Fatalf("expect the session tagged with tutorial, got: %v", found)
+	}
+	if found, _ := Sessions.FindByTag("state", "lobby"); len(found) != 1 || found[0] != b {
+		t.Fatalf("expect the session tagged with lobby, got: %v", found)
+	}
+
+	a.Untag("state")
+	if found, _ := Sessions.FindByTag("state", "tutorial"); len(found) != 0 {
+		t.Fatalf("expect no session, got: %v", found)
+	}
+
+	// the closed sessions are removed from the store
+	Lifetime.Close(b)
+	if found, _ := Sessions.FindByTag("state", "lobby"); len(found) != 0 {
+		t.Fatalf("expect no session, got: %v", found)
+	}
+	if v, ok := b.TagValue("state"); !ok || v != "lobby" {
+		t.Fatalf("expect the tag to be available, got: %v %v", v, ok)
+	}
+
+	// the forked sessions are not indexed
+	a.Fork(nil).Tag("state", "shadow")
+	if found, _ := Sessions.FindByTag("state", "shadow"); len(found) != 0 {
+		t.Fatalf("expect no session, got: %v", found)
+	}
+}
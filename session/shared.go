@@ -0,0 +1,172 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/internal/packet"
+)
+
+// maxPooledPacket is the capacity above which the packet buffers are not returned
+// to the pool, so that a few huge broadcasts do not pin the memory
+const maxPooledPacket = 64 * 1024
+
+var packetPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
+// SharedMessage is a push message which is serialized once and shared by all the
+// sessions it is pushed to, e.g: the broadcast of a group. The packet of each
+// protocol version is encoded and framed at most once with a pooled buffer, and
+// the same byte slice is written to every connection.
+//
+// The message is reference counted, the buffers are returned to the pool once the
+// creator and all the sessions which queued it have released it.
+type SharedMessage struct {
+	Route   string
+	Payload []byte
+
+	refs    int32
+	mu      sync.Mutex
+	packets map[int]*[]byte
+}
+
+// SharedPusher is implemented by the network entities which can write a shared
+// message to the low-level connection without encoding it again.
+type SharedPusher interface {
+	PushShared(m *SharedMessage) error
+}
+
+// Multicaster is implemented by the network entities which can push a shared
+// message to a batch of sessions at once, e.g: the backend sessions served by the
+// same frontend are pushed with one request to the frontend.
+type Multicaster interface {
+	// MulticastKey returns the key of the batch the entity belongs to, the sessions
+	// whose entities return the same key are pushed together
+	MulticastKey() string
+	// Multicast pushes the message to the sessions of the batch
+	Multicast(sessions []*Session, m *SharedMessage) error
+}
+
+// NewSharedMessage returns a shared message of the serialized payload which holds
+// a reference owned by the caller
+func NewSharedMessage(route string, payload []byte) *SharedMessage {
+	return &SharedMessage{Route: route, Payload: payload, refs: 1}
+}
+
+// Retain adds a reference to the message
+func (m *SharedMessage) Retain() {
+	atomic.AddInt32(&m.refs, 1)
+}
+
+// Release drops a reference to the message, the packets must not be used after the
+// last reference is released
+func (m *SharedMessage) Release() {
+	if atomic.AddInt32(&m.refs, -1) != 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for version, buf := range m.packets {
+		if cap(*buf) <= maxPooledPacket {
+			packetPool.Put(buf)
+		}
+		delete(m.packets, version)
+	}
+}
+
+// Packet returns the packet of the message encoded with the protocol version, the
+// packet is encoded by the first caller and shared by the subsequent ones
+func (m *SharedMessage) Packet(version int) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if buf, ok := m.packets[version]; ok {
+		return *buf, nil
+	}
+
+	em, err := message.CodecOf(version).Encode(&message.Message{
+		Type:  message.Push,
+		Route: m.Route,
+		Data:  m.Payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+	head, err := codec.EncodeHead(packet.Data, len(em))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := packetPool.Get().(*[]byte)
+	*buf = append(append((*buf)[:0], head...), em...)
+	if m.packets == nil {
+		m.packets = map[int]*[]byte{}
+	}
+	m.packets[version] = buf
+	return *buf, nil
+}
+
+// PushShared pushes the shared message to client. The message is pushed as a normal
+// one if the low-level network entity does not support shared messages, e.g: the
+// session is the backend session of a remote gate.
+func (s *Session) PushShared(m *SharedMessage) error {
+	if sp, ok := s.entity.(SharedPusher); ok {
+		return sp.PushShared(m)
+	}
+	return s.entity.Push(m.Route, m.Payload)
+}
+
+// PushSharedAll pushes the shared message to the sessions, the sessions whose
+// network entities are Multicasters are pushed in batches, e.g: a group spanning
+// several frontend nodes costs one request per frontend. onError is called with
+// the sessions failed to push, which can be nil.
+func PushSharedAll(sessions []*Session, m *SharedMessage, onError func(s *Session, err error)) {
+	var batches map[string][]*Session
+	for _, s := range sessions {
+		if mc, ok := s.entity.(Multicaster); ok {
+			if batches == nil {
+				batches = map[string][]*Session{}
+			}
+			key := mc.MulticastKey()
+			batches[key] = append(batches[key], s)
+			continue
+		}
+		if err := s.PushShared(m); err != nil && onError != nil {
+			onError(s, err)
+		}
+	}
+	for _, batch := range batches {
+		err := batch[0].entity.(Multicaster).Multicast(batch, m)
+		if err != nil && onError != nil {
+			for _, s := range batch {
+				onError(s, err)
+			}
+		}
+	}
+}
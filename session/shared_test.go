@@ -0,0 +1,69 @@
+package session
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lonng/nano/internal/codec"
+	"github.com/lonng/nano/internal/message"
+	"github.com/lonng/nano/internal/packet"
+)
+
+type pushEntity struct {
+	NetworkEntity
+	routes []string
+}
+
+func (e *pushEntity) Push(route string, v interface{}) error {
+	e.routes = append(e.routes, route)
+	return nil
+}
+
+func TestSharedMessage_Packet(t *testing.T) {
+	m := NewSharedMessage("room.update", []byte("payload"))
+	for _, version := range []int{message.V1, message.V2} {
+		em, err := message.CodecOf(version).Encode(&message.Message{Type: message.Push, Route: "room.update", Data: []byte("payload")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect, _ := codec.Encode(packet.Data, em)
+
+		p1, err := m.Packet(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p1, expect) {
+			t.Fatalf("expect: %v, got: %v", expect, p1)
+		}
+		// the packet is encoded once and shared
+		p2, _ := m.Packet(version)
+		if &p1[0] != &p2[0] {
+			t.Fatalf("expect the packet of version %d shared", version)
+		}
+	}
+
+	m.Retain()
+	m.Release()
+	if len(m.packets) != 2 {
+		t.Fatalf("expect the packets kept while referenced, got: %d", len(m.packets))
+	}
+	m.Release()
+	if len(m.packets) != 0 {
+		t.Fatalf("expect the packets released, got: %d", len(m.packets))
+	}
+}
+
+func TestSession_PushShared(t *testing.T) {
+	e := &pushEntity{}
+	s := New(e)
+	m := NewSharedMessage("room.update", []byte("payload"))
+	defer m.Release()
+
+	// the entity which does not support shared messages receives a normal push
+	if err := s.PushShared(m); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.routes) != 1 || e.routes[0] != "room.update" {
+		t.Fatalf("expect the message pushed, got: %v", e.routes)
+	}
+}
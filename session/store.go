@@ -0,0 +1,121 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import "sync"
+
+// Store persists the uid bindings and the data of sessions out of the servers, so
+// that the state of a user survives the restarts of frontend servers, and any node
+// of the cluster can find where a user is online. The data values are encoded by
+// the caller.
+type Store interface {
+	// Bind records uid is online and bound to the session sid served by the node
+	// of addr
+	Bind(uid, sid int64, addr string) error
+	// Unbind removes the binding of uid if it is still bound to the session sid
+	Unbind(uid, sid int64) error
+	// Locate returns the addresses of the nodes serving the uids, the offline
+	// uids are absent
+	Locate(uids []int64) (map[int64]string, error)
+	// Save replaces the data saved for uid
+	Save(uid int64, data map[string][]byte) error
+	// Load returns the data saved for uid, which is nil if absent
+	Load(uid int64) (map[string][]byte, error)
+}
+
+type binding struct {
+	sid  int64
+	addr string
+}
+
+// MemoryStore is a Store which keeps everything in memory, which is used by the
+// single process deployments and tests
+type MemoryStore struct {
+	mu       sync.RWMutex
+	bindings map[int64]binding
+	data     map[int64]map[string][]byte
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		bindings: map[int64]binding{},
+		data:     map[int64]map[string][]byte{},
+	}
+}
+
+// Bind implements the Store interface
+func (m *MemoryStore) Bind(uid, sid int64, addr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bindings[uid] = binding{sid: sid, addr: addr}
+	return nil
+}
+
+// Unbind implements the Store interface
+func (m *MemoryStore) Unbind(uid, sid int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b, ok := m.bindings[uid]; ok && b.sid == sid {
+		delete(m.bindings, uid)
+	}
+	return nil
+}
+
+// Locate implements the Store interface
+func (m *MemoryStore) Locate(uids []int64) (map[int64]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	addrs := make(map[int64]string, len(uids))
+	for _, uid := range uids {
+		if b, ok := m.bindings[uid]; ok {
+			addrs[uid] = b.addr
+		}
+	}
+	return addrs, nil
+}
+
+// Save implements the Store interface
+func (m *MemoryStore) Save(uid int64, data map[string][]byte) error {
+	copied := make(map[string][]byte, len(data))
+	for k, v := range data {
+		copied[k] = append([]byte(nil), v...)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[uid] = copied
+	return nil
+}
+
+// Load implements the Store interface
+func (m *MemoryStore) Load(uid int64) (map[string][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	saved, ok := m.data[uid]
+	if !ok {
+		return nil, nil
+	}
+	data := make(map[string][]byte, len(saved))
+	for k, v := range saved {
+		data[k] = append([]byte(nil), v...)
+	}
+	return data, nil
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+func TestMemoryStore(t *testing.T) {
+	m := NewMemoryStore()
+	m.Bind(1001, 1, "127.0.0.1:3250")
+	m.Bind(1001, 2, "127.0.0.1:3251")
+
+	// the binding of the previous session is kept
+	m.Unbind(1001, 1)
+	if addrs, _ := m.Locate([]int64{1001, 1002}); len(addrs) != 1 || addrs[1001] != "127.0.0.1:3251" {
+		t.Fatalf("expect 1001 located at 127.0.0.1:3251, got: %v", addrs)
+	}
+	m.Unbind(1001, 2)
+	if addrs, _ := m.Locate([]int64{1001}); len(addrs) != 0 {
+		t.Fatalf("expect 1001 offline, got: %v", addrs)
+	}
+
+	if data, err := m.Load(1001); err != nil || data != nil {
+		t.Fatalf("expect no data, got: %v %v", data, err)
+	}
+	saved := map[string][]byte{"level": []byte("7")}
+	m.Save(1001, saved)
+	saved["level"][0] = '8'
+	if data, _ := m.Load(1001); string(data["level"]) != "7" {
+		t.Fatalf("expect: 7, got: %s", data["level"])
+	}
+}
+
+func TestRedisStore_Unreachable(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 100 * time.Millisecond,
+	})
+	defer client.Close()
+
+	r := NewRedisStore(client, "")
+	if err := r.Bind(1001, 1, "127.0.0.1:3250"); err == nil {
+		t.Fatalf("expect bind failed")
+	}
+	if _, err := r.Locate([]int64{1001}); err == nil {
+		t.Fatalf("expect locate failed")
+	}
+	if _, err := r.Load(1001); err == nil {
+		t.Fatalf("expect load failed")
+	}
+	if key := r.userKey(1001); key != "nano:session:user:1001" {
+		t.Fatalf("unexpected key: %s", key)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"errors"
+	"sync"
+)
+
+// StreamCancelRoute is the route of the notify which is sent by the client to
+// unsubscribe a stream, the payload is a JSON object which contains the id of
+// the request that opened the stream, e.g: {"mid": 12}
+const StreamCancelRoute = "sys.unsubscribe"
+
+var (
+	// ErrNoPendingRequest represents the session has no request to be streamed
+	ErrNoPendingRequest = errors.New("no pending request, stream must be opened in a request handler")
+	// ErrStreamClosed represents the stream has been closed
+	ErrStreamClosed = errors.New("stream closed")
+)
+
+// Stream emits multiple responses to a single request.
+//
+// Unlike Push, which sends a message to a route that the client listens to,
+// every message of a stream is a response to the request which opened the
+// stream, so the client can correlate the messages by the request id. The
+// client stops a stream by sending a notify to StreamCancelRoute, and all
+// streams of a session will be closed when the session is closed, handlers
+// should watch Done to stop emitting.
+type Stream struct {
+	session *Session
+	mid     uint64
+	once    sync.Once
+	done    chan struct{}
+}
+
+// Stream opens a stream of the request being handled, the stream must be
+// opened in the handler goroutine before the handler returns, because the
+// request id is changed once the next request arrives.
+func (s *Session) Stream() (*Stream, error) {
+	mid := s.LastMid()
+	if mid == 0 {
+		return nil, ErrNoPendingRequest
+	}
+
+	st := &Stream{
+		session: s,
+		mid:     mid,
+		done:    make(chan struct{}),
+	}
+
+	s.Lock()
+	if s.streams == nil {
+		s.streams = map[uint64]*Stream{}
+	}
+	if old, ok := s.streams[mid]; ok {
+		old.close()
+	}
+	s.streams[mid] = st
+	s.Unlock()
+	return st, nil
+}
+
+// CloseStream closes the stream opened by the request mid, returns false if
+// the stream does not exist.
+func (s *Session) CloseStream(mid uint64) bool {
+	s.Lock()
+	st, ok := s.streams[mid]
+	delete(s.streams, mid)
+	s.Unlock()
+
+	if ok {
+		st.close()
+	}
+	return ok
+}
+
+// closeStreams closes all streams of the session
+func (s *Session) closeStreams() {
+	s.Lock()
+	streams := s.streams
+	s.streams = nil
+	s.Unlock()
+
+	for _, st := range streams {
+		st.close()
+	}
+}
+
+// ID returns the id of the request which opened the stream
+func (st *Stream) ID() uint64 {
+	return st.mid
+}
+
+// Send emits a message of the stream
+func (st *Stream) Send(v interface{}) error {
+	select {
+	case <-st.done:
+		return ErrStreamClosed
+	default:
+	}
+	return st.session.ResponseMID(st.mid, v)
+}
+
+// Done returns a channel which is closed when the stream is closed by the
+// handler, unsubscribed by the client, or the session is closed.
+func (st *Stream) Done() <-chan struct{} {
+	return st.done
+}
+
+// Close stops the stream, subsequent Send will return ErrStreamClosed
+func (st *Stream) Close() {
+	st.session.Lock()
+	if st.session.streams[st.mid] == st {
+		delete(st.session.streams, st.mid)
+	}
+	st.session.Unlock()
+	st.close()
+}
+
+func (st *Stream) close() {
+	st.once.Do(func() { close(st.done) })
+}
@@ -0,0 +1,136 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrIllegalTag represents the tag key is empty
+var ErrIllegalTag = errors.New("illegal tag")
+
+// SessionStore indexes the sessions by their tags, so that the sessions with a
+// specific property can be found without iterating all sessions
+type SessionStore struct {
+	tags sync.Map // tag -> *sync.Map, the set of sessions with the tag
+}
+
+type tag struct {
+	key, value string
+}
+
+// Sessions is the store of the sessions of current node, sessions are indexed
+// once they are tagged, and removed from the store once they are closed.
+var Sessions = &SessionStore{}
+
+func (st *SessionStore) add(key, value string, s *Session) {
+	set, _ := st.tags.LoadOrStore(tag{key, value}, &sync.Map{})
+	set.(*sync.Map).Store(s.ID(), s)
+}
+
+func (st *SessionStore) remove(key, value string, s *Session) {
+	if set, ok := st.tags.Load(tag{key, value}); ok {
+		set.(*sync.Map).Delete(s.ID())
+	}
+}
+
+// FindByTag returns the sessions tagged with key and value
+func (st *SessionStore) FindByTag(key, value string) ([]*Session, error) {
+	if key == "" {
+		return nil, ErrIllegalTag
+	}
+	set, ok := st.tags.Load(tag{key, value})
+	if !ok {
+		return nil, nil
+	}
+	var sessions []*Session
+	set.(*sync.Map).Range(func(_, v interface{}) bool {
+		sessions = append(sessions, v.(*Session))
+		return true
+	})
+	return sessions, nil
+}
+
+// Tag tags the session with key and value, which replaces the previous value
+// of key. The session can be found by SessionStore.FindByTag then.
+func (s *Session) Tag(key, value string) error {
+	if key == "" {
+		return ErrIllegalTag
+	}
+	s.tagMu.Lock()
+	defer s.tagMu.Unlock()
+
+	old, ok := s.tags[key]
+	if ok && old == value {
+		return nil
+	}
+	if s.tags == nil {
+		s.tags = map[string]string{}
+	}
+	s.tags[key] = value
+	if s.store != nil {
+		s.store.add(key, value, s)
+		if ok {
+			s.store.remove(key, old, s)
+		}
+	}
+	return nil
+}
+
+// Untag removes the tag of key from the session
+func (s *Session) Untag(key string) {
+	s.tagMu.Lock()
+	defer s.tagMu.Unlock()
+
+	value, ok := s.tags[key]
+	if !ok {
+		return
+	}
+	delete(s.tags, key)
+	if s.store != nil {
+		s.store.remove(key, value, s)
+	}
+}
+
+// TagValue returns the value of the tag of key, the boolean is false if the
+// session is not tagged with key.
+func (s *Session) TagValue(key string) (string, bool) {
+	s.tagMu.Lock()
+	defer s.tagMu.Unlock()
+
+	value, ok := s.tags[key]
+	return value, ok
+}
+
+// untagAll removes the session from the store once the session is closed, the
+// tags are still available via TagValue but not indexed any more
+func (s *Session) untagAll() {
+	s.tagMu.Lock()
+	defer s.tagMu.Unlock()
+
+	if s.store != nil {
+		for key, value := range s.tags {
+			s.store.remove(key, value, s)
+		}
+	}
+	s.store = nil
+}
@@ -0,0 +1,213 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/lonng/nano/internal/log"
+)
+
+// Transactable is implemented by the components whose state can be changed in a
+// transaction with the other components, see TxManager. Commit and Rollback must
+// be idempotent, because they are called again for the transactions which have
+// not completed when the server crashed, and Rollback may be called for the
+// transactions which have not been prepared.
+type Transactable interface {
+	// Prepare validates and reserves the change described by payload, e.g: freezes
+	// the currency to deduct, so that the change can not fail in Commit.
+	Prepare(txID string, payload interface{}) error
+	// Commit applies the change prepared by the transaction.
+	Commit(txID string) error
+	// Rollback releases the change prepared by the transaction.
+	Rollback(txID string) error
+}
+
+// TxManager changes the state of multiple components atomically by two-phase
+// commit: the change is prepared by all components first, and then committed
+// only if all of them are prepared, otherwise rolled back. The transaction log is
+// persisted to the TxLog before each phase, so the transactions interrupted by a
+// crash can be completed by Recover after restart.
+type TxManager struct {
+	log TxLog
+}
+
+// Tx is a transaction of TxManager, which is not safe for concurrent use.
+type Tx struct {
+	m      *TxManager
+	record TxRecord
+	comps  []Transactable
+	args   []interface{}
+	done   bool
+}
+
+// NewTxManager returns a TxManager persisting the transaction log to log.
+func NewTxManager(log TxLog) *TxManager {
+	return &TxManager{log: log}
+}
+
+// Begin starts a transaction.
+func (m *TxManager) Begin() *Tx {
+	return &Tx{m: m, record: TxRecord{ID: uuid.New().String()}}
+}
+
+// participantName returns the name of the component in the transaction log, which
+// is the name of its type, the same as the default name of the component.
+func participantName(c Transactable) string {
+	return reflect.Indirect(reflect.ValueOf(c)).Type().Name()
+}
+
+// ID returns the id of the transaction.
+func (tx *Tx) ID() string {
+	return tx.record.ID
+}
+
+// Register adds the component to the transaction with the payload passed to its
+// Prepare. The payload is saved to the transaction log encoded as JSON.
+func (tx *Tx) Register(c Transactable, payload interface{}) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	name := participantName(c)
+	for _, p := range tx.record.Participants {
+		if p.Name == name {
+			return ErrDuplicateParticipant
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	tx.record.Participants = append(tx.record.Participants, TxParticipant{Name: name, Payload: data})
+	tx.comps = append(tx.comps, c)
+	tx.args = append(tx.args, payload)
+	return nil
+}
+
+// Commit prepares the change with all components, and commits it if all of them
+// are prepared, otherwise rolls it back and returns the error of Prepare. If any
+// component fails to commit, the error is returned and the transaction is kept in
+// the log to be committed again by Recover.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	tx.record.State = TxPreparing
+	if err := tx.m.log.Save(tx.record); err != nil {
+		return err
+	}
+	for i, c := range tx.comps {
+		if err := c.Prepare(tx.record.ID, tx.args[i]); err != nil {
+			if rerr := tx.m.abort(tx.record, tx.comps[:i+1]); rerr != nil {
+				return fmt.Errorf("prepare %s: %v, rollback: %v", tx.record.Participants[i].Name, err, rerr)
+			}
+			return err
+		}
+	}
+
+	// the transaction is committed once the decision is persisted
+	tx.record.State = TxCommitting
+	if err := tx.m.log.Save(tx.record); err != nil {
+		if rerr := tx.m.abort(tx.record, tx.comps); rerr != nil {
+			return fmt.Errorf("%v, rollback: %v", err, rerr)
+		}
+		return err
+	}
+	return tx.m.commit(tx.record, tx.comps)
+}
+
+// Rollback discards the transaction before it is committed, ErrTxDone is returned
+// if it has been committed or rolled back.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	return nil
+}
+
+// commit commits the transaction with the components, and removes it from the log
+// if all of them are committed.
+func (m *TxManager) commit(record TxRecord, comps []Transactable) error {
+	for i, c := range comps {
+		if err := c.Commit(record.ID); err != nil {
+			return fmt.Errorf("commit %s: %v", record.Participants[i].Name, err)
+		}
+	}
+	return m.log.Delete(record.ID)
+}
+
+// abort rolls back the transaction with the components, and removes it from the
+// log if all of them are rolled back.
+func (m *TxManager) abort(record TxRecord, comps []Transactable) error {
+	record.State = TxAborting
+	if err := m.log.Save(record); err != nil {
+		return err
+	}
+	for i, c := range comps {
+		if err := c.Rollback(record.ID); err != nil {
+			return fmt.Errorf("rollback %s: %v", record.Participants[i].Name, err)
+		}
+	}
+	return m.log.Delete(record.ID)
+}
+
+// Recover completes the transactions left in the log, e.g: by a crash, with the
+// components: the transactions deciding to commit are committed, and the others
+// are rolled back. It should be called after the components are initialized and
+// before any transaction begins. ErrUnknownParticipant is returned if a component
+// of the transactions is absent.
+func (m *TxManager) Recover(components ...Transactable) error {
+	byName := make(map[string]Transactable, len(components))
+	for _, c := range components {
+		byName[participantName(c)] = c
+	}
+
+	records, err := m.log.Pending()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		comps := make([]Transactable, 0, len(record.Participants))
+		for _, p := range record.Participants {
+			c, ok := byName[p.Name]
+			if !ok {
+				log.Println(fmt.Sprintf("Transaction %s can not be recovered without %s", record.ID, p.Name))
+				return ErrUnknownParticipant
+			}
+			comps = append(comps, c)
+		}
+		if record.State == TxCommitting {
+			err = m.commit(record, comps)
+		} else {
+			err = m.abort(record, comps)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+// TxState is the phase of a transaction saved in the transaction log.
+type TxState int
+
+// The phases of a transaction, the transactions in TxCommitting are committed by
+// TxManager.Recover, and the others are rolled back.
+const (
+	TxPreparing TxState = iota
+	TxCommitting
+	TxAborting
+)
+
+type (
+	// TxRecord is the transaction log of a transaction.
+	TxRecord struct {
+		ID           string          `json:"id"`
+		State        TxState         `json:"state"`
+		Participants []TxParticipant `json:"participants"`
+	}
+
+	// TxParticipant is a component registered to a transaction.
+	TxParticipant struct {
+		Name    string          `json:"name"`
+		Payload json.RawMessage `json:"payload"`
+	}
+)
+
+// TxLog is the durable store of the transaction log. The record of a transaction
+// is saved before each phase, and deleted once the transaction completes.
+type TxLog interface {
+	Save(record TxRecord) error
+	Delete(id string) error
+	// Pending returns the records of the transactions not completed.
+	Pending() ([]TxRecord, error)
+}
+
+// MemoryTxLog keeps the transaction log in memory, which does not survive server
+// restarts and is used in tests.
+type MemoryTxLog struct {
+	mu      sync.Mutex
+	records map[string]TxRecord
+	seq     map[string]int // order of the transactions
+	next    int
+}
+
+// NewMemoryTxLog returns an empty MemoryTxLog.
+func NewMemoryTxLog() *MemoryTxLog {
+	return &MemoryTxLog{records: map[string]TxRecord{}, seq: map[string]int{}}
+}
+
+// Save implements the TxLog interface
+func (l *MemoryTxLog) Save(record TxRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seq[record.ID]; !ok {
+		l.next++
+		l.seq[record.ID] = l.next
+	}
+	record.Participants = append([]TxParticipant(nil), record.Participants...)
+	l.records[record.ID] = record
+	return nil
+}
+
+// Delete implements the TxLog interface
+func (l *MemoryTxLog) Delete(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.records, id)
+	delete(l.seq, id)
+	return nil
+}
+
+// Pending implements the TxLog interface, the records are returned in the order
+// the transactions began.
+func (l *MemoryTxLog) Pending() ([]TxRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := make([]TxRecord, 0, len(l.records))
+	for _, r := range l.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return l.seq[records[i].ID] < l.seq[records[j].ID] })
+	return records, nil
+}
+
+// RedisTxLog saves the transaction log in a Redis hash, whose fields are the
+// transaction ids and values are the records encoded as JSON.
+type RedisTxLog struct {
+	client redis.Cmdable
+	key    string
+}
+
+// NewRedisTxLog returns a TxLog backed by Redis, the default key of the hash is
+// "nano:txlog". The Redis server should be configured with AOF persistence, so
+// that the log is durable.
+func NewRedisTxLog(client redis.Cmdable, key string) *RedisTxLog {
+	if key == "" {
+		key = "nano:txlog"
+	}
+	return &RedisTxLog{client: client, key: key}
+}
+
+// Save implements the TxLog interface
+func (r *RedisTxLog) Save(record TxRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(r.key, record.ID, data).Err()
+}
+
+// Delete implements the TxLog interface
+func (r *RedisTxLog) Delete(id string) error {
+	return r.client.HDel(r.key, id).Err()
+}
+
+// Pending implements the TxLog interface
+func (r *RedisTxLog) Pending() ([]TxRecord, error) {
+	values, err := r.client.HGetAll(r.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]TxRecord, 0, len(values))
+	for _, v := range values {
+		var record TxRecord
+		if err := json.Unmarshal([]byte(v), &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
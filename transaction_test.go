@@ -0,0 +1,146 @@
+package nano
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Wallet is a participant of transactions which records the calls
+type Wallet struct {
+	calls      []string
+	prepareErr error
+	commitErr  error
+}
+
+func (w *Wallet) Prepare(txID string, payload interface{}) error {
+	w.calls = append(w.calls, "prepare")
+	return w.prepareErr
+}
+
+func (w *Wallet) Commit(txID string) error {
+	w.calls = append(w.calls, "commit")
+	return w.commitErr
+}
+
+func (w *Wallet) Rollback(txID string) error {
+	w.calls = append(w.calls, "rollback")
+	return nil
+}
+
+type Bag struct {
+	Wallet
+}
+
+func beginTx(t *testing.T, log TxLog) (*Tx, *Wallet, *Bag) {
+	m := NewTxManager(log)
+	tx := m.Begin()
+	wallet, bag := &Wallet{}, &Bag{}
+	if err := tx.Register(wallet, map[string]int{"gold": -100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Register(bag, map[string]int{"sword": 1}); err != nil {
+		t.Fatal(err)
+	}
+	return tx, wallet, bag
+}
+
+func expectCalls(t *testing.T, name string, got []string, expect ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("%s: expect calls: %v, got: %v", name, expect, got)
+	}
+}
+
+func expectPending(t *testing.T, log TxLog, n int) []TxRecord {
+	t.Helper()
+	records, err := log.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != n {
+		t.Fatalf("expect %d pending transactions, got: %d", n, len(records))
+	}
+	return records
+}
+
+func TestTx_Commit(t *testing.T) {
+	log := NewMemoryTxLog()
+	tx, wallet, bag := beginTx(t, log)
+	if err := tx.Register(&Wallet{}, nil); err != ErrDuplicateParticipant {
+		t.Fatalf("expect: %v, got: %v", ErrDuplicateParticipant, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls(t, "wallet", wallet.calls, "prepare", "commit")
+	expectCalls(t, "bag", bag.calls, "prepare", "commit")
+	expectPending(t, log, 0)
+
+	if err := tx.Commit(); err != ErrTxDone {
+		t.Fatalf("expect: %v, got: %v", ErrTxDone, err)
+	}
+	if err := tx.Rollback(); err != ErrTxDone {
+		t.Fatalf("expect: %v, got: %v", ErrTxDone, err)
+	}
+}
+
+func TestTx_PrepareFailed(t *testing.T) {
+	log := NewMemoryTxLog()
+	tx, wallet, bag := beginTx(t, log)
+	bag.prepareErr = errors.New("bag is full")
+	if err := tx.Commit(); err != bag.prepareErr {
+		t.Fatalf("expect: %v, got: %v", bag.prepareErr, err)
+	}
+	expectCalls(t, "wallet", wallet.calls, "prepare", "rollback")
+	expectCalls(t, "bag", bag.calls, "prepare", "rollback")
+	expectPending(t, log, 0)
+}
+
+func TestTx_Rollback(t *testing.T) {
+	log := NewMemoryTxLog()
+	tx, wallet, bag := beginTx(t, log)
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != ErrTxDone {
+		t.Fatalf("expect: %v, got: %v", ErrTxDone, err)
+	}
+	expectCalls(t, "wallet", wallet.calls)
+	expectCalls(t, "bag", bag.calls)
+	expectPending(t, log, 0)
+}
+
+func TestTxManager_Recover(t *testing.T) {
+	log := NewMemoryTxLog()
+
+	// the commit failed after the decision is persisted
+	tx, wallet, bag := beginTx(t, log)
+	bag.commitErr = errors.New("crash")
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expect the commit to fail")
+	}
+	records := expectPending(t, log, 1)
+	if records[0].State != TxCommitting || string(records[0].Participants[1].Payload) != `{"sword":1}` {
+		t.Fatalf("unexpected record: %+v", records[0])
+	}
+
+	// the server crashed while preparing
+	preparing := TxRecord{ID: "preparing", State: TxPreparing, Participants: []TxParticipant{{Name: "Wallet"}}}
+	if err := log.Save(preparing); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewTxManager(log)
+	if err := m.Recover(wallet); err != ErrUnknownParticipant {
+		t.Fatalf("expect: %v, got: %v", ErrUnknownParticipant, err)
+	}
+
+	wallet.calls, bag.calls, bag.commitErr = nil, nil, nil
+	if err := m.Recover(wallet, bag); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls(t, "wallet", wallet.calls, "commit", "rollback")
+	expectCalls(t, "bag", bag.calls, "commit")
+	expectPending(t, log, 0)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) nano Authors. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"github.com/lonng/nano/internal/runtime"
+	"github.com/lonng/nano/session"
+)
+
+// SendToUser pushes the message to the sessions bound to uid, i.e. all devices of
+// the user, the message will be forwarded to the frontend node serving the user in
+// cluster mode. ErrUserNotFound will be returned if the user is offline.
+func SendToUser(uid int64, route string, v interface{}) error {
+	if runtime.CurrentNode == nil {
+		return ErrUserNotFound
+	}
+	return runtime.CurrentNode.SendToUser(uid, route, v)
+}
+
+// PushToUID pushes the message to the sessions bound to uid, which may be served by
+// any frontend node in cluster mode, e.g: from the game logic of backend nodes. It
+// reports whether the message is delivered, false if the user is not online.
+func PushToUID(uid int64, route string, v interface{}) (bool, error) {
+	if runtime.CurrentNode == nil {
+		return false, nil
+	}
+	return runtime.CurrentNode.PushToUID(uid, route, v)
+}
+
+// SendToDevice pushes the message to the session bound to uid with the device tag
+// by session.BindDevice, e.g: "companion". ErrUserNotFound will be returned if the
+// user is not online on the device. In cluster mode, the devices of a user are
+// located on the frontend node serving the latest bound one.
+func SendToDevice(uid int64, device, route string, v interface{}) error {
+	if runtime.CurrentNode == nil {
+		return ErrUserNotFound
+	}
+	return runtime.CurrentNode.SendToDevice(uid, device, route, v)
+}
+
+// MultiSend pushes the message to the sessions bound to uids, and returns the uids
+// of the offline users, e.g: to deliver the message by mail.
+func MultiSend(uids []int64, route string, v interface{}) ([]int64, error) {
+	if runtime.CurrentNode == nil {
+		return uids, nil
+	}
+	return runtime.CurrentNode.MultiSend(uids, route, v)
+}
+
+// KickUser kicks the session bound to uid with the reason, which is sent to the
+// client in the kick packet. ErrUserNotFound will be returned if the user is offline.
+func KickUser(uid int64, reason string) error {
+	if runtime.CurrentNode == nil {
+		return ErrUserNotFound
+	}
+	return runtime.CurrentNode.KickUser(uid, reason)
+}
+
+// KickUID pushes the reason to the session bound to uid with the route "onKick"
+// and closes it, the reason can be any value supported by the serializer, e.g: a
+// protobuf message telling the client it is banned or logged in elsewhere.
+// ErrUserNotFound will be returned if the user is offline.
+func KickUID(uid int64, reason interface{}) error {
+	if runtime.CurrentNode == nil {
+		return ErrUserNotFound
+	}
+	return runtime.CurrentNode.KickUID(uid, reason)
+}
+
+// GetByUID returns the latest session bound to uid in current node, nil will be
+// returned if the user is not online on current node.
+func GetByUID(uid int64) *session.Session {
+	if runtime.CurrentNode == nil {
+		return nil
+	}
+	return runtime.CurrentNode.FindUser(uid)
+}
+
+// SessionCount returns the number of the sessions of current node, including the
+// sessions of the remote clients on the backend nodes.
+func SessionCount() int {
+	if runtime.CurrentNode == nil {
+		return 0
+	}
+	return runtime.CurrentNode.SessionCount()
+}
+
+// RangeSessions calls f for each session of current node until f returns false,
+// f can close or bind the sessions.
+func RangeSessions(f func(s *session.Session) bool) {
+	if runtime.CurrentNode == nil {
+		return
+	}
+	runtime.CurrentNode.RangeSessions(f)
+}